@@ -0,0 +1,115 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package benchmarks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.elastic.co/fastjson"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+// publishBatchSize keeps a batch of large messages under the default 4MiB
+// limit of gRPC.
+const publishBatchSize = 32
+
+var (
+	valueResult   *messages.Value
+	marshalResult []byte
+)
+
+func TestShapes(t *testing.T) {
+	for _, shape := range Shapes() {
+		e, err := shape.Event()
+		require.NoError(t, err, shape.Name)
+		require.NoError(t, helpers.NewValidator().Validate(e), shape.Name)
+		require.Equal(t, shape.DataStream, helpers.DataStreamFromEvent(e))
+	}
+}
+
+func BenchmarkNewValue(b *testing.B) {
+	for _, shape := range Shapes() {
+		fields := shape.Fields()
+		b.Run(shape.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				v, err := helpers.NewValue(fields)
+				if err != nil {
+					b.Fatal(err)
+				}
+				valueResult = v
+			}
+		})
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	for _, shape := range Shapes() {
+		e, err := shape.Event()
+		require.NoError(b, err)
+
+		b.Run(shape.Name+"/proto", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := proto.Marshal(e)
+				if err != nil {
+					b.Fatal(err)
+				}
+				marshalResult = data
+			}
+			b.SetBytes(int64(len(marshalResult)))
+		})
+		b.Run(shape.Name+"/json", func(b *testing.B) {
+			b.ReportAllocs()
+			var w fastjson.Writer
+			for i := 0; i < b.N; i++ {
+				w.Reset()
+				if err := e.Fields.MarshalFastJSON(&w); err != nil {
+					b.Fatal(err)
+				}
+			}
+			marshalResult = w.Bytes()
+			b.SetBytes(int64(len(marshalResult)))
+		})
+	}
+}
+
+// BenchmarkPublish measures publishing batches of events to the in-memory
+// shipper, reporting the time per event.
+func BenchmarkPublish(b *testing.B) {
+	srv := servertest.New(servertest.Options{AutoPersist: true, DiscardEvents: true})
+	srv.Start()
+	defer srv.Stop()
+
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: []grpc.DialOption{srv.DialOption()},
+	})
+	require.NoError(b, err)
+	defer c.Close()
+
+	for _, shape := range Shapes() {
+		events, err := shape.Events(publishBatchSize)
+		require.NoError(b, err)
+		req := &messages.PublishRequest{Events: events}
+
+		b.Run(shape.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i += publishBatchSize {
+				if _, err := c.Publish(context.Background(), req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
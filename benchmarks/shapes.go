@@ -0,0 +1,132 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package benchmarks measures the cost of building, marshaling and
+// publishing representative events. Run it with "mage benchmark" to compare
+// against the stored baseline, and "mage benchmarkBaseline" to update it.
+package benchmarks
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Shape is a representative kind of event.
+type Shape struct {
+	// Name identifies the shape in the benchmark names.
+	Name string
+	// Fields returns a new copy of the event fields.
+	Fields func() map[string]interface{}
+	// DataStream the events are routed to.
+	DataStream helpers.DataStream
+}
+
+// Shapes returns the event shapes used by the benchmarks:
+//
+//   - "flat_metrics": a metricset with a few dozen numeric fields.
+//   - "nested_logs": a log line with ECS objects a few levels deep.
+//   - "large_message": a log line with a 64KiB message and a long stack trace.
+func Shapes() []Shape {
+	return []Shape{
+		{
+			Name:       "flat_metrics",
+			Fields:     flatMetrics,
+			DataStream: helpers.DataStream{Type: "metrics", Dataset: "system.cpu", Namespace: "default"},
+		},
+		{
+			Name:       "nested_logs",
+			Fields:     nestedLogs,
+			DataStream: helpers.DataStream{Type: "logs", Dataset: "nginx.access", Namespace: "default"},
+		},
+		{
+			Name:       "large_message",
+			Fields:     largeMessage,
+			DataStream: helpers.DataStream{Type: "logs", Dataset: "generic", Namespace: "default"},
+		},
+	}
+}
+
+// Event builds an event of the shape.
+func (s Shape) Event() (*messages.Event, error) {
+	b := helpers.NewEventBuilder().
+		SetTimestamp(timestamp).
+		SetSource("benchmarks", s.Name).
+		SetDataStream(s.DataStream.Type, s.DataStream.Dataset, s.DataStream.Namespace)
+	for k, v := range s.Fields() {
+		b.AddField(k, v)
+	}
+	return b.Build()
+}
+
+// Events builds n events of the shape.
+func (s Shape) Events(n int) ([]*messages.Event, error) {
+	events := make([]*messages.Event, n)
+	for i := range events {
+		e, err := s.Event()
+		if err != nil {
+			return nil, err
+		}
+		events[i] = e
+	}
+	return events, nil
+}
+
+var timestamp = time.Date(2022, 8, 4, 18, 17, 28, 0, time.UTC)
+
+func flatMetrics() map[string]interface{} {
+	fields := map[string]interface{}{
+		"metricset.name":   "cpu",
+		"host.name":        "web-1",
+		"system.cpu.cores": 8,
+	}
+	for _, state := range []string{"user", "system", "idle", "iowait", "irq", "softirq", "steal", "nice"} {
+		fields["system.cpu."+state+".pct"] = 0.125
+		fields["system.cpu."+state+".norm.pct"] = 0.015625
+		fields["system.cpu."+state+".ticks"] = int64(123456789)
+	}
+	return fields
+}
+
+func nestedLogs() map[string]interface{} {
+	return map[string]interface{}{
+		"message": `10.0.0.1 - - [04/Aug/2022:18:17:28 +0000] "GET /index.html HTTP/1.1" 200 512 "-" "curl/7.79.1"`,
+		"log": map[string]interface{}{
+			"file":   map[string]interface{}{"path": "/var/log/nginx/access.log"},
+			"offset": int64(4096),
+		},
+		"host": map[string]interface{}{
+			"name": "web-1",
+			"ip":   []interface{}{"10.0.0.1", "fe80::1"},
+			"os":   map[string]interface{}{"family": "debian", "kernel": "5.15.0", "name": "Ubuntu"},
+		},
+		"http": map[string]interface{}{
+			"request":  map[string]interface{}{"method": "GET", "referrer": "-"},
+			"response": map[string]interface{}{"status_code": 200, "body": map[string]interface{}{"bytes": int64(512)}},
+			"version":  "1.1",
+		},
+		"url":        map[string]interface{}{"original": "/index.html"},
+		"user_agent": map[string]interface{}{"original": "curl/7.79.1"},
+		"source":     map[string]interface{}{"address": "10.0.0.1", "ip": "10.0.0.1"},
+		"tags":       []interface{}{"nginx", "access", "forwarded"},
+	}
+}
+
+func largeMessage() map[string]interface{} {
+	var trace strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&trace, "\tat com.example.service.Handler.handle%d(Handler.java:%d)\n", i, 100+i)
+	}
+	return map[string]interface{}{
+		"message": strings.Repeat("lorem ipsum dolor sit amet ", 64*1024/27),
+		"error": map[string]interface{}{
+			"type":        "java.lang.IllegalStateException",
+			"stack_trace": trace.String(),
+		},
+		"host": map[string]interface{}{"name": "app-1"},
+	}
+}
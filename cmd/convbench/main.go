@@ -0,0 +1,133 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Command convbench runs the same inputs through every available conversion
+// strategy and reports ns/op and allocs/op as CSV or markdown.
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"testing"
+)
+
+type result struct {
+	strategy string
+	input    string
+	nsPerOp  int64
+	allocs   int64
+	bytes    int64
+	err      error
+}
+
+func main() {
+	format := flag.String("format", "markdown", "report format, one of csv or markdown")
+	output := flag.String("o", "", "write the report to this file instead of stdout")
+	flag.Parse()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("failed to create report file: %s", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	results := run()
+
+	var err error
+	switch *format {
+	case "csv":
+		err = writeCSV(w, results)
+	case "markdown":
+		err = writeMarkdown(w, results)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		log.Fatalf("failed to write report: %s", err)
+	}
+}
+
+func run() []result {
+	var results []result
+	for _, in := range inputs {
+		for _, s := range strategies {
+			r := result{strategy: s.name, input: in.name}
+			// check once outside of the benchmark, so a failing strategy is reported instead of measured
+			if err := s.convert(in); err != nil {
+				r.err = err
+				results = append(results, r)
+				continue
+			}
+
+			convert, data := s.convert, in
+			bench := testing.Benchmark(func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_ = convert(data)
+				}
+			})
+			r.nsPerOp = bench.NsPerOp()
+			r.allocs = bench.AllocsPerOp()
+			r.bytes = bench.AllocedBytesPerOp()
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+func writeCSV(w io.Writer, results []result) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"input", "strategy", "ns/op", "allocs/op", "B/op", "error"}); err != nil {
+		return err
+	}
+	for _, r := range results {
+		errStr := ""
+		if r.err != nil {
+			errStr = r.err.Error()
+		}
+		record := []string{
+			r.input,
+			r.strategy,
+			strconv.FormatInt(r.nsPerOp, 10),
+			strconv.FormatInt(r.allocs, 10),
+			strconv.FormatInt(r.bytes, 10),
+			errStr,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeMarkdown(w io.Writer, results []result) error {
+	if _, err := fmt.Fprintln(w, "| input | strategy | ns/op | allocs/op | B/op |"); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "|---|---|---:|---:|---:|"); err != nil {
+		return err
+	}
+	for _, r := range results {
+		var err error
+		if r.err != nil {
+			_, err = fmt.Fprintf(w, "| %s | %s | error: %s | | |\n", r.input, r.strategy, r.err)
+		} else {
+			_, err = fmt.Fprintf(w, "| %s | %s | %d | %d | %d |\n", r.input, r.strategy, r.nsPerOp, r.allocs, r.bytes)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+)
+
+// strategy is one way of converting an input into a proto struct, from its
+// Go map or its JSON encoding.
+type strategy struct {
+	name    string
+	convert func(input) error
+}
+
+// pool is shared by the runs of the ValuePool strategy.
+var pool = helpers.NewValuePool()
+
+// converter is shared by the runs of the Converter strategy, it is reset
+// after every conversion like after publishing a batch.
+var converter = helpers.NewConverter()
+
+// strategies lists every conversion path compared by the report.
+var strategies = []strategy{
+	{
+		name: "helpers.NewStruct",
+		convert: func(in input) error {
+			_, err := helpers.NewStruct(in.data)
+			return err
+		},
+	},
+	{
+		name: "helpers.ValuePool",
+		convert: func(in input) error {
+			st, err := pool.NewStruct(in.data)
+			pool.ReleaseStruct(st)
+			return err
+		},
+	},
+	{
+		name: "helpers.Converter",
+		convert: func(in input) error {
+			_, err := converter.Convert(in.data)
+			converter.Reset()
+			return err
+		},
+	},
+	{
+		// every field is converted, the worst case of the lazy path, which
+		// pays off when few fields of the events are accessed
+		name: "helpers.LazyStruct",
+		convert: func(in input) error {
+			l, err := helpers.NewLazyStruct(in.json)
+			if err != nil {
+				return err
+			}
+			_, err = l.Struct()
+			return err
+		},
+	},
+	{
+		name: "structpb.NewStruct",
+		convert: func(in input) error {
+			_, err := structpb.NewStruct(in.data)
+			return err
+		},
+	},
+}
+
+// input is a representative event shape used as benchmark input.
+type input struct {
+	name string
+	data map[string]interface{}
+	// json is data encoded, for the strategies reading raw events
+	json []byte
+}
+
+func init() {
+	for i := range inputs {
+		data, err := json.Marshal(inputs[i].data)
+		if err != nil {
+			panic(err)
+		}
+		inputs[i].json = data
+	}
+}
+
+// inputs only use types supported by every strategy, so results are comparable.
+var inputs = []input{
+	{
+		name: "flat metrics",
+		data: map[string]interface{}{
+			"cpu.user":      12.5,
+			"cpu.system":    3.25,
+			"cpu.idle":      84.25,
+			"memory.used":   int64(8321499136),
+			"memory.free":   int64(8858370048),
+			"host.name":     "host-1",
+			"service.type":  "system",
+			"metricset":     "cpu",
+			"event.module":  "system",
+			"event.success": true,
+		},
+	},
+	{
+		name: "nested log",
+		data: map[string]interface{}{
+			"message": "GET /index.html HTTP/1.1 200 512",
+			"log": map[string]interface{}{
+				"level": "info",
+				"file": map[string]interface{}{
+					"path":   "/var/log/nginx/access.log",
+					"offset": int64(23456),
+				},
+			},
+			"http": map[string]interface{}{
+				"request": map[string]interface{}{
+					"method": "GET",
+					"headers": map[string]interface{}{
+						"user-agent": "curl/7.79.1",
+						"accept":     "*/*",
+					},
+				},
+				"response": map[string]interface{}{
+					"status_code": 200,
+					"bytes":       512,
+				},
+			},
+			"tags": []interface{}{"nginx", "access", "production"},
+		},
+	},
+	{
+		name: "large message",
+		data: map[string]interface{}{
+			"message": string(make([]byte, 64*1024)),
+			"error": map[string]interface{}{
+				"stack_trace": []interface{}{
+					"main.main()", "runtime.main()", "runtime.goexit()",
+				},
+			},
+		},
+	},
+}
@@ -0,0 +1,79 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Command schemainfer reads newline-delimited JSON objects, from the files
+// given as arguments or stdin, and reports the type of every field, flagging
+// the fields Elasticsearch can't map, like sometimes strings and sometimes
+// numbers. It exits with status 1 when there are conflicts.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+)
+
+func main() {
+	conflictsOnly := flag.Bool("conflicts", false, "only report the fields with conflicting types")
+	flag.Parse()
+
+	inferrer := helpers.NewSchemaInferrer()
+	if flag.NArg() == 0 {
+		if err := observe(inferrer, "stdin", os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, path := range flag.Args() {
+		if err := observeFile(inferrer, path); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	schema := inferrer.Schema()
+	conflicts := schema.Conflicts()
+	if *conflictsOnly {
+		schema = conflicts
+	}
+	if err := schema.Write(os.Stdout); err != nil {
+		log.Fatalf("failed to write the schema: %s", err)
+	}
+	if len(conflicts) > 0 {
+		fmt.Fprintf(os.Stderr, "%d fields with conflicting types in %d objects\n", len(conflicts), inferrer.Count())
+		os.Exit(1)
+	}
+}
+
+func observeFile(inferrer *helpers.SchemaInferrer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return observe(inferrer, path, f)
+}
+
+// observe adds every line of r, a JSON object, to inferrer.
+func observe(inferrer *helpers.SchemaInferrer, name string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		st, err := helpers.StructFromJSON(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		inferrer.Observe(st)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/config"
+)
+
+// connFlags are the flags of the connection to the shipper, shared by the
+// commands.
+type connFlags struct {
+	server     string
+	configPath string
+	ca         string
+}
+
+func (f *connFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.server, "server", "", "address of the shipper, host:port or a unix:// or npipe:// address")
+	fs.StringVar(&f.configPath, "config", "", "YAML file of the shipper output block, the other flags override it")
+	fs.StringVar(&f.ca, "ca", "", "certificate authority of the shipper, enables TLS")
+}
+
+// dial connects to the shipper.
+func (f *connFlags) dial(ctx context.Context) (*client.Client, error) {
+	c := config.DefaultConfig()
+	if f.configPath != "" {
+		data, err := os.ReadFile(f.configPath)
+		if err != nil {
+			return nil, err
+		}
+		if c, err = config.FromYAML(data); err != nil {
+			return nil, err
+		}
+	}
+	if f.server != "" {
+		c.Server = f.server
+	}
+	if c.Server == "" {
+		return nil, errors.New("-server or -config is required")
+	}
+	if f.ca != "" {
+		c.TLS = &tlscommon.Config{CAs: []string{f.ca}}
+	}
+	return c.NewClient(ctx)
+}
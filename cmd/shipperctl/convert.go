@@ -0,0 +1,212 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// The events are read and written as the event documents of
+// helpers.EventFromDocument, or as a binary or text PublishRequest holding
+// all the events.
+
+func runConvert(_ context.Context, args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	from := fs.String("from", "json", "input format: json, yaml or proto")
+	to := fs.String("to", "json", "output format: json, ndjson, yaml, proto or text")
+	output := fs.String("o", "", "write the output to this file instead of stdout")
+	validate := fs.Bool("validate", false, "validate the events, the command fails if one is invalid")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: shipperctl convert [flags] [file]")
+		fmt.Fprintln(fs.Output(), "\nConverts the events of the file, or stdin, between JSON or YAML documents and")
+		fmt.Fprintln(fs.Output(), "the binary or text format of a PublishRequest, the json input is a stream or")
+		fmt.Fprintln(fs.Output(), "an array of objects, the yaml input a stream of documents.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("at most one input file is supported")
+	}
+
+	in := io.Reader(os.Stdin)
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	events, err := readEvents(in, *from)
+	if err != nil {
+		return err
+	}
+
+	if *validate {
+		validator := helpers.NewValidator()
+		invalid := 0
+		for i, e := range events {
+			if err := validator.Validate(e); err != nil {
+				invalid++
+				fmt.Fprintf(os.Stderr, "event %d: %s\n", i+1, err)
+			}
+		}
+		if invalid > 0 {
+			return fmt.Errorf("%d invalid events out of %d", invalid, len(events))
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeEvents(&out, events, *to); err != nil {
+		return err
+	}
+	if *output != "" {
+		return os.WriteFile(*output, out.Bytes(), 0o644) //nolint:gosec // fixtures are not secrets
+	}
+	_, err = os.Stdout.Write(out.Bytes())
+	return err
+}
+
+func readEvents(in io.Reader, format string) ([]*messages.Event, error) {
+	switch format {
+	case "json":
+		return readJSONEvents(in)
+	case "yaml":
+		return readYAMLEvents(in)
+	case "proto":
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return nil, err
+		}
+		var req messages.PublishRequest
+		if err := proto.Unmarshal(data, &req); err != nil {
+			return nil, fmt.Errorf("invalid PublishRequest: %w", err)
+		}
+		return req.Events, nil
+	}
+	return nil, fmt.Errorf("unknown input format %q", format)
+}
+
+func readJSONEvents(in io.Reader) ([]*messages.Event, error) {
+	dec := json.NewDecoder(in)
+	var docs []json.RawMessage
+	for {
+		var doc json.RawMessage
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", len(docs)+1, err)
+		}
+		if trimmed := bytes.TrimSpace(doc); len(trimmed) > 0 && trimmed[0] == '[' {
+			var items []json.RawMessage
+			if err := json.Unmarshal(doc, &items); err != nil {
+				return nil, fmt.Errorf("document %d: %w", len(docs)+1, err)
+			}
+			docs = append(docs, items...)
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	events := make([]*messages.Event, 0, len(docs))
+	for i, doc := range docs {
+		e, err := helpers.EventFromJSON(doc, nil)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i+1, err)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func readYAMLEvents(in io.Reader) ([]*messages.Event, error) {
+	dec := yaml.NewDecoder(in)
+	var events []*messages.Event
+	for {
+		var doc map[string]interface{}
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", len(events)+1, err)
+		}
+		st, err := helpers.NewStructWithOptions(doc, helpers.WithMapKeys(helpers.MapKeysFormat))
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", len(events)+1, err)
+		}
+		e, err := helpers.EventFromDocument(st, nil)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", len(events)+1, err)
+		}
+		events = append(events, e)
+	}
+}
+
+func writeEvents(out *bytes.Buffer, events []*messages.Event, format string) error {
+	switch format {
+	case "json", "ndjson":
+		for _, e := range events {
+			data, err := helpers.StructToJSON(helpers.EventToDocument(e))
+			if err != nil {
+				return err
+			}
+			if format == "json" {
+				if err := json.Indent(out, data, "", "  "); err != nil {
+					return err
+				}
+			} else {
+				out.Write(data)
+			}
+			out.WriteByte('\n')
+		}
+		return nil
+	case "yaml":
+		for i, e := range events {
+			data, err := helpers.StructToYAML(helpers.EventToDocument(e))
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				out.WriteString("---\n")
+			}
+			out.Write(data)
+		}
+		return nil
+	case "proto":
+		data, err := proto.Marshal(&messages.PublishRequest{Events: events})
+		if err != nil {
+			return err
+		}
+		out.Write(data)
+		return nil
+	case "text":
+		data, err := prototext.MarshalOptions{Multiline: true}.Marshal(&messages.PublishRequest{Events: events})
+		if err != nil {
+			return err
+		}
+		out.Write(data)
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
@@ -0,0 +1,93 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/fixtures"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func convertFile(t *testing.T, in string, args ...string) string {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "out")
+	require.NoError(t, runConvert(context.Background(), append(append(args, "-o", out), in)))
+	return out
+}
+
+func readFile(t *testing.T, name, format string) []*messages.Event {
+	t.Helper()
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	events, err := readEvents(f, format)
+	require.NoError(t, err)
+	return events
+}
+
+func requireSameEvents(t *testing.T, expected, actual []*messages.Event) {
+	t.Helper()
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		require.True(t, proto.Equal(expected[i], actual[i]), "event %d:\n%v\n%v", i+1, expected[i], actual[i])
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	var docs [][]byte
+	var expected []*messages.Event
+	for _, name := range fixtures.Names() {
+		data, err := fixtures.JSON(name)
+		require.NoError(t, err)
+		docs = append(docs, data)
+		expected = append(expected, fixtures.MustEvent(name))
+	}
+	in := filepath.Join(t.TempDir(), "events.json")
+	require.NoError(t, os.WriteFile(in, append(append([]byte("["), bytes.Join(docs, []byte(","))...), ']'), 0o600))
+
+	ndjson := convertFile(t, in, "-to", "ndjson")
+	requireSameEvents(t, expected, readFile(t, ndjson, "json"))
+
+	yaml := convertFile(t, ndjson, "-to", "yaml")
+	requireSameEvents(t, expected, readFile(t, yaml, "yaml"))
+
+	binary := convertFile(t, yaml, "-from", "yaml", "-to", "proto")
+	requireSameEvents(t, expected, readFile(t, binary, "proto"))
+
+	indented := convertFile(t, binary, "-from", "proto", "-to", "json")
+	requireSameEvents(t, expected, readFile(t, indented, "json"))
+
+	text, err := os.ReadFile(convertFile(t, indented, "-to", "text"))
+	require.NoError(t, err)
+	var req messages.PublishRequest
+	require.NoError(t, prototext.Unmarshal(text, &req))
+	requireSameEvents(t, expected, req.Events)
+}
+
+func TestConvertValidate(t *testing.T) {
+	in := filepath.Join(t.TempDir(), "events.json")
+	valid, err := fixtures.JSON(fixtures.Names()[0])
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(in, append(valid, `{"fields": {"message": "no source"}}`...), 0o600))
+	out := filepath.Join(t.TempDir(), "out")
+
+	// the events are converted as long as they aren't validated
+	require.NoError(t, runConvert(context.Background(), []string{"-o", out, in}))
+	require.Len(t, readFile(t, out, "json"), 2)
+
+	require.NoError(t, os.Remove(out))
+	err = runConvert(context.Background(), []string{"-validate", "-o", out, in})
+	require.EqualError(t, err, "1 invalid events out of 2")
+	require.NoFileExists(t, out)
+}
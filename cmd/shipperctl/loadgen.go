@@ -0,0 +1,52 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/loadgen"
+)
+
+func runLoadgen(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	var conn connFlags
+	conn.register(fs)
+	var config loadgen.Config
+	fs.IntVar(&config.EPS, "eps", loadgen.DefaultEPS, "target rate in events per second")
+	fs.IntVar(&config.BatchSize, "batch", loadgen.DefaultBatchSize, "number of events per request")
+	fs.IntVar(&config.Workers, "workers", loadgen.DefaultWorkers, "number of concurrent requests")
+	fs.DurationVar(&config.Duration, "duration", 10*time.Second, "duration of the run, 0 runs until interrupted")
+	fs.StringVar(&config.Generator.Kind, "kind", loadgen.KindLogs, "kind of events: logs or metrics")
+	fs.IntVar(&config.Generator.Cardinality, "cardinality", loadgen.DefaultCardinality, "number of distinct hosts")
+	fs.StringVar(&config.Generator.InputID, "input-id", loadgen.DefaultInputID, "input ID of the events")
+	fs.Int64Var(&config.Generator.Seed, "seed", 0, "seed of the generated events, random if 0")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: shipperctl loadgen [flags]")
+		fmt.Fprintln(fs.Output(), "\nPublishes synthetic events at a target rate and reports the achieved throughput,")
+		fmt.Fprintln(fs.Output(), "the request latencies and the events the shipper didn't accept.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := conn.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	report, err := loadgen.Run(ctx, c, config)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, report)
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Command shipperctl talks to a shipper to debug its deployments:
+//
+//	shipperctl publish -server localhost:50052 events.ndjson
+//	shipperctl tail -server unix:///run/elastic-agent/shipper.sock
+//	shipperctl convert -from yaml -to proto -validate events.yaml > events.pb
+//	shipperctl loadgen -server localhost:50052 -eps 5000 -duration 1m
+//
+// Run a command with -h for its flags.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+)
+
+// command is a subcommand of shipperctl.
+type command struct {
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"convert": {"convert events between JSON, YAML and protobuf", runConvert},
+	"loadgen": {"publish synthetic events at a target rate", runLoadgen},
+	"publish": {"publish NDJSON events from files or stdin", runPublish},
+	"tail":    {"print the persisted index as it changes", runTail},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: shipperctl <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := cmd.run(ctx, os.Args[2:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "shipperctl %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/adapters/ndjson"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// errPersisted stops the persisted index subscription.
+var errPersisted = errors.New("persisted")
+
+// publishStats are the counters printed at the end of publish.
+type publishStats struct {
+	events   int
+	invalid  int
+	requests int
+	// partial counts the requests the shipper didn't fully accept
+	partial       int
+	uuid          string
+	acceptedIndex uint64
+}
+
+func runPublish(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ContinueOnError)
+	var conn connFlags
+	conn.register(fs)
+	batchSize := fs.Int("batch", 100, "number of events per request")
+	inputID := fs.String("input-id", "shipperctl", "input ID of the events")
+	streamID := fs.String("stream-id", "", "stream ID of the events")
+	dataStream := fs.String("data-stream", "logs-generic-default", "data stream of the events")
+	retryInterval := fs.Duration("retry-interval", time.Second, "wait before sending again the events the shipper didn't accept")
+	wait := fs.Bool("wait", false, "wait until the shipper persisted the events")
+	verbose := fs.Bool("v", false, "print the reply of every request")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: shipperctl publish [flags] [file...]")
+		fmt.Fprintln(fs.Output(), "\nPublishes the NDJSON events of the files, or stdin, one object per line.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("invalid batch size %d", *batchSize)
+	}
+	ds, err := helpers.ParseDataStream(*dataStream)
+	if err != nil {
+		return err
+	}
+	readerConfig := ndjson.Config{
+		Source:     &messages.Source{InputId: *inputID, StreamId: *streamID},
+		DataStream: &messages.DataStream{Type: ds.Type, Dataset: ds.Dataset, Namespace: ds.Namespace},
+	}
+
+	c, err := conn.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	p := &publisher{client: c, retryInterval: *retryInterval, verbose: *verbose}
+	start := time.Now()
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	for _, path := range inputs {
+		if err := p.publishFile(ctx, path, readerConfig, *batchSize); err != nil {
+			p.printStats(time.Since(start))
+			return err
+		}
+	}
+	if *wait && p.stats.acceptedIndex > 0 {
+		if err := p.waitPersisted(ctx); err != nil {
+			p.printStats(time.Since(start))
+			return err
+		}
+	}
+	p.printStats(time.Since(start))
+	return nil
+}
+
+type publisher struct {
+	client        *client.Client
+	retryInterval time.Duration
+	verbose       bool
+	stats         publishStats
+}
+
+func (p *publisher) publishFile(ctx context.Context, path string, config ndjson.Config, batchSize int) error {
+	in := io.Reader(os.Stdin)
+	name := "stdin"
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in, name = f, path
+	}
+
+	reader := ndjson.NewReader(in, config)
+	batch := make([]*messages.Event, 0, batchSize)
+	for {
+		e, err := reader.Next()
+		var lineErr *ndjson.LineError
+		switch {
+		case errors.Is(err, io.EOF):
+			return p.publish(ctx, batch)
+		case errors.As(err, &lineErr):
+			p.stats.invalid++
+			fmt.Fprintf(os.Stderr, "%s: %s, skipped\n", name, lineErr)
+			continue
+		case err != nil:
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		batch = append(batch, e)
+		if len(batch) == batchSize {
+			if err := p.publish(ctx, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+}
+
+// publish sends the events until the shipper accepted all of them.
+func (p *publisher) publish(ctx context.Context, events []*messages.Event) error {
+	for len(events) > 0 {
+		reply, err := p.client.Publish(ctx, &messages.PublishRequest{Uuid: p.stats.uuid, Events: events})
+		if err != nil {
+			return err
+		}
+		p.stats.requests++
+		if p.verbose {
+			fmt.Fprintf(os.Stdout, "events=%d accepted_count=%d accepted_index=%d uuid=%s\n",
+				len(events), reply.GetAcceptedCount(), reply.GetAcceptedIndex(), reply.GetUuid())
+		}
+		if p.stats.uuid != "" && reply.GetUuid() != p.stats.uuid {
+			fmt.Fprintf(os.Stderr, "the shipper restarted, uuid %s is now %s\n", p.stats.uuid, reply.GetUuid())
+		}
+		p.stats.uuid = reply.GetUuid()
+		p.stats.acceptedIndex = reply.GetAcceptedIndex()
+		accepted := int(reply.GetAcceptedCount())
+		p.stats.events += accepted
+		events = events[accepted:]
+		if len(events) == 0 {
+			break
+		}
+		p.stats.partial++
+		if accepted > 0 {
+			continue
+		}
+		// the queue of the shipper is full
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.retryInterval):
+		}
+	}
+	return nil
+}
+
+// waitPersisted returns once the shipper persisted the accepted events.
+func (p *publisher) waitPersisted(ctx context.Context) error {
+	err := p.client.SubscribePersistedIndex(ctx, 100*time.Millisecond, func(reply *messages.PersistedIndexReply) error {
+		if reply.GetUuid() != p.stats.uuid {
+			return fmt.Errorf("the shipper restarted, uuid %s is now %s: the events not persisted were lost", p.stats.uuid, reply.GetUuid())
+		}
+		if reply.GetPersistedIndex() >= p.stats.acceptedIndex {
+			return errPersisted
+		}
+		return nil
+	})
+	if errors.Is(err, errPersisted) {
+		return nil
+	}
+	return err
+}
+
+func (p *publisher) printStats(elapsed time.Duration) {
+	rate := float64(p.stats.events) / elapsed.Seconds()
+	fmt.Fprintf(os.Stdout, "published=%d invalid=%d requests=%d partial=%d accepted_index=%d uuid=%s elapsed=%s rate=%.0f/s\n",
+		p.stats.events, p.stats.invalid, p.stats.requests, p.stats.partial,
+		p.stats.acceptedIndex, p.stats.uuid, elapsed.Round(time.Millisecond), rate)
+}
@@ -0,0 +1,101 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func newTestPublisher(t *testing.T) (*servertest.Server, *publisher) {
+	srv := servertest.New(servertest.Options{})
+	srv.Start()
+	t.Cleanup(srv.Stop)
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: []grpc.DialOption{srv.DialOption()},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return srv, &publisher{client: c, retryInterval: time.Millisecond}
+}
+
+func testEvents(from, n int) []*messages.Event {
+	events := make([]*messages.Event, 0, n)
+	for i := from; i < from+n; i++ {
+		events = append(events, &messages.Event{Fields: &messages.Struct{Data: map[string]*messages.Value{
+			"message": helpers.NewStringValue(fmt.Sprintf("event %d", i)),
+		}}})
+	}
+	return events
+}
+
+func TestPublisherPartialAccept(t *testing.T) {
+	srv, p := newTestPublisher(t)
+	srv.SetAcceptLimit(3)
+
+	events := testEvents(0, 10)
+	require.NoError(t, p.publish(context.Background(), events))
+	require.Equal(t, publishStats{
+		events:        10,
+		requests:      4,
+		partial:       3,
+		uuid:          "servertest",
+		acceptedIndex: 10,
+	}, p.stats)
+	// the rest of the events is sent again, in order
+	requireSameEvents(t, events, srv.Events())
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = srv.Persist(9)
+		time.Sleep(50 * time.Millisecond)
+		srv.PersistAll()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, p.waitPersisted(ctx))
+	_, persisted := srv.Indexes()
+	require.EqualValues(t, 10, persisted)
+}
+
+func TestPublisherRestart(t *testing.T) {
+	srv, p := newTestPublisher(t)
+	require.NoError(t, p.publish(context.Background(), testEvents(0, 2)))
+	srv.Restart("restarted")
+
+	// the request carrying the old uuid is refused, the events are sent
+	// again with the new one
+	require.NoError(t, p.publish(context.Background(), testEvents(2, 2)))
+	require.Equal(t, publishStats{
+		events:        4,
+		requests:      3,
+		partial:       1,
+		uuid:          "restarted",
+		acceptedIndex: 2,
+	}, p.stats)
+	requests := srv.Requests()
+	require.Len(t, requests, 3)
+	require.Equal(t, "servertest", requests[1].Uuid)
+	require.Equal(t, "restarted", requests[2].Uuid)
+	require.Len(t, srv.Events(), 4)
+
+	// the events accepted before a restart are lost
+	srv.Restart("restarted again")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := p.waitPersisted(ctx)
+	require.EqualError(t, err, "the shipper restarted, uuid restarted is now restarted again: the events not persisted were lost")
+}
@@ -0,0 +1,41 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func runTail(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	var conn connFlags
+	conn.register(fs)
+	interval := fs.Duration("interval", time.Second, "polling interval of the persisted index")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := conn.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.SubscribePersistedIndex(ctx, *interval, func(reply *messages.PersistedIndexReply) error {
+		fmt.Fprintf(os.Stdout, "%s uuid=%s persisted_index=%d\n", time.Now().Format(time.RFC3339), reply.GetUuid(), reply.GetPersistedIndex())
+		return nil
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
@@ -25,6 +25,12 @@ const (
 	goProtocGenGo     = "google.golang.org/protobuf/cmd/protoc-gen-go@v1.28"
 	goProtocGenGoGRPC = "google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.2"
 	goLicenserRepo    = "github.com/elastic/go-licenser@v0.4.1"
+	goBenchstat       = "golang.org/x/perf/cmd/benchstat@v0.0.0-20230113213139-801c7ef9e5c5"
+
+	benchmarkPackage  = "./benchmarks"
+	benchmarkBaseline = "benchmarks/testdata/baseline.txt"
+	benchmarkOutput   = "bench_output.txt"
+	benchmarkCount    = "5"
 )
 
 var (
@@ -125,6 +131,36 @@ func GenerateGo() error {
 	return nil
 }
 
+// Benchmark runs the benchmark suite and compares the results against the
+// stored baseline.
+func Benchmark() error {
+	mg.Deps(InstallBenchstat)
+	if err := runBenchmarks(benchmarkOutput); err != nil {
+		return err
+	}
+	return sh.RunV("benchstat", benchmarkBaseline, benchmarkOutput)
+}
+
+// BenchmarkBaseline runs the benchmark suite and stores the results as the
+// new baseline.
+func BenchmarkBaseline() error {
+	return runBenchmarks(benchmarkBaseline)
+}
+
+// InstallBenchstat installs benchstat to compare benchmark results.
+func InstallBenchstat() error {
+	return gotool.Install(gotool.Install.Package(goBenchstat))
+}
+
+func runBenchmarks(dest string) error {
+	log.Printf("Running benchmarks into %s...\n", dest)
+	out, err := sh.Output("go", "test", "-run=^$", "-bench=.", "-benchmem", "-count="+benchmarkCount, benchmarkPackage)
+	if err != nil {
+		return fmt.Errorf("failed to run benchmarks: %w", err)
+	}
+	return ioutil.WriteFile(dest, []byte(out+"\n"), 0o644)
+}
+
 // Check runs all the checks
 func Check() {
 	mg.Deps(devtools.Deps.CheckModuleTidy, CheckLicenseHeaders)
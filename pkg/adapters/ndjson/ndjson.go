@@ -0,0 +1,258 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package ndjson reads events from newline-delimited JSON, one object per
+// line, so file-based producers can feed the shipper.
+package ndjson
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+var (
+	// ErrInvalidTimestamp is returned for lines with a timestamp field that
+	// can't be parsed.
+	ErrInvalidTimestamp = errors.New("invalid timestamp")
+	// ErrLineTooLong is returned for lines longer than MaxLineSize, they are
+	// skipped without being buffered.
+	ErrLineTooLong = errors.New("line too long")
+)
+
+// Config configures a Reader.
+type Config struct {
+	// Timestamp configures how the event timestamp is extracted.
+	Timestamp TimestampConfig
+	// Source and DataStream are set in every event, they are not copied.
+	Source     *messages.Source
+	DataStream *messages.DataStream
+	// MaxLineSize is the maximum length of a line in bytes, without its
+	// line ending.
+	MaxLineSize int
+}
+
+// TimestampConfig configures the extraction of the event timestamp from the
+// decoded line.
+type TimestampConfig struct {
+	// Fields are the dotted paths checked, in order, for the timestamp. The
+	// first one found is used. The current time is used when none is found.
+	Fields []string
+	// Layouts are the time.Parse layouts tried, in order, for string
+	// timestamps.
+	Layouts []string
+	// EpochUnit is the unit of numeric timestamps, like time.Second or
+	// time.Millisecond.
+	EpochUnit time.Duration
+	// Keep leaves the timestamp field in the event fields, by default it's
+	// removed since it's the event timestamp.
+	Keep bool
+}
+
+// DefaultConfig returns the default configuration: the timestamp is read
+// from "@timestamp" as RFC3339 or milliseconds since the epoch, and lines
+// can be up to 1MiB long.
+func DefaultConfig() Config {
+	return Config{
+		Timestamp: TimestampConfig{
+			Fields:    []string{"@timestamp"},
+			Layouts:   []string{time.RFC3339Nano},
+			EpochUnit: time.Millisecond,
+		},
+		MaxLineSize: 1024 * 1024,
+	}
+}
+
+// LineError is returned for a line that can't be converted into an event.
+// Reading can continue with the next line.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Reader converts the lines of an io.Reader into events. It's not safe for
+// concurrent use.
+type Reader struct {
+	config Config
+	reader *bufio.Reader
+	buf    []byte
+	line   int
+	now    func() time.Time
+}
+
+// NewReader returns a Reader of the lines in r. Zero fields of config are
+// set from DefaultConfig.
+func NewReader(r io.Reader, config Config) *Reader {
+	defaults := DefaultConfig()
+	if config.Timestamp.Fields == nil {
+		config.Timestamp.Fields = defaults.Timestamp.Fields
+	}
+	if config.Timestamp.Layouts == nil {
+		config.Timestamp.Layouts = defaults.Timestamp.Layouts
+	}
+	if config.Timestamp.EpochUnit <= 0 {
+		config.Timestamp.EpochUnit = defaults.Timestamp.EpochUnit
+	}
+	if config.MaxLineSize <= 0 {
+		config.MaxLineSize = defaults.MaxLineSize
+	}
+	return &Reader{
+		config: config,
+		reader: bufio.NewReader(r),
+		now:    time.Now,
+	}
+}
+
+// Next returns the event of the next non-empty line, or io.EOF when there are
+// no more lines. Lines that can't be converted return a *LineError, and
+// reading can continue. Any other error is final.
+func (r *Reader) Next() (*messages.Event, error) {
+	for {
+		line, tooLong, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		r.line++
+		if tooLong {
+			return nil, &LineError{Line: r.line, Err: ErrLineTooLong}
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		e, err := r.event(line)
+		if err != nil {
+			return nil, &LineError{Line: r.line, Err: err}
+		}
+		return e, nil
+	}
+}
+
+// readLine returns the next line without its line ending. A line longer
+// than MaxLineSize is discarded and reported as too long. It returns io.EOF
+// once all the lines are read.
+func (r *Reader) readLine() ([]byte, bool, error) {
+	r.buf = r.buf[:0]
+	tooLong, read := false, false
+	for {
+		chunk, err := r.reader.ReadSlice('\n')
+		read = read || len(chunk) > 0
+		if !tooLong {
+			r.buf = append(r.buf, chunk...)
+			// the line ending doesn't count
+			content := bytes.TrimRight(r.buf, "\r\n")
+			if len(content) > r.config.MaxLineSize {
+				tooLong = true
+				r.buf = r.buf[:0]
+			}
+		}
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF):
+			if !read {
+				return nil, false, io.EOF
+			}
+		case err != nil:
+			return nil, false, fmt.Errorf("failed to read line %d: %w", r.line+1, err)
+		}
+		if tooLong {
+			return nil, true, nil
+		}
+		return bytes.TrimRight(r.buf, "\r\n"), false, nil
+	}
+}
+
+func (r *Reader) event(line []byte) (*messages.Event, error) {
+	fields, err := helpers.StructFromJSON(line)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := r.timestamp(fields)
+	if err != nil {
+		return nil, err
+	}
+	return &messages.Event{
+		Timestamp:  timestamppb.New(ts),
+		Source:     r.config.Source,
+		DataStream: r.config.DataStream,
+		Fields:     fields,
+	}, nil
+}
+
+// timestamp extracts the timestamp from the first configured field found.
+func (r *Reader) timestamp(fields *messages.Struct) (time.Time, error) {
+	for _, name := range r.config.Timestamp.Fields {
+		v, err := helpers.GetField(fields, name)
+		if err != nil {
+			continue
+		}
+		ts, err := r.parseTimestamp(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w in %s: %v", ErrInvalidTimestamp, name, err)
+		}
+		if !r.config.Timestamp.Keep {
+			if err := helpers.DeleteField(fields, name); err != nil {
+				return time.Time{}, err
+			}
+		}
+		return ts, nil
+	}
+	return r.now(), nil
+}
+
+func (r *Reader) parseTimestamp(v *messages.Value) (time.Time, error) {
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_StringValue:
+		var firstErr error
+		for _, layout := range r.config.Timestamp.Layouts {
+			ts, err := time.Parse(layout, kind.StringValue)
+			if err == nil {
+				return ts, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return time.Time{}, firstErr
+	case *messages.Value_Int64Value:
+		return r.epoch(float64(kind.Int64Value))
+	case *messages.Value_Uint64Value:
+		return r.epoch(float64(kind.Uint64Value))
+	case *messages.Value_Float64Value:
+		return r.epoch(kind.Float64Value)
+	case *messages.Value_TimestampValue:
+		return kind.TimestampValue.AsTime(), nil
+	}
+	return time.Time{}, fmt.Errorf("unexpected %T", v.GetKind())
+}
+
+func (r *Reader) epoch(n float64) (time.Time, error) {
+	unit := float64(r.config.Timestamp.EpochUnit)
+	if math.IsNaN(n) || math.Abs(n*unit) >= math.MaxInt64 {
+		return time.Time{}, fmt.Errorf("epoch %v is out of range", n)
+	}
+	// the whole units are converted separately, so the fraction doesn't
+	// lose the precision taken by the magnitude of the timestamp
+	whole, frac := math.Modf(n)
+	nanos := int64(whole)*int64(r.config.Timestamp.EpochUnit) + int64(math.Round(frac*unit))
+	return time.Unix(0, nanos).UTC(), nil
+}
@@ -0,0 +1,149 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package ndjson
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func readAll(t *testing.T, r *Reader) ([]*messages.Event, []error) {
+	var events []*messages.Event
+	var errs []error
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return events, errs
+		}
+		var lineErr *LineError
+		if errors.As(err, &lineErr) {
+			errs = append(errs, err)
+			continue
+		}
+		require.NoError(t, err)
+		events = append(events, e)
+	}
+}
+
+func TestReader(t *testing.T) {
+	input := strings.Join([]string{
+		`{"@timestamp":"2022-08-01T12:00:00.5Z","message":"first"}`,
+		``,
+		`{"message":"no timestamp"}`,
+		`not json`,
+		`{"@timestamp":1659355200000,"message":"epoch"}`,
+		`{"@timestamp":"yesterday"}`,
+		"{\"message\":\"windows line ending\"}\r",
+	}, "\n")
+	now := time.Date(2022, 8, 2, 0, 0, 0, 0, time.UTC)
+	source := &messages.Source{InputId: "ndjson"}
+
+	config := DefaultConfig()
+	config.Source = source
+	r := NewReader(strings.NewReader(input), config)
+	r.now = func() time.Time { return now }
+
+	events, errs := readAll(t, r)
+	require.Len(t, events, 4)
+	expected := []struct {
+		ts      time.Time
+		message string
+	}{
+		{ts: time.Date(2022, 8, 1, 12, 0, 0, 500000000, time.UTC), message: "first"},
+		{ts: now, message: "no timestamp"},
+		{ts: time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC), message: "epoch"},
+		{ts: now, message: "windows line ending"},
+	}
+	for i, e := range events {
+		require.Equal(t, expected[i].ts, e.Timestamp.AsTime())
+		require.Equal(t, expected[i].message, e.Fields.Data["message"].GetStringValue())
+		require.False(t, helpers.HasField(e.Fields, "@timestamp"), "the timestamp field is removed")
+		require.Same(t, source, e.Source)
+	}
+
+	require.Len(t, errs, 2)
+	require.Contains(t, errs[0].Error(), "line 4")
+	require.ErrorIs(t, errs[1], ErrInvalidTimestamp)
+	require.Contains(t, errs[1].Error(), "line 6")
+}
+
+func TestReaderTimestampRules(t *testing.T) {
+	cases := []struct {
+		name      string
+		config    TimestampConfig
+		line      string
+		expected  time.Time
+		keepField string
+	}{
+		{
+			name:     "first field found",
+			config:   TimestampConfig{Fields: []string{"event.created", "ts"}},
+			line:     `{"ts":"2022-08-01T00:00:00Z","event":{"created":"2022-08-01T10:00:00Z"}}`,
+			expected: time.Date(2022, 8, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "custom layouts",
+			config:   TimestampConfig{Layouts: []string{time.RFC3339, "2006-01-02 15:04:05"}},
+			line:     `{"@timestamp":"2022-08-01 10:30:00"}`,
+			expected: time.Date(2022, 8, 1, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "epoch seconds with fraction",
+			config:   TimestampConfig{EpochUnit: time.Second},
+			line:     `{"@timestamp":1659355200.25}`,
+			expected: time.Date(2022, 8, 1, 12, 0, 0, 250000000, time.UTC),
+		},
+		{
+			name:      "keep field",
+			config:    TimestampConfig{Keep: true},
+			line:      `{"@timestamp":"2022-08-01T00:00:00Z"}`,
+			expected:  time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+			keepField: "@timestamp",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tc.line), Config{Timestamp: tc.config})
+			e, err := r.Next()
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, e.Timestamp.AsTime())
+			if tc.keepField != "" {
+				require.True(t, helpers.HasField(e.Fields, tc.keepField))
+			}
+			_, err = r.Next()
+			require.ErrorIs(t, err, io.EOF)
+		})
+	}
+}
+
+func TestReaderLineTooLong(t *testing.T) {
+	input := strings.Join([]string{
+		`{"message":"first"}`,
+		`{"message":"` + strings.Repeat("a", 100) + `"}`,
+		`{"message":"` + strings.Repeat("b", 40) + `"}`,
+		`{"message":"last"}`,
+	}, "\r\n")
+	// a small buffer, so the long line is read in several chunks
+	r := NewReader(strings.NewReader(input), Config{MaxLineSize: 56})
+	r.reader = bufio.NewReaderSize(strings.NewReader(input), 16)
+
+	events, errs := readAll(t, r)
+	require.Len(t, events, 3)
+	require.Equal(t, "last", events[2].Fields.Data["message"].GetStringValue())
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], ErrLineTooLong)
+	var lineErr *LineError
+	require.ErrorAs(t, errs[0], &lineErr)
+	require.Equal(t, 2, lineErr.Line)
+}
@@ -0,0 +1,212 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package otlp converts OpenTelemetry log records into events, so OTel
+// collectors can publish through the shipper client.
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Config configures a Converter.
+type Config struct {
+	// Source and DataStream are set in every event, they are not copied.
+	Source     *messages.Source
+	DataStream *messages.DataStream
+}
+
+// Converter converts OTLP log records into events. The Timestamp of an event
+// is the time of the record, its observed time when not set, or the
+// current time.
+//
+// The fields of the events are:
+//   - message: the body when it's a string, body.structured otherwise
+//   - log.level: the severity text, or the name of the severity number
+//   - event.severity: the severity number
+//   - trace.id, span.id: the hex encoded IDs
+//   - attributes: the attributes of the record
+//   - resource.attributes, scope.name, scope.version
+//   - service.name, service.version, host.name: copied from the resource
+//     attributes following the semantic conventions
+type Converter struct {
+	config Config
+	now    func() time.Time
+}
+
+// NewConverter returns a Converter with the given configuration.
+func NewConverter(config Config) *Converter {
+	return &Converter{config: config, now: time.Now}
+}
+
+// ResourceLogs converts all the records of rl.
+func (c *Converter) ResourceLogs(rl *logspb.ResourceLogs) ([]*messages.Event, error) {
+	var events []*messages.Event
+	for _, sl := range rl.GetScopeLogs() {
+		for _, record := range sl.GetLogRecords() {
+			e, err := c.Event(rl.GetResource(), sl.GetScope(), record)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// semanticConventions are the resource attributes copied to ECS fields.
+var semanticConventions = map[string]string{
+	"service.name":    "service.name",
+	"service.version": "service.version",
+	"host.name":       "host.name",
+}
+
+// Event converts a single record, resource and scope may be nil.
+func (c *Converter) Event(resource *resourcepb.Resource, scope *commonpb.InstrumentationScope, record *logspb.LogRecord) (*messages.Event, error) {
+	fields := &messages.Struct{Data: map[string]*messages.Value{}}
+	put := func(key string, v *messages.Value) error {
+		if _, err := helpers.PutField(fields, key, v); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+		return nil
+	}
+
+	if body := record.GetBody(); body != nil {
+		if s, ok := body.GetValue().(*commonpb.AnyValue_StringValue); ok {
+			fields.Data["message"] = helpers.NewStringValue(s.StringValue)
+		} else if err := put("body.structured", anyValue(body)); err != nil {
+			return nil, err
+		}
+	}
+	if level := severityText(record); level != "" {
+		if err := put("log.level", helpers.NewStringValue(level)); err != nil {
+			return nil, err
+		}
+	}
+	if n := record.GetSeverityNumber(); n != logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+		if err := put("event.severity", helpers.NewInt64Value(int64(n))); err != nil {
+			return nil, err
+		}
+	}
+	if id := record.GetTraceId(); len(id) > 0 {
+		if err := put("trace.id", helpers.NewStringValue(hex.EncodeToString(id))); err != nil {
+			return nil, err
+		}
+	}
+	if id := record.GetSpanId(); len(id) > 0 {
+		if err := put("span.id", helpers.NewStringValue(hex.EncodeToString(id))); err != nil {
+			return nil, err
+		}
+	}
+	if attrs := record.GetAttributes(); len(attrs) > 0 {
+		fields.Data["attributes"] = helpers.NewStructValue(attributes(attrs))
+	}
+
+	if attrs := resource.GetAttributes(); len(attrs) > 0 {
+		if err := put("resource.attributes", helpers.NewStructValue(attributes(attrs))); err != nil {
+			return nil, err
+		}
+		for _, kv := range attrs {
+			if field, ok := semanticConventions[kv.GetKey()]; ok {
+				if err := put(field, anyValue(kv.GetValue())); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if scope != nil {
+		scopeFields := map[string]*messages.Value{}
+		if scope.GetName() != "" {
+			scopeFields["name"] = helpers.NewStringValue(scope.GetName())
+		}
+		if scope.GetVersion() != "" {
+			scopeFields["version"] = helpers.NewStringValue(scope.GetVersion())
+		}
+		if len(scopeFields) > 0 {
+			fields.Data["scope"] = helpers.NewStructValue(&messages.Struct{Data: scopeFields})
+		}
+	}
+
+	return &messages.Event{
+		Timestamp:  timestamppb.New(c.timestamp(record)),
+		Source:     c.config.Source,
+		DataStream: c.config.DataStream,
+		Fields:     fields,
+	}, nil
+}
+
+func (c *Converter) timestamp(record *logspb.LogRecord) time.Time {
+	if ns := record.GetTimeUnixNano(); ns != 0 {
+		return time.Unix(0, int64(ns)).UTC()
+	}
+	if ns := record.GetObservedTimeUnixNano(); ns != 0 {
+		return time.Unix(0, int64(ns)).UTC()
+	}
+	return c.now()
+}
+
+// severityText returns the severity text, or the lowercase name of the
+// range of the severity number, like "warn" for WARN2.
+func severityText(record *logspb.LogRecord) string {
+	if text := record.GetSeverityText(); text != "" {
+		return text
+	}
+	n := record.GetSeverityNumber()
+	if n == logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+		return ""
+	}
+	// every range has 4 numbers starting at the one without suffix
+	base := logspb.SeverityNumber((n-1)/4*4 + 1)
+	name, ok := logspb.SeverityNumber_name[int32(base)]
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(name, "SEVERITY_NUMBER_"))
+}
+
+// attributes converts the key-value pairs, keys are kept as they are even if
+// they contain dots.
+func attributes(kvs []*commonpb.KeyValue) *messages.Struct {
+	data := make(map[string]*messages.Value, len(kvs))
+	for _, kv := range kvs {
+		data[kv.GetKey()] = anyValue(kv.GetValue())
+	}
+	return &messages.Struct{Data: data}
+}
+
+func anyValue(v *commonpb.AnyValue) *messages.Value {
+	switch kind := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return helpers.NewStringValue(kind.StringValue)
+	case *commonpb.AnyValue_BoolValue:
+		return helpers.NewBoolValue(kind.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return helpers.NewInt64Value(kind.IntValue)
+	case *commonpb.AnyValue_DoubleValue:
+		return helpers.NewFloat64Value(kind.DoubleValue)
+	case *commonpb.AnyValue_BytesValue:
+		return helpers.NewStringValue(base64.StdEncoding.EncodeToString(kind.BytesValue))
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]*messages.Value, len(kind.ArrayValue.GetValues()))
+		for i, item := range kind.ArrayValue.GetValues() {
+			values[i] = anyValue(item)
+		}
+		return helpers.NewListValue(&messages.ListValue{Values: values})
+	case *commonpb.AnyValue_KvlistValue:
+		return helpers.NewStructValue(attributes(kind.KvlistValue.GetValues()))
+	}
+	return helpers.NewNullValue()
+}
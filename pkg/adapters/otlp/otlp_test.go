@@ -0,0 +1,128 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func TestResourceLogs(t *testing.T) {
+	ts := time.Date(2022, 8, 1, 12, 0, 0, 123, time.UTC)
+	rl := &logspb.ResourceLogs{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			stringAttr("service.name", "checkout"),
+			stringAttr("k8s.pod.name", "checkout-1"),
+		}},
+		ScopeLogs: []*logspb.ScopeLogs{{
+			Scope: &commonpb.InstrumentationScope{Name: "otelzap", Version: "0.1.0"},
+			LogRecords: []*logspb.LogRecord{
+				{
+					TimeUnixNano:   uint64(ts.UnixNano()),
+					SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_WARN2,
+					Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "payment slow"}},
+					Attributes: []*commonpb.KeyValue{
+						stringAttr("http.method", "POST"),
+						{Key: "retries", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 2}}},
+					},
+					TraceId: []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c},
+					SpanId:  []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+				},
+				{
+					ObservedTimeUnixNano: uint64(ts.UnixNano()),
+					SeverityText:         "ERROR",
+					Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+						Values: []*commonpb.KeyValue{
+							stringAttr("order", "1234"),
+							{Key: "items", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{
+								Values: []*commonpb.AnyValue{
+									{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 1.5}},
+									{Value: &commonpb.AnyValue_BytesValue{BytesValue: []byte("hi")}},
+								},
+							}}}},
+						},
+					}}},
+				},
+			},
+		}},
+	}
+	dataStream := &messages.DataStream{Type: "logs", Dataset: "otel", Namespace: "default"}
+	events, err := NewConverter(Config{DataStream: dataStream}).ResourceLogs(rl)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	for _, e := range events {
+		require.Equal(t, ts, e.Timestamp.AsTime())
+		require.Same(t, dataStream, e.DataStream)
+	}
+
+	require.Equal(t, map[string]interface{}{
+		"message":    "payment slow",
+		"log":        map[string]interface{}{"level": "warn"},
+		"event":      map[string]interface{}{"severity": int64(14)},
+		"trace":      map[string]interface{}{"id": "5b8efff798038103d269b633813fc60c"},
+		"span":       map[string]interface{}{"id": "eee19b7ec3c1b174"},
+		"attributes": map[string]interface{}{"http.method": "POST", "retries": int64(2)},
+		"resource": map[string]interface{}{
+			"attributes": map[string]interface{}{"service.name": "checkout", "k8s.pod.name": "checkout-1"},
+		},
+		"service": map[string]interface{}{"name": "checkout"},
+		"scope":   map[string]interface{}{"name": "otelzap", "version": "0.1.0"},
+	}, helpers.AsMap(events[0].Fields))
+
+	second := events[1].Fields
+	level, err := helpers.GetField(second, "log.level")
+	require.NoError(t, err)
+	require.Equal(t, "ERROR", level.GetStringValue())
+	body, err := helpers.GetField(second, "body.structured")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"order": "1234",
+		"items": []interface{}{1.5, "aGk="},
+	}, helpers.AsMap(body.GetStructValue()))
+	require.False(t, helpers.HasField(second, "message"))
+}
+
+func TestSeverityText(t *testing.T) {
+	cases := []struct {
+		number   logspb.SeverityNumber
+		expected string
+	}{
+		{number: logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, expected: ""},
+		{number: logspb.SeverityNumber_SEVERITY_NUMBER_TRACE, expected: "trace"},
+		{number: logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG4, expected: "debug"},
+		{number: logspb.SeverityNumber_SEVERITY_NUMBER_INFO, expected: "info"},
+		{number: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR3, expected: "error"},
+		{number: logspb.SeverityNumber_SEVERITY_NUMBER_FATAL4, expected: "fatal"},
+		{number: 42, expected: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.number.String(), func(t *testing.T) {
+			require.Equal(t, tc.expected, severityText(&logspb.LogRecord{SeverityNumber: tc.number}))
+		})
+	}
+}
+
+func TestEventWithoutTime(t *testing.T) {
+	now := time.Date(2022, 8, 2, 0, 0, 0, 0, time.UTC)
+	c := NewConverter(Config{})
+	c.now = func() time.Time { return now }
+	e, err := c.Event(nil, nil, &logspb.LogRecord{})
+	require.NoError(t, err)
+	require.Equal(t, now, e.Timestamp.AsTime())
+	require.Empty(t, e.Fields.GetData())
+}
@@ -0,0 +1,93 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package agent bootstraps shipper clients from the unit configuration
+// sent by the Elastic Agent over the control protocol.
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	agentclient "github.com/elastic/elastic-agent-client/v7/pkg/client"
+	agentproto "github.com/elastic/elastic-agent-client/v7/pkg/proto"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrNotOutputUnit is returned when the connection information is requested
+// from a unit that is not an output unit.
+var ErrNotOutputUnit = errors.New("unit is not an output unit")
+
+// ConnectionInfo is how to reach the shipper, as configured in the output unit.
+type ConnectionInfo struct {
+	// Server is the address of the shipper, e.g. unix:///path/to/shipper.sock.
+	Server string `config:"server" validate:"required"`
+	// TLS holds the certificates generated by the Agent for the shipper connection.
+	TLS *tlscommon.Config `config:"ssl"`
+}
+
+// ConnectionInfoFromConfig reads the shipper connection information from
+// the expected configuration of an output unit.
+func ConnectionInfoFromConfig(expected *agentproto.UnitExpectedConfig) (ConnectionInfo, error) {
+	var info ConnectionInfo
+	if expected.GetSource() == nil {
+		return info, errors.New("unit has no configuration")
+	}
+	cfg, err := config.NewConfigFrom(expected.GetSource().AsMap())
+	if err != nil {
+		return info, fmt.Errorf("failed to read unit %s configuration: %w", expected.GetId(), err)
+	}
+	if err := cfg.Unpack(&info); err != nil {
+		return info, fmt.Errorf("invalid shipper configuration in unit %s: %w", expected.GetId(), err)
+	}
+	return info, nil
+}
+
+// Sources returns the event sources described by the expected configuration
+// of an input unit, one per stream. Inputs without streams have a single
+// source with an empty stream ID.
+func Sources(expected *agentproto.UnitExpectedConfig) []*messages.Source {
+	if len(expected.GetStreams()) == 0 {
+		return []*messages.Source{{InputId: expected.GetId()}}
+	}
+	sources := make([]*messages.Source, 0, len(expected.GetStreams()))
+	for _, stream := range expected.GetStreams() {
+		sources = append(sources, &messages.Source{
+			InputId:  expected.GetId(),
+			StreamId: stream.GetId(),
+		})
+	}
+	return sources
+}
+
+// NewClient connects to the shipper described by the connection information.
+// The TLS configuration of opts is replaced by the one in info, if any.
+func NewClient(ctx context.Context, info ConnectionInfo, opts client.Options) (*client.Client, error) {
+	if info.TLS.IsEnabled() {
+		tlsConfig, err := tlscommon.LoadTLSConfig(info.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load shipper TLS configuration: %w", err)
+		}
+		opts.TLS = tlsConfig.BuildModuleClientConfig("")
+	}
+	return client.New(ctx, info.Server, opts)
+}
+
+// NewClientFromUnit connects to the shipper configured in the given output unit.
+func NewClientFromUnit(ctx context.Context, unit *agentclient.Unit, opts client.Options) (*client.Client, error) {
+	if unit.Type() != agentclient.UnitTypeOutput {
+		return nil, fmt.Errorf("unit %s: %w", unit.ID(), ErrNotOutputUnit)
+	}
+	_, _, expected := unit.Expected()
+	info, err := ConnectionInfoFromConfig(expected)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(ctx, info, opts)
+}
@@ -0,0 +1,89 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	agentproto "github.com/elastic/elastic-agent-client/v7/pkg/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestConnectionInfoFromConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		source map[string]interface{}
+		exp    string
+		tls    bool
+		err    bool
+	}{
+		{
+			name:   "server only",
+			source: map[string]interface{}{"type": "shipper", "server": "unix:///tmp/shipper.sock"},
+			exp:    "unix:///tmp/shipper.sock",
+		},
+		{
+			name: "server with certificates",
+			source: map[string]interface{}{
+				"server": "localhost:50051",
+				"ssl": map[string]interface{}{
+					"certificate_authorities": []interface{}{"/path/to/ca.pem"},
+					"certificate":             "/path/to/cert.pem",
+					"key":                     "/path/to/key.pem",
+				},
+			},
+			exp: "localhost:50051",
+			tls: true,
+		},
+		{
+			name:   "missing server",
+			source: map[string]interface{}{"type": "shipper"},
+			err:    true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			source, err := structpb.NewStruct(c.source)
+			require.NoError(t, err)
+
+			info, err := ConnectionInfoFromConfig(&agentproto.UnitExpectedConfig{Id: "shipper-output", Source: source})
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.exp, info.Server)
+			require.Equal(t, c.tls, info.TLS.IsEnabled())
+		})
+	}
+}
+
+func TestSources(t *testing.T) {
+	require.Equal(t,
+		[]*messages.Source{{InputId: "log-1"}},
+		Sources(&agentproto.UnitExpectedConfig{Id: "log-1"}),
+	)
+
+	require.Equal(t,
+		[]*messages.Source{{InputId: "log-1", StreamId: "a"}, {InputId: "log-1", StreamId: "b"}},
+		Sources(&agentproto.UnitExpectedConfig{
+			Id:      "log-1",
+			Streams: []*agentproto.Stream{{Id: "a"}, {Id: "b"}},
+		}),
+	)
+}
+
+func TestNewClient(t *testing.T) {
+	c, err := NewClient(context.Background(), ConnectionInfo{Server: "localhost:50051"}, client.Options{})
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+}
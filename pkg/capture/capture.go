@@ -0,0 +1,177 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package capture records the PublishEvents requests to a file and replays
+// them against a shipper, for load testing and bug reproduction. The
+// requests are recorded by the interceptors of the package, on the producer
+// or the shipper side:
+//
+//	f, _ := os.Create("events.capture")
+//	w, err := capture.NewWriter(f, nil)
+//	c, err := client.New(ctx, address, client.Options{
+//		DialOptions: []grpc.DialOption{grpc.WithChainUnaryInterceptor(capture.UnaryClientInterceptor(w))},
+//	})
+//
+// and replayed with Replay:
+//
+//	r, err := capture.NewReader(f)
+//	stats, err := capture.Replay(ctx, c, r, capture.ReplayConfig{Speed: 10})
+//
+// A capture starts with the magic "SHIPCAP" and the version of the format,
+// followed by the records: the capture time in nanoseconds since the epoch,
+// 8 bytes big-endian, the length of the request as an unsigned varint and
+// the request in the protobuf wire format.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// header starts every capture, the last byte is the version of the format.
+var header = []byte("SHIPCAP\x01")
+
+// MaxRecordSize is the max size of a recorded request, bigger records are
+// considered corrupted.
+const MaxRecordSize = 64 * 1024 * 1024
+
+// ErrInvalidCapture is returned when reading a file that is not a capture,
+// or a corrupted one.
+var ErrInvalidCapture = errors.New("invalid capture")
+
+// Record is a recorded request.
+type Record struct {
+	// Time is when the request was recorded.
+	Time    time.Time
+	Request *messages.PublishRequest
+}
+
+// Writer records requests to a capture. It is safe for concurrent use.
+type Writer struct {
+	clock clock.Clock
+
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+	err error
+}
+
+// NewWriter writes the header of a capture to w and returns a Writer
+// recording to it. The records are timed with c, clock.Real if nil.
+func NewWriter(w io.Writer, c clock.Clock) (*Writer, error) {
+	if c == nil {
+		c = clock.Real
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{clock: c, w: w}, nil
+}
+
+// Write records req. Once a write failed, the capture is truncated and all
+// the next writes return the same error.
+func (w *Writer) Write(req *messages.PublishRequest) error {
+	now := w.clock.Now()
+	size := proto.Size(req)
+	if size > MaxRecordSize {
+		return fmt.Errorf("request of %d bytes is bigger than the max record size", size)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	var prefix [8 + binary.MaxVarintLen64]byte
+	binary.BigEndian.PutUint64(prefix[:], uint64(now.UnixNano()))
+	n := 8 + binary.PutUvarint(prefix[8:], uint64(size))
+	buf, err := proto.MarshalOptions{}.MarshalAppend(append(w.buf[:0], prefix[:n]...), req)
+	if err != nil {
+		return err
+	}
+	w.buf = buf
+	// a single write per record, a file never ends with half a header
+	if _, err := w.w.Write(buf); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// Reader reads the records of a capture.
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader reads the header of the capture in r and returns a Reader of
+// its records. It fails with ErrInvalidCapture if r is not a capture.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	got := make([]byte, len(header))
+	if _, err := io.ReadFull(br, got); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: missing header", ErrInvalidCapture)
+		}
+		return nil, err
+	}
+	if string(got[:len(got)-1]) != string(header[:len(header)-1]) {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidCapture)
+	}
+	if got[len(got)-1] != header[len(header)-1] {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidCapture, got[len(got)-1])
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the capture. A
+// truncated or corrupted record returns ErrInvalidCapture.
+func (r *Reader) Next() (Record, error) {
+	var ts [8]byte
+	if _, err := io.ReadFull(r.r, ts[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, io.EOF
+		}
+		return Record{}, truncated(err)
+	}
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return Record{}, truncated(err)
+	}
+	if size > MaxRecordSize {
+		return Record{}, fmt.Errorf("%w: record of %d bytes", ErrInvalidCapture, size)
+	}
+	if uint64(cap(r.buf)) < size {
+		r.buf = make([]byte, size)
+	}
+	buf := r.buf[:size]
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return Record{}, truncated(err)
+	}
+	req := &messages.PublishRequest{}
+	if err := proto.Unmarshal(buf, req); err != nil {
+		return Record{}, fmt.Errorf("%w: %s", ErrInvalidCapture, err)
+	}
+	return Record{
+		Time:    time.Unix(0, int64(binary.BigEndian.Uint64(ts[:]))),
+		Request: req,
+	}, nil
+}
+
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: truncated record", ErrInvalidCapture)
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func testRequest(values ...string) *messages.PublishRequest {
+	req := &messages.PublishRequest{Uuid: "recorded"}
+	for _, m := range values {
+		req.Events = append(req.Events, &messages.Event{
+			Source: &messages.Source{InputId: "in"},
+			Fields: &messages.Struct{Data: map[string]*messages.Value{"message": helpers.NewStringValue(m)}},
+		})
+	}
+	return req
+}
+
+func TestWriterReader(t *testing.T) {
+	now := time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+	c := clock.NewFake(now)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, c)
+	require.NoError(t, err)
+
+	first, second := testRequest("a", "b"), testRequest("c")
+	require.NoError(t, w.Write(first))
+	c.Advance(1500 * time.Millisecond)
+	require.NoError(t, w.Write(second))
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	rec, err := r.Next()
+	require.NoError(t, err)
+	require.True(t, now.Equal(rec.Time))
+	require.True(t, proto.Equal(first, rec.Request))
+	rec, err = r.Next()
+	require.NoError(t, err)
+	require.True(t, now.Add(1500*time.Millisecond).Equal(rec.Time))
+	require.True(t, proto.Equal(second, rec.Request))
+	_, err = r.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+type failingWriter struct {
+	n int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	f.n--
+	return len(p), nil
+}
+
+func TestWriterError(t *testing.T) {
+	w, err := NewWriter(&failingWriter{n: 1}, nil)
+	require.NoError(t, err)
+	require.EqualError(t, w.Write(testRequest("a")), "disk full")
+	require.EqualError(t, w.Write(testRequest("b")), "disk full", "the capture stops at the first error")
+
+	_, err = NewWriter(&failingWriter{}, nil)
+	require.EqualError(t, err, "disk full")
+}
+
+func TestReaderInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(testRequest("a")))
+	data := buf.Bytes()
+
+	tests := map[string]struct {
+		data    []byte
+		header  string
+		message string
+	}{
+		"empty":             {data: nil, header: "invalid capture: missing header"},
+		"not a capture":     {data: []byte(`{"message": "a"}`), header: "invalid capture: missing header"},
+		"version":           {data: []byte("SHIPCAP\x02"), header: "invalid capture: unsupported version 2"},
+		"truncated time":    {data: data[:len(header)+4], message: "invalid capture: truncated record"},
+		"truncated request": {data: data[:len(data)-1], message: "invalid capture: truncated record"},
+		"too large": {
+			data:    append(append([]byte(string(header)), 0, 0, 0, 0, 0, 0, 0, 0), 0xff, 0xff, 0xff, 0xff, 0x7f),
+			message: "invalid capture: record of 34359738367 bytes",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(tc.data))
+			if tc.header != "" {
+				require.ErrorIs(t, err, ErrInvalidCapture)
+				require.EqualError(t, err, tc.header)
+				return
+			}
+			require.NoError(t, err)
+			_, err = r.Next()
+			require.ErrorIs(t, err, ErrInvalidCapture)
+			require.EqualError(t, err, tc.message)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package capture
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// publishMethod is the full name of the PublishEvents method.
+const publishMethod = "/elastic.agent.shipper.v1.Producer/PublishEvents"
+
+// UnaryClientInterceptor records the PublishEvents requests of a client to
+// w before sending them. A failed recording doesn't fail the call, the
+// capture just stops, see Writer.Write.
+func UnaryClientInterceptor(w *Writer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if r, ok := req.(*messages.PublishRequest); ok && method == publishMethod {
+			_ = w.Write(r)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// UnaryServerInterceptor records the PublishEvents requests received by a
+// shipper to w before handling them. A failed recording doesn't fail the
+// call, the capture just stops, see Writer.Write.
+func UnaryServerInterceptor(w *Writer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if r, ok := req.(*messages.PublishRequest); ok && info.FullMethod == publishMethod {
+			_ = w.Write(r)
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package capture
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+)
+
+// ReplayConfig configures Replay.
+type ReplayConfig struct {
+	// Speed accelerates the replay, 10 sends the requests 10 times faster
+	// than they were recorded. Defaults to 1, the original pacing.
+	Speed float64
+	// Unpaced sends the requests back to back, ignoring the recorded
+	// pacing.
+	Unpaced bool
+}
+
+// ReplayStats counts what a replay sent.
+type ReplayStats struct {
+	Requests int
+	Events   int
+	// Accepted is the number of events the shipper accepted, the events
+	// it didn't accept are not sent again: the capture already holds the
+	// requests the producer sent again.
+	Accepted int
+	// UUID is the uuid of the shipper in the last reply.
+	UUID string
+	// AcceptedIndex is the accepted index in the last reply.
+	AcceptedIndex uint64
+}
+
+// Replay publishes the requests of r to the shipper, paced like they were
+// recorded. The recorded uuids belong to the shipper the capture was made
+// with, so the requests are sent with the uuid of the last reply instead.
+// It returns at the end of the capture, or with the error of the first
+// failed request, the stats tell how many were sent before.
+func Replay(ctx context.Context, c client.Publisher, r *Reader, config ReplayConfig) (ReplayStats, error) {
+	if config.Speed <= 0 {
+		config.Speed = 1
+	}
+
+	var stats ReplayStats
+	var first time.Time
+	start := time.Now()
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		if !config.Unpaced {
+			if first.IsZero() {
+				first = rec.Time
+			}
+			// paced from the start, so the delays of the sends don't add up
+			offset := time.Duration(float64(rec.Time.Sub(first)) / config.Speed)
+			if err := sleep(ctx, time.Until(start.Add(offset))); err != nil {
+				return stats, err
+			}
+		}
+
+		req := rec.Request
+		req.Uuid = stats.UUID
+		reply, err := c.Publish(ctx, req)
+		if err != nil {
+			return stats, err
+		}
+		stats.Requests++
+		stats.Events += len(req.GetEvents())
+		stats.Accepted += int(reply.GetAcceptedCount())
+		stats.UUID = reply.GetUuid()
+		stats.AcceptedIndex = reply.GetAcceptedIndex()
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func newTestClient(t *testing.T, srv *servertest.Server, opts ...grpc.DialOption) *client.Client {
+	srv.Start()
+	t.Cleanup(srv.Stop)
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: append([]grpc.DialOption{srv.DialOption()}, opts...),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil)
+	require.NoError(t, err)
+
+	recorded := servertest.New(servertest.Options{UUID: "recorded"})
+	c := newTestClient(t, recorded, grpc.WithChainUnaryInterceptor(UnaryClientInterceptor(w)))
+	_, err = c.Publish(ctx, testRequest("a", "b"))
+	require.NoError(t, err)
+	_, err = c.Publish(ctx, testRequest("c"))
+	require.NoError(t, err)
+
+	replayed := servertest.New(servertest.Options{UUID: "replayed"})
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	stats, err := Replay(ctx, newTestClient(t, replayed), r, ReplayConfig{Unpaced: true})
+	require.NoError(t, err)
+	require.Equal(t, ReplayStats{Requests: 2, Events: 3, Accepted: 3, UUID: "replayed", AcceptedIndex: 3}, stats)
+
+	events := replayed.Events()
+	require.Len(t, events, 3)
+	require.Equal(t, "c", events[2].Fields.Data["message"].GetStringValue())
+	requests := replayed.Requests()
+	require.Equal(t, "", requests[0].Uuid)
+	require.Equal(t, "replayed", requests[1].Uuid)
+}
+
+func TestServerInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil)
+	require.NoError(t, err)
+	srv := servertest.New(servertest.Options{
+		ServerOptions: []grpc.ServerOption{grpc.ChainUnaryInterceptor(UnaryServerInterceptor(w))},
+	})
+	_, err = newTestClient(t, srv).Publish(context.Background(), testRequest("a"))
+	require.NoError(t, err)
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	rec, err := r.Next()
+	require.NoError(t, err)
+	require.Len(t, rec.Request.Events, 1)
+}
+
+func TestReplayPacing(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, c)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.Write(testRequest("a")))
+		c.Advance(100 * time.Millisecond)
+	}
+
+	srv := servertest.New(servertest.Options{})
+	client := newTestClient(t, srv)
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	start := time.Now()
+	stats, err := Replay(context.Background(), client, r, ReplayConfig{Speed: 2})
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.Requests)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond, "the last request is sent 200ms/2 after the first")
+
+	// cancelled while waiting
+	buf.Reset()
+	w, err = NewWriter(&buf, c)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(testRequest("a")))
+	c.Advance(time.Hour)
+	require.NoError(t, w.Write(testRequest("b")))
+	r, err = NewReader(&buf)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stats, err = Replay(ctx, client, r, ReplayConfig{})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, stats.Requests)
+}
+
+func TestReplayError(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Write(testRequest("a")))
+
+	srv := servertest.New(servertest.Options{})
+	c := newTestClient(t, srv)
+	srv.SetPublishErrors(status.Error(codes.Unavailable, "shutting down"))
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	stats, err := Replay(context.Background(), c, r, ReplayConfig{Unpaced: true})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 0, stats.Requests)
+}
@@ -0,0 +1,158 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package auth provides gRPC client interceptors attaching an API key or a
+// bearer token to every call to the shipper, in the authorization metadata:
+//
+//	c, err := client.New(ctx, address, client.Options{
+//		DialOptions: auth.DialOptions(auth.APIKey(key)),
+//	})
+//
+// The credentials are sent in clear text unless the connection uses TLS or
+// a local socket.
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+)
+
+// MetadataKey is the metadata key holding the credentials.
+const MetadataKey = "authorization"
+
+// Authorization schemes of the credentials.
+const (
+	SchemeAPIKey = "ApiKey"
+	SchemeBearer = "Bearer"
+)
+
+// ErrEmptyToken is returned when a provider returns an empty token.
+var ErrEmptyToken = errors.New("empty token")
+
+// TokenProvider returns the token to use for a call, it's called for every
+// call so the token can be rotated. It must be safe for concurrent use, see
+// Cached for expensive providers. Its errors fail the call with an
+// Unauthenticated status, without sending it.
+type TokenProvider func(ctx context.Context) (string, error)
+
+// Credentials are a token and the scheme it's sent with.
+type Credentials struct {
+	scheme   string
+	provider TokenProvider
+}
+
+// APIKey sends the key, in its base64 encoded "id:api_key" form.
+func APIKey(key string) Credentials {
+	return APIKeyFrom(staticToken(key))
+}
+
+// APIKeyFrom sends the keys returned by the provider.
+func APIKeyFrom(provider TokenProvider) Credentials {
+	return Credentials{scheme: SchemeAPIKey, provider: provider}
+}
+
+// Bearer sends the bearer token.
+func Bearer(token string) Credentials {
+	return BearerFrom(staticToken(token))
+}
+
+// BearerFrom sends the bearer tokens returned by the provider.
+func BearerFrom(provider TokenProvider) Credentials {
+	return Credentials{scheme: SchemeBearer, provider: provider}
+}
+
+func staticToken(token string) TokenProvider {
+	return func(context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+// attach returns the context with the credentials in its outgoing metadata,
+// replacing any previous ones.
+func (c Credentials) attach(ctx context.Context) (context.Context, error) {
+	token, err := c.provider(ctx)
+	if err == nil && token == "" {
+		err = ErrEmptyToken
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "failed to get %s credentials: %v", c.scheme, err)
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	md.Set(MetadataKey, c.scheme+" "+token)
+	return metadata.NewOutgoingContext(ctx, md), nil
+}
+
+// DialOptions returns the dial options installing both interceptors.
+func DialOptions(c Credentials) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor(c)),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptor(c)),
+	}
+}
+
+// UnaryClientInterceptor attaches the credentials to every unary call, like
+// PublishEvents.
+func UnaryClientInterceptor(c Credentials) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := c.attach(ctx)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor attaches the credentials to every stream, like
+// PersistedIndex. A stream keeps the token it was opened with.
+func StreamClientInterceptor(c Credentials) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := c.attach(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// Cached calls the provider at most once per ttl, and reuses its last token
+// in between. Errors are not cached, the next call tries again.
+func Cached(provider TokenProvider, ttl time.Duration) TokenProvider {
+	return CachedWithClock(provider, ttl, clock.Real)
+}
+
+// CachedWithClock is Cached using the given clock.
+func CachedWithClock(provider TokenProvider, ttl time.Duration, clk clock.Clock) TokenProvider {
+	var (
+		mu      sync.Mutex
+		token   string
+		expires time.Time
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && clk.Now().Before(expires) {
+			return token, nil
+		}
+		t, err := provider(ctx)
+		if err != nil {
+			return "", err
+		}
+		token, expires = t, clk.Now().Add(ttl)
+		return token, nil
+	}
+}
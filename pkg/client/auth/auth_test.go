@@ -0,0 +1,154 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+type authTest struct {
+	client *client.Client
+
+	mu      sync.Mutex
+	headers []string
+}
+
+func newAuthTest(t *testing.T, c Credentials) *authTest {
+	at := &authTest{}
+	record := func(ctx context.Context) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		at.mu.Lock()
+		defer at.mu.Unlock()
+		at.headers = append(at.headers, md.Get(MetadataKey)...)
+	}
+	srv := servertest.New(servertest.Options{
+		ServerOptions: []grpc.ServerOption{
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				record(ctx)
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				record(ss.Context())
+				return handler(srv, ss)
+			}),
+		},
+	})
+	srv.Start()
+	t.Cleanup(srv.Stop)
+
+	var err error
+	at.client, err = client.New(context.Background(), servertest.Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: append(DialOptions(c), srv.DialOption()),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { at.client.Close() })
+	return at
+}
+
+func (at *authTest) recorded() []string {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	return append([]string(nil), at.headers...)
+}
+
+func TestAPIKey(t *testing.T) {
+	at := newAuthTest(t, APIKey("aWQ6a2V5"))
+
+	// a header set by the caller is replaced
+	ctx := metadata.AppendToOutgoingContext(context.Background(), MetadataKey, "Basic dXNlcjpwYXNz")
+	_, err := at.client.Publish(ctx, &messages.PublishRequest{})
+	require.NoError(t, err)
+
+	errDone := errors.New("done")
+	err = at.client.SubscribePersistedIndex(context.Background(), time.Millisecond, func(*messages.PersistedIndexReply) error {
+		return errDone
+	})
+	require.ErrorIs(t, err, errDone)
+	require.Equal(t, []string{"ApiKey aWQ6a2V5", "ApiKey aWQ6a2V5"}, at.recorded())
+}
+
+func TestBearerRotation(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		token = "first"
+	)
+	at := newAuthTest(t, BearerFrom(func(context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return token, nil
+	}))
+
+	_, err := at.client.Publish(context.Background(), &messages.PublishRequest{})
+	require.NoError(t, err)
+	mu.Lock()
+	token = "second"
+	mu.Unlock()
+	_, err = at.client.Publish(context.Background(), &messages.PublishRequest{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Bearer first", "Bearer second"}, at.recorded())
+}
+
+func TestProviderError(t *testing.T) {
+	for name, provider := range map[string]TokenProvider{
+		"error": func(context.Context) (string, error) { return "", errors.New("vault sealed") },
+		"empty": staticToken(""),
+	} {
+		t.Run(name, func(t *testing.T) {
+			at := newAuthTest(t, BearerFrom(provider))
+			_, err := at.client.Publish(context.Background(), &messages.PublishRequest{})
+			require.Equal(t, codes.Unauthenticated, status.Code(err))
+			require.Empty(t, at.recorded())
+		})
+	}
+}
+
+func TestCached(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	calls := 0
+	fail := false
+	provider := CachedWithClock(func(context.Context) (string, error) {
+		calls++
+		if fail {
+			return "", errors.New("unavailable")
+		}
+		return "token", nil
+	}, time.Minute, clk)
+
+	for i := 0; i < 3; i++ {
+		token, err := provider(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "token", token)
+	}
+	require.Equal(t, 1, calls)
+
+	clk.Advance(time.Minute)
+	fail = true
+	_, err := provider(context.Background())
+	require.Error(t, err)
+	_, err = provider(context.Background())
+	require.Error(t, err)
+	require.Equal(t, 3, calls)
+
+	fail = false
+	_, err = provider(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 4, calls)
+}
@@ -0,0 +1,75 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// BackoffConfig configures the exponential backoff used between reconnection
+// attempts and retries.
+type BackoffConfig struct {
+	// Init is the wait time after the first failure.
+	Init time.Duration
+	// Max is the upper bound of the wait time.
+	Max time.Duration
+}
+
+// DefaultBackoffConfig returns the default backoff configuration.
+func DefaultBackoffConfig() BackoffConfig {
+	return BackoffConfig{
+		Init: 100 * time.Millisecond,
+		Max:  30 * time.Second,
+	}
+}
+
+// backoff doubles the wait time after every failure, with jitter,
+// up to the configured maximum.
+type backoff struct {
+	config BackoffConfig
+	next   time.Duration
+}
+
+func newBackoff(config BackoffConfig) *backoff {
+	config = config.normalize()
+	return &backoff{config: config, next: config.Init}
+}
+
+// normalize replaces a zero Init by its default and raises Max to Init.
+func (c BackoffConfig) normalize() BackoffConfig {
+	if c.Init <= 0 {
+		c.Init = DefaultBackoffConfig().Init
+	}
+	if c.Max < c.Init {
+		c.Max = c.Init
+	}
+	return c
+}
+
+// Wait blocks for the next backoff interval, it returns false if ctx is done first.
+func (b *backoff) Wait(ctx context.Context) bool {
+	//nolint:gosec // jitter doesn't need a secure random source
+	wait := b.next/2 + time.Duration(rand.Int63n(int64(b.next/2)+1))
+	b.next *= 2
+	if b.next > b.config.Max {
+		b.next = b.config.Max
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Reset restores the initial wait time, it's called after a success.
+func (b *backoff) Reset() {
+	b.next = b.config.Init
+}
@@ -0,0 +1,282 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package client contains a managed client for talking to the shipper over gRPC.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	grpcbackoff "google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/retry"
+)
+
+// minConnectTimeout is the minimum time given to a connection attempt, the
+// default of gRPC.
+const minConnectTimeout = 20 * time.Second
+
+// Options configures a Client.
+type Options struct {
+	// Timeout decides the deadline of every PublishEvents call.
+	// Defaults to a DynamicTimeout with the default configuration.
+	Timeout TimeoutPolicy
+	// Backoff configures the wait time between reconnection attempts,
+	// publish retries and PersistedIndex resubscriptions.
+	Backoff BackoffConfig
+	// MaxRetries is how many times a publish is retried while the shipper is
+	// unavailable. Zero means retrying until the context is done, a negative
+	// value disables retries.
+	MaxRetries int
+	// Retry, if set, retries the publishes instead of MaxRetries and Backoff,
+	// for its own retryable codes and with a circuit breaker. Backoff still
+	// applies to reconnections and resubscriptions.
+	Retry *retry.Retrier
+	// TLS configures the transport security. The connection is insecure when nil.
+	TLS *tls.Config
+	// Compression configures the compression of published requests.
+	Compression CompressionOptions
+	// Metrics receives the measurements of the client, they are discarded
+	// when nil.
+	Metrics Metrics
+	// Logger receives the diagnostics of the client, they are discarded
+	// when nil.
+	Logger Logger
+	// HealthService is the service name checked by Check and WaitUntilReady
+	// on the standard gRPC health service. Empty checks the whole shipper.
+	HealthService string
+	// DialOptions are appended to the options used to dial the shipper.
+	DialOptions []grpc.DialOption
+}
+
+// Client is a managed connection to the shipper. The connection is
+// re-established automatically with exponential backoff when it breaks,
+// publishes are retried while the shipper is unavailable and persisted
+// index subscriptions are renewed after the stream fails.
+// It is safe for concurrent use.
+type Client struct {
+	conn     *grpc.ClientConn
+	producer pb.ProducerClient
+	timeout  TimeoutPolicy
+	opts     Options
+	accepted acceptedIndex
+}
+
+// New connects to the shipper listening on address.
+func New(ctx context.Context, address string, opts Options) (*Client, error) {
+	if opts.Backoff == (BackoffConfig{}) {
+		opts.Backoff = DefaultBackoffConfig()
+	}
+	if err := opts.Compression.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = nopMetrics{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = nopLogger{}
+	}
+
+	creds := insecure.NewCredentials()
+	if opts.TLS != nil {
+		creds = credentials.NewTLS(opts.TLS)
+	}
+	reconnect := opts.Backoff.normalize()
+	connectBackoff := grpcbackoff.DefaultConfig
+	connectBackoff.BaseDelay = reconnect.Init
+	connectBackoff.MaxDelay = reconnect.Max
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: connectBackoff,
+			// without it the deadline of a connection attempt is the
+			// backoff delay, too short for a slow shipper
+			MinConnectTimeout: minConnectTimeout,
+		}),
+	}, opts.DialOptions...)
+
+	conn, err := grpc.DialContext(ctx, address, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial shipper at %s: %w", address, err)
+	}
+
+	timeout := opts.Timeout
+	if timeout == nil {
+		timeout = NewDynamicTimeout(DefaultDynamicTimeoutConfig())
+	}
+
+	return &Client{
+		conn:     conn,
+		producer: pb.NewProducerClient(conn),
+		timeout:  timeout,
+		opts:     opts,
+	}, nil
+}
+
+// Publish sends the request to the shipper, using the timeout policy of the
+// client. The request is retried with backoff while the shipper is
+// unavailable, or according to Options.Retry when set. The errors match the
+// sentinels of their kind, like ErrQueueFull, see StatusError.
+func (c *Client) Publish(ctx context.Context, req *messages.PublishRequest, opts ...grpc.CallOption) (*messages.PublishReply, error) {
+	if compression := c.opts.Compression.callOptions(req); compression != nil {
+		// before the options of the caller, which take precedence
+		opts = append(compression, opts...)
+	}
+	metrics := c.opts.Metrics
+	metrics.EventsPublished(len(req.Events))
+	var reply *messages.PublishReply
+	var err error
+	if c.opts.Retry != nil {
+		attempts := 0
+		err = c.opts.Retry.Do(ctx, func(ctx context.Context) error {
+			if attempts > 0 {
+				metrics.PublishRetried()
+				c.opts.Logger.Warnw("retrying publish", "attempt", attempts, "error", err)
+			}
+			attempts++
+			reply, err = c.publishOnce(ctx, req, opts)
+			return err
+		})
+	} else {
+		reply, err = c.publishWithBackoff(ctx, req, opts)
+	}
+	if err != nil {
+		metrics.EventsDropped(len(req.Events))
+		return nil, err
+	}
+
+	if c.accepted.update(reply) {
+		c.opts.Logger.Infow("shipper restarted, accepted indexes start over", "uuid", reply.GetUuid())
+	}
+	accepted := int(reply.GetAcceptedCount())
+	metrics.EventsAccepted(accepted)
+	if dropped := len(req.Events) - accepted; dropped > 0 {
+		metrics.EventsDropped(dropped)
+	}
+	return reply, nil
+}
+
+func (c *Client) publishOnce(ctx context.Context, req *messages.PublishRequest, opts []grpc.CallOption) (*messages.PublishReply, error) {
+	start := time.Now()
+	reply, err := PublishEvents(ctx, c.producer, c.timeout, req, opts...)
+	c.opts.Metrics.PublishDuration(time.Since(start), err)
+	return reply, wrapStatus(err)
+}
+
+// publishWithBackoff retries the publish according to MaxRetries and Backoff.
+func (c *Client) publishWithBackoff(ctx context.Context, req *messages.PublishRequest, opts []grpc.CallOption) (*messages.PublishReply, error) {
+	b := newBackoff(c.opts.Backoff)
+	for retries := 0; ; retries++ {
+		if retries > 0 {
+			c.opts.Metrics.PublishRetried()
+		}
+		reply, err := c.publishOnce(ctx, req, opts)
+		if err == nil {
+			return reply, nil
+		}
+		if !c.shouldRetry(err, retries) {
+			return nil, err
+		}
+		c.opts.Logger.Warnw("retrying publish", "attempt", retries+1, "error", err)
+		if !b.Wait(ctx) {
+			return nil, err
+		}
+	}
+}
+
+// shouldRetry returns true if a publish that failed with err after the given
+// number of retries can be retried.
+func (c *Client) shouldRetry(err error, retries int) bool {
+	if status.Code(err) != codes.Unavailable || c.opts.MaxRetries < 0 {
+		return false
+	}
+	return c.opts.MaxRetries == 0 || retries < c.opts.MaxRetries
+}
+
+// PersistedIndex subscribes to the persisted index updates of the shipper.
+// The returned stream is not renewed when it fails, see SubscribePersistedIndex.
+func (c *Client) PersistedIndex(ctx context.Context, req *messages.PersistedIndexRequest, opts ...grpc.CallOption) (pb.Producer_PersistedIndexClient, error) {
+	return c.producer.PersistedIndex(ctx, req, opts...)
+}
+
+// SubscribePersistedIndex calls fn with every persisted index update sent by
+// the shipper, polled every interval. When the stream fails, the client waits
+// according to its backoff and subscribes again. It blocks until ctx is done
+// or fn returns an error, which is then returned. The interval must be positive.
+func (c *Client) SubscribePersistedIndex(ctx context.Context, interval time.Duration, fn func(*messages.PersistedIndexReply) error) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid persisted index polling interval %s", interval)
+	}
+	req := &messages.PersistedIndexRequest{PollingInterval: durationpb.New(interval)}
+	b := newBackoff(c.opts.Backoff)
+	for {
+		streamCtx, cancel := context.WithCancel(ctx)
+		stream, err := c.producer.PersistedIndex(streamCtx, req, grpc.WaitForReady(true))
+		if err == nil {
+			err = c.consumeStream(stream, b, fn)
+		}
+		cancel()
+		var fnErr callbackError
+		if errors.As(err, &fnErr) {
+			return fnErr.err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			c.opts.Logger.Warnw("persisted index stream failed, subscribing again", "error", err)
+		} else {
+			c.opts.Logger.Debugw("persisted index stream closed by the shipper, subscribing again")
+		}
+		if !b.Wait(ctx) {
+			return ctx.Err()
+		}
+	}
+}
+
+// callbackError marks errors returned by the subscription callback, so
+// they are not mistaken for stream failures.
+type callbackError struct {
+	err error
+}
+
+func (e callbackError) Error() string {
+	return e.err.Error()
+}
+
+func (c *Client) consumeStream(stream pb.Producer_PersistedIndexClient, b *backoff, fn func(*messages.PersistedIndexReply) error) error {
+	for {
+		reply, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// the shipper closed the stream, subscribe again
+				return nil
+			}
+			return err
+		}
+		b.Reset()
+		c.opts.Metrics.PersistedIndexLag(c.accepted.lag(reply))
+		if err := fn(reply); err != nil {
+			return callbackError{err: err}
+		}
+	}
+}
+
+// Close closes the connection to the shipper.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,196 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/retry"
+)
+
+type flakyProducer struct {
+	pb.UnimplementedProducerServer
+
+	mu            sync.Mutex
+	publishErrors int
+	publishCalls  int
+	subscriptions int
+}
+
+func (p *flakyProducer) PublishEvents(_ context.Context, req *messages.PublishRequest) (*messages.PublishReply, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.publishCalls++
+	if p.publishCalls <= p.publishErrors {
+		return nil, status.Error(codes.Unavailable, "queue is not ready")
+	}
+	return &messages.PublishReply{AcceptedCount: uint32(len(req.Events))}, nil
+}
+
+// PersistedIndex sends a single update per subscription and then breaks the stream.
+func (p *flakyProducer) PersistedIndex(_ *messages.PersistedIndexRequest, stream pb.Producer_PersistedIndexServer) error {
+	p.mu.Lock()
+	p.subscriptions++
+	index := uint64(p.subscriptions)
+	p.mu.Unlock()
+
+	if err := stream.Send(&messages.PersistedIndexReply{PersistedIndex: index}); err != nil {
+		return err
+	}
+	return status.Error(codes.Unavailable, "shipper is restarting")
+}
+
+// newTestClient serves srv, and the services added by register, to a new client.
+func newTestClient(t *testing.T, srv pb.ProducerServer, opts Options, register ...func(*grpc.Server)) *Client {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	pb.RegisterProducerServer(server, srv)
+	for _, fn := range register {
+		fn(server)
+	}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	opts.Backoff = BackoffConfig{Init: time.Millisecond, Max: 10 * time.Millisecond}
+	opts.DialOptions = append(opts.DialOptions, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}))
+	c, err := New(context.Background(), "bufnet", opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestPublishRetries(t *testing.T) {
+	cases := []struct {
+		name       string
+		errors     int
+		maxRetries int
+		expErr     bool
+	}{
+		{
+			name:   "retries until the shipper is available",
+			errors: 3,
+		},
+		{
+			name:       "gives up after max retries",
+			errors:     3,
+			maxRetries: 2,
+			expErr:     true,
+		},
+		{
+			name:       "retries can be disabled",
+			errors:     1,
+			maxRetries: -1,
+			expErr:     true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := &flakyProducer{publishErrors: c.errors}
+			client := newTestClient(t, srv, Options{MaxRetries: c.maxRetries})
+
+			reply, err := client.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}, {}}})
+			if c.expErr {
+				require.Equal(t, codes.Unavailable, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, uint32(2), reply.AcceptedCount)
+			require.Equal(t, c.errors+1, srv.publishCalls)
+		})
+	}
+}
+
+func TestPublishRetrier(t *testing.T) {
+	config := retry.DefaultRetryConfig()
+	config.InitialBackoff = time.Millisecond
+	config.MaxAttempts = 3
+
+	srv := &flakyProducer{publishErrors: 2}
+	client := newTestClient(t, srv, Options{Retry: retry.New(config)})
+	_, err := client.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.NoError(t, err)
+	require.Equal(t, 3, srv.publishCalls)
+
+	srv = &flakyProducer{publishErrors: 3}
+	client = newTestClient(t, srv, Options{Retry: retry.New(config)})
+	_, err = client.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.Equal(t, codes.Unavailable, status.Code(errors.Unwrap(err)))
+	require.Equal(t, 3, srv.publishCalls, "MaxRetries and Backoff don't apply")
+}
+
+func TestSubscribePersistedIndexResubscribes(t *testing.T) {
+	srv := &flakyProducer{}
+	client := newTestClient(t, srv, Options{})
+
+	errDone := errors.New("done")
+	var indexes []uint64
+	err := client.SubscribePersistedIndex(context.Background(), time.Second, func(reply *messages.PersistedIndexReply) error {
+		indexes = append(indexes, reply.PersistedIndex)
+		if len(indexes) == 3 {
+			return errDone
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errDone)
+	require.Equal(t, []uint64{1, 2, 3}, indexes)
+}
+
+func TestSubscribePersistedIndexStopsWithContext(t *testing.T) {
+	client := newTestClient(t, &flakyProducer{}, Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := client.SubscribePersistedIndex(ctx, time.Second, func(*messages.PersistedIndexReply) error {
+		cancel()
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestBackoffConfigNormalize(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   BackoffConfig
+		expected BackoffConfig
+	}{
+		{
+			name:     "unchanged",
+			config:   BackoffConfig{Init: time.Second, Max: time.Minute},
+			expected: BackoffConfig{Init: time.Second, Max: time.Minute},
+		},
+		{
+			name:     "max below init",
+			config:   BackoffConfig{Init: time.Second},
+			expected: BackoffConfig{Init: time.Second, Max: time.Second},
+		},
+		{
+			name:     "default init",
+			config:   BackoffConfig{Max: time.Minute},
+			expected: BackoffConfig{Init: DefaultBackoffConfig().Init, Max: time.Minute},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.config.normalize())
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client/zstd"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Compression algorithms registered by the package. The shipper must have
+// them registered too.
+const (
+	CompressionGzip = gzip.Name
+	CompressionZstd = zstd.Name
+)
+
+// CompressionOptions configures the compression of the requests sent by
+// Client.Publish.
+//
+// Single calls can select their own compressor with grpc.UseCompressor,
+// which takes precedence.
+type CompressionOptions struct {
+	// Algorithm is the name of a registered gRPC compressor, like
+	// CompressionGzip or CompressionZstd. Requests are not compressed when
+	// empty.
+	Algorithm string
+	// MinSize is the marshaled size in bytes from which requests are
+	// compressed, small batches are not worth the CPU. Zero compresses every
+	// request.
+	MinSize int
+}
+
+func (o CompressionOptions) validate() error {
+	if o.Algorithm != "" && encoding.GetCompressor(o.Algorithm) == nil {
+		return fmt.Errorf("compressor %q is not registered", o.Algorithm)
+	}
+	return nil
+}
+
+// callOptions returns the compressor for the request, if any.
+func (o CompressionOptions) callOptions(req *messages.PublishRequest) []grpc.CallOption {
+	if o.Algorithm == "" {
+		return nil
+	}
+	if o.MinSize > 0 && proto.Size(req) < o.MinSize {
+		return nil
+	}
+	return []grpc.CallOption{grpc.UseCompressor(o.Algorithm)}
+}
@@ -0,0 +1,123 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// encodingRecorder records the compression of the sent requests.
+type encodingRecorder struct {
+	mu        sync.Mutex
+	encodings []string
+}
+
+func (r *encodingRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (r *encodingRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.OutHeader); ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.encodings = append(r.encodings, h.Compression)
+	}
+}
+
+func (r *encodingRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (r *encodingRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestPublishCompression(t *testing.T) {
+	small := &messages.PublishRequest{Events: []*messages.Event{{}}}
+	large := &messages.PublishRequest{Events: []*messages.Event{{Metadata: &messages.Struct{
+		Data: map[string]*messages.Value{
+			"message": {Kind: &messages.Value_StringValue{StringValue: strings.Repeat("a", 1024)}},
+		},
+	}}}}
+
+	cases := []struct {
+		name        string
+		compression CompressionOptions
+		req         *messages.PublishRequest
+		callOpts    []grpc.CallOption
+		expected    string
+	}{
+		{
+			name:     "disabled by default",
+			req:      large,
+			expected: "",
+		},
+		{
+			name:        "gzip",
+			compression: CompressionOptions{Algorithm: CompressionGzip},
+			req:         small,
+			expected:    "gzip",
+		},
+		{
+			name:        "zstd",
+			compression: CompressionOptions{Algorithm: CompressionZstd},
+			req:         small,
+			expected:    "zstd",
+		},
+		{
+			name:        "small requests are not compressed",
+			compression: CompressionOptions{Algorithm: CompressionZstd, MinSize: 512},
+			req:         small,
+			expected:    "",
+		},
+		{
+			name:        "large requests are compressed",
+			compression: CompressionOptions{Algorithm: CompressionZstd, MinSize: 512},
+			req:         large,
+			expected:    "zstd",
+		},
+		{
+			name:        "per call compressor takes precedence",
+			compression: CompressionOptions{Algorithm: CompressionZstd},
+			req:         small,
+			callOpts:    []grpc.CallOption{grpc.UseCompressor(CompressionGzip)},
+			expected:    "gzip",
+		},
+		{
+			name:     "per call compressor without client compression",
+			req:      small,
+			callOpts: []grpc.CallOption{grpc.UseCompressor(CompressionZstd)},
+			expected: "zstd",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &encodingRecorder{}
+			c := newTestClient(t, &flakyProducer{}, Options{
+				Compression: tc.compression,
+				DialOptions: []grpc.DialOption{grpc.WithStatsHandler(recorder)},
+			})
+
+			reply, err := c.Publish(context.Background(), tc.req, tc.callOpts...)
+			require.NoError(t, err)
+			require.EqualValues(t, len(tc.req.Events), reply.AcceptedCount)
+			require.Equal(t, []string{tc.expected}, recorder.encodings)
+		})
+	}
+}
+
+func TestUnknownCompression(t *testing.T) {
+	_, err := New(context.Background(), "localhost:0", Options{
+		Compression: CompressionOptions{Algorithm: "lz4"},
+	})
+	require.Error(t, err)
+}
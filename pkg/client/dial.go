@@ -0,0 +1,216 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+// DialConfig configures the transport security and keepalive of Dial.
+type DialConfig struct {
+	// CertFile and KeyFile are the PEM encoded certificate and key the client
+	// presents to the shipper. They must be set together.
+	CertFile string
+	KeyFile  string
+	// CAFile is the PEM encoded bundle of the authorities trusted to sign the
+	// shipper certificate. The system pool is used when empty.
+	CAFile string
+	// ServerName is verified against the shipper certificate. Defaults to
+	// the host in the dialed address.
+	ServerName string
+	// ReloadCertificates makes new connections use the files as they are on
+	// disk, so certificates can be rotated without recreating the client.
+	// Established connections are not affected.
+	ReloadCertificates bool
+	// Keepalive configures the pings sent on the connection. Defaults to
+	// DefaultKeepalive.
+	Keepalive keepalive.ClientParameters
+}
+
+// DefaultKeepalive returns the keepalive parameters used by Dial.
+//
+// The PersistedIndex stream stays open for the whole life of the client and
+// can be idle for long periods, pings detect a dead shipper before the next
+// publish does. The interval is the minimum gRPC servers accept by default,
+// shorter intervals are answered with a GOAWAY unless the server enforcement
+// policy allows them.
+func DefaultKeepalive() keepalive.ClientParameters {
+	return keepalive.ClientParameters{
+		Time:                5 * time.Minute,
+		Timeout:             20 * time.Second,
+		PermitWithoutStream: false,
+	}
+}
+
+// Dial connects to the shipper listening on address using mutual TLS with the
+// certificates in config. It fails early if the files can't be loaded.
+// opts.TLS is ignored, the rest of opts is used like in New.
+func Dial(ctx context.Context, address string, config DialConfig, opts Options) (*Client, error) {
+	var creds credentials.TransportCredentials
+	if config.ReloadCertificates {
+		r := &certReloader{config: config}
+		if _, err := r.credentials(); err != nil {
+			return nil, err
+		}
+		creds = &reloadingCredentials{reloader: r}
+	} else {
+		tlsConfig, err := config.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	ka := config.Keepalive
+	if ka == (keepalive.ClientParameters{}) {
+		ka = DefaultKeepalive()
+	}
+
+	opts.TLS = nil
+	// before the options of the caller, which take precedence
+	opts.DialOptions = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(ka),
+	}, opts.DialOptions...)
+	return New(ctx, address, opts)
+}
+
+// tlsConfig loads the files into a new TLS configuration.
+func (c DialConfig) tlsConfig() (*tls.Config, error) {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// fileStamp identifies the version of a file on disk.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// certReloader loads the certificates again when the files change. The files
+// are checked on every handshake, which only happens when connecting.
+type certReloader struct {
+	config DialConfig
+
+	mu     sync.Mutex
+	stamps [3]fileStamp
+	creds  credentials.TransportCredentials
+}
+
+// credentials returns the credentials for the current files. When the files
+// changed but can't be loaded, as it happens while they are being replaced,
+// the previous credentials are kept and loading is retried on the next call.
+func (r *certReloader) credentials() (credentials.TransportCredentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamps, err := r.stat()
+	if err != nil {
+		if r.creds != nil {
+			return r.creds, nil
+		}
+		return nil, err
+	}
+	if r.creds != nil && stamps == r.stamps {
+		return r.creds, nil
+	}
+	tlsConfig, err := r.config.tlsConfig()
+	if err != nil {
+		if r.creds != nil {
+			return r.creds, nil
+		}
+		return nil, err
+	}
+	r.creds = credentials.NewTLS(tlsConfig)
+	r.stamps = stamps
+	return r.creds, nil
+}
+
+func (r *certReloader) stat() ([3]fileStamp, error) {
+	var stamps [3]fileStamp
+	for i, path := range []string{r.config.CertFile, r.config.KeyFile, r.config.CAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return stamps, fmt.Errorf("failed to stat certificate file: %w", err)
+		}
+		stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+// reloadingCredentials delegates the handshakes to the latest credentials of
+// the reloader.
+type reloadingCredentials struct {
+	reloader *certReloader
+}
+
+func (c *reloadingCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	creds, err := c.reloader.credentials()
+	if err != nil {
+		return nil, nil, err
+	}
+	return creds.ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *reloadingCredentials) ServerHandshake(net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("server handshake is not supported by client credentials")
+}
+
+func (c *reloadingCredentials) Info() credentials.ProtocolInfo {
+	creds, err := c.reloader.credentials()
+	if err != nil {
+		return credentials.ProtocolInfo{SecurityProtocol: "tls", ServerName: c.reloader.config.ServerName}
+	}
+	return creds.Info()
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingCredentials{reloader: c.reloader}
+}
+
+// OverrideServerName is deprecated in gRPC, it's only kept to satisfy the
+// interface.
+func (c *reloadingCredentials) OverrideServerName(string) error {
+	return errors.New("overriding the server name is not supported, use DialConfig.ServerName")
+}
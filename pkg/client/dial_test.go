@@ -0,0 +1,215 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+// newTestCert creates a certificate signed by parent, or a self-signed CA
+// when parent is nil.
+func newTestCert(t *testing.T, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{
+		cert: cert,
+		key:  key,
+		tls:  tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert},
+	}
+}
+
+// write stores the certificate and key as PEM files.
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	if keyFile != "" {
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+		require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	}
+}
+
+func testDialConfig(t *testing.T) DialConfig {
+	dir := t.TempDir()
+	return DialConfig{
+		CertFile:   filepath.Join(dir, "client.crt"),
+		KeyFile:    filepath.Join(dir, "client.key"),
+		CAFile:     filepath.Join(dir, "ca.crt"),
+		ServerName: "localhost",
+	}
+}
+
+func TestDialMutualTLS(t *testing.T) {
+	ca := newTestCert(t, 1, nil)
+	serverCert := newTestCert(t, 2, ca)
+	clientCert := newTestCert(t, 3, ca)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	srv := servertest.New(servertest.Options{
+		ServerOptions: []grpc.ServerOption{
+			grpc.Creds(credentials.NewTLS(&tls.Config{
+				Certificates: []tls.Certificate{serverCert.tls},
+				ClientCAs:    clientCAs,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				MinVersion:   tls.VersionTLS12,
+			})),
+		},
+	})
+	srv.Start()
+	t.Cleanup(srv.Stop)
+
+	for _, reload := range []bool{false, true} {
+		config := testDialConfig(t)
+		config.ReloadCertificates = reload
+		clientCert.write(t, config.CertFile, config.KeyFile)
+		ca.write(t, config.CAFile, "")
+
+		c, err := Dial(context.Background(), servertest.Target, config, Options{
+			DialOptions: []grpc.DialOption{srv.DialOption()},
+		})
+		require.NoError(t, err)
+
+		reply, err := c.Publish(context.Background(), &messages.PublishRequest{
+			Events: []*messages.Event{{}},
+		})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, reply.AcceptedCount)
+		require.NoError(t, c.Close())
+	}
+}
+
+func TestDialInvalidFiles(t *testing.T) {
+	ca := newTestCert(t, 1, nil)
+
+	cases := []struct {
+		name   string
+		config func(DialConfig) DialConfig
+	}{
+		{
+			name: "missing key",
+			config: func(c DialConfig) DialConfig {
+				c.KeyFile = ""
+				return c
+			},
+		},
+		{
+			name: "missing files",
+			config: func(c DialConfig) DialConfig {
+				c.CertFile += ".missing"
+				return c
+			},
+		},
+		{
+			name: "invalid CA",
+			config: func(c DialConfig) DialConfig {
+				c.CAFile = c.KeyFile
+				return c
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := testDialConfig(t)
+			ca.write(t, config.CertFile, config.KeyFile)
+			ca.write(t, config.CAFile, "")
+			config = tc.config(config)
+
+			for _, reload := range []bool{false, true} {
+				config.ReloadCertificates = reload
+				_, err := Dial(context.Background(), servertest.Target, config, Options{})
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCert(t, 1, nil)
+	config := testDialConfig(t)
+	newTestCert(t, 2, ca).write(t, config.CertFile, config.KeyFile)
+	ca.write(t, config.CAFile, "")
+
+	r := &certReloader{config: config}
+	first, err := r.credentials()
+	require.NoError(t, err)
+	same, err := r.credentials()
+	require.NoError(t, err)
+	require.Same(t, first, same, "unchanged files must not be reloaded")
+
+	// a partially written certificate keeps the previous credentials
+	require.NoError(t, os.WriteFile(config.CertFile, []byte("-----BEGIN"), 0o600))
+	kept, err := r.credentials()
+	require.NoError(t, err)
+	require.Same(t, first, kept)
+
+	newTestCert(t, 3, ca).write(t, config.CertFile, config.KeyFile)
+	// the rewrite can fall within the resolution of the modification time
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(config.CertFile, future, future))
+	reloaded, err := r.credentials()
+	require.NoError(t, err)
+	require.NotSame(t, first, reloaded)
+
+	tlsConfig, err := r.config.tlsConfig()
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	require.EqualValues(t, 3, leaf.SerialNumber.Int64())
+}
+
+func TestDefaultKeepalive(t *testing.T) {
+	ka := DefaultKeepalive()
+	// gRPC servers reject pings more frequent than 5 minutes by default
+	require.GreaterOrEqual(t, ka.Time, 5*time.Minute)
+	require.Less(t, ka.Timeout, ka.Time)
+}
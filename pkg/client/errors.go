@@ -0,0 +1,89 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+)
+
+// The sentinels of the error taxonomy, see helpers.ErrInvalidEvent. The
+// errors of Publish match them with errors.Is according to their gRPC
+// status.
+var (
+	// ErrInvalidEvent is matched by the InvalidArgument statuses.
+	ErrInvalidEvent = helpers.ErrInvalidEvent
+	// ErrTooLarge is matched by the ResourceExhausted statuses of the
+	// requests above the max message size.
+	ErrTooLarge = helpers.ErrTooLarge
+	// ErrQueueFull is matched by the other ResourceExhausted statuses.
+	ErrQueueFull = helpers.ErrQueueFull
+	// ErrNotConnected is matched by the Unavailable statuses.
+	ErrNotConnected = helpers.ErrNotConnected
+	// ErrShutdown is matched by the calls on a closed client.
+	ErrShutdown = helpers.ErrShutdown
+)
+
+// StatusError is a gRPC status error matching the sentinel of its kind with
+// errors.Is. The status is kept: status.Code and status.FromError work on
+// it like on the original error.
+type StatusError struct {
+	// Err is the gRPC status error.
+	Err error
+	// Kind is the sentinel of the error, like ErrQueueFull.
+	Kind error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes StatusError match its Kind.
+func (e *StatusError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// GRPCStatus returns the status of the error.
+func (e *StatusError) GRPCStatus() *status.Status {
+	return status.Convert(e.Err)
+}
+
+// wrapStatus wraps the gRPC status errors of a known kind in a StatusError,
+// the other errors are returned as is.
+func wrapStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+	var kind error
+	switch st.Code() {
+	case codes.InvalidArgument:
+		kind = ErrInvalidEvent
+	case codes.ResourceExhausted:
+		kind = ErrQueueFull
+		if strings.Contains(st.Message(), "larger than max") {
+			kind = ErrTooLarge
+		}
+	case codes.Unavailable:
+		kind = ErrNotConnected
+	case codes.Canceled:
+		// gRPC fails the calls on a closed connection with Canceled
+		if strings.Contains(st.Message(), "client connection is closing") {
+			kind = ErrShutdown
+		}
+	}
+	if kind == nil {
+		return err
+	}
+	return &StatusError{Err: err, Kind: kind}
+}
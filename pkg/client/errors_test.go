@@ -0,0 +1,82 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/retry"
+)
+
+func TestWrapStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		kind error
+	}{
+		{err: status.Error(codes.InvalidArgument, "missing timestamp"), kind: ErrInvalidEvent},
+		{err: status.Error(codes.ResourceExhausted, "grpc: received message larger than max (200 vs. 100)"), kind: ErrTooLarge},
+		{err: status.Error(codes.ResourceExhausted, "queue is full"), kind: ErrQueueFull},
+		{err: status.Error(codes.Unavailable, "connection refused"), kind: ErrNotConnected},
+		{err: status.Error(codes.Canceled, "grpc: the client connection is closing"), kind: ErrShutdown},
+		{err: status.Error(codes.Canceled, "context canceled")},
+		{err: status.Error(codes.Internal, "boom")},
+		{err: errors.New("not a status")},
+		{},
+	}
+	kinds := []error{ErrInvalidEvent, ErrTooLarge, ErrQueueFull, ErrNotConnected, ErrShutdown}
+	for _, c := range cases {
+		err := wrapStatus(c.err)
+		if c.kind == nil {
+			require.Equal(t, c.err, err)
+			continue
+		}
+		for _, kind := range kinds {
+			require.Equal(t, kind == c.kind, errors.Is(err, kind), "%v is %v", err, kind)
+		}
+		require.Equal(t, status.Code(c.err), status.Code(err), "the status is kept")
+		require.Equal(t, c.err.Error(), err.Error())
+		require.ErrorIs(t, err, c.err)
+		var statusErr *StatusError
+		require.True(t, errors.As(err, &statusErr))
+	}
+}
+
+// statusProducer fails every publish with err.
+type statusProducer struct {
+	pb.UnimplementedProducerServer
+	err error
+}
+
+func (p *statusProducer) PublishEvents(context.Context, *messages.PublishRequest) (*messages.PublishReply, error) {
+	return nil, p.err
+}
+
+func TestPublishErrorKinds(t *testing.T) {
+	srv := &statusProducer{err: status.Error(codes.ResourceExhausted, "queue is full")}
+	c := newTestClient(t, srv, Options{MaxRetries: -1})
+	_, err := c.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.ErrorIs(t, err, ErrQueueFull)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	config := retry.DefaultRetryConfig()
+	config.InitialBackoff = time.Millisecond
+	config.MaxAttempts = 2
+	c = newTestClient(t, srv, Options{Retry: retry.New(config)})
+	_, err = c.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.ErrorIs(t, err, ErrQueueFull, "the kind survives the retries")
+
+	require.NoError(t, c.Close())
+	_, err = c.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.ErrorIs(t, err, ErrShutdown)
+}
@@ -0,0 +1,95 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Check returns the serving status reported by the standard gRPC health
+// service of the shipper for Options.HealthService. It fails with an
+// Unimplemented status when the shipper doesn't register the health service.
+func (c *Client) Check(ctx context.Context) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	reply, err := healthpb.NewHealthClient(c.conn).Check(ctx, &healthpb.HealthCheckRequest{
+		Service: c.opts.HealthService,
+	})
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+	return reply.GetStatus(), nil
+}
+
+// WaitUntilReady blocks until the shipper reports it's serving
+// Options.HealthService, or ctx is done. Producers can use it to start
+// publishing only once the shipper is available.
+//
+// Without a health service on the shipper it waits until the connection is
+// ready instead. Watch streams that fail are renewed with the backoff of the
+// client.
+func (c *Client) WaitUntilReady(ctx context.Context) error {
+	health := healthpb.NewHealthClient(c.conn)
+	req := &healthpb.HealthCheckRequest{Service: c.opts.HealthService}
+	b := newBackoff(c.opts.Backoff)
+	for {
+		serving, err := c.watchServing(ctx, health, req, b)
+		if serving {
+			return nil
+		}
+		if status.Code(err) == codes.Unimplemented {
+			c.opts.Logger.Debugw("shipper has no health service, waiting for the connection")
+			return c.waitConnected(ctx)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.opts.Logger.Debugw("health watch failed, watching again", "error", err)
+		if !b.Wait(ctx) {
+			return ctx.Err()
+		}
+	}
+}
+
+// watchServing watches the health of the shipper, it returns true once
+// it's serving, or the error that broke the stream.
+func (c *Client) watchServing(ctx context.Context, health healthpb.HealthClient, req *healthpb.HealthCheckRequest, b *backoff) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := health.Watch(ctx, req, grpc.WaitForReady(true))
+	if err != nil {
+		return false, err
+	}
+	for {
+		reply, err := stream.Recv()
+		if err != nil {
+			return false, err
+		}
+		b.Reset()
+		if reply.GetStatus() == healthpb.HealthCheckResponse_SERVING {
+			return true, nil
+		}
+	}
+}
+
+// waitConnected blocks until the connection to the shipper is ready.
+func (c *Client) waitConnected(ctx context.Context) error {
+	for {
+		state := c.conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Idle:
+			c.conn.Connect()
+		}
+		if !c.conn.WaitForStateChange(ctx, state) {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestWaitUntilReady(t *testing.T) {
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("shipper", healthpb.HealthCheckResponse_NOT_SERVING)
+	c := newTestClient(t, &flakyProducer{}, Options{HealthService: "shipper"}, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, healthServer)
+	})
+
+	st, err := c.Check(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, st)
+
+	ready := make(chan error, 1)
+	go func() {
+		ready <- c.WaitUntilReady(context.Background())
+	}()
+	select {
+	case err := <-ready:
+		t.Fatalf("ready before serving: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	healthServer.SetServingStatus("shipper", healthpb.HealthCheckResponse_SERVING)
+	select {
+	case err := <-ready:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("not ready after serving")
+	}
+}
+
+func TestWaitUntilReadyTimeout(t *testing.T) {
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	c := newTestClient(t, &flakyProducer{}, Options{}, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, healthServer)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, c.WaitUntilReady(ctx), context.DeadlineExceeded)
+}
+
+func TestWaitUntilReadyWithoutHealthService(t *testing.T) {
+	c := newTestClient(t, &flakyProducer{}, Options{})
+
+	_, err := c.Check(context.Background())
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, c.WaitUntilReady(ctx), "the connection is ready")
+}
@@ -0,0 +1,32 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Publisher publishes requests to the shipper, it is implemented by Client.
+type Publisher interface {
+	Publish(ctx context.Context, req *messages.PublishRequest, opts ...grpc.CallOption) (*messages.PublishReply, error)
+}
+
+// Producer is the part of Client talking to the Producer service of the
+// shipper. Code depending on it instead of Client can be tested with the
+// fakes of the clienttest package.
+type Producer interface {
+	Publisher
+	PersistedIndex(ctx context.Context, req *messages.PersistedIndexRequest, opts ...grpc.CallOption) (pb.Producer_PersistedIndexClient, error)
+	SubscribePersistedIndex(ctx context.Context, interval time.Duration, fn func(*messages.PersistedIndexReply) error) error
+	Close() error
+}
+
+var _ Producer = (*Client)(nil)
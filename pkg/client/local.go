@@ -0,0 +1,76 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+// Schemes of the local addresses accepted by DialLocal.
+const (
+	UnixScheme  = "unix"
+	NpipeScheme = "npipe"
+)
+
+// ErrUnsupportedAddress is returned by DialLocal for addresses it can't dial
+// on the current platform.
+var ErrUnsupportedAddress = errors.New("unsupported local address")
+
+// localAuthority is sent as the HTTP/2 authority and verified as the server
+// name when TLS is used, local addresses have no host.
+const localAuthority = "localhost"
+
+// DialLocal connects to a shipper listening on a local address, either a Unix
+// domain socket like unix:///run/elastic-agent/shipper.sock or a Windows
+// named pipe like npipe:///elastic-agent-shipper. Named pipes without the
+// \\.\pipe\ prefix are created under it.
+// opts are used like in New.
+func DialLocal(ctx context.Context, address string, opts Options) (*Client, error) {
+	dialer, err := localDialer(address)
+	if err != nil {
+		return nil, err
+	}
+	opts.DialOptions = append([]grpc.DialOption{
+		grpc.WithContextDialer(dialer),
+		grpc.WithAuthority(localAuthority),
+	}, opts.DialOptions...)
+	return New(ctx, "passthrough:///"+address, opts)
+}
+
+type contextDialer func(ctx context.Context, address string) (net.Conn, error)
+
+func localDialer(address string) (contextDialer, error) {
+	scheme, path, ok := strings.Cut(address, "://")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("%w %q: expected %s:// or %s://", ErrUnsupportedAddress, address, UnixScheme, NpipeScheme)
+	}
+	switch scheme {
+	case UnixScheme:
+		return func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}, nil
+	case NpipeScheme:
+		return dialNpipe(npipePath(path))
+	default:
+		return nil, fmt.Errorf("%w %q: unknown scheme %s", ErrUnsupportedAddress, address, scheme)
+	}
+}
+
+// npipePath returns the full path of a named pipe in a npipe:// address.
+func npipePath(path string) string {
+	const prefix = `\\.\pipe\`
+	path = strings.ReplaceAll(path, "/", `\`)
+	if strings.HasPrefix(path, prefix) {
+		return path
+	}
+	return prefix + strings.TrimLeft(path, `\`)
+}
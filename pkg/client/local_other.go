@@ -0,0 +1,16 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !windows
+// +build !windows
+
+package client
+
+import (
+	"fmt"
+)
+
+func dialNpipe(path string) (contextDialer, error) {
+	return nil, fmt.Errorf("%w %s: named pipes are only available on Windows", ErrUnsupportedAddress, path)
+}
@@ -0,0 +1,90 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestDialLocalUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not tested on Windows")
+	}
+	// t.TempDir can exceed the length limit of socket paths
+	dir, err := os.MkdirTemp("", "shipper")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "shipper.sock")
+
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	pb.RegisterProducerServer(server, &flakyProducer{})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	c, err := DialLocal(context.Background(), "unix://"+path, Options{})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	reply, err := c.Publish(context.Background(), &messages.PublishRequest{
+		Events: []*messages.Event{{}, {}},
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, reply.AcceptedCount)
+}
+
+func TestDialLocalUnsupported(t *testing.T) {
+	cases := []struct {
+		name    string
+		address string
+	}{
+		{name: "no scheme", address: "/run/shipper.sock"},
+		{name: "empty path", address: "unix://"},
+		{name: "remote address", address: "tcp://localhost:50051"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DialLocal(context.Background(), tc.address, Options{})
+			require.ErrorIs(t, err, ErrUnsupportedAddress)
+		})
+	}
+
+	if runtime.GOOS != "windows" {
+		_, err := DialLocal(context.Background(), "npipe:///shipper", Options{})
+		require.ErrorIs(t, err, ErrUnsupportedAddress)
+	}
+}
+
+func TestNpipePath(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/elastic-agent-shipper", expected: `\\.\pipe\elastic-agent-shipper`},
+		{path: "elastic-agent-shipper", expected: `\\.\pipe\elastic-agent-shipper`},
+		{path: "/agent/shipper", expected: `\\.\pipe\agent\shipper`},
+		{path: `\\.\pipe\shipper`, expected: `\\.\pipe\shipper`},
+		{path: "//./pipe/shipper", expected: `\\.\pipe\shipper`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			require.Equal(t, tc.expected, npipePath(tc.path))
+		})
+	}
+}
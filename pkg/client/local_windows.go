@@ -0,0 +1,21 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build windows
+// +build windows
+
+package client
+
+import (
+	"context"
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+func dialNpipe(path string) (contextDialer, error) {
+	return func(ctx context.Context, _ string) (net.Conn, error) {
+		return winio.DialPipeContext(ctx, path)
+	}, nil
+}
@@ -0,0 +1,95 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/retry"
+)
+
+type logEntry struct {
+	level         string
+	msg           string
+	keysAndValues []interface{}
+}
+
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) log(level, msg string, keysAndValues []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, keysAndValues: keysAndValues})
+}
+
+func (l *recordingLogger) Debugw(msg string, kv ...interface{}) { l.log("debug", msg, kv) }
+func (l *recordingLogger) Infow(msg string, kv ...interface{})  { l.log("info", msg, kv) }
+func (l *recordingLogger) Warnw(msg string, kv ...interface{})  { l.log("warn", msg, kv) }
+func (l *recordingLogger) Errorw(msg string, kv ...interface{}) { l.log("error", msg, kv) }
+
+func (l *recordingLogger) messages(level string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var msgs []string
+	for _, e := range l.entries {
+		if e.level == level {
+			msgs = append(msgs, e.msg)
+		}
+	}
+	return msgs
+}
+
+func TestLoggerPublishRetries(t *testing.T) {
+	logger := &recordingLogger{}
+	client := newTestClient(t, &flakyProducer{publishErrors: 2}, Options{Logger: logger})
+	_, err := client.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"retrying publish", "retrying publish"}, logger.messages("warn"))
+	require.Equal(t, "attempt", logger.entries[1].keysAndValues[0])
+	require.Equal(t, 2, logger.entries[1].keysAndValues[1])
+
+	config := retry.DefaultRetryConfig()
+	config.InitialBackoff = time.Millisecond
+	logger = &recordingLogger{}
+	client = newTestClient(t, &flakyProducer{publishErrors: 1}, Options{Logger: logger, Retry: retry.New(config)})
+	_, err = client.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"retrying publish"}, logger.messages("warn"))
+	require.Error(t, logger.entries[0].keysAndValues[3].(error))
+}
+
+func TestLoggerResubscriptions(t *testing.T) {
+	logger := &recordingLogger{}
+	client := newTestClient(t, &flakyProducer{}, Options{Logger: logger})
+
+	errDone := errors.New("done")
+	calls := 0
+	err := client.SubscribePersistedIndex(context.Background(), time.Second, func(*messages.PersistedIndexReply) error {
+		calls++
+		if calls == 2 {
+			return errDone
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errDone)
+	require.Equal(t, []string{"persisted index stream failed, subscribing again"}, logger.messages("warn"))
+}
+
+func TestLoggerShipperRestart(t *testing.T) {
+	var a acceptedIndex
+	require.False(t, a.update(&messages.PublishReply{Uuid: "first", AcceptedIndex: 3}))
+	require.False(t, a.update(&messages.PublishReply{Uuid: "first", AcceptedIndex: 4}))
+	require.True(t, a.update(&messages.PublishReply{Uuid: "second", AcceptedIndex: 1}))
+}
@@ -0,0 +1,29 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package logging adapts common loggers to the client Logger, so the
+// diagnostics of the client surface in the logs of the application:
+//
+//	c, err := client.New(ctx, address, client.Options{
+//		Logger: logging.Logp(logp.NewLogger("shipper")),
+//	})
+package logging
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+)
+
+// Logp returns a client.Logger writing to an elastic-agent-libs logger.
+func Logp(logger *logp.Logger) client.Logger {
+	return logger
+}
+
+// Zap returns a client.Logger writing to a zap logger.
+func Zap(logger *zap.Logger) client.Logger {
+	return logger.Sugar()
+}
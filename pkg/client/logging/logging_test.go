@@ -0,0 +1,41 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestLogp(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput()))
+	logger := Logp(logp.NewLogger("shipper"))
+	logger.Warnw("retrying publish", "attempt", 1)
+
+	entries := logp.ObserverLogs().TakeAll()
+	require.Len(t, entries, 1)
+	require.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	require.Equal(t, "retrying publish", entries[0].Message)
+	require.Equal(t, map[string]interface{}{"attempt": int64(1)}, entries[0].ContextMap())
+}
+
+func TestZap(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := Zap(zap.New(core))
+	logger.Debugw("persisted index stream closed")
+	logger.Errorw("failed", "uuid", "shipper")
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 2)
+	require.Equal(t, zapcore.DebugLevel, entries[0].Level)
+	require.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+	require.Equal(t, map[string]interface{}{"uuid": "shipper"}, entries[1].ContextMap())
+}
@@ -0,0 +1,40 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"log/slog"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+)
+
+// Slog returns a client.Logger writing to a log/slog logger, the keys and
+// values become the attributes of the records.
+func Slog(logger *slog.Logger) client.Logger {
+	return slogLogger{logger: logger}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l slogLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, keysAndValues...)
+}
+
+func (l slogLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.logger.Info(msg, keysAndValues...)
+}
+
+func (l slogLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn(msg, keysAndValues...)
+}
+
+func (l slogLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, keysAndValues...)
+}
@@ -0,0 +1,76 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Metrics receives the measurements of a Client, see the prometheus
+// subpackage for an implementation. It must be safe for concurrent use.
+type Metrics interface {
+	// EventsPublished counts the events of every Publish call.
+	EventsPublished(n int)
+	// EventsAccepted counts the events accepted by the shipper.
+	EventsAccepted(n int)
+	// EventsDropped counts the events of a Publish call that were not
+	// accepted, because the publish failed or the shipper accepted only a
+	// part of the request.
+	EventsDropped(n int)
+	// PublishRetried counts the attempts of a Publish call after the first.
+	PublishRetried()
+	// PublishDuration observes the duration of every publish attempt, err
+	// is the error returned by the shipper, if any.
+	PublishDuration(d time.Duration, err error)
+	// PersistedIndexLag is the difference between the last accepted index and
+	// the persisted index, updated with every persisted index update.
+	PersistedIndexLag(lag uint64)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) EventsPublished(int)                  {}
+func (nopMetrics) EventsAccepted(int)                   {}
+func (nopMetrics) EventsDropped(int)                    {}
+func (nopMetrics) PublishRetried()                      {}
+func (nopMetrics) PublishDuration(time.Duration, error) {}
+func (nopMetrics) PersistedIndexLag(uint64)             {}
+
+// acceptedIndex tracks the last index accepted by the shipper, the indexes
+// restart from zero when the shipper restarts.
+type acceptedIndex struct {
+	mu    sync.Mutex
+	uuid  string
+	index uint64
+}
+
+// update returns true if the reply comes from a new shipper process.
+func (a *acceptedIndex) update(reply *messages.PublishReply) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	restarted := false
+	if reply.GetUuid() != a.uuid {
+		restarted = a.uuid != ""
+		a.uuid = reply.GetUuid()
+		a.index = 0
+	}
+	if reply.GetAcceptedIndex() > a.index {
+		a.index = reply.GetAcceptedIndex()
+	}
+	return restarted
+}
+
+// lag returns the accepted events that are not persisted yet.
+func (a *acceptedIndex) lag(reply *messages.PersistedIndexReply) uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if reply.GetUuid() != a.uuid || reply.GetPersistedIndex() >= a.index {
+		return 0
+	}
+	return a.index - reply.GetPersistedIndex()
+}
@@ -0,0 +1,276 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Endpoint is a shipper address used by MultiClient.
+type Endpoint struct {
+	Address string
+	// Priority orders the endpoints, the lowest values are preferred.
+	Priority int
+}
+
+// BalanceMode selects how MultiClient spreads the publishes.
+type BalanceMode int
+
+const (
+	// BalanceFailover publishes to the preferred healthy endpoint, this is
+	// the default.
+	BalanceFailover BalanceMode = iota
+	// BalanceRoundRobin rotates between the healthy endpoints of the best
+	// priority.
+	BalanceRoundRobin
+)
+
+// DialFunc connects to a single endpoint, like New or DialLocal.
+type DialFunc func(ctx context.Context, address string, opts Options) (*Client, error)
+
+// MultiOptions configures a MultiClient.
+type MultiOptions struct {
+	// Options configure the client of every endpoint. Their retries apply
+	// to a single endpoint, disabling them with a negative MaxRetries fails
+	// over faster.
+	Options
+	// Balance selects how the publishes are spread.
+	Balance BalanceMode
+	// Cooldown is how long an endpoint that failed is avoided, defaults to
+	// 30 seconds.
+	Cooldown time.Duration
+	// Dial connects to the endpoints, defaults to New.
+	Dial DialFunc
+	// Clock measures the cooldowns, defaults to clock.Real.
+	Clock clock.Clock
+}
+
+type endpoint struct {
+	Endpoint
+	client *Client
+	// failed is when the last publish failed, zero if it succeeded
+	failed time.Time
+	// uuid is the shipper process of the last successful publish
+	uuid string
+}
+
+// MultiClient publishes to several shipper endpoints. An endpoint is
+// degraded when its connection is failing, or when a publish failed with an
+// Unavailable status or a deadline within the cooldown. Publishes go to the
+// healthy endpoints first, failing over to the next one on these errors.
+// It is safe for concurrent use.
+type MultiClient struct {
+	opts MultiOptions
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	active    *endpoint
+	next      int
+	// changed is closed and replaced when the active endpoint changes
+	changed chan struct{}
+}
+
+// NewMulti connects to all the endpoints.
+func NewMulti(ctx context.Context, endpoints []Endpoint, opts MultiOptions) (*MultiClient, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("no shipper endpoint")
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 30 * time.Second
+	}
+	if opts.Dial == nil {
+		opts.Dial = New
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.Real
+	}
+	if opts.Logger == nil {
+		opts.Logger = nopLogger{}
+	}
+
+	m := &MultiClient{opts: opts, changed: make(chan struct{})}
+	for _, e := range endpoints {
+		c, err := opts.Dial(ctx, e.Address, opts.Options)
+		if err != nil {
+			_ = m.Close()
+			return nil, err
+		}
+		m.endpoints = append(m.endpoints, &endpoint{Endpoint: e, client: c})
+	}
+	sort.SliceStable(m.endpoints, func(i, j int) bool {
+		return m.endpoints[i].Priority < m.endpoints[j].Priority
+	})
+	m.active = m.endpoints[0]
+	return m, nil
+}
+
+// Publish sends the request to the healthy endpoints in order of
+// preference, until one succeeds or fails with an error other than an
+// Unavailable status or a deadline. The degraded endpoints are tried last.
+//
+// The uuid of the request is only sent to the endpoint it was returned by:
+// after a fail over, the request is sent without it and the reply carries
+// the uuid of the new shipper process, to use in the next requests.
+func (m *MultiClient) Publish(ctx context.Context, req *messages.PublishRequest, opts ...grpc.CallOption) (*messages.PublishReply, error) {
+	var err error
+	for _, e := range m.candidates() {
+		var reply *messages.PublishReply
+		reply, err = e.client.Publish(ctx, m.request(e, req), opts...)
+		if err == nil {
+			m.succeeded(e, reply.GetUuid())
+			return reply, nil
+		}
+		if !failsOver(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		m.failed(e, err)
+	}
+	return nil, err
+}
+
+// request returns req without its uuid if it isn't the one of e.
+func (m *MultiClient) request(e *endpoint, req *messages.PublishRequest) *messages.PublishRequest {
+	if req.GetUuid() == "" {
+		return req
+	}
+	m.mu.Lock()
+	uuid := e.uuid
+	m.mu.Unlock()
+	if req.GetUuid() == uuid {
+		return req
+	}
+	return &messages.PublishRequest{Events: req.GetEvents()}
+}
+
+// failsOver returns true if err means the endpoint is degraded.
+func failsOver(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// candidates returns the endpoints in the order they are tried.
+func (m *MultiClient) candidates() []*endpoint {
+	now := m.opts.Clock.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	healthy := make([]*endpoint, 0, len(m.endpoints))
+	var degraded []*endpoint
+	for _, e := range m.endpoints {
+		if m.degradedLocked(e, now) {
+			degraded = append(degraded, e)
+		} else {
+			healthy = append(healthy, e)
+		}
+	}
+	if m.opts.Balance == BalanceRoundRobin && len(healthy) > 1 {
+		// rotate the endpoints of the best priority
+		n := 1
+		for n < len(healthy) && healthy[n].Priority == healthy[0].Priority {
+			n++
+		}
+		shift := m.next % n
+		m.next++
+		best := append(append([]*endpoint{}, healthy[shift:n]...), healthy[:shift]...)
+		copy(healthy, best)
+	}
+	return append(healthy, degraded...)
+}
+
+func (m *MultiClient) degradedLocked(e *endpoint, now time.Time) bool {
+	if !e.failed.IsZero() && now.Sub(e.failed) < m.opts.Cooldown {
+		return true
+	}
+	return e.client.conn.GetState() == connectivity.TransientFailure
+}
+
+func (m *MultiClient) succeeded(e *endpoint, uuid string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.failed = time.Time{}
+	e.uuid = uuid
+	if m.active != e {
+		m.opts.Logger.Infow("switched shipper endpoint", "from", m.active.Address, "to", e.Address)
+		m.active = e
+		close(m.changed)
+		m.changed = make(chan struct{})
+	}
+}
+
+func (m *MultiClient) failed(e *endpoint, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.failed = m.opts.Clock.Now()
+	m.opts.Logger.Warnw("shipper endpoint degraded", "address", e.Address, "error", err)
+}
+
+// Active returns the address of the endpoint of the last successful
+// publish, or the preferred one before any.
+func (m *MultiClient) Active() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active.Address
+}
+
+// SubscribePersistedIndex is like Client.SubscribePersistedIndex on the
+// active endpoint. When the active endpoint changes, it subscribes to the
+// new one: the updates then come from another shipper process, with its
+// own UUID.
+func (m *MultiClient) SubscribePersistedIndex(ctx context.Context, interval time.Duration, fn func(*messages.PersistedIndexReply) error) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid persisted index polling interval %s", interval)
+	}
+	for {
+		m.mu.Lock()
+		active, changed := m.active, m.changed
+		m.mu.Unlock()
+
+		subCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-changed:
+				cancel()
+			case <-subCtx.Done():
+			}
+		}()
+		err := active.client.SubscribePersistedIndex(subCtx, interval, fn)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		select {
+		case <-changed:
+		default:
+			// fn failed
+			return err
+		}
+	}
+}
+
+// Close closes the connections to all the endpoints.
+func (m *MultiClient) Close() error {
+	var err error
+	for _, e := range m.endpoints {
+		if closeErr := e.client.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close %s: %w", e.Address, closeErr)
+		}
+	}
+	return err
+}
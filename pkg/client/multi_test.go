@@ -0,0 +1,166 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+// newTestMulti serves a servertest server for every address.
+func newTestMulti(t *testing.T, endpoints []Endpoint, opts MultiOptions) (*MultiClient, map[string]*servertest.Server) {
+	servers := map[string]*servertest.Server{}
+	for _, e := range endpoints {
+		srv := servertest.New(servertest.Options{UUID: e.Address})
+		srv.Start()
+		t.Cleanup(srv.Stop)
+		servers[e.Address] = srv
+	}
+	opts.MaxRetries = -1
+	opts.Dial = func(ctx context.Context, address string, opts Options) (*Client, error) {
+		opts.DialOptions = append(opts.DialOptions, servers[address].DialOption())
+		return New(ctx, servertest.Target, opts)
+	}
+	m, err := NewMulti(context.Background(), endpoints, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = m.Close() })
+	return m, servers
+}
+
+func publishTo(t *testing.T, m *MultiClient) string {
+	reply, err := m.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.NoError(t, err)
+	return reply.GetUuid()
+}
+
+func TestMultiClientFailover(t *testing.T) {
+	clk := clock.NewFake(time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC))
+	m, servers := newTestMulti(t, []Endpoint{
+		{Address: "secondary", Priority: 1},
+		{Address: "primary"},
+	}, MultiOptions{Cooldown: time.Minute, Clock: clk})
+
+	require.Equal(t, "primary", m.Active())
+	require.Equal(t, "primary", publishTo(t, m))
+
+	servers["primary"].SetPublishErrors(status.Error(codes.Unavailable, "shipper is stopping"))
+	require.Equal(t, "secondary", publishTo(t, m))
+	require.Equal(t, "secondary", m.Active())
+
+	// the primary is avoided during the cooldown
+	require.Equal(t, "secondary", publishTo(t, m))
+	require.Len(t, servers["primary"].Requests(), 2)
+
+	clk.Advance(time.Minute)
+	require.Equal(t, "primary", publishTo(t, m))
+	require.Equal(t, "primary", m.Active())
+
+	// other errors don't fail over
+	servers["primary"].SetPublishErrors(status.Error(codes.InvalidArgument, "bad request"))
+	_, err := m.Publish(context.Background(), &messages.PublishRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Len(t, servers["secondary"].Requests(), 2)
+
+	// the last error is returned when all the endpoints fail
+	servers["primary"].SetPublishErrors(status.Error(codes.Unavailable, "primary"))
+	servers["secondary"].SetPublishErrors(status.Error(codes.Unavailable, "secondary"))
+	_, err = m.Publish(context.Background(), &messages.PublishRequest{})
+	require.Equal(t, "secondary", status.Convert(err).Message())
+}
+
+func TestMultiClientFailoverUuid(t *testing.T) {
+	m, servers := newTestMulti(t, []Endpoint{
+		{Address: "primary"},
+		{Address: "secondary", Priority: 1},
+	}, MultiOptions{})
+	publish := func(uuid string) *messages.PublishReply {
+		reply, err := m.Publish(context.Background(), &messages.PublishRequest{Uuid: uuid, Events: []*messages.Event{{}}})
+		require.NoError(t, err)
+		return reply
+	}
+
+	reply := publish("")
+	require.Equal(t, "primary", reply.Uuid)
+
+	// the uuid of the primary isn't sent to the secondary
+	servers["primary"].SetPublishErrors(status.Error(codes.Unavailable, "shipper is stopping"))
+	reply = publish(reply.Uuid)
+	require.Equal(t, "secondary", reply.Uuid)
+	require.EqualValues(t, 1, reply.AcceptedCount)
+	require.Empty(t, servers["secondary"].Requests()[0].Uuid)
+
+	// the uuid of the secondary is, a restart is still detected
+	servers["secondary"].Restart("restarted")
+	reply = publish(reply.Uuid)
+	require.Equal(t, "restarted", reply.Uuid)
+	require.Zero(t, reply.AcceptedCount)
+	require.Equal(t, "secondary", servers["secondary"].Requests()[1].Uuid)
+	require.EqualValues(t, 1, publish(reply.Uuid).AcceptedCount)
+}
+
+func TestMultiClientRoundRobin(t *testing.T) {
+	m, servers := newTestMulti(t, []Endpoint{
+		{Address: "a"},
+		{Address: "b"},
+		{Address: "backup", Priority: 1},
+	}, MultiOptions{Balance: BalanceRoundRobin})
+
+	for i := 0; i < 4; i++ {
+		publishTo(t, m)
+	}
+	require.Len(t, servers["a"].Requests(), 2)
+	require.Len(t, servers["b"].Requests(), 2)
+	require.Empty(t, servers["backup"].Requests())
+}
+
+func TestMultiClientSubscribeFollowsActive(t *testing.T) {
+	m, servers := newTestMulti(t, []Endpoint{
+		{Address: "primary"},
+		{Address: "secondary", Priority: 1},
+	}, MultiOptions{})
+	publishTo(t, m)
+
+	updates := make(chan string, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- m.SubscribePersistedIndex(ctx, time.Millisecond, func(reply *messages.PersistedIndexReply) error {
+			updates <- reply.GetUuid()
+			return nil
+		})
+	}()
+	require.Equal(t, "primary", <-updates)
+
+	servers["primary"].SetPublishErrors(status.Error(codes.Unavailable, "shipper is stopping"))
+	publishTo(t, m)
+	require.Eventually(t, func() bool {
+		return <-updates == "secondary"
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestNewMultiErrors(t *testing.T) {
+	_, err := NewMulti(context.Background(), nil, MultiOptions{})
+	require.Error(t, err)
+
+	errDial := errors.New("dial failed")
+	_, err = NewMulti(context.Background(), []Endpoint{{Address: "a"}}, MultiOptions{
+		Dial: func(context.Context, string, Options) (*Client, error) { return nil, errDial },
+	})
+	require.ErrorIs(t, err, errDial)
+}
@@ -0,0 +1,127 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package prometheus implements the client metrics with Prometheus
+// collectors:
+//
+//	metrics, err := prometheus.New(prom.DefaultRegisterer, prometheus.Options{})
+//	c, err := client.New(ctx, address, client.Options{Metrics: metrics})
+package prometheus
+
+import (
+	"fmt"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+)
+
+// Options configures the collectors.
+type Options struct {
+	// Namespace prefixes the metric names. Defaults to "shipper_client".
+	Namespace string
+	// ConstLabels are added to all the metrics, to tell apart several clients
+	// in the same process.
+	ConstLabels prom.Labels
+	// Buckets of the publish duration histogram in seconds. Defaults to
+	// prometheus.DefBuckets.
+	Buckets []float64
+}
+
+// Metrics is a client.Metrics recording into Prometheus collectors.
+type Metrics struct {
+	published prom.Counter
+	accepted  prom.Counter
+	dropped   prom.Counter
+	retries   prom.Counter
+	lag       prom.Gauge
+	throttle  prom.Gauge
+	duration  *prom.HistogramVec
+}
+
+var _ client.Metrics = (*Metrics)(nil)
+
+// New creates the collectors and registers them in reg.
+func New(reg prom.Registerer, opts Options) (*Metrics, error) {
+	if opts.Namespace == "" {
+		opts.Namespace = "shipper_client"
+	}
+	if opts.Buckets == nil {
+		opts.Buckets = prom.DefBuckets
+	}
+	counter := func(name, help string) prom.Counter {
+		return prom.NewCounter(prom.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: opts.ConstLabels,
+		})
+	}
+	m := &Metrics{
+		published: counter("events_published_total", "Events sent to the shipper in publish calls."),
+		accepted:  counter("events_accepted_total", "Events accepted by the shipper."),
+		dropped:   counter("events_dropped_total", "Events of publish calls not accepted by the shipper."),
+		retries:   counter("publish_retries_total", "Publish attempts retried while the shipper was unavailable."),
+		lag: prom.NewGauge(prom.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Name:        "persisted_index_lag",
+			Help:        "Accepted events not persisted by the shipper yet.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		throttle: prom.NewGauge(prom.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Name:        "throttle_level",
+			Help:        "Throttling of the publishes by the flow control, from 0 for none to 1.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		duration: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        "publish_duration_seconds",
+			Help:        "Duration of the publish attempts by gRPC status code.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.Buckets,
+		}, []string{"code"}),
+	}
+	for _, c := range m.collectors() {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("failed to register shipper client metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) collectors() []prom.Collector {
+	return []prom.Collector{m.published, m.accepted, m.dropped, m.retries, m.lag, m.throttle, m.duration}
+}
+
+func (m *Metrics) EventsPublished(n int) {
+	m.published.Add(float64(n))
+}
+
+func (m *Metrics) EventsAccepted(n int) {
+	m.accepted.Add(float64(n))
+}
+
+func (m *Metrics) EventsDropped(n int) {
+	m.dropped.Add(float64(n))
+}
+
+func (m *Metrics) PublishRetried() {
+	m.retries.Inc()
+}
+
+func (m *Metrics) PublishDuration(d time.Duration, err error) {
+	m.duration.WithLabelValues(status.Code(err).String()).Observe(d.Seconds())
+}
+
+func (m *Metrics) PersistedIndexLag(lag uint64) {
+	m.lag.Set(float64(lag))
+}
+
+// ThrottleLevel implements publisher.FlowMetrics.
+func (m *Metrics) ThrottleLevel(level float64) {
+	m.throttle.Set(level)
+}
@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prom.NewRegistry()
+	metrics, err := New(reg, Options{ConstLabels: prom.Labels{"output": "default"}})
+	require.NoError(t, err)
+
+	srv := servertest.New(servertest.Options{})
+	srv.Start()
+	t.Cleanup(srv.Stop)
+	srv.SetAcceptLimit(2)
+	srv.SetPublishErrors(status.Error(codes.Unavailable, "queue is not ready"))
+
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		Backoff:     client.BackoffConfig{Init: time.Millisecond, Max: time.Millisecond},
+		Metrics:     metrics,
+		DialOptions: []grpc.DialOption{srv.DialOption()},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	reply, err := c.Publish(context.Background(), &messages.PublishRequest{
+		Events: []*messages.Event{{}, {}, {}},
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, reply.AcceptedCount)
+
+	require.Equal(t, 3.0, testutil.ToFloat64(metrics.published))
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.accepted))
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.dropped))
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.retries))
+	require.Equal(t, 2, testutil.CollectAndCount(metrics.duration), "one series per status code")
+
+	require.NoError(t, srv.Persist(1))
+	stop := errors.New("stop")
+	err = c.SubscribePersistedIndex(context.Background(), time.Millisecond, func(*messages.PersistedIndexReply) error {
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.lag))
+
+	metrics.ThrottleLevel(0.5)
+	require.Equal(t, 0.5, testutil.ToFloat64(metrics.throttle))
+
+	_, err = New(reg, Options{ConstLabels: prom.Labels{"output": "default"}})
+	require.Error(t, err, "registering the same metrics twice must fail")
+}
@@ -0,0 +1,163 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// TimeoutPolicy decides how long a single PublishEvents call may take.
+type TimeoutPolicy interface {
+	// Timeout returns the deadline to use for a request of size bytes.
+	Timeout(size int) time.Duration
+	// Observe records that a request of size bytes completed in elapsed.
+	Observe(size int, elapsed time.Duration)
+}
+
+// FixedTimeout is a TimeoutPolicy that always returns the same duration.
+type FixedTimeout time.Duration
+
+// Timeout implements TimeoutPolicy.
+func (t FixedTimeout) Timeout(int) time.Duration {
+	return time.Duration(t)
+}
+
+// Observe implements TimeoutPolicy. Fixed timeouts ignore observations.
+func (FixedTimeout) Observe(int, time.Duration) {}
+
+// DynamicTimeoutConfig configures a DynamicTimeout.
+type DynamicTimeoutConfig struct {
+	// Base is the fixed overhead allowed for every request, regardless of
+	// size. Zero takes the default of 5 seconds, a negative value allows no
+	// overhead.
+	Base time.Duration
+	// Min and Max bound the computed timeout.
+	Min time.Duration
+	Max time.Duration
+	// InitialThroughput is the assumed throughput in bytes per second
+	// until the first request has been observed.
+	InitialThroughput float64
+	// Factor is the safety margin applied to the expected transfer time.
+	Factor float64
+	// Smoothing is the weight (0, 1] given to each new throughput sample.
+	Smoothing float64
+}
+
+// DefaultDynamicTimeoutConfig returns a configuration suitable for a local shipper.
+func DefaultDynamicTimeoutConfig() DynamicTimeoutConfig {
+	return DynamicTimeoutConfig{
+		Base:              5 * time.Second,
+		Min:               5 * time.Second,
+		Max:               5 * time.Minute,
+		InitialThroughput: 1 << 20, // 1MiB/s
+		Factor:            3,
+		Smoothing:         0.2,
+	}
+}
+
+// DynamicTimeout is a TimeoutPolicy that scales the deadline with the size
+// of the request and the throughput observed on previous requests.
+// It is safe for concurrent use.
+type DynamicTimeout struct {
+	config DynamicTimeoutConfig
+
+	mu         sync.Mutex
+	throughput float64
+}
+
+// NewDynamicTimeout returns a DynamicTimeout using the given configuration.
+// Zero values in config are replaced by their defaults.
+func NewDynamicTimeout(config DynamicTimeoutConfig) *DynamicTimeout {
+	defaults := DefaultDynamicTimeoutConfig()
+	switch {
+	case config.Base == 0:
+		config.Base = defaults.Base
+	case config.Base < 0:
+		config.Base = 0
+	}
+	if config.Min <= 0 {
+		config.Min = defaults.Min
+	}
+	if config.Max <= 0 {
+		config.Max = defaults.Max
+	}
+	if config.Max < config.Min {
+		config.Max = config.Min
+	}
+	if config.InitialThroughput <= 0 {
+		config.InitialThroughput = defaults.InitialThroughput
+	}
+	if config.Factor <= 0 {
+		config.Factor = defaults.Factor
+	}
+	if config.Smoothing <= 0 || config.Smoothing > 1 {
+		config.Smoothing = defaults.Smoothing
+	}
+	return &DynamicTimeout{
+		config:     config,
+		throughput: config.InitialThroughput,
+	}
+}
+
+// Timeout implements TimeoutPolicy.
+func (d *DynamicTimeout) Timeout(size int) time.Duration {
+	d.mu.Lock()
+	throughput := d.throughput
+	d.mu.Unlock()
+
+	// clamped before the conversion, a slow throughput overflows a Duration
+	timeout := float64(d.config.Base) + float64(size)/throughput*d.config.Factor*float64(time.Second)
+	if timeout < float64(d.config.Min) {
+		return d.config.Min
+	}
+	if timeout > float64(d.config.Max) {
+		return d.config.Max
+	}
+	return time.Duration(timeout)
+}
+
+// Observe implements TimeoutPolicy.
+func (d *DynamicTimeout) Observe(size int, elapsed time.Duration) {
+	if size <= 0 || elapsed <= 0 {
+		return
+	}
+	sample := float64(size) / elapsed.Seconds()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.throughput += d.config.Smoothing * (sample - d.throughput)
+}
+
+// Throughput returns the current throughput estimate in bytes per second.
+func (d *DynamicTimeout) Throughput() float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.throughput
+}
+
+// PublishEvents sends req using a deadline computed by policy from the
+// marshaled size of the request. Successful calls are reported back to
+// the policy so it can adapt to the observed throughput.
+func PublishEvents(ctx context.Context, client pb.ProducerClient, policy TimeoutPolicy, req *messages.PublishRequest, opts ...grpc.CallOption) (*messages.PublishReply, error) {
+	size := proto.Size(req)
+	ctx, cancel := context.WithTimeout(ctx, policy.Timeout(size))
+	defer cancel()
+
+	start := time.Now()
+	reply, err := client.PublishEvents(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	policy.Observe(size, time.Since(start))
+	return reply, nil
+}
@@ -0,0 +1,121 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package client
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestDynamicTimeout(t *testing.T) {
+	config := DynamicTimeoutConfig{
+		Base:              time.Second,
+		Min:               2 * time.Second,
+		Max:               time.Minute,
+		InitialThroughput: 1000,
+		Factor:            2,
+		Smoothing:         1,
+	}
+
+	cases := []struct {
+		name string
+		size int
+		exp  time.Duration
+	}{
+		{
+			name: "small batches use the minimum",
+			size: 100,
+			exp:  2 * time.Second,
+		},
+		{
+			name: "timeout scales with size",
+			size: 5000,
+			exp:  11 * time.Second,
+		},
+		{
+			name: "large batches are capped",
+			size: 1 << 30,
+			exp:  time.Minute,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			policy := NewDynamicTimeout(config)
+			require.Equal(t, c.exp, policy.Timeout(c.size))
+		})
+	}
+}
+
+func TestDynamicTimeoutDefaults(t *testing.T) {
+	defaults := NewDynamicTimeout(DefaultDynamicTimeoutConfig())
+	policy := NewDynamicTimeout(DynamicTimeoutConfig{})
+	for _, size := range []int{0, 100, 10 << 20, 1 << 30} {
+		require.Equal(t, defaults.Timeout(size), policy.Timeout(size), "size %d", size)
+	}
+}
+
+func TestDynamicTimeoutBounds(t *testing.T) {
+	// the transfer time of a slow throughput is beyond a Duration
+	policy := NewDynamicTimeout(DynamicTimeoutConfig{InitialThroughput: 1e-6, Max: time.Hour})
+	for _, size := range []int{10 << 20, math.MaxInt32} {
+		require.Equal(t, time.Hour, policy.Timeout(size), "size %d", size)
+	}
+
+	// a negative base allows no overhead
+	policy = NewDynamicTimeout(DynamicTimeoutConfig{
+		Base:              -1,
+		Min:               time.Millisecond,
+		InitialThroughput: 1000,
+		Factor:            1,
+	})
+	require.Equal(t, time.Second, policy.Timeout(1000))
+	require.Equal(t, time.Millisecond, policy.Timeout(0))
+}
+
+func TestDynamicTimeoutObserve(t *testing.T) {
+	policy := NewDynamicTimeout(DynamicTimeoutConfig{
+		Base:              time.Second,
+		InitialThroughput: 1000,
+		Factor:            1,
+		Smoothing:         0.5,
+	})
+
+	// a 4000 bytes/s sample moves the estimate halfway from 1000
+	policy.Observe(4000, time.Second)
+	require.Equal(t, float64(2500), policy.Throughput())
+
+	// invalid samples are ignored
+	policy.Observe(0, time.Second)
+	policy.Observe(100, 0)
+	require.Equal(t, float64(2500), policy.Throughput())
+}
+
+type deadlineRecorder struct {
+	pb.ProducerClient
+	remaining time.Duration
+}
+
+func (d *deadlineRecorder) PublishEvents(ctx context.Context, _ *messages.PublishRequest, _ ...grpc.CallOption) (*messages.PublishReply, error) {
+	deadline, _ := ctx.Deadline()
+	d.remaining = time.Until(deadline)
+	return &messages.PublishReply{}, nil
+}
+
+func TestPublishEventsDeadline(t *testing.T) {
+	recorder := &deadlineRecorder{}
+	_, err := PublishEvents(context.Background(), recorder, FixedTimeout(time.Minute), &messages.PublishRequest{})
+	require.NoError(t, err)
+	require.Greater(t, recorder.remaining, 50*time.Second)
+	require.LessOrEqual(t, recorder.remaining, time.Minute)
+}
@@ -0,0 +1,231 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package tracing provides gRPC client interceptors creating OpenTelemetry
+// spans for the calls to the shipper, and propagating the trace context in
+// the request metadata:
+//
+//	c, err := client.New(ctx, address, client.Options{
+//		DialOptions: tracing.DialOptions(),
+//	})
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// instrumentationName identifies the tracer of the package.
+const instrumentationName = "github.com/elastic/elastic-agent-shipper-client/pkg/client/tracing"
+
+// Attributes set in the spans, besides the RPC semantic conventions.
+const (
+	// EventsKey is the number of events in a PublishEvents request.
+	EventsKey = attribute.Key("shipper.events")
+	// AcceptedKey is the number of events accepted by the shipper.
+	AcceptedKey = attribute.Key("shipper.events.accepted")
+	// MessagesKey is the number of messages received in a stream.
+	MessagesKey = attribute.Key("shipper.stream.messages")
+)
+
+// Option configures the interceptors.
+type Option func(*config)
+
+type config struct {
+	provider    trace.TracerProvider
+	propagators propagation.TextMapPropagator
+}
+
+// WithTracerProvider sets the provider of the tracer. Defaults to the global
+// provider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = provider
+	}
+}
+
+// WithPropagators sets the propagators of the trace context. Defaults to the
+// global propagators.
+func WithPropagators(propagators propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagators = propagators
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		provider:    otel.GetTracerProvider(),
+		propagators: otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// DialOptions returns the dial options installing both interceptors.
+func DialOptions(opts ...Option) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor(opts...)),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptor(opts...)),
+	}
+}
+
+// UnaryClientInterceptor creates a span for every unary call, like
+// PublishEvents.
+func UnaryClientInterceptor(opts ...Option) grpc.UnaryClientInterceptor {
+	c := newConfig(opts)
+	tracer := c.provider.Tracer(instrumentationName)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		ctx, span := c.start(ctx, tracer, method)
+		defer span.End()
+		if r, ok := req.(*messages.PublishRequest); ok {
+			span.SetAttributes(EventsKey.Int(len(r.GetEvents())))
+		}
+
+		err := invoker(ctx, method, req, reply, cc, callOpts...)
+		if r, ok := reply.(*messages.PublishReply); ok && err == nil {
+			span.SetAttributes(AcceptedKey.Int64(int64(r.GetAcceptedCount())))
+		}
+		setStatus(span, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor creates a span for every stream, like
+// PersistedIndex. The span ends when the stream does.
+func StreamClientInterceptor(opts ...Option) grpc.StreamClientInterceptor {
+	c := newConfig(opts)
+	tracer := c.provider.Tracer(instrumentationName)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := c.start(ctx, tracer, method)
+		stream, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			setStatus(span, err)
+			span.End()
+			return nil, err
+		}
+		s := &tracedStream{ClientStream: stream, span: span}
+		go func() {
+			// the caller isn't required to read the stream until it ends
+			<-stream.Context().Done()
+			s.end(stream.Context().Err())
+		}()
+		return s, nil
+	}
+}
+
+func (c *config) start(ctx context.Context, tracer trace.Tracer, method string) (context.Context, trace.Span) {
+	service, name := splitMethod(method)
+	ctx, span := tracer.Start(ctx, strings.TrimPrefix(method, "/"),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", name),
+		),
+	)
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	c.propagators.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// splitMethod splits "/package.Service/Method".
+func splitMethod(method string) (service, name string) {
+	method = strings.TrimPrefix(method, "/")
+	if i := strings.LastIndex(method, "/"); i >= 0 {
+		return method[:i], method[i+1:]
+	}
+	return "", method
+}
+
+func setStatus(span trace.Span, err error) {
+	s, ok := status.FromError(err)
+	if !ok {
+		// a stream ends with the error of its context
+		s = status.FromContextError(err)
+	}
+	span.SetAttributes(attribute.Int64("rpc.grpc.status_code", int64(s.Code())))
+	// the caller canceling the call is not an error
+	if err != nil && s.Code() != codes.Canceled {
+		span.SetStatus(otelcodes.Error, s.Message())
+	}
+}
+
+type tracedStream struct {
+	grpc.ClientStream
+	span trace.Span
+
+	once     sync.Once
+	mu       sync.Mutex
+	received int
+}
+
+func (s *tracedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		s.end(nil)
+	case err != nil:
+		s.end(err)
+	default:
+		s.mu.Lock()
+		s.received++
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *tracedStream) end(err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.span.SetAttributes(MessagesKey.Int(s.received))
+		s.mu.Unlock()
+		setStatus(s.span, err)
+		s.span.End()
+	})
+}
+
+// metadataCarrier adapts the gRPC metadata to the propagators.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
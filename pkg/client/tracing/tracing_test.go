@@ -0,0 +1,170 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+type tracingTest struct {
+	recorder *tracetest.SpanRecorder
+	provider *sdktrace.TracerProvider
+	srv      *servertest.Server
+	client   *client.Client
+
+	mu           sync.Mutex
+	traceparents []string
+}
+
+func newTracingTest(t *testing.T) *tracingTest {
+	tt := &tracingTest{recorder: tracetest.NewSpanRecorder()}
+	tt.provider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(tt.recorder))
+
+	record := func(ctx context.Context) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		tt.mu.Lock()
+		defer tt.mu.Unlock()
+		tt.traceparents = append(tt.traceparents, md.Get("traceparent")...)
+	}
+	tt.srv = servertest.New(servertest.Options{
+		ServerOptions: []grpc.ServerOption{
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				record(ctx)
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				record(ss.Context())
+				return handler(srv, ss)
+			}),
+		},
+	})
+	tt.srv.Start()
+	t.Cleanup(tt.srv.Stop)
+
+	dialOpts := append(DialOptions(
+		WithTracerProvider(tt.provider),
+		WithPropagators(propagation.TraceContext{}),
+	), tt.srv.DialOption())
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		DialOptions: dialOpts,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	tt.client = c
+	return tt
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	tt := newTracingTest(t)
+	tt.srv.SetAcceptLimit(1)
+
+	ctx, parent := tt.provider.Tracer("test").Start(context.Background(), "publish batch")
+	_, err := tt.client.Publish(ctx, &messages.PublishRequest{Events: []*messages.Event{{}, {}}})
+	require.NoError(t, err)
+	parent.End()
+
+	tt.srv.SetPublishErrors(status.Error(codes.InvalidArgument, "bad request"))
+	_, err = tt.client.Publish(context.Background(), &messages.PublishRequest{})
+	require.Error(t, err)
+
+	spans := tt.recorder.Ended()
+	require.Len(t, spans, 3)
+	publish, parentSpan, failed := spans[0], spans[1], spans[2]
+
+	require.Equal(t, "elastic.agent.shipper.v1.Producer/PublishEvents", publish.Name())
+	require.Equal(t, trace.SpanKindClient, publish.SpanKind())
+	require.Equal(t, parentSpan.SpanContext().SpanID(), publish.Parent().SpanID())
+	attrs := attributes(publish)
+	require.Equal(t, "grpc", attrs["rpc.system"].AsString())
+	require.Equal(t, "elastic.agent.shipper.v1.Producer", attrs["rpc.service"].AsString())
+	require.Equal(t, "PublishEvents", attrs["rpc.method"].AsString())
+	require.EqualValues(t, 2, attrs[EventsKey].AsInt64())
+	require.EqualValues(t, 1, attrs[AcceptedKey].AsInt64())
+	require.Equal(t, otelcodes.Unset, publish.Status().Code)
+
+	require.Equal(t, otelcodes.Error, failed.Status().Code)
+	require.EqualValues(t, codes.InvalidArgument, attributes(failed)["rpc.grpc.status_code"].AsInt64())
+
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	require.Len(t, tt.traceparents, 2)
+	require.Contains(t, tt.traceparents[0], publish.SpanContext().TraceID().String())
+	require.Contains(t, tt.traceparents[0], publish.SpanContext().SpanID().String())
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	tt := newTracingTest(t)
+
+	stop := errors.New("stop")
+	received := 0
+	err := tt.client.SubscribePersistedIndex(context.Background(), time.Millisecond, func(*messages.PersistedIndexReply) error {
+		received++
+		if received == 2 {
+			return stop
+		}
+		_, err := tt.client.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+		require.NoError(t, err)
+		tt.srv.PersistAll()
+		return nil
+	})
+	require.ErrorIs(t, err, stop)
+
+	var stream sdktrace.ReadOnlySpan
+	require.Eventually(t, func() bool {
+		for _, span := range tt.recorder.Ended() {
+			if span.Name() == "elastic.agent.shipper.v1.Producer/PersistedIndex" {
+				stream = span
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond, "the stream span must end when the stream is canceled")
+	require.EqualValues(t, 2, attributes(stream)[MessagesKey].AsInt64())
+	require.Equal(t, trace.SpanKindClient, stream.SpanKind())
+	require.EqualValues(t, codes.Canceled, attributes(stream)["rpc.grpc.status_code"].AsInt64())
+	require.Equal(t, otelcodes.Unset, stream.Status().Code, "canceling the stream is not an error")
+
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	require.Contains(t, tt.traceparents, "00-"+stream.SpanContext().TraceID().String()+"-"+stream.SpanContext().SpanID().String()+"-01")
+}
+
+func TestSplitMethod(t *testing.T) {
+	service, method := splitMethod("/elastic.agent.shipper.v1.Producer/PublishEvents")
+	require.Equal(t, "elastic.agent.shipper.v1.Producer", service)
+	require.Equal(t, "PublishEvents", method)
+
+	service, method = splitMethod("PublishEvents")
+	require.Equal(t, "", service)
+	require.Equal(t, "PublishEvents", method)
+}
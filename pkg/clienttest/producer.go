@@ -0,0 +1,243 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package clienttest provides fakes of the shipper clients, to unit test
+// the code publishing events without a gRPC server. Producer implements
+// both the generated pb.ProducerClient and the client.Producer interface
+// of the managed client:
+//
+//	p := clienttest.NewProducer("shipper-uuid")
+//	p.SetAcceptLimit(10)
+//	run(ctx, p) // code depending on client.Producer
+//	require.Len(t, p.Events(), 10)
+//
+// To test against a real gRPC server, see the servertest package.
+package clienttest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Producer is a fake shipper client behaving like servertest.Server: it
+// records the published events and lets tests control accepted counts,
+// errors and the persisted index. It is safe for concurrent use.
+type Producer struct {
+	mu             sync.Mutex
+	uuid           string
+	requests       []*messages.PublishRequest
+	events         []*messages.Event
+	acceptLimit    int
+	publishErrors  []error
+	acceptedIndex  uint64
+	persistedIndex uint64
+	streams        map[*PersistedIndexStream]struct{}
+	closed         bool
+}
+
+var (
+	_ pb.ProducerClient = (*Producer)(nil)
+	_ client.Producer   = (*Producer)(nil)
+)
+
+// NewProducer returns a Producer faking the shipper with uuid.
+func NewProducer(uuid string) *Producer {
+	return &Producer{uuid: uuid, streams: map[*PersistedIndexStream]struct{}{}}
+}
+
+// PublishEvents implements pb.ProducerClient. The call options are
+// ignored.
+func (p *Producer) PublishEvents(ctx context.Context, req *messages.PublishRequest, _ ...grpc.CallOption) (*messages.PublishReply, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+	if len(p.publishErrors) > 0 {
+		err := p.publishErrors[0]
+		p.publishErrors = p.publishErrors[1:]
+		return nil, err
+	}
+
+	reply := &messages.PublishReply{Uuid: p.uuid}
+	if req.GetUuid() != "" && req.GetUuid() != p.uuid {
+		reply.AcceptedIndex = p.acceptedIndex
+		return reply, nil
+	}
+	accepted := req.GetEvents()
+	if p.acceptLimit > 0 && len(accepted) > p.acceptLimit {
+		accepted = accepted[:p.acceptLimit]
+	}
+	p.events = append(p.events, accepted...)
+	p.acceptedIndex += uint64(len(accepted))
+	reply.AcceptedCount = uint32(len(accepted))
+	reply.AcceptedIndex = p.acceptedIndex
+	return reply, nil
+}
+
+// Publish implements client.Producer, like PublishEvents: the fake doesn't
+// retry.
+func (p *Producer) Publish(ctx context.Context, req *messages.PublishRequest, opts ...grpc.CallOption) (*messages.PublishReply, error) {
+	return p.PublishEvents(ctx, req, opts...)
+}
+
+// PersistedIndex implements pb.ProducerClient and client.Producer. The
+// stream sends the current persisted index right away, then every change,
+// the polling interval is ignored. It ends with ctx.
+func (p *Producer) PersistedIndex(ctx context.Context, _ *messages.PersistedIndexRequest, _ ...grpc.CallOption) (pb.Producer_PersistedIndexClient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	stream := NewPersistedIndexStream(ctx)
+	p.mu.Lock()
+	stream.Send(p.persistedIndexReplyLocked())
+	p.streams[stream] = struct{}{}
+	p.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		p.mu.Lock()
+		delete(p.streams, stream)
+		p.mu.Unlock()
+	}()
+	return stream, nil
+}
+
+// SubscribePersistedIndex implements client.Producer, it calls fn with the
+// updates of the persisted index until ctx is done or fn fails. The
+// interval is ignored.
+func (p *Producer) SubscribePersistedIndex(ctx context.Context, interval time.Duration, fn func(*messages.PersistedIndexReply) error) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid persisted index polling interval %s", interval)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := p.PersistedIndex(ctx, &messages.PersistedIndexRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		reply, err := stream.Recv()
+		if err != nil {
+			return ctx.Err()
+		}
+		if err := fn(reply); err != nil {
+			return err
+		}
+	}
+}
+
+// Close implements client.Producer, it only records the call, see Closed.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+// Closed returns whether Close was called.
+func (p *Producer) Closed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+func (p *Producer) persistedIndexReplyLocked() *messages.PersistedIndexReply {
+	return &messages.PersistedIndexReply{Uuid: p.uuid, PersistedIndex: p.persistedIndex}
+}
+
+// SetAcceptLimit limits how many events of each request are accepted.
+// Zero accepts all events.
+func (p *Producer) SetAcceptLimit(limit int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.acceptLimit = limit
+}
+
+// SetPublishErrors makes the next publishes fail, one error per call.
+func (p *Producer) SetPublishErrors(errs ...error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.publishErrors = append(p.publishErrors[:0], errs...)
+}
+
+// Persist advances the persisted index and notifies the open streams. It
+// can't go past the accepted index.
+func (p *Producer) Persist(index uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if index > p.acceptedIndex {
+		return fmt.Errorf("index %d has not been accepted, the accepted index is %d", index, p.acceptedIndex)
+	}
+	if index > p.persistedIndex {
+		p.persistedIndex = index
+		p.notifyLocked()
+	}
+	return nil
+}
+
+// PersistAll marks every accepted event as persisted.
+func (p *Producer) PersistAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.persistedIndex != p.acceptedIndex {
+		p.persistedIndex = p.acceptedIndex
+		p.notifyLocked()
+	}
+}
+
+// Restart simulates a restart of the shipper process: the uuid changes and
+// the indexes are reset. Recorded events are kept.
+func (p *Producer) Restart(uuid string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.uuid = uuid
+	p.acceptedIndex = 0
+	p.persistedIndex = 0
+	p.notifyLocked()
+}
+
+func (p *Producer) notifyLocked() {
+	for stream := range p.streams {
+		stream.Send(p.persistedIndexReplyLocked())
+	}
+}
+
+// UUID returns the uuid of the faked shipper.
+func (p *Producer) UUID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.uuid
+}
+
+// Requests returns all the received publish requests, including the
+// failed ones.
+func (p *Producer) Requests() []*messages.PublishRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*messages.PublishRequest(nil), p.requests...)
+}
+
+// Events returns all the accepted events, in order.
+func (p *Producer) Events() []*messages.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*messages.Event(nil), p.events...)
+}
+
+// Indexes returns the current accepted and persisted indexes.
+func (p *Producer) Indexes() (accepted, persisted uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.acceptedIndex, p.persistedIndex
+}
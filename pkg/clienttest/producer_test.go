@@ -0,0 +1,152 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package clienttest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func testEvents(n int) []*messages.Event {
+	events := make([]*messages.Event, n)
+	for i := range events {
+		events[i] = &messages.Event{Source: &messages.Source{InputId: "in"}}
+	}
+	return events
+}
+
+func TestProducerPublish(t *testing.T) {
+	ctx := context.Background()
+	p := NewProducer("uuid")
+	var c client.Producer = p
+
+	reply, err := c.Publish(ctx, &messages.PublishRequest{Events: testEvents(3)})
+	require.NoError(t, err)
+	require.Equal(t, &messages.PublishReply{Uuid: "uuid", AcceptedCount: 3, AcceptedIndex: 3}, reply)
+
+	p.SetAcceptLimit(1)
+	reply, err = p.PublishEvents(ctx, &messages.PublishRequest{Uuid: "uuid", Events: testEvents(2)})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), reply.AcceptedCount)
+	require.Equal(t, uint64(4), reply.AcceptedIndex)
+
+	reply, err = c.Publish(ctx, &messages.PublishRequest{Uuid: "other", Events: testEvents(2)})
+	require.NoError(t, err)
+	require.Zero(t, reply.AcceptedCount, "a request for another shipper is not accepted")
+
+	p.SetPublishErrors(status.Error(codes.Unavailable, "down"))
+	_, err = c.Publish(ctx, &messages.PublishRequest{Events: testEvents(1)})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.Publish(canceled, &messages.PublishRequest{Events: testEvents(1)})
+	require.Equal(t, codes.Canceled, status.Code(err))
+
+	require.Len(t, p.Events(), 4)
+	require.Len(t, p.Requests(), 4)
+	accepted, persisted := p.Indexes()
+	require.Equal(t, uint64(4), accepted)
+	require.Zero(t, persisted)
+
+	require.NoError(t, c.Close())
+	require.True(t, p.Closed())
+}
+
+func TestProducerPersistedIndex(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewProducer("uuid")
+	_, err := p.Publish(ctx, &messages.PublishRequest{Events: testEvents(5)})
+	require.NoError(t, err)
+
+	stream, err := p.PersistedIndex(ctx, &messages.PersistedIndexRequest{})
+	require.NoError(t, err)
+	reply, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), reply.PersistedIndex, "the current value is sent right away")
+
+	require.NoError(t, p.Persist(2))
+	require.EqualError(t, p.Persist(6), "index 6 has not been accepted, the accepted index is 5")
+	reply, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), reply.PersistedIndex)
+
+	p.PersistAll()
+	var got messages.PersistedIndexReply
+	require.NoError(t, stream.RecvMsg(&got))
+	require.Equal(t, uint64(5), got.PersistedIndex)
+
+	p.Restart("restarted")
+	reply, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "restarted", reply.Uuid)
+	require.Zero(t, reply.PersistedIndex)
+
+	cancel()
+	_, err = stream.Recv()
+	require.Equal(t, codes.Canceled, status.Code(err))
+}
+
+func TestProducerSubscribePersistedIndex(t *testing.T) {
+	ctx := context.Background()
+	p := NewProducer("uuid")
+	_, err := p.Publish(ctx, &messages.PublishRequest{Events: testEvents(5)})
+	require.NoError(t, err)
+
+	done := errors.New("done")
+	errs := make(chan error)
+	var seen []uint64
+	go func() {
+		errs <- p.SubscribePersistedIndex(ctx, time.Second, func(reply *messages.PersistedIndexReply) error {
+			seen = append(seen, reply.PersistedIndex)
+			if reply.PersistedIndex == 5 {
+				return done
+			}
+			return nil
+		})
+	}()
+	require.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return len(p.streams) == 1
+	}, time.Second, time.Millisecond)
+	p.PersistAll()
+	require.ErrorIs(t, <-errs, done)
+	require.Equal(t, []uint64{0, 5}, seen)
+
+	require.Error(t, p.SubscribePersistedIndex(ctx, 0, nil))
+}
+
+func TestPersistedIndexStream(t *testing.T) {
+	s := NewPersistedIndexStream(context.Background())
+	s.Send(&messages.PersistedIndexReply{PersistedIndex: 1})
+	s.CloseWithError(nil)
+	s.Send(&messages.PersistedIndexReply{PersistedIndex: 2})
+
+	reply, err := s.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), reply.PersistedIndex)
+	_, err = s.Recv()
+	require.ErrorIs(t, err, io.EOF, "the replies sent after the close are dropped")
+
+	s = NewPersistedIndexStream(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.CloseWithError(status.Error(codes.Unavailable, "down"))
+	}()
+	_, err = s.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err), "Recv blocks until the stream closes")
+	require.Error(t, s.SendMsg(&messages.PersistedIndexRequest{}))
+}
@@ -0,0 +1,136 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package clienttest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// PersistedIndexStream is a fake pb.Producer_PersistedIndexClient. Recv
+// returns the replies given to Send, in order, and blocks until there is
+// one. Once the replies are consumed, it returns the error given to
+// CloseWithError, or a Canceled status once the context is done, like a
+// gRPC stream. It is safe for concurrent use.
+type PersistedIndexStream struct {
+	ctx context.Context
+
+	mu      sync.Mutex
+	replies []*messages.PersistedIndexReply
+	err     error
+	notify  chan struct{}
+}
+
+var _ pb.Producer_PersistedIndexClient = (*PersistedIndexStream)(nil)
+
+// NewPersistedIndexStream returns an open stream ending with ctx.
+func NewPersistedIndexStream(ctx context.Context) *PersistedIndexStream {
+	return &PersistedIndexStream{ctx: ctx, notify: make(chan struct{})}
+}
+
+// Send queues a reply for Recv. The replies sent after the stream closed
+// are dropped.
+func (s *PersistedIndexStream) Send(reply *messages.PersistedIndexReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.replies = append(s.replies, reply)
+	s.wakeLocked()
+}
+
+// CloseWithError closes the stream, Recv returns err once the queued
+// replies are consumed. A nil err closes it with io.EOF, like a shipper
+// ending the stream.
+func (s *PersistedIndexStream) CloseWithError(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+		s.wakeLocked()
+	}
+}
+
+func (s *PersistedIndexStream) wakeLocked() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// Recv implements pb.Producer_PersistedIndexClient.
+func (s *PersistedIndexStream) Recv() (*messages.PersistedIndexReply, error) {
+	for {
+		s.mu.Lock()
+		if len(s.replies) > 0 {
+			reply := s.replies[0]
+			s.replies = s.replies[1:]
+			s.mu.Unlock()
+			return reply, nil
+		}
+		if s.err != nil {
+			s.mu.Unlock()
+			return nil, s.err
+		}
+		notify := s.notify
+		s.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-s.ctx.Done():
+			return nil, status.FromContextError(s.ctx.Err()).Err()
+		}
+	}
+}
+
+// RecvMsg implements grpc.ClientStream.
+func (s *PersistedIndexStream) RecvMsg(m interface{}) error {
+	dst, ok := m.(*messages.PersistedIndexReply)
+	if !ok {
+		return status.Errorf(codes.Internal, "unexpected message type %T", m)
+	}
+	reply, err := s.Recv()
+	if err != nil {
+		return err
+	}
+	dst.Uuid, dst.PersistedIndex = reply.GetUuid(), reply.GetPersistedIndex()
+	return nil
+}
+
+// SendMsg implements grpc.ClientStream, the stream is server-side only.
+func (s *PersistedIndexStream) SendMsg(interface{}) error {
+	return errors.New("the persisted index stream doesn't send messages")
+}
+
+// Header implements grpc.ClientStream.
+func (s *PersistedIndexStream) Header() (metadata.MD, error) {
+	return metadata.MD{}, nil
+}
+
+// Trailer implements grpc.ClientStream.
+func (s *PersistedIndexStream) Trailer() metadata.MD {
+	return metadata.MD{}
+}
+
+// CloseSend implements grpc.ClientStream.
+func (s *PersistedIndexStream) CloseSend() error {
+	return nil
+}
+
+// Context implements grpc.ClientStream.
+func (s *PersistedIndexStream) Context() context.Context {
+	return s.ctx
+}
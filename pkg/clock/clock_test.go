@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func ticks(t Ticker) int {
+	n := 0
+	for {
+		select {
+		case <-t.C():
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	start := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	ticker := f.NewTicker(time.Second)
+	require.Equal(t, 1, f.Tickers())
+
+	f.Advance(500 * time.Millisecond)
+	require.Zero(t, ticks(ticker))
+
+	f.Advance(500 * time.Millisecond)
+	require.Equal(t, 1, ticks(ticker))
+	require.Equal(t, start.Add(time.Second), f.Now())
+
+	// ticks are dropped while the channel is full
+	f.Advance(5 * time.Second)
+	f.Advance(time.Second)
+	require.Equal(t, 1, ticks(ticker))
+
+	// going back in time doesn't fire
+	f.Set(start)
+	require.Zero(t, ticks(ticker))
+
+	ticker.Stop()
+	require.Zero(t, f.Tickers())
+	f.Set(start.Add(time.Hour))
+	require.Zero(t, ticks(ticker))
+}
+
+func TestFakeTickerInvalidInterval(t *testing.T) {
+	require.Panics(t, func() { NewFake(time.Now()).NewTicker(0) })
+}
+
+func TestReal(t *testing.T) {
+	before := time.Now()
+	require.False(t, Real.Now().Before(before))
+
+	ticker := Real.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	select {
+	case <-ticker.C():
+	case <-time.After(time.Second):
+		t.Fatal("no tick")
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package config reads the shipper output block of the beats configuration
+// and Elastic Agent policies into the options of the client and the
+// publisher, so all the inputs configure them the same way:
+//
+//	output.shipper:
+//	  server: "unix:///run/elastic-agent/shipper.sock"
+//	  ssl.certificate_authorities: ["/etc/pki/ca.pem"]
+//	  timeout: 30s
+//	  max_retries: 3
+//	  backoff:
+//	    init: 1s
+//	    max: 60s
+//	  bulk_max_size: 1024
+//	  flush_interval: 1s
+//	  compression: zstd
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+	"google.golang.org/grpc"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/publisher"
+)
+
+// Config is the shipper output block.
+type Config struct {
+	// Server is the address of the shipper, either host:port or a local
+	// address accepted by client.DialLocal.
+	Server string `config:"server"`
+	// TLS configures the transport security like the other beats outputs.
+	// The connection is insecure when it's not set or disabled.
+	TLS *tlscommon.Config `config:"ssl"`
+	// Timeout is the deadline of every publish, the deadline adapts to the
+	// size of the requests and the throughput when zero.
+	Timeout time.Duration `config:"timeout"`
+	// MaxRetries is client.Options.MaxRetries: zero retries until the
+	// publish is canceled, a negative value disables retries.
+	MaxRetries int `config:"max_retries"`
+	// Backoff is the wait between reconnections and retries.
+	Backoff Backoff `config:"backoff"`
+	// BulkMaxSize and BulkMaxBytes limit the number of events and the size
+	// of the published requests.
+	BulkMaxSize  int `config:"bulk_max_size"`
+	BulkMaxBytes int `config:"bulk_max_bytes"`
+	// FlushInterval publishes the pending events periodically.
+	FlushInterval time.Duration `config:"flush_interval"`
+	// Compression is the algorithm compressing the requests from
+	// CompressionMinSize bytes, like client.CompressionZstd.
+	Compression        string `config:"compression"`
+	CompressionMinSize int    `config:"compression_min_size"`
+}
+
+// Backoff is the client.BackoffConfig block.
+type Backoff struct {
+	Init time.Duration `config:"init"`
+	Max  time.Duration `config:"max"`
+}
+
+// DefaultConfig returns the defaults of the client and the batcher, without
+// a server.
+func DefaultConfig() Config {
+	backoff := client.DefaultBackoffConfig()
+	batcher := publisher.DefaultBatcherConfig()
+	return Config{
+		MaxRetries:    3,
+		Backoff:       Backoff{Init: backoff.Init, Max: backoff.Max},
+		BulkMaxSize:   batcher.MaxEvents,
+		BulkMaxBytes:  batcher.MaxBytes,
+		FlushInterval: batcher.FlushInterval,
+	}
+}
+
+// Unpack reads the block over the defaults.
+func Unpack(cfg *conf.C) (Config, error) {
+	c := DefaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return Config{}, fmt.Errorf("invalid shipper output configuration: %w", err)
+	}
+	return c, nil
+}
+
+// FromYAML reads the block from YAML.
+func FromYAML(data []byte) (Config, error) {
+	cfg, err := conf.NewConfigWithYAML(data, "shipper output")
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid shipper output configuration: %w", err)
+	}
+	return Unpack(cfg)
+}
+
+// Validate is called by Unpack.
+func (c *Config) Validate() error {
+	switch {
+	case c.Server == "":
+		return errors.New("server is required")
+	case c.Timeout < 0:
+		return fmt.Errorf("timeout %s is negative", c.Timeout)
+	case c.Backoff.Init <= 0 || c.Backoff.Max < c.Backoff.Init:
+		return fmt.Errorf("backoff.init %s must be positive and at most backoff.max %s", c.Backoff.Init, c.Backoff.Max)
+	case c.BulkMaxSize <= 0:
+		return fmt.Errorf("bulk_max_size %d must be positive", c.BulkMaxSize)
+	case c.BulkMaxBytes <= 0:
+		return fmt.Errorf("bulk_max_bytes %d must be positive", c.BulkMaxBytes)
+	case c.FlushInterval < 0:
+		return fmt.Errorf("flush_interval %s is negative", c.FlushInterval)
+	}
+	return nil
+}
+
+// local returns true for the addresses dialed with client.DialLocal.
+func (c Config) local() bool {
+	return strings.HasPrefix(c.Server, client.UnixScheme+"://") || strings.HasPrefix(c.Server, client.NpipeScheme+"://")
+}
+
+// ClientOptions returns the options of the client, loading the TLS
+// certificates.
+func (c Config) ClientOptions() (client.Options, error) {
+	opts := client.Options{
+		MaxRetries: c.MaxRetries,
+		Backoff:    client.BackoffConfig{Init: c.Backoff.Init, Max: c.Backoff.Max},
+		Compression: client.CompressionOptions{
+			Algorithm: c.Compression,
+			MinSize:   c.CompressionMinSize,
+		},
+	}
+	if c.Timeout > 0 {
+		opts.Timeout = client.FixedTimeout(c.Timeout)
+	}
+	if c.TLS != nil {
+		tlsConfig, err := tlscommon.LoadTLSConfig(c.TLS)
+		if err != nil {
+			return client.Options{}, fmt.Errorf("invalid ssl configuration: %w", err)
+		}
+		if tlsConfig != nil {
+			opts.TLS = tlsConfig.BuildModuleClientConfig(c.serverName())
+		}
+	}
+	return opts, nil
+}
+
+// serverName is the name verified against the shipper certificate, local
+// addresses are verified against "localhost" like in client.DialLocal.
+func (c Config) serverName() string {
+	if c.local() {
+		return "localhost"
+	}
+	address := c.Server
+	if i := strings.LastIndex(address, "://"); i >= 0 {
+		address = address[i+3:]
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// BatcherConfig returns the configuration of the batcher.
+func (c Config) BatcherConfig() publisher.BatcherConfig {
+	config := publisher.DefaultBatcherConfig()
+	config.MaxEvents = c.BulkMaxSize
+	config.MaxBytes = c.BulkMaxBytes
+	config.FlushInterval = c.FlushInterval
+	return config
+}
+
+// NewClient connects to the server with the options of the block, and the
+// dial options, like the ones of the auth or tracing packages.
+func (c Config) NewClient(ctx context.Context, dialOpts ...grpc.DialOption) (*client.Client, error) {
+	opts, err := c.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.DialOptions = dialOpts
+	if c.local() {
+		return client.DialLocal(ctx, c.Server, opts)
+	}
+	return client.New(ctx, c.Server, opts)
+}
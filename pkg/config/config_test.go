@@ -0,0 +1,110 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func TestFromYAML(t *testing.T) {
+	c, err := FromYAML([]byte(`
+server: "shipper.example.com:50052"
+ssl.verification_mode: none
+timeout: 30s
+max_retries: -1
+backoff:
+  init: 1s
+  max: 60s
+bulk_max_size: 50
+flush_interval: 5s
+compression: gzip
+compression_min_size: 1024
+`))
+	require.NoError(t, err)
+	require.Equal(t, "shipper.example.com:50052", c.Server)
+	require.Equal(t, Backoff{Init: time.Second, Max: time.Minute}, c.Backoff)
+
+	opts, err := c.ClientOptions()
+	require.NoError(t, err)
+	require.Equal(t, -1, opts.MaxRetries)
+	require.Equal(t, client.FixedTimeout(30*time.Second), opts.Timeout)
+	require.Equal(t, client.BackoffConfig{Init: time.Second, Max: time.Minute}, opts.Backoff)
+	require.Equal(t, client.CompressionOptions{Algorithm: client.CompressionGzip, MinSize: 1024}, opts.Compression)
+	require.NotNil(t, opts.TLS)
+	require.True(t, opts.TLS.InsecureSkipVerify)
+	require.Equal(t, "shipper.example.com", opts.TLS.ServerName)
+
+	batcher := c.BatcherConfig()
+	require.Equal(t, 50, batcher.MaxEvents)
+	require.Equal(t, 4<<20, batcher.MaxBytes)
+	require.Equal(t, 5*time.Second, batcher.FlushInterval)
+}
+
+func TestDefaults(t *testing.T) {
+	c, err := Unpack(conf.MustNewConfigFrom(map[string]interface{}{
+		"server": "unix:///run/elastic-agent/shipper.sock",
+	}))
+	require.NoError(t, err)
+	expected := DefaultConfig()
+	expected.Server = "unix:///run/elastic-agent/shipper.sock"
+	require.Equal(t, expected, c)
+
+	opts, err := c.ClientOptions()
+	require.NoError(t, err)
+	require.Nil(t, opts.Timeout)
+	require.Nil(t, opts.TLS)
+	require.Equal(t, "localhost", c.serverName())
+
+	disabled, err := FromYAML([]byte("server: localhost:50052\nssl.enabled: false"))
+	require.NoError(t, err)
+	opts, err = disabled.ClientOptions()
+	require.NoError(t, err)
+	require.Nil(t, opts.TLS)
+}
+
+func TestInvalid(t *testing.T) {
+	for name, yaml := range map[string]string{
+		"missing server":   `timeout: 1s`,
+		"negative timeout": "server: localhost:50052\ntimeout: -1s",
+		"backoff":          "server: localhost:50052\nbackoff.init: 2m",
+		"bulk_max_size":    "server: localhost:50052\nbulk_max_size: 0",
+		"not a duration":   "server: localhost:50052\nflush_interval: soon",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := FromYAML([]byte(yaml))
+			require.Error(t, err)
+		})
+	}
+
+	c, err := FromYAML([]byte("server: localhost:50052\nssl.certificate_authorities: [/does/not/exist.pem]"))
+	require.NoError(t, err)
+	_, err = c.ClientOptions()
+	require.Error(t, err)
+}
+
+func TestNewClient(t *testing.T) {
+	srv := servertest.New(servertest.Options{})
+	srv.Start()
+	defer srv.Stop()
+
+	c := DefaultConfig()
+	c.Server = servertest.Target
+	cl, err := c.NewClient(context.Background(), srv.DialOption())
+	require.NoError(t, err)
+	defer cl.Close()
+
+	_, err = cl.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.NoError(t, err)
+	require.Len(t, srv.Events(), 1)
+}
@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package fixtures provides a corpus of canonical events for the test suites
+// of the producers and shippers: logs, metrics, logs carrying trace
+// context, and edge cases like unusual unicode, deep nesting and numbers at
+// the limits of their types. The events are deterministic, the same name
+// always loads the same event:
+//
+//	e := fixtures.MustEvent("logs_nginx")
+//
+// The events are stored in testdata as JSON event documents, see
+// helpers.EventFromDocument.
+package fixtures
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+//go:embed testdata/*.json
+var corpus embed.FS
+
+// ErrUnknownFixture is returned when loading a fixture that doesn't exist.
+var ErrUnknownFixture = errors.New("unknown fixture")
+
+// Names returns the names of the fixtures, sorted.
+func Names() []string {
+	entries, _ := corpus.ReadDir("testdata")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// JSON returns the JSON document of a fixture.
+func JSON(name string) ([]byte, error) {
+	data, err := corpus.ReadFile(path.Join("testdata", name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFixture, name)
+	}
+	return data, nil
+}
+
+// Event loads a fixture, every call returns a new event the caller can
+// modify.
+func Event(name string) (*messages.Event, error) {
+	data, err := JSON(name)
+	if err != nil {
+		return nil, err
+	}
+	e, err := helpers.EventFromJSON(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", name, err)
+	}
+	return e, nil
+}
+
+// MustEvent is Event panicking on errors, for tests.
+func MustEvent(name string) *messages.Event {
+	e, err := Event(name)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Events loads all the fixtures, in the order of Names.
+func Events() []*messages.Event {
+	names := Names()
+	events := make([]*messages.Event, len(names))
+	for i, name := range names {
+		events[i] = MustEvent(name)
+	}
+	return events
+}
@@ -0,0 +1,85 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package fixtures
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestNames(t *testing.T) {
+	require.Equal(t, []string{
+		"deep_nesting",
+		"logs_multiline",
+		"logs_nginx",
+		"metrics_system",
+		"numbers",
+		"traces_in_logs",
+		"unicode",
+	}, Names())
+}
+
+func TestCorpus(t *testing.T) {
+	validator := helpers.NewValidator()
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			e, err := Event(name)
+			require.NoError(t, err)
+			require.NoError(t, validator.Validate(e))
+
+			again := MustEvent(name)
+			require.NotSame(t, e, again)
+			deterministic := proto.MarshalOptions{Deterministic: true}
+			a, err := deterministic.Marshal(e)
+			require.NoError(t, err)
+			b, err := deterministic.Marshal(again)
+			require.NoError(t, err)
+			require.Equal(t, a, b)
+		})
+	}
+	require.Len(t, Events(), len(Names()))
+}
+
+func TestEdgeCases(t *testing.T) {
+	field := func(e *messages.Event, key string) *messages.Value {
+		v, err := helpers.GetField(e.Fields, key)
+		require.NoError(t, err)
+		return v
+	}
+
+	unicode := MustEvent("unicode")
+	require.Equal(t, "é vs é", field(unicode, "combining").GetStringValue())
+	require.Equal(t, "\U0001D11E", field(unicode, "surrogate_pair").GetStringValue())
+	require.True(t, strings.Contains(field(unicode, "escapes").GetStringValue(), "\x00"))
+	require.Equal(t, "not nested", unicode.Fields.Data["keys"].GetStructValue().Data["dotted.key"].GetStringValue())
+
+	numbers := MustEvent("numbers")
+	require.Equal(t, uint64(18446744073709551615), field(numbers, "uint64_max").GetUint64Value())
+	require.Equal(t, int64(-9223372036854775808), field(numbers, "int64_min").GetInt64Value())
+	require.Equal(t, "18446744073709551616", field(numbers, "beyond_uint64").GetStringValue())
+	require.IsType(t, &messages.Value_NullValue{}, field(numbers, "null").GetKind())
+	require.IsType(t, &messages.Value_Float64Value{}, field(numbers, "negative_zero").GetKind())
+
+	nested := MustEvent("deep_nesting")
+	path := "nested" + strings.Repeat(".level", 64) + ".leaf"
+	require.Equal(t, "bottom", field(nested, path).GetStringValue())
+
+	trace := MustEvent("traces_in_logs")
+	require.Equal(t, "0af7651916cd43dd8448eb211c80319c", field(trace, "trace.id").GetStringValue())
+	require.Equal(t, 123456, trace.Timestamp.AsTime().Nanosecond())
+}
+
+func TestUnknown(t *testing.T) {
+	_, err := Event("missing")
+	require.ErrorIs(t, err, ErrUnknownFixture)
+	require.PanicsWithError(t, fmt.Sprintf("%s: missing", ErrUnknownFixture), func() { MustEvent("missing") })
+}
@@ -0,0 +1,259 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package gateway forwards events received over HTTP as JSON to the shipper,
+// for the producers that can't speak gRPC.
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Defaults of Config.
+const (
+	DefaultMaxBodySize = 10 * 1024 * 1024
+	DefaultMaxEvents   = 1000
+)
+
+// Config configures a Handler.
+type Config struct {
+	// MaxBodySize is the max size of a request body in bytes, defaults to
+	// DefaultMaxBodySize.
+	MaxBodySize int64
+	// MaxEvents is the max number of events of a request, defaults to
+	// DefaultMaxEvents.
+	MaxEvents int
+	// Timestamp parses the timestamps of the events, defaults to RFC 3339
+	// strings and milliseconds since the epoch, like
+	// helpers.EventFromDocument.
+	Timestamp *helpers.TimestampParser
+	// Clock sets the timestamp of the events without one, defaults to
+	// clock.Real.
+	Clock clock.Clock
+}
+
+// Handler is an http.Handler accepting POST requests of events and
+// publishing them in a single PublishEvents call. The body is a JSON array
+// of events, or a stream of events like newline-delimited JSON. The events
+// are the event documents of helpers.EventFromDocument, the ones without a
+// timestamp are timestamped with the clock.
+//
+// The uuid query parameter is forwarded as the uuid of the request. The
+// reply is the JSON of the PublishReply, with the uuid, accepted_count and
+// accepted_index of the shipper: the events after accepted_count were not
+// accepted and must be sent again. gRPC errors are mapped to HTTP statuses,
+// like 429 for ResourceExhausted and 503 for Unavailable.
+type Handler struct {
+	client client.Publisher
+	config Config
+}
+
+// NewHandler returns a Handler publishing through c. Zero values in config
+// are replaced by their defaults.
+func NewHandler(c client.Publisher, config Config) *Handler {
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultMaxBodySize
+	}
+	if config.MaxEvents <= 0 {
+		config.MaxEvents = DefaultMaxEvents
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+	return &Handler{client: c, config: config}
+}
+
+// reply is the JSON body of the replies.
+type reply struct {
+	UUID          string `json:"uuid,omitempty"`
+	AcceptedCount uint32 `json:"accepted_count"`
+	AcceptedIndex uint64 `json:"accepted_index"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeReply(w, http.StatusMethodNotAllowed, reply{Error: "only POST is supported"})
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/json" && mediaType != "application/x-ndjson") {
+			writeReply(w, http.StatusUnsupportedMediaType, reply{Error: fmt.Sprintf("unsupported content type %q", contentType)})
+			return
+		}
+	}
+
+	events, err := h.decode(&limitedReader{r: r.Body, n: h.config.MaxBodySize})
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errBodyTooLarge) || errors.Is(err, errTooManyEvents) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		writeReply(w, code, reply{Error: err.Error()})
+		return
+	}
+
+	res, err := h.client.Publish(r.Context(), &messages.PublishRequest{
+		Uuid:   r.URL.Query().Get("uuid"),
+		Events: events,
+	})
+	if err != nil {
+		writeReply(w, httpStatus(err), reply{Error: status.Convert(err).Message()})
+		return
+	}
+	writeReply(w, http.StatusOK, reply{
+		UUID:          res.GetUuid(),
+		AcceptedCount: res.GetAcceptedCount(),
+		AcceptedIndex: res.GetAcceptedIndex(),
+	})
+}
+
+var (
+	errTooManyEvents = errors.New("too many events")
+	errBodyTooLarge  = errors.New("request body too large")
+)
+
+// limitedReader fails with errBodyTooLarge once more than n bytes are
+// read.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// decode reads the events of the body, a JSON array or a stream of JSON
+// objects.
+func (h *Handler) decode(body io.Reader) ([]*messages.Event, error) {
+	br := bufio.NewReader(body)
+	dec := json.NewDecoder(br)
+	first, err := firstByte(br)
+	if err != nil {
+		return nil, err
+	}
+	array := first == '['
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	var events []*messages.Event
+	for dec.More() {
+		if len(events) == h.config.MaxEvents {
+			return nil, fmt.Errorf("%w: the limit is %d", errTooManyEvents, h.config.MaxEvents)
+		}
+		var doc json.RawMessage
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("event %d: %w", len(events)+1, err)
+		}
+		e, err := h.event(doc)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", len(events)+1, err)
+		}
+		events = append(events, e)
+	}
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	switch _, err := dec.Token(); {
+	case errors.Is(err, io.EOF):
+	case errors.Is(err, errBodyTooLarge):
+		return nil, err
+	default:
+		return nil, errors.New("unexpected data after the events")
+	}
+	if len(events) == 0 {
+		return nil, errors.New("no events")
+	}
+	return events, nil
+}
+
+// firstByte returns the first byte of br that is not a space, without
+// consuming it. It's 0 for an empty body.
+func firstByte(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = br.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+func (h *Handler) event(doc json.RawMessage) (*messages.Event, error) {
+	e, err := helpers.EventFromJSON(doc, h.config.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if e.Timestamp == nil {
+		e.Timestamp = timestamppb.New(h.config.Clock.Now())
+	}
+	return e, nil
+}
+
+// httpStatus returns the HTTP status of a publish error.
+func httpStatus(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Canceled:
+		// the client went away, nobody reads the status
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+func writeReply(w http.ResponseWriter, code int, r reply) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(r)
+}
@@ -0,0 +1,123 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func newTestGateway(t *testing.T, config Config) (*servertest.Server, *httptest.Server) {
+	srv := servertest.New(servertest.Options{})
+	srv.Start()
+	t.Cleanup(srv.Stop)
+
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: []grpc.DialOption{srv.DialOption()},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	gw := httptest.NewServer(NewHandler(c, config))
+	t.Cleanup(gw.Close)
+	return srv, gw
+}
+
+func post(t *testing.T, url, contentType, body string) (int, reply) {
+	res, err := http.Post(url, contentType, strings.NewReader(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	var r reply
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&r))
+	return res.StatusCode, r
+}
+
+func TestHandlerNDJSON(t *testing.T) {
+	now := time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+	srv, gw := newTestGateway(t, Config{Clock: clock.NewFake(now)})
+
+	code, r := post(t, gw.URL, "application/x-ndjson",
+		`{"timestamp": "2022-07-01T09:00:00Z", "source": {"input_id": "in"}, "fields": {"message": "a"}}`+"\n"+
+			`{"timestamp": 1656666000000, "data_stream": {"type": "logs", "dataset": "generic", "namespace": "default"}}`+"\n"+
+			`{"metadata": {"pipeline": "p"}}`+"\n")
+	require.Equal(t, http.StatusOK, code, r.Error)
+	require.Equal(t, srv.UUID(), r.UUID)
+	require.Equal(t, uint32(3), r.AcceptedCount)
+	require.Equal(t, uint64(3), r.AcceptedIndex)
+
+	events := srv.Events()
+	require.Len(t, events, 3)
+	require.Equal(t, "in", events[0].Source.InputId)
+	require.Equal(t, "a", events[0].Fields.Data["message"].GetStringValue())
+	require.True(t, now.Add(-time.Hour).Equal(events[0].Timestamp.AsTime()))
+	require.True(t, now.Add(-time.Hour).Equal(events[1].Timestamp.AsTime()))
+	require.Equal(t, "generic", events[1].DataStream.Dataset)
+	require.True(t, now.Equal(events[2].Timestamp.AsTime()), "events without timestamp get the current time")
+	require.Equal(t, "p", events[2].Metadata.Data["pipeline"].GetStringValue())
+}
+
+func TestHandlerArray(t *testing.T) {
+	srv, gw := newTestGateway(t, Config{})
+	srv.SetAcceptLimit(1)
+
+	code, r := post(t, gw.URL+"?uuid="+srv.UUID(), "application/json; charset=utf-8",
+		` [{"fields": {"n": 1}}, {"fields": {"n": 2}}] `)
+	require.Equal(t, http.StatusOK, code, r.Error)
+	require.Equal(t, uint32(1), r.AcceptedCount)
+
+	code, r = post(t, gw.URL+"?uuid=other", "", `[{}]`)
+	require.Equal(t, http.StatusOK, code)
+	require.Zero(t, r.AcceptedCount)
+}
+
+func TestHandlerErrors(t *testing.T) {
+	srv, gw := newTestGateway(t, Config{MaxEvents: 2, MaxBodySize: 64})
+
+	cases := map[string]struct {
+		contentType, body string
+		code              int
+	}{
+		"invalid JSON":       {"", `{"fields": `, http.StatusBadRequest},
+		"no events":          {"", ` `, http.StatusBadRequest},
+		"trailing data":      {"", `[{}] {}`, http.StatusBadRequest},
+		"invalid timestamp":  {"", `{"timestamp": "now"}`, http.StatusBadRequest},
+		"too many events":    {"", `{} {} {}`, http.StatusRequestEntityTooLarge},
+		"body too large":     {"", `{"fields": {"message": "` + strings.Repeat("a", 64) + `"}}`, http.StatusRequestEntityTooLarge},
+		"unsupported format": {"text/plain", `{}`, http.StatusUnsupportedMediaType},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			code, r := post(t, gw.URL, tc.contentType, tc.body)
+			require.Equal(t, tc.code, code, r.Error)
+			require.NotEmpty(t, r.Error)
+		})
+	}
+	require.Empty(t, srv.Requests())
+
+	res, err := http.Get(gw.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+
+	srv.SetPublishErrors(status.Error(codes.ResourceExhausted, "queue full"))
+	code, r := post(t, gw.URL, "", `{}`)
+	require.Equal(t, http.StatusTooManyRequests, code)
+	require.Equal(t, "queue full", r.Error)
+}
@@ -0,0 +1,200 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Converter converts many events while amortizing the allocations, like an
+// arena: it keeps the messages, maps and lists of the events it converts,
+// and Reset makes it reuse them for the next conversions, which then barely
+// allocate. Reset must be called once the events are not used anymore,
+// typically after they are published, until then the converter holds on to
+// all of them. The conversion state is reused from one event to the next.
+// It is not safe for concurrent use, each goroutine needs its own Converter.
+//
+// WithPool is ignored, the values can't be released to a pool.
+type Converter struct {
+	conv  *converter
+	arena arena
+	state convState
+}
+
+// NewConverter returns a converter using the options for every event.
+func NewConverter(opts ...Option) *Converter {
+	c := &Converter{conv: newConverter(opts)}
+	c.conv.arena = &c.arena
+	return c
+}
+
+// Convert returns an event with the given fields, the other parts of the
+// event, like the timestamp or the data stream, are left to the caller.
+func (c *Converter) Convert(fields map[string]interface{}) (*messages.Event, error) {
+	c.state = convState{depth: 1, seen: c.state.seen}
+	st, err := c.conv.newStruct(fields, &c.state)
+	if err != nil {
+		// a failed conversion doesn't leave the containers it entered
+		for id := range c.state.seen {
+			delete(c.state.seen, id)
+		}
+		return nil, err
+	}
+	e := c.arena.newEvent()
+	e.Fields = st
+	return e, nil
+}
+
+// ConvertBatch converts each map of the batch with Convert. It stops at the
+// first error, which is returned with the index of the failed map.
+func (c *Converter) ConvertBatch(batch []map[string]interface{}) ([]*messages.Event, error) {
+	events := make([]*messages.Event, len(batch))
+	for i, fields := range batch {
+		e, err := c.Convert(fields)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i, err)
+		}
+		events[i] = e
+	}
+	return events, nil
+}
+
+// Reset reuses the memory of all the events converted since the last reset,
+// which must not be used anymore. Values added to the events by the caller,
+// rather than converted, are not reused.
+func (c *Converter) Reset() {
+	c.arena.reset()
+}
+
+// arena keeps the messages it allocates, to reuse them after a reset.
+type arena struct {
+	events  slab[messages.Event]
+	values  slab[messages.Value]
+	structs slab[messages.Struct]
+	lists   slab[messages.ListValue]
+
+	stringKinds  slab[messages.Value_StringValue]
+	int64Kinds   slab[messages.Value_Int64Value]
+	float64Kinds slab[messages.Value_Float64Value]
+	boolKinds    slab[messages.Value_BoolValue]
+	structKinds  slab[messages.Value_StructValue]
+	listKinds    slab[messages.Value_ListValue]
+}
+
+func (a *arena) reset() {
+	a.events.reset()
+	a.values.reset()
+	a.structs.reset()
+	a.lists.reset()
+	a.stringKinds.reset()
+	a.int64Kinds.reset()
+	a.float64Kinds.reset()
+	a.boolKinds.reset()
+	a.structKinds.reset()
+	a.listKinds.reset()
+}
+
+// slab keeps the elements it allocated, and hands them out again in the
+// same order after a reset. A reused element holds the content it had
+// before.
+type slab[T any] struct {
+	elems []*T
+	next  int
+}
+
+func (s *slab[T]) alloc() *T {
+	if s.next == len(s.elems) {
+		s.elems = append(s.elems, new(T))
+	}
+	e := s.elems[s.next]
+	s.next++
+	return e
+}
+
+func (s *slab[T]) reset() {
+	s.next = 0
+}
+
+func (a *arena) newEvent() *messages.Event {
+	e := a.events.alloc()
+	*e = messages.Event{}
+	return e
+}
+
+func (a *arena) stringValue(s string) *messages.Value {
+	k := a.stringKinds.alloc()
+	k.StringValue = s
+	v := a.values.alloc()
+	*v = messages.Value{Kind: k}
+	return v
+}
+
+func (a *arena) int64Value(i int64) *messages.Value {
+	k := a.int64Kinds.alloc()
+	k.Int64Value = i
+	v := a.values.alloc()
+	*v = messages.Value{Kind: k}
+	return v
+}
+
+func (a *arena) float64Value(f float64) *messages.Value {
+	k := a.float64Kinds.alloc()
+	k.Float64Value = f
+	v := a.values.alloc()
+	*v = messages.Value{Kind: k}
+	return v
+}
+
+func (a *arena) boolValue(b bool) *messages.Value {
+	k := a.boolKinds.alloc()
+	k.BoolValue = b
+	v := a.values.alloc()
+	*v = messages.Value{Kind: k}
+	return v
+}
+
+func (a *arena) structValue(st *messages.Struct) *messages.Value {
+	k := a.structKinds.alloc()
+	k.StructValue = st
+	v := a.values.alloc()
+	*v = messages.Value{Kind: k}
+	return v
+}
+
+func (a *arena) listValue(l *messages.ListValue) *messages.Value {
+	k := a.listKinds.alloc()
+	k.ListValue = l
+	v := a.values.alloc()
+	*v = messages.Value{Kind: k}
+	return v
+}
+
+// newStructData reuses the map of a reused struct.
+func (a *arena) newStructData(size int) *messages.Struct {
+	st := a.structs.alloc()
+	data := st.Data
+	*st = messages.Struct{Data: data}
+	if data == nil {
+		st.Data = make(map[string]*messages.Value, size)
+	}
+	for k := range data {
+		delete(data, k)
+	}
+	return st
+}
+
+// newListValues reuses the values of a reused list when they have room for
+// size values.
+func (a *arena) newListValues(size int) *messages.ListValue {
+	l := a.lists.alloc()
+	values := l.Values[:0]
+	*l = messages.ListValue{Values: values}
+	if cap(values) < size {
+		l.Values = make([]*messages.Value, 0, size)
+	}
+	return l
+}
@@ -0,0 +1,132 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func converterTestFields(i int) map[string]interface{} {
+	return map[string]interface{}{
+		"message": fmt.Sprintf("GET /page/%d HTTP/1.1", i),
+		"host": map[string]interface{}{
+			"name": "web-1",
+			"ip":   []interface{}{"10.0.0.1", "fe80::1"},
+			"os":   map[string]interface{}{"family": "debian", "kernel": "5.15.0"},
+		},
+		"http": map[string]interface{}{
+			"request":  map[string]interface{}{"method": "GET"},
+			"response": map[string]interface{}{"status_code": 200, "bytes": int64(512 + i)},
+		},
+		"tags":     []string{"nginx", "access"},
+		"duration": 0.25,
+		"ok":       true,
+		"missing":  nil,
+		"seen":     []int{1, 2, 3},
+	}
+}
+
+func TestConverterConvertBatch(t *testing.T) {
+	c := NewConverter()
+	for round := 0; round < 3; round++ {
+		batch := make([]map[string]interface{}, 100)
+		for i := range batch {
+			batch[i] = converterTestFields(i)
+		}
+		events, err := c.ConvertBatch(batch)
+		require.NoError(t, err)
+		require.Len(t, events, len(batch))
+		for i, e := range events {
+			expected, err := NewStruct(batch[i])
+			require.NoError(t, err)
+			require.True(t, proto.Equal(expected, e.Fields), "event %d", i)
+		}
+
+		// the events don't share their lists
+		events[0].Fields.Data["host"].GetStructValue().Data["ip"].GetListValue().Values = append(
+			events[0].Fields.Data["host"].GetStructValue().Data["ip"].GetListValue().Values, NewStringValue("10.0.0.2"))
+		require.Equal(t, "10.0.0.1", events[1].Fields.Data["host"].GetStructValue().Data["ip"].GetListValue().Values[0].GetStringValue())
+		require.Len(t, events[1].Fields.Data["host"].GetStructValue().Data["ip"].GetListValue().Values, 2)
+		c.Reset()
+	}
+}
+
+func TestConverterReset(t *testing.T) {
+	c := NewConverter()
+	fields := converterTestFields(1)
+	delete(fields, "missing") // null values are not reused
+	first, err := c.Convert(fields)
+	require.NoError(t, err)
+	c.Reset()
+
+	allocs := testing.AllocsPerRun(10, func() {
+		e, err := c.Convert(fields)
+		require.NoError(t, err)
+		require.Same(t, first, e)
+		c.Reset()
+	})
+	require.Zero(t, allocs)
+}
+
+func TestConverterErrors(t *testing.T) {
+	c := NewConverter(WithMaxDepth(2))
+	_, err := c.ConvertBatch([]map[string]interface{}{
+		{"a": 1},
+		{"a": map[string]interface{}{"b": map[string]interface{}{}}},
+	})
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	require.Contains(t, err.Error(), "event 1")
+
+	// the converter is still usable after an error
+	e, err := c.Convert(map[string]interface{}{"a": "b"})
+	require.NoError(t, err)
+	require.Equal(t, "b", e.Fields.Data["a"].GetStringValue())
+
+	_, err = c.Convert(map[string]interface{}{"a": "\xff"})
+	require.Error(t, err)
+}
+
+func TestConverterLongList(t *testing.T) {
+	c := NewConverter()
+	long := make([]interface{}, 1000)
+	for i := range long {
+		long[i] = i
+	}
+	e, err := c.Convert(map[string]interface{}{"long": long})
+	require.NoError(t, err)
+	require.Len(t, e.Fields.Data["long"].GetListValue().Values, len(long))
+}
+
+func BenchmarkConverter(b *testing.B) {
+	batch := make([]map[string]interface{}, 100)
+	for i := range batch {
+		batch[i] = converterTestFields(i)
+	}
+
+	b.Run("NewStruct", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, fields := range batch {
+				if _, err := NewStruct(fields); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("ConvertBatch", func(b *testing.B) {
+		b.ReportAllocs()
+		c := NewConverter()
+		for i := 0; i < b.N; i++ {
+			if _, err := c.ConvertBatch(batch); err != nil {
+				b.Fatal(err)
+			}
+			c.Reset()
+		}
+	})
+}
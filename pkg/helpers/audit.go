@@ -0,0 +1,135 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// AccessMode is the kind of access to an Audited message.
+type AccessMode int
+
+const (
+	// AccessRead is a Read call.
+	AccessRead AccessMode = iota
+	// AccessWrite is a Write call.
+	AccessWrite
+)
+
+func (m AccessMode) String() string {
+	if m == AccessWrite {
+		return "write"
+	}
+	return "read"
+}
+
+// ConcurrentAccessError reports a write to an Audited message that overlapped
+// with another read or write.
+type ConcurrentAccessError struct {
+	// Mode is the access that detected the overlap.
+	Mode AccessMode
+	// Readers and Writers are the numbers of accesses in progress, including
+	// the one that detected the overlap.
+	Readers, Writers int32
+}
+
+func (e *ConcurrentAccessError) Error() string {
+	return fmt.Sprintf("concurrent access to a shared message: %s with %d readers and %d writers", e.Mode, e.Readers, e.Writers)
+}
+
+// AuditOption configures an Audited message.
+type AuditOption func(*auditConfig)
+
+type auditConfig struct {
+	enabled  bool
+	onAccess func(*ConcurrentAccessError)
+}
+
+// WithAudit enables the checks of an Audited message. They are always
+// enabled when building with the shipper_audit build tag.
+func WithAudit() AuditOption {
+	return func(c *auditConfig) {
+		c.enabled = true
+	}
+}
+
+// WithConcurrentAccessHandler calls fn when a concurrent access is detected,
+// instead of panicking, to log them for instance. fn is called from the
+// goroutine that detected it, while the access is in progress.
+func WithConcurrentAccessHandler(fn func(*ConcurrentAccessError)) AuditOption {
+	return func(c *auditConfig) {
+		c.onAccess = fn
+	}
+}
+
+// Audited wraps a message, like a *messages.Event or a *messages.Struct,
+// that is shared between goroutines, to catch writes that race with reads
+// or other writes. Every access goes through Read or Write, which panic,
+// or call the handler set with WithConcurrentAccessHandler, when a write
+// overlaps with another access.
+//
+// The checks are meant for tests and debugging, they only catch the overlaps
+// that actually happen. Unless WithAudit is set or the shipper_audit build
+// tag is used, they are disabled and Read and Write only call their function.
+type Audited[T any] struct {
+	msg     T
+	config  auditConfig
+	readers int32
+	writers int32
+}
+
+// NewAudited wraps msg.
+func NewAudited[T any](msg T, opts ...AuditOption) *Audited[T] {
+	a := &Audited[T]{msg: msg}
+	a.config.enabled = auditBuildTag
+	for _, opt := range opts {
+		opt(&a.config)
+	}
+	return a
+}
+
+// Read calls fn with the message, which it must not modify.
+func (a *Audited[T]) Read(fn func(T)) {
+	if !a.config.enabled {
+		fn(a.msg)
+		return
+	}
+	readers := atomic.AddInt32(&a.readers, 1)
+	defer atomic.AddInt32(&a.readers, -1)
+	if writers := atomic.LoadInt32(&a.writers); writers > 0 {
+		a.report(AccessRead, readers, writers)
+	}
+	fn(a.msg)
+}
+
+// Write calls fn with the message, which it may modify.
+func (a *Audited[T]) Write(fn func(T)) {
+	if !a.config.enabled {
+		fn(a.msg)
+		return
+	}
+	writers := atomic.AddInt32(&a.writers, 1)
+	defer atomic.AddInt32(&a.writers, -1)
+	if readers := atomic.LoadInt32(&a.readers); readers > 0 || writers > 1 {
+		a.report(AccessWrite, readers, writers)
+		fn(a.msg)
+		return
+	}
+	fn(a.msg)
+	// catch the readers that started during the write and are still running
+	if readers := atomic.LoadInt32(&a.readers); readers > 0 {
+		a.report(AccessWrite, readers, atomic.LoadInt32(&a.writers))
+	}
+}
+
+func (a *Audited[T]) report(mode AccessMode, readers, writers int32) {
+	err := &ConcurrentAccessError{Mode: mode, Readers: readers, Writers: writers}
+	if a.config.onAccess != nil {
+		a.config.onAccess(err)
+		return
+	}
+	panic(err)
+}
@@ -0,0 +1,11 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !shipper_audit
+// +build !shipper_audit
+
+package helpers
+
+// auditBuildTag enables the checks of all the Audited messages.
+const auditBuildTag = false
@@ -0,0 +1,93 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestAuditedDetectsOverlaps(t *testing.T) {
+	var mu sync.Mutex
+	var reports []*ConcurrentAccessError
+	st := NewAudited(&messages.Struct{Data: map[string]*messages.Value{}},
+		WithAudit(),
+		WithConcurrentAccessHandler(func(err *ConcurrentAccessError) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, err)
+		}))
+
+	// sequential accesses are fine
+	st.Write(func(st *messages.Struct) { st.Data["a"] = NewStringValue("a") })
+	st.Read(func(st *messages.Struct) { require.Len(t, st.Data, 1) })
+	require.Empty(t, reports)
+
+	// concurrent reads are fine
+	inRead := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		st.Read(func(*messages.Struct) {
+			close(inRead)
+			<-release
+		})
+	}()
+	<-inRead
+	st.Read(func(*messages.Struct) {})
+	require.Empty(t, reports)
+
+	// a write during the read is reported
+	st.Write(func(*messages.Struct) {})
+	close(release)
+	<-done
+	require.Len(t, reports, 1)
+	require.Equal(t, AccessWrite, reports[0].Mode)
+	require.EqualValues(t, 1, reports[0].Readers)
+
+	// and so is a read during a write
+	inWrite := make(chan struct{})
+	release = make(chan struct{})
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		st.Write(func(*messages.Struct) {
+			close(inWrite)
+			<-release
+		})
+	}()
+	<-inWrite
+	st.Read(func(*messages.Struct) {})
+	close(release)
+	<-done
+	require.Len(t, reports, 2)
+	require.Equal(t, AccessRead, reports[1].Mode)
+}
+
+func TestAuditedPanicsByDefault(t *testing.T) {
+	e := NewAudited(&messages.Event{}, WithAudit())
+	require.PanicsWithError(t, (&ConcurrentAccessError{Mode: AccessWrite, Writers: 2}).Error(), func() {
+		e.Write(func(*messages.Event) {
+			e.Write(func(*messages.Event) {})
+		})
+	})
+}
+
+func TestAuditedDisabled(t *testing.T) {
+	if auditBuildTag {
+		t.Skip("enabled by the build tag")
+	}
+	e := NewAudited(&messages.Event{})
+	require.NotPanics(t, func() {
+		e.Write(func(*messages.Event) {
+			e.Read(func(*messages.Event) {})
+		})
+	})
+}
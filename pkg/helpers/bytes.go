@@ -0,0 +1,162 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"encoding/base64"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/runtime/protoimpl"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// BytesKey is the key of the structs wrapping the byte slices converted
+// with WithBytesWrapper, like {"$binary": "aGVsbG8="}.
+const BytesKey = "$binary"
+
+// WithBytesWrapper converts byte slices to a struct holding their base64
+// form under BytesKey, instead of the base64 string alone. Unlike strings,
+// the wrapped values can be told apart from text, so AsInterfaceWithOptions
+// and WithDecodeBytes recover the original []byte. It has no effect with
+// WithUnsafeStrings or WithBytesKind.
+func WithBytesWrapper() Option {
+	return func(o *options) {
+		o.wrapBytes = true
+	}
+}
+
+// WithBytesKind converts byte slices to bytes values, see NewBytesValue,
+// instead of base64 strings. The bytes are sent as they are and converted
+// back to []byte by AsInterface, but shippers built before the bytes kind
+// was added to the protocol don't know it. It takes precedence over
+// WithBytesWrapper.
+func WithBytesKind() Option {
+	return func(o *options) {
+		o.bytesKind = true
+	}
+}
+
+// bytesValue converts a byte slice to a bytes value if enabled, to a string
+// sharing its memory if unsafe strings are enabled, or to its base64 string,
+// wrapped if enabled.
+func (c *converter) bytesValue(data []byte, s *convState) (*messages.Value, error) {
+	if c.bytesKind {
+		if err := c.addSize(s, len(data)); err != nil {
+			return nil, err
+		}
+		if c.unsafeStrings {
+			return NewBytesValue(data), nil
+		}
+		// copied, the caller may reuse its buffer
+		return NewBytesValue(append([]byte(nil), data...)), nil
+	}
+	if c.unsafeStrings {
+		if !utf8.Valid(data) {
+			return nil, protoimpl.X.NewError("invalid UTF-8 in string: %q", data)
+		}
+		if err := c.addSize(s, len(data)); err != nil {
+			return nil, err
+		}
+		return c.stringValue(UnsafeString(data)), nil
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	if err := c.addSize(s, len(encoded)); err != nil {
+		return nil, err
+	}
+	if !c.wrapBytes {
+		return c.stringValue(encoded), nil
+	}
+	if err := c.addKey(s, BytesKey); err != nil {
+		return nil, err
+	}
+	st := c.newStructData(1)
+	st.Data[BytesKey] = c.stringValue(encoded)
+	return c.structValue(st), nil
+}
+
+// unwrapBytes returns the bytes of a struct created by WithBytesWrapper.
+func unwrapBytes(st *messages.Struct) ([]byte, bool) {
+	if len(st.GetData()) != 1 {
+		return nil, false
+	}
+	encoded, ok := st.GetData()[BytesKey].GetKind().(*messages.Value_StringValue)
+	if !ok {
+		return nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded.StringValue)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// InterfaceOption configures the conversion done by AsInterfaceWithOptions
+// and AsMapWithOptions.
+type InterfaceOption func(*interfaceOptions)
+
+type interfaceOptions struct {
+	decodeBytes bool
+	// unsafeBytes converts the strings to byte slices, see WithUnsafeBytes
+	unsafeBytes bool
+}
+
+// WithDecodeBytes converts the structs created by WithBytesWrapper back to
+// []byte. Structs with BytesKey whose value isn't valid base64 are
+// converted to maps as usual.
+func WithDecodeBytes() InterfaceOption {
+	return func(o *interfaceOptions) {
+		o.decodeBytes = true
+	}
+}
+
+// AsInterfaceWithOptions converts x like AsInterface, using the given options.
+func AsInterfaceWithOptions(x *messages.Value, opts ...InterfaceOption) interface{} {
+	var o interfaceOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.asInterface(x)
+}
+
+// AsMapWithOptions converts x like AsMap, using the given options.
+func AsMapWithOptions(x *messages.Struct, opts ...InterfaceOption) map[string]interface{} {
+	var o interfaceOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.asMap(x)
+}
+
+func (o *interfaceOptions) asInterface(x *messages.Value) interface{} {
+	switch v := x.GetKind().(type) {
+	case *messages.Value_StringValue:
+		if o.unsafeBytes {
+			return UnsafeBytes(v.StringValue)
+		}
+	case *messages.Value_StructValue:
+		if o.decodeBytes {
+			if data, ok := unwrapBytes(v.StructValue); ok {
+				return data
+			}
+		}
+		return o.asMap(v.StructValue)
+	case *messages.Value_ListValue:
+		vs := make([]interface{}, len(v.ListValue.GetValues()))
+		for i, v := range v.ListValue.GetValues() {
+			vs[i] = o.asInterface(v)
+		}
+		return vs
+	}
+	return AsInterface(x)
+}
+
+func (o *interfaceOptions) asMap(x *messages.Struct) map[string]interface{} {
+	vs := make(map[string]interface{}, len(x.GetData()))
+	for k, v := range x.GetData() {
+		vs[k] = o.asInterface(v)
+	}
+	return vs
+}
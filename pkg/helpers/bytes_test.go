@@ -0,0 +1,95 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestBytesWrapperRoundTrip(t *testing.T) {
+	in := map[string]interface{}{
+		"payload": []byte{0, 1, 0xff},
+		"text":    "aGVsbG8=",
+		"list":    []interface{}{[]byte("a"), "b"},
+		"empty":   []byte{},
+	}
+	st, err := NewStructWithOptions(in, WithBytesWrapper())
+	require.NoError(t, err)
+	require.Equal(t, "AAH/", st.Data["payload"].GetStructValue().GetData()[BytesKey].GetStringValue())
+
+	out := AsMapWithOptions(st, WithDecodeBytes())
+	require.Equal(t, in, out)
+
+	// without the option the wrappers are plain maps
+	require.Equal(t, map[string]interface{}{BytesKey: "AAH/"}, AsMap(st)["payload"])
+}
+
+func TestDecodeBytesInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		data map[string]*messages.Value
+	}{
+		{name: "not base64", data: map[string]*messages.Value{BytesKey: NewStringValue("%%%")}},
+		{name: "not a string", data: map[string]*messages.Value{BytesKey: NewInt64Value(1)}},
+		{name: "other keys", data: map[string]*messages.Value{BytesKey: NewStringValue("AA=="), "b": NewNullValue()}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewStructValue(&messages.Struct{Data: tc.data})
+			require.Equal(t, AsInterface(v), AsInterfaceWithOptions(v, WithDecodeBytes()))
+		})
+	}
+}
+
+func TestAsTypedBytes(t *testing.T) {
+	wrapped, err := NewValueWithOptions([]byte("hello"), WithBytesWrapper())
+	require.NoError(t, err)
+	plain, err := NewValue([]byte("hello"))
+	require.NoError(t, err)
+
+	for _, v := range []*messages.Value{wrapped, plain} {
+		data, err := AsTyped[[]byte](v)
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), data)
+	}
+
+	_, err = AsTyped[[]byte](NewStringValue("not base64!"))
+	require.ErrorIs(t, err, ErrConversion)
+}
+
+func TestBytesKind(t *testing.T) {
+	buf := []byte{0, 1, 0xff}
+	in := map[string]interface{}{
+		"payload": buf,
+		"list":    []interface{}{[]byte("a"), "b"},
+	}
+	st, err := NewStructWithOptions(in, WithBytesKind(), WithBytesWrapper())
+	require.NoError(t, err)
+	require.Equal(t, buf, st.Data["payload"].GetBytesValue())
+
+	// the input buffer is copied
+	buf[0] = 42
+	require.Equal(t, []byte{0, 1, 0xff}, AsMap(st)["payload"])
+
+	data, err := proto.Marshal(st)
+	require.NoError(t, err)
+	var decoded messages.Struct
+	require.NoError(t, proto.Unmarshal(data, &decoded))
+	require.True(t, StructEqual(st, &decoded))
+
+	out, err := StructToJSON(st)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"payload":"AAH/","list":["YQ==","b"]}`, string(out))
+	require.Equal(t, `{"list":["YQ==","b"],"payload":"AAH/"}`, string(CanonicalJSON(st)))
+
+	typed, err := AsTyped[[]byte](st.Data["payload"])
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 1, 0xff}, typed)
+}
@@ -0,0 +1,118 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"encoding/base64"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.elastic.co/fastjson"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// CanonicalJSON encodes st as JSON in a canonical form: structs that hold
+// the same numbers, strings and timestamps give byte-identical output, which
+// makes it suitable for hashing and golden files. Unlike StructToJSON:
+//   - keys are sorted by their bytes, without whitespace,
+//   - numbers are normalized, so an Int32Value 1, an Int64Value 1 and a
+//     Float64Value 1.0 are the same, floats use their shortest form and
+//     float32 values the shortest form that round trips to float32,
+//   - timestamps are RFC3339 strings in UTC and bytes base64 strings.
+//
+// NaN and infinite values are encoded as strings, like StructToJSON does.
+func CanonicalJSON(st *messages.Struct) []byte {
+	var w fastjson.Writer
+	writeCanonicalStruct(&w, st)
+	return w.Bytes()
+}
+
+// CanonicalValueJSON is CanonicalJSON for a single value, nil is null.
+func CanonicalValueJSON(v *messages.Value) []byte {
+	var w fastjson.Writer
+	writeCanonicalValue(&w, v)
+	return w.Bytes()
+}
+
+func writeCanonicalStruct(w *fastjson.Writer, st *messages.Struct) {
+	data := st.GetData()
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.RawByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			w.RawByte(',')
+		}
+		w.String(k)
+		w.RawByte(':')
+		writeCanonicalValue(w, data[k])
+	}
+	w.RawByte('}')
+}
+
+func writeCanonicalValue(w *fastjson.Writer, v *messages.Value) {
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_Float64Value:
+		writeCanonicalFloat(w, kind.Float64Value, 64)
+	case *messages.Value_Float32Value:
+		writeCanonicalFloat(w, float64(kind.Float32Value), 32)
+	case *messages.Value_Int32Value:
+		w.Int64(int64(kind.Int32Value))
+	case *messages.Value_Int64Value:
+		w.Int64(kind.Int64Value)
+	case *messages.Value_Uint32Value:
+		w.Uint64(uint64(kind.Uint32Value))
+	case *messages.Value_Uint64Value:
+		w.Uint64(kind.Uint64Value)
+	case *messages.Value_StringValue:
+		w.String(kind.StringValue)
+	case *messages.Value_BoolValue:
+		w.Bool(kind.BoolValue)
+	case *messages.Value_TimestampValue:
+		w.String(kind.TimestampValue.AsTime().UTC().Format(time.RFC3339Nano))
+	case *messages.Value_BytesValue:
+		w.String(base64.StdEncoding.EncodeToString(kind.BytesValue))
+	case *messages.Value_StructValue:
+		writeCanonicalStruct(w, kind.StructValue)
+	case *messages.Value_ListValue:
+		w.RawByte('[')
+		for i, item := range kind.ListValue.GetValues() {
+			if i > 0 {
+				w.RawByte(',')
+			}
+			writeCanonicalValue(w, item)
+		}
+		w.RawByte(']')
+	default:
+		w.RawString("null")
+	}
+}
+
+// maxExactFloat is the largest integer up to which all the integers are
+// exactly represented by a float64.
+const maxExactFloat = 1 << 53
+
+func writeCanonicalFloat(w *fastjson.Writer, f float64, bitSize int) {
+	switch {
+	case math.IsNaN(f):
+		w.RawString(`"NaN"`)
+	case math.IsInf(f, 1):
+		w.RawString(`"Infinity"`)
+	case math.IsInf(f, -1):
+		w.RawString(`"-Infinity"`)
+	case f == math.Trunc(f) && math.Abs(f) <= maxExactFloat:
+		// same as the integer kinds, this also turns -0 into 0
+		w.Int64(int64(f))
+	default:
+		w.RawString(strconv.FormatFloat(f, 'g', -1, bitSize))
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	st, err := NewStruct(map[string]interface{}{
+		"z":      "last",
+		"a":      []interface{}{1, "two", nil, true},
+		"nested": map[string]interface{}{"y": 2.5, "x": int32(1), "é": "\"quoted\"\n"},
+		"time":   time.Date(2022, 8, 1, 14, 30, 0, 500, time.FixedZone("CEST", 2*3600)),
+	})
+	require.NoError(t, err)
+
+	expected := `{"a":[1,"two",null,true],"nested":{"x":1,"y":2.5,"é":"\"quoted\"\n"},"time":"2022-08-01T12:30:00.0000005Z","z":"last"}`
+	for i := 0; i < 20; i++ {
+		// map iteration order changes on every run
+		require.Equal(t, expected, string(CanonicalJSON(st)))
+	}
+	require.True(t, json.Valid(CanonicalJSON(st)))
+	require.Equal(t, "{}", string(CanonicalJSON(nil)))
+}
+
+func TestCanonicalValueJSON(t *testing.T) {
+	cases := []struct {
+		name   string
+		values []*messages.Value
+		exp    string
+	}{
+		{
+			name:   "integral numbers",
+			values: []*messages.Value{NewInt32Value(1), NewInt64Value(1), NewUint32Value(1), NewUint64Value(1), NewFloat32Value(1), NewFloat64Value(1)},
+			exp:    "1",
+		},
+		{name: "negative zero", values: []*messages.Value{NewFloat64Value(math.Copysign(0, -1)), NewInt64Value(0)}, exp: "0"},
+		{name: "float32", values: []*messages.Value{NewFloat32Value(0.1), NewFloat64Value(0.1)}, exp: "0.1"},
+		{name: "large float", values: []*messages.Value{NewFloat64Value(1e21)}, exp: "1e+21"},
+		{name: "max uint64", values: []*messages.Value{NewUint64Value(math.MaxUint64)}, exp: "18446744073709551615"},
+		{name: "NaN", values: []*messages.Value{NewFloat64Value(math.NaN()), NewFloat32Value(float32(math.NaN()))}, exp: `"NaN"`},
+		{name: "infinity", values: []*messages.Value{NewFloat64Value(math.Inf(-1))}, exp: `"-Infinity"`},
+		{name: "null", values: []*messages.Value{nil, NewNullValue(), {}}, exp: "null"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, v := range tc.values {
+				require.Equal(t, tc.exp, string(CanonicalValueJSON(v)), "%v", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// the options are constant and valid, building the modes can't fail
+var (
+	cborEnc, _ = cbor.EncOptions{
+		Time:    cbor.TimeRFC3339Nano,
+		TimeTag: cbor.EncTagRequired,
+	}.EncMode()
+	cborDec, _ = cbor.DecOptions{
+		DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+		TimeTag:        cbor.DecTagOptional,
+	}.DecMode()
+)
+
+// StructToCBOR encodes the Struct as a CBOR map.
+// Timestamps are encoded as tagged RFC3339 date/time strings.
+func StructToCBOR(st *messages.Struct) ([]byte, error) {
+	data, err := cborEnc.Marshal(AsMap(st))
+	if err != nil {
+		return nil, fmt.Errorf("error encoding CBOR: %w", err)
+	}
+	return data, nil
+}
+
+// StructFromCBOR decodes a CBOR map with string keys into a Struct.
+// Tagged date/times are decoded as timestamps, byte strings as base64
+// strings and the values are converted using NewValue.
+func StructFromCBOR(data []byte) (*messages.Struct, error) {
+	var m map[string]interface{}
+	if err := cborDec.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error decoding CBOR: %w", err)
+	}
+	return NewStruct(m)
+}
@@ -0,0 +1,72 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCBORRoundTrip(t *testing.T) {
+	ts := time.Date(2022, 8, 4, 18, 17, 28, 123000000, time.UTC)
+	st, err := NewStruct(map[string]interface{}{
+		"message":    "hello",
+		"count":      int64(-3),
+		"size":       int32(3),
+		"max_uint64": uint64(math.MaxUint64),
+		"ratio":      0.5,
+		"ok":         true,
+		"missing":    nil,
+		"@timestamp": ts,
+		"tags":       []string{"a", "b"},
+		"host":       map[string]interface{}{"name": "web-1"},
+	})
+	require.NoError(t, err)
+
+	data, err := StructToCBOR(st)
+	require.NoError(t, err)
+	decoded, err := StructFromCBOR(data)
+	require.NoError(t, err)
+
+	// CBOR doesn't keep the width and sign of positive integers
+	require.Equal(t, map[string]interface{}{
+		"message":    "hello",
+		"count":      int64(-3),
+		"size":       uint64(3),
+		"max_uint64": uint64(math.MaxUint64),
+		"ratio":      0.5,
+		"ok":         true,
+		"missing":    nil,
+		"@timestamp": ts,
+		"tags":       []interface{}{"a", "b"},
+		"host":       map[string]interface{}{"name": "web-1"},
+	}, AsMap(decoded))
+}
+
+func TestStructFromCBORErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+	}{
+		{name: "not a map", in: []string{"a"}},
+		{name: "non-string keys", in: map[int]string{1: "a"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := cbor.Marshal(c.in)
+			require.NoError(t, err)
+			_, err = StructFromCBOR(data)
+			require.Error(t, err)
+		})
+	}
+
+	_, err := StructFromCBOR([]byte{0xff})
+	require.Error(t, err)
+}
@@ -0,0 +1,113 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// The clone functions deep copy the messages like proto.Clone, without its
+// generic reflection: the copies share no structs, lists, timestamps or
+// byte slices with the originals, so an event can be fanned out to several
+// outputs that modify it. Unknown fields are not copied. Cloning nil
+// returns nil.
+
+// CloneValue returns a deep copy of v.
+func CloneValue(v *messages.Value) *messages.Value {
+	if v == nil {
+		return nil
+	}
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_NullValue:
+		return &messages.Value{Kind: &messages.Value_NullValue{NullValue: kind.NullValue}}
+	case *messages.Value_Float64Value:
+		return &messages.Value{Kind: &messages.Value_Float64Value{Float64Value: kind.Float64Value}}
+	case *messages.Value_Float32Value:
+		return &messages.Value{Kind: &messages.Value_Float32Value{Float32Value: kind.Float32Value}}
+	case *messages.Value_Int32Value:
+		return &messages.Value{Kind: &messages.Value_Int32Value{Int32Value: kind.Int32Value}}
+	case *messages.Value_Int64Value:
+		return &messages.Value{Kind: &messages.Value_Int64Value{Int64Value: kind.Int64Value}}
+	case *messages.Value_Uint32Value:
+		return &messages.Value{Kind: &messages.Value_Uint32Value{Uint32Value: kind.Uint32Value}}
+	case *messages.Value_Uint64Value:
+		return &messages.Value{Kind: &messages.Value_Uint64Value{Uint64Value: kind.Uint64Value}}
+	case *messages.Value_StringValue:
+		return &messages.Value{Kind: &messages.Value_StringValue{StringValue: kind.StringValue}}
+	case *messages.Value_BoolValue:
+		return &messages.Value{Kind: &messages.Value_BoolValue{BoolValue: kind.BoolValue}}
+	case *messages.Value_StructValue:
+		return &messages.Value{Kind: &messages.Value_StructValue{StructValue: CloneStruct(kind.StructValue)}}
+	case *messages.Value_ListValue:
+		return &messages.Value{Kind: &messages.Value_ListValue{ListValue: CloneList(kind.ListValue)}}
+	case *messages.Value_TimestampValue:
+		return &messages.Value{Kind: &messages.Value_TimestampValue{TimestampValue: cloneTimestamp(kind.TimestampValue)}}
+	case *messages.Value_BytesValue:
+		return &messages.Value{Kind: &messages.Value_BytesValue{BytesValue: append([]byte(nil), kind.BytesValue...)}}
+	}
+	return &messages.Value{}
+}
+
+// CloneStruct returns a deep copy of st.
+func CloneStruct(st *messages.Struct) *messages.Struct {
+	if st == nil {
+		return nil
+	}
+	out := &messages.Struct{}
+	if st.Data != nil {
+		out.Data = make(map[string]*messages.Value, len(st.Data))
+		for k, v := range st.Data {
+			out.Data[k] = CloneValue(v)
+		}
+	}
+	return out
+}
+
+// CloneList returns a deep copy of list.
+func CloneList(list *messages.ListValue) *messages.ListValue {
+	if list == nil {
+		return nil
+	}
+	out := &messages.ListValue{}
+	if list.Values != nil {
+		out.Values = make([]*messages.Value, len(list.Values))
+		for i, v := range list.Values {
+			out.Values[i] = CloneValue(v)
+		}
+	}
+	return out
+}
+
+// CloneEvent returns a deep copy of e.
+func CloneEvent(e *messages.Event) *messages.Event {
+	if e == nil {
+		return nil
+	}
+	out := &messages.Event{
+		Timestamp: cloneTimestamp(e.Timestamp),
+		Metadata:  CloneStruct(e.Metadata),
+		Fields:    CloneStruct(e.Fields),
+	}
+	if e.Source != nil {
+		out.Source = &messages.Source{InputId: e.Source.InputId, StreamId: e.Source.StreamId}
+	}
+	if e.DataStream != nil {
+		out.DataStream = &messages.DataStream{
+			Type:      e.DataStream.Type,
+			Dataset:   e.DataStream.Dataset,
+			Namespace: e.DataStream.Namespace,
+		}
+	}
+	return out
+}
+
+func cloneTimestamp(ts *timestamppb.Timestamp) *timestamppb.Timestamp {
+	if ts == nil {
+		return nil
+	}
+	return &timestamppb.Timestamp{Seconds: ts.Seconds, Nanos: ts.Nanos}
+}
@@ -0,0 +1,76 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func cloneTestEvent(t testing.TB) *messages.Event {
+	e, err := NewEventBuilder().
+		SetTimestamp(time.Date(2022, 8, 4, 18, 17, 28, 0, time.UTC)).
+		SetSource("input-1", "stream-1").
+		SetDataStream("logs", "nginx.access", "default").
+		AddField("message", "GET /index.html HTTP/1.1 200 512").
+		AddField("host", map[string]interface{}{"name": "web-1", "ip": []string{"10.0.0.1", "10.0.0.2"}}).
+		AddField("http", map[string]interface{}{"response": map[string]interface{}{"status_code": 200, "bytes": int64(512)}}).
+		AddField("ratio", float32(0.5)).
+		AddField("ok", true).
+		AddField("missing", nil).
+		AddField("seen", time.Unix(1, 2)).
+		AddMetadata("pipeline", "nginx").
+		Build()
+	require.NoError(t, err)
+	e.Fields.Data["payload"] = NewBytesValue([]byte{0, 1})
+	return e
+}
+
+func TestCloneEvent(t *testing.T) {
+	e := cloneTestEvent(t)
+	c := CloneEvent(e)
+	require.True(t, proto.Equal(e, c))
+
+	// modifying the copy leaves the original untouched
+	c.Source.InputId = "input-2"
+	c.Timestamp.Seconds++
+	c.Fields.Data["host"].GetStructValue().Data["name"] = NewStringValue("web-2")
+	c.Fields.Data["host"].GetStructValue().Data["ip"].GetListValue().Values[0] = NewStringValue("10.0.0.3")
+	c.Fields.Data["seen"].GetTimestampValue().Nanos++
+	c.Fields.Data["payload"].GetBytesValue()[0] = 42
+	c.Metadata.Data["pipeline"] = NewStringValue("other")
+	require.True(t, proto.Equal(cloneTestEvent(t), e))
+
+	require.Nil(t, CloneEvent(nil))
+	require.Nil(t, CloneStruct(nil))
+	require.Nil(t, CloneList(nil))
+	require.Nil(t, CloneValue(nil))
+	require.True(t, proto.Equal(&messages.Value{}, CloneValue(&messages.Value{})))
+	require.True(t, proto.Equal(&messages.Event{}, CloneEvent(&messages.Event{})))
+}
+
+var cloneResult *messages.Event
+
+func BenchmarkCloneEvent(b *testing.B) {
+	e := cloneTestEvent(b)
+
+	b.Run("CloneEvent", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			cloneResult = CloneEvent(e)
+		}
+	})
+	b.Run("proto.Clone", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			cloneResult = proto.Clone(e).(*messages.Event)
+		}
+	})
+}
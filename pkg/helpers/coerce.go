@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// CoerceToString converts the scalar values to a string, unlike AsTyped
+// which only accepts strings: numbers and booleans are formatted like
+// strconv, times in RFC 3339 and bytes in base64. Null values, structs and
+// lists fail with a ConversionError.
+func CoerceToString(x *messages.Value) (string, error) {
+	switch v := x.GetKind().(type) {
+	case *messages.Value_StringValue:
+		return v.StringValue, nil
+	case *messages.Value_BoolValue:
+		return strconv.FormatBool(v.BoolValue), nil
+	case *messages.Value_Int32Value:
+		return strconv.FormatInt(int64(v.Int32Value), 10), nil
+	case *messages.Value_Int64Value:
+		return strconv.FormatInt(v.Int64Value, 10), nil
+	case *messages.Value_Uint32Value:
+		return strconv.FormatUint(uint64(v.Uint32Value), 10), nil
+	case *messages.Value_Uint64Value:
+		return strconv.FormatUint(v.Uint64Value, 10), nil
+	case *messages.Value_Float32Value:
+		return strconv.FormatFloat(float64(v.Float32Value), 'f', -1, 32), nil
+	case *messages.Value_Float64Value:
+		return strconv.FormatFloat(v.Float64Value, 'f', -1, 64), nil
+	case *messages.Value_TimestampValue:
+		return v.TimestampValue.AsTime().Format(time.RFC3339Nano), nil
+	case *messages.Value_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue), nil
+	}
+	return "", conversionError[string](x, "")
+}
+
+// CoerceToFloat converts numbers, numeric strings, surrounding spaces
+// ignored, and booleans, as 0 or 1, to a float64. Other values, and strings
+// that are not finite numbers, fail with a ConversionError.
+func CoerceToFloat(x *messages.Value) (float64, error) {
+	if f, ok := asFloat(x); ok {
+		return f, nil
+	}
+	switch v := x.GetKind().(type) {
+	case *messages.Value_BoolValue:
+		if v.BoolValue {
+			return 1, nil
+		}
+		return 0, nil
+	case *messages.Value_StringValue:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.StringValue), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return 0, conversionError[float64](x, "not a number")
+		}
+		return f, nil
+	}
+	return 0, conversionError[float64](x, "")
+}
+
+// CoerceToTime converts timestamps, RFC 3339 strings, and numbers or
+// numeric strings of milliseconds since the Unix epoch to a time. Other
+// values fail with a ConversionError.
+func CoerceToTime(x *messages.Value) (time.Time, error) {
+	switch v := x.GetKind().(type) {
+	case *messages.Value_TimestampValue:
+		return v.TimestampValue.AsTime(), nil
+	case *messages.Value_StringValue:
+		s := strings.TrimSpace(v.StringValue)
+		if ts, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return ts, nil
+		}
+		millis, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, conversionError[time.Time](x, "not an RFC 3339 time or epoch milliseconds")
+		}
+		return epochMillis(x, millis)
+	}
+	if millis, ok := asFloat(x); ok {
+		return epochMillis(x, millis)
+	}
+	return time.Time{}, conversionError[time.Time](x, "")
+}
+
+func epochMillis(x *messages.Value, millis float64) (time.Time, error) {
+	if math.IsNaN(millis) {
+		return time.Time{}, conversionError[time.Time](x, "not a number")
+	}
+	ts, ok := epochTime(millis, 0, time.Millisecond)
+	if !ok {
+		return time.Time{}, conversionError[time.Time](x, "out of range")
+	}
+	return ts, nil
+}
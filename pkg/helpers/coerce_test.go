@@ -0,0 +1,78 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestCoerceToString(t *testing.T) {
+	ts := time.Date(2022, 5, 1, 12, 30, 0, 500, time.UTC)
+	cases := map[string]*messages.Value{
+		"text":                         NewStringValue("text"),
+		"true":                         NewBoolValue(true),
+		"-3":                           NewInt32Value(-3),
+		"18446744073709551615":         NewUint64Value(1<<64 - 1),
+		"0.1":                          NewFloat32Value(0.1),
+		"1.5":                          NewFloat64Value(1.5),
+		"2022-05-01T12:30:00.0000005Z": NewTimestampValue(ts),
+		"aGk=":                         NewBytesValue([]byte("hi")),
+	}
+	for want, v := range cases {
+		s, err := CoerceToString(v)
+		require.NoError(t, err, want)
+		require.Equal(t, want, s)
+	}
+	for _, v := range []*messages.Value{NewNullValue(), NewStructValue(&messages.Struct{}), nil} {
+		_, err := CoerceToString(v)
+		var convErr *ConversionError
+		require.ErrorAs(t, err, &convErr)
+		require.Equal(t, "string", convErr.Type)
+	}
+}
+
+func TestCoerceToFloat(t *testing.T) {
+	for want, v := range map[float64]*messages.Value{
+		42:   NewInt64Value(42),
+		1.25: NewStringValue(" 1.25 "),
+		-3e2: NewStringValue("-3e2"),
+		1:    NewBoolValue(true),
+	} {
+		f, err := CoerceToFloat(v)
+		require.NoError(t, err)
+		require.Equal(t, want, f)
+	}
+	for _, v := range []*messages.Value{NewStringValue("12ms"), NewStringValue("NaN"), NewStringValue("Inf"), NewNullValue()} {
+		_, err := CoerceToFloat(v)
+		require.ErrorIs(t, err, ErrConversion)
+	}
+}
+
+func TestCoerceToTime(t *testing.T) {
+	want := time.Date(2022, 5, 1, 12, 30, 0, 250_000_000, time.UTC)
+	for _, v := range []*messages.Value{
+		NewTimestampValue(want),
+		NewStringValue("2022-05-01T14:30:00.25+02:00"),
+		NewStringValue("1651408200250"),
+		NewInt64Value(1651408200250),
+		NewFloat64Value(1651408200250),
+		NewFloat64Value(1651408200249.9999),
+	} {
+		ts, err := CoerceToTime(v)
+		require.NoError(t, err, v)
+		require.WithinDuration(t, want, ts, time.Microsecond, v)
+	}
+	for _, v := range []*messages.Value{NewStringValue("yesterday"), NewFloat64Value(1e300), NewBoolValue(true)} {
+		_, err := CoerceToTime(v)
+		var convErr *ConversionError
+		require.ErrorAs(t, err, &convErr)
+		require.Equal(t, "time.Time", convErr.Type)
+	}
+}
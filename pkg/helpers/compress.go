@@ -0,0 +1,182 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// CompressedKey is the metadata key listing the dotted paths of the fields
+// compressed by CompressFields.
+const CompressedKey = "compressed_fields"
+
+// ErrInvalidCompressed is returned for compressed fields that can't be
+// decoded.
+var ErrInvalidCompressed = errors.New("invalid compressed field")
+
+// CompressFields replaces the strings of the event fields longer than
+// threshold bytes, like stack traces or raw payloads, by their gzip
+// compression encoded in base64, and lists their paths in the metadata of
+// the event. fields are the dotted paths of the compressed strings, empty
+// compresses all the strings outside of lists. Strings that wouldn't be
+// shorter are left as they are. It returns the paths of the compressed
+// fields, in order.
+func CompressFields(e *messages.Event, threshold int, fields ...string) ([]string, error) {
+	marked := compressedFields(e)
+	var compressed []string
+	compress := func(key string, v *messages.Value) error {
+		s, ok := v.GetKind().(*messages.Value_StringValue)
+		if !ok || len(s.StringValue) <= threshold {
+			return nil
+		}
+		if _, done := marked[key]; done {
+			return nil
+		}
+		encoded, err := compressString(s.StringValue)
+		if err != nil {
+			return fmt.Errorf("failed to compress %s: %w", key, err)
+		}
+		if len(encoded) >= len(s.StringValue) {
+			return nil
+		}
+		s.StringValue = encoded
+		compressed = append(compressed, key)
+		return nil
+	}
+
+	if len(fields) == 0 {
+		err := WalkStruct(e.GetFields(), func(path []string, v *messages.Value) error {
+			if _, isList := v.GetKind().(*messages.Value_ListValue); isList {
+				return ErrSkipChildren
+			}
+			return compress(strings.Join(path, "."), v)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range fields {
+		v, err := GetField(e.GetFields(), key)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := compress(key, v); err != nil {
+			return nil, err
+		}
+	}
+	if len(compressed) > 0 {
+		sort.Strings(compressed)
+		markCompressed(e, compressed)
+	}
+	return compressed, nil
+}
+
+// DecompressedString returns the string of the event field at the dotted
+// path key, decompressed if CompressFields compressed it.
+func DecompressedString(e *messages.Event, key string) (string, error) {
+	v, err := GetField(e.GetFields(), key)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := compressedFields(e)[key]; !ok {
+		return v.GetStringValue(), nil
+	}
+	return decompressString(key, v.GetStringValue())
+}
+
+// DecompressFields restores the fields compressed by CompressFields and
+// removes their list from the metadata.
+func DecompressFields(e *messages.Event) error {
+	marked := compressedFields(e)
+	keys := make([]string, 0, len(marked))
+	for key := range marked {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v, err := GetField(e.GetFields(), key)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s, err := decompressString(key, v.GetStringValue())
+		if err != nil {
+			return err
+		}
+		v.Kind = &messages.Value_StringValue{StringValue: s}
+	}
+	delete(e.GetMetadata().GetData(), CompressedKey)
+	return nil
+}
+
+// compressedFields returns the set of the paths listed under CompressedKey.
+func compressedFields(e *messages.Event) map[string]struct{} {
+	list := e.GetMetadata().GetData()[CompressedKey].GetListValue().GetValues()
+	marked := make(map[string]struct{}, len(list))
+	for _, v := range list {
+		marked[v.GetStringValue()] = struct{}{}
+	}
+	return marked
+}
+
+// markCompressed adds keys to the list under CompressedKey.
+func markCompressed(e *messages.Event, keys []string) {
+	if e.Metadata == nil {
+		e.Metadata = &messages.Struct{}
+	}
+	if e.Metadata.Data == nil {
+		e.Metadata.Data = map[string]*messages.Value{}
+	}
+	list := e.Metadata.Data[CompressedKey].GetListValue()
+	if list == nil {
+		list = &messages.ListValue{}
+		e.Metadata.Data[CompressedKey] = NewListValue(list)
+	}
+	for _, key := range keys {
+		list.Values = append(list.Values, NewStringValue(key))
+	}
+}
+
+func compressString(s string) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, s); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decompressString(key, s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidCompressed, key, err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidCompressed, key, err)
+	}
+	var out strings.Builder
+	if _, err := io.Copy(&out, r); err != nil { //nolint:gosec // the producer is trusted
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidCompressed, key, err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,59 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestCompressFields(t *testing.T) {
+	trace := strings.Repeat("at com.example.Main.run(Main.java:42)\n", 100)
+	fields, err := NewStruct(map[string]interface{}{
+		"message": "short",
+		"error":   map[string]interface{}{"stack_trace": trace},
+		"tags":    []interface{}{trace},
+		"random":  "Zx9qL2mB7vR4tY1w",
+	})
+	require.NoError(t, err)
+	e := &messages.Event{Fields: fields}
+
+	compressed, err := CompressFields(e, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"error.stack_trace"}, compressed, "lists and incompressible strings are skipped")
+	v, err := GetField(e.Fields, "error.stack_trace")
+	require.NoError(t, err)
+	require.Less(t, len(v.GetStringValue()), len(trace))
+
+	s, err := DecompressedString(e, "error.stack_trace")
+	require.NoError(t, err)
+	require.Equal(t, trace, s)
+	s, err = DecompressedString(e, "message")
+	require.NoError(t, err)
+	require.Equal(t, "short", s)
+
+	// compressed fields are compressed once
+	compressed, err = CompressFields(e, 10, "error.stack_trace", "missing")
+	require.NoError(t, err)
+	require.Empty(t, compressed)
+
+	require.NoError(t, DecompressFields(e))
+	require.Equal(t, trace, AsMap(e.Fields)["error"].(map[string]interface{})["stack_trace"])
+	require.NotContains(t, e.Metadata.Data, CompressedKey)
+}
+
+func TestDecompressedStringInvalid(t *testing.T) {
+	e := &messages.Event{Fields: &messages.Struct{Data: map[string]*messages.Value{
+		"payload": NewStringValue("not gzip"),
+	}}}
+	markCompressed(e, []string{"payload"})
+	_, err := DecompressedString(e, "payload")
+	require.ErrorIs(t, err, ErrInvalidCompressed)
+	require.ErrorIs(t, DecompressFields(e), ErrInvalidCompressed)
+}
@@ -0,0 +1,80 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// TypeConverter converts a value of the type it's registered for. Returning
+// a nil Value and error falls back to the built-in conversion. It must return
+// a new Value every time: a Value shared by several fields would be released
+// more than once by a ValuePool, and then handed out twice.
+type TypeConverter func(v interface{}) (*messages.Value, error)
+
+// ConverterRegistry maps Go types to the converters used for their values,
+// see WithConverters. It must not be modified once in use.
+type ConverterRegistry struct {
+	converters map[reflect.Type]TypeConverter
+}
+
+// NewConverterRegistry returns an empty registry.
+func NewConverterRegistry() *ConverterRegistry {
+	return &ConverterRegistry{converters: map[reflect.Type]TypeConverter{}}
+}
+
+// Register makes fn convert the values of the same type as sample. The type
+// must match exactly: registering decimal.Decimal doesn't apply to
+// *decimal.Decimal.
+func (r *ConverterRegistry) Register(sample interface{}, fn TypeConverter) {
+	r.converters[reflect.TypeOf(sample)] = fn
+}
+
+// WithConverters consults the registry before any built-in conversion,
+// including for the values nested in maps, slices and structs.
+func WithConverters(r *ConverterRegistry) Option {
+	return func(o *options) {
+		o.converters = r
+	}
+}
+
+// WithTypeConverter adds fn for the type of sample to the converters set by
+// the previous options, without modifying a registry set by WithConverters.
+func WithTypeConverter(sample interface{}, fn TypeConverter) Option {
+	return func(o *options) {
+		r := NewConverterRegistry()
+		if o.converters != nil {
+			for t, fn := range o.converters.converters {
+				r.converters[t] = fn
+			}
+		}
+		r.Register(sample, fn)
+		o.converters = r
+	}
+}
+
+// convertRegistered returns a nil Value when there's no converter for the
+// type of v, or when the converter falls back to the built-in conversion.
+func (c *converter) convertRegistered(v interface{}, s *convState) (*messages.Value, error) {
+	fn, ok := c.converters.converters[reflect.TypeOf(v)]
+	if !ok {
+		return nil, nil
+	}
+	value, err := fn(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert value of type %T: %w", v, err)
+	}
+	if value != nil && c.maxSize > 0 {
+		if err := c.addSize(s, proto.Size(value)); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
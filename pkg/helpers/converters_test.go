@@ -0,0 +1,81 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+type celsius float64
+
+func TestConverterRegistry(t *testing.T) {
+	r := NewConverterRegistry()
+	r.Register(net.IP{}, func(v interface{}) (*messages.Value, error) {
+		ip := v.(net.IP)
+		if ip.To4() == nil {
+			// keep the default text form
+			return nil, nil
+		}
+		return NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+			"ip":     NewStringValue(ip.String()),
+			"family": NewStringValue("ipv4"),
+		}}), nil
+	})
+	r.Register(celsius(0), func(v interface{}) (*messages.Value, error) {
+		if v.(celsius) < -273.15 {
+			return nil, errors.New("below absolute zero")
+		}
+		return NewFloat64Value(float64(v.(celsius))), nil
+	})
+
+	type reading struct {
+		Host  net.IP
+		Temp  celsius
+		Peers []net.IP
+	}
+	v, err := NewValueWithOptions(reading{
+		Host:  net.ParseIP("10.0.0.1"),
+		Temp:  21.5,
+		Peers: []net.IP{net.ParseIP("::1")},
+	}, WithConverters(r))
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"Host":  map[string]interface{}{"ip": "10.0.0.1", "family": "ipv4"},
+		"Temp":  21.5,
+		"Peers": []interface{}{"::1"},
+	}, AsInterface(v))
+
+	_, err = NewValueWithOptions(map[string]interface{}{"temp": celsius(-300)}, WithConverters(r))
+	require.ErrorContains(t, err, "below absolute zero")
+
+	_, err = NewValueWithOptions(celsius(21.5))
+	require.Error(t, err, "custom converters are only used when registered")
+
+	_, err = NewValueWithOptions(celsius(21.5), WithConverters(r), WithMaxSize(4))
+	var limitErr *LimitError
+	require.ErrorAs(t, err, &limitErr)
+}
+
+func TestWithTypeConverter(t *testing.T) {
+	r := NewConverterRegistry()
+	r.Register(celsius(0), func(v interface{}) (*messages.Value, error) {
+		return NewFloat64Value(float64(v.(celsius))), nil
+	})
+	toString := func(v interface{}) (*messages.Value, error) {
+		return NewStringValue(v.(net.IP).String()), nil
+	}
+
+	v, err := NewValueWithOptions([]interface{}{celsius(1), net.IPv4(10, 0, 0, 1)},
+		WithConverters(r), WithTypeConverter(net.IP{}, toString))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{1.0, "10.0.0.1"}, AsInterface(v))
+	require.Len(t, r.converters, 1, "the registry must not be modified")
+}
@@ -0,0 +1,118 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrInvalidDataStream is returned for data stream names Elasticsearch
+// would reject.
+var ErrInvalidDataStream = errors.New("invalid data stream")
+
+// Limits of the data stream naming scheme of Elasticsearch, in bytes.
+const (
+	MaxDatasetLength        = 100
+	MaxNamespaceLength      = 100
+	MaxDataStreamNameLength = 255
+)
+
+// dataStreamForbidden are the characters Elasticsearch rejects in index
+// names, plus the dash separating the parts of the data stream name.
+const dataStreamForbidden = `\/*?"<>| ,#:-`
+
+// DataStream is the data stream events are routed to, named
+// "{type}-{dataset}-{namespace}" in Elasticsearch, like
+// "logs-nginx.access-default".
+type DataStream struct {
+	// Type is the generic type of the data, like "logs" or "metrics".
+	Type string
+	// Dataset describes the data and its structure, like "nginx.access".
+	Dataset string
+	// Namespace is a user-defined grouping, like "default" or "production".
+	Namespace string
+}
+
+// ParseDataStream parses and validates the name of a data stream.
+func ParseDataStream(name string) (DataStream, error) {
+	parts := strings.Split(name, "-")
+	if len(parts) != 3 {
+		return DataStream{}, fmt.Errorf("%w: %q is not {type}-{dataset}-{namespace}", ErrInvalidDataStream, name)
+	}
+	ds := DataStream{Type: parts[0], Dataset: parts[1], Namespace: parts[2]}
+	return ds, ds.Validate()
+}
+
+// DataStreamFromEvent returns the data stream of the event, which is not
+// validated.
+func DataStreamFromEvent(e *messages.Event) DataStream {
+	ds := e.GetDataStream()
+	return DataStream{Type: ds.GetType(), Dataset: ds.GetDataset(), Namespace: ds.GetNamespace()}
+}
+
+// String returns the name of the data stream in Elasticsearch.
+func (d DataStream) String() string {
+	return d.Type + "-" + d.Dataset + "-" + d.Namespace
+}
+
+// Validate checks the naming constraints of Elasticsearch: all the parts are
+// required, lowercase, without dashes or the characters forbidden in index
+// names, and can't start with "_", "+" or ".". The dataset and namespace are
+// limited to 100 bytes, and the whole name to 255.
+func (d DataStream) Validate() error {
+	for _, part := range []struct{ name, value string }{
+		{"type", d.Type},
+		{"dataset", d.Dataset},
+		{"namespace", d.Namespace},
+	} {
+		if err := validateDataStreamPart(part.value); err != nil {
+			return fmt.Errorf("%w: %s %q %s", ErrInvalidDataStream, part.name, part.value, err)
+		}
+	}
+	if len(d.Dataset) > MaxDatasetLength {
+		return fmt.Errorf("%w: dataset is longer than %d bytes", ErrInvalidDataStream, MaxDatasetLength)
+	}
+	if len(d.Namespace) > MaxNamespaceLength {
+		return fmt.Errorf("%w: namespace is longer than %d bytes", ErrInvalidDataStream, MaxNamespaceLength)
+	}
+	if len(d.String()) > MaxDataStreamNameLength {
+		return fmt.Errorf("%w: name is longer than %d bytes", ErrInvalidDataStream, MaxDataStreamNameLength)
+	}
+	return nil
+}
+
+// validateDataStreamPart returns the reason why s is invalid as an error
+// message completing "{part} {value}".
+func validateDataStreamPart(s string) error {
+	switch {
+	case s == "":
+		return errors.New("is empty")
+	case strings.ContainsAny(s[:1], "_+."):
+		return fmt.Errorf("starts with %q", s[:1])
+	case strings.ContainsAny(s, dataStreamForbidden):
+		return fmt.Errorf("contains one of %q", dataStreamForbidden)
+	case strings.ToLower(s) != s:
+		return errors.New("is not lowercase")
+	}
+	return nil
+}
+
+// Proto returns the data stream of the events.
+func (d DataStream) Proto() *messages.DataStream {
+	return &messages.DataStream{Type: d.Type, Dataset: d.Dataset, Namespace: d.Namespace}
+}
+
+// Apply validates the data stream and routes the event to it.
+func (d DataStream) Apply(e *messages.Event) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	e.DataStream = d.Proto()
+	return nil
+}
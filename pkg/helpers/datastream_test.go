@@ -0,0 +1,58 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestParseDataStream(t *testing.T) {
+	ds, err := ParseDataStream("logs-nginx.access-default")
+	require.NoError(t, err)
+	require.Equal(t, DataStream{Type: "logs", Dataset: "nginx.access", Namespace: "default"}, ds)
+	require.Equal(t, "logs-nginx.access-default", ds.String())
+
+	for _, name := range []string{"logs-nginx", "logs-nginx-access-default", "logs--default"} {
+		_, err := ParseDataStream(name)
+		require.ErrorIs(t, err, ErrInvalidDataStream, name)
+	}
+}
+
+func TestDataStreamValidate(t *testing.T) {
+	valid := DataStream{Type: "metrics", Dataset: "system.cpu", Namespace: "production"}
+	require.NoError(t, valid.Validate())
+
+	cases := map[string]DataStream{
+		"empty type":         {Dataset: "generic", Namespace: "default"},
+		"uppercase dataset":  {Type: "logs", Dataset: "Nginx", Namespace: "default"},
+		"dash in namespace":  {Type: "logs", Dataset: "generic", Namespace: "my-team"},
+		"space in dataset":   {Type: "logs", Dataset: "my app", Namespace: "default"},
+		"forbidden char":     {Type: "logs", Dataset: "a*b", Namespace: "default"},
+		"leading underscore": {Type: "logs", Dataset: "_internal", Namespace: "default"},
+		"long dataset":       {Type: "logs", Dataset: strings.Repeat("a", MaxDatasetLength+1), Namespace: "default"},
+		"long namespace":     {Type: "logs", Dataset: "generic", Namespace: strings.Repeat("a", MaxNamespaceLength+1)},
+		"long name":          {Type: strings.Repeat("a", 60), Dataset: strings.Repeat("b", 100), Namespace: strings.Repeat("c", 100)},
+	}
+	for name, ds := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.ErrorIs(t, ds.Validate(), ErrInvalidDataStream)
+			require.ErrorIs(t, ds.Apply(&messages.Event{}), ErrInvalidDataStream)
+		})
+	}
+}
+
+func TestDataStreamApply(t *testing.T) {
+	e := &messages.Event{}
+	ds := DataStream{Type: "logs", Dataset: "nginx.access", Namespace: "default"}
+	require.NoError(t, ds.Apply(e))
+	require.Equal(t, "nginx.access", e.DataStream.Dataset)
+	require.Equal(t, ds, DataStreamFromEvent(e))
+	require.Equal(t, DataStream{}, DataStreamFromEvent(&messages.Event{}))
+}
@@ -0,0 +1,164 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// DiffKind is the kind of change of a FieldDiff.
+type DiffKind int
+
+const (
+	// DiffAdded is a field only set in the second event.
+	DiffAdded DiffKind = iota
+	// DiffRemoved is a field only set in the first event.
+	DiffRemoved
+	// DiffChanged is a field set in both events with different values.
+	DiffChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	}
+	return "DiffKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// FieldDiff is the difference of a single field between two events.
+type FieldDiff struct {
+	// Path is the dotted path of the field in the event, like the paths
+	// of ValidationError: "fields.http.status_code" or "fields.tags[1]".
+	Path string
+	Kind DiffKind
+	// Old is nil for added fields, New is nil for removed ones.
+	Old *messages.Value
+	New *messages.Value
+}
+
+func (d FieldDiff) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("+ %s: %v", d.Path, AsInterface(d.New))
+	case DiffRemoved:
+		return fmt.Sprintf("- %s: %v", d.Path, AsInterface(d.Old))
+	}
+	return fmt.Sprintf("~ %s: %v -> %v", d.Path, AsInterface(d.Old), AsInterface(d.New))
+}
+
+// DiffEvents returns the fields that differ between a and b, sorted by
+// path. Nested structs are compared field by field and lists item by item,
+// other values are compared with Equal and the given options. An added or
+// removed struct or list is reported as a single field. With
+// WithIgnoreListOrder, lists are reported as a whole. Unset source and data
+// stream fields are the same as empty ones.
+func DiffEvents(a, b *messages.Event, opts ...EqualOption) []FieldDiff {
+	d := &differ{options: newEqualOptions(opts)}
+	d.value("timestamp", timestampValue(a), timestampValue(b))
+	d.value("source.input_id", stringField(a.GetSource().GetInputId()), stringField(b.GetSource().GetInputId()))
+	d.value("source.stream_id", stringField(a.GetSource().GetStreamId()), stringField(b.GetSource().GetStreamId()))
+	d.value("data_stream.type", stringField(a.GetDataStream().GetType()), stringField(b.GetDataStream().GetType()))
+	d.value("data_stream.dataset", stringField(a.GetDataStream().GetDataset()), stringField(b.GetDataStream().GetDataset()))
+	d.value("data_stream.namespace", stringField(a.GetDataStream().GetNamespace()), stringField(b.GetDataStream().GetNamespace()))
+	d.structs("metadata.", a.GetMetadata(), b.GetMetadata())
+	d.structs("fields.", a.GetFields(), b.GetFields())
+	return d.sorted()
+}
+
+// DiffStructs is like DiffEvents for two structs, the paths are relative to
+// the structs.
+func DiffStructs(a, b *messages.Struct, opts ...EqualOption) []FieldDiff {
+	d := &differ{options: newEqualOptions(opts)}
+	d.structs("", a, b)
+	return d.sorted()
+}
+
+func timestampValue(e *messages.Event) *messages.Value {
+	if e.GetTimestamp() == nil {
+		return nil
+	}
+	return &messages.Value{Kind: &messages.Value_TimestampValue{TimestampValue: e.GetTimestamp()}}
+}
+
+func stringField(s string) *messages.Value {
+	if s == "" {
+		return nil
+	}
+	return NewStringValue(s)
+}
+
+type differ struct {
+	options *equalOptions
+	diffs   []FieldDiff
+}
+
+func (d *differ) sorted() []FieldDiff {
+	sort.SliceStable(d.diffs, func(i, j int) bool {
+		return d.diffs[i].Path < d.diffs[j].Path
+	})
+	return d.diffs
+}
+
+// value compares the values at path, nil values are not set.
+func (d *differ) value(path string, a, b *messages.Value) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		d.diffs = append(d.diffs, FieldDiff{Path: path, Kind: DiffAdded, New: b})
+		return
+	case b == nil:
+		d.diffs = append(d.diffs, FieldDiff{Path: path, Kind: DiffRemoved, Old: a})
+		return
+	}
+
+	aStruct, aIsStruct := a.GetKind().(*messages.Value_StructValue)
+	bStruct, bIsStruct := b.GetKind().(*messages.Value_StructValue)
+	if aIsStruct && bIsStruct {
+		d.structs(path+".", aStruct.StructValue, bStruct.StructValue)
+		return
+	}
+	aList, aIsList := a.GetKind().(*messages.Value_ListValue)
+	bList, bIsList := b.GetKind().(*messages.Value_ListValue)
+	if aIsList && bIsList && !d.options.ignoreListOrder {
+		aValues, bValues := aList.ListValue.GetValues(), bList.ListValue.GetValues()
+		for i := 0; i < len(aValues) || i < len(bValues); i++ {
+			var aItem, bItem *messages.Value
+			if i < len(aValues) {
+				aItem = aValues[i]
+			}
+			if i < len(bValues) {
+				bItem = bValues[i]
+			}
+			d.value(path+"["+strconv.Itoa(i)+"]", aItem, bItem)
+		}
+		return
+	}
+	if !d.options.equal(a, b) {
+		d.diffs = append(d.diffs, FieldDiff{Path: path, Kind: DiffChanged, Old: a, New: b})
+	}
+}
+
+// structs compares the fields of two structs, prefix ends with a dot unless
+// it's empty.
+func (d *differ) structs(prefix string, a, b *messages.Struct) {
+	for k, av := range a.GetData() {
+		d.value(prefix+k, av, b.GetData()[k])
+	}
+	for k, bv := range b.GetData() {
+		if _, ok := a.GetData()[k]; !ok {
+			d.value(prefix+k, nil, bv)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func diffStrings(diffs []FieldDiff) []string {
+	out := make([]string, len(diffs))
+	for i, d := range diffs {
+		out[i] = d.String()
+	}
+	return out
+}
+
+func TestDiffEvents(t *testing.T) {
+	now := time.Date(2022, 8, 1, 12, 30, 0, 0, time.UTC)
+	newEvent := func(fields map[string]interface{}) *messages.Event {
+		st, err := NewStruct(fields)
+		require.NoError(t, err)
+		return &messages.Event{
+			Timestamp:  timestamppb.New(now),
+			Source:     &messages.Source{InputId: "input"},
+			DataStream: &messages.DataStream{Type: "logs", Dataset: "generic", Namespace: "default"},
+			Fields:     st,
+		}
+	}
+
+	a := newEvent(map[string]interface{}{
+		"message": "hello",
+		"host":    map[string]interface{}{"name": "web-1", "ip": "10.0.0.1"},
+		"tags":    []interface{}{"a", "b", "c"},
+		"count":   1,
+	})
+	require.Empty(t, DiffEvents(a, a))
+
+	b := newEvent(map[string]interface{}{
+		"message": "hello",
+		"host":    map[string]interface{}{"name": "web-2", "os": "linux"},
+		"tags":    []interface{}{"a", "x"},
+		"count":   "1",
+	})
+	b.Source.StreamId = "stream"
+	b.DataStream.Namespace = "prod"
+	b.Timestamp = timestamppb.New(now.Add(time.Millisecond))
+
+	require.Equal(t, []string{
+		"~ data_stream.namespace: default -> prod",
+		"~ fields.count: 1 -> 1",
+		"- fields.host.ip: 10.0.0.1",
+		"~ fields.host.name: web-1 -> web-2",
+		"+ fields.host.os: linux",
+		"~ fields.tags[1]: b -> x",
+		"- fields.tags[2]: c",
+		"+ source.stream_id: stream",
+		"~ timestamp: 2022-08-01 12:30:00 +0000 UTC -> 2022-08-01 12:30:00.001 +0000 UTC",
+	}, diffStrings(DiffEvents(a, b)))
+
+	diffs := DiffEvents(a, b, WithTimestampTolerance(time.Second), WithIgnoreListOrder())
+	require.Len(t, diffs, 7)
+	for _, d := range diffs {
+		require.NotEqual(t, "timestamp", d.Path)
+	}
+	require.Contains(t, diffs, FieldDiff{
+		Path: "fields.tags",
+		Kind: DiffChanged,
+		Old:  a.Fields.Data["tags"],
+		New:  b.Fields.Data["tags"],
+	})
+
+	require.Equal(t, []string{
+		"+ data_stream.dataset: generic",
+		"+ data_stream.namespace: default",
+		"+ data_stream.type: logs",
+		"+ fields.count: 1",
+		"+ fields.host: map[ip:10.0.0.1 name:web-1]",
+		"+ fields.message: hello",
+		"+ fields.tags: [a b c]",
+		"+ source.input_id: input",
+		"+ timestamp: 2022-08-01 12:30:00 +0000 UTC",
+	}, diffStrings(DiffEvents(nil, a)))
+}
+
+func TestDiffStructs(t *testing.T) {
+	a, err := NewStruct(map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": true}})
+	require.NoError(t, err)
+	b, err := NewStruct(map[string]interface{}{"a": 1, "b": "flat"})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"~ b: map[c:true] -> flat"}, diffStrings(DiffStructs(a, b)))
+	require.Empty(t, DiffStructs(nil, &messages.Struct{}))
+	require.Equal(t, "changed", DiffChanged.String())
+}
@@ -0,0 +1,136 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// documentTimestamps parses the timestamps of the event documents when no
+// parser is given.
+var documentTimestamps = NewTimestampParser(TimestampParserConfig{
+	Layouts: []string{time.RFC3339Nano, LayoutUnixMs},
+})
+
+// EventFromDocument converts an event document into an event. The
+// documents are the JSON or YAML form of the events read by the gateway,
+// the shipperctl convert command and the fixtures:
+//
+//	{
+//	  "timestamp": "2022-07-01T10:00:00Z",
+//	  "source": {"input_id": "...", "stream_id": "..."},
+//	  "data_stream": {"type": "logs", "dataset": "generic", "namespace": "default"},
+//	  "fields": {"message": "hello"},
+//	  "metadata": {}
+//	}
+//
+// The timestamp is parsed with timestamps, nil parses RFC 3339 strings and
+// milliseconds since the epoch. The missing or null parts are left unset,
+// the unknown keys are an error. The fields and metadata are shared with
+// doc.
+func EventFromDocument(doc *messages.Struct, timestamps *TimestampParser) (*messages.Event, error) {
+	if timestamps == nil {
+		timestamps = documentTimestamps
+	}
+	e := &messages.Event{}
+	for key, v := range doc.GetData() {
+		if _, null := v.GetKind().(*messages.Value_NullValue); null {
+			continue
+		}
+		switch key {
+		case "timestamp":
+			ts, err := timestamps.ParseValue(v)
+			if err != nil {
+				return nil, err
+			}
+			e.Timestamp = timestamppb.New(ts)
+		case "source":
+			st, err := documentObject(key, v)
+			if err != nil {
+				return nil, err
+			}
+			e.Source = &messages.Source{
+				InputId:  st.Data["input_id"].GetStringValue(),
+				StreamId: st.Data["stream_id"].GetStringValue(),
+			}
+		case "data_stream":
+			st, err := documentObject(key, v)
+			if err != nil {
+				return nil, err
+			}
+			e.DataStream = &messages.DataStream{
+				Type:      st.Data["type"].GetStringValue(),
+				Dataset:   st.Data["dataset"].GetStringValue(),
+				Namespace: st.Data["namespace"].GetStringValue(),
+			}
+		case "fields", "metadata":
+			st, err := documentObject(key, v)
+			if err != nil {
+				return nil, err
+			}
+			if key == "fields" {
+				e.Fields = st
+			} else {
+				e.Metadata = st
+			}
+		default:
+			return nil, fmt.Errorf("unknown event key %q", key)
+		}
+	}
+	return e, nil
+}
+
+func documentObject(key string, v *messages.Value) (*messages.Struct, error) {
+	st := v.GetStructValue()
+	if st == nil {
+		return nil, fmt.Errorf("%s is not an object", key)
+	}
+	return st, nil
+}
+
+// EventFromJSON decodes a JSON event document, see EventFromDocument.
+func EventFromJSON(data []byte, timestamps *TimestampParser) (*messages.Event, error) {
+	doc, err := StructFromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return EventFromDocument(doc, timestamps)
+}
+
+// EventToDocument converts an event into an event document, see
+// EventFromDocument. The unset parts are left out, the fields and metadata
+// are shared with e.
+func EventToDocument(e *messages.Event) *messages.Struct {
+	data := map[string]*messages.Value{}
+	if e.Timestamp != nil {
+		data["timestamp"] = NewTimestampValue(e.Timestamp.AsTime())
+	}
+	if e.Source != nil {
+		source := map[string]*messages.Value{"input_id": NewStringValue(e.Source.InputId)}
+		if e.Source.StreamId != "" {
+			source["stream_id"] = NewStringValue(e.Source.StreamId)
+		}
+		data["source"] = NewStructValue(&messages.Struct{Data: source})
+	}
+	if e.DataStream != nil {
+		data["data_stream"] = NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+			"type":      NewStringValue(e.DataStream.Type),
+			"dataset":   NewStringValue(e.DataStream.Dataset),
+			"namespace": NewStringValue(e.DataStream.Namespace),
+		}})
+	}
+	if e.Fields != nil {
+		data["fields"] = NewStructValue(e.Fields)
+	}
+	if e.Metadata != nil {
+		data["metadata"] = NewStructValue(e.Metadata)
+	}
+	return &messages.Struct{Data: data}
+}
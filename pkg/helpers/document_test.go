@@ -0,0 +1,60 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestEventFromJSON(t *testing.T) {
+	ts := time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+	for _, timestamp := range []string{`"2022-07-01T10:00:00Z"`, `1656669600000`} {
+		e, err := EventFromJSON([]byte(`{
+			"timestamp": `+timestamp+`,
+			"source": {"input_id": "filestream", "stream_id": "app.log"},
+			"data_stream": {"type": "logs", "dataset": "generic", "namespace": "default"},
+			"fields": {"message": "hello"},
+			"metadata": null
+		}`), nil)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(&messages.Event{
+			Timestamp:  NewTimestampValue(ts).GetTimestampValue(),
+			Source:     &messages.Source{InputId: "filestream", StreamId: "app.log"},
+			DataStream: &messages.DataStream{Type: "logs", Dataset: "generic", Namespace: "default"},
+			Fields:     &messages.Struct{Data: map[string]*messages.Value{"message": NewStringValue("hello")}},
+		}, e), "%s: %v", timestamp, e)
+
+		// back to the same document, without the null metadata
+		again, err := EventFromDocument(EventToDocument(e), nil)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(e, again))
+	}
+
+	e, err := EventFromJSON([]byte(`{"fields": {}}`), nil)
+	require.NoError(t, err)
+	require.Nil(t, e.Timestamp)
+	require.Nil(t, e.Source)
+
+	parser := NewTimestampParser(TimestampParserConfig{Layouts: []string{time.RFC3339Nano}})
+	_, err = EventFromJSON([]byte(`{"timestamp": 1656669600000}`), parser)
+	require.ErrorIs(t, err, ErrInvalidTimestamp)
+
+	for _, doc := range []string{
+		`{"message": "hello"}`,
+		`{"fields": "hello"}`,
+		`{"source": "filestream"}`,
+		`{"timestamp": "yesterday"}`,
+		`[]`,
+	} {
+		_, err := EventFromJSON([]byte(doc), nil)
+		require.Error(t, err, doc)
+	}
+}
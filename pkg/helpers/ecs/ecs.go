@@ -0,0 +1,152 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package ecs sets event fields following the Elastic Common Schema.
+//
+// The setters nest the fields as ECS expects, host.os.name ends up in the
+// "os" struct of the "host" struct, and validate them against the field
+// definitions of the bundled ECS Version.
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrInvalidField is returned for values that don't match their ECS definition.
+var ErrInvalidField = errors.New("invalid ECS field")
+
+type field struct {
+	name  string
+	value *messages.Value
+}
+
+// fieldSet collects the non-empty fields of a setter.
+type fieldSet []field
+
+func (s *fieldSet) str(name, v string) {
+	if v != "" {
+		*s = append(*s, field{name, helpers.NewStringValue(v)})
+	}
+}
+
+func (s *fieldSet) strs(name string, v []string) {
+	if len(v) == 0 {
+		return
+	}
+	values := make([]*messages.Value, len(v))
+	for i, s := range v {
+		values[i] = helpers.NewStringValue(s)
+	}
+	*s = append(*s, field{name, helpers.NewListValue(&messages.ListValue{Values: values})})
+}
+
+func (s *fieldSet) long(name string, v int64) {
+	if v != 0 {
+		*s = append(*s, field{name, helpers.NewInt64Value(v)})
+	}
+}
+
+// set validates fs and writes it into fields, nothing is written if a field
+// is invalid or can't be written.
+func set(fields *messages.Struct, fs fieldSet) error {
+	if fields == nil {
+		return errors.New("fields can't be nil")
+	}
+	for _, f := range fs {
+		t, ok := Lookup(f.name)
+		if !ok {
+			return fmt.Errorf("%w: %s is not defined in ECS %s", ErrInvalidField, f.name, Version)
+		}
+		if err := checkType(f.name, t, f.value); err != nil {
+			return err
+		}
+		if err := checkParents(fields, f.name); err != nil {
+			return err
+		}
+	}
+	for _, f := range fs {
+		if _, err := helpers.PutField(fields, f.name, f.value); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidField, err)
+		}
+	}
+	return nil
+}
+
+// checkParents checks that the existing parents of the dotted path name
+// are structs, PutField can't write through another value.
+func checkParents(fields *messages.Struct, name string) error {
+	keys := strings.Split(name, ".")
+	st := fields
+	for i, k := range keys[:len(keys)-1] {
+		v, ok := st.GetData()[k]
+		if !ok {
+			// created by PutField
+			return nil
+		}
+		if st = v.GetStructValue(); st == nil {
+			return fmt.Errorf("%w: can't set %s, %s is not an object", ErrInvalidField, name, strings.Join(keys[:i+1], "."))
+		}
+	}
+	return nil
+}
+
+// checkType checks that v, or every value of a list, matches the ECS type.
+func checkType(name string, t Type, v *messages.Value) error {
+	if list, ok := v.GetKind().(*messages.Value_ListValue); ok {
+		for _, item := range list.ListValue.GetValues() {
+			if err := checkType(name, t, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	valid := false
+	switch t {
+	case Keyword:
+		_, valid = v.GetKind().(*messages.Value_StringValue)
+	case IP:
+		s, ok := v.GetKind().(*messages.Value_StringValue)
+		valid = ok && net.ParseIP(s.StringValue) != nil
+	case Long:
+		switch v.GetKind().(type) {
+		case *messages.Value_Int32Value, *messages.Value_Int64Value, *messages.Value_Uint32Value, *messages.Value_Uint64Value:
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("%w: %s must be a %s, got %v", ErrInvalidField, name, t, helpers.AsInterface(v))
+	}
+	return nil
+}
+
+// Validate checks that the ECS fields of fields have the expected types.
+// Fields not bundled with this package are ignored.
+func Validate(fields *messages.Struct) error {
+	return validate("", fields)
+}
+
+func validate(prefix string, st *messages.Struct) error {
+	for key, v := range st.GetData() {
+		name := prefix + key
+		if t, ok := Lookup(name); ok {
+			if err := checkType(name, t, v); err != nil {
+				return err
+			}
+			continue
+		}
+		if child := v.GetStructValue(); child != nil {
+			if err := validate(name+".", child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
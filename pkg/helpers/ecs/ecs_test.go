@@ -0,0 +1,130 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package ecs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestSetters(t *testing.T) {
+	fields := &messages.Struct{}
+	require.NoError(t, SetHost(fields, Host{
+		Name: "web-1",
+		IP:   []string{"10.0.0.1", "fe80::1"},
+		OS:   OS{Name: "Ubuntu", Version: "22.04"},
+	}))
+	require.NoError(t, SetAgent(fields, Agent{Type: "filebeat", Version: "8.4.0"}))
+	require.NoError(t, SetLog(fields, Log{Level: "info", OriginFileLine: 42}))
+	require.NoError(t, SetNetwork(fields, Network{Transport: "tcp", Bytes: 1024}))
+	require.NoError(t, SetService(fields, Service{Name: "nginx", NodeName: "node-1"}))
+
+	require.Equal(t, map[string]interface{}{
+		"host": map[string]interface{}{
+			"name": "web-1",
+			"ip":   []interface{}{"10.0.0.1", "fe80::1"},
+			"os":   map[string]interface{}{"name": "Ubuntu", "version": "22.04"},
+		},
+		"agent": map[string]interface{}{"type": "filebeat", "version": "8.4.0"},
+		"log": map[string]interface{}{
+			"level":  "info",
+			"origin": map[string]interface{}{"file": map[string]interface{}{"line": int64(42)}},
+		},
+		"network": map[string]interface{}{"transport": "tcp", "bytes": int64(1024)},
+		"service": map[string]interface{}{"name": "nginx", "node": map[string]interface{}{"name": "node-1"}},
+	}, helpers.AsMap(fields))
+	require.NoError(t, Validate(fields))
+}
+
+func TestSettersErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		fields map[string]interface{}
+		set    func(*messages.Struct) error
+	}{
+		{
+			name: "invalid ip",
+			set:  func(st *messages.Struct) error { return SetHost(st, Host{IP: []string{"localhost"}}) },
+		},
+		{
+			name:   "parent is not an object",
+			fields: map[string]interface{}{"host": "web-1"},
+			set:    func(st *messages.Struct) error { return SetHost(st, Host{Name: "web-1"}) },
+		},
+		{
+			name:   "nested parent is not an object",
+			fields: map[string]interface{}{"host": map[string]interface{}{"os": "linux"}},
+			set: func(st *messages.Struct) error {
+				return SetHost(st, Host{Name: "web-1", OS: OS{Name: "Ubuntu"}})
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fields, err := helpers.NewStruct(c.fields)
+			require.NoError(t, err)
+			require.ErrorIs(t, c.set(fields), ErrInvalidField)
+			// nothing is written when validation fails
+			require.Equal(t, c.fields, nilIfEmpty(helpers.AsMap(fields)))
+		})
+	}
+}
+
+func nilIfEmpty(m map[string]interface{}) map[string]interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		fields map[string]interface{}
+		valid  bool
+	}{
+		{
+			name:   "nested",
+			fields: map[string]interface{}{"host": map[string]interface{}{"uptime": 10}},
+			valid:  true,
+		},
+		{
+			name:   "dotted keys",
+			fields: map[string]interface{}{"host.os": map[string]interface{}{"name": "Ubuntu"}},
+			valid:  true,
+		},
+		{
+			name:   "custom fields are ignored",
+			fields: map[string]interface{}{"host": map[string]interface{}{"rack": 3}, "custom": true},
+			valid:  true,
+		},
+		{
+			name:   "wrong type",
+			fields: map[string]interface{}{"host": map[string]interface{}{"uptime": "10s"}},
+		},
+		{
+			name:   "object instead of keyword",
+			fields: map[string]interface{}{"host": map[string]interface{}{"name": map[string]interface{}{}}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fields, err := helpers.NewStruct(c.fields)
+			require.NoError(t, err)
+			err = Validate(fields)
+			if c.valid {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, ErrInvalidField)
+			}
+		})
+	}
+}
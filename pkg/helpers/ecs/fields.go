@@ -0,0 +1,82 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package ecs
+
+// Version is the ECS version the bundled field definitions come from.
+const Version = "8.4.0"
+
+// Type is the ECS data type of a field.
+type Type string
+
+// ECS data types used by the bundled fields.
+const (
+	Keyword Type = "keyword"
+	Long    Type = "long"
+	IP      Type = "ip"
+)
+
+// fields are the ECS fields set by this package, by dotted name.
+var fields = map[string]Type{
+	"agent.build.original": Keyword,
+	"agent.ephemeral_id":   Keyword,
+	"agent.id":             Keyword,
+	"agent.name":           Keyword,
+	"agent.type":           Keyword,
+	"agent.version":        Keyword,
+
+	"host.architecture": Keyword,
+	"host.boot.id":      Keyword,
+	"host.domain":       Keyword,
+	"host.hostname":     Keyword,
+	"host.id":           Keyword,
+	"host.ip":           IP,
+	"host.mac":          Keyword,
+	"host.name":         Keyword,
+	"host.type":         Keyword,
+	"host.uptime":       Long,
+	"host.os.family":    Keyword,
+	"host.os.full":      Keyword,
+	"host.os.kernel":    Keyword,
+	"host.os.name":      Keyword,
+	"host.os.platform":  Keyword,
+	"host.os.type":      Keyword,
+	"host.os.version":   Keyword,
+
+	"log.file.path":        Keyword,
+	"log.level":            Keyword,
+	"log.logger":           Keyword,
+	"log.origin.file.line": Long,
+	"log.origin.file.name": Keyword,
+	"log.origin.function":  Keyword,
+
+	"network.application":  Keyword,
+	"network.bytes":        Long,
+	"network.community_id": Keyword,
+	"network.direction":    Keyword,
+	"network.forwarded_ip": IP,
+	"network.iana_number":  Keyword,
+	"network.name":         Keyword,
+	"network.packets":      Long,
+	"network.protocol":     Keyword,
+	"network.transport":    Keyword,
+	"network.type":         Keyword,
+
+	"service.address":      Keyword,
+	"service.environment":  Keyword,
+	"service.ephemeral_id": Keyword,
+	"service.id":           Keyword,
+	"service.name":         Keyword,
+	"service.node.name":    Keyword,
+	"service.node.role":    Keyword,
+	"service.state":        Keyword,
+	"service.type":         Keyword,
+	"service.version":      Keyword,
+}
+
+// Lookup returns the type of a bundled ECS field.
+func Lookup(name string) (Type, bool) {
+	t, ok := fields[name]
+	return t, ok
+}
@@ -0,0 +1,167 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package ecs
+
+import (
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Agent holds the agent.* fields. Empty values are not set.
+type Agent struct {
+	BuildOriginal string
+	EphemeralID   string
+	ID            string
+	Name          string
+	Type          string
+	Version       string
+}
+
+// SetAgent sets the agent.* fields.
+func SetAgent(fields *messages.Struct, a Agent) error {
+	var fs fieldSet
+	fs.str("agent.build.original", a.BuildOriginal)
+	fs.str("agent.ephemeral_id", a.EphemeralID)
+	fs.str("agent.id", a.ID)
+	fs.str("agent.name", a.Name)
+	fs.str("agent.type", a.Type)
+	fs.str("agent.version", a.Version)
+	return set(fields, fs)
+}
+
+// OS holds the host.os.* fields.
+type OS struct {
+	Family   string
+	Full     string
+	Kernel   string
+	Name     string
+	Platform string
+	Type     string
+	Version  string
+}
+
+// Host holds the host.* fields. Empty values are not set.
+type Host struct {
+	Architecture string
+	BootID       string
+	Domain       string
+	Hostname     string
+	ID           string
+	// IP addresses of the host, they must be valid IPv4 or IPv6 addresses.
+	IP   []string
+	MAC  []string
+	Name string
+	Type string
+	// Uptime in seconds.
+	Uptime int64
+	OS     OS
+}
+
+// SetHost sets the host.* fields.
+func SetHost(fields *messages.Struct, h Host) error {
+	var fs fieldSet
+	fs.str("host.architecture", h.Architecture)
+	fs.str("host.boot.id", h.BootID)
+	fs.str("host.domain", h.Domain)
+	fs.str("host.hostname", h.Hostname)
+	fs.str("host.id", h.ID)
+	fs.strs("host.ip", h.IP)
+	fs.strs("host.mac", h.MAC)
+	fs.str("host.name", h.Name)
+	fs.str("host.type", h.Type)
+	fs.long("host.uptime", h.Uptime)
+	fs.str("host.os.family", h.OS.Family)
+	fs.str("host.os.full", h.OS.Full)
+	fs.str("host.os.kernel", h.OS.Kernel)
+	fs.str("host.os.name", h.OS.Name)
+	fs.str("host.os.platform", h.OS.Platform)
+	fs.str("host.os.type", h.OS.Type)
+	fs.str("host.os.version", h.OS.Version)
+	return set(fields, fs)
+}
+
+// Log holds the log.* fields. Empty values are not set.
+type Log struct {
+	FilePath       string
+	Level          string
+	Logger         string
+	OriginFileLine int64
+	OriginFileName string
+	OriginFunction string
+}
+
+// SetLog sets the log.* fields.
+func SetLog(fields *messages.Struct, l Log) error {
+	var fs fieldSet
+	fs.str("log.file.path", l.FilePath)
+	fs.str("log.level", l.Level)
+	fs.str("log.logger", l.Logger)
+	fs.long("log.origin.file.line", l.OriginFileLine)
+	fs.str("log.origin.file.name", l.OriginFileName)
+	fs.str("log.origin.function", l.OriginFunction)
+	return set(fields, fs)
+}
+
+// Network holds the network.* fields. Empty values are not set.
+type Network struct {
+	Application string
+	Bytes       int64
+	CommunityID string
+	Direction   string
+	// ForwardedIP must be a valid IPv4 or IPv6 address.
+	ForwardedIP string
+	IANANumber  string
+	Name        string
+	Packets     int64
+	Protocol    string
+	Transport   string
+	Type        string
+}
+
+// SetNetwork sets the network.* fields.
+func SetNetwork(fields *messages.Struct, n Network) error {
+	var fs fieldSet
+	fs.str("network.application", n.Application)
+	fs.long("network.bytes", n.Bytes)
+	fs.str("network.community_id", n.CommunityID)
+	fs.str("network.direction", n.Direction)
+	fs.str("network.forwarded_ip", n.ForwardedIP)
+	fs.str("network.iana_number", n.IANANumber)
+	fs.str("network.name", n.Name)
+	fs.long("network.packets", n.Packets)
+	fs.str("network.protocol", n.Protocol)
+	fs.str("network.transport", n.Transport)
+	fs.str("network.type", n.Type)
+	return set(fields, fs)
+}
+
+// Service holds the service.* fields. Empty values are not set.
+type Service struct {
+	Address     string
+	Environment string
+	EphemeralID string
+	ID          string
+	Name        string
+	NodeName    string
+	NodeRole    string
+	State       string
+	Type        string
+	Version     string
+}
+
+// SetService sets the service.* fields.
+func SetService(fields *messages.Struct, s Service) error {
+	var fs fieldSet
+	fs.str("service.address", s.Address)
+	fs.str("service.environment", s.Environment)
+	fs.str("service.ephemeral_id", s.EphemeralID)
+	fs.str("service.id", s.ID)
+	fs.str("service.name", s.Name)
+	fs.str("service.node.name", s.NodeName)
+	fs.str("service.node.role", s.NodeRole)
+	fs.str("service.state", s.State)
+	fs.str("service.type", s.Type)
+	fs.str("service.version", s.Version)
+	return set(fields, fs)
+}
@@ -0,0 +1,122 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// EqualOption configures Equal and StructEqual.
+type EqualOption func(*equalOptions)
+
+type equalOptions struct {
+	ignoreListOrder    bool
+	timestampTolerance time.Duration
+}
+
+// WithIgnoreListOrder compares lists as unordered collections.
+func WithIgnoreListOrder() EqualOption {
+	return func(o *equalOptions) {
+		o.ignoreListOrder = true
+	}
+}
+
+// WithTimestampTolerance considers timestamps equal when they are at most
+// tolerance apart.
+func WithTimestampTolerance(tolerance time.Duration) EqualOption {
+	return func(o *equalOptions) {
+		o.timestampTolerance = tolerance
+	}
+}
+
+// Equal reports whether two values are deeply equal. Values of different
+// kinds are never equal, an Int32Value 1 isn't equal to an Int64Value 1.
+func Equal(a, b *messages.Value, opts ...EqualOption) bool {
+	return newEqualOptions(opts).equal(a, b)
+}
+
+// StructEqual reports whether two structs have the same fields with equal
+// values, see Equal. A nil Struct is equal to an empty one.
+func StructEqual(a, b *messages.Struct, opts ...EqualOption) bool {
+	return newEqualOptions(opts).structEqual(a, b)
+}
+
+func newEqualOptions(opts []EqualOption) *equalOptions {
+	o := &equalOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *equalOptions) equal(a, b *messages.Value) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	switch av := a.GetKind().(type) {
+	case *messages.Value_StructValue:
+		bv, ok := b.GetKind().(*messages.Value_StructValue)
+		return ok && o.structEqual(av.StructValue, bv.StructValue)
+	case *messages.Value_ListValue:
+		bv, ok := b.GetKind().(*messages.Value_ListValue)
+		return ok && o.listEqual(av.ListValue.GetValues(), bv.ListValue.GetValues())
+	case *messages.Value_TimestampValue:
+		bv, ok := b.GetKind().(*messages.Value_TimestampValue)
+		if !ok || o.timestampTolerance == 0 {
+			return ok && proto.Equal(av.TimestampValue, bv.TimestampValue)
+		}
+		diff := av.TimestampValue.AsTime().Sub(bv.TimestampValue.AsTime())
+		return diff <= o.timestampTolerance && diff >= -o.timestampTolerance
+	}
+	return proto.Equal(a, b)
+}
+
+func (o *equalOptions) structEqual(a, b *messages.Struct) bool {
+	if len(a.GetData()) != len(b.GetData()) {
+		return false
+	}
+	for k, av := range a.GetData() {
+		bv, ok := b.GetData()[k]
+		if !ok || !o.equal(av, bv) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *equalOptions) listEqual(a, b []*messages.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if !o.ignoreListOrder {
+		for i := range a {
+			if !o.equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// lists of events are small, a quadratic match is good enough
+	matched := make([]bool, len(b))
+	for _, av := range a {
+		found := false
+		for j, bv := range b {
+			if !matched[j] && o.equal(av, bv) {
+				matched[j] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
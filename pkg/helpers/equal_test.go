@@ -0,0 +1,66 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestEqual(t *testing.T) {
+	ts := time.Date(2022, 8, 4, 18, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		a, b  interface{}
+		opts  []EqualOption
+		equal bool
+	}{
+		{name: "same", a: map[string]interface{}{"a": []interface{}{1, "b"}}, b: map[string]interface{}{"a": []interface{}{1, "b"}}, equal: true},
+		{name: "different kinds", a: int32(1), b: int64(1)},
+		{name: "different keys", a: map[string]interface{}{"a": 1}, b: map[string]interface{}{"b": 1}},
+		{name: "list order", a: []interface{}{1, 2, 2}, b: []interface{}{2, 1, 2}},
+		{name: "ignore list order", a: []interface{}{1, 2, 2}, b: []interface{}{2, 1, 2}, opts: []EqualOption{WithIgnoreListOrder()}, equal: true},
+		{name: "ignore list order counts duplicates", a: []interface{}{1, 1, 2}, b: []interface{}{2, 1, 2}, opts: []EqualOption{WithIgnoreListOrder()}},
+		{name: "timestamps", a: ts, b: ts.Add(time.Millisecond)},
+		{
+			name:  "timestamp tolerance",
+			a:     map[string]interface{}{"@timestamp": ts},
+			b:     map[string]interface{}{"@timestamp": ts.Add(-time.Millisecond)},
+			opts:  []EqualOption{WithTimestampTolerance(time.Millisecond)},
+			equal: true,
+		},
+		{name: "timestamp out of tolerance", a: ts, b: ts.Add(time.Second), opts: []EqualOption{WithTimestampTolerance(time.Millisecond)}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a, err := NewValue(c.a)
+			require.NoError(t, err)
+			b, err := NewValue(c.b)
+			require.NoError(t, err)
+			require.Equal(t, c.equal, Equal(a, b, c.opts...))
+			require.Equal(t, c.equal, Equal(b, a, c.opts...))
+		})
+	}
+
+	require.True(t, Equal(nil, nil))
+	require.False(t, Equal(NewNullValue(), nil, WithIgnoreListOrder()))
+}
+
+func TestStructEqual(t *testing.T) {
+	a, err := NewStruct(map[string]interface{}{"tags": []interface{}{"a", "b"}})
+	require.NoError(t, err)
+	b, err := NewStruct(map[string]interface{}{"tags": []interface{}{"b", "a"}})
+	require.NoError(t, err)
+
+	require.False(t, StructEqual(a, b))
+	require.True(t, StructEqual(a, b, WithIgnoreListOrder()))
+	require.True(t, StructEqual(nil, &messages.Struct{}))
+}
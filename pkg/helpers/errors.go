@@ -0,0 +1,33 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import "errors"
+
+// The sentinels of the error taxonomy of the module. The errors of the
+// helpers, the client and the publishers match the sentinel of their kind
+// with errors.Is, so callers can branch on the kind of failure instead of
+// matching messages:
+//
+//	if errors.Is(err, helpers.ErrQueueFull) {
+//		// slow down and send again
+//	}
+//
+// The client re-exports them, see client.ErrQueueFull.
+var (
+	// ErrInvalidEvent is matched by the events the shipper or a Validator
+	// rejected, see ValidationError. Sending them again fails the same way.
+	ErrInvalidEvent = errors.New("invalid event")
+	// ErrTooLarge is matched by the values, events and requests above a
+	// limit of size, depth or number of keys, see LimitError.
+	ErrTooLarge = errors.New("too large")
+	// ErrQueueFull is matched when the queue of the shipper or of a
+	// publisher has no room, the events can be sent again later.
+	ErrQueueFull = errors.New("queue is full")
+	// ErrNotConnected is matched when the shipper can't be reached.
+	ErrNotConnected = errors.New("not connected to the shipper")
+	// ErrShutdown is matched by the calls on a closed client or publisher.
+	ErrShutdown = errors.New("shut down")
+)
@@ -0,0 +1,179 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// EventBuilder assembles a messages.Event using fluent setters.
+// Conversion errors are deferred until Build is called.
+type EventBuilder struct {
+	timestamp  time.Time
+	clock      clock.Clock
+	source     *messages.Source
+	dataStream *messages.DataStream
+	fields     map[string]*messages.Value
+	metadata   map[string]*messages.Value
+	err        error
+
+	// timestampField is parsed by timestampParser when the timestamp isn't
+	// set
+	timestampField  string
+	timestampParser *TimestampParser
+}
+
+// NewEventBuilder returns an empty EventBuilder.
+func NewEventBuilder() *EventBuilder {
+	return &EventBuilder{
+		fields:   map[string]*messages.Value{},
+		metadata: map[string]*messages.Value{},
+	}
+}
+
+// SetTimestamp sets the creation time of the event.
+func (b *EventBuilder) SetTimestamp(ts time.Time) *EventBuilder {
+	b.timestamp = ts
+	return b
+}
+
+// SetClock makes Build default the timestamp of the events to the current
+// time of c when SetTimestamp wasn't called. Without a clock the timestamp
+// is required.
+func (b *EventBuilder) SetClock(c clock.Clock) *EventBuilder {
+	b.clock = c
+	return b
+}
+
+// SetTimestampField makes Build parse the timestamp of the event from the
+// field at the dotted path key with parser, when SetTimestamp wasn't called.
+// The field is kept, the events without it fall back to the clock. A nil
+// parser uses the defaults of NewTimestampParser.
+func (b *EventBuilder) SetTimestampField(key string, parser *TimestampParser) *EventBuilder {
+	if parser == nil {
+		parser = NewTimestampParser(TimestampParserConfig{})
+	}
+	b.timestampField = key
+	b.timestampParser = parser
+	return b
+}
+
+// SetSource sets the input and stream that generated the event.
+// The stream ID is optional.
+func (b *EventBuilder) SetSource(inputID, streamID string) *EventBuilder {
+	b.source = &messages.Source{InputId: inputID, StreamId: streamID}
+	return b
+}
+
+// SetDataStream sets the data stream the event is routed to.
+func (b *EventBuilder) SetDataStream(typ, dataset, namespace string) *EventBuilder {
+	b.dataStream = &messages.DataStream{Type: typ, Dataset: dataset, Namespace: namespace}
+	return b
+}
+
+// AddField sets a field of the event, the value is converted using NewValue.
+func (b *EventBuilder) AddField(key string, value interface{}) *EventBuilder {
+	b.add(b.fields, "field", key, value)
+	return b
+}
+
+// AddMetadata sets a metadata field of the event, the value is converted using NewValue.
+func (b *EventBuilder) AddMetadata(key string, value interface{}) *EventBuilder {
+	b.add(b.metadata, "metadata", key, value)
+	return b
+}
+
+func (b *EventBuilder) add(target map[string]*messages.Value, kind, key string, value interface{}) {
+	if b.err != nil {
+		return
+	}
+	v, err := NewValue(value)
+	if err != nil {
+		b.err = fmt.Errorf("invalid %s %q: %w", kind, key, err)
+		return
+	}
+	target[key] = v
+}
+
+// Build validates the required fields and returns the event. The required
+// fields are:
+//
+//   - the timestamp, from SetTimestamp, else from the field of
+//     SetTimestampField, else from the clock of SetClock
+//   - the source input ID
+//   - the data stream type, dataset and namespace
+//
+// The builder can be reused, the events already built are not affected by
+// later changes.
+func (b *EventBuilder) Build() (*messages.Event, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	e := &messages.Event{
+		Fields:   &messages.Struct{Data: copyData(b.fields)},
+		Metadata: &messages.Struct{Data: copyData(b.metadata)},
+	}
+	if b.source != nil {
+		e.Source = proto.Clone(b.source).(*messages.Source)
+	}
+	if b.dataStream != nil {
+		e.DataStream = proto.Clone(b.dataStream).(*messages.DataStream)
+	}
+	if !b.timestamp.IsZero() {
+		e.Timestamp = timestamppb.New(b.timestamp)
+	} else if v, err := GetField(e.Fields, b.timestampField); b.timestampField != "" && err == nil {
+		ts, err := b.timestampParser.ParseValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp field %q: %w", b.timestampField, err)
+		}
+		e.Timestamp = timestamppb.New(ts)
+	} else if b.clock != nil {
+		e.Timestamp = timestamppb.New(b.clock.Now())
+	}
+	if missing := missingFields(e); len(missing) > 0 {
+		return nil, fmt.Errorf("event is missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return e, nil
+}
+
+// copyData returns a deep copy of the map, every built event owns its
+// values.
+func copyData(data map[string]*messages.Value) map[string]*messages.Value {
+	copied := make(map[string]*messages.Value, len(data))
+	for k, v := range data {
+		copied[k] = CloneValue(v)
+	}
+	return copied
+}
+
+// missingFields returns the required fields that are not set in the event.
+func missingFields(e *messages.Event) []string {
+	var missing []string
+	if e.Timestamp == nil {
+		missing = append(missing, "timestamp")
+	}
+	if e.Source.GetInputId() == "" {
+		missing = append(missing, "source.input_id")
+	}
+	if e.DataStream.GetType() == "" {
+		missing = append(missing, "data_stream.type")
+	}
+	if e.DataStream.GetDataset() == "" {
+		missing = append(missing, "data_stream.dataset")
+	}
+	if e.DataStream.GetNamespace() == "" {
+		missing = append(missing, "data_stream.namespace")
+	}
+	return missing
+}
@@ -0,0 +1,127 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestEventBuilder(t *testing.T) {
+	ts := time.Now()
+	event, err := NewEventBuilder().
+		SetTimestamp(ts).
+		SetSource("log-1", "stream-1").
+		SetDataStream("logs", "nginx.access", "default").
+		AddField("message", "GET /index.html").
+		AddField("http.response.status_code", 200).
+		AddMetadata("pipeline", "nginx").
+		Build()
+	require.NoError(t, err)
+
+	require.Equal(t, &messages.Event{
+		Timestamp:  timestamppb.New(ts),
+		Source:     &messages.Source{InputId: "log-1", StreamId: "stream-1"},
+		DataStream: &messages.DataStream{Type: "logs", Dataset: "nginx.access", Namespace: "default"},
+		Fields: &messages.Struct{Data: map[string]*messages.Value{
+			"message":                   NewStringValue("GET /index.html"),
+			"http.response.status_code": NewInt64Value(200),
+		}},
+		Metadata: &messages.Struct{Data: map[string]*messages.Value{
+			"pipeline": NewStringValue("nginx"),
+		}},
+	}, event)
+}
+
+func TestEventBuilderReuse(t *testing.T) {
+	builder := NewEventBuilder().
+		SetTimestamp(time.Now()).
+		SetSource("log-1", "").
+		SetDataStream("logs", "generic", "default").
+		AddField("message", "first").
+		AddField("host", map[string]interface{}{"name": "first"})
+	first, err := builder.Build()
+	require.NoError(t, err)
+
+	second, err := builder.AddField("message", "second").AddMetadata("pipeline", "p").Build()
+	require.NoError(t, err)
+	second.Source.StreamId = "changed"
+	_, err = PutField(second.Fields, "host.name", NewStringValue("changed"))
+	require.NoError(t, err)
+
+	require.Equal(t, "first", first.Fields.Data["message"].GetStringValue())
+	host, err := GetField(first.Fields, "host.name")
+	require.NoError(t, err)
+	require.Equal(t, "first", host.GetStringValue())
+	require.Empty(t, first.Metadata.Data)
+	require.Empty(t, first.Source.StreamId)
+	require.Equal(t, "second", second.Fields.Data["message"].GetStringValue())
+}
+
+func TestEventBuilderErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		builder *EventBuilder
+		err     string
+	}{
+		{
+			name:    "missing everything",
+			builder: NewEventBuilder(),
+			err:     "event is missing required fields: timestamp, source.input_id, data_stream.type, data_stream.dataset, data_stream.namespace",
+		},
+		{
+			name: "missing namespace",
+			builder: NewEventBuilder().
+				SetTimestamp(time.Now()).
+				SetSource("log-1", "").
+				SetDataStream("logs", "generic", ""),
+			err: "event is missing required fields: data_stream.namespace",
+		},
+		{
+			name: "invalid field",
+			builder: NewEventBuilder().
+				SetTimestamp(time.Now()).
+				AddField("channel", make(chan int)),
+			err: `invalid field "channel"`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := c.builder.Build()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), c.err)
+		})
+	}
+}
+
+func TestEventBuilderClock(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	builder := NewEventBuilder().
+		SetClock(fake).
+		SetSource("log-1", "").
+		SetDataStream("logs", "generic", "default")
+
+	event, err := builder.Build()
+	require.NoError(t, err)
+	require.Equal(t, now, event.Timestamp.AsTime())
+
+	fake.Advance(time.Minute)
+	event, err = builder.Build()
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Minute), event.Timestamp.AsTime())
+
+	// an explicit timestamp takes precedence
+	event, err = builder.SetTimestamp(now).Build()
+	require.NoError(t, err)
+	require.Equal(t, now, event.Timestamp.AsTime())
+}
@@ -0,0 +1,96 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrKeyNotFound is returned when a dotted path doesn't exist in a Struct.
+var ErrKeyNotFound = errors.New("key not found")
+
+// The field accessors address nested fields with dotted paths, like beats
+// processors and mapstr.M do: "host.name" is the "name" field of the
+// struct in the "host" field.
+
+// GetField returns the value at the dotted path.
+func GetField(st *messages.Struct, key string) (*messages.Value, error) {
+	parent, last, err := walkFields(st, key, false)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := parent.GetData()[last]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	return v, nil
+}
+
+// HasField returns true if the dotted path exists.
+func HasField(st *messages.Struct, key string) bool {
+	_, err := GetField(st, key)
+	return err == nil
+}
+
+// PutField sets the value at the dotted path, creating the missing parent
+// structs, and returns the previous value, if any. It fails if a parent
+// exists and isn't a struct.
+func PutField(st *messages.Struct, key string, v *messages.Value) (*messages.Value, error) {
+	if st == nil {
+		return nil, errors.New("can't put a field into a nil struct")
+	}
+	parent, last, err := walkFields(st, key, true)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Data == nil {
+		parent.Data = map[string]*messages.Value{}
+	}
+	old := parent.Data[last]
+	parent.Data[last] = v
+	return old, nil
+}
+
+// DeleteField removes the value at the dotted path.
+func DeleteField(st *messages.Struct, key string) error {
+	parent, last, err := walkFields(st, key, false)
+	if err != nil {
+		return err
+	}
+	if _, ok := parent.GetData()[last]; !ok {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	delete(parent.Data, last)
+	return nil
+}
+
+// walkFields returns the struct holding the last key of the path, creating
+// the missing structs when create is true.
+func walkFields(st *messages.Struct, key string, create bool) (*messages.Struct, string, error) {
+	keys := strings.Split(key, ".")
+	for i, k := range keys[:len(keys)-1] {
+		v, ok := st.GetData()[k]
+		if !ok {
+			if !create {
+				return nil, "", fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+			}
+			if st.Data == nil {
+				st.Data = map[string]*messages.Value{}
+			}
+			v = NewStructValue(&messages.Struct{})
+			st.Data[k] = v
+		}
+		next := v.GetStructValue()
+		if next == nil {
+			return nil, "", fmt.Errorf("expected a struct at %s, got %T", strings.Join(keys[:i+1], "."), v.GetKind())
+		}
+		st = next
+	}
+	return st, keys[len(keys)-1], nil
+}
@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestFieldAccessors(t *testing.T) {
+	st, err := NewStruct(map[string]interface{}{
+		"message": "hello",
+		"host":    map[string]interface{}{"name": "web-1"},
+	})
+	require.NoError(t, err)
+
+	v, err := GetField(st, "host.name")
+	require.NoError(t, err)
+	require.Equal(t, "web-1", v.GetStringValue())
+	require.True(t, HasField(st, "message"))
+	require.False(t, HasField(st, "host.ip"))
+	require.False(t, HasField(st, "message.text"))
+
+	_, err = GetField(st, "agent.name")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	old, err := PutField(st, "host.name", NewStringValue("web-2"))
+	require.NoError(t, err)
+	require.Equal(t, "web-1", old.GetStringValue())
+	old, err = PutField(st, "host.os.name", NewStringValue("linux"))
+	require.NoError(t, err)
+	require.Nil(t, old)
+	_, err = PutField(st, "message.text", NewStringValue("hello"))
+	require.Error(t, err)
+
+	require.NoError(t, DeleteField(st, "host.name"))
+	require.ErrorIs(t, DeleteField(st, "host.name"), ErrKeyNotFound)
+	require.ErrorIs(t, DeleteField(st, "agent.name"), ErrKeyNotFound)
+
+	require.Equal(t, map[string]interface{}{
+		"message": "hello",
+		"host":    map[string]interface{}{"os": map[string]interface{}{"name": "linux"}},
+	}, AsMap(st))
+}
+
+func TestPutFieldEmptyStruct(t *testing.T) {
+	st := &messages.Struct{}
+	_, err := PutField(st, "a.b.c", NewBoolValue(true))
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{"b": map[string]interface{}{"c": true}},
+	}, AsMap(st))
+
+	_, err = PutField(nil, "a", NewBoolValue(true))
+	require.Error(t, err)
+}
@@ -0,0 +1,64 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Fingerprint returns the hex encoded SHA-256 of the canonical JSON encoding
+// of the event, see CanonicalJSON. Equal events get the same fingerprint, so
+// it can be used as a deduplication or idempotency key.
+//
+// When fields are given, only these dotted paths of the event fields are
+// hashed, in any order: events that only differ by other fields get the same
+// fingerprint. Missing fields are left out, which is different from fields
+// set to null.
+func Fingerprint(e *messages.Event, fields ...string) string {
+	var content *messages.Struct
+	if len(fields) == 0 {
+		content = canonicalEvent(e)
+	} else {
+		content = &messages.Struct{Data: make(map[string]*messages.Value, len(fields))}
+		for _, path := range fields {
+			if v, err := GetField(e.GetFields(), path); err == nil {
+				content.Data[path] = v
+			}
+		}
+	}
+	sum := sha256.Sum256(CanonicalJSON(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalEvent returns a struct holding all the data of the event, the
+// unset parts are left out.
+func canonicalEvent(e *messages.Event) *messages.Struct {
+	st := &messages.Struct{Data: map[string]*messages.Value{}}
+	if e.GetTimestamp() != nil {
+		st.Data["timestamp"] = &messages.Value{Kind: &messages.Value_TimestampValue{TimestampValue: e.GetTimestamp()}}
+	}
+	strings := map[string]string{
+		"source.input_id":       e.GetSource().GetInputId(),
+		"source.stream_id":      e.GetSource().GetStreamId(),
+		"data_stream.type":      e.GetDataStream().GetType(),
+		"data_stream.dataset":   e.GetDataStream().GetDataset(),
+		"data_stream.namespace": e.GetDataStream().GetNamespace(),
+	}
+	for k, s := range strings {
+		if s != "" {
+			st.Data[k] = NewStringValue(s)
+		}
+	}
+	if e.GetMetadata() != nil {
+		st.Data["metadata"] = NewStructValue(e.GetMetadata())
+	}
+	if e.GetFields() != nil {
+		st.Data["fields"] = NewStructValue(e.GetFields())
+	}
+	return st
+}
@@ -0,0 +1,51 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestFingerprint(t *testing.T) {
+	now := time.Date(2022, 8, 1, 12, 30, 0, 0, time.UTC)
+	newEvent := func(fields map[string]interface{}) *messages.Event {
+		st, err := NewStruct(fields)
+		require.NoError(t, err)
+		return &messages.Event{
+			Timestamp:  timestamppb.New(now),
+			Source:     &messages.Source{InputId: "input"},
+			DataStream: &messages.DataStream{Type: "logs"},
+			Fields:     st,
+		}
+	}
+
+	a := newEvent(map[string]interface{}{"message": "hello", "host": map[string]interface{}{"name": "web-1"}, "count": 1})
+	b := newEvent(map[string]interface{}{"message": "hello", "host": map[string]interface{}{"name": "web-1"}, "count": 1.0})
+	c := newEvent(map[string]interface{}{"message": "hello", "host": map[string]interface{}{"name": "web-2"}, "count": 1})
+
+	require.Len(t, Fingerprint(a), 64)
+	require.Equal(t, Fingerprint(a), Fingerprint(b), "numbers are normalized")
+	require.NotEqual(t, Fingerprint(a), Fingerprint(c))
+
+	require.Equal(t, Fingerprint(a, "message", "count"), Fingerprint(c, "count", "message"))
+	require.NotEqual(t, Fingerprint(a, "message", "host.name"), Fingerprint(c, "message", "host.name"))
+
+	withNull := newEvent(map[string]interface{}{"message": "hello", "host": nil})
+	require.NotEqual(t, Fingerprint(withNull, "message", "host"), Fingerprint(withNull, "message", "missing"))
+	require.Equal(t, Fingerprint(withNull, "message"), Fingerprint(withNull, "message", "missing"))
+
+	moved := newEvent(map[string]interface{}{"message": "hello", "host": map[string]interface{}{"name": "web-1"}, "count": 1})
+	moved.Source.InputId = "other"
+	require.NotEqual(t, Fingerprint(a), Fingerprint(moved), "the whole event is hashed")
+	require.Equal(t, Fingerprint(a, "message"), Fingerprint(moved, "message"))
+
+	require.Equal(t, Fingerprint(nil), Fingerprint(&messages.Event{}))
+}
@@ -0,0 +1,99 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// defaultSeparator is used by Flatten and Unflatten when sep is empty, it
+// matches the dotted paths of the field accessors.
+const defaultSeparator = "."
+
+// Flatten returns the leaves of st keyed by their path, the keys of the
+// nested structs joined with sep, like {"host.name": "web-1"}. Lists are
+// leaves, their items are not flattened. Empty structs are kept as leaves,
+// so Unflatten restores them. It fails when two leaves have the same path,
+// like "host.name" and "name" nested in "host", since one would overwrite
+// the other. The values are not copied. An empty sep is ".".
+func Flatten(st *messages.Struct, sep string) (map[string]*messages.Value, error) {
+	if sep == "" {
+		sep = defaultSeparator
+	}
+	out := make(map[string]*messages.Value, len(st.GetData()))
+	if err := flattenStruct(out, "", st, sep); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func flattenStruct(out map[string]*messages.Value, prefix string, st *messages.Struct, sep string) error {
+	for k, v := range st.GetData() {
+		key := k
+		if prefix != "" {
+			key = prefix + sep + k
+		}
+		if nested := v.GetStructValue(); len(nested.GetData()) > 0 {
+			if err := flattenStruct(out, key, nested, sep); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := out[key]; ok {
+			return fmt.Errorf("can't flatten %q, it conflicts with another key", key)
+		}
+		out[key] = v
+	}
+	return nil
+}
+
+// Unflatten is the inverse of Flatten, it splits the keys of fields on sep
+// and nests the values into structs. It fails when a key is both a leaf and
+// the parent of another key, like "host" and "host.name". The values are not
+// copied. An empty sep is ".".
+func Unflatten(fields map[string]*messages.Value, sep string) (*messages.Struct, error) {
+	if sep == "" {
+		sep = defaultSeparator
+	}
+	// sorted, so the conflicts are reported consistently
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := &messages.Struct{Data: make(map[string]*messages.Value, len(fields))}
+	// the structs created here, the ones from fields are leaves
+	created := map[*messages.Struct]bool{out: true}
+	for _, key := range keys {
+		parts := strings.Split(key, sep)
+		parent := out
+		for i, part := range parts[:len(parts)-1] {
+			v, ok := parent.Data[part]
+			if !ok {
+				nested := &messages.Struct{Data: map[string]*messages.Value{}}
+				created[nested] = true
+				parent.Data[part] = NewStructValue(nested)
+				parent = nested
+				continue
+			}
+			nested := v.GetStructValue()
+			if !created[nested] {
+				return nil, fmt.Errorf("can't unflatten %q, %q is not a struct", key, strings.Join(parts[:i+1], sep))
+			}
+			parent = nested
+		}
+		last := parts[len(parts)-1]
+		if _, ok := parent.Data[last]; ok {
+			return nil, fmt.Errorf("can't unflatten %q, it conflicts with another key", key)
+		}
+		parent.Data[last] = fields[key]
+	}
+	return out, nil
+}
@@ -0,0 +1,81 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestFlattenRoundTrip(t *testing.T) {
+	st, err := NewStruct(map[string]interface{}{
+		"message": "hello",
+		"host":    map[string]interface{}{"name": "web-1", "ip": []string{"10.0.0.1"}, "os": map[string]interface{}{"family": "linux"}},
+		"labels":  map[string]interface{}{},
+	})
+	require.NoError(t, err)
+
+	flat, err := Flatten(st, "")
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"message":        "hello",
+		"host.name":      "web-1",
+		"host.ip":        []interface{}{"10.0.0.1"},
+		"host.os.family": "linux",
+		"labels":         map[string]interface{}{},
+	}, AsMap(&messages.Struct{Data: flat}))
+
+	nested, err := Unflatten(flat, "")
+	require.NoError(t, err)
+	require.True(t, StructEqual(st, nested))
+
+	flat, err = Flatten(st, "_")
+	require.NoError(t, err)
+	require.Contains(t, flat, "host_os_family")
+	nested, err = Unflatten(flat, "_")
+	require.NoError(t, err)
+	require.True(t, StructEqual(st, nested))
+}
+
+func TestFlattenConflicts(t *testing.T) {
+	st, err := NewStruct(map[string]interface{}{
+		"host.name": "web-1",
+		"host":      map[string]interface{}{"name": "web-2", "ip": "10.0.0.1"},
+	})
+	require.NoError(t, err)
+	_, err = Flatten(st, "")
+	require.EqualError(t, err, `can't flatten "host.name", it conflicts with another key`)
+
+	// no conflict with another separator
+	flat, err := Flatten(st, "_")
+	require.NoError(t, err)
+	require.Len(t, flat, 3)
+}
+
+func TestUnflattenConflicts(t *testing.T) {
+	cases := map[string]map[string]*messages.Value{
+		"leaf and parent": {
+			"host":      NewStringValue("web-1"),
+			"host.name": NewStringValue("web-1"),
+		},
+		"struct leaf and parent": {
+			"host":      NewStructValue(&messages.Struct{}),
+			"host.name": NewStringValue("web-1"),
+		},
+		"parent and leaf": {
+			"a.b":   NewStringValue("x"),
+			"a.b.c": NewStringValue("y"),
+		},
+	}
+	for name, fields := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Unflatten(fields, ".")
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+var fuzzSeeds = []string{
+	`{}`,
+	`null`,
+	`{"message":"hello","count":3,"ratio":0.5,"ok":true,"missing":null}`,
+	`{"host":{"name":"web-1","ip":["10.0.0.1","fe80::1"]},"tags":[]}`,
+	`[1,"a",[{"b":[]}],-1.5e300]`,
+	`{"max":18446744073709551615,"min":-9223372036854775808,"é":"😀"}`,
+}
+
+// FuzzNewValue checks that the values decoded by encoding/json round trip
+// through NewValue and AsInterface.
+func FuzzNewValue(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var in interface{}
+		if err := json.Unmarshal(data, &in); err != nil {
+			return
+		}
+		v, err := NewValue(in)
+		require.NoError(t, err)
+		require.Equal(t, in, AsInterface(v))
+
+		// and through the wire format
+		encoded, err := proto.Marshal(v)
+		require.NoError(t, err)
+		var decoded = NewNullValue()
+		require.NoError(t, proto.Unmarshal(encoded, decoded))
+		require.True(t, proto.Equal(v, decoded))
+	})
+}
+
+// FuzzStructFromJSON checks that any JSON object accepted by StructFromJSON
+// is encoded back by StructToJSON to an equivalent object. JSON doesn't
+// tell integral floats from integers, so the documents are compared rather
+// than the Value kinds.
+func FuzzStructFromJSON(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		st, err := StructFromJSON(data)
+		if err != nil {
+			return
+		}
+		encoded, err := StructToJSON(st)
+		require.NoError(t, err)
+		decoded, err := StructFromJSON(encoded)
+		require.NoError(t, err, string(encoded))
+		reencoded, err := StructToJSON(decoded)
+		require.NoError(t, err)
+
+		var exp, got interface{}
+		require.NoError(t, json.Unmarshal(encoded, &exp))
+		require.NoError(t, json.Unmarshal(reencoded, &got))
+		require.Equal(t, exp, got)
+	})
+}
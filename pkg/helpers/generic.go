@@ -0,0 +1,355 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+	"unicode/utf8"
+
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrConversion is returned when a value can't be converted to a Go type.
+var ErrConversion = errors.New("cannot convert value")
+
+// ConversionError describes a value that can't be converted by AsTyped.
+type ConversionError struct {
+	// Kind is the kind of the value, like "string" or "int64".
+	Kind string
+	// Type is the Go type the value was converted to.
+	Type string
+	// Reason is set when the kind is supported but not this value.
+	Reason string
+}
+
+func (e *ConversionError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s: %s value to %s: %s", ErrConversion, e.Kind, e.Type, e.Reason)
+	}
+	return fmt.Sprintf("%s: %s value to %s", ErrConversion, e.Kind, e.Type)
+}
+
+// Is makes ConversionError match ErrConversion.
+func (e *ConversionError) Is(target error) bool {
+	return target == ErrConversion
+}
+
+// NewValueT is NewValue for a value of static type T. Strings, booleans,
+// numbers and times are converted directly, other types like NewValue.
+func NewValueT[T any](v T) (*messages.Value, error) {
+	switch v := any(v).(type) {
+	case string:
+		if !utf8.ValidString(v) {
+			return nil, protoimpl.X.NewError("invalid UTF-8 in string: %q", v)
+		}
+		return NewStringValue(v), nil
+	case bool:
+		return NewBoolValue(v), nil
+	case int:
+		return NewInt64Value(int64(v)), nil
+	case int32:
+		return NewInt32Value(v), nil
+	case int64:
+		return NewInt64Value(v), nil
+	case uint32:
+		return NewUint32Value(v), nil
+	case uint64:
+		return NewUint64Value(v), nil
+	case float32:
+		return NewFloat32Value(v), nil
+	case float64:
+		return NewFloat64Value(v), nil
+	case time.Time:
+		return NewTimestampValue(v), nil
+	}
+	return NewValue(v)
+}
+
+// AsTyped converts x to T. The supported types are:
+//   - string, bool and time.Time, from values of the same kind. Times are
+//     also parsed from RFC 3339 strings.
+//   - the integer and floating-point types, from any number that fits in
+//     T. Floats only convert to integers when they have no fractional part.
+//   - []string, from lists of strings, []interface{} and
+//     map[string]interface{}, converted like AsSlice and AsMap, and
+//     map[string]string, from structs of strings.
+//   - []byte, from bytes values, which are not copied, base64 strings and
+//     the structs of WithBytesWrapper.
+//   - *messages.Struct and *messages.ListValue, which are not copied.
+//   - interface{}, converted like AsInterface.
+//
+// Null values convert to the nil slices, maps, pointers and interfaces. Any
+// other conversion fails with a ConversionError.
+func AsTyped[T any](x *messages.Value) (T, error) {
+	var zero T
+	out, err := asTyped[T](x, any(zero))
+	if err != nil {
+		return zero, err
+	}
+	if out == nil {
+		return zero, nil
+	}
+	typed, ok := out.(T)
+	if !ok {
+		return zero, conversionError[T](x, "")
+	}
+	return typed, nil
+}
+
+func asTyped[T any](x *messages.Value, zero interface{}) (interface{}, error) {
+	switch zero.(type) {
+	case string:
+		if v, ok := x.GetKind().(*messages.Value_StringValue); ok {
+			return v.StringValue, nil
+		}
+	case bool:
+		if v, ok := x.GetKind().(*messages.Value_BoolValue); ok {
+			return v.BoolValue, nil
+		}
+	case time.Time:
+		switch v := x.GetKind().(type) {
+		case *messages.Value_TimestampValue:
+			return v.TimestampValue.AsTime(), nil
+		case *messages.Value_StringValue:
+			ts, err := time.Parse(time.RFC3339Nano, v.StringValue)
+			if err != nil {
+				return nil, conversionError[T](x, "not an RFC 3339 time")
+			}
+			return ts, nil
+		}
+	case int:
+		return asInteger[int, T](x)
+	case int8:
+		return asInteger[int8, T](x)
+	case int16:
+		return asInteger[int16, T](x)
+	case int32:
+		return asInteger[int32, T](x)
+	case int64:
+		return asInteger[int64, T](x)
+	case uint:
+		return asInteger[uint, T](x)
+	case uint8:
+		return asInteger[uint8, T](x)
+	case uint16:
+		return asInteger[uint16, T](x)
+	case uint32:
+		return asInteger[uint32, T](x)
+	case uint64:
+		return asInteger[uint64, T](x)
+	case float32:
+		f, ok := asFloat(x)
+		if !ok {
+			break
+		}
+		if math.Abs(f) > math.MaxFloat32 && !math.IsInf(f, 0) {
+			return nil, conversionError[T](x, "out of range")
+		}
+		return float32(f), nil
+	case float64:
+		if f, ok := asFloat(x); ok {
+			return f, nil
+		}
+	case []string:
+		if isNull(x) {
+			return nil, nil
+		}
+		list, ok := x.GetKind().(*messages.Value_ListValue)
+		if !ok {
+			break
+		}
+		strs := make([]string, len(list.ListValue.GetValues()))
+		for i, v := range list.ListValue.GetValues() {
+			s, ok := v.GetKind().(*messages.Value_StringValue)
+			if !ok {
+				return nil, conversionError[T](x, fmt.Sprintf("element %d is of kind %s", i, kindName(v)))
+			}
+			strs[i] = s.StringValue
+		}
+		return strs, nil
+	case []byte:
+		switch v := x.GetKind().(type) {
+		case *messages.Value_BytesValue:
+			return v.BytesValue, nil
+		case *messages.Value_StringValue:
+			data, err := base64.StdEncoding.DecodeString(v.StringValue)
+			if err != nil {
+				return nil, conversionError[T](x, "not base64")
+			}
+			return data, nil
+		case *messages.Value_StructValue:
+			if data, ok := unwrapBytes(v.StructValue); ok {
+				return data, nil
+			}
+		case *messages.Value_NullValue:
+			return nil, nil
+		}
+	case []interface{}:
+		if isNull(x) {
+			return nil, nil
+		}
+		if list, ok := x.GetKind().(*messages.Value_ListValue); ok {
+			return AsSlice(list.ListValue), nil
+		}
+	case map[string]interface{}:
+		if isNull(x) {
+			return nil, nil
+		}
+		if st, ok := x.GetKind().(*messages.Value_StructValue); ok {
+			return AsMap(st.StructValue), nil
+		}
+	case map[string]string:
+		if isNull(x) {
+			return nil, nil
+		}
+		st, ok := x.GetKind().(*messages.Value_StructValue)
+		if !ok {
+			break
+		}
+		strs := make(map[string]string, len(st.StructValue.GetData()))
+		for k, v := range st.StructValue.GetData() {
+			s, ok := v.GetKind().(*messages.Value_StringValue)
+			if !ok {
+				return nil, conversionError[T](x, fmt.Sprintf("key %q is of kind %s", k, kindName(v)))
+			}
+			strs[k] = s.StringValue
+		}
+		return strs, nil
+	case *messages.Struct:
+		if isNull(x) {
+			return nil, nil
+		}
+		if st, ok := x.GetKind().(*messages.Value_StructValue); ok {
+			return st.StructValue, nil
+		}
+	case *messages.ListValue:
+		if isNull(x) {
+			return nil, nil
+		}
+		if list, ok := x.GetKind().(*messages.Value_ListValue); ok {
+			return list.ListValue, nil
+		}
+	case nil:
+		// T is an interface type
+		return AsInterface(x), nil
+	}
+	return nil, conversionError[T](x, "")
+}
+
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// asInteger converts the numbers of x that fit in N.
+func asInteger[N integer, T any](x *messages.Value) (interface{}, error) {
+	var signed int64
+	switch v := x.GetKind().(type) {
+	case *messages.Value_Int32Value:
+		signed = int64(v.Int32Value)
+	case *messages.Value_Int64Value:
+		signed = v.Int64Value
+	case *messages.Value_Uint32Value:
+		signed = int64(v.Uint32Value)
+	case *messages.Value_Uint64Value:
+		if n := N(v.Uint64Value); n >= 0 && uint64(n) == v.Uint64Value {
+			return n, nil
+		}
+		return nil, conversionError[T](x, "out of range")
+	case *messages.Value_Float32Value, *messages.Value_Float64Value:
+		f, _ := asFloat(x)
+		if f != math.Trunc(f) {
+			return nil, conversionError[T](x, "not an integer")
+		}
+		switch {
+		case f >= -(1<<63) && f < 1<<63:
+			signed = int64(f)
+		case f >= 1<<63 && f < 1<<64:
+			if n := N(uint64(f)); n >= 0 && uint64(n) == uint64(f) {
+				return n, nil
+			}
+			return nil, conversionError[T](x, "out of range")
+		default:
+			return nil, conversionError[T](x, "out of range")
+		}
+	default:
+		return nil, conversionError[T](x, "")
+	}
+	if n := N(signed); int64(n) == signed && (n < 0) == (signed < 0) {
+		return n, nil
+	}
+	return nil, conversionError[T](x, "out of range")
+}
+
+// asFloat returns the value of a number as a float64.
+func asFloat(x *messages.Value) (float64, bool) {
+	switch v := x.GetKind().(type) {
+	case *messages.Value_Float64Value:
+		return v.Float64Value, true
+	case *messages.Value_Float32Value:
+		return float64(v.Float32Value), true
+	case *messages.Value_Int32Value:
+		return float64(v.Int32Value), true
+	case *messages.Value_Int64Value:
+		return float64(v.Int64Value), true
+	case *messages.Value_Uint32Value:
+		return float64(v.Uint32Value), true
+	case *messages.Value_Uint64Value:
+		return float64(v.Uint64Value), true
+	}
+	return 0, false
+}
+
+func isNull(x *messages.Value) bool {
+	_, ok := x.GetKind().(*messages.Value_NullValue)
+	return ok || x.GetKind() == nil
+}
+
+func conversionError[T any](x *messages.Value, reason string) error {
+	return &ConversionError{
+		Kind:   kindName(x),
+		Type:   reflect.TypeOf((*T)(nil)).Elem().String(),
+		Reason: reason,
+	}
+}
+
+// kindName returns the name of the kind of x, as used in errors.
+func kindName(x *messages.Value) string {
+	switch x.GetKind().(type) {
+	case *messages.Value_NullValue, nil:
+		return "null"
+	case *messages.Value_BoolValue:
+		return "bool"
+	case *messages.Value_Int32Value:
+		return "int32"
+	case *messages.Value_Int64Value:
+		return "int64"
+	case *messages.Value_Uint32Value:
+		return "uint32"
+	case *messages.Value_Uint64Value:
+		return "uint64"
+	case *messages.Value_Float32Value:
+		return "float32"
+	case *messages.Value_Float64Value:
+		return "float64"
+	case *messages.Value_StringValue:
+		return "string"
+	case *messages.Value_TimestampValue:
+		return "timestamp"
+	case *messages.Value_BytesValue:
+		return "bytes"
+	case *messages.Value_StructValue:
+		return "struct"
+	case *messages.Value_ListValue:
+		return "list"
+	}
+	return fmt.Sprintf("%T", x.GetKind())
+}
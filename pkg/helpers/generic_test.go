@@ -0,0 +1,168 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestNewValueT(t *testing.T) {
+	ts := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name string
+		new  func() (*messages.Value, error)
+		want *messages.Value
+	}{
+		{name: "string", new: func() (*messages.Value, error) { return NewValueT("a") }, want: NewStringValue("a")},
+		{name: "int", new: func() (*messages.Value, error) { return NewValueT(1) }, want: NewInt64Value(1)},
+		{name: "uint64", new: func() (*messages.Value, error) { return NewValueT(uint64(math.MaxUint64)) }, want: NewUint64Value(math.MaxUint64)},
+		{name: "float32", new: func() (*messages.Value, error) { return NewValueT(float32(1.5)) }, want: NewFloat32Value(1.5)},
+		{name: "time", new: func() (*messages.Value, error) { return NewValueT(ts) }, want: NewTimestampValue(ts)},
+		{name: "map", new: func() (*messages.Value, error) { return NewValueT(map[string]string{"a": "b"}) }, want: mustValue(t, map[string]interface{}{"a": "b"})},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.new()
+			require.NoError(t, err)
+			require.True(t, Equal(tc.want, got), "got %v", got)
+		})
+	}
+
+	_, err := NewValueT("\xff")
+	require.Error(t, err)
+}
+
+func mustValue(t *testing.T, v interface{}) *messages.Value {
+	value, err := NewValue(v)
+	require.NoError(t, err)
+	return value
+}
+
+func TestAsTyped(t *testing.T) {
+	ts := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	s, err := AsTyped[string](NewStringValue("a"))
+	require.NoError(t, err)
+	require.Equal(t, "a", s)
+
+	b, err := AsTyped[bool](NewBoolValue(true))
+	require.NoError(t, err)
+	require.True(t, b)
+
+	tm, err := AsTyped[time.Time](NewTimestampValue(ts))
+	require.NoError(t, err)
+	require.Equal(t, ts, tm)
+	tm, err = AsTyped[time.Time](NewStringValue("2022-06-01T00:00:00Z"))
+	require.NoError(t, err)
+	require.Equal(t, ts, tm)
+
+	f, err := AsTyped[float64](NewInt32Value(3))
+	require.NoError(t, err)
+	require.Equal(t, 3.0, f)
+
+	i, err := AsTyped[int](NewFloat64Value(3))
+	require.NoError(t, err)
+	require.Equal(t, 3, i)
+
+	u, err := AsTyped[uint64](NewUint64Value(math.MaxUint64))
+	require.NoError(t, err)
+	require.Equal(t, uint64(math.MaxUint64), u)
+
+	strs, err := AsTyped[[]string](mustValue(t, []string{"a", "b"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, strs)
+
+	labels, err := AsTyped[map[string]string](mustValue(t, map[string]string{"a": "b"}))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"a": "b"}, labels)
+
+	m, err := AsTyped[map[string]interface{}](mustValue(t, map[string]interface{}{"n": int64(1)}))
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"n": int64(1)}, m)
+
+	st, err := AsTyped[*messages.Struct](mustValue(t, map[string]interface{}{"n": 1}))
+	require.NoError(t, err)
+	require.Len(t, st.GetData(), 1)
+
+	iface, err := AsTyped[interface{}](NewInt64Value(1))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), iface)
+
+	nilList, err := AsTyped[[]string](NewNullValue())
+	require.NoError(t, err)
+	require.Nil(t, nilList)
+}
+
+func TestAsTypedErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		convert func() error
+		err     string
+	}{
+		{
+			name:    "kind",
+			convert: func() error { _, err := AsTyped[string](NewInt64Value(1)); return err },
+			err:     "cannot convert value: int64 value to string",
+		},
+		{
+			name:    "null",
+			convert: func() error { _, err := AsTyped[bool](NewNullValue()); return err },
+			err:     "cannot convert value: null value to bool",
+		},
+		{
+			name:    "overflow",
+			convert: func() error { _, err := AsTyped[int8](NewInt64Value(200)); return err },
+			err:     "cannot convert value: int64 value to int8: out of range",
+		},
+		{
+			name:    "negative",
+			convert: func() error { _, err := AsTyped[uint](NewInt32Value(-1)); return err },
+			err:     "cannot convert value: int32 value to uint: out of range",
+		},
+		{
+			name:    "uint64 overflow",
+			convert: func() error { _, err := AsTyped[int64](NewUint64Value(math.MaxUint64)); return err },
+			err:     "cannot convert value: uint64 value to int64: out of range",
+		},
+		{
+			name:    "fraction",
+			convert: func() error { _, err := AsTyped[int](NewFloat64Value(1.5)); return err },
+			err:     "cannot convert value: float64 value to int: not an integer",
+		},
+		{
+			name:    "float32 overflow",
+			convert: func() error { _, err := AsTyped[float32](NewFloat64Value(math.MaxFloat64)); return err },
+			err:     "cannot convert value: float64 value to float32: out of range",
+		},
+		{
+			name:    "time",
+			convert: func() error { _, err := AsTyped[time.Time](NewStringValue("yesterday")); return err },
+			err:     "cannot convert value: string value to time.Time: not an RFC 3339 time",
+		},
+		{
+			name:    "list element",
+			convert: func() error { _, err := AsTyped[[]string](mustValue(t, []interface{}{"a", 1})); return err },
+			err:     "cannot convert value: list value to []string: element 1 is of kind int64",
+		},
+		{
+			name:    "unsupported type",
+			convert: func() error { _, err := AsTyped[complex64](NewFloat64Value(1)); return err },
+			err:     "cannot convert value: float64 value to complex64",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.convert()
+			require.ErrorIs(t, err, ErrConversion)
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
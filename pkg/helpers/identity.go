@@ -0,0 +1,160 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // required by version 5 UUIDs
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrInvalidUUID is returned for identifiers that are not UUIDs.
+var ErrInvalidUUID = errors.New("invalid UUID")
+
+// UUID is an RFC 4122 UUID, used as the identity of agents, inputs and
+// streams.
+type UUID [16]byte
+
+// IDNamespace is the default namespace of NewStableUUID, the version 5 UUID
+// of the URL of this module.
+var IDNamespace = MustParseUUID("857e428f-bbea-5809-9cc3-38766c11f1f8")
+
+// NewUUID returns a random, version 4, UUID.
+func NewUUID() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return UUID{}, fmt.Errorf("error generating a UUID: %w", err)
+	}
+	u.setVersion(4)
+	return u, nil
+}
+
+// NewStableUUID returns the version 5 UUID of name in namespace: the same
+// name always gives the same UUID, so an input can derive its ID from its
+// configuration and keep it across restarts.
+func NewStableUUID(namespace UUID, name string) UUID {
+	h := sha1.New() //nolint:gosec // required by version 5 UUIDs
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+	var u UUID
+	copy(u[:], h.Sum(nil))
+	u.setVersion(5)
+	return u
+}
+
+func (u *UUID) setVersion(version byte) {
+	u[6] = u[6]&0x0f | version<<4
+	// RFC 4122 variant
+	u[8] = u[8]&0x3f | 0x80
+}
+
+// ParseUUID parses the canonical form of a UUID, like
+// "78830eae-97ff-5d43-9e2c-73914914303e", in lower or upper case.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return UUID{}, fmt.Errorf("%w: %q", ErrInvalidUUID, s)
+	}
+	src := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	if _, err := hex.Decode(u[:], []byte(src)); err != nil {
+		return UUID{}, fmt.Errorf("%w: %q", ErrInvalidUUID, s)
+	}
+	return u, nil
+}
+
+// MustParseUUID is ParseUUID for constants, it panics if s is invalid.
+func MustParseUUID(s string) UUID {
+	u, err := ParseUUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// String returns the canonical, lower case, form of the UUID.
+func (u UUID) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// AgentIDField is the ECS field of the events holding the ID of the agent.
+const AgentIDField = "agent.id"
+
+// NewSource returns the source of the events of an input, validated with
+// ValidateSource.
+func NewSource(inputID, streamID string) (*messages.Source, error) {
+	src := &messages.Source{InputId: inputID, StreamId: streamID}
+	if err := ValidateSource(src); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// ValidateSource checks that the input ID of src is a UUID, and the stream
+// ID too when it is set.
+func ValidateSource(src *messages.Source) error {
+	if _, err := ParseUUID(src.GetInputId()); err != nil {
+		return fmt.Errorf("input ID: %w", err)
+	}
+	if src.GetStreamId() == "" {
+		return nil
+	}
+	if _, err := ParseUUID(src.GetStreamId()); err != nil {
+		return fmt.Errorf("stream ID: %w", err)
+	}
+	return nil
+}
+
+// SetAgentID sets the AgentIDField of the event fields.
+func SetAgentID(e *messages.Event, id UUID) error {
+	if e.Fields == nil {
+		e.Fields = &messages.Struct{}
+	}
+	_, err := PutField(e.Fields, AgentIDField, NewStringValue(id.String()))
+	return err
+}
+
+// WithUUIDIdentity makes the Validator reject the events whose source input
+// and stream IDs, or AgentIDField, are set and are not UUIDs.
+func WithUUIDIdentity() ValidatorOption {
+	return func(v *Validator) {
+		v.uuidIdentity = true
+	}
+}
+
+// checkIdentity checks the identifiers of the event for WithUUIDIdentity.
+func (r *validationRun) checkIdentity(e *messages.Event) {
+	for _, id := range []struct{ path, value string }{
+		{"source.input_id", e.Source.GetInputId()},
+		{"source.stream_id", e.Source.GetStreamId()},
+	} {
+		if id.value == "" {
+			continue
+		}
+		if _, err := ParseUUID(id.value); err != nil {
+			r.add(id.path, ErrInvalidUUID)
+		}
+	}
+	agentID, err := GetField(e.Fields, AgentIDField)
+	if err != nil {
+		return
+	}
+	if _, err := ParseUUID(agentID.GetStringValue()); err != nil {
+		r.add("fields."+AgentIDField, ErrInvalidUUID)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUUID(t *testing.T) {
+	a, err := NewUUID()
+	require.NoError(t, err)
+	b, err := NewUUID()
+	require.NoError(t, err)
+	require.NotEqual(t, a, b)
+	require.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, a.String())
+
+	parsed, err := ParseUUID(a.String())
+	require.NoError(t, err)
+	require.Equal(t, a, parsed)
+
+	// matches the version 5 UUIDs of other implementations
+	require.Equal(t, "78830eae-97ff-5d43-9e2c-73914914303e", NewStableUUID(IDNamespace, "filestream-nginx").String())
+	require.Equal(t, NewStableUUID(IDNamespace, "a"), NewStableUUID(IDNamespace, "a"))
+	require.NotEqual(t, NewStableUUID(IDNamespace, "a"), NewStableUUID(IDNamespace, "b"))
+
+	upper, err := ParseUUID("78830EAE-97FF-5D43-9E2C-73914914303E")
+	require.NoError(t, err)
+	require.Equal(t, "78830eae-97ff-5d43-9e2c-73914914303e", upper.String())
+
+	for _, s := range []string{"", "input-1", "78830eae97ff5d439e2c73914914303e", "78830eae-97ff-5d43-9e2c-73914914303g", "{78830eae-97ff-5d43-9e2c-73914914303}"} {
+		_, err := ParseUUID(s)
+		require.ErrorIs(t, err, ErrInvalidUUID, s)
+	}
+}
+
+func TestSourceIdentity(t *testing.T) {
+	input := NewStableUUID(IDNamespace, "input").String()
+	stream := NewStableUUID(IDNamespace, "stream").String()
+
+	src, err := NewSource(input, stream)
+	require.NoError(t, err)
+	require.Equal(t, input, src.InputId)
+	_, err = NewSource(input, "")
+	require.NoError(t, err)
+	_, err = NewSource("input-1", stream)
+	require.ErrorIs(t, err, ErrInvalidUUID)
+	_, err = NewSource(input, "stream-1")
+	require.ErrorIs(t, err, ErrInvalidUUID)
+}
+
+func TestValidatorUUIDIdentity(t *testing.T) {
+	e, err := NewEventBuilder().
+		SetTimestamp(time.Unix(1, 0)).
+		SetSource("input-1", "stream-1").
+		SetDataStream("logs", "generic", "default").
+		AddField("agent", map[string]interface{}{"id": "agent-1"}).
+		Build()
+	require.NoError(t, err)
+
+	require.NoError(t, NewValidator().Validate(e))
+	err = NewValidator(WithUUIDIdentity()).Validate(e)
+	require.ErrorIs(t, err, ErrInvalidUUID)
+	require.Len(t, err.(*ValidationError).Errors, 3)
+
+	e.Source.InputId = NewStableUUID(IDNamespace, "input").String()
+	e.Source.StreamId = ""
+	agent, err := NewUUID()
+	require.NoError(t, err)
+	require.NoError(t, SetAgentID(e, agent))
+	require.NoError(t, NewValidator(WithUUIDIdentity()).Validate(e))
+}
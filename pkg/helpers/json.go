@@ -0,0 +1,141 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"go.elastic.co/fastjson"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// StructFromJSON decodes a JSON object directly into a Struct, without
+// going through an intermediate map[string]interface{}.
+// Integers are stored as Int64 or Uint64 values when they fit, other
+// numbers as Float64 values. Integers beyond 64 bits and floats out of the
+// float64 range are stored as strings, so no precision is lost.
+func StructFromJSON(data []byte) (*messages.Struct, error) {
+	st := &messages.Struct{}
+	if err := st.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// valueFromJSON decodes a single JSON value.
+func valueFromJSON(data []byte) (*messages.Value, error) {
+	v := &messages.Value{}
+	if err := v.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// jsonNumberValue converts a JSON number like StructFromJSON does.
+func jsonNumberValue(n json.Number) (*messages.Value, error) {
+	// anything else than a number would decode to another kind
+	if n == "" || (n[0] != '-' && (n[0] < '0' || n[0] > '9')) {
+		return nil, fmt.Errorf("invalid JSON number %q", string(n))
+	}
+	v, err := valueFromJSON([]byte(n))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON number %q: %w", string(n), err)
+	}
+	return v, nil
+}
+
+// StructToJSON encodes the Struct as a JSON object, without going through
+// AsMap and encoding/json. Timestamps are encoded as RFC3339 strings,
+// bytes as base64 strings, and the floats with an integer value keep a
+// fraction so that StructFromJSON decodes them back as floats.
+func StructToJSON(st *messages.Struct) ([]byte, error) {
+	var w fastjson.Writer
+	if err := st.MarshalFastJSON(&w); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// jsonChunkSize is the size of the chunks written by WriteStructJSON.
+const jsonChunkSize = 32 << 10
+
+// WriteStructJSON encodes the Struct as a JSON object into out, like
+// StructToJSON. It is written in chunks as it is encoded, so the whole
+// document is not kept in memory.
+func WriteStructJSON(out io.Writer, st *messages.Struct) error {
+	s := &jsonStream{out: out}
+	if err := s.writeStruct(st); err != nil {
+		return err
+	}
+	return s.write()
+}
+
+// jsonStream encodes the containers itself, to write the chunks between
+// their values, and the other values with MarshalFastJSON.
+type jsonStream struct {
+	out io.Writer
+	w   fastjson.Writer
+}
+
+// write writes the encoded data to out.
+func (s *jsonStream) write() error {
+	if s.w.Size() == 0 {
+		return nil
+	}
+	_, err := s.out.Write(s.w.Bytes())
+	s.w.Reset()
+	return err
+}
+
+func (s *jsonStream) writeValue(v *messages.Value) error {
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_StructValue:
+		return s.writeStruct(kind.StructValue)
+	case *messages.Value_ListValue:
+		return s.writeList(kind.ListValue)
+	}
+	if err := v.MarshalFastJSON(&s.w); err != nil {
+		return err
+	}
+	if s.w.Size() >= jsonChunkSize {
+		return s.write()
+	}
+	return nil
+}
+
+func (s *jsonStream) writeStruct(st *messages.Struct) error {
+	s.w.RawByte('{')
+	first := true
+	for key, v := range st.GetData() {
+		if !first {
+			s.w.RawByte(',')
+		}
+		first = false
+		s.w.String(key)
+		s.w.RawByte(':')
+		if err := s.writeValue(v); err != nil {
+			return err
+		}
+	}
+	s.w.RawByte('}')
+	return nil
+}
+
+func (s *jsonStream) writeList(list *messages.ListValue) error {
+	s.w.RawByte('[')
+	for i, v := range list.GetValues() {
+		if i > 0 {
+			s.w.RawByte(',')
+		}
+		if err := s.writeValue(v); err != nil {
+			return err
+		}
+	}
+	s.w.RawByte(']')
+	return nil
+}
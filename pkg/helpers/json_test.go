@@ -0,0 +1,371 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestStructFromJSON(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		exp  *messages.Struct
+		err  bool
+	}{
+		{
+			name: "scalar types",
+			in:   `{"str": "test", "bool": true, "null": null, "int": -5, "float": 2.5, "exp": 1e3}`,
+			exp: &messages.Struct{Data: map[string]*messages.Value{
+				"str":   NewStringValue("test"),
+				"bool":  NewBoolValue(true),
+				"null":  NewNullValue(),
+				"int":   NewInt64Value(-5),
+				"float": NewFloat64Value(2.5),
+				"exp":   NewFloat64Value(1000),
+			}},
+		},
+		{
+			name: "large integers keep their precision",
+			in:   `{"max_int64": 9223372036854775807, "max_uint64": 18446744073709551615, "beyond": 18446744073709551616}`,
+			exp: &messages.Struct{Data: map[string]*messages.Value{
+				"max_int64":  NewInt64Value(9223372036854775807),
+				"max_uint64": NewUint64Value(18446744073709551615),
+				"beyond":     NewStringValue("18446744073709551616"),
+			}},
+		},
+		{
+			name: "nested objects and lists",
+			in:   `{"host": {"name": "host-1", "ip": ["10.0.0.1", "10.0.0.2"]}, "tags": [], "matrix": [[1], [{"a": 2}]]}`,
+			exp: &messages.Struct{Data: map[string]*messages.Value{
+				"host": NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+					"name": NewStringValue("host-1"),
+					"ip": NewListValue(&messages.ListValue{Values: []*messages.Value{
+						NewStringValue("10.0.0.1"),
+						NewStringValue("10.0.0.2"),
+					}}),
+				}}),
+				"tags": NewListValue(&messages.ListValue{}),
+				"matrix": NewListValue(&messages.ListValue{Values: []*messages.Value{
+					NewListValue(&messages.ListValue{Values: []*messages.Value{NewInt64Value(1)}}),
+					NewListValue(&messages.ListValue{Values: []*messages.Value{
+						NewStructValue(&messages.Struct{Data: map[string]*messages.Value{"a": NewInt64Value(2)}}),
+					}}),
+				}}),
+			}},
+		},
+		{
+			name: "not an object",
+			in:   `["test"]`,
+			err:  true,
+		},
+		{
+			name: "trailing data",
+			in:   `{"a": 1} {"b": 2}`,
+			err:  true,
+		},
+		{
+			name: "invalid JSON",
+			in:   `{"a": }`,
+			err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := StructFromJSON([]byte(c.in))
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.exp, res)
+		})
+	}
+}
+
+var structResult *messages.Struct
+
+func BenchmarkStructFromJSON(b *testing.B) {
+	in := []byte(`{"message": "GET /index.html HTTP/1.1 200 512", "log": {"level": "info", "file": {"path": "/var/log/nginx/access.log", "offset": 23456}}, "http": {"response": {"status_code": 200, "bytes": 512}}, "tags": ["nginx", "access"]}`)
+
+	b.Run("direct decoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			st, err := StructFromJSON(in)
+			if err != nil {
+				b.Fatal(err)
+			}
+			structResult = st
+		}
+	})
+	b.Run("through a map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m := map[string]interface{}{}
+			if err := json.Unmarshal(in, &m); err != nil {
+				b.Fatal(err)
+			}
+			st, err := NewStruct(m)
+			if err != nil {
+				b.Fatal(err)
+			}
+			structResult = st
+		}
+	})
+}
+
+func TestStructToJSON(t *testing.T) {
+	ts := time.Date(2022, 6, 1, 12, 30, 0, 500, time.UTC)
+	cases := []struct {
+		name string
+		in   *messages.Struct
+		exp  string
+	}{
+		{
+			name: "nil struct",
+			in:   nil,
+			exp:  `{}`,
+		},
+		{
+			name: "keys are escaped",
+			in: &messages.Struct{Data: map[string]*messages.Value{
+				`quoted "key"`: NewStringValue(`quoted "value"`),
+			}},
+			exp: `{"quoted \"key\"":"quoted \"value\""}`,
+		},
+		{
+			name: "nested values",
+			in: &messages.Struct{Data: map[string]*messages.Value{
+				"event": NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+					"created": NewTimestampValue(ts),
+					"tags":    NewListValue(&messages.ListValue{}),
+					"codes":   NewListValue(&messages.ListValue{Values: []*messages.Value{NewInt64Value(1), NewUint64Value(math.MaxUint64)}}),
+					"empty":   NewStructValue(&messages.Struct{}),
+					"null":    NewNullValue(),
+				}}),
+			}},
+			exp: `{"event":{"created":"2022-06-01T12:30:00.0000005Z","tags":[],"codes":[1,18446744073709551615],"empty":{},"null":null}}`,
+		},
+		{
+			name: "non-finite floats",
+			in: &messages.Struct{Data: map[string]*messages.Value{
+				"nan":  NewFloat64Value(math.NaN()),
+				"inf":  NewFloat32Value(float32(math.Inf(1))),
+				"-inf": NewFloat64Value(math.Inf(-1)),
+			}},
+			exp: `{"nan":"NaN","inf":"Infinity","-inf":"-Infinity"}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := StructToJSON(c.in)
+			require.NoError(t, err)
+			require.JSONEq(t, c.exp, string(res))
+
+			var buf bytes.Buffer
+			require.NoError(t, WriteStructJSON(&buf, c.in))
+			require.JSONEq(t, c.exp, buf.String())
+		})
+	}
+}
+
+// chunkWriter records the size of the writes, failing after failAfter of
+// them if it's positive.
+type chunkWriter struct {
+	buf       bytes.Buffer
+	writes    []int
+	failAfter int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	if w.failAfter > 0 && len(w.writes) == w.failAfter {
+		return 0, errors.New("disk full")
+	}
+	w.writes = append(w.writes, len(p))
+	return w.buf.Write(p)
+}
+
+func TestWriteStructJSONChunks(t *testing.T) {
+	data := map[string]interface{}{}
+	for i := 0; i < 2000; i++ {
+		data[fmt.Sprintf("field%d", i)] = map[string]interface{}{
+			"tags": []interface{}{strings.Repeat("a", 100), int64(i)},
+		}
+	}
+	st, err := NewStruct(data)
+	require.NoError(t, err)
+	expected, err := StructToJSON(st)
+	require.NoError(t, err)
+
+	var w chunkWriter
+	require.NoError(t, WriteStructJSON(&w, st))
+	require.JSONEq(t, string(expected), w.buf.String())
+	require.Greater(t, len(w.writes), 1)
+	for _, n := range w.writes {
+		require.Less(t, n, jsonChunkSize+1024)
+	}
+
+	w = chunkWriter{failAfter: 2}
+	require.EqualError(t, WriteStructJSON(&w, st), "disk full")
+	require.Len(t, w.writes, 2, "the encoding stops at the first error")
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	st, err := NewStruct(map[string]interface{}{
+		"count": int64(-3),
+		"ratio": 1.0,
+		"zero":  math.Copysign(0, -1),
+		"big":   1e21,
+	})
+	require.NoError(t, err)
+
+	data, err := StructToJSON(st)
+	require.NoError(t, err)
+	decoded, err := StructFromJSON(data)
+	require.NoError(t, err)
+	require.True(t, StructEqual(st, decoded), string(data))
+}
+
+var jsonResult []byte
+
+func BenchmarkStructToJSON(b *testing.B) {
+	st, err := StructFromJSON([]byte(`{"message": "GET /index.html HTTP/1.1 200 512", "log": {"level": "info", "file": {"path": "/var/log/nginx/access.log", "offset": 23456}}, "http": {"response": {"status_code": 200, "bytes": 512}}, "tags": ["nginx", "access"]}`))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("direct encoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			out, err := StructToJSON(st)
+			if err != nil {
+				b.Fatal(err)
+			}
+			jsonResult = out
+		}
+	})
+	b.Run("through a map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			out, err := json.Marshal(AsMap(st))
+			if err != nil {
+				b.Fatal(err)
+			}
+			jsonResult = out
+		}
+	})
+}
+
+func TestNewValueJSONTypes(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+		exp  interface{}
+		err  bool
+	}{
+		{name: "integer", in: json.Number("-42"), exp: int64(-42)},
+		{name: "uint64", in: json.Number("18446744073709551615"), exp: uint64(math.MaxUint64)},
+		{name: "float", in: json.Number("1.5e3"), exp: 1500.0},
+		{name: "big integer", in: json.Number("123456789012345678901234567890"), exp: "123456789012345678901234567890"},
+		{name: "beyond uint64", in: json.Number("18446744073709551616"), exp: "18446744073709551616"},
+		{name: "float out of range", in: json.Number("1e400"), exp: "1e400"},
+		{name: "invalid number", in: json.Number("12a"), err: true},
+		{name: "not a number", in: json.Number("true"), err: true},
+		{
+			name: "raw object",
+			in:   json.RawMessage(`{"a":[1,2.5,"x",null]}`),
+			exp:  map[string]interface{}{"a": []interface{}{int64(1), 2.5, "x", nil}},
+		},
+		{name: "raw string", in: json.RawMessage(`"hello"`), exp: "hello"},
+		{name: "raw beyond uint64", in: json.RawMessage(`18446744073709551616`), exp: "18446744073709551616"},
+		{name: "empty raw", in: json.RawMessage(nil), exp: nil},
+		{name: "invalid raw", in: json.RawMessage(`{"a":`), err: true},
+		{
+			name: "decoded with UseNumber",
+			in: func() interface{} {
+				dec := json.NewDecoder(bytes.NewReader([]byte(`{"n":9007199254740993,"raw":{"b":true}}`)))
+				dec.UseNumber()
+				var v struct {
+					N   json.Number
+					Raw json.RawMessage
+				}
+				require.NoError(t, dec.Decode(&v))
+				return v
+			}(),
+			exp: map[string]interface{}{"N": int64(9007199254740993), "Raw": map[string]interface{}{"b": true}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := NewValue(c.in)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.exp, AsInterface(v))
+		})
+	}
+}
+
+func TestEncodingJSON(t *testing.T) {
+	ts := time.Date(2022, 8, 1, 12, 30, 0, 0, time.UTC)
+	st := &messages.Struct{Data: map[string]*messages.Value{
+		"message":    NewStringValue("hello"),
+		"count":      NewInt64Value(3),
+		"@timestamp": NewTimestampValue(ts),
+		"tags":       NewListValue(&messages.ListValue{Values: []*messages.Value{NewStringValue("a"), NewNullValue()}}),
+	}}
+
+	// the types are usable as fields of Go structs
+	doc := struct {
+		Fields *messages.Struct    `json:"fields"`
+		Tags   *messages.ListValue `json:"tags"`
+		Value  *messages.Value     `json:"value"`
+	}{Fields: st, Tags: st.Data["tags"].GetListValue(), Value: NewFloat64Value(2.5)}
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"fields": {"message": "hello", "count": 3, "@timestamp": "2022-08-01T12:30:00Z", "tags": ["a", null]},
+		"tags": ["a", null],
+		"value": 2.5
+	}`, string(data))
+
+	require.NoError(t, json.Unmarshal(data, &doc))
+	require.Equal(t, "2022-08-01T12:30:00Z", doc.Fields.Data["@timestamp"].GetStringValue())
+	require.True(t, Equal(NewInt64Value(3), doc.Fields.Data["count"]))
+	require.Len(t, doc.Tags.GetValues(), 2)
+	require.Equal(t, 2.5, doc.Value.GetFloat64Value())
+
+	var v messages.Value
+	require.NoError(t, json.Unmarshal([]byte(`18446744073709551616`), &v))
+	require.Equal(t, "18446744073709551616", v.GetStringValue())
+
+	require.Error(t, json.Unmarshal([]byte(`[1]`), &messages.Struct{}))
+	require.Error(t, json.Unmarshal([]byte(`{}`), &messages.ListValue{}))
+	require.Error(t, (&messages.Value{}).UnmarshalJSON([]byte(`1 2`)))
+}
+
+func TestNewValueMessages(t *testing.T) {
+	st := &messages.Struct{Data: map[string]*messages.Value{"ts": NewTimestampValue(time.Unix(1, 0))}}
+	v, err := NewValue(map[string]interface{}{"st": st, "nil": (*messages.Value)(nil)})
+	require.NoError(t, err)
+	// used as they are, not through MarshalJSON
+	require.Same(t, st, v.GetStructValue().GetData()["st"].GetStructValue())
+	require.NotNil(t, v.GetStructValue().GetData()["nil"].GetKind())
+}
@@ -0,0 +1,230 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.elastic.co/fastjson"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// LazyStruct is a JSON object whose fields are only converted to Values
+// when they are accessed or modified, the untouched fields are kept as raw
+// JSON and written back as they are. It avoids the cost of the conversion
+// for pass-through events, of which few fields are looked at.
+//
+// The fields are addressed with dotted paths like GetField, accessing a
+// path converts the whole top-level field it starts with. It is not safe
+// for concurrent use, even for reading.
+type LazyStruct struct {
+	raw    map[string]json.RawMessage
+	fields *messages.Struct
+}
+
+// NewLazyStruct indexes the top-level fields of the JSON object, it fails
+// if data is not a valid JSON object.
+// The raw fields share the memory of data, which must not be modified.
+func NewLazyStruct(data []byte) (*LazyStruct, error) {
+	if !json.Valid(data) {
+		return nil, errors.New("failed to index JSON object: invalid JSON")
+	}
+	raw, err := indexJSONObject(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to index JSON object: %w", err)
+	}
+	return &LazyStruct{raw: raw, fields: &messages.Struct{Data: map[string]*messages.Value{}}}, nil
+}
+
+// Len returns the number of top-level fields.
+func (l *LazyStruct) Len() int {
+	return len(l.raw) + len(l.fields.Data)
+}
+
+// Keys returns the sorted top-level keys.
+func (l *LazyStruct) Keys() []string {
+	keys := make([]string, 0, l.Len())
+	for k := range l.raw {
+		keys = append(keys, k)
+	}
+	for k := range l.fields.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetField returns the value at the dotted path.
+func (l *LazyStruct) GetField(key string) (*messages.Value, error) {
+	if err := l.materialize(key); err != nil {
+		return nil, err
+	}
+	return GetField(l.fields, key)
+}
+
+// PutField sets the value at the dotted path like PutField.
+func (l *LazyStruct) PutField(key string, v *messages.Value) (*messages.Value, error) {
+	if err := l.materialize(key); err != nil {
+		return nil, err
+	}
+	return PutField(l.fields, key, v)
+}
+
+// DeleteField removes the value at the dotted path. Deleting a top-level
+// field doesn't convert it.
+func (l *LazyStruct) DeleteField(key string) error {
+	if _, ok := l.raw[key]; ok {
+		delete(l.raw, key)
+		return nil
+	}
+	if err := l.materialize(key); err != nil {
+		return err
+	}
+	return DeleteField(l.fields, key)
+}
+
+// Struct converts the remaining raw fields and returns the Struct holding
+// all of them, which is shared with the LazyStruct.
+func (l *LazyStruct) Struct() (*messages.Struct, error) {
+	for k := range l.raw {
+		if err := l.materialize(k); err != nil {
+			return nil, err
+		}
+	}
+	return l.fields, nil
+}
+
+// MarshalFastJSON writes the object with sorted keys, the raw fields are
+// written as they were read.
+func (l *LazyStruct) MarshalFastJSON(w *fastjson.Writer) error {
+	w.RawByte('{')
+	for i, k := range l.Keys() {
+		if i > 0 {
+			w.RawByte(',')
+		}
+		w.String(k)
+		w.RawByte(':')
+		if raw, ok := l.raw[k]; ok {
+			w.RawBytes(raw)
+			continue
+		}
+		if err := l.fields.Data[k].MarshalFastJSON(w); err != nil {
+			return err
+		}
+	}
+	w.RawByte('}')
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (l *LazyStruct) MarshalJSON() ([]byte, error) {
+	var w fastjson.Writer
+	if err := l.MarshalFastJSON(&w); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// indexJSONObject returns the raw values of the top-level fields of data,
+// which must be valid JSON. The later of duplicate keys wins, like with
+// encoding/json.
+func indexJSONObject(data []byte) (map[string]json.RawMessage, error) {
+	i := skipJSONSpace(data, 0)
+	if data[i] != '{' {
+		return nil, fmt.Errorf("expected an object, got %q", data[i])
+	}
+	raw := map[string]json.RawMessage{}
+	i = skipJSONSpace(data, i+1)
+	for data[i] != '}' {
+		end := skipJSONValue(data, i)
+		var key string
+		if bytes.IndexByte(data[i:end], '\\') < 0 {
+			key = string(data[i+1 : end-1])
+		} else if err := json.Unmarshal(data[i:end], &key); err != nil {
+			return nil, err
+		}
+		// skip the colon
+		i = skipJSONSpace(data, skipJSONSpace(data, end)+1)
+		end = skipJSONValue(data, i)
+		raw[key] = data[i:end:end]
+		i = skipJSONSpace(data, end)
+		if data[i] == ',' {
+			i = skipJSONSpace(data, i+1)
+		}
+	}
+	return raw, nil
+}
+
+func skipJSONSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// skipJSONValue returns the end of the valid JSON value starting at i.
+func skipJSONValue(data []byte, i int) int {
+	depth := 0
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case '"':
+			i = skipJSONString(data, i)
+			if depth == 0 {
+				return i
+			}
+			i--
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+			if depth < 0 {
+				return i
+			}
+		case ',', ' ', '\t', '\n', '\r':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// skipJSONString returns the end of the string starting at i.
+func skipJSONString(data []byte, i int) int {
+	for i++; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return i
+}
+
+// materialize converts the top-level field the dotted path starts with.
+func (l *LazyStruct) materialize(key string) error {
+	top, _, _ := strings.Cut(key, ".")
+	raw, ok := l.raw[top]
+	if !ok {
+		return nil
+	}
+	v, err := valueFromJSON(raw)
+	if err != nil {
+		return fmt.Errorf("failed to convert field %s: %w", top, err)
+	}
+	l.fields.Data[top] = v
+	delete(l.raw, top)
+	return nil
+}
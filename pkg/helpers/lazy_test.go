@@ -0,0 +1,101 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+const lazyTestJSON = `{"message":"GET /index.html","http":{"response":{"status_code":200}},"ratio":1.0,"tags":["a", "b"],"big":123456789012345678901234567890}`
+
+func TestLazyStruct(t *testing.T) {
+	l, err := NewLazyStruct([]byte(lazyTestJSON))
+	require.NoError(t, err)
+	require.Equal(t, 5, l.Len())
+	require.Equal(t, []string{"big", "http", "message", "ratio", "tags"}, l.Keys())
+
+	v, err := l.GetField("http.response.status_code")
+	require.NoError(t, err)
+	require.Equal(t, int64(200), v.GetInt64Value())
+	_, err = l.GetField("http.request")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = l.GetField("missing")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+
+	_, err = l.PutField("http.request.method", NewStringValue("GET"))
+	require.NoError(t, err)
+	_, err = l.PutField("host.name", NewStringValue("web-1"))
+	require.NoError(t, err)
+	require.NoError(t, l.DeleteField("message"))
+	require.ErrorIs(t, l.DeleteField("message"), ErrKeyNotFound)
+	require.NoError(t, l.DeleteField("http.response"))
+
+	// the untouched fields are written as they were read
+	data, err := l.MarshalJSON()
+	require.NoError(t, err)
+	require.Equal(t, `{"big":123456789012345678901234567890,"host":{"name":"web-1"},"http":{"request":{"method":"GET"}},"ratio":1.0,"tags":["a", "b"]}`, string(data))
+
+	// encoding/json compacts the output
+	data, err = json.Marshal(l)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"tags":["a","b"]`)
+
+	st, err := l.Struct()
+	require.NoError(t, err)
+	expected, err := StructFromJSON(data)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(expected, st))
+	require.Equal(t, 5, l.Len())
+}
+
+func TestLazyStructInvalid(t *testing.T) {
+	for _, data := range []string{``, `null`, `[]`, `"a"`, `{"a":`, `{"a":1}x`} {
+		_, err := NewLazyStruct([]byte(data))
+		require.Error(t, err, data)
+	}
+}
+
+func BenchmarkLazyStruct(b *testing.B) {
+	data := []byte(`{"@timestamp":"2022-08-04T18:17:28Z","message":"10.0.0.1 - - GET /index.html HTTP/1.1 200 512",` +
+		`"host":{"name":"web-1","ip":["10.0.0.1","fe80::1"],"os":{"family":"debian","kernel":"5.15.0"}},` +
+		`"http":{"request":{"method":"GET"},"response":{"status_code":200,"body":{"bytes":512}}},` +
+		`"user_agent":{"original":"curl/7.79.1"},"tags":["nginx","access"]}`)
+
+	// pass-through: read one field and write the event back
+	b.Run("StructFromJSON", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			st, err := StructFromJSON(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := GetField(st, "host.name"); err != nil {
+				b.Fatal(err)
+			}
+			if marshalResult, err = StructToJSON(st); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("LazyStruct", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			l, err := NewLazyStruct(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := l.GetField("host.name"); err != nil {
+				b.Fatal(err)
+			}
+			if marshalResult, err = l.MarshalJSON(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
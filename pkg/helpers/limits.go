@@ -0,0 +1,159 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrLimitExceeded matches every LimitError with errors.Is.
+var ErrLimitExceeded = errors.New("conversion limit exceeded")
+
+// LimitKind identifies a conversion limit.
+type LimitKind int
+
+const (
+	// LimitDepth is the nesting depth of maps, lists and structs.
+	LimitDepth LimitKind = iota + 1
+	// LimitKeys is the total number of keys of all maps and structs.
+	LimitKeys
+	// LimitSize is the estimated serialized size in bytes.
+	LimitSize
+)
+
+func (k LimitKind) String() string {
+	switch k {
+	case LimitDepth:
+		return "depth"
+	case LimitKeys:
+		return "keys"
+	case LimitSize:
+		return "size"
+	}
+	return fmt.Sprintf("LimitKind(%d)", int(k))
+}
+
+// LimitError is returned when a conversion exceeds one of the limits set
+// with WithMaxDepth, WithMaxKeys or WithMaxSize.
+type LimitError struct {
+	Kind LimitKind
+	Max  int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s is limited to %d", ErrLimitExceeded, e.Kind, e.Max)
+}
+
+// Is makes LimitError match ErrLimitExceeded and ErrTooLarge.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded || target == ErrTooLarge
+}
+
+// WithMaxDepth limits how deep maps, lists and structs can be nested. A
+// flat map has a depth of 1, a map holding a flat map a depth of 2.
+func WithMaxDepth(depth int) Option {
+	return func(o *options) {
+		o.maxDepth = depth
+	}
+}
+
+// WithMaxKeys limits the total number of keys of all maps and structs.
+func WithMaxKeys(keys int) Option {
+	return func(o *options) {
+		o.maxKeys = keys
+	}
+}
+
+// WithMaxSize limits the serialized size of the result. The size is
+// estimated while converting, so the conversion stops before allocating a
+// too large value: it's the length of all the keys and strings, plus a
+// couple of bytes for every value.
+func WithMaxSize(bytes int) Option {
+	return func(o *options) {
+		o.maxSize = bytes
+	}
+}
+
+// valueOverhead approximates the protobuf tag and length of a value.
+const valueOverhead = 2
+
+// enter tracks the nesting of containers, see convState.enter.
+func (c *converter) enter(s *convState, container interface{}) error {
+	if err := s.enter(container); err != nil {
+		return err
+	}
+	if c.maxDepth > 0 && s.depth > c.maxDepth {
+		return &LimitError{Kind: LimitDepth, Max: c.maxDepth}
+	}
+	return nil
+}
+
+// addKey counts a key of a map or struct.
+func (c *converter) addKey(s *convState, key string) error {
+	if c.maxKeys > 0 {
+		s.keys++
+		if s.keys > c.maxKeys {
+			return &LimitError{Kind: LimitKeys, Max: c.maxKeys}
+		}
+	}
+	return c.addSize(s, len(key)+valueOverhead)
+}
+
+// addSize adds n bytes to the estimated size.
+func (c *converter) addSize(s *convState, n int) error {
+	if c.maxSize > 0 {
+		s.size += n
+		if s.size > c.maxSize {
+			return &LimitError{Kind: LimitSize, Max: c.maxSize}
+		}
+	}
+	return nil
+}
+
+// checkDecoded applies the depth and keys limits to a value decoded in one
+// go, like the JSON of json.RawMessage and json.Marshaler values. Its size
+// is already counted from the encoded length.
+func (c *converter) checkDecoded(s *convState, v *messages.Value) error {
+	if c.maxDepth <= 0 && c.maxKeys <= 0 {
+		return nil
+	}
+	return c.checkNested(s, v, s.depth)
+}
+
+func (c *converter) checkNested(s *convState, v *messages.Value, depth int) error {
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_StructValue:
+		depth++
+		if c.maxDepth > 0 && depth > c.maxDepth {
+			return &LimitError{Kind: LimitDepth, Max: c.maxDepth}
+		}
+		data := kind.StructValue.GetData()
+		if c.maxKeys > 0 {
+			s.keys += len(data)
+			if s.keys > c.maxKeys {
+				return &LimitError{Kind: LimitKeys, Max: c.maxKeys}
+			}
+		}
+		for _, fv := range data {
+			if err := c.checkNested(s, fv, depth); err != nil {
+				return err
+			}
+		}
+	case *messages.Value_ListValue:
+		depth++
+		if c.maxDepth > 0 && depth > c.maxDepth {
+			return &LimitError{Kind: LimitDepth, Max: c.maxDepth}
+		}
+		for _, lv := range kind.ListValue.GetValues() {
+			if err := c.checkNested(s, lv, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
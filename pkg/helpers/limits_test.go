@@ -0,0 +1,102 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversionLimits(t *testing.T) {
+	type labels struct {
+		Env, Team string
+	}
+	in := map[string]interface{}{
+		"message": strings.Repeat("a", 100),
+		"host":    map[string]interface{}{"os": map[string]string{"name": "linux"}},
+		"labels":  labels{Env: "prod", Team: "obs"},
+		"tags":    []string{"a", "b"},
+	}
+
+	cases := []struct {
+		name string
+		opts []Option
+		kind LimitKind
+	}{
+		{name: "no limits"},
+		{name: "depth within", opts: []Option{WithMaxDepth(3)}},
+		{name: "depth", opts: []Option{WithMaxDepth(2)}, kind: LimitDepth},
+		{name: "keys within", opts: []Option{WithMaxKeys(8)}},
+		{name: "keys", opts: []Option{WithMaxKeys(7)}, kind: LimitKeys},
+		{name: "size within", opts: []Option{WithMaxSize(1000)}},
+		{name: "size", opts: []Option{WithMaxSize(100)}, kind: LimitSize},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewStructWithOptions(in, c.opts...)
+			if c.kind == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrLimitExceeded)
+			require.ErrorIs(t, err, ErrTooLarge)
+			var limitErr *LimitError
+			require.True(t, errors.As(err, &limitErr))
+			require.Equal(t, c.kind, limitErr.Kind)
+		})
+	}
+}
+
+func TestMaxDepthNewValue(t *testing.T) {
+	flat := map[string]interface{}{"a": 1}
+	_, err := NewValueWithOptions(flat, WithMaxDepth(1))
+	require.NoError(t, err)
+	_, err = NewValueWithOptions([]interface{}{flat}, WithMaxDepth(1))
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	_, err = NewStructWithOptions(flat, WithMaxDepth(1))
+	require.NoError(t, err)
+}
+
+func TestLimitsDecodedJSON(t *testing.T) {
+	in := map[string]interface{}{
+		"raw":   json.RawMessage(`{"a": {"b": [1, {"c": 2}]}}`),
+		"point": &testPoint{X: 1, Y: 2},
+	}
+
+	cases := []struct {
+		name string
+		opts []Option
+		kind LimitKind
+	}{
+		{name: "depth within", opts: []Option{WithMaxDepth(5)}},
+		{name: "depth", opts: []Option{WithMaxDepth(4)}, kind: LimitDepth},
+		{name: "keys within", opts: []Option{WithMaxKeys(6)}},
+		{name: "keys", opts: []Option{WithMaxKeys(5)}, kind: LimitKeys},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewStructWithOptions(in, c.opts...)
+			if c.kind == 0 {
+				require.NoError(t, err)
+				return
+			}
+			var limitErr *LimitError
+			require.ErrorAs(t, err, &limitErr)
+			require.Equal(t, c.kind, limitErr.Kind)
+		})
+	}
+
+	// the depth of a marshaler counts from where it is
+	_, err := NewValueWithOptions([]interface{}{&testPoint{X: 1, Y: 2}}, WithMaxDepth(2))
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	_, err = NewValueWithOptions([]interface{}{&testPoint{X: 1, Y: 2}}, WithMaxDepth(3))
+	require.NoError(t, err)
+}
@@ -0,0 +1,123 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrMergeConflict is returned by MergeStructs with MergeError when both
+// structs set a field to different values.
+var ErrMergeConflict = errors.New("conflicting values")
+
+// MergeConflict selects how MergeStructs resolves a field set in both
+// structs, when the values aren't both structs.
+type MergeConflict int
+
+const (
+	// MergeOverwrite uses the value of src, this is the default.
+	MergeOverwrite MergeConflict = iota
+	// MergeKeep keeps the value of dst.
+	MergeKeep
+	// MergeError fails the merge, unless both values are equal.
+	MergeError
+)
+
+// MergeOption configures MergeStructs.
+type MergeOption func(*mergeOptions)
+
+type mergeOptions struct {
+	conflict    MergeConflict
+	appendLists bool
+}
+
+// WithMergeConflict sets how conflicting fields are resolved.
+func WithMergeConflict(mode MergeConflict) MergeOption {
+	return func(o *mergeOptions) {
+		o.conflict = mode
+	}
+}
+
+// WithAppendLists appends the values of lists set in both structs, instead
+// of resolving them as a conflict.
+func WithAppendLists() MergeOption {
+	return func(o *mergeOptions) {
+		o.appendLists = true
+	}
+}
+
+// MergeStructs deep-merges src into dst: nested structs are merged field by
+// field, other values of src are copied into dst. src is not modified and
+// dst doesn't share any value with it afterwards. When an error is returned
+// dst is left unchanged.
+func MergeStructs(dst, src *messages.Struct, opts ...MergeOption) error {
+	if dst == nil {
+		return errors.New("can't merge into a nil struct")
+	}
+	var o mergeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.conflict == MergeError {
+		if err := o.checkConflicts("", dst, src); err != nil {
+			return err
+		}
+	}
+	o.merge(dst, src)
+	return nil
+}
+
+func (o *mergeOptions) merge(dst, src *messages.Struct) {
+	for key, sv := range src.GetData() {
+		if dst.Data == nil {
+			dst.Data = map[string]*messages.Value{}
+		}
+		dv, exists := dst.Data[key]
+		if !exists {
+			dst.Data[key] = CloneValue(sv)
+			continue
+		}
+		if ds, ss := dv.GetStructValue(), sv.GetStructValue(); ds != nil && ss != nil {
+			o.merge(ds, ss)
+			continue
+		}
+		if dl, sl := dv.GetListValue(), sv.GetListValue(); o.appendLists && dl != nil && sl != nil {
+			for _, v := range sl.GetValues() {
+				dl.Values = append(dl.Values, CloneValue(v))
+			}
+			continue
+		}
+		if o.conflict == MergeOverwrite {
+			dst.Data[key] = CloneValue(sv)
+		}
+	}
+}
+
+func (o *mergeOptions) checkConflicts(prefix string, dst, src *messages.Struct) error {
+	for key, sv := range src.GetData() {
+		dv, exists := dst.GetData()[key]
+		if !exists {
+			continue
+		}
+		if ds, ss := dv.GetStructValue(), sv.GetStructValue(); ds != nil && ss != nil {
+			if err := o.checkConflicts(prefix+key+".", ds, ss); err != nil {
+				return err
+			}
+			continue
+		}
+		if o.appendLists && dv.GetListValue() != nil && sv.GetListValue() != nil {
+			continue
+		}
+		if !proto.Equal(dv, sv) {
+			return fmt.Errorf("%w for field %s", ErrMergeConflict, prefix+key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeStructs(t *testing.T) {
+	dst := map[string]interface{}{
+		"message": "dst",
+		"tags":    []interface{}{"a"},
+		"host":    map[string]interface{}{"name": "web-1", "os": map[string]interface{}{"name": "linux"}},
+	}
+	src := map[string]interface{}{
+		"message": "src",
+		"tags":    []interface{}{"b"},
+		"host":    map[string]interface{}{"ip": "10.0.0.1", "os": map[string]interface{}{"name": "linux"}},
+		"level":   "info",
+	}
+
+	cases := []struct {
+		name string
+		opts []MergeOption
+		exp  map[string]interface{}
+		err  error
+	}{
+		{
+			name: "overwrite",
+			exp: map[string]interface{}{
+				"message": "src",
+				"tags":    []interface{}{"b"},
+				"host":    map[string]interface{}{"name": "web-1", "ip": "10.0.0.1", "os": map[string]interface{}{"name": "linux"}},
+				"level":   "info",
+			},
+		},
+		{
+			name: "keep and append lists",
+			opts: []MergeOption{WithMergeConflict(MergeKeep), WithAppendLists()},
+			exp: map[string]interface{}{
+				"message": "dst",
+				"tags":    []interface{}{"a", "b"},
+				"host":    map[string]interface{}{"name": "web-1", "ip": "10.0.0.1", "os": map[string]interface{}{"name": "linux"}},
+				"level":   "info",
+			},
+		},
+		{
+			name: "error",
+			opts: []MergeOption{WithMergeConflict(MergeError), WithAppendLists()},
+			exp:  dst,
+			err:  ErrMergeConflict,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dstStruct, err := NewStruct(dst)
+			require.NoError(t, err)
+			srcStruct, err := NewStruct(src)
+			require.NoError(t, err)
+
+			err = MergeStructs(dstStruct, srcStruct, c.opts...)
+			require.ErrorIs(t, err, c.err)
+			require.Equal(t, c.exp, AsMap(dstStruct))
+			require.Equal(t, src, AsMap(srcStruct))
+		})
+	}
+}
+
+func TestMergeStructsErrorEqualValues(t *testing.T) {
+	dst, err := NewStruct(map[string]interface{}{"host": map[string]interface{}{"name": "web-1"}})
+	require.NoError(t, err)
+	src, err := NewStruct(map[string]interface{}{"host": map[string]interface{}{"name": "web-1", "id": "1"}})
+	require.NoError(t, err)
+
+	require.NoError(t, MergeStructs(dst, src, WithMergeConflict(MergeError)))
+	require.Equal(t, AsMap(src), AsMap(dst))
+
+	// dst doesn't share values with src
+	src.Data["host"].GetStructValue().Data["id"] = NewStringValue("2")
+	require.Equal(t, "1", AsMap(dst)["host"].(map[string]interface{})["id"])
+}
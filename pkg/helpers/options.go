@@ -0,0 +1,264 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Option configures the conversion done by NewValueWithOptions and
+// NewStructWithOptions.
+type Option func(*options)
+
+type options struct {
+	// tagName is the struct tag used for field names, struct tags are
+	// ignored when empty.
+	tagName string
+	// mapKeys selects the handling of non-string map keys.
+	mapKeys MapKeyMode
+	// limits, disabled when zero
+	maxDepth int
+	maxKeys  int
+	maxSize  int
+	// pool allocates the values when set
+	pool *ValuePool
+	// converters are consulted first when set
+	converters *ConverterRegistry
+	// durations selects the representation of time.Duration
+	durations DurationFormat
+	// wrapBytes converts byte slices to structs, see WithBytesWrapper
+	wrapBytes bool
+	// bytesKind converts byte slices to bytes values, see WithBytesKind
+	bytesKind bool
+	// unsafeStrings shares the memory of byte slices, see WithUnsafeStrings
+	unsafeStrings bool
+}
+
+// MapKeyMode selects how maps with non-string keys are converted.
+type MapKeyMode int
+
+const (
+	// MapKeysError fails the conversion, this is the default.
+	MapKeysError MapKeyMode = iota
+	// MapKeysFormat formats the keys with fmt.Sprint.
+	MapKeysFormat
+	// MapKeysSkip leaves the maps out: they are omitted from their parent
+	// map, struct or list, and converted to a null Value at the top level.
+	MapKeysSkip
+)
+
+// WithMapKeys selects how maps with non-string keys, like map[int]string,
+// are converted.
+func WithMapKeys(mode MapKeyMode) Option {
+	return func(o *options) {
+		o.mapKeys = mode
+	}
+}
+
+// DurationFormat selects how time.Duration values are converted.
+type DurationFormat int
+
+const (
+	// DurationNanoseconds converts durations to an integer number of
+	// nanoseconds, this is the default.
+	DurationNanoseconds DurationFormat = iota
+	// DurationMilliseconds converts durations to a float number of
+	// milliseconds, like the event.duration of ECS is often displayed.
+	DurationMilliseconds
+	// DurationString converts durations to their String form, like "1.5s".
+	DurationString
+)
+
+// WithDurationFormat selects how time.Duration values are converted.
+func WithDurationFormat(format DurationFormat) Option {
+	return func(o *options) {
+		o.durations = format
+	}
+}
+
+// durationValue converts d according to the duration format.
+func (c *converter) durationValue(d time.Duration, s *convState) (*messages.Value, error) {
+	switch c.durations {
+	case DurationMilliseconds:
+		return c.float64Value(float64(d) / float64(time.Millisecond)), nil
+	case DurationString:
+		str := d.String()
+		if err := c.addSize(s, len(str)); err != nil {
+			return nil, err
+		}
+		return c.stringValue(str), nil
+	}
+	return c.int64Value(int64(d)), nil
+}
+
+// errSkip is returned by converter.newValue for values left out of the
+// conversion, it never reaches the callers of the package.
+var errSkip = errors.New("skipped value")
+
+// WithStructTags makes the conversion of Go structs honor the given struct
+// tag, using the same rules as encoding/json: the tag sets the field name,
+// "-" skips the field, "omitempty" skips empty values and embedded structs
+// without a name are flattened into their parent.
+func WithStructTags(tagName string) Option {
+	return func(o *options) {
+		o.tagName = tagName
+	}
+}
+
+// WithJSONTags is WithStructTags("json").
+func WithJSONTags() Option {
+	return WithStructTags("json")
+}
+
+// NewValueWithOptions constructs a Value like NewValue, using the given options.
+func NewValueWithOptions(v interface{}, opts ...Option) (*messages.Value, error) {
+	var s convState
+	value, err := newConverter(opts).newValue(v, &s)
+	if errors.Is(err, errSkip) {
+		return NewNullValue(), nil
+	}
+	return value, err
+}
+
+// NewStructWithOptions constructs a Struct like NewStruct, using the given options.
+func NewStructWithOptions(v map[string]interface{}, opts ...Option) (*messages.Struct, error) {
+	s := convState{depth: 1}
+	return newConverter(opts).newStruct(v, &s)
+}
+
+// converter holds the options of a single conversion.
+type converter struct {
+	options
+	// arena allocates the values of a Converter, instead of the pool
+	arena *arena
+}
+
+// defaultConverter is shared by NewValue, NewStruct and NewList, so the
+// conversion without options doesn't allocate a converter on every call.
+var defaultConverter = &converter{}
+
+func newConverter(opts []Option) *converter {
+	c := &converter{}
+	for _, opt := range opts {
+		opt(&c.options)
+	}
+	return c
+}
+
+// structFields converts the exported fields of a Go struct.
+func (c *converter) structFields(rv reflect.Value, s *convState) (map[string]*messages.Value, error) {
+	fields := make(map[string]*messages.Value, rv.NumField())
+	if err := c.addStructFields(fields, rv, s); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func (c *converter) addStructFields(fields map[string]*messages.Value, rv reflect.Value, s *convState) error {
+	rt := rv.Type()
+	var embedded []reflect.Value
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		fv := rv.Field(i)
+
+		name, omitEmpty, skip := c.fieldName(field)
+		if skip {
+			continue
+		}
+		if c.tagName != "" && field.Anonymous && name == "" {
+			// flattened after the fields of the parent, which take precedence
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				embedded = append(embedded, fv)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+
+		if err := c.addKey(s, name); err != nil {
+			return err
+		}
+		v, err := c.newValue(fv.Interface(), s)
+		if errors.Is(err, errSkip) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fields[name] = v
+	}
+
+	for _, ev := range embedded {
+		flattened := map[string]*messages.Value{}
+		if err := c.addStructFields(flattened, ev, s); err != nil {
+			return err
+		}
+		for k, v := range flattened {
+			if _, exists := fields[k]; !exists {
+				fields[k] = v
+			}
+		}
+	}
+	return nil
+}
+
+// fieldName returns the name set in the struct tag, if any.
+func (c *converter) fieldName(field reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	if c.tagName == "" {
+		return "", false, false
+	}
+	tag, ok := field.Tag.Lookup(c.tagName)
+	if !ok {
+		return "", false, false
+	}
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return parts[0], omitEmpty, false
+}
+
+// isEmptyValue follows the omitempty semantics of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+type testCommon struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+}
+
+type testMeta struct {
+	Version int `yaml:"version" json:"version"`
+}
+
+type testTagged struct {
+	testCommon
+	*testMeta
+	Kind     string            `json:"kind"`
+	Name     string            `json:"name"`
+	Optional string            `json:"optional,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Ignored  string            `json:"-"`
+	Untagged bool
+	private  string
+}
+
+func TestWithStructTags(t *testing.T) {
+	in := testTagged{
+		testCommon: testCommon{ID: "1234", Kind: "shadowed"},
+		testMeta:   &testMeta{Version: 2},
+		Kind:       "log",
+		Name:       "test",
+		Ignored:    "ignored",
+		Untagged:   true,
+		private:    "private",
+	}
+
+	cases := []struct {
+		name string
+		opts []Option
+		in   interface{}
+		exp  *messages.Value
+	}{
+		{
+			name: "json tags",
+			opts: []Option{WithJSONTags()},
+			in:   in,
+			exp: NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+				"id":       NewStringValue("1234"),
+				"version":  NewInt64Value(2),
+				"kind":     NewStringValue("log"),
+				"name":     NewStringValue("test"),
+				"Untagged": NewBoolValue(true),
+			}}),
+		},
+		{
+			name: "custom tag name",
+			opts: []Option{WithStructTags("yaml")},
+			in:   testMeta{Version: 3},
+			exp: NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+				"version": NewInt64Value(3),
+			}}),
+		},
+		{
+			name: "nil embedded pointer",
+			opts: []Option{WithJSONTags()},
+			in:   testTagged{Name: "test", Labels: map[string]string{"env": "prod"}},
+			exp: NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+				"id":       NewStringValue(""),
+				"kind":     NewStringValue(""),
+				"name":     NewStringValue("test"),
+				"labels":   NewStructValue(&messages.Struct{Data: map[string]*messages.Value{"env": NewStringValue("prod")}}),
+				"Untagged": NewBoolValue(false),
+			}}),
+		},
+		{
+			name: "without options tags are ignored",
+			in:   testMeta{Version: 3},
+			exp: NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+				"Version": NewInt64Value(3),
+			}}),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := NewValueWithOptions(c.in, c.opts...)
+			require.NoError(t, err)
+			require.Equal(t, c.exp, res)
+		})
+	}
+}
+
+func TestNewStructWithOptions(t *testing.T) {
+	res, err := NewStructWithOptions(map[string]interface{}{
+		"meta": []interface{}{testMeta{Version: 1}},
+	}, WithJSONTags())
+	require.NoError(t, err)
+	require.Equal(t, &messages.Struct{Data: map[string]*messages.Value{
+		"meta": NewListValue(&messages.ListValue{Values: []*messages.Value{
+			NewStructValue(&messages.Struct{Data: map[string]*messages.Value{"version": NewInt64Value(1)}}),
+		}}),
+	}}, res)
+}
+
+func TestWithMapKeys(t *testing.T) {
+	in := map[string]interface{}{
+		"codes":  map[int]string{200: "OK"},
+		"list":   []interface{}{"a", map[bool]int{true: 1}},
+		"labels": map[string]string{"env": "prod"},
+	}
+
+	cases := []struct {
+		name string
+		opts []Option
+		exp  map[string]interface{}
+		err  bool
+	}{
+		{
+			name: "error by default",
+			err:  true,
+		},
+		{
+			name: "format",
+			opts: []Option{WithMapKeys(MapKeysFormat)},
+			exp: map[string]interface{}{
+				"codes":  map[string]interface{}{"200": "OK"},
+				"list":   []interface{}{"a", map[string]interface{}{"true": int64(1)}},
+				"labels": map[string]interface{}{"env": "prod"},
+			},
+		},
+		{
+			name: "skip",
+			opts: []Option{WithMapKeys(MapKeysSkip)},
+			exp: map[string]interface{}{
+				"list":   []interface{}{"a"},
+				"labels": map[string]interface{}{"env": "prod"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := NewStructWithOptions(in, c.opts...)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.exp, AsMap(res))
+		})
+	}
+
+	v, err := NewValueWithOptions(map[int]int{1: 1}, WithMapKeys(MapKeysSkip))
+	require.NoError(t, err)
+	require.Equal(t, NewNullValue(), v)
+}
+
+func TestWithDurationFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		format   DurationFormat
+		expected interface{}
+	}{
+		{name: "nanoseconds", format: DurationNanoseconds, expected: int64(1500000000)},
+		{name: "milliseconds", format: DurationMilliseconds, expected: 1500.0},
+		{name: "string", format: DurationString, expected: "1.5s"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewValueWithOptions(map[string]interface{}{
+				"took": 1500 * time.Millisecond,
+			}, WithDurationFormat(tc.format))
+			require.NoError(t, err)
+			require.Equal(t, map[string]interface{}{"took": tc.expected}, AsInterface(v))
+		})
+	}
+
+	v, err := NewValue(time.Duration(-42))
+	require.NoError(t, err)
+	require.Equal(t, int64(-42), v.GetInt64Value())
+}
+
+func TestTimeValues(t *testing.T) {
+	now := time.Date(2022, 8, 1, 12, 30, 0, 500, time.UTC)
+	ts := timestamppb.New(now)
+
+	for _, input := range []interface{}{now, &now, ts} {
+		v, err := NewValue(input)
+		require.NoError(t, err)
+		require.Equal(t, now, v.GetTimestampValue().AsTime(), "%T", input)
+	}
+	for _, input := range []interface{}{(*time.Time)(nil), (*timestamppb.Timestamp)(nil)} {
+		v, err := NewValue(input)
+		require.NoError(t, err)
+		require.Equal(t, NewNullValue(), v, "%T", input)
+	}
+}
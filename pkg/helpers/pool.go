@@ -0,0 +1,262 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"sync"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ValuePool recycles Values, Structs and ListValues to reduce the garbage
+// produced when converting lots of events. Values are released once they
+// are not used anymore, typically after the events are published, and
+// acquired again by the next conversions. It is safe for concurrent use.
+//
+// A released value must not be used anymore, nor be part of another value
+// that is still in use. A value must not appear twice in a released tree, it
+// would be put in the pool twice and acquired by two conversions; the
+// release doesn't track the values it visited, to stay cheap.
+type ValuePool struct {
+	values  sync.Pool
+	structs sync.Pool
+	lists   sync.Pool
+
+	conv *converter
+}
+
+// NewValuePool returns an empty pool.
+func NewValuePool() *ValuePool {
+	p := &ValuePool{}
+	p.conv = &converter{options: options{pool: p}}
+	return p
+}
+
+// WithPool allocates the converted values from the pool.
+func WithPool(p *ValuePool) Option {
+	return func(o *options) {
+		o.pool = p
+	}
+}
+
+// NewValue is NewValue with the values allocated from the pool.
+func (p *ValuePool) NewValue(v interface{}) (*messages.Value, error) {
+	var s convState
+	return p.conv.newValue(v, &s)
+}
+
+// NewStruct is NewStruct with the values allocated from the pool.
+func (p *ValuePool) NewStruct(v map[string]interface{}) (*messages.Struct, error) {
+	s := convState{depth: 1}
+	return p.conv.newStruct(v, &s)
+}
+
+// AcquireValue returns a Value from the pool, its kind must be set by the
+// caller.
+func (p *ValuePool) AcquireValue() *messages.Value {
+	if v, ok := p.values.Get().(*messages.Value); ok {
+		return v
+	}
+	return &messages.Value{}
+}
+
+// AcquireStruct returns an empty Struct from the pool.
+func (p *ValuePool) AcquireStruct() *messages.Struct {
+	if st, ok := p.structs.Get().(*messages.Struct); ok {
+		return st
+	}
+	return &messages.Struct{Data: map[string]*messages.Value{}}
+}
+
+// AcquireList returns an empty ListValue from the pool.
+func (p *ValuePool) AcquireList() *messages.ListValue {
+	if l, ok := p.lists.Get().(*messages.ListValue); ok {
+		return l
+	}
+	return &messages.ListValue{}
+}
+
+// Release returns the value to the pool, with all the values it contains.
+// Each of them must appear only once in v.
+func (p *ValuePool) Release(v *messages.Value) {
+	if v == nil {
+		return
+	}
+	// the kind is kept, so the next value of the same kind reuses it
+	switch k := v.Kind.(type) {
+	case *messages.Value_StructValue:
+		p.ReleaseStruct(k.StructValue)
+		k.StructValue = nil
+	case *messages.Value_ListValue:
+		p.ReleaseList(k.ListValue)
+		k.ListValue = nil
+	case *messages.Value_StringValue:
+		k.StringValue = ""
+	case *messages.Value_TimestampValue:
+		k.TimestampValue = nil
+	case *messages.Value_BytesValue:
+		k.BytesValue = nil
+	}
+	p.values.Put(v)
+}
+
+// ReleaseStruct returns the struct to the pool, with all the values it contains.
+func (p *ValuePool) ReleaseStruct(st *messages.Struct) {
+	if st == nil {
+		return
+	}
+	for _, v := range st.Data {
+		p.Release(v)
+	}
+	st.Clear()
+	if st.Data == nil {
+		st.Data = map[string]*messages.Value{}
+	}
+	p.structs.Put(st)
+}
+
+// ReleaseList returns the list to the pool, with all the values it contains.
+func (p *ValuePool) ReleaseList(l *messages.ListValue) {
+	if l == nil {
+		return
+	}
+	for _, v := range l.Values {
+		p.Release(v)
+	}
+	l.Clear()
+	p.lists.Put(l)
+}
+
+// ReleaseEvent returns the fields and metadata of the event to the pool.
+func (p *ValuePool) ReleaseEvent(e *messages.Event) {
+	p.ReleaseStruct(e.GetFields())
+	p.ReleaseStruct(e.GetMetadata())
+	e.Fields = nil
+	e.Metadata = nil
+}
+
+// The converter allocates the most common kinds from its pool, when set.
+
+func (c *converter) stringValue(s string) *messages.Value {
+	if c.arena != nil {
+		return c.arena.stringValue(s)
+	}
+	if c.pool == nil {
+		return NewStringValue(s)
+	}
+	v := c.pool.AcquireValue()
+	if k, ok := v.Kind.(*messages.Value_StringValue); ok {
+		k.StringValue = s
+	} else {
+		v.Kind = &messages.Value_StringValue{StringValue: s}
+	}
+	return v
+}
+
+func (c *converter) int64Value(i int64) *messages.Value {
+	if c.arena != nil {
+		return c.arena.int64Value(i)
+	}
+	if c.pool == nil {
+		return NewInt64Value(i)
+	}
+	v := c.pool.AcquireValue()
+	if k, ok := v.Kind.(*messages.Value_Int64Value); ok {
+		k.Int64Value = i
+	} else {
+		v.Kind = &messages.Value_Int64Value{Int64Value: i}
+	}
+	return v
+}
+
+func (c *converter) float64Value(f float64) *messages.Value {
+	if c.arena != nil {
+		return c.arena.float64Value(f)
+	}
+	if c.pool == nil {
+		return NewFloat64Value(f)
+	}
+	v := c.pool.AcquireValue()
+	if k, ok := v.Kind.(*messages.Value_Float64Value); ok {
+		k.Float64Value = f
+	} else {
+		v.Kind = &messages.Value_Float64Value{Float64Value: f}
+	}
+	return v
+}
+
+func (c *converter) boolValue(b bool) *messages.Value {
+	if c.arena != nil {
+		return c.arena.boolValue(b)
+	}
+	if c.pool == nil {
+		return NewBoolValue(b)
+	}
+	v := c.pool.AcquireValue()
+	if k, ok := v.Kind.(*messages.Value_BoolValue); ok {
+		k.BoolValue = b
+	} else {
+		v.Kind = &messages.Value_BoolValue{BoolValue: b}
+	}
+	return v
+}
+
+func (c *converter) structValue(st *messages.Struct) *messages.Value {
+	if c.arena != nil {
+		return c.arena.structValue(st)
+	}
+	if c.pool == nil {
+		return NewStructValue(st)
+	}
+	v := c.pool.AcquireValue()
+	if k, ok := v.Kind.(*messages.Value_StructValue); ok {
+		k.StructValue = st
+	} else {
+		v.Kind = &messages.Value_StructValue{StructValue: st}
+	}
+	return v
+}
+
+func (c *converter) listValue(l *messages.ListValue) *messages.Value {
+	if c.arena != nil {
+		return c.arena.listValue(l)
+	}
+	if c.pool == nil {
+		return NewListValue(l)
+	}
+	v := c.pool.AcquireValue()
+	if k, ok := v.Kind.(*messages.Value_ListValue); ok {
+		k.ListValue = l
+	} else {
+		v.Kind = &messages.Value_ListValue{ListValue: l}
+	}
+	return v
+}
+
+// newStructData returns an empty struct with room for size fields.
+func (c *converter) newStructData(size int) *messages.Struct {
+	if c.arena != nil {
+		return c.arena.newStructData(size)
+	}
+	if c.pool == nil {
+		return &messages.Struct{Data: make(map[string]*messages.Value, size)}
+	}
+	return c.pool.AcquireStruct()
+}
+
+// newListValues returns an empty list with room for size values.
+func (c *converter) newListValues(size int) *messages.ListValue {
+	if c.arena != nil {
+		return c.arena.newListValues(size)
+	}
+	if c.pool == nil {
+		return &messages.ListValue{Values: make([]*messages.Value, 0, size)}
+	}
+	l := c.pool.AcquireList()
+	if cap(l.Values) < size {
+		l.Values = make([]*messages.Value, 0, size)
+	}
+	return l
+}
@@ -0,0 +1,101 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+var poolTestEvent = map[string]interface{}{
+	"message":    "GET /index.html HTTP/1.1 200 512",
+	"@timestamp": time.Unix(1660000000, 0).UTC(),
+	"count":      12,
+	"ratio":      0.5,
+	"ok":         true,
+	"missing":    nil,
+	"labels":     map[string]string{"env": "prod"},
+	"tags":       []string{"nginx", "access"},
+	"http": map[string]interface{}{
+		"request": map[string]interface{}{"method": "GET"},
+		"ports":   []interface{}{80, int32(443)},
+	},
+}
+
+func TestValuePool(t *testing.T) {
+	exp, err := NewStruct(poolTestEvent)
+	require.NoError(t, err)
+
+	pool := NewValuePool()
+	for i := 0; i < 3; i++ {
+		st, err := pool.NewStruct(poolTestEvent)
+		require.NoError(t, err)
+		require.True(t, proto.Equal(exp, st))
+		pool.ReleaseStruct(st)
+	}
+
+	v, err := NewValueWithOptions([]interface{}{"a", 1}, WithPool(pool))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"a", int64(1)}, AsInterface(v))
+	pool.Release(v)
+
+	// values of another kind are reused too
+	b, err := pool.NewValue(true)
+	require.NoError(t, err)
+	require.Equal(t, true, AsInterface(b))
+}
+
+func TestValuePoolReleaseEvent(t *testing.T) {
+	pool := NewValuePool()
+	fields, err := pool.NewStruct(poolTestEvent)
+	require.NoError(t, err)
+	e := &messages.Event{Fields: fields, Metadata: pool.AcquireStruct()}
+
+	pool.ReleaseEvent(e)
+	require.Nil(t, e.Fields)
+	require.Nil(t, e.Metadata)
+	require.Empty(t, fields.Data)
+}
+
+func TestClear(t *testing.T) {
+	st, err := NewStruct(map[string]interface{}{"a": 1})
+	require.NoError(t, err)
+	st.Clear()
+	require.True(t, proto.Equal(&messages.Struct{}, st))
+	require.NotNil(t, st.Data)
+
+	l, err := NewList([]interface{}{1, 2})
+	require.NoError(t, err)
+	l.Clear()
+	require.Empty(t, l.Values)
+	require.Equal(t, 2, cap(l.Values))
+}
+
+func BenchmarkValuePool(b *testing.B) {
+	b.Run("NewStruct", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := NewStruct(poolTestEvent); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ValuePool", func(b *testing.B) {
+		pool := NewValuePool()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			st, err := pool.NewStruct(poolTestEvent)
+			if err != nil {
+				b.Fatal(err)
+			}
+			pool.ReleaseStruct(st)
+		}
+	})
+}
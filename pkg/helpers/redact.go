@@ -0,0 +1,143 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// DefaultRedactedPlaceholder replaces the redacted values by default.
+const DefaultRedactedPlaceholder = "[REDACTED]"
+
+// RedactorOption configures a Redactor.
+type RedactorOption func(*Redactor)
+
+// WithPlaceholder replaces the redacted values with the string s.
+func WithPlaceholder(s string) RedactorOption {
+	return func(r *Redactor) {
+		r.replace = func(*messages.Value) *messages.Value {
+			return NewStringValue(s)
+		}
+	}
+}
+
+// WithHash replaces the redacted values with the hex encoded HMAC-SHA256 of
+// the value using key, or its SHA-256 when key is empty. Equal values get
+// the same hash, so they can still be correlated. Without a key, values
+// from a small set, like short passwords, can be recovered by brute force.
+func WithHash(key []byte) RedactorOption {
+	return func(r *Redactor) {
+		newHash := sha256.New
+		if len(key) > 0 {
+			newHash = func() hash.Hash { return hmac.New(sha256.New, key) }
+		}
+		r.replace = func(v *messages.Value) *messages.Value {
+			h := newHash()
+			if s, ok := v.GetKind().(*messages.Value_StringValue); ok {
+				h.Write([]byte(s.StringValue))
+			} else {
+				// deterministic so equal structs get the same hash
+				b, _ := proto.MarshalOptions{Deterministic: true}.Marshal(v)
+				h.Write(b)
+			}
+			return NewStringValue(hex.EncodeToString(h.Sum(nil)))
+		}
+	}
+}
+
+// Redactor replaces the values of sensitive fields before events are
+// shipped. It is safe for concurrent use.
+type Redactor struct {
+	patterns [][]string
+	replace  func(*messages.Value) *messages.Value
+}
+
+// NewRedactor returns a Redactor for the fields matching any of the dotted
+// path patterns. Each segment of a pattern is matched with path.Match, so
+// "*" matches a single key and "user.*" the fields of user. The "**"
+// segment matches any number of keys: "**.password" matches "password" at
+// any depth. List items are matched by their index, like "tags.0" or
+// "users.*.password". By default the values are replaced with
+// DefaultRedactedPlaceholder.
+func NewRedactor(patterns []string, opts ...RedactorOption) (*Redactor, error) {
+	r := &Redactor{}
+	WithPlaceholder(DefaultRedactedPlaceholder)(r)
+	for _, opt := range opts {
+		opt(r)
+	}
+	for _, p := range patterns {
+		segments := strings.Split(p, ".")
+		for _, segment := range segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+			}
+		}
+		r.patterns = append(r.patterns, segments)
+	}
+	return r, nil
+}
+
+// Redact redacts the fields of the event, the metadata is left untouched. It
+// returns the number of redacted values.
+func (r *Redactor) Redact(e *messages.Event) int {
+	return r.RedactStruct(e.GetFields())
+}
+
+// RedactStruct redacts the fields of st in place and returns the number of
+// redacted values. A redacted struct or list is replaced as a whole.
+func (r *Redactor) RedactStruct(st *messages.Struct) int {
+	redacted := 0
+	_ = WalkStruct(st, func(p []string, v *messages.Value) error {
+		if !r.matches(p) {
+			return nil
+		}
+		v.Kind = r.replace(v).Kind
+		redacted++
+		return ErrSkipChildren
+	})
+	return redacted
+}
+
+func (r *Redactor) matches(p []string) bool {
+	for _, pattern := range r.patterns {
+		if matchSegments(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches a path against the pattern segments, the patterns
+// are validated when the Redactor is created.
+func matchSegments(pattern, p []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(p); i++ {
+				if matchSegments(pattern[1:], p[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(p) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], p[0]); !ok {
+			return false
+		}
+		pattern, p = pattern[1:], p[1:]
+	}
+	return len(p) == 0
+}
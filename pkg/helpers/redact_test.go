@@ -0,0 +1,121 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func redactTestFields(t *testing.T) *messages.Struct {
+	st, err := NewStruct(map[string]interface{}{
+		"message": "login",
+		"user":    map[string]interface{}{"name": "alice", "password": "secret"},
+		"http": map[string]interface{}{"request": map[string]interface{}{
+			"headers": map[string]interface{}{"authorization": "Bearer token", "accept": "*/*"},
+		}},
+		"users": []interface{}{
+			map[string]interface{}{"name": "bob", "password": "hunter2"},
+		},
+		"password": "top",
+	})
+	require.NoError(t, err)
+	return st
+}
+
+func TestRedactor(t *testing.T) {
+	r := DefaultRedactedPlaceholder
+	cases := []struct {
+		name     string
+		patterns []string
+		redacted int
+		expected map[string]interface{}
+	}{
+		{
+			name:     "dotted path",
+			patterns: []string{"http.request.headers.authorization"},
+			redacted: 1,
+			expected: map[string]interface{}{
+				"message": "login",
+				"user":    map[string]interface{}{"name": "alice", "password": "secret"},
+				"http": map[string]interface{}{"request": map[string]interface{}{
+					"headers": map[string]interface{}{"authorization": r, "accept": "*/*"},
+				}},
+				"users":    []interface{}{map[string]interface{}{"name": "bob", "password": "hunter2"}},
+				"password": "top",
+			},
+		},
+		{
+			name:     "single level wildcard",
+			patterns: []string{"*.password", "users.*.password"},
+			redacted: 2,
+			expected: map[string]interface{}{
+				"message": "login",
+				"user":    map[string]interface{}{"name": "alice", "password": r},
+				"http": map[string]interface{}{"request": map[string]interface{}{
+					"headers": map[string]interface{}{"authorization": "Bearer token", "accept": "*/*"},
+				}},
+				"users":    []interface{}{map[string]interface{}{"name": "bob", "password": r}},
+				"password": "top",
+			},
+		},
+		{
+			name:     "any depth",
+			patterns: []string{"**.password", "http.**"},
+			redacted: 4,
+			expected: map[string]interface{}{
+				"message":  "login",
+				"user":     map[string]interface{}{"name": "alice", "password": r},
+				"http":     r,
+				"users":    []interface{}{map[string]interface{}{"name": "bob", "password": r}},
+				"password": r,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			redactor, err := NewRedactor(tc.patterns)
+			require.NoError(t, err)
+			st := redactTestFields(t)
+			require.Equal(t, tc.redacted, redactor.Redact(&messages.Event{Fields: st}))
+			require.Equal(t, tc.expected, AsMap(st))
+		})
+	}
+}
+
+func TestRedactorOptions(t *testing.T) {
+	redactor, err := NewRedactor([]string{"user.password"}, WithPlaceholder("xxx"))
+	require.NoError(t, err)
+	st := redactTestFields(t)
+	redactor.RedactStruct(st)
+	v, err := GetField(st, "user.password")
+	require.NoError(t, err)
+	require.Equal(t, "xxx", v.GetStringValue())
+
+	sum := sha256.Sum256([]byte("secret"))
+	redactor, err = NewRedactor([]string{"user.password"}, WithHash(nil))
+	require.NoError(t, err)
+	st = redactTestFields(t)
+	redactor.RedactStruct(st)
+	v, err = GetField(st, "user.password")
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(sum[:]), v.GetStringValue())
+
+	redactor, err = NewRedactor([]string{"user", "users"}, WithHash([]byte("key")))
+	require.NoError(t, err)
+	first, second := redactTestFields(t), redactTestFields(t)
+	redactor.RedactStruct(first)
+	redactor.RedactStruct(second)
+	require.Equal(t, AsMap(first), AsMap(second), "hashes of structs must be stable")
+	require.NotEqual(t, hex.EncodeToString(sum[:]), first.Data["user"].GetStringValue())
+
+	_, err = NewRedactor([]string{"user.[pass"})
+	require.Error(t, err)
+}
@@ -0,0 +1,181 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Field types of a Schema, named after the Elasticsearch field types the
+// values are dynamically mapped to.
+const (
+	TypeString  = "string"
+	TypeLong    = "long"
+	TypeDouble  = "double"
+	TypeBoolean = "boolean"
+	TypeDate    = "date"
+	TypeBinary  = "binary"
+	TypeObject  = "object"
+)
+
+// FieldSchema describes the values seen at a field.
+type FieldSchema struct {
+	// Path is the dotted path of the field, list items are at the path of
+	// their list, like Elasticsearch arrays.
+	Path string
+	// Types counts the values of every type, null values are not counted.
+	Types map[string]int
+}
+
+// TypeNames returns the types of the field, sorted.
+func (f FieldSchema) TypeNames() []string {
+	names := make([]string, 0, len(f.Types))
+	for name := range f.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Conflict returns whether the field has values Elasticsearch can't map
+// to the same field, like strings and numbers, or objects and scalars.
+// Longs and doubles don't conflict.
+func (f FieldSchema) Conflict() bool {
+	families := map[string]struct{}{}
+	for name := range f.Types {
+		if name == TypeDouble {
+			name = TypeLong
+		}
+		families[name] = struct{}{}
+	}
+	return len(families) > 1
+}
+
+// Schema is the schema inferred by a SchemaInferrer, sorted by path.
+type Schema []FieldSchema
+
+// Conflicts returns the fields with conflicting types.
+func (s Schema) Conflicts() Schema {
+	var conflicts Schema
+	for _, f := range s {
+		if f.Conflict() {
+			conflicts = append(conflicts, f)
+		}
+	}
+	return conflicts
+}
+
+// Write writes the schema as a table of the fields with the count of
+// every type, flagging the conflicts.
+func (s Schema) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tTYPES\t")
+	for _, f := range s {
+		types := make([]string, 0, len(f.Types))
+		for _, name := range f.TypeNames() {
+			types = append(types, fmt.Sprintf("%s (%d)", name, f.Types[name]))
+		}
+		conflict := ""
+		if f.Conflict() {
+			conflict = "CONFLICT"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Path, strings.Join(types, ", "), conflict)
+	}
+	return tw.Flush()
+}
+
+// SchemaInferrer infers the schema of a stream of structs, like the fields
+// of events, to catch the mapping conflicts before they are ingested. It is
+// safe for concurrent use.
+type SchemaInferrer struct {
+	mu     sync.Mutex
+	fields map[string]map[string]int
+	count  int
+}
+
+// NewSchemaInferrer returns a SchemaInferrer that didn't observe anything.
+func NewSchemaInferrer() *SchemaInferrer {
+	return &SchemaInferrer{fields: map[string]map[string]int{}}
+}
+
+// Observe adds the fields of st to the schema.
+func (s *SchemaInferrer) Observe(st *messages.Struct) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.observeStruct("", st)
+}
+
+// Count returns the number of structs observed.
+func (s *SchemaInferrer) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Schema returns the schema of the structs observed so far.
+func (s *SchemaInferrer) Schema() Schema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schema := make(Schema, 0, len(s.fields))
+	for path, types := range s.fields {
+		copied := make(map[string]int, len(types))
+		for name, n := range types {
+			copied[name] = n
+		}
+		schema = append(schema, FieldSchema{Path: path, Types: copied})
+	}
+	sort.Slice(schema, func(i, j int) bool { return schema[i].Path < schema[j].Path })
+	return schema
+}
+
+func (s *SchemaInferrer) observeStruct(prefix string, st *messages.Struct) {
+	for key, v := range st.GetData() {
+		s.observeValue(prefix+key, v)
+	}
+}
+
+func (s *SchemaInferrer) observeValue(path string, v *messages.Value) {
+	var name string
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_NullValue, nil:
+		return
+	case *messages.Value_ListValue:
+		for _, item := range kind.ListValue.GetValues() {
+			s.observeValue(path, item)
+		}
+		return
+	case *messages.Value_StructValue:
+		name = TypeObject
+		s.observeStruct(path+".", kind.StructValue)
+	case *messages.Value_StringValue:
+		name = TypeString
+	case *messages.Value_BoolValue:
+		name = TypeBoolean
+	case *messages.Value_Int32Value, *messages.Value_Int64Value, *messages.Value_Uint32Value, *messages.Value_Uint64Value:
+		name = TypeLong
+	case *messages.Value_Float32Value, *messages.Value_Float64Value:
+		name = TypeDouble
+	case *messages.Value_TimestampValue:
+		name = TypeDate
+	case *messages.Value_BytesValue:
+		name = TypeBinary
+	default:
+		name = kindName(v)
+	}
+	types, ok := s.fields[path]
+	if !ok {
+		types = map[string]int{}
+		s.fields[path] = types
+	}
+	types[name]++
+}
@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaInferrer(t *testing.T) {
+	inferrer := NewSchemaInferrer()
+	for _, doc := range []string{
+		`{"message": "a", "http": {"status": 200}, "tags": ["x", "y"], "latency": 1}`,
+		`{"message": "b", "http.status": "OK", "tags": null, "latency": 1.5}`,
+		`{"message": {"text": "c"}, "user": null}`,
+	} {
+		st, err := StructFromJSON([]byte(doc))
+		require.NoError(t, err)
+		inferrer.Observe(st)
+	}
+	require.Equal(t, 3, inferrer.Count())
+
+	schema := inferrer.Schema()
+	paths := make([]string, len(schema))
+	for i, f := range schema {
+		paths[i] = f.Path
+	}
+	require.Equal(t, []string{"http", "http.status", "latency", "message", "message.text", "tags"}, paths)
+	require.Equal(t, map[string]int{TypeString: 2}, schema[5].Types, "list items are counted at the list path")
+
+	conflicts := schema.Conflicts()
+	require.Len(t, conflicts, 2)
+	require.Equal(t, "http.status", conflicts[0].Path)
+	require.Equal(t, []string{TypeLong, TypeString}, conflicts[0].TypeNames())
+	require.Equal(t, "message", conflicts[1].Path)
+	require.False(t, schema[2].Conflict(), "longs and doubles are compatible")
+
+	var out strings.Builder
+	require.NoError(t, conflicts.Write(&out))
+	require.Equal(t, "FIELD        TYPES                   \n"+
+		"http.status  long (1), string (1)    CONFLICT\n"+
+		"message      object (1), string (2)  CONFLICT\n", out.String())
+}
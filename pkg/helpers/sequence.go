@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrInvalidSequence is returned for events whose sequence metadata is
+// malformed.
+var ErrInvalidSequence = errors.New("invalid sequence")
+
+// SequenceKey is the metadata key holding the sequence of an event, a struct
+// with the producer ID as a string and the number as an unsigned integer.
+const SequenceKey = "sequence"
+
+// Sequence identifies an event among the events of a source: numbers are
+// given by the producer, increasing from 1 for every source, so a receiver
+// can recognize the events it already got.
+type Sequence struct {
+	// Producer is the ID of the producer numbering the events, a new ID
+	// starts the numbers over.
+	Producer string
+	// Number of the event among the events of its source.
+	Number uint64
+}
+
+// SetSequence sets the sequence of the event in its metadata.
+func SetSequence(e *messages.Event, seq Sequence) {
+	if e.Metadata == nil {
+		e.Metadata = &messages.Struct{}
+	}
+	if e.Metadata.Data == nil {
+		e.Metadata.Data = map[string]*messages.Value{}
+	}
+	e.Metadata.Data[SequenceKey] = NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+		"producer": NewStringValue(seq.Producer),
+		"number":   NewUint64Value(seq.Number),
+	}})
+}
+
+// GetSequence returns the sequence of the event, ok is false if it has none.
+func GetSequence(e *messages.Event) (seq Sequence, ok bool, err error) {
+	v, found := e.GetMetadata().GetData()[SequenceKey]
+	if !found {
+		return Sequence{}, false, nil
+	}
+	data := v.GetStructValue().GetData()
+	producer, number := data["producer"], data["number"]
+	if _, isString := producer.GetKind().(*messages.Value_StringValue); !isString || producer.GetStringValue() == "" {
+		return Sequence{}, false, fmt.Errorf("%w: missing producer", ErrInvalidSequence)
+	}
+	if _, isUint := number.GetKind().(*messages.Value_Uint64Value); !isUint || number.GetUint64Value() == 0 {
+		return Sequence{}, false, fmt.Errorf("%w: missing number", ErrInvalidSequence)
+	}
+	return Sequence{Producer: producer.GetStringValue(), Number: number.GetUint64Value()}, true, nil
+}
+
+// SequenceStream identifies the events numbered together: the events of a
+// source from a producer.
+func SequenceStream(e *messages.Event, producer string) string {
+	return producer + "/" + e.GetSource().GetInputId() + "/" + e.GetSource().GetStreamId()
+}
@@ -0,0 +1,34 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestSequence(t *testing.T) {
+	e := &messages.Event{Source: &messages.Source{InputId: "input", StreamId: "stream"}}
+	_, ok, err := GetSequence(e)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	SetSequence(e, Sequence{Producer: "producer", Number: 42})
+	seq, ok, err := GetSequence(e)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Sequence{Producer: "producer", Number: 42}, seq)
+	require.Equal(t, "producer/input/stream", SequenceStream(e, seq.Producer))
+
+	e.Metadata.Data[SequenceKey] = NewStringValue("42")
+	_, _, err = GetSequence(e)
+	require.ErrorIs(t, err, ErrInvalidSequence)
+	SetSequence(e, Sequence{Producer: "producer"})
+	_, _, err = GetSequence(e)
+	require.ErrorIs(t, err, ErrInvalidSequence)
+}
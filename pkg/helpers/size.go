@@ -0,0 +1,116 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// EventSize returns the marshaled size of the event in bytes, without
+// marshaling it.
+func EventSize(e *messages.Event) int {
+	return proto.Size(e)
+}
+
+// StructSize returns the marshaled size of the struct in bytes, without
+// marshaling it.
+func StructSize(st *messages.Struct) int {
+	return proto.Size(st)
+}
+
+// ApproximateEventSize returns an upper bound of the marshaled size of the
+// event that is cheaper to compute than EventSize. Numbers and lengths are
+// counted with their maximum encoded size, so it's only a few bytes per value
+// above the actual size.
+func ApproximateEventSize(e *messages.Event) int {
+	if e == nil {
+		return 0
+	}
+	size := 0
+	if e.Timestamp != nil {
+		size += timestampSize
+	}
+	if e.Source != nil {
+		size += approxBytes(approxString(e.Source.InputId) + approxString(e.Source.StreamId))
+	}
+	if e.DataStream != nil {
+		size += approxBytes(approxString(e.DataStream.Type) + approxString(e.DataStream.Dataset) + approxString(e.DataStream.Namespace))
+	}
+	if e.Metadata != nil {
+		size += approxBytes(ApproximateStructSize(e.Metadata))
+	}
+	if e.Fields != nil {
+		size += approxBytes(ApproximateStructSize(e.Fields))
+	}
+	return size
+}
+
+// ApproximateStructSize returns an upper bound of the marshaled size of the
+// struct, see ApproximateEventSize.
+func ApproximateStructSize(st *messages.Struct) int {
+	size := 0
+	for k, v := range st.GetData() {
+		// map entries are messages with the key and the value as fields
+		size += approxBytes(approxString(k) + approxBytes(approxValueSize(v)))
+	}
+	return size
+}
+
+// Maximum encoded sizes, including the tag of the field.
+const (
+	varintSize  = 1 + 10
+	fixed64Size = 1 + 8
+	fixed32Size = 1 + 4
+	boolSize    = 1 + 1
+	// the seconds and nanos of a timestamp are varints, nanos are below 10^9
+	timestampSize = 1 + 1 + varintSize + 1 + 5
+)
+
+func approxValueSize(v *messages.Value) int {
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_NullValue:
+		return boolSize
+	case *messages.Value_Float64Value:
+		return fixed64Size
+	case *messages.Value_Float32Value:
+		return fixed32Size
+	case *messages.Value_Int32Value, *messages.Value_Int64Value, *messages.Value_Uint64Value:
+		return varintSize
+	case *messages.Value_Uint32Value:
+		return 1 + 5
+	case *messages.Value_BoolValue:
+		return boolSize
+	case *messages.Value_StringValue:
+		return approxString(kind.StringValue)
+	case *messages.Value_TimestampValue:
+		return timestampSize
+	case *messages.Value_BytesValue:
+		return approxBytes(len(kind.BytesValue))
+	case *messages.Value_StructValue:
+		return approxBytes(ApproximateStructSize(kind.StructValue))
+	case *messages.Value_ListValue:
+		size := 0
+		for _, item := range kind.ListValue.GetValues() {
+			size += approxBytes(approxValueSize(item))
+		}
+		return approxBytes(size)
+	}
+	return 0
+}
+
+func approxString(s string) int {
+	return approxBytes(len(s))
+}
+
+// approxBytes returns the size of a length-delimited field of n bytes. The
+// length takes 3 bytes up to 2MiB, 5 bytes are enough for any longer field.
+func approxBytes(n int) int {
+	if n < 1<<21 {
+		return 1 + 3 + n
+	}
+	return 1 + 5 + n
+}
@@ -0,0 +1,84 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func sizeTestEvents(t testing.TB) map[string]*messages.Event {
+	fields, err := NewStruct(map[string]interface{}{
+		"message": "GET /index.html HTTP/1.1 200 512",
+		"http": map[string]interface{}{
+			"status_code": 200,
+			"bytes":       int64(math.MaxInt64),
+			"ratio":       -0.5,
+			"ok":          true,
+		},
+		"tags":    []interface{}{"a", nil, uint64(math.MaxUint64), []interface{}{int32(math.MinInt32)}},
+		"created": time.Date(2022, 8, 1, 12, 0, 0, 999999999, time.UTC),
+		"empty":   map[string]interface{}{},
+	})
+	require.NoError(t, err)
+
+	return map[string]*messages.Event{
+		"empty": {},
+		"full": {
+			Timestamp:  timestamppb.New(time.Date(2022, 8, 1, 12, 0, 0, 999999999, time.UTC)),
+			Source:     &messages.Source{InputId: "filestream-1", StreamId: "nginx-access"},
+			DataStream: &messages.DataStream{Type: "logs", Dataset: "nginx.access", Namespace: "default"},
+			Metadata:   &messages.Struct{Data: map[string]*messages.Value{"pipeline": NewStringValue("nginx")}},
+			Fields:     fields,
+		},
+		"large string": {
+			Fields: &messages.Struct{Data: map[string]*messages.Value{
+				"message": NewStringValue(strings.Repeat("a", 3<<20)),
+			}},
+		},
+	}
+}
+
+func TestEventSize(t *testing.T) {
+	for name, e := range sizeTestEvents(t) {
+		t.Run(name, func(t *testing.T) {
+			data, err := proto.Marshal(e)
+			require.NoError(t, err)
+			require.Equal(t, len(data), EventSize(e))
+			require.Equal(t, proto.Size(e.Fields), StructSize(e.Fields))
+
+			approx := ApproximateEventSize(e)
+			require.GreaterOrEqual(t, approx, len(data), "the approximation must be an upper bound")
+			require.LessOrEqual(t, approx, len(data)*2+64)
+			require.GreaterOrEqual(t, ApproximateStructSize(e.Fields), StructSize(e.Fields))
+		})
+	}
+	require.Zero(t, ApproximateEventSize(nil))
+	require.Zero(t, ApproximateStructSize(nil))
+}
+
+func BenchmarkEventSize(b *testing.B) {
+	e := sizeTestEvents(b)["full"]
+	b.Run("exact", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = EventSize(e)
+		}
+	})
+	b.Run("approximate", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = ApproximateEventSize(e)
+		}
+	})
+}
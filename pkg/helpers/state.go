@@ -0,0 +1,130 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrCyclicValue is returned when converting a map, slice or pointer that
+// contains itself.
+var ErrCyclicValue = errors.New("cyclic value")
+
+// startDetectingCyclesAfter is the nesting depth after which containers are
+// tracked, cycles are rare so shallow values don't pay for the tracking.
+// This is the same as encoding/json.
+const startDetectingCyclesAfter = 1000
+
+// containerID identifies a map, a slice by its backing array and length, or
+// a pointer.
+type containerID struct {
+	ptr uintptr
+	len int
+}
+
+// convState holds the state of a single conversion, it lives on the stack
+// of the exported functions so the shared converter stays stateless.
+type convState struct {
+	depth int
+	// derefs counts the pointers being dereferenced, they don't add to the
+	// depth of the converted value but can form cycles on their own
+	derefs int
+	seen   map[containerID]struct{}
+	// keys and size are only counted when the matching limit is set
+	keys int
+	size int
+}
+
+// enter must be called before converting the content of a map, slice or
+// struct, and followed by leave when done.
+func (s *convState) enter(container interface{}) error {
+	s.depth++
+	if s.nesting() <= startDetectingCyclesAfter {
+		return nil
+	}
+	id, ok := newContainerID(container)
+	if !ok {
+		return nil
+	}
+	if _, seen := s.seen[id]; seen {
+		return fmt.Errorf("%w: %T contains itself", ErrCyclicValue, container)
+	}
+	if s.seen == nil {
+		s.seen = map[containerID]struct{}{}
+	}
+	s.seen[id] = struct{}{}
+	return nil
+}
+
+func (s *convState) leave(container interface{}) {
+	if s.nesting() > startDetectingCyclesAfter {
+		if id, ok := newContainerID(container); ok {
+			delete(s.seen, id)
+		}
+	}
+	s.depth--
+}
+
+// enterPointer must be called before converting the value a pointer points
+// to, and followed by leavePointer when done. Pointers count toward the
+// nesting that starts the cycle detection, a pointer to an interface can
+// point to itself without any container in between.
+func (s *convState) enterPointer(ptr reflect.Value) error {
+	s.derefs++
+	if s.nesting() <= startDetectingCyclesAfter {
+		return nil
+	}
+	id := pointerID(ptr)
+	if _, seen := s.seen[id]; seen {
+		return fmt.Errorf("%w: %s points to itself", ErrCyclicValue, ptr.Type())
+	}
+	if s.seen == nil {
+		s.seen = map[containerID]struct{}{}
+	}
+	s.seen[id] = struct{}{}
+	return nil
+}
+
+func (s *convState) leavePointer(ptr reflect.Value) {
+	if s.nesting() > startDetectingCyclesAfter {
+		delete(s.seen, pointerID(ptr))
+	}
+	s.derefs--
+}
+
+// nesting is the number of containers and pointers being converted.
+func (s *convState) nesting() int {
+	return s.depth + s.derefs
+}
+
+// wrapNested adds the context of a container to the error of its content.
+// The cyclic value errors are returned as is: they come from the bottom of
+// a cycle and would be wrapped once per level, a thousand times.
+func wrapNested(err error, format string, args ...interface{}) error {
+	if errors.Is(err, ErrCyclicValue) {
+		return err
+	}
+	return fmt.Errorf(format+": %w", append(args, err)...)
+}
+
+// pointerID uses a negative length so a pointer doesn't collide with a slice
+// starting at the same address.
+func pointerID(ptr reflect.Value) containerID {
+	return containerID{ptr: ptr.Pointer(), len: -1}
+}
+
+// newContainerID returns false for values that can't contain themselves.
+func newContainerID(container interface{}) (containerID, bool) {
+	rv := reflect.ValueOf(container)
+	switch rv.Kind() {
+	case reflect.Map:
+		return containerID{ptr: rv.Pointer()}, true
+	case reflect.Slice:
+		return containerID{ptr: rv.Pointer(), len: rv.Len()}, true
+	}
+	return containerID{}, false
+}
@@ -10,11 +10,12 @@
 // the Struct message represents a JSON object, and the ListValue message
 // represents a JSON array. See https://json.org for more information.
 //
-// The Value, Struct, and ListValue types have generated MarshalJSON and
-// UnmarshalJSON methods such that they serialize JSON equivalent to what the
-// messages themselves represent. Use of these types with the
-// "google.golang.org/protobuf/encoding/protojson" package
-// ensures that they will be serialized as their JSON equivalent.
+// The Value, Struct, and ListValue types have MarshalJSON and UnmarshalJSON
+// methods such that they serialize JSON equivalent to what the messages
+// themselves represent, so they can be used with "encoding/json" directly.
+// Timestamps and bytes are marshaled as RFC3339 and base64 strings, and
+// unmarshaled as string values. The "google.golang.org/protobuf/encoding/protojson"
+// package serializes them as their generic protobuf JSON form instead.
 //
 // # Conversion to and from a Go interface
 //
@@ -91,7 +92,10 @@
 package helpers
 
 import (
-	"encoding/base64"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
 	"time"
 	utf8 "unicode/utf8"
@@ -106,16 +110,27 @@ import (
 // The map keys must be valid UTF-8.
 // The map values are converted using NewValue.
 func NewStruct(v map[string]interface{}) (*messages.Struct, error) {
-	x := &messages.Struct{Data: make(map[string]*messages.Value, len(v))}
+	s := convState{depth: 1}
+	return defaultConverter.newStruct(v, &s)
+}
+
+func (c *converter) newStruct(v map[string]interface{}, s *convState) (*messages.Struct, error) {
+	x := c.newStructData(len(v))
 	for k, v := range v {
 		if !utf8.ValidString(k) {
 			return nil, protoimpl.X.NewError("invalid UTF-8 in string: %q", k)
 		}
-		var err error
-		x.Data[k], err = NewValue(v)
+		if err := c.addKey(s, k); err != nil {
+			return nil, err
+		}
+		value, err := c.newValue(v, s)
+		if errors.Is(err, errSkip) {
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
+		x.Data[k] = value
 	}
 	return x, nil
 }
@@ -171,6 +186,10 @@ func AsInterface(x *messages.Value) interface{} {
 		if v != nil {
 			return v.TimestampValue.AsTime()
 		}
+	case *messages.Value_BytesValue:
+		if v != nil {
+			return v.BytesValue
+		}
 	case *messages.Value_BoolValue:
 		if v != nil {
 			return v.BoolValue
@@ -198,25 +217,56 @@ func AsSlice(x *messages.ListValue) []interface{} {
 }
 
 // NewValue constructs a Value from a general-purpose Go interface.
-// When converting an int64 or uint64 to a NumberValue, numeric precision loss
-// is possible since they are stored as a float64.
+// Integers are stored using the integer kind of matching sign and width, so
+// int64 and uint64 values round trip through AsInterface without precision
+// loss. Smaller integer types are widened to 32 bits, and int and uint to 64.
+// Values implementing json.Marshaler or encoding.TextMarshaler are converted
+// from their marshaled form, as encoding/json would.
+// time.Time, *time.Time and *timestamppb.Timestamp values are converted to
+// timestamps, and time.Duration values to nanoseconds, see WithDurationFormat.
+// Pointers are dereferenced, nil pointers and interfaces become null values.
+// Values, Structs and ListValues are used as they are, without a copy.
+// json.RawMessage values are parsed, and json.Number values are converted to
+// numbers, or kept as strings when they don't fit in 64 bits.
+// Go structs are converted using the names of their exported fields, see
+// NewValueWithOptions and WithStructTags to use struct tags instead.
 func NewValue(newValue interface{}) (*messages.Value, error) {
+	var s convState
+	return defaultConverter.newValue(newValue, &s)
+}
 
+func (c *converter) newValue(newValue interface{}, s *convState) (*messages.Value, error) {
+	if err := c.addSize(s, valueOverhead); err != nil {
+		return nil, err
+	}
 	if newValue == nil {
 		return NewNullValue(), nil
 	}
+	if c.converters != nil {
+		if v, err := c.convertRegistered(newValue, s); v != nil || err != nil {
+			return v, err
+		}
+	}
 
 	switch newValueTyped := newValue.(type) {
 	case bool:
-		return NewBoolValue(newValueTyped), nil
+		return c.boolValue(newValueTyped), nil
 	case int:
-		return NewInt64Value(int64(newValueTyped)), nil
+		return c.int64Value(int64(newValueTyped)), nil
+	case int8:
+		return NewInt32Value(int32(newValueTyped)), nil
+	case int16:
+		return NewInt32Value(int32(newValueTyped)), nil
 	case int32:
 		return NewInt32Value(newValueTyped), nil
 	case int64:
-		return NewInt64Value(newValueTyped), nil
+		return c.int64Value(newValueTyped), nil
 	case uint:
 		return NewUint64Value(uint64(newValueTyped)), nil
+	case uint8:
+		return NewUint32Value(uint32(newValueTyped)), nil
+	case uint16:
+		return NewUint32Value(uint32(newValueTyped)), nil
 	case uint32:
 		return NewUint32Value(newValueTyped), nil
 	case uint64:
@@ -224,89 +274,314 @@ func NewValue(newValue interface{}) (*messages.Value, error) {
 	case float32:
 		return NewFloat32Value(newValueTyped), nil
 	case float64:
-		return NewFloat64Value(newValueTyped), nil
+		return c.float64Value(newValueTyped), nil
 	case string:
 		if !utf8.ValidString(newValueTyped) {
 			return nil, protoimpl.X.NewError("invalid UTF-8 in string: %q", newValueTyped)
 		}
-		return NewStringValue(newValueTyped), nil
+		if err := c.addSize(s, len(newValueTyped)); err != nil {
+			return nil, err
+		}
+		return c.stringValue(newValueTyped), nil
 	case time.Time:
 		return NewTimestampValue(newValueTyped), nil
+	case *time.Time:
+		if newValueTyped == nil {
+			return NewNullValue(), nil
+		}
+		return NewTimestampValue(*newValueTyped), nil
+	case *timestamppb.Timestamp: // not copied, like the structs and lists of NewStructValue and NewListValue
+		if newValueTyped == nil {
+			return NewNullValue(), nil
+		}
+		return &messages.Value{Kind: &messages.Value_TimestampValue{TimestampValue: newValueTyped}}, nil
+	case time.Duration:
+		return c.durationValue(newValueTyped, s)
+	case *messages.Value: // not copied, checked before json.Marshaler which they implement
+		if newValueTyped == nil {
+			return NewNullValue(), nil
+		}
+		return newValueTyped, nil
+	case *messages.Struct:
+		if newValueTyped == nil {
+			return NewNullValue(), nil
+		}
+		return NewStructValue(newValueTyped), nil
+	case *messages.ListValue:
+		if newValueTyped == nil {
+			return NewNullValue(), nil
+		}
+		return NewListValue(newValueTyped), nil
 
 	case map[string]interface{}:
-		sv, err := NewStruct(newValueTyped)
+		if err := c.enter(s, newValue); err != nil {
+			return nil, err
+		}
+		sv, err := c.newStruct(newValueTyped, s)
+		s.leave(newValue)
 		if err != nil {
-			return nil, protoimpl.X.NewError("error creating struct object: %q", newValueTyped)
+			return nil, wrapNested(err, "error creating struct object")
 		}
-		return NewStructValue(sv), nil
+		return c.structValue(sv), nil
 	case mapstr.M: // mapstr.M is just a map[string]interface, but the typecast won't recognize that
-		sv, err := NewStruct(newValueTyped)
+		if err := c.enter(s, newValue); err != nil {
+			return nil, err
+		}
+		sv, err := c.newStruct(newValueTyped, s)
+		s.leave(newValue)
 		if err != nil {
-			return nil, protoimpl.X.NewError("error creating struct object: %q", newValueTyped)
+			return nil, wrapNested(err, "error creating struct object")
+		}
+		return c.structValue(sv), nil
+	case map[string]string: // common for labels and headers, avoid reflecting over the map
+		if err := c.enter(s, newValue); err != nil {
+			return nil, err
+		}
+		defer s.leave(newValue)
+		strMapVal := c.newStructData(len(newValueTyped))
+		for k, sv := range newValueTyped {
+			if !utf8.ValidString(k) {
+				return nil, protoimpl.X.NewError("invalid UTF-8 in string: %q", k)
+			}
+			if !utf8.ValidString(sv) {
+				return nil, protoimpl.X.NewError("invalid UTF-8 in string: %q", sv)
+			}
+			if err := c.addKey(s, k); err != nil {
+				return nil, err
+			}
+			if err := c.addSize(s, len(sv)+valueOverhead); err != nil {
+				return nil, err
+			}
+			strMapVal.Data[k] = c.stringValue(sv)
 		}
-		return NewStructValue(sv), nil
+		return c.structValue(strMapVal), nil
 	case []interface{}:
-		lst, err := NewList(newValueTyped)
+		if err := c.enter(s, newValue); err != nil {
+			return nil, err
+		}
+		lst, err := c.newList(newValueTyped, s)
+		s.leave(newValue)
 		if err != nil {
-			return nil, protoimpl.X.NewError("error creating list object: %q", newValueTyped)
+			return nil, wrapNested(err, "error creating list object")
 		}
-		return NewListValue(lst), nil
+		return c.listValue(lst), nil
 	case []string: // not strictly needed, but []string seems to be common in log events, so this will give a slight performance boost
-		strListVal := &messages.ListValue{Values: make([]*messages.Value, len(newValueTyped))}
-		for i, sv := range newValueTyped {
-			strListVal.Values[i] = NewStringValue(sv)
+		if err := c.enter(s, newValue); err != nil {
+			return nil, err
+		}
+		defer s.leave(newValue)
+		strListVal := c.newListValues(len(newValueTyped))
+		for _, sv := range newValueTyped {
+			if !utf8.ValidString(sv) {
+				return nil, protoimpl.X.NewError("invalid UTF-8 in string: %q", sv)
+			}
+			if err := c.addSize(s, len(sv)+valueOverhead); err != nil {
+				return nil, err
+			}
+			strListVal.Values = append(strListVal.Values, c.stringValue(sv))
+		}
+		return c.listValue(strListVal), nil
+	case []int:
+		if err := c.enter(s, newValue); err != nil {
+			return nil, err
+		}
+		defer s.leave(newValue)
+		if err := c.addSize(s, len(newValueTyped)*valueOverhead); err != nil {
+			return nil, err
+		}
+		intListVal := c.newListValues(len(newValueTyped))
+		for _, iv := range newValueTyped {
+			intListVal.Values = append(intListVal.Values, c.int64Value(int64(iv)))
+		}
+		return c.listValue(intListVal), nil
+	case []float64:
+		if err := c.enter(s, newValue); err != nil {
+			return nil, err
+		}
+		defer s.leave(newValue)
+		if err := c.addSize(s, len(newValueTyped)*valueOverhead); err != nil {
+			return nil, err
+		}
+		floatListVal := c.newListValues(len(newValueTyped))
+		for _, fv := range newValueTyped {
+			floatListVal.Values = append(floatListVal.Values, c.float64Value(fv))
+		}
+		return c.listValue(floatListVal), nil
+	case []bool:
+		if err := c.enter(s, newValue); err != nil {
+			return nil, err
+		}
+		defer s.leave(newValue)
+		if err := c.addSize(s, len(newValueTyped)*valueOverhead); err != nil {
+			return nil, err
+		}
+		boolListVal := c.newListValues(len(newValueTyped))
+		for _, bv := range newValueTyped {
+			boolListVal.Values = append(boolListVal.Values, c.boolValue(bv))
 		}
-		return NewListValue(strListVal), nil
+		return c.listValue(boolListVal), nil
+	case []map[string]interface{}: // lists of objects, like decoded JSON arrays
+		if err := c.enter(s, newValue); err != nil {
+			return nil, err
+		}
+		defer s.leave(newValue)
+		mapListVal := c.newListValues(len(newValueTyped))
+		for _, mv := range newValueTyped {
+			if err := c.addSize(s, valueOverhead); err != nil {
+				return nil, err
+			}
+			if err := c.enter(s, mv); err != nil {
+				return nil, err
+			}
+			sv, err := c.newStruct(mv, s)
+			s.leave(mv)
+			if err != nil {
+				return nil, wrapNested(err, "error creating struct object")
+			}
+			mapListVal.Values = append(mapListVal.Values, c.structValue(sv))
+		}
+		return c.listValue(mapListVal), nil
 	case []byte:
-		s := base64.StdEncoding.EncodeToString(newValueTyped)
-		return NewStringValue(s), nil
+		return c.bytesValue(newValueTyped, s)
+	case json.Number: // decoded with UseNumber
+		if err := c.addSize(s, len(newValueTyped)); err != nil {
+			return nil, err
+		}
+		return jsonNumberValue(newValueTyped)
+	case json.RawMessage: // embedded JSON, parsed without the copy of MarshalJSON
+		if len(newValueTyped) == 0 {
+			return NewNullValue(), nil
+		}
+		if err := c.addSize(s, len(newValueTyped)); err != nil {
+			return nil, err
+		}
+		v, err := valueFromJSON(newValueTyped)
+		if err != nil {
+			return nil, protoimpl.X.NewError("invalid JSON in json.RawMessage: %s", err)
+		}
+		if err := c.checkDecoded(s, v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case json.Marshaler: // same precedence as encoding/json, uuids, enums and the likes
+		if isNilPointer(newValueTyped) {
+			return NewNullValue(), nil
+		}
+		data, err := newValueTyped.MarshalJSON()
+		if err != nil {
+			return nil, protoimpl.X.NewError("could not marshal value of type %T to JSON: %s", newValueTyped, err)
+		}
+		if err := c.addSize(s, len(data)); err != nil {
+			return nil, err
+		}
+		v, err := valueFromJSON(data)
+		if err != nil {
+			return nil, protoimpl.X.NewError("invalid JSON from value of type %T: %s", newValueTyped, err)
+		}
+		if err := c.checkDecoded(s, v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case encoding.TextMarshaler: // net.IP, big.Int...
+		if isNilPointer(newValueTyped) {
+			return NewNullValue(), nil
+		}
+		text, err := newValueTyped.MarshalText()
+		if err != nil {
+			return nil, protoimpl.X.NewError("could not marshal value of type %T to text: %s", newValueTyped, err)
+		}
+		if !utf8.Valid(text) {
+			return nil, protoimpl.X.NewError("invalid UTF-8 in text of type %T: %q", newValueTyped, text)
+		}
+		if err := c.addSize(s, len(text)); err != nil {
+			return nil, err
+		}
+		if c.unsafeStrings {
+			return c.stringValue(UnsafeString(text)), nil
+		}
+		return c.stringValue(string(text)), nil
 
 	default: // fall back to using reflection to unpack the value
 		switch reflect.TypeOf(newValueTyped).Kind() {
 		case reflect.Struct:
-			mapVal := reflect.ValueOf(newValueTyped)
-			fields := reflect.TypeOf(newValueTyped)
-			interMap := map[string]*messages.Value{}
-			for i := 0; i < mapVal.NumField(); i++ {
-				msgVal, err := NewValue(mapVal.Field(i).Interface())
-				if err != nil {
-					return nil, protoimpl.X.NewError("could not convert value of type %T in struct: %s", newValueTyped, err)
-				}
-				name := fields.Field(i).Name // is there a struct tag we should use instead?
-				interMap[name] = msgVal
+			if err := c.enter(s, newValue); err != nil {
+				return nil, err
+			}
+			interMap, err := c.structFields(reflect.ValueOf(newValueTyped), s)
+			s.leave(newValue)
+			if err != nil {
+				return nil, wrapNested(err, "could not convert value of type %T in struct", newValueTyped)
 			}
 			structObj := &messages.Struct{Data: interMap}
-			return NewStructValue(structObj), nil
+			return c.structValue(structObj), nil
 		case reflect.Map: // we'll only end up here if we have a map that doesn't resolve to value type interface{}
-			reflected := map[string]*messages.Value{}
+			reflected := c.newStructData(reflect.ValueOf(newValueTyped).Len())
 			mapIter := reflect.ValueOf(newValueTyped).MapRange()
-			// hard error if the key type isn't a string
-			if reftype := reflect.TypeOf(newValueTyped).Key().Kind(); reftype != reflect.String {
-				return nil, protoimpl.X.NewError("maps must have key of type string, got %v", reftype)
+			stringKeys := reflect.TypeOf(newValueTyped).Key().Kind() == reflect.String
+			switch {
+			case stringKeys || c.mapKeys == MapKeysFormat:
+			case c.mapKeys == MapKeysSkip:
+				return nil, errSkip
+			default:
+				return nil, protoimpl.X.NewError("maps must have key of type string, got %v, see WithMapKeys", reflect.TypeOf(newValueTyped).Key())
+			}
+			if err := c.enter(s, newValue); err != nil {
+				return nil, err
 			}
-			var err error
+			defer s.leave(newValue)
 			for mapIter.Next() {
-				k := mapIter.Key().String()
+				var k string
+				if stringKeys {
+					k = mapIter.Key().String()
+				} else {
+					k = fmt.Sprint(mapIter.Key().Interface())
+				}
+				if !utf8.ValidString(k) {
+					return nil, protoimpl.X.NewError("invalid UTF-8 in string: %q", k)
+				}
+				if err := c.addKey(s, k); err != nil {
+					return nil, err
+				}
 				mv := mapIter.Value().Interface()
-				reflected[k], err = NewValue(mv)
+				value, err := c.newValue(mv, s)
+				if errors.Is(err, errSkip) {
+					continue
+				}
 				if err != nil {
-					protoimpl.X.NewError("could not convert value of type %T in map: %s", mv, err)
+					return nil, wrapNested(err, "could not convert value of type %T in map", mv)
 				}
+				reflected.Data[k] = value
+			}
+			return c.structValue(reflected), nil
+		case reflect.Slice, reflect.Array: // only for the slices without a fast path above
+			if err := c.enter(s, newValue); err != nil {
+				return nil, err
 			}
-			mapObj := &messages.Struct{Data: reflected}
-			return NewStructValue(mapObj), nil
-		case reflect.Slice: // only for arrays that aren't type []string or []interface{}
+			defer s.leave(newValue)
 			refVal := reflect.ValueOf(newValueTyped)
-			listVal := &messages.ListValue{Values: make([]*messages.Value, refVal.Len())}
+			listVal := c.newListValues(refVal.Len())
 			for i := 0; i < refVal.Len(); i++ {
-				var err error
-				listVal.Values[i], err = NewValue(refVal.Index(i).Interface())
+				value, err := c.newValue(refVal.Index(i).Interface(), s)
+				if errors.Is(err, errSkip) {
+					continue
+				}
 				if err != nil {
-					return nil, protoimpl.X.NewError("error unpacking field of type %T in array %#v: %s", refVal.Field(i).Interface(), newValueTyped, err)
+					return nil, wrapNested(err, "error unpacking field of type %T in array of type %T", refVal.Index(i).Interface(), newValueTyped)
 				}
+				listVal.Values = append(listVal.Values, value)
 			}
 
-			return NewListValue(listVal), nil
+			return c.listValue(listVal), nil
+		case reflect.Ptr: // *string, *int and the likes of API structs
+			rv := reflect.ValueOf(newValueTyped)
+			if rv.IsNil() {
+				return NewNullValue(), nil
+			}
+			if err := s.enterPointer(rv); err != nil {
+				return nil, err
+			}
+			defer s.leavePointer(rv)
+			return c.newValue(rv.Elem().Interface(), s)
 		default:
 			return nil, protoimpl.X.NewError("invalid type: %T", newValueTyped)
 		}
@@ -314,6 +589,11 @@ func NewValue(newValue interface{}) (*messages.Value, error) {
 	}
 }
 
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
 // NewNullValue constructs a new null Value.
 func NewNullValue() *messages.Value {
 	return &messages.Value{Kind: &messages.Value_NullValue{NullValue: messages.NullValue_NULL_VALUE}}
@@ -364,6 +644,11 @@ func NewTimestampValue(v time.Time) *messages.Value {
 	return &messages.Value{Kind: &messages.Value_TimestampValue{TimestampValue: timestamppb.New(v)}}
 }
 
+// NewBytesValue constructs a new bytes Value, v is not copied.
+func NewBytesValue(v []byte) *messages.Value {
+	return &messages.Value{Kind: &messages.Value_BytesValue{BytesValue: v}}
+}
+
 // NewStructValue constructs a new struct Value.
 func NewStructValue(v *messages.Struct) *messages.Value {
 	return &messages.Value{Kind: &messages.Value_StructValue{StructValue: v}}
@@ -377,13 +662,21 @@ func NewListValue(v *messages.ListValue) *messages.Value {
 // NewList constructs a ListValue from a general-purpose Go slice.
 // The slice elements are converted using NewValue.
 func NewList(v []interface{}) (*messages.ListValue, error) {
-	x := &messages.ListValue{Values: make([]*messages.Value, len(v))}
-	for i, v := range v {
-		var err error
-		x.Values[i], err = NewValue(v)
+	s := convState{depth: 1}
+	return defaultConverter.newList(v, &s)
+}
+
+func (c *converter) newList(v []interface{}, s *convState) (*messages.ListValue, error) {
+	x := c.newListValues(len(v))
+	for _, v := range v {
+		value, err := c.newValue(v, s)
+		if errors.Is(err, errSkip) {
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
+		x.Values = append(x.Values, value)
 	}
 	return x, nil
 }
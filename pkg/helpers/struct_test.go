@@ -1,8 +1,13 @@
 package helpers
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"reflect"
 	"time"
 
@@ -236,6 +241,43 @@ func BenchmarkCustomUnmarshal(b *testing.B) {
 	}
 }
 
+func BenchmarkNewValueFastPath(b *testing.B) {
+	cases := []struct {
+		name string
+		in   interface{}
+	}{
+		{name: "bool", in: true},
+		{name: "int", in: 42},
+		{name: "int64", in: int64(42)},
+		{name: "uint16", in: uint16(42)},
+		{name: "float64", in: 42.5},
+		{name: "string", in: "test-string"},
+		{name: "map of strings", in: map[string]string{"key1": "value1", "key2": "value2"}},
+		{name: "map of interfaces", in: map[string]interface{}{"key1": "value1", "key2": 2, "key3": true}},
+		{name: "strings", in: []string{"a", "b", "c", "d"}},
+		{name: "ints", in: []int{1, 2, 3, 4}},
+		{name: "floats", in: []float64{1.5, 2.5, 3.5, 4.5}},
+		{name: "bools", in: []bool{true, false, true, false}},
+		{name: "maps", in: []map[string]interface{}{{"a": 1}, {"b": 2}}},
+		{name: "array", in: [4]int{1, 2, 3, 4}},
+	}
+
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var r *messages.Value
+			var err error
+			for i := 0; i < b.N; i++ {
+				r, err = NewValue(c.in)
+				if err != nil {
+					b.Fatalf("error: %s", err)
+				}
+			}
+			result = r
+		})
+	}
+}
+
 func TestStructValue(t *testing.T) {
 	testStructType := struct {
 		A int
@@ -290,6 +332,33 @@ func TestStructValue(t *testing.T) {
 			in:   32,
 			exp:  &messages.Value{Kind: &messages.Value_Int64Value{Int64Value: 32}},
 		},
+		{
+			name: "int8 conversion",
+			in:   int8(-8),
+			exp:  &messages.Value{Kind: &messages.Value_Int32Value{Int32Value: -8}},
+		},
+		{
+			name: "int16 conversion",
+			in:   int16(-16),
+			exp:  &messages.Value{Kind: &messages.Value_Int32Value{Int32Value: -16}},
+		},
+		{
+			name: "uint8 conversion",
+			in:   uint8(8),
+			exp:  &messages.Value{Kind: &messages.Value_Uint32Value{Uint32Value: 8}},
+		},
+		{
+			name: "uint16 conversion",
+			in:   uint16(16),
+			exp:  &messages.Value{Kind: &messages.Value_Uint32Value{Uint32Value: 16}},
+		},
+		{
+			name: "map of strings conversion",
+			in:   map[string]string{"key": "value"},
+			exp: NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+				"key": NewStringValue("value"),
+			}}),
+		},
 		{
 			name: "nil value",
 			in:   nil,
@@ -365,3 +434,243 @@ func TestStructValue(t *testing.T) {
 		})
 	}
 }
+
+func TestIntegerRoundTrip(t *testing.T) {
+	in := map[string]interface{}{
+		"max_int64":  int64(math.MaxInt64),
+		"min_int64":  int64(math.MinInt64),
+		"max_uint64": uint64(math.MaxUint64),
+		"max_int32":  int32(math.MaxInt32),
+		"max_uint32": uint32(math.MaxUint32),
+		"int":        math.MaxInt64,
+		"uint":       uint(math.MaxUint64),
+		"int8":       int8(math.MinInt8),
+		"uint16":     uint16(math.MaxUint16),
+	}
+	exp := map[string]interface{}{
+		"max_int64":  int64(math.MaxInt64),
+		"min_int64":  int64(math.MinInt64),
+		"max_uint64": uint64(math.MaxUint64),
+		"max_int32":  int32(math.MaxInt32),
+		"max_uint32": uint32(math.MaxUint32),
+		"int":        int64(math.MaxInt64),
+		"uint":       uint64(math.MaxUint64),
+		"int8":       int32(math.MinInt8),
+		"uint16":     uint32(math.MaxUint16),
+	}
+
+	st, err := NewStruct(in)
+	require.NoError(t, err)
+	require.Equal(t, exp, AsMap(st))
+
+	// the JSON encoding must not go through float64 either
+	jsonWriter := &fastjson.Writer{}
+	require.NoError(t, st.MarshalFastJSON(jsonWriter))
+	decoder := json.NewDecoder(bytes.NewReader(jsonWriter.Bytes()))
+	decoder.UseNumber()
+	decoded := map[string]json.Number{}
+	require.NoError(t, decoder.Decode(&decoded))
+	require.Equal(t, json.Number("9223372036854775807"), decoded["max_int64"])
+	require.Equal(t, json.Number("-9223372036854775808"), decoded["min_int64"])
+	require.Equal(t, json.Number("18446744073709551615"), decoded["max_uint64"])
+}
+
+type testLevel int
+
+func (l testLevel) MarshalText() ([]byte, error) {
+	switch l {
+	case 0:
+		return []byte("info"), nil
+	case 1:
+		return []byte("error"), nil
+	}
+	return nil, errors.New("unknown level")
+}
+
+type testPoint struct {
+	X, Y int
+}
+
+func (p *testPoint) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"coordinates":[%d,%d]}`, p.X, p.Y)), nil
+}
+
+func TestNewValueMarshalers(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+		exp  interface{}
+		err  bool
+	}{
+		{name: "net.IP", in: net.ParseIP("10.0.0.1"), exp: "10.0.0.1"},
+		{name: "text enum", in: testLevel(1), exp: "error"},
+		{name: "text error", in: testLevel(5), err: true},
+		{name: "json", in: &testPoint{X: 1, Y: 2}, exp: map[string]interface{}{"coordinates": []interface{}{int64(1), int64(2)}}},
+		{name: "nil pointer", in: (*testPoint)(nil), exp: nil},
+		{name: "nested", in: map[string]interface{}{"level": testLevel(0)}, exp: map[string]interface{}{"level": "info"}},
+		{name: "time keeps its kind", in: time.Unix(0, 0).UTC(), exp: time.Unix(0, 0).UTC()},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := NewValue(c.in)
+			if c.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.exp, AsInterface(v))
+		})
+	}
+}
+
+func TestNewValueCycles(t *testing.T) {
+	cyclicMap := map[string]interface{}{}
+	cyclicMap["self"] = cyclicMap
+
+	cyclicList := []interface{}{nil}
+	cyclicList[0] = cyclicList
+
+	type node struct {
+		Children map[string]interface{}
+	}
+	cyclicStruct := node{Children: map[string]interface{}{}}
+	cyclicStruct.Children["node"] = cyclicStruct
+
+	cyclicTyped := map[string][]interface{}{}
+	cyclicTyped["list"] = []interface{}{cyclicTyped}
+
+	type linked struct {
+		Next *linked
+	}
+	cyclicPointer := &linked{}
+	cyclicPointer.Next = cyclicPointer
+
+	var cyclicInterface interface{}
+	cyclicInterface = &cyclicInterface
+
+	cases := []struct {
+		name string
+		in   interface{}
+	}{
+		{name: "map", in: cyclicMap},
+		{name: "list", in: cyclicList},
+		{name: "struct", in: cyclicStruct},
+		{name: "typed map", in: cyclicTyped},
+		{name: "pointer", in: cyclicPointer},
+		{name: "interface pointer", in: cyclicInterface},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := NewValue(c.in)
+			require.ErrorIs(t, err, ErrCyclicValue)
+			// not wrapped at every level of the cycle
+			require.Less(t, len(err.Error()), 200)
+		})
+	}
+
+	// the same value can appear several times without a cycle
+	shared := map[string]interface{}{"a": 1}
+	_, err := NewValue([]interface{}{shared, shared, []interface{}{shared}})
+	require.NoError(t, err)
+}
+
+func TestNewValuePointers(t *testing.T) {
+	str, num, flag := "hello", 42, true
+	strPtr := &str
+
+	type apiObject struct {
+		Name    *string
+		Count   *int
+		Enabled *bool
+		Missing *string
+		Any     interface{}
+		Empty   interface{}
+	}
+
+	cases := []struct {
+		name string
+		in   interface{}
+		exp  interface{}
+	}{
+		{name: "string", in: &str, exp: "hello"},
+		{name: "int", in: &num, exp: int64(42)},
+		{name: "pointer to pointer", in: &strPtr, exp: "hello"},
+		{name: "nil", in: (*int)(nil), exp: nil},
+		{name: "map", in: &map[string]interface{}{"a": &num}, exp: map[string]interface{}{"a": int64(42)}},
+		{name: "list", in: []*string{&str, nil}, exp: []interface{}{"hello", nil}},
+		{
+			name: "struct",
+			in:   &apiObject{Name: &str, Count: &num, Enabled: &flag, Any: &num},
+			exp: map[string]interface{}{
+				"Name": "hello", "Count": int64(42), "Enabled": true,
+				"Missing": nil, "Any": int64(42), "Empty": nil,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := NewValue(c.in)
+			require.NoError(t, err)
+			require.Equal(t, c.exp, AsInterface(v))
+		})
+	}
+
+	// the same pointer can appear several times without a cycle
+	_, err := NewValue([]interface{}{&str, &str})
+	require.NoError(t, err)
+}
+
+func TestNewValueSlicesAndArrays(t *testing.T) {
+	type point struct{ X, Y int }
+
+	cases := []struct {
+		name string
+		in   interface{}
+		exp  interface{}
+	}{
+		{name: "ints", in: []int{1, -2}, exp: []interface{}{int64(1), int64(-2)}},
+		{name: "floats", in: []float64{1.5, 2}, exp: []interface{}{1.5, 2.0}},
+		{name: "bools", in: []bool{true, false}, exp: []interface{}{true, false}},
+		{
+			name: "maps",
+			in:   []map[string]interface{}{{"a": 1}, nil},
+			exp:  []interface{}{map[string]interface{}{"a": int64(1)}, map[string]interface{}{}},
+		},
+		{name: "nil slice", in: []int(nil), exp: []interface{}{}},
+		{name: "array", in: [3]string{"a", "b", "c"}, exp: []interface{}{"a", "b", "c"}},
+		{name: "empty array", in: [0]int{}, exp: []interface{}{}},
+		{name: "array of structs", in: [1]point{{X: 1, Y: 2}}, exp: []interface{}{map[string]interface{}{"X": int64(1), "Y": int64(2)}}},
+		{name: "nested arrays", in: [2][2]int{{1, 2}, {3, 4}}, exp: []interface{}{
+			[]interface{}{int64(1), int64(2)},
+			[]interface{}{int64(3), int64(4)},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := NewValue(c.in)
+			require.NoError(t, err)
+			require.Equal(t, c.exp, AsInterface(v))
+		})
+	}
+
+	// the fast paths check the strings like the string values
+	for _, in := range []interface{}{
+		"\xff",
+		[]string{"valid", "\xff"},
+		map[string]string{"key": "\xff"},
+	} {
+		_, err := NewValue(in)
+		require.ErrorContains(t, err, `invalid UTF-8 in string: "\xff"`, "%#v", in)
+	}
+
+	_, err := NewValueWithOptions([]int{1, 2, 3}, WithMaxSize(6))
+	var limitErr *LimitError
+	require.ErrorAs(t, err, &limitErr)
+
+	cyclic := []map[string]interface{}{{}}
+	cyclic[0]["self"] = cyclic
+	_, err = NewValue(cyclic)
+	require.ErrorIs(t, err, ErrCyclicValue)
+}
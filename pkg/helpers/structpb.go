@@ -0,0 +1,119 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"encoding/base64"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// The structpb converters translate between the messages types and the
+// well-known google.protobuf.Struct types, which only have double numbers
+// and no timestamps. Converting to structpb turns all the numbers into
+// doubles, integers beyond 2^53 lose precision, and timestamps into RFC3339
+// strings. Converting from structpb gives float64 numbers. Both directions
+// copy the whole value, the result doesn't share data with the input.
+
+// StructToPB converts st to a structpb.Struct.
+func StructToPB(st *messages.Struct) *structpb.Struct {
+	if st == nil {
+		return nil
+	}
+	out := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(st.GetData()))}
+	for k, v := range st.GetData() {
+		out.Fields[k] = ValueToPB(v)
+	}
+	return out
+}
+
+// ListToPB converts list to a structpb.ListValue.
+func ListToPB(list *messages.ListValue) *structpb.ListValue {
+	if list == nil {
+		return nil
+	}
+	out := &structpb.ListValue{Values: make([]*structpb.Value, len(list.GetValues()))}
+	for i, v := range list.GetValues() {
+		out.Values[i] = ValueToPB(v)
+	}
+	return out
+}
+
+// ValueToPB converts v to a structpb.Value, nil and unset values are
+// converted to null.
+func ValueToPB(v *messages.Value) *structpb.Value {
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_Float64Value:
+		return structpb.NewNumberValue(kind.Float64Value)
+	case *messages.Value_Float32Value:
+		return structpb.NewNumberValue(float64(kind.Float32Value))
+	case *messages.Value_Int32Value:
+		return structpb.NewNumberValue(float64(kind.Int32Value))
+	case *messages.Value_Int64Value:
+		return structpb.NewNumberValue(float64(kind.Int64Value))
+	case *messages.Value_Uint32Value:
+		return structpb.NewNumberValue(float64(kind.Uint32Value))
+	case *messages.Value_Uint64Value:
+		return structpb.NewNumberValue(float64(kind.Uint64Value))
+	case *messages.Value_StringValue:
+		return structpb.NewStringValue(kind.StringValue)
+	case *messages.Value_BoolValue:
+		return structpb.NewBoolValue(kind.BoolValue)
+	case *messages.Value_TimestampValue:
+		return structpb.NewStringValue(kind.TimestampValue.AsTime().Format(time.RFC3339Nano))
+	case *messages.Value_BytesValue:
+		return structpb.NewStringValue(base64.StdEncoding.EncodeToString(kind.BytesValue))
+	case *messages.Value_StructValue:
+		return structpb.NewStructValue(StructToPB(kind.StructValue))
+	case *messages.Value_ListValue:
+		return structpb.NewListValue(ListToPB(kind.ListValue))
+	}
+	return structpb.NewNullValue()
+}
+
+// StructFromPB converts a structpb.Struct to a Struct.
+func StructFromPB(st *structpb.Struct) *messages.Struct {
+	if st == nil {
+		return nil
+	}
+	out := &messages.Struct{Data: make(map[string]*messages.Value, len(st.GetFields()))}
+	for k, v := range st.GetFields() {
+		out.Data[k] = ValueFromPB(v)
+	}
+	return out
+}
+
+// ListFromPB converts a structpb.ListValue to a ListValue.
+func ListFromPB(list *structpb.ListValue) *messages.ListValue {
+	if list == nil {
+		return nil
+	}
+	out := &messages.ListValue{Values: make([]*messages.Value, len(list.GetValues()))}
+	for i, v := range list.GetValues() {
+		out.Values[i] = ValueFromPB(v)
+	}
+	return out
+}
+
+// ValueFromPB converts a structpb.Value to a Value, nil and unset values are
+// converted to null.
+func ValueFromPB(v *structpb.Value) *messages.Value {
+	switch kind := v.GetKind().(type) {
+	case *structpb.Value_NumberValue:
+		return NewFloat64Value(kind.NumberValue)
+	case *structpb.Value_StringValue:
+		return NewStringValue(kind.StringValue)
+	case *structpb.Value_BoolValue:
+		return NewBoolValue(kind.BoolValue)
+	case *structpb.Value_StructValue:
+		return NewStructValue(StructFromPB(kind.StructValue))
+	case *structpb.Value_ListValue:
+		return NewListValue(ListFromPB(kind.ListValue))
+	}
+	return NewNullValue()
+}
@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestStructToPB(t *testing.T) {
+	ts := time.Date(2022, 8, 1, 12, 30, 0, 500, time.UTC)
+	st, err := NewStruct(map[string]interface{}{
+		"int":     int32(-1),
+		"int64":   int64(2),
+		"uint":    uint32(3),
+		"uint64":  uint64(4),
+		"float32": float32(1.5),
+		"float64": 2.5,
+		"string":  "hello",
+		"bool":    true,
+		"null":    nil,
+		"time":    ts,
+		"nested":  map[string]interface{}{"list": []interface{}{"a", 1}},
+	})
+	require.NoError(t, err)
+
+	expected, err := structpb.NewStruct(map[string]interface{}{
+		"int":     -1,
+		"int64":   2,
+		"uint":    3,
+		"uint64":  4,
+		"float32": 1.5,
+		"float64": 2.5,
+		"string":  "hello",
+		"bool":    true,
+		"null":    nil,
+		"time":    "2022-08-01T12:30:00.0000005Z",
+		"nested":  map[string]interface{}{"list": []interface{}{"a", 1}},
+	})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(expected, StructToPB(st)), "got %v", StructToPB(st))
+
+	require.Nil(t, StructToPB(nil))
+	require.Nil(t, ListToPB(nil))
+	require.Equal(t, structpb.NewNullValue(), ValueToPB(nil))
+}
+
+func TestStructFromPB(t *testing.T) {
+	in, err := structpb.NewStruct(map[string]interface{}{
+		"number": 42,
+		"string": "hello",
+		"bool":   false,
+		"null":   nil,
+		"nested": map[string]interface{}{"list": []interface{}{"a", 1.5}},
+	})
+	require.NoError(t, err)
+
+	st := StructFromPB(in)
+	require.Equal(t, map[string]interface{}{
+		"number": 42.0,
+		"string": "hello",
+		"bool":   false,
+		"null":   nil,
+		"nested": map[string]interface{}{"list": []interface{}{"a", 1.5}},
+	}, AsMap(st))
+
+	// no data is shared with the input
+	in.Fields["nested"].GetStructValue().Fields["list"].GetListValue().Values[0] = structpb.NewStringValue("b")
+	nested, err := GetField(st, "nested.list")
+	require.NoError(t, err)
+	require.Equal(t, "a", nested.GetListValue().Values[0].GetStringValue())
+
+	require.True(t, proto.Equal(in, StructToPB(StructFromPB(in))), "structpb values must round trip")
+	require.Nil(t, StructFromPB(nil))
+	require.Nil(t, ListFromPB(nil))
+	require.Equal(t, NewNullValue(), ValueFromPB(nil))
+	require.True(t, proto.Equal(&messages.Value{Kind: &messages.Value_NullValue{}}, ValueFromPB(&structpb.Value{})))
+}
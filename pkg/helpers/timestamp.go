@@ -0,0 +1,167 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrInvalidTimestamp is returned for times no layout of a TimestampParser
+// can parse.
+var ErrInvalidTimestamp = errors.New("invalid timestamp")
+
+// Layouts of the times since the Unix epoch, in seconds, milliseconds,
+// microseconds and nanoseconds, named like in the beats timestamp processor.
+const (
+	LayoutUnix   = "UNIX"
+	LayoutUnixMs = "UNIX_MS"
+	LayoutUnixUs = "UNIX_US"
+	LayoutUnixNs = "UNIX_NS"
+)
+
+// LayoutSyslog is the time of the RFC 3164 syslog messages, like
+// "Jan  2 15:04:05", which has no year. RFC 5424 messages use RFC 3339.
+const LayoutSyslog = time.Stamp
+
+// epochUnits are the durations of the units of the epoch layouts.
+var epochUnits = map[string]time.Duration{
+	LayoutUnix:   time.Second,
+	LayoutUnixMs: time.Millisecond,
+	LayoutUnixUs: time.Microsecond,
+	LayoutUnixNs: time.Nanosecond,
+}
+
+// TimestampParserConfig configures a TimestampParser.
+type TimestampParserConfig struct {
+	// Layouts are tried in order, they are time package layouts or the
+	// epoch layouts, like LayoutUnixMs. Defaults to time.RFC3339Nano and
+	// LayoutSyslog.
+	Layouts []string
+	// Location is the time zone of the times without one, defaults to UTC.
+	Location *time.Location
+	// Clock gives the year of the times without one, the current year or
+	// the previous one if the time would be more than a day in the future.
+	// Defaults to clock.Real.
+	Clock clock.Clock
+}
+
+// TimestampParser parses the times of the events in the formats of their
+// sources. It is safe for concurrent use.
+type TimestampParser struct {
+	config TimestampParserConfig
+}
+
+// NewTimestampParser returns a TimestampParser, zero values in config are
+// replaced by their defaults.
+func NewTimestampParser(config TimestampParserConfig) *TimestampParser {
+	if len(config.Layouts) == 0 {
+		config.Layouts = []string{time.RFC3339Nano, LayoutSyslog}
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+	return &TimestampParser{config: config}
+}
+
+// Parse parses s with the first layout that matches, surrounding spaces
+// ignored.
+func (p *TimestampParser) Parse(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range p.config.Layouts {
+		if unit, ok := epochUnits[layout]; ok {
+			if ts, ok := parseEpoch(s, unit); ok {
+				return ts, nil
+			}
+			continue
+		}
+		ts, err := time.ParseInLocation(layout, s, p.config.Location)
+		if err != nil {
+			continue
+		}
+		if ts.Year() == 0 {
+			ts = p.withYear(ts)
+		}
+		return ts, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q doesn't match the layouts %s", ErrInvalidTimestamp, s, strings.Join(p.config.Layouts, ", "))
+}
+
+// ParseValue parses timestamps, strings, and numbers with the first epoch
+// layout.
+func (p *TimestampParser) ParseValue(v *messages.Value) (time.Time, error) {
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_TimestampValue:
+		return kind.TimestampValue.AsTime(), nil
+	case *messages.Value_StringValue:
+		return p.Parse(kind.StringValue)
+	}
+	if _, ok := asFloat(v); !ok {
+		return time.Time{}, fmt.Errorf("%w: expected a timestamp, a string or a number, got %s", ErrInvalidTimestamp, kindName(v))
+	}
+	for _, layout := range p.config.Layouts {
+		unit, ok := epochUnits[layout]
+		if !ok {
+			continue
+		}
+		if n, err := AsTyped[int64](v); err == nil {
+			if ts, ok := epochTime(float64(n), n, unit); ok {
+				return ts, nil
+			}
+		} else if f, _ := asFloat(v); !math.IsInf(f, 0) {
+			if ts, ok := epochTime(f, 0, unit); ok {
+				return ts, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("%w: %s is out of range", ErrInvalidTimestamp, AsInterface(v))
+	}
+	return time.Time{}, fmt.Errorf("%w: no epoch layout for the number %v", ErrInvalidTimestamp, AsInterface(v))
+}
+
+// withYear sets the year of ts, which was parsed without one.
+func (p *TimestampParser) withYear(ts time.Time) time.Time {
+	now := p.config.Clock.Now().In(ts.Location())
+	withYear := ts.AddDate(now.Year(), 0, 0)
+	if withYear.After(now.Add(24 * time.Hour)) {
+		withYear = ts.AddDate(now.Year()-1, 0, 0)
+	}
+	return withYear
+}
+
+// parseEpoch parses the integer or decimal number of units since the
+// epoch in s.
+func parseEpoch(s string, unit time.Duration) (time.Time, bool) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return epochTime(float64(n), n, unit)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return time.Time{}, false
+	}
+	return epochTime(f, 0, unit)
+}
+
+// epochTime returns the time f units after the epoch. n is f as an integer
+// when it is one, to keep the precision of the nanoseconds.
+func epochTime(f float64, n int64, unit time.Duration) (time.Time, bool) {
+	if math.Abs(f) >= math.MaxInt64/float64(unit) {
+		return time.Time{}, false
+	}
+	if float64(n) == f {
+		return time.Unix(0, n*int64(unit)).UTC(), true
+	}
+	whole := math.Trunc(f)
+	return time.Unix(0, int64(whole)*int64(unit)+int64((f-whole)*float64(unit))).UTC(), true
+}
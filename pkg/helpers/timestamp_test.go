@@ -0,0 +1,100 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+)
+
+func TestTimestampParser(t *testing.T) {
+	now := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	p := NewTimestampParser(TimestampParserConfig{
+		Layouts:  []string{time.RFC3339Nano, LayoutSyslog, "2006-01-02 15:04:05", LayoutUnixMs},
+		Location: time.FixedZone("CET", 60*60),
+		Clock:    clock.NewFake(now),
+	})
+
+	cases := map[string]time.Time{
+		"2022-07-01T10:00:00.5Z": time.Date(2022, 7, 1, 10, 0, 0, 500_000_000, time.UTC),
+		"Jan  1 10:30:00":        time.Date(2023, 1, 1, 9, 30, 0, 0, time.UTC),
+		"Dec 31 23:00:00.250":    time.Date(2022, 12, 31, 22, 0, 0, 250_000_000, time.UTC),
+		" 2022-07-01 10:00:00 ":  time.Date(2022, 7, 1, 9, 0, 0, 0, time.UTC),
+		"1656669600000":          time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC),
+		"1656669600000.5":        time.Date(2022, 7, 1, 10, 0, 0, 500_000, time.UTC),
+	}
+	for s, want := range cases {
+		ts, err := p.Parse(s)
+		require.NoError(t, err, s)
+		require.True(t, want.Equal(ts), "%s: %s", s, ts)
+	}
+
+	// the syslog time of the next days is from last year
+	ts, err := p.Parse("Dec 30 10:00:00")
+	require.NoError(t, err)
+	require.Equal(t, 2022, ts.Year())
+
+	_, err = p.Parse("yesterday")
+	require.ErrorIs(t, err, ErrInvalidTimestamp)
+}
+
+func TestTimestampParserEpoch(t *testing.T) {
+	want := time.Date(2022, 7, 1, 10, 0, 0, 123456789, time.UTC)
+	for layout, s := range map[string]string{
+		LayoutUnix:   "1656669600.123456789",
+		LayoutUnixMs: "1656669600123.456789",
+		LayoutUnixUs: "1656669600123456.789",
+		LayoutUnixNs: "1656669600123456789",
+	} {
+		p := NewTimestampParser(TimestampParserConfig{Layouts: []string{layout}})
+		ts, err := p.Parse(s)
+		require.NoError(t, err, layout)
+		require.WithinDuration(t, want, ts, time.Microsecond, layout)
+	}
+
+	p := NewTimestampParser(TimestampParserConfig{Layouts: []string{time.RFC3339, LayoutUnixNs}})
+	ts, err := p.ParseValue(NewInt64Value(1656669600123456789))
+	require.NoError(t, err)
+	require.Equal(t, want, ts, "integers keep the nanoseconds")
+	ts, err = p.ParseValue(NewTimestampValue(want))
+	require.NoError(t, err)
+	require.True(t, want.Equal(ts))
+
+	_, err = p.ParseValue(NewFloat64Value(1e300))
+	require.ErrorIs(t, err, ErrInvalidTimestamp)
+	_, err = p.ParseValue(NewBoolValue(true))
+	require.ErrorIs(t, err, ErrInvalidTimestamp)
+	_, err = NewTimestampParser(TimestampParserConfig{}).ParseValue(NewInt64Value(1))
+	require.ErrorIs(t, err, ErrInvalidTimestamp, "no epoch layout")
+}
+
+func TestEventBuilderTimestampField(t *testing.T) {
+	now := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	builder := NewEventBuilder().
+		SetClock(clock.NewFake(now)).
+		SetTimestampField("log.time", nil).
+		SetSource("log-1", "").
+		SetDataStream("logs", "generic", "default")
+
+	e, err := builder.Build()
+	require.NoError(t, err)
+	require.True(t, now.Equal(e.Timestamp.AsTime()), "missing fields fall back to the clock")
+
+	e, err = builder.AddField("log", map[string]interface{}{"time": "2022-07-01T10:00:00Z"}).Build()
+	require.NoError(t, err)
+	require.True(t, time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC).Equal(e.Timestamp.AsTime()))
+	require.Contains(t, e.Fields.Data, "log")
+
+	_, err = builder.AddField("log", map[string]interface{}{"time": "now"}).Build()
+	require.ErrorIs(t, err, ErrInvalidTimestamp)
+
+	e, err = builder.SetTimestamp(now.Add(time.Hour)).Build()
+	require.NoError(t, err)
+	require.True(t, now.Add(time.Hour).Equal(e.Timestamp.AsTime()))
+}
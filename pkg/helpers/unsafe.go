@@ -0,0 +1,60 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"unsafe"
+)
+
+// WithUnsafeStrings converts byte slices to string values sharing their
+// memory, instead of base64 strings, so log lines read into buffers are
+// shipped as text without a copy. It takes precedence over
+// WithBytesWrapper: the strings are not wrapped. With WithBytesKind, byte
+// slices are converted to bytes values sharing their memory instead. The
+// text of encoding.TextMarshaler values is not copied either.
+//
+// The caller must own the buffers and leave them untouched until the values
+// are not used anymore, typically after they are published: a buffer
+// modified or reused for the next line changes the strings of the values
+// already converted, which Go assumes never happens, breaking the maps
+// they are keys of, among others. The byte slices must be valid UTF-8,
+// like strings.
+func WithUnsafeStrings() Option {
+	return func(o *options) {
+		o.unsafeStrings = true
+	}
+}
+
+// WithUnsafeBytes converts string values to byte slices sharing their
+// memory, the reverse of WithUnsafeStrings, so the text of the events is
+// written out without a copy. The byte slices must not be modified: Go
+// assumes strings never change, and the values may share their strings with
+// other values or maps.
+func WithUnsafeBytes() InterfaceOption {
+	return func(o *interfaceOptions) {
+		o.unsafeBytes = true
+	}
+}
+
+// UnsafeString returns a string sharing the memory of b, which must not be
+// modified as long as the string is used.
+func UnsafeString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+// UnsafeBytes returns a byte slice sharing the memory of s, which must not
+// be modified.
+func UnsafeBytes(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	return *(*[]byte)(unsafe.Pointer(&struct {
+		string
+		cap int
+	}{s, len(s)}))
+}
@@ -0,0 +1,81 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsafeStrings(t *testing.T) {
+	line := []byte("GET /index.html")
+	v, err := NewValueWithOptions(line, WithUnsafeStrings())
+	require.NoError(t, err)
+	require.Equal(t, "GET /index.html", v.GetStringValue())
+
+	// the value shares the memory of the buffer
+	line[0] = 'P'
+	require.Equal(t, "PET /index.html", v.GetStringValue())
+
+	_, err = NewValueWithOptions([]byte{0xff}, WithUnsafeStrings())
+	require.Error(t, err)
+
+	v, err = NewValueWithOptions(line, WithUnsafeStrings(), WithBytesKind())
+	require.NoError(t, err)
+	line[0] = 'G'
+	require.Equal(t, line, v.GetBytesValue())
+	require.Same(t, &line[0], &v.GetBytesValue()[0])
+
+	// the strings are not wrapped
+	v, err = NewValueWithOptions(line, WithUnsafeStrings(), WithBytesWrapper())
+	require.NoError(t, err)
+	require.Equal(t, "GET /index.html", v.GetStringValue())
+
+	v, err = NewValueWithOptions(net.ParseIP("10.0.0.1"), WithUnsafeStrings())
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1", v.GetStringValue())
+
+	// without the option, byte slices are still copied to base64 strings
+	v, err = NewValue(line)
+	require.NoError(t, err)
+	require.Equal(t, "R0VUIC9pbmRleC5odG1s", v.GetStringValue())
+}
+
+func TestUnsafeString(t *testing.T) {
+	b := []byte("hello")
+	s := UnsafeString(b)
+	require.Equal(t, "hello", s)
+	b[0] = 'j'
+	require.Equal(t, "jello", s)
+
+	require.Equal(t, "", UnsafeString(nil))
+
+	require.Equal(t, []byte("jello"), UnsafeBytes(s))
+	require.Len(t, UnsafeBytes(s), 5)
+	require.Equal(t, 5, cap(UnsafeBytes(s)))
+	require.Same(t, &b[0], &UnsafeBytes(s)[0])
+	require.Nil(t, UnsafeBytes(""))
+}
+
+func TestUnsafeBytes(t *testing.T) {
+	line := []byte("GET /index.html")
+	st, err := NewStructWithOptions(map[string]interface{}{
+		"message": line,
+		"tags":    []string{"web"},
+	}, WithUnsafeStrings())
+	require.NoError(t, err)
+
+	// the bytes are the ones of the line, not a copy
+	m := AsMapWithOptions(st, WithUnsafeBytes())
+	message, ok := m["message"].([]byte)
+	require.True(t, ok)
+	require.Same(t, &line[0], &message[0])
+	require.Equal(t, []interface{}{[]byte("web")}, m["tags"])
+
+	// the other values are converted as usual
+	require.Equal(t, int64(1), AsInterfaceWithOptions(NewInt64Value(1), WithUnsafeBytes()))
+}
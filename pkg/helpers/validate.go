@@ -0,0 +1,228 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+var (
+	// ErrMissingField is returned for required fields that are not set.
+	ErrMissingField = errors.New("missing required field")
+	// ErrInvalidUTF8 is returned for keys and strings that are not valid UTF-8.
+	ErrInvalidUTF8 = errors.New("invalid UTF-8")
+)
+
+// FieldError is the validation failure of a single field.
+type FieldError struct {
+	// Path is the dotted path of the field in the event, like
+	// "fields.http.status_code" or "fields.tags[1]".
+	Path string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError aggregates the failures found by a Validator, sorted by
+// path. errors.Is matches any of them, and ErrInvalidEvent.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "invalid event: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	if target == ErrInvalidEvent {
+		return true
+	}
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Constraint checks the value of a field, v is nil when the field is not set.
+type Constraint func(v *messages.Value) error
+
+// Required fails when the field is not set.
+func Required() Constraint {
+	return func(v *messages.Value) error {
+		if v == nil {
+			return ErrMissingField
+		}
+		return nil
+	}
+}
+
+// MaxLength fails for strings longer than n bytes, other values are ignored.
+func MaxLength(n int) Constraint {
+	return func(v *messages.Value) error {
+		if s, ok := v.GetKind().(*messages.Value_StringValue); ok && len(s.StringValue) > n {
+			return fmt.Errorf("string of %d bytes exceeds the maximum of %d", len(s.StringValue), n)
+		}
+		return nil
+	}
+}
+
+// ValidatorOption configures a Validator.
+type ValidatorOption func(*Validator)
+
+// WithConstraint checks the field at the dotted path of the event fields
+// with c. Several constraints can be set for the same field.
+func WithConstraint(path string, c Constraint) ValidatorOption {
+	return func(v *Validator) {
+		v.constraints = append(v.constraints, fieldConstraint{path: path, check: c})
+	}
+}
+
+// WithMaxErrors stops the validation after n failures, zero reports all of
+// them.
+func WithMaxErrors(n int) ValidatorOption {
+	return func(v *Validator) {
+		v.maxErrors = n
+	}
+}
+
+type fieldConstraint struct {
+	path  string
+	check Constraint
+}
+
+// Validator checks events before they are published: the fields required by
+// the shipper must be set, all the keys and strings must be valid UTF-8, and
+// the fields must meet the constraints of the validator.
+// It is safe for concurrent use.
+type Validator struct {
+	constraints  []fieldConstraint
+	maxErrors    int
+	uuidIdentity bool
+}
+
+// NewValidator returns a Validator with the given options.
+func NewValidator(opts ...ValidatorOption) *Validator {
+	v := &Validator{}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Validate returns a *ValidationError with all the failures found in the
+// event, or nil if it is valid.
+func (v *Validator) Validate(e *messages.Event) error {
+	if e == nil {
+		e = &messages.Event{}
+	}
+	r := &validationRun{maxErrors: v.maxErrors}
+
+	for _, name := range missingFields(e) {
+		r.add(name, ErrMissingField)
+	}
+	r.checkString("source.input_id", e.Source.GetInputId())
+	r.checkString("source.stream_id", e.Source.GetStreamId())
+	r.checkString("data_stream.type", e.DataStream.GetType())
+	r.checkString("data_stream.dataset", e.DataStream.GetDataset())
+	r.checkString("data_stream.namespace", e.DataStream.GetNamespace())
+	r.checkStruct("metadata", e.Metadata)
+	r.checkStruct("fields", e.Fields)
+	if v.uuidIdentity {
+		r.checkIdentity(e)
+	}
+
+	for _, c := range v.constraints {
+		if r.full() {
+			break
+		}
+		field, err := GetField(e.Fields, c.path)
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			r.add("fields."+c.path, err)
+			continue
+		}
+		if err := c.check(field); err != nil {
+			r.add("fields."+c.path, err)
+		}
+	}
+
+	if len(r.errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(r.errs, func(i, j int) bool {
+		return r.errs[i].Path < r.errs[j].Path
+	})
+	return &ValidationError{Errors: r.errs}
+}
+
+// validationRun collects the failures of a single validation.
+type validationRun struct {
+	errs      []*FieldError
+	maxErrors int
+}
+
+func (r *validationRun) full() bool {
+	return r.maxErrors > 0 && len(r.errs) >= r.maxErrors
+}
+
+func (r *validationRun) add(path string, err error) {
+	if !r.full() {
+		r.errs = append(r.errs, &FieldError{Path: path, Err: err})
+	}
+}
+
+func (r *validationRun) checkString(path, s string) {
+	if !utf8.ValidString(s) {
+		r.add(path, ErrInvalidUTF8)
+	}
+}
+
+func (r *validationRun) checkStruct(path string, st *messages.Struct) {
+	for key, v := range st.GetData() {
+		if r.full() {
+			return
+		}
+		if !utf8.ValidString(key) {
+			// the key can't be printed, the path points to its parent
+			r.add(path, fmt.Errorf("key %q: %w", key, ErrInvalidUTF8))
+			continue
+		}
+		r.checkValue(path+"."+key, v)
+	}
+}
+
+func (r *validationRun) checkValue(path string, v *messages.Value) {
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_StringValue:
+		r.checkString(path, kind.StringValue)
+	case *messages.Value_StructValue:
+		r.checkStruct(path, kind.StructValue)
+	case *messages.Value_ListValue:
+		for i, item := range kind.ListValue.GetValues() {
+			if r.full() {
+				return
+			}
+			r.checkValue(path+"["+strconv.Itoa(i)+"]", item)
+		}
+	}
+}
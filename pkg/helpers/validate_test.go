@@ -0,0 +1,126 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func validTestEvent(t *testing.T, fields map[string]interface{}) *messages.Event {
+	b := NewEventBuilder().
+		SetTimestamp(time.Now()).
+		SetSource("input-1", "").
+		SetDataStream("logs", "generic", "default")
+	for k, v := range fields {
+		b.AddField(k, v)
+	}
+	e, err := b.Build()
+	require.NoError(t, err)
+	return e
+}
+
+func TestValidator(t *testing.T) {
+	invalid := string([]byte{0xff, 0xfe})
+
+	cases := []struct {
+		name   string
+		opts   []ValidatorOption
+		event  func(t *testing.T) *messages.Event
+		paths  []string
+		target error
+	}{
+		{
+			name: "valid",
+			event: func(t *testing.T) *messages.Event {
+				return validTestEvent(t, map[string]interface{}{"message": "hello"})
+			},
+		},
+		{
+			name: "missing required fields",
+			event: func(t *testing.T) *messages.Event {
+				return &messages.Event{DataStream: &messages.DataStream{Type: "logs"}}
+			},
+			paths:  []string{"data_stream.dataset", "data_stream.namespace", "source.input_id", "timestamp"},
+			target: ErrMissingField,
+		},
+		{
+			name: "invalid UTF-8 in nested strings",
+			event: func(t *testing.T) *messages.Event {
+				// NewValue rejects invalid strings, they can only be set directly
+				e := validTestEvent(t, nil)
+				e.Fields.Data["message"] = NewStringValue(invalid)
+				e.Fields.Data["http"] = NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+					"method": NewStringValue(invalid),
+				}})
+				e.Fields.Data["tags"] = NewListValue(&messages.ListValue{Values: []*messages.Value{
+					NewStringValue("ok"), NewStringValue(invalid),
+				}})
+				e.DataStream.Dataset = invalid
+				return e
+			},
+			paths:  []string{"data_stream.dataset", "fields.http.method", "fields.message", "fields.tags[1]"},
+			target: ErrInvalidUTF8,
+		},
+		{
+			name: "invalid UTF-8 in keys",
+			event: func(t *testing.T) *messages.Event {
+				e := validTestEvent(t, nil)
+				e.Metadata.Data[invalid] = NewStringValue("value")
+				return e
+			},
+			paths:  []string{"metadata"},
+			target: ErrInvalidUTF8,
+		},
+		{
+			name: "constraints",
+			opts: []ValidatorOption{
+				WithConstraint("host.name", Required()),
+				WithConstraint("message", MaxLength(5)),
+				WithConstraint("message", Required()),
+				WithConstraint("message.text", Required()),
+			},
+			event: func(t *testing.T) *messages.Event {
+				return validTestEvent(t, map[string]interface{}{"message": "too long"})
+			},
+			paths: []string{"fields.host.name", "fields.message", "fields.message.text"},
+		},
+		{
+			name: "max errors",
+			opts: []ValidatorOption{WithMaxErrors(2)},
+			event: func(t *testing.T) *messages.Event {
+				return nil
+			},
+			paths:  []string{"source.input_id", "timestamp"},
+			target: ErrMissingField,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := NewValidator(tc.opts...).Validate(tc.event(t))
+			if tc.paths == nil {
+				require.NoError(t, err)
+				return
+			}
+			var verr *ValidationError
+			require.True(t, errors.As(err, &verr), "expected a ValidationError, got %v", err)
+			paths := make([]string, len(verr.Errors))
+			for i, fe := range verr.Errors {
+				paths[i] = fe.Path
+				require.Contains(t, err.Error(), fe.Path)
+			}
+			require.Equal(t, tc.paths, paths)
+			require.ErrorIs(t, err, ErrInvalidEvent)
+			if tc.target != nil {
+				require.ErrorIs(t, err, tc.target)
+			}
+		})
+	}
+}
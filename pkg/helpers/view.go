@@ -0,0 +1,194 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// EventView gives read access to an event shared with other views, and
+// copies the parts it modifies on write: putting "host.name" copies the
+// event, its fields struct and the host struct, but not their other values.
+// The event passed to NewEventView is never modified, so processors running
+// concurrently can each get a view of it with Fork, without data races or
+// deep copies.
+//
+// A single view is not safe for concurrent use. The values returned by the
+// accessors, and the event returned by Event, may be shared with other views
+// and must not be modified in place: replace them with the setters instead.
+type EventView struct {
+	event *messages.Event
+	// ownEvent is true once event is a copy made by this view
+	ownEvent bool
+	// owned holds the structs copied by this view, which it can modify
+	owned map[*messages.Struct]bool
+}
+
+// NewEventView returns a view of e, which is not copied.
+func NewEventView(e *messages.Event) *EventView {
+	return &EventView{event: e}
+}
+
+// Fork returns a new view of the current state of v. Both views share it, so
+// the next changes of either view copy what they modify again.
+func (v *EventView) Fork() *EventView {
+	v.ownEvent = false
+	v.owned = nil
+	return &EventView{event: v.event}
+}
+
+// Event returns the event with the changes made through the view. It may be
+// shared with other views and must not be modified, use Fork or CloneEvent
+// to get a copy that can be.
+func (v *EventView) Event() *messages.Event {
+	return v.event
+}
+
+// Timestamp returns the creation time of the event, zero if unset.
+func (v *EventView) Timestamp() time.Time {
+	if v.event.GetTimestamp() == nil {
+		return time.Time{}
+	}
+	return v.event.GetTimestamp().AsTime()
+}
+
+// Source returns the input and stream IDs of the event.
+func (v *EventView) Source() (inputID, streamID string) {
+	return v.event.GetSource().GetInputId(), v.event.GetSource().GetStreamId()
+}
+
+// DataStream returns the data stream the event is routed to.
+func (v *EventView) DataStream() (typ, dataset, namespace string) {
+	ds := v.event.GetDataStream()
+	return ds.GetType(), ds.GetDataset(), ds.GetNamespace()
+}
+
+// GetField returns the field at the dotted path, see GetField.
+func (v *EventView) GetField(key string) (*messages.Value, error) {
+	return GetField(v.event.GetFields(), key)
+}
+
+// GetMetadata returns the metadata field at the dotted path, see GetField.
+func (v *EventView) GetMetadata(key string) (*messages.Value, error) {
+	return GetField(v.event.GetMetadata(), key)
+}
+
+// SetTimestamp sets the creation time of the event.
+func (v *EventView) SetTimestamp(ts time.Time) {
+	v.mutableEvent().Timestamp = timestamppb.New(ts)
+}
+
+// SetSource sets the input and stream that generated the event.
+func (v *EventView) SetSource(inputID, streamID string) {
+	v.mutableEvent().Source = &messages.Source{InputId: inputID, StreamId: streamID}
+}
+
+// SetDataStream sets the data stream the event is routed to.
+func (v *EventView) SetDataStream(typ, dataset, namespace string) {
+	v.mutableEvent().DataStream = &messages.DataStream{Type: typ, Dataset: dataset, Namespace: namespace}
+}
+
+// PutField sets the field at the dotted path and returns the previous value,
+// if any, see PutField.
+func (v *EventView) PutField(key string, value *messages.Value) (*messages.Value, error) {
+	return v.put(&v.mutableEvent().Fields, key, value)
+}
+
+// PutMetadata sets the metadata field at the dotted path and returns the
+// previous value, if any, see PutField.
+func (v *EventView) PutMetadata(key string, value *messages.Value) (*messages.Value, error) {
+	return v.put(&v.mutableEvent().Metadata, key, value)
+}
+
+// DeleteField removes the field at the dotted path, see DeleteField.
+func (v *EventView) DeleteField(key string) error {
+	if _, err := v.GetField(key); err != nil {
+		return err
+	}
+	_, err := v.put(&v.mutableEvent().Fields, key, nil)
+	return err
+}
+
+// DeleteMetadata removes the metadata field at the dotted path, see
+// DeleteField.
+func (v *EventView) DeleteMetadata(key string) error {
+	if _, err := v.GetMetadata(key); err != nil {
+		return err
+	}
+	_, err := v.put(&v.mutableEvent().Metadata, key, nil)
+	return err
+}
+
+// mutableEvent returns the event after making a shallow copy of it if it is
+// shared.
+func (v *EventView) mutableEvent() *messages.Event {
+	if !v.ownEvent {
+		e := v.event
+		v.event = &messages.Event{
+			Timestamp:  e.GetTimestamp(),
+			Source:     e.GetSource(),
+			DataStream: e.GetDataStream(),
+			Metadata:   e.GetMetadata(),
+			Fields:     e.GetFields(),
+		}
+		v.ownEvent = true
+	}
+	return v.event
+}
+
+// mutableStruct returns a struct owned by the view with the fields of st,
+// st itself if it already is.
+func (v *EventView) mutableStruct(st *messages.Struct) *messages.Struct {
+	if st != nil && v.owned[st] {
+		return st
+	}
+	copied := &messages.Struct{Data: make(map[string]*messages.Value, len(st.GetData())+1)}
+	for k, val := range st.GetData() {
+		copied.Data[k] = val
+	}
+	if v.owned == nil {
+		v.owned = map[*messages.Struct]bool{}
+	}
+	v.owned[copied] = true
+	return copied
+}
+
+// put copies the structs along the path and sets the value of its last key
+// in the copy, deleting it when value is nil.
+func (v *EventView) put(root **messages.Struct, key string, value *messages.Value) (*messages.Value, error) {
+	keys := strings.Split(key, ".")
+	st := v.mutableStruct(*root)
+	*root = st
+	for i, k := range keys[:len(keys)-1] {
+		current, ok := st.Data[k]
+		var next *messages.Struct
+		if ok {
+			next = current.GetStructValue()
+			if next == nil {
+				return nil, fmt.Errorf("expected a struct at %s, got %T", strings.Join(keys[:i+1], "."), current.GetKind())
+			}
+		}
+		copied := v.mutableStruct(next)
+		if copied != next {
+			// the Value holding the struct may be shared too
+			st.Data[k] = NewStructValue(copied)
+		}
+		st = copied
+	}
+	last := keys[len(keys)-1]
+	old := st.Data[last]
+	if value == nil {
+		delete(st.Data, last)
+	} else {
+		st.Data[last] = value
+	}
+	return old, nil
+}
@@ -0,0 +1,106 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEventViewCopyOnWrite(t *testing.T) {
+	e := cloneTestEvent(t)
+	original := CloneEvent(e)
+	v := NewEventView(e)
+
+	require.Same(t, e, v.Event())
+	name, err := v.GetField("host.name")
+	require.NoError(t, err)
+	require.Equal(t, "web-1", name.GetStringValue())
+
+	old, err := v.PutField("host.name", NewStringValue("web-2"))
+	require.NoError(t, err)
+	require.Equal(t, "web-1", old.GetStringValue())
+	_, err = v.PutField("user.name", NewStringValue("alice"))
+	require.NoError(t, err)
+	require.NoError(t, v.DeleteField("message"))
+	_, err = v.PutMetadata("pipeline", NewStringValue("other"))
+	require.NoError(t, err)
+	v.SetTimestamp(time.Unix(10, 0))
+	v.SetDataStream("metrics", "system.cpu", "prod")
+
+	// the original event is untouched
+	require.True(t, proto.Equal(original, e))
+
+	got := v.Event()
+	require.NotSame(t, e, got)
+	require.Equal(t, "web-2", AsMap(got.Fields)["host"].(map[string]interface{})["name"])
+	require.Equal(t, "alice", AsMap(got.Fields)["user"].(map[string]interface{})["name"])
+	require.NotContains(t, got.Fields.Data, "message")
+	require.Equal(t, time.Unix(10, 0).UTC(), v.Timestamp())
+	typ, dataset, namespace := v.DataStream()
+	require.Equal(t, []string{"metrics", "system.cpu", "prod"}, []string{typ, dataset, namespace})
+	input, stream := v.Source()
+	require.Equal(t, []string{"input-1", "stream-1"}, []string{input, stream})
+
+	// the untouched values are shared, not copied
+	require.Same(t, e.Fields.Data["http"], got.Fields.Data["http"])
+	require.Same(t, e.Fields.Data["host"].GetStructValue().Data["ip"], got.Fields.Data["host"].GetStructValue().Data["ip"])
+
+	// a struct copied once is modified in place by the next changes
+	host := got.Fields.Data["host"].GetStructValue()
+	_, err = v.PutField("host.id", NewStringValue("1"))
+	require.NoError(t, err)
+	require.Same(t, host, v.Event().Fields.Data["host"].GetStructValue())
+
+	_, err = v.PutField("message.text", NewStringValue("x"))
+	require.NoError(t, err)
+	_, err = v.PutField("ok.text", NewStringValue("x"))
+	require.Error(t, err)
+	require.ErrorIs(t, v.DeleteField("nope"), ErrKeyNotFound)
+}
+
+func TestEventViewFork(t *testing.T) {
+	v := NewEventView(cloneTestEvent(t))
+	_, err := v.PutField("host.name", NewStringValue("web-2"))
+	require.NoError(t, err)
+
+	fork := v.Fork()
+	_, err = fork.PutField("host.name", NewStringValue("web-3"))
+	require.NoError(t, err)
+	_, err = v.PutField("host.name", NewStringValue("web-4"))
+	require.NoError(t, err)
+
+	name, _ := fork.GetField("host.name")
+	require.Equal(t, "web-3", name.GetStringValue())
+	name, _ = v.GetField("host.name")
+	require.Equal(t, "web-4", name.GetStringValue())
+}
+
+func TestEventViewConcurrent(t *testing.T) {
+	e := cloneTestEvent(t)
+	original := CloneEvent(e)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v := NewEventView(e)
+			for j := 0; j < 100; j++ {
+				_, err := v.PutField("host.name", NewStringValue(fmt.Sprint(i, j)))
+				require.NoError(t, err)
+				_, err = v.GetField("http.response.status_code")
+				require.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.True(t, proto.Equal(original, e))
+}
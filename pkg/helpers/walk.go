@@ -0,0 +1,81 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrSkipChildren can be returned by a WalkFunc to skip the fields or items of
+// the current value, like filepath.SkipDir. It's not returned by Walk.
+var ErrSkipChildren = errors.New("skip children")
+
+// WalkFunc is called by Walk for every value. path holds the struct keys and
+// list indexes leading to the value, it is reused between calls and must be
+// copied to be retained. The value can be modified in place, its children
+// are visited after fn returns.
+type WalkFunc func(path []string, v *messages.Value) error
+
+// Walk calls fn for v and then for every nested value, depth first. Struct
+// fields are visited in key order, list items in their order, with their
+// index in the path. It stops at the first error returned by fn, other than
+// ErrSkipChildren, and returns it.
+func Walk(v *messages.Value, fn WalkFunc) error {
+	return walkValue(make([]string, 0, 8), v, fn)
+}
+
+// WalkStruct is like Walk for every field of st, the struct itself is not
+// passed to fn. Walking the fields of an event gives the same paths as the
+// field accessors.
+func WalkStruct(st *messages.Struct, fn WalkFunc) error {
+	return walkStruct(make([]string, 0, 8), st, fn)
+}
+
+func walkValue(path []string, v *messages.Value, fn WalkFunc) error {
+	if v == nil {
+		return nil
+	}
+	if err := fn(path, v); err != nil {
+		if errors.Is(err, ErrSkipChildren) {
+			return nil
+		}
+		return err
+	}
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_StructValue:
+		return walkStruct(path, kind.StructValue, fn)
+	case *messages.Value_ListValue:
+		for i, item := range kind.ListValue.GetValues() {
+			if err := walkValue(append(path, strconv.Itoa(i)), item, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func walkStruct(path []string, st *messages.Struct, fn WalkFunc) error {
+	data := st.GetData()
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// fn may have removed a sibling
+		v, ok := data[key]
+		if !ok {
+			continue
+		}
+		if err := walkValue(append(path, key), v, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
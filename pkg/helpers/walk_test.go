@@ -0,0 +1,84 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestWalk(t *testing.T) {
+	st, err := NewStruct(map[string]interface{}{
+		"message": "hello",
+		"host":    map[string]interface{}{"name": "web-1", "ip": []interface{}{"10.0.0.1", "10.0.0.2"}},
+		"user":    map[string]interface{}{"name": "alice", "password": "secret"},
+	})
+	require.NoError(t, err)
+
+	visited := func(skip string, stop string) ([]string, error) {
+		var paths []string
+		err := WalkStruct(st, func(path []string, v *messages.Value) error {
+			p := strings.Join(path, ".")
+			paths = append(paths, p)
+			switch p {
+			case skip:
+				return ErrSkipChildren
+			case stop:
+				return errors.New("stop")
+			}
+			return nil
+		})
+		return paths, err
+	}
+
+	paths, err := visited("", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"host", "host.ip", "host.ip.0", "host.ip.1", "host.name",
+		"message",
+		"user", "user.name", "user.password",
+	}, paths)
+
+	paths, err = visited("host", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"host", "message", "user", "user.name", "user.password"}, paths)
+
+	paths, err = visited("", "message")
+	require.EqualError(t, err, "stop")
+	require.Equal(t, []string{"host", "host.ip", "host.ip.0", "host.ip.1", "host.name", "message"}, paths)
+
+	var root []string
+	require.NoError(t, Walk(NewStructValue(st), func(path []string, v *messages.Value) error {
+		if len(path) == 0 {
+			root = append(root, "root")
+		}
+		return ErrSkipChildren
+	}))
+	require.Equal(t, []string{"root"}, root)
+}
+
+func TestWalkModify(t *testing.T) {
+	st, err := NewStruct(map[string]interface{}{
+		"a": map[string]interface{}{"password": "secret"},
+		"b": []interface{}{"x", map[string]interface{}{"password": "secret"}},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, WalkStruct(st, func(path []string, v *messages.Value) error {
+		if path[len(path)-1] == "password" {
+			v.Kind = &messages.Value_StringValue{StringValue: "***"}
+		}
+		return nil
+	}))
+	require.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{"password": "***"},
+		"b": []interface{}{"x", map[string]interface{}{"password": "***"}},
+	}, AsMap(st))
+}
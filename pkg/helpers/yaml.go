@@ -0,0 +1,74 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// StructToYAML encodes the Struct as a YAML mapping.
+// Timestamps are encoded as YAML timestamps, and the floats with an integer
+// value keep a fraction so that they're decoded back as floats.
+func StructToYAML(st *messages.Struct) ([]byte, error) {
+	data, err := yaml.Marshal(yamlFloats(AsMap(st)))
+	if err != nil {
+		return nil, fmt.Errorf("error encoding YAML: %w", err)
+	}
+	return data, nil
+}
+
+// StructFromYAML decodes a YAML mapping into a Struct. Unquoted timestamps
+// are decoded as timestamps, and the keys of nested mappings that aren't
+// strings, like numbers or booleans, are formatted as strings, see
+// MapKeysFormat. The values are converted using NewValue, integers that
+// don't fit in 64 bits are decoded as floats by the YAML parser.
+func StructFromYAML(data []byte) (*messages.Struct, error) {
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error decoding YAML: %w", err)
+	}
+	return NewStructWithOptions(m, WithMapKeys(MapKeysFormat))
+}
+
+// yamlFloat is a float with an integer value, encoded with a fraction.
+type yamlFloat float64
+
+func (f yamlFloat) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!float",
+		Value: strconv.FormatFloat(float64(f), 'f', 1, 64),
+	}, nil
+}
+
+// yamlFloats replaces the floats of v with an integer value by yamlFloat.
+func yamlFloats(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = yamlFloats(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = yamlFloats(item)
+		}
+	case float32:
+		if f := float64(v); f == math.Trunc(f) && math.Abs(f) < 1e21 {
+			return yamlFloat(f)
+		}
+	case float64:
+		// larger floats are written with an exponent
+		if v == math.Trunc(v) && math.Abs(v) < 1e21 {
+			return yamlFloat(v)
+		}
+	}
+	return v
+}
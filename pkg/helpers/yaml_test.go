@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package helpers
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStructFromYAML(t *testing.T) {
+	st, err := StructFromYAML([]byte(`
+message: hello
+count: -3
+max_uint64: 18446744073709551615
+ratio: 0.5
+ok: true
+missing: null
+quoted: "2022-08-04"
+"@timestamp": 2022-08-04T18:17:28.123Z
+tags: [a, b]
+status:
+  200: ok
+  true: yes
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"message":    "hello",
+		"count":      int64(-3),
+		"max_uint64": uint64(math.MaxUint64),
+		"ratio":      0.5,
+		"ok":         true,
+		"missing":    nil,
+		"quoted":     "2022-08-04",
+		"@timestamp": time.Date(2022, 8, 4, 18, 17, 28, 123000000, time.UTC),
+		"tags":       []interface{}{"a", "b"},
+		"status":     map[string]interface{}{"200": "ok", "true": "yes"},
+	}, AsMap(st))
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	ts := time.Date(2022, 8, 4, 18, 17, 28, 0, time.UTC)
+	st, err := NewStruct(map[string]interface{}{
+		"message":    "hello",
+		"count":      int64(-3),
+		"ratio":      1.0,
+		"zero":       math.Copysign(0, -1),
+		"@timestamp": ts,
+		"host":       map[string]interface{}{"name": "web-1", "ip": []string{"10.0.0.1"}},
+	})
+	require.NoError(t, err)
+
+	data, err := StructToYAML(st)
+	require.NoError(t, err)
+	decoded, err := StructFromYAML(data)
+	require.NoError(t, err)
+	require.True(t, StructEqual(st, decoded), string(data))
+}
+
+func TestStructFromYAMLErrors(t *testing.T) {
+	for _, in := range []string{"- a\n- b\n", "a: [", "a: !!binary /w==\n"} {
+		_, err := StructFromYAML([]byte(in))
+		require.Error(t, err, in)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package loadgen generates synthetic log and metric events at a given rate
+// and publishes them to a shipper, reporting the achieved throughput, the
+// latency of the requests and the events the shipper didn't accept:
+//
+//	report, err := loadgen.Run(ctx, c, loadgen.Config{EPS: 5000, Duration: time.Minute})
+//	fmt.Println(report)
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Kinds of generated events.
+const (
+	KindLogs    = "logs"
+	KindMetrics = "metrics"
+)
+
+// Defaults of GeneratorConfig.
+const (
+	DefaultCardinality = 100
+	DefaultInputID     = "loadgen"
+)
+
+// GeneratorConfig configures a Generator.
+type GeneratorConfig struct {
+	// Kind is the kind of events, KindLogs or KindMetrics, defaults to
+	// KindLogs.
+	Kind string
+	// Cardinality is the number of distinct hosts the events come from,
+	// defaults to DefaultCardinality. Every host runs one of a few
+	// services, the number of distinct host and service pairs is the same.
+	Cardinality int
+	// InputID is the input ID of the events, defaults to DefaultInputID.
+	InputID string
+	// Seed seeds the randomness of the events, for reproducible runs.
+	// Defaults to a time based seed.
+	Seed int64
+	// Clock sets the timestamps of the events, defaults to clock.Real.
+	Clock clock.Clock
+}
+
+// Generator synthesizes events looking like the ones of Filebeat or
+// Metricbeat: the logs have a message, a level and the host and service
+// they come from, the metrics the CPU and memory usage of the host. It is
+// not safe for concurrent use.
+type Generator struct {
+	config GeneratorConfig
+	rand   *rand.Rand
+}
+
+var (
+	services = []string{"nginx", "postgres", "redis", "auth", "billing", "frontend"}
+	levels   = []string{"info", "info", "info", "info", "warn", "error", "debug"}
+	paths    = []string{"/", "/login", "/api/v1/orders", "/api/v1/users", "/static/app.js", "/health"}
+	statuses = []int64{200, 200, 200, 200, 201, 304, 400, 404, 500}
+)
+
+// NewGenerator returns a Generator. Zero values in config are replaced by
+// their defaults.
+func NewGenerator(config GeneratorConfig) (*Generator, error) {
+	if config.Kind == "" {
+		config.Kind = KindLogs
+	}
+	if config.Kind != KindLogs && config.Kind != KindMetrics {
+		return nil, fmt.Errorf("unknown kind of events %q", config.Kind)
+	}
+	if config.Cardinality < 0 {
+		return nil, fmt.Errorf("cardinality can't be negative, got %d", config.Cardinality)
+	}
+	if config.Cardinality == 0 {
+		config.Cardinality = DefaultCardinality
+	}
+	if config.InputID == "" {
+		config.InputID = DefaultInputID
+	}
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+	return &Generator{
+		config: config,
+		rand:   rand.New(rand.NewSource(config.Seed)), //nolint:gosec // synthetic data
+	}, nil
+}
+
+// Next returns a new event.
+func (g *Generator) Next() *messages.Event {
+	host := g.rand.Intn(g.config.Cardinality)
+	fields := map[string]*messages.Value{
+		"host":    object("name", helpers.NewStringValue(fmt.Sprintf("host-%d", host))),
+		"service": object("name", helpers.NewStringValue(services[host%len(services)])),
+	}
+	if g.config.Kind == KindLogs {
+		g.log(fields)
+	} else {
+		g.metrics(fields)
+	}
+	return &messages.Event{
+		Timestamp:  timestamppb.New(g.config.Clock.Now()),
+		Source:     &messages.Source{InputId: g.config.InputID, StreamId: fmt.Sprintf("%s-%d", g.config.Kind, host)},
+		DataStream: &messages.DataStream{Type: g.config.Kind, Dataset: "loadgen", Namespace: "default"},
+		Fields:     &messages.Struct{Data: fields},
+	}
+}
+
+// Batch returns n new events.
+func (g *Generator) Batch(n int) []*messages.Event {
+	events := make([]*messages.Event, n)
+	for i := range events {
+		events[i] = g.Next()
+	}
+	return events
+}
+
+func (g *Generator) log(fields map[string]*messages.Value) {
+	path := paths[g.rand.Intn(len(paths))]
+	status := statuses[g.rand.Intn(len(statuses))]
+	duration := g.rand.Int63n(500_000_000)
+	fields["message"] = helpers.NewStringValue(fmt.Sprintf("10.0.%d.%d - - \"GET %s HTTP/1.1\" %d %d",
+		g.rand.Intn(256), g.rand.Intn(256), path, status, g.rand.Intn(64*1024)))
+	fields["log"] = object("level", helpers.NewStringValue(levels[g.rand.Intn(len(levels))]))
+	fields["http"] = object("response", object("status_code", helpers.NewInt64Value(status)))
+	fields["url"] = object("path", helpers.NewStringValue(path))
+	fields["event"] = object("duration", helpers.NewInt64Value(duration))
+}
+
+func (g *Generator) metrics(fields map[string]*messages.Value) {
+	fields["metricset"] = object("name", helpers.NewStringValue("system"))
+	fields["system"] = helpers.NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+		"cpu": object("total", object("pct", helpers.NewFloat64Value(g.rand.Float64()))),
+		"memory": helpers.NewStructValue(&messages.Struct{Data: map[string]*messages.Value{
+			"used":  object("bytes", helpers.NewInt64Value(g.rand.Int63n(64<<30))),
+			"total": object("bytes", helpers.NewInt64Value(64<<30)),
+		}}),
+		"load": object("1", helpers.NewFloat64Value(g.rand.Float64()*8)),
+	}})
+}
+
+// object returns an object with a single field.
+func object(key string, v *messages.Value) *messages.Value {
+	return helpers.NewStructValue(&messages.Struct{Data: map[string]*messages.Value{key: v}})
+}
@@ -0,0 +1,56 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package loadgen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+)
+
+func TestGenerator(t *testing.T) {
+	now := time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC)
+	validator := helpers.NewValidator()
+	for _, kind := range []string{KindLogs, KindMetrics} {
+		t.Run(kind, func(t *testing.T) {
+			g, err := NewGenerator(GeneratorConfig{Kind: kind, Cardinality: 5, Seed: 1, Clock: clock.NewFake(now)})
+			require.NoError(t, err)
+			hosts := map[string]struct{}{}
+			for _, e := range g.Batch(200) {
+				require.NoError(t, validator.Validate(e))
+				require.True(t, now.Equal(e.Timestamp.AsTime()))
+				require.Equal(t, kind, e.DataStream.Type)
+				require.Equal(t, DefaultInputID, e.Source.InputId)
+				host, err := helpers.GetField(e.Fields, "host.name")
+				require.NoError(t, err)
+				hosts[host.GetStringValue()] = struct{}{}
+			}
+			require.Len(t, hosts, 5)
+		})
+	}
+}
+
+func TestGeneratorSeed(t *testing.T) {
+	config := GeneratorConfig{Seed: 42, Clock: clock.NewFake(time.Now())}
+	a, err := NewGenerator(config)
+	require.NoError(t, err)
+	b, err := NewGenerator(config)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.True(t, proto.Equal(a.Next(), b.Next()), "the same seed generates the same events")
+	}
+}
+
+func TestGeneratorConfig(t *testing.T) {
+	_, err := NewGenerator(GeneratorConfig{Kind: "traces"})
+	require.EqualError(t, err, `unknown kind of events "traces"`)
+	_, err = NewGenerator(GeneratorConfig{Cardinality: -1})
+	require.EqualError(t, err, "cardinality can't be negative, got -1")
+}
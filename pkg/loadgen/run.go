@@ -0,0 +1,213 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Defaults of Config.
+const (
+	DefaultEPS       = 1000
+	DefaultBatchSize = 100
+	DefaultWorkers   = 1
+)
+
+// Config configures Run.
+type Config struct {
+	// Generator configures the generated events.
+	Generator GeneratorConfig
+	// EPS is the target rate in events per second, defaults to DefaultEPS.
+	EPS int
+	// BatchSize is the number of events per request, defaults to
+	// DefaultBatchSize, or EPS if it's lower.
+	BatchSize int
+	// Workers is the number of concurrent requests, defaults to
+	// DefaultWorkers. When all the workers are busy the rate drops below
+	// the target: the generation is not ahead of the shipper.
+	Workers int
+	// Duration stops the run, zero runs until the context is done.
+	Duration time.Duration
+}
+
+// Latency is the distribution of the request latencies.
+type Latency struct {
+	P50, P90, P99, Max time.Duration
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	Elapsed  time.Duration
+	Requests int
+	// Errors is the number of failed requests.
+	Errors int
+	// Sent is the number of events sent.
+	Sent int
+	// Accepted is the number of events the shipper accepted.
+	Accepted int
+	// Dropped is the number of events the shipper didn't accept, or lost
+	// by failed requests. They are not sent again.
+	Dropped int
+	// UUID is the uuid of the shipper in the last reply.
+	UUID    string
+	Latency Latency
+}
+
+// EPS returns the rate of accepted events per second.
+func (r Report) EPS() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Accepted) / r.Elapsed.Seconds()
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("elapsed=%s requests=%d errors=%d sent=%d accepted=%d dropped=%d eps=%.0f latency_p50=%s latency_p90=%s latency_p99=%s latency_max=%s",
+		r.Elapsed.Round(time.Millisecond), r.Requests, r.Errors, r.Sent, r.Accepted, r.Dropped, r.EPS(),
+		r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+}
+
+// Run publishes generated events at the target rate until the duration
+// elapsed or ctx is done, and reports the achieved throughput. The failed
+// requests are counted, not returned, it only fails on an invalid config.
+func Run(ctx context.Context, c client.Publisher, config Config) (Report, error) {
+	if config.EPS < 0 || config.BatchSize < 0 || config.Workers < 0 {
+		return Report{}, fmt.Errorf("invalid load: eps=%d batch=%d workers=%d", config.EPS, config.BatchSize, config.Workers)
+	}
+	if config.EPS == 0 {
+		config.EPS = DefaultEPS
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.BatchSize > config.EPS {
+		config.BatchSize = config.EPS
+	}
+	if config.Workers == 0 {
+		config.Workers = DefaultWorkers
+	}
+	interval := time.Duration(float64(time.Second) * float64(config.BatchSize) / float64(config.EPS))
+	if interval <= 0 {
+		return Report{}, fmt.Errorf("invalid load: eps=%d is more than a batch of %d events per nanosecond", config.EPS, config.BatchSize)
+	}
+	gen, err := NewGenerator(config.Generator)
+	if err != nil {
+		return Report{}, err
+	}
+	if config.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Duration)
+		defer cancel()
+	}
+
+	r := &recorder{}
+	batches := make(chan []*messages.Event)
+	var wg sync.WaitGroup
+	for i := 0; i < config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for events := range batches {
+				r.publish(ctx, c, events)
+			}
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	batch := gen.Batch(config.BatchSize)
+loop:
+	for {
+		// the ticker drops the ticks while the workers are busy
+		select {
+		case <-ctx.Done():
+			break loop
+		case batches <- batch:
+		}
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+		batch = gen.Batch(config.BatchSize)
+	}
+	close(batches)
+	wg.Wait()
+	return r.report(time.Since(start)), nil
+}
+
+// recorder aggregates the outcome of the requests.
+type recorder struct {
+	mu        sync.Mutex
+	r         Report
+	latencies []time.Duration
+}
+
+func (r *recorder) publish(ctx context.Context, c client.Publisher, events []*messages.Event) {
+	r.mu.Lock()
+	uuid := r.r.UUID
+	r.mu.Unlock()
+
+	start := time.Now()
+	reply, err := c.Publish(ctx, &messages.PublishRequest{Uuid: uuid, Events: events})
+	latency := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ctx.Err() != nil && err != nil {
+		// stopped in flight, not a failure of the shipper
+		return
+	}
+	r.r.Requests++
+	r.r.Sent += len(events)
+	r.latencies = append(r.latencies, latency)
+	if err != nil {
+		r.r.Errors++
+		r.r.Dropped += len(events)
+		return
+	}
+	accepted := int(reply.GetAcceptedCount())
+	r.r.Accepted += accepted
+	r.r.Dropped += len(events) - accepted
+	r.r.UUID = reply.GetUuid()
+}
+
+func (r *recorder) report(elapsed time.Duration) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := r.r
+	report.Elapsed = elapsed
+	if len(r.latencies) > 0 {
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		report.Latency = Latency{
+			P50: percentile(r.latencies, 0.5),
+			P90: percentile(r.latencies, 0.9),
+			P99: percentile(r.latencies, 0.99),
+			Max: r.latencies[len(r.latencies)-1],
+		}
+	}
+	return report
+}
+
+// percentile returns the nearest-rank percentile p of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package loadgen
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func newTestClient(t *testing.T) (*servertest.Server, *client.Client) {
+	srv := servertest.New(servertest.Options{})
+	srv.Start()
+	t.Cleanup(srv.Stop)
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: []grpc.DialOption{srv.DialOption()},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return srv, c
+}
+
+func TestRun(t *testing.T) {
+	srv, c := newTestClient(t)
+	report, err := Run(context.Background(), c, Config{EPS: 1000, BatchSize: 50, Duration: 300 * time.Millisecond})
+	require.NoError(t, err)
+
+	require.Greater(t, report.Requests, 1)
+	require.Equal(t, 50*report.Requests, report.Sent)
+	require.Equal(t, report.Sent, report.Accepted)
+	require.Zero(t, report.Dropped)
+	require.Zero(t, report.Errors)
+	require.Equal(t, srv.UUID(), report.UUID)
+	// a request stopped in flight can reach the shipper without being counted
+	require.GreaterOrEqual(t, len(srv.Events()), report.Accepted)
+	require.LessOrEqual(t, report.Sent, 400, "paced at 1000 EPS")
+	require.Greater(t, report.EPS(), 0.0)
+	require.LessOrEqual(t, report.Latency.P50, report.Latency.P99)
+	require.LessOrEqual(t, report.Latency.P99, report.Latency.Max)
+	require.Contains(t, report.String(), "accepted=")
+}
+
+func TestRunDropped(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.SetAcceptLimit(10)
+	srv.SetPublishErrors(status.Error(codes.Unavailable, "shutting down"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	report, err := Run(ctx, c, Config{EPS: 500, BatchSize: 50})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Errors)
+	require.Greater(t, report.Requests, 1)
+	require.Equal(t, 10*(report.Requests-1), report.Accepted)
+	require.Equal(t, report.Sent-report.Accepted, report.Dropped)
+}
+
+func TestRunConfig(t *testing.T) {
+	_, err := Run(context.Background(), nil, Config{EPS: -1})
+	require.EqualError(t, err, "invalid load: eps=-1 batch=0 workers=0")
+	_, err = Run(context.Background(), nil, Config{EPS: 2_000_000_000, BatchSize: 1})
+	require.EqualError(t, err, "invalid load: eps=2000000000 is more than a batch of 1 events per nanosecond")
+	_, err = Run(context.Background(), nil, Config{Generator: GeneratorConfig{Kind: "traces"}})
+	require.EqualError(t, err, `unknown kind of events "traces"`)
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	require.Equal(t, 50*time.Millisecond, percentile(sorted, 0.5))
+	require.Equal(t, 99*time.Millisecond, percentile(sorted, 0.99))
+	require.Equal(t, time.Millisecond, percentile(sorted[:1], 0.99))
+}
@@ -0,0 +1,66 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// AddFields adds constant fields to the events.
+type AddFields struct {
+	keys      []string
+	values    []*messages.Value
+	overwrite bool
+}
+
+// NewAddFields returns a processor adding fields, whose keys are dotted
+// paths. The existing fields are kept unless overwrite is true. A key
+// can't be the parent of another, like "a" and "a.b": set b in the value
+// of a instead.
+func NewAddFields(fields map[string]interface{}, overwrite bool) (*AddFields, error) {
+	p := &AddFields{overwrite: overwrite}
+	for key := range fields {
+		p.keys = append(p.keys, key)
+	}
+	// sorted so the errors are stable
+	sort.Strings(p.keys)
+	for _, key := range p.keys {
+		for i, c := range key {
+			if _, ok := fields[key[:i]]; c == '.' && ok {
+				return nil, fmt.Errorf("field %s conflicts with its parent %s", key, key[:i])
+			}
+		}
+		v, err := helpers.NewValue(fields[key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for field %s: %w", key, err)
+		}
+		p.values = append(p.values, v)
+	}
+	return p, nil
+}
+
+// Process adds the fields to e.
+func (p *AddFields) Process(e *messages.Event) (*messages.Event, error) {
+	st := fields(e)
+	for i, key := range p.keys {
+		if !p.overwrite && helpers.HasField(st, key) {
+			continue
+		}
+		// every event gets its own copy, later processors can modify it
+		if _, err := helpers.PutField(st, key, helpers.CloneValue(p.values[i])); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (p *AddFields) String() string {
+	return "add_fields=" + strings.Join(p.keys, ",")
+}
@@ -0,0 +1,112 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+)
+
+// ttlCache is an LRU cache whose entries also expire after a ttl. It's
+// safe for concurrent use.
+type ttlCache[V any] struct {
+	ttl   time.Duration
+	max   int
+	clock clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order holds the entries, the most recently used first
+	order *list.List
+}
+
+type cacheEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+func newTTLCache[V any](max int, ttl time.Duration, clk clock.Clock) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:     ttl,
+		max:     max,
+		clock:   clk,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// get returns the value of key, if it's not expired.
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.getLocked(key, c.clock.Now())
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// add sets the value of key, which expires after the ttl.
+func (c *ttlCache[V]) add(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addLocked(key, value, c.clock.Now())
+}
+
+// addIfAbsent sets the value of key unless it's present and not expired,
+// it returns true if the value was set.
+func (c *ttlCache[V]) addIfAbsent(key string, value V) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if _, ok := c.getLocked(key, now); ok {
+		return false
+	}
+	c.addLocked(key, value, now)
+	return true
+}
+
+// len returns the number of entries, including the expired ones not
+// evicted yet.
+func (c *ttlCache[V]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *ttlCache[V]) getLocked(key string, now time.Time) (*cacheEntry[V], bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry[V])
+	if !now.Before(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry, true
+}
+
+func (c *ttlCache[V]) addLocked(key string, value V, now time.Time) {
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry[V])
+		entry.value, entry.expires = value, now.Add(c.ttl)
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry[V]{key: key, value: value, expires: now.Add(c.ttl)})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry[V]).key)
+	}
+}
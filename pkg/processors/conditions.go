@@ -0,0 +1,372 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Condition matches events, like the beats processor conditions. The
+// fields are addressed with dotted paths. It must be safe for concurrent
+// use.
+type Condition interface {
+	Check(e *messages.Event) bool
+}
+
+// When returns a processor running p only on the events matching cond.
+func When(cond Condition, p Processor) Processor {
+	return &conditional{cond: cond, processor: p}
+}
+
+type conditional struct {
+	cond      Condition
+	processor Processor
+}
+
+func (c *conditional) Process(e *messages.Event) (*messages.Event, error) {
+	if !c.cond.Check(e) {
+		return e, nil
+	}
+	return c.processor.Process(e)
+}
+
+func (c *conditional) String() string {
+	return fmt.Sprintf("%s, condition=%v", name(c.processor), c.cond)
+}
+
+// DropEvent returns a processor dropping every event, it's meant to be
+// used with When.
+func DropEvent() Processor {
+	return dropEvent{}
+}
+
+type dropEvent struct{}
+
+func (dropEvent) Process(*messages.Event) (*messages.Event, error) {
+	return nil, nil
+}
+
+func (dropEvent) String() string {
+	return "drop_event"
+}
+
+// Equals matches the events whose field equals value. Numbers are compared
+// by value whatever their type: integers exactly, and as floats when one of
+// them is a float. Other values must have the same kind.
+func Equals(field string, value interface{}) (Condition, error) {
+	v, err := helpers.NewValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for field %s: %w", field, err)
+	}
+	return &equals{field: field, value: v}, nil
+}
+
+type equals struct {
+	field string
+	value *messages.Value
+}
+
+func (c *equals) Check(e *messages.Event) bool {
+	v, err := helpers.GetField(e.GetFields(), c.field)
+	if err != nil {
+		return false
+	}
+	if expected, negative, ok := asInteger(c.value); ok {
+		if actual, actualNegative, ok := asInteger(v); ok {
+			return actual == expected && actualNegative == negative
+		}
+	}
+	if expected, err := helpers.AsTyped[float64](c.value); err == nil {
+		actual, err := helpers.AsTyped[float64](v)
+		return err == nil && actual == expected
+	}
+	return helpers.Equal(v, c.value)
+}
+
+// asInteger returns the absolute value of an integer and its sign, ok is
+// false if v isn't an integer.
+func asInteger(v *messages.Value) (abs uint64, negative bool, ok bool) {
+	var signed int64
+	switch kind := v.GetKind().(type) {
+	case *messages.Value_Uint32Value:
+		return uint64(kind.Uint32Value), false, true
+	case *messages.Value_Uint64Value:
+		return kind.Uint64Value, false, true
+	case *messages.Value_Int32Value:
+		signed = int64(kind.Int32Value)
+	case *messages.Value_Int64Value:
+		signed = kind.Int64Value
+	default:
+		return 0, false, false
+	}
+	if signed < 0 {
+		// -signed overflows for the smallest int64
+		return uint64(-(signed + 1)) + 1, true, true
+	}
+	return uint64(signed), false, true
+}
+
+func (c *equals) String() string {
+	return fmt.Sprintf("equals: %s=%v", c.field, helpers.AsInterface(c.value))
+}
+
+// Contains matches the events whose field is a string containing substr,
+// or a list holding such a string.
+func Contains(field, substr string) Condition {
+	return &stringMatch{op: "contains", field: field, pattern: substr, match: func(s string) bool {
+		return strings.Contains(s, substr)
+	}}
+}
+
+// Regexp matches the events whose field is a string matching pattern, or a
+// list holding such a string.
+func Regexp(field, pattern string) (Condition, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regexp for field %s: %w", field, err)
+	}
+	return &stringMatch{op: "regexp", field: field, pattern: pattern, match: re.MatchString}, nil
+}
+
+type stringMatch struct {
+	op      string
+	field   string
+	pattern string
+	match   func(string) bool
+}
+
+func (c *stringMatch) Check(e *messages.Event) bool {
+	v, err := helpers.GetField(e.GetFields(), c.field)
+	if err != nil {
+		return false
+	}
+	if list := v.GetListValue(); list != nil {
+		for _, item := range list.GetValues() {
+			if s, ok := item.GetKind().(*messages.Value_StringValue); ok && c.match(s.StringValue) {
+				return true
+			}
+		}
+		return false
+	}
+	s, ok := v.GetKind().(*messages.Value_StringValue)
+	return ok && c.match(s.StringValue)
+}
+
+func (c *stringMatch) String() string {
+	return fmt.Sprintf("%s: %s=%s", c.op, c.field, c.pattern)
+}
+
+// Exists matches the events having all the fields.
+func Exists(fields ...string) Condition {
+	return exists(fields)
+}
+
+type exists []string
+
+func (c exists) Check(e *messages.Event) bool {
+	for _, field := range c {
+		if !helpers.HasField(e.GetFields(), field) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c exists) String() string {
+	return "has_fields: " + strings.Join(c, ",")
+}
+
+// And matches the events matching all the conditions.
+func And(conds ...Condition) Condition {
+	return and(conds)
+}
+
+type and []Condition
+
+func (c and) Check(e *messages.Event) bool {
+	for _, cond := range c {
+		if !cond.Check(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c and) String() string {
+	return joinConditions("and", c)
+}
+
+// Or matches the events matching any of the conditions.
+func Or(conds ...Condition) Condition {
+	return or(conds)
+}
+
+type or []Condition
+
+func (c or) Check(e *messages.Event) bool {
+	for _, cond := range c {
+		if cond.Check(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c or) String() string {
+	return joinConditions("or", c)
+}
+
+// Not matches the events not matching cond.
+func Not(cond Condition) Condition {
+	return not{cond: cond}
+}
+
+type not struct {
+	cond Condition
+}
+
+func (c not) Check(e *messages.Event) bool {
+	return !c.cond.Check(e)
+}
+
+func (c not) String() string {
+	return fmt.Sprintf("not: (%v)", c.cond)
+}
+
+func joinConditions(op string, conds []Condition) string {
+	parts := make([]string, len(conds))
+	for i, cond := range conds {
+		parts[i] = fmt.Sprintf("(%v)", cond)
+	}
+	return op + ": " + strings.Join(parts, " ")
+}
+
+// NewCondition builds a condition from its beats configuration, like:
+//
+//	or:
+//	  - equals:
+//	      log.level: debug
+//	  - regexp:
+//	      message: "^DBG"
+//	  - not:
+//	      has_fields: ["error"]
+//
+// The supported conditions are equals, contains, regexp, has_fields, and,
+// or and not. A condition with several fields or keys matches when all of
+// them match.
+func NewCondition(config map[string]interface{}) (Condition, error) {
+	if len(config) == 0 {
+		return nil, errors.New("empty condition")
+	}
+	var conds []Condition
+	for _, op := range sortedKeys(config) {
+		cond, err := newCondition(op, config[op])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s condition: %w", op, err)
+		}
+		conds = append(conds, cond)
+	}
+	if len(conds) == 1 {
+		return conds[0], nil
+	}
+	return And(conds...), nil
+}
+
+func newCondition(op string, config interface{}) (Condition, error) {
+	switch op {
+	case "equals", "contains", "regexp":
+		fields, ok := config.(map[string]interface{})
+		if !ok || len(fields) == 0 {
+			return nil, fmt.Errorf("expected a map of fields, got %T", config)
+		}
+		var conds []Condition
+		for _, field := range sortedKeys(fields) {
+			cond, err := newFieldCondition(op, field, fields[field])
+			if err != nil {
+				return nil, err
+			}
+			conds = append(conds, cond)
+		}
+		if len(conds) == 1 {
+			return conds[0], nil
+		}
+		return And(conds...), nil
+	case "has_fields":
+		list, ok := config.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("expected a list of fields, got %T", config)
+		}
+		fields := make([]string, len(list))
+		for i, field := range list {
+			if fields[i], ok = field.(string); !ok {
+				return nil, fmt.Errorf("expected a field name, got %T", field)
+			}
+		}
+		return Exists(fields...), nil
+	case "and", "or":
+		list, ok := config.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("expected a list of conditions, got %T", config)
+		}
+		conds := make([]Condition, len(list))
+		for i, item := range list {
+			sub, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("expected a condition, got %T", item)
+			}
+			cond, err := NewCondition(sub)
+			if err != nil {
+				return nil, err
+			}
+			conds[i] = cond
+		}
+		if op == "and" {
+			return And(conds...), nil
+		}
+		return Or(conds...), nil
+	case "not":
+		sub, ok := config.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a condition, got %T", config)
+		}
+		cond, err := NewCondition(sub)
+		if err != nil {
+			return nil, err
+		}
+		return Not(cond), nil
+	default:
+		return nil, errors.New("unknown condition")
+	}
+}
+
+func newFieldCondition(op, field string, value interface{}) (Condition, error) {
+	if op == "equals" {
+		return Equals(field, value)
+	}
+	pattern, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string for field %s, got %T", field, value)
+	}
+	if op == "contains" {
+		return Contains(field, pattern), nil
+	}
+	return Regexp(field, pattern)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
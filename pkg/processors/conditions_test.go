@@ -0,0 +1,124 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func mustCondition(c Condition, err error) Condition {
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func TestConditions(t *testing.T) {
+	e := testEvent(t, map[string]interface{}{
+		"message": "DBG connection reset",
+		"log":     map[string]interface{}{"level": "debug"},
+		"status":  int32(404),
+		"tags":    []interface{}{"web", "frontend"},
+		"ok":      false,
+		"id":      uint64(1<<53 + 1),
+		"offset":  int64(-1 << 63),
+	})
+
+	cases := []struct {
+		name string
+		cond Condition
+		exp  bool
+	}{
+		{"equals string", mustCondition(Equals("log.level", "debug")), true},
+		{"equals other string", mustCondition(Equals("log.level", "info")), false},
+		{"equals number of another type", mustCondition(Equals("status", 404)), true},
+		{"equals float", mustCondition(Equals("status", 404.0)), true},
+		{"equals large integer", mustCondition(Equals("id", int64(1<<53+1))), true},
+		{"equals close large integer", mustCondition(Equals("id", uint64(1<<53))), false},
+		{"equals smallest integer", mustCondition(Equals("offset", int64(-1<<63))), true},
+		{"equals unsigned of the smallest integer", mustCondition(Equals("offset", uint64(1<<63))), false},
+		{"equals bool", mustCondition(Equals("ok", false)), true},
+		{"equals missing", mustCondition(Equals("missing", "x")), false},
+		{"equals kind mismatch", mustCondition(Equals("status", "404")), false},
+		{"contains", Contains("message", "reset"), true},
+		{"contains in list", Contains("tags", "front"), true},
+		{"contains not string", Contains("status", "4"), false},
+		{"regexp", mustCondition(Regexp("message", "^DBG")), true},
+		{"regexp no match", mustCondition(Regexp("log.level", "^err")), false},
+		{"exists", Exists("log.level", "tags"), true},
+		{"exists missing", Exists("log.level", "error"), false},
+		{"and", And(Exists("tags"), Contains("message", "DBG")), true},
+		{"or", Or(Exists("error"), Contains("message", "DBG")), true},
+		{"not", Not(Exists("error")), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.exp, c.cond.Check(e))
+		})
+	}
+
+	_, err := Regexp("message", "(")
+	require.Error(t, err)
+}
+
+func TestNewCondition(t *testing.T) {
+	var config map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+or:
+  - equals:
+      log.level: debug
+      status: 200
+  - and:
+      - regexp:
+          message: "^DBG"
+      - not:
+          has_fields: ["error"]
+`), &config))
+	cond, err := NewCondition(config)
+	require.NoError(t, err)
+
+	matching := testEvent(t, map[string]interface{}{"message": "DBG retrying"})
+	require.True(t, cond.Check(matching))
+	require.False(t, cond.Check(testEvent(t, map[string]interface{}{"message": "DBG", "error": "x"})))
+	require.True(t, cond.Check(testEvent(t, map[string]interface{}{"log": map[string]interface{}{"level": "debug"}, "status": 200})))
+	require.False(t, cond.Check(testEvent(t, map[string]interface{}{"log": map[string]interface{}{"level": "debug"}})))
+	require.Equal(t, "or: (and: (equals: log.level=debug) (equals: status=200)) (and: (regexp: message=^DBG) (not: (has_fields: error)))", cond.(interface{ String() string }).String())
+
+	for _, invalid := range []map[string]interface{}{
+		{},
+		{"unknown": "x"},
+		{"equals": "x"},
+		{"contains": map[string]interface{}{"message": 1}},
+		{"regexp": map[string]interface{}{"message": "("}},
+		{"has_fields": []interface{}{1}},
+		{"or": []interface{}{"x"}},
+		{"not": []interface{}{}},
+	} {
+		_, err := NewCondition(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestWhen(t *testing.T) {
+	p := NewPipeline(When(Contains("message", "DBG"), DropEvent()))
+	out, err := p.Process(testEvent(t, map[string]interface{}{"message": "DBG noisy"}))
+	require.NoError(t, err)
+	require.Nil(t, out)
+
+	e := testEvent(t, map[string]interface{}{"message": "important"})
+	out, err = p.Process(e)
+	require.NoError(t, err)
+	require.Same(t, e, out)
+
+	out, err = p.Process(&messages.Event{})
+	require.NoError(t, err)
+	require.NotNil(t, out)
+	require.Equal(t, "pipeline=[drop_event, condition=contains: message=DBG]", p.String())
+}
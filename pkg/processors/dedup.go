@@ -0,0 +1,67 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// DedupConfig configures a Dedup processor.
+type DedupConfig struct {
+	// Window is how long a fingerprint is remembered after the first event
+	// having it, it must be positive.
+	Window time.Duration
+	// Fields are the dotted paths hashed into the fingerprint, the whole
+	// event is hashed when empty. See helpers.Fingerprint.
+	Fields []string
+	// MaxEntries bounds the remembered fingerprints, the least recently
+	// seen are forgotten first. Defaults to 10000.
+	MaxEntries int
+	// Clock expires the fingerprints, defaults to clock.Real.
+	Clock clock.Clock
+}
+
+// Dedup drops the events whose fingerprint was seen within a window, to
+// protect the shipper from replayed events.
+type Dedup struct {
+	fields []string
+	seen   *ttlCache[struct{}]
+}
+
+// NewDedup returns a Dedup processor.
+func NewDedup(config DedupConfig) (*Dedup, error) {
+	if config.Window <= 0 {
+		return nil, fmt.Errorf("deduplication window must be positive, got %s", config.Window)
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 10000
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+	return &Dedup{
+		fields: config.Fields,
+		seen:   newTTLCache[struct{}](config.MaxEntries, config.Window, config.Clock),
+	}, nil
+}
+
+// Process returns nil if the fingerprint of e was seen within the window,
+// e otherwise.
+func (p *Dedup) Process(e *messages.Event) (*messages.Event, error) {
+	if !p.seen.addIfAbsent(helpers.Fingerprint(e, p.fields...), struct{}{}) {
+		return nil, nil
+	}
+	return e, nil
+}
+
+func (p *Dedup) String() string {
+	return "dedup=" + strings.Join(p.fields, ",")
+}
@@ -0,0 +1,76 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+)
+
+func TestDedup(t *testing.T) {
+	clk := clock.NewFake(time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC))
+	p, err := NewDedup(DedupConfig{Window: time.Minute, Clock: clk})
+	require.NoError(t, err)
+
+	kept := func(message string) bool {
+		out, err := p.Process(testEvent(t, map[string]interface{}{"message": message}))
+		require.NoError(t, err)
+		return out != nil
+	}
+	require.True(t, kept("first"))
+	require.False(t, kept("first"))
+	require.True(t, kept("second"))
+
+	// duplicates don't extend the window
+	clk.Advance(59 * time.Second)
+	require.False(t, kept("first"))
+	clk.Advance(time.Second)
+	require.True(t, kept("first"))
+	require.False(t, kept("first"))
+
+	_, err = NewDedup(DedupConfig{})
+	require.Error(t, err)
+}
+
+func TestDedupFields(t *testing.T) {
+	p, err := NewDedup(DedupConfig{Window: time.Minute, Fields: []string{"event.id"}})
+	require.NoError(t, err)
+
+	out, err := p.Process(testEvent(t, map[string]interface{}{"event": map[string]interface{}{"id": "1"}, "attempt": 1}))
+	require.NoError(t, err)
+	require.NotNil(t, out)
+	out, err = p.Process(testEvent(t, map[string]interface{}{"event": map[string]interface{}{"id": "1"}, "attempt": 2}))
+	require.NoError(t, err)
+	require.Nil(t, out)
+}
+
+func TestTTLCache(t *testing.T) {
+	clk := clock.NewFake(time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC))
+	c := newTTLCache[int](3, time.Minute, clk)
+	for i := 0; i < 3; i++ {
+		c.add(fmt.Sprint(i), i)
+	}
+	// "0" becomes the most recently used, so "1" is evicted
+	v, ok := c.get("0")
+	require.True(t, ok)
+	require.Equal(t, 0, v)
+	c.add("3", 3)
+	_, ok = c.get("1")
+	require.False(t, ok)
+	require.Equal(t, 3, c.len())
+
+	require.False(t, c.addIfAbsent("3", 30))
+	clk.Advance(time.Minute)
+	_, ok = c.get("0")
+	require.False(t, ok)
+	require.True(t, c.addIfAbsent("3", 30))
+	v, _ = c.get("3")
+	require.Equal(t, 30, v)
+}
@@ -0,0 +1,40 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// DropFields removes fields from the events.
+type DropFields struct {
+	fields        []string
+	ignoreMissing bool
+}
+
+// NewDropFields returns a processor removing fields, given as dotted paths.
+// It fails on a missing field unless ignoreMissing is true.
+func NewDropFields(ignoreMissing bool, fields ...string) *DropFields {
+	return &DropFields{fields: fields, ignoreMissing: ignoreMissing}
+}
+
+// Process removes the fields from e.
+func (p *DropFields) Process(e *messages.Event) (*messages.Event, error) {
+	for _, key := range p.fields {
+		err := helpers.DeleteField(e.GetFields(), key)
+		if err != nil && !(p.ignoreMissing && errors.Is(err, helpers.ErrKeyNotFound)) {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (p *DropFields) String() string {
+	return "drop_fields=" + strings.Join(p.fields, ",")
+}
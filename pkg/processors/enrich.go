@@ -0,0 +1,247 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Enricher looks up the value derived from a key, like the host name of an
+// IP address or its geo location. It returns nil when nothing is known
+// about the key. It must be safe for concurrent use.
+type Enricher interface {
+	Lookup(ctx context.Context, key string) (*messages.Value, error)
+}
+
+// EnricherFunc is a function implementing Enricher.
+type EnricherFunc func(ctx context.Context, key string) (*messages.Value, error)
+
+// Lookup calls f.
+func (f EnricherFunc) Lookup(ctx context.Context, key string) (*messages.Value, error) {
+	return f(ctx, key)
+}
+
+// CacheConfig configures a CachingEnricher.
+type CacheConfig struct {
+	// TTL is how long the lookup results are kept, defaults to 5 minutes.
+	TTL time.Duration
+	// MaxEntries bounds the cached results, the least recently used are
+	// evicted first. Defaults to 10000.
+	MaxEntries int
+	// Timeout bounds the lookups, which are shared by the concurrent
+	// callers and the prefetches and don't end with the context of one of
+	// them. Defaults to 5 seconds.
+	Timeout time.Duration
+	// MaxPending bounds the background lookups in progress, Prefetch does
+	// nothing when it's reached. Defaults to 64.
+	MaxPending int
+	// Clock expires the results, defaults to clock.Real.
+	Clock clock.Clock
+}
+
+// CachingEnricher caches the results of an Enricher, including the keys
+// with no result. The errors are not cached. Concurrent lookups of the same
+// key share the same call to the Enricher.
+type CachingEnricher struct {
+	enricher Enricher
+	config   CacheConfig
+	cache    *ttlCache[*messages.Value]
+
+	mu       sync.Mutex
+	inflight map[string]*lookupCall
+}
+
+type lookupCall struct {
+	done  chan struct{}
+	value *messages.Value
+	err   error
+}
+
+// NewCachingEnricher returns a CachingEnricher for enricher, zero values in
+// config are replaced by their defaults.
+func NewCachingEnricher(enricher Enricher, config CacheConfig) *CachingEnricher {
+	if config.TTL <= 0 {
+		config.TTL = 5 * time.Minute
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 10000
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.MaxPending <= 0 {
+		config.MaxPending = 64
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+	return &CachingEnricher{
+		enricher: enricher,
+		config:   config,
+		cache:    newTTLCache[*messages.Value](config.MaxEntries, config.TTL, config.Clock),
+		inflight: map[string]*lookupCall{},
+	}
+}
+
+// Lookup returns the cached result for key, or looks it up. The returned
+// value is shared and must not be modified. The lookup is shared with the
+// concurrent calls, it isn't canceled with ctx: Lookup returns when ctx is
+// done but the lookup goes on for the other callers, up to the timeout.
+func (c *CachingEnricher) Lookup(ctx context.Context, key string) (*messages.Value, error) {
+	if v, ok := c.cache.get(key); ok {
+		return v, nil
+	}
+	call := c.start(key, false)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.value, call.err
+	}
+}
+
+// Cached returns the cached result for key, ok is false if there is none.
+func (c *CachingEnricher) Cached(key string) (*messages.Value, bool) {
+	return c.cache.get(key)
+}
+
+// Prefetch looks up key in the background, unless its result is cached,
+// it's already being looked up or there are too many lookups in progress.
+func (c *CachingEnricher) Prefetch(key string) {
+	if _, ok := c.cache.get(key); ok {
+		return
+	}
+	c.start(key, true)
+}
+
+// start joins the lookup of key in progress, or starts one bounded by the
+// timeout, detached from the callers. When bounded, no lookup is started
+// once MaxPending are in progress and the returned call is nil.
+func (c *CachingEnricher) start(key string, bounded bool) *lookupCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if call, ok := c.inflight[key]; ok {
+		return call
+	}
+	if bounded && len(c.inflight) >= c.config.MaxPending {
+		return nil
+	}
+	call := &lookupCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+		defer cancel()
+		call.value, call.err = c.enricher.Lookup(ctx, key)
+		if call.err == nil {
+			c.cache.add(key, call.value)
+		}
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// EnrichConfig configures an Enrich processor.
+type EnrichConfig struct {
+	// Field is the dotted path of the string looked up.
+	Field string
+	// Target is the dotted path the result is put at, replacing the
+	// existing value.
+	Target string
+	// Enricher looks up the results.
+	Enricher Enricher
+	// Async doesn't wait for the lookups: the events whose result isn't
+	// cached are passed on without it, while the result is looked up in the
+	// background for the next events. Enricher must be a CachingEnricher.
+	Async bool
+	// Timeout bounds the lookups that are waited for, defaults to 1 second.
+	Timeout time.Duration
+	// IgnoreFailure passes on the events whose lookup failed, instead of
+	// failing.
+	IgnoreFailure bool
+}
+
+// Enrich adds the value derived from a field of the events, looked up with
+// an Enricher.
+type Enrich struct {
+	config EnrichConfig
+	cached *CachingEnricher
+}
+
+// NewEnrich returns an Enrich processor.
+func NewEnrich(config EnrichConfig) (*Enrich, error) {
+	if config.Field == "" || config.Target == "" {
+		return nil, errors.New("enrichment needs a field and a target")
+	}
+	if config.Enricher == nil {
+		return nil, errors.New("enrichment needs an enricher")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+	p := &Enrich{config: config}
+	if config.Async {
+		cached, ok := config.Enricher.(*CachingEnricher)
+		if !ok {
+			return nil, fmt.Errorf("asynchronous enrichment needs a CachingEnricher, got %T", config.Enricher)
+		}
+		p.cached = cached
+	}
+	return p, nil
+}
+
+// Process adds the result for the field of e, if the field is a string.
+func (p *Enrich) Process(e *messages.Event) (*messages.Event, error) {
+	v, err := helpers.GetField(e.GetFields(), p.config.Field)
+	if err != nil {
+		return e, nil
+	}
+	key, ok := v.GetKind().(*messages.Value_StringValue)
+	if !ok {
+		return e, nil
+	}
+
+	var result *messages.Value
+	if p.cached != nil {
+		cached, ok := p.cached.Cached(key.StringValue)
+		if !ok {
+			p.cached.Prefetch(key.StringValue)
+			return e, nil
+		}
+		result = cached
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), p.config.Timeout)
+		defer cancel()
+		result, err = p.config.Enricher.Lookup(ctx, key.StringValue)
+		if err != nil {
+			if p.config.IgnoreFailure {
+				return e, nil
+			}
+			return nil, fmt.Errorf("failed to look up %s: %w", p.config.Field, err)
+		}
+	}
+	if result == nil {
+		return e, nil
+	}
+	// the result can be cached and shared by other events
+	if _, err := helpers.PutField(fields(e), p.config.Target, helpers.CloneValue(result)); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (p *Enrich) String() string {
+	return fmt.Sprintf("enrich=[%s->%s]", p.config.Field, p.config.Target)
+}
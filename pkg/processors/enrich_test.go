@@ -0,0 +1,195 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+var errLookup = errors.New("lookup failed")
+
+// reverseDNS resolves the IPs of its table, and fails for "bad".
+type reverseDNS struct {
+	calls   int32
+	release chan struct{}
+}
+
+func (r *reverseDNS) Lookup(ctx context.Context, ip string) (*messages.Value, error) {
+	atomic.AddInt32(&r.calls, 1)
+	if r.release != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-r.release:
+		}
+	}
+	switch ip {
+	case "10.0.0.1":
+		return helpers.NewStringValue("web-1"), nil
+	case "bad":
+		return nil, errLookup
+	}
+	return nil, nil
+}
+
+func ipEvent(t *testing.T, ip interface{}) *messages.Event {
+	return testEvent(t, map[string]interface{}{"source": map[string]interface{}{"ip": ip}})
+}
+
+func TestEnrich(t *testing.T) {
+	p, err := NewEnrich(EnrichConfig{Field: "source.ip", Target: "source.domain", Enricher: &reverseDNS{}})
+	require.NoError(t, err)
+
+	e, err := p.Process(ipEvent(t, "10.0.0.1"))
+	require.NoError(t, err)
+	require.Equal(t, "web-1", e.Fields.Data["source"].GetStructValue().Data["domain"].GetStringValue())
+
+	for _, ip := range []interface{}{"10.0.0.2", 10} {
+		e, err = p.Process(ipEvent(t, ip))
+		require.NoError(t, err)
+		require.False(t, helpers.HasField(e.Fields, "source.domain"))
+	}
+	e, err = p.Process(testEvent(t, nil))
+	require.NoError(t, err)
+	require.NotNil(t, e)
+
+	_, err = p.Process(ipEvent(t, "bad"))
+	require.ErrorIs(t, err, errLookup)
+
+	p, err = NewEnrich(EnrichConfig{Field: "source.ip", Target: "source.domain", Enricher: &reverseDNS{}, IgnoreFailure: true})
+	require.NoError(t, err)
+	e, err = p.Process(ipEvent(t, "bad"))
+	require.NoError(t, err)
+	require.NotNil(t, e)
+
+	for _, config := range []EnrichConfig{
+		{Target: "x", Enricher: &reverseDNS{}},
+		{Field: "x", Target: "y"},
+		{Field: "x", Target: "y", Enricher: &reverseDNS{}, Async: true},
+	} {
+		_, err := NewEnrich(config)
+		require.Error(t, err)
+	}
+}
+
+func TestCachingEnricher(t *testing.T) {
+	clk := clock.NewFake(time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC))
+	dns := &reverseDNS{release: make(chan struct{})}
+	cache := NewCachingEnricher(dns, CacheConfig{TTL: time.Minute, Clock: clk})
+
+	// concurrent lookups share the same call
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cache.Lookup(context.Background(), "10.0.0.1")
+			require.NoError(t, err)
+			require.Equal(t, "web-1", v.GetStringValue())
+		}()
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&dns.calls) == 1 }, time.Second, time.Millisecond)
+	close(dns.release)
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&dns.calls))
+
+	// results are cached, including the unknown keys, but not the errors
+	for i := 0; i < 2; i++ {
+		_, err := cache.Lookup(context.Background(), "10.0.0.1")
+		require.NoError(t, err)
+		v, err := cache.Lookup(context.Background(), "10.0.0.2")
+		require.NoError(t, err)
+		require.Nil(t, v)
+		_, err = cache.Lookup(context.Background(), "bad")
+		require.ErrorIs(t, err, errLookup)
+	}
+	require.Equal(t, int32(4), atomic.LoadInt32(&dns.calls))
+
+	clk.Advance(time.Minute)
+	_, ok := cache.Cached("10.0.0.1")
+	require.False(t, ok)
+}
+
+func TestCachingEnricherCanceledCaller(t *testing.T) {
+	dns := &reverseDNS{release: make(chan struct{})}
+	cache := NewCachingEnricher(dns, CacheConfig{MaxPending: 2})
+
+	// the first caller giving up doesn't fail the others
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := cache.Lookup(ctx, "10.0.0.1")
+		first <- err
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&dns.calls) == 1 }, time.Second, time.Millisecond)
+	second := make(chan *messages.Value)
+	go func() {
+		v, err := cache.Lookup(context.Background(), "10.0.0.1")
+		require.NoError(t, err)
+		second <- v
+	}()
+	cancel()
+	require.ErrorIs(t, <-first, context.Canceled)
+	close(dns.release)
+	require.Equal(t, "web-1", (<-second).GetStringValue())
+
+	// concurrent prefetches don't go over MaxPending
+	dns = &reverseDNS{release: make(chan struct{})}
+	cache = NewCachingEnricher(dns, CacheConfig{MaxPending: 2})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cache.Prefetch(fmt.Sprintf("10.0.1.%d", i))
+		}(i)
+	}
+	wg.Wait()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&dns.calls) == 2 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, int32(2), atomic.LoadInt32(&dns.calls))
+	close(dns.release)
+}
+
+func TestEnrichAsync(t *testing.T) {
+	dns := &reverseDNS{release: make(chan struct{})}
+	cache := NewCachingEnricher(dns, CacheConfig{})
+	p, err := NewEnrich(EnrichConfig{Field: "source.ip", Target: "source.domain", Enricher: cache, Async: true})
+	require.NoError(t, err)
+
+	// the lookup doesn't block the first events
+	for i := 0; i < 3; i++ {
+		e, err := p.Process(ipEvent(t, "10.0.0.1"))
+		require.NoError(t, err)
+		require.False(t, helpers.HasField(e.Fields, "source.domain"))
+	}
+	close(dns.release)
+	require.Eventually(t, func() bool {
+		_, ok := cache.Cached("10.0.0.1")
+		return ok
+	}, time.Second, time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&dns.calls))
+
+	e, err := p.Process(ipEvent(t, "10.0.0.1"))
+	require.NoError(t, err)
+	require.True(t, helpers.HasField(e.Fields, "source.domain"))
+
+	// every event gets its own copy of the cached result
+	e.Fields.Data["source"].GetStructValue().Data["domain"].Kind = &messages.Value_StringValue{StringValue: "modified"}
+	v, _ := cache.Cached("10.0.0.1")
+	require.Equal(t, "web-1", v.GetStringValue())
+}
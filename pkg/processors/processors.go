@@ -0,0 +1,84 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package processors transforms the events before they are published, like
+// the beats processors. A Pipeline runs processors in order, the publishers
+// run it when events are added:
+//
+//	addFields, err := processors.NewAddFields(map[string]interface{}{"env": "prod"}, false)
+//	pipeline := processors.NewPipeline(addFields, processors.NewDropFields(true, "tmp"))
+//	p := publisher.NewAsyncPublisher(client, publisher.AsyncPublisherConfig{Pipeline: pipeline})
+package processors
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Processor transforms an event. It returns the processed event, which can
+// be e modified in place, or nil to drop the event. It must be safe for
+// concurrent use.
+type Processor interface {
+	Process(e *messages.Event) (*messages.Event, error)
+}
+
+// Func is a function implementing Processor.
+type Func func(e *messages.Event) (*messages.Event, error)
+
+// Process calls f.
+func (f Func) Process(e *messages.Event) (*messages.Event, error) {
+	return f(e)
+}
+
+// Pipeline runs processors in order.
+type Pipeline struct {
+	processors []Processor
+}
+
+// NewPipeline returns a Pipeline running processors in order.
+func NewPipeline(processors ...Processor) *Pipeline {
+	return &Pipeline{processors: processors}
+}
+
+// Process runs the processors in order, it stops as soon as one drops the
+// event or fails. Errors are prefixed by the failing processor.
+func (p *Pipeline) Process(e *messages.Event) (*messages.Event, error) {
+	for _, proc := range p.processors {
+		var err error
+		e, err = proc.Process(e)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name(proc), err)
+		}
+		if e == nil {
+			return nil, nil
+		}
+	}
+	return e, nil
+}
+
+// String lists the processors of the pipeline.
+func (p *Pipeline) String() string {
+	names := make([]string, len(p.processors))
+	for i, proc := range p.processors {
+		names[i] = name(proc)
+	}
+	return "pipeline=[" + strings.Join(names, ", ") + "]"
+}
+
+func name(proc Processor) string {
+	if s, ok := proc.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", proc)
+}
+
+// fields returns the fields of e, creating them when missing.
+func fields(e *messages.Event) *messages.Struct {
+	if e.Fields == nil {
+		e.Fields = &messages.Struct{}
+	}
+	return e.Fields
+}
@@ -0,0 +1,202 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func testEvent(t *testing.T, fields map[string]interface{}) *messages.Event {
+	st, err := helpers.NewStruct(fields)
+	require.NoError(t, err)
+	return &messages.Event{Fields: st}
+}
+
+func TestPipeline(t *testing.T) {
+	var calls []string
+	record := func(name string) Processor {
+		return Func(func(e *messages.Event) (*messages.Event, error) {
+			calls = append(calls, name)
+			return e, nil
+		})
+	}
+	drop := Func(func(*messages.Event) (*messages.Event, error) { return nil, nil })
+
+	e := testEvent(t, nil)
+	out, err := NewPipeline(record("first"), record("second")).Process(e)
+	require.NoError(t, err)
+	require.Same(t, e, out)
+	require.Equal(t, []string{"first", "second"}, calls)
+
+	calls = nil
+	out, err = NewPipeline(record("first"), drop, record("second")).Process(e)
+	require.NoError(t, err)
+	require.Nil(t, out)
+	require.Equal(t, []string{"first"}, calls)
+
+	_, err = NewPipeline(NewDropFields(false, "missing")).Process(e)
+	require.ErrorIs(t, err, helpers.ErrKeyNotFound)
+	require.Contains(t, err.Error(), "drop_fields=missing: ")
+
+	require.Equal(t, "pipeline=[drop_fields=a,b, processors.Func]",
+		NewPipeline(NewDropFields(false, "a", "b"), drop).String())
+}
+
+func TestAddFields(t *testing.T) {
+	p, err := NewAddFields(map[string]interface{}{
+		"env":        "prod",
+		"host.name":  "web-1",
+		"tags":       []interface{}{"a"},
+		"host.known": true,
+	}, false)
+	require.NoError(t, err)
+
+	e := testEvent(t, map[string]interface{}{"env": "dev"})
+	_, err = p.Process(e)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"env":  "dev",
+		"host": map[string]interface{}{"name": "web-1", "known": true},
+		"tags": []interface{}{"a"},
+	}, helpers.AsMap(e.Fields))
+
+	// the values are copied for every event
+	e.Fields.Data["tags"].GetListValue().Values[0] = helpers.NewStringValue("modified")
+	other := &messages.Event{}
+	_, err = p.Process(other)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"a"}, helpers.AsMap(other.Fields)["tags"])
+
+	p, err = NewAddFields(map[string]interface{}{"env": "prod"}, true)
+	require.NoError(t, err)
+	_, err = p.Process(e)
+	require.NoError(t, err)
+	require.Equal(t, "prod", e.Fields.Data["env"].GetStringValue())
+
+	_, err = NewAddFields(map[string]interface{}{"ch": make(chan int)}, false)
+	require.Error(t, err)
+	_, err = NewAddFields(map[string]interface{}{"a": 1, "a.b.c": 2}, false)
+	require.Error(t, err)
+}
+
+func TestDropFields(t *testing.T) {
+	e := testEvent(t, map[string]interface{}{
+		"message": "hello",
+		"host":    map[string]interface{}{"name": "web-1", "ip": "10.0.0.1"},
+	})
+	_, err := NewDropFields(true, "host.ip", "missing").Process(e)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"message": "hello",
+		"host":    map[string]interface{}{"name": "web-1"},
+	}, helpers.AsMap(e.Fields))
+
+	_, err = NewDropFields(false, "missing").Process(e)
+	require.ErrorIs(t, err, helpers.ErrKeyNotFound)
+}
+
+func TestRename(t *testing.T) {
+	e := testEvent(t, map[string]interface{}{
+		"msg":  "hello",
+		"host": "web-1",
+	})
+	p := NewRename([]RenameField{
+		{From: "msg", To: "message"},
+		{From: "host", To: "host_name"},
+		{From: "missing", To: "other"},
+	}, true)
+	_, err := p.Process(e)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"message":   "hello",
+		"host_name": "web-1",
+	}, helpers.AsMap(e.Fields))
+
+	_, err = NewRename([]RenameField{{From: "missing", To: "other"}}, false).Process(e)
+	require.ErrorIs(t, err, helpers.ErrKeyNotFound)
+
+	_, err = NewRename([]RenameField{{From: "message", To: "host_name"}}, false).Process(e)
+	require.ErrorIs(t, err, ErrTargetExists)
+	require.Equal(t, "hello", e.Fields.Data["message"].GetStringValue())
+
+	// the field is kept when the target can't be written
+	_, err = NewRename([]RenameField{{From: "message", To: "host_name.value"}}, false).Process(e)
+	require.Error(t, err)
+	require.Equal(t, "hello", e.Fields.Data["message"].GetStringValue())
+
+	_, err = NewRename([]RenameField{{From: "message", To: "message.text"}}, false).Process(e)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"message":   map[string]interface{}{"text": "hello"},
+		"host_name": "web-1",
+	}, helpers.AsMap(e.Fields))
+}
+
+func TestTimestamp(t *testing.T) {
+	now := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+	p := NewTimestamp(TimestampConfig{
+		Field:    "time",
+		Layouts:  []string{time.RFC3339, "2006-01-02 15:04:05"},
+		Location: time.FixedZone("CEST", 2*60*60),
+		Clock:    clock.NewFake(now),
+	})
+
+	cases := []struct {
+		name   string
+		fields map[string]interface{}
+		ts     *timestamppb.Timestamp
+		exp    time.Time
+	}{
+		{
+			name:   "RFC3339 string",
+			fields: map[string]interface{}{"time": "2022-07-01T10:00:00Z"},
+			exp:    time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "second layout in the configured location",
+			fields: map[string]interface{}{"time": "2022-07-01 10:00:00"},
+			exp:    time.Date(2022, 7, 1, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "timestamp value",
+			fields: map[string]interface{}{"time": time.Date(2022, 7, 2, 0, 0, 0, 0, time.UTC)},
+			exp:    time.Date(2022, 7, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "missing field keeps the timestamp",
+			ts:   timestamppb.New(time.Date(2022, 7, 3, 0, 0, 0, 0, time.UTC)),
+			exp:  time.Date(2022, 7, 3, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "missing timestamp is set to now",
+			exp:  now,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e := testEvent(t, c.fields)
+			e.Timestamp = c.ts
+			_, err := p.Process(e)
+			require.NoError(t, err)
+			require.Equal(t, c.exp, e.Timestamp.AsTime())
+			require.False(t, helpers.HasField(e.Fields, "time"))
+		})
+	}
+
+	_, err := p.Process(testEvent(t, map[string]interface{}{"time": "yesterday"}))
+	require.Error(t, err)
+	_, err = p.Process(testEvent(t, map[string]interface{}{"time": 12}))
+	require.Error(t, err)
+	require.False(t, errors.Is(err, helpers.ErrKeyNotFound))
+}
@@ -0,0 +1,80 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrTargetExists is returned when renaming a field to an existing one.
+var ErrTargetExists = errors.New("target field already exists")
+
+// RenameField moves the field From to To, both dotted paths.
+type RenameField struct {
+	From string
+	To   string
+}
+
+// Rename moves fields of the events.
+type Rename struct {
+	fields        []RenameField
+	ignoreMissing bool
+}
+
+// NewRename returns a processor renaming fields in order. It fails on a
+// missing field unless ignoreMissing is true, and always fails if the
+// target exists.
+func NewRename(fields []RenameField, ignoreMissing bool) *Rename {
+	return &Rename{fields: fields, ignoreMissing: ignoreMissing}
+}
+
+// Process renames the fields of e.
+func (p *Rename) Process(e *messages.Event) (*messages.Event, error) {
+	st := fields(e)
+	for _, field := range p.fields {
+		v, err := helpers.GetField(st, field.From)
+		if err != nil {
+			if p.ignoreMissing && errors.Is(err, helpers.ErrKeyNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if helpers.HasField(st, field.To) {
+			return nil, fmt.Errorf("%w: %s", ErrTargetExists, field.To)
+		}
+		if strings.HasPrefix(field.To, field.From+".") {
+			// moved into itself, the parents of To are replaced by new
+			// structs so the put can't fail
+			if err := helpers.DeleteField(st, field.From); err != nil {
+				return nil, err
+			}
+			if _, err := helpers.PutField(st, field.To, v); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// put first, the field is kept if To can't be written
+		if _, err := helpers.PutField(st, field.To, v); err != nil {
+			return nil, err
+		}
+		if err := helpers.DeleteField(st, field.From); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (p *Rename) String() string {
+	pairs := make([]string, len(p.fields))
+	for i, field := range p.fields {
+		pairs[i] = field.From + "->" + field.To
+	}
+	return "rename=" + strings.Join(pairs, ",")
+}
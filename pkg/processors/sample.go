@@ -0,0 +1,109 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// SampleConfig configures a Sample processor, at least one of Rate and
+// PerSecond must be set.
+type SampleConfig struct {
+	// Rate is the fraction of the events kept, between 0 and 1. Zero
+	// disables the probabilistic sampling.
+	Rate float64
+	// Fields make the probabilistic sampling consistent: the events with
+	// the same values for these dotted paths are all kept or all dropped,
+	// see helpers.Fingerprint. Without fields, events are sampled randomly.
+	Fields []string
+	// PerSecond keeps at most this many events every second, after the
+	// probabilistic sampling. Zero disables the limit.
+	PerSecond int
+	// Clock decides the one second windows of PerSecond, defaults to
+	// clock.Real.
+	Clock clock.Clock
+}
+
+// Sample drops a part of the events, to thin out noisy streams before they
+// reach the shipper.
+type Sample struct {
+	config SampleConfig
+
+	mu     sync.Mutex
+	window time.Time
+	kept   int
+}
+
+// NewSample returns a Sample processor.
+func NewSample(config SampleConfig) (*Sample, error) {
+	if config.Rate < 0 || config.Rate > 1 || math.IsNaN(config.Rate) {
+		return nil, fmt.Errorf("sampling rate must be between 0 and 1, got %v", config.Rate)
+	}
+	if config.PerSecond < 0 {
+		return nil, fmt.Errorf("events per second can't be negative, got %d", config.PerSecond)
+	}
+	if config.Rate == 0 && config.PerSecond == 0 {
+		return nil, errors.New("sampling needs a rate or a number of events per second")
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+	return &Sample{config: config}, nil
+}
+
+// Process returns e if it's sampled, nil otherwise.
+func (p *Sample) Process(e *messages.Event) (*messages.Event, error) {
+	if p.config.Rate > 0 && p.config.Rate < 1 && p.position(e) >= p.config.Rate {
+		return nil, nil
+	}
+	if p.config.PerSecond > 0 && !p.admit() {
+		return nil, nil
+	}
+	return e, nil
+}
+
+// position returns a number in [0, 1), derived from the fingerprint of the
+// fields if any.
+func (p *Sample) position(e *messages.Event) float64 {
+	if len(p.config.Fields) == 0 {
+		//nolint:gosec // sampling doesn't need a secure random source
+		return rand.Float64()
+	}
+	sum, _ := hex.DecodeString(helpers.Fingerprint(e, p.config.Fields...)[:16])
+	// the 53 high bits, like rand.Float64
+	return float64(binary.BigEndian.Uint64(sum)>>11) / (1 << 53)
+}
+
+// admit counts the event in the current one second window, it returns
+// false once the window is full.
+func (p *Sample) admit() bool {
+	window := p.config.Clock.Now().Truncate(time.Second)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !window.Equal(p.window) {
+		p.window = window
+		p.kept = 0
+	}
+	if p.kept >= p.config.PerSecond {
+		return false
+	}
+	p.kept++
+	return true
+}
+
+func (p *Sample) String() string {
+	return fmt.Sprintf("sample=[rate=%v, per_second=%d]", p.config.Rate, p.config.PerSecond)
+}
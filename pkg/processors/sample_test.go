@@ -0,0 +1,90 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+)
+
+func TestSampleRate(t *testing.T) {
+	p, err := NewSample(SampleConfig{Rate: 0.25})
+	require.NoError(t, err)
+
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		out, err := p.Process(testEvent(t, nil))
+		require.NoError(t, err)
+		if out != nil {
+			kept++
+		}
+	}
+	require.InDelta(t, 2500, kept, 300)
+}
+
+func TestSampleConsistent(t *testing.T) {
+	p, err := NewSample(SampleConfig{Rate: 0.5, Fields: []string{"trace.id"}})
+	require.NoError(t, err)
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprint(i)
+		first, err := p.Process(testEvent(t, map[string]interface{}{"trace": map[string]interface{}{"id": id}, "message": "first"}))
+		require.NoError(t, err)
+		second, err := p.Process(testEvent(t, map[string]interface{}{"trace": map[string]interface{}{"id": id}, "message": "second"}))
+		require.NoError(t, err)
+		require.Equal(t, first == nil, second == nil, "trace %s", id)
+		if first != nil {
+			kept++
+		}
+	}
+	require.InDelta(t, 500, kept, 100)
+}
+
+func TestSamplePerSecond(t *testing.T) {
+	clk := clock.NewFake(time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC))
+	p, err := NewSample(SampleConfig{PerSecond: 3, Clock: clk})
+	require.NoError(t, err)
+
+	count := func() int {
+		kept := 0
+		for i := 0; i < 10; i++ {
+			if out, _ := p.Process(testEvent(t, nil)); out != nil {
+				kept++
+			}
+		}
+		return kept
+	}
+	require.Equal(t, 3, count())
+	clk.Advance(500 * time.Millisecond)
+	require.Equal(t, 0, count())
+	clk.Advance(500 * time.Millisecond)
+	require.Equal(t, 3, count())
+}
+
+func TestSampleConfig(t *testing.T) {
+	for _, config := range []SampleConfig{
+		{},
+		{Rate: -0.1},
+		{Rate: 1.5},
+		{PerSecond: -1},
+	} {
+		_, err := NewSample(config)
+		require.Error(t, err, config)
+	}
+
+	p, err := NewSample(SampleConfig{Rate: 1})
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		out, err := p.Process(testEvent(t, nil))
+		require.NoError(t, err)
+		require.NotNil(t, out)
+	}
+}
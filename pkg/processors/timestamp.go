@@ -0,0 +1,89 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// TimestampConfig configures a Timestamp processor.
+type TimestampConfig struct {
+	// Field holds the time of the event, as a timestamp or a string. Once
+	// parsed it becomes the event timestamp and is removed from the fields.
+	// Empty keeps the timestamp of the event.
+	Field string
+	// Layouts parse the string values, in order, they can be the epoch
+	// layouts of helpers.TimestampParser, like helpers.LayoutUnixMs, which
+	// also parse numbers. Defaults to time.RFC3339Nano.
+	Layouts []string
+	// Location is the time zone of the layouts without one, defaults to UTC.
+	Location *time.Location
+	// Clock sets the timestamp of the events without one, defaults to
+	// clock.Real.
+	Clock clock.Clock
+}
+
+// Timestamp normalizes the timestamp of the events: it's read from a field
+// if configured, and set to the current time when missing.
+type Timestamp struct {
+	config TimestampConfig
+	parser *helpers.TimestampParser
+}
+
+// NewTimestamp returns a Timestamp processor, zero values in config are
+// replaced by their defaults.
+func NewTimestamp(config TimestampConfig) *Timestamp {
+	if len(config.Layouts) == 0 {
+		config.Layouts = []string{time.RFC3339Nano}
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+	return &Timestamp{config: config, parser: helpers.NewTimestampParser(helpers.TimestampParserConfig{
+		Layouts:  config.Layouts,
+		Location: config.Location,
+		Clock:    config.Clock,
+	})}
+}
+
+// Process sets the timestamp of e.
+func (p *Timestamp) Process(e *messages.Event) (*messages.Event, error) {
+	if p.config.Field != "" {
+		v, err := helpers.GetField(e.GetFields(), p.config.Field)
+		switch {
+		case errors.Is(err, helpers.ErrKeyNotFound):
+		case err != nil:
+			return nil, err
+		default:
+			ts, err := p.parser.ParseValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp in %s: %w", p.config.Field, err)
+			}
+			e.Timestamp = timestamppb.New(ts)
+			if err := helpers.DeleteField(e.Fields, p.config.Field); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if e.Timestamp == nil {
+		e.Timestamp = timestamppb.New(p.config.Clock.Now())
+	}
+	return e, nil
+}
+
+func (p *Timestamp) String() string {
+	return "timestamp=" + p.config.Field
+}
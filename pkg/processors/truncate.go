@@ -0,0 +1,136 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// TruncatedFlag is added to the marker list of the truncated events.
+const TruncatedFlag = "truncated"
+
+// TruncateConfig configures a Truncate processor.
+type TruncateConfig struct {
+	// MaxBytes is the maximum length of the strings, it must be positive.
+	MaxBytes int
+	// Fields are the dotted paths of the truncated fields, the strings
+	// nested in structs and lists are truncated too. Empty truncates all
+	// the strings of the event.
+	Fields []string
+	// Marker is the dotted path of the list TruncatedFlag is added to when
+	// a string is truncated, like the beats truncate_fields processor.
+	// Defaults to "log.flags".
+	Marker string
+}
+
+// Truncate shortens the strings longer than a number of bytes, so a single
+// giant message isn't rejected by the shipper. Strings are cut at a rune
+// boundary and can end up shorter than the limit.
+type Truncate struct {
+	config TruncateConfig
+}
+
+// NewTruncate returns a Truncate processor.
+func NewTruncate(config TruncateConfig) (*Truncate, error) {
+	if config.MaxBytes <= 0 {
+		return nil, fmt.Errorf("truncation limit must be positive, got %d", config.MaxBytes)
+	}
+	if config.Marker == "" {
+		config.Marker = "log.flags"
+	}
+	return &Truncate{config: config}, nil
+}
+
+// Process truncates the strings of e.
+func (p *Truncate) Process(e *messages.Event) (*messages.Event, error) {
+	truncated := false
+	truncate := func(_ []string, v *messages.Value) error {
+		if p.truncate(v) {
+			truncated = true
+		}
+		return nil
+	}
+	if len(p.config.Fields) == 0 {
+		err := helpers.WalkStruct(e.GetFields(), func(path []string, v *messages.Value) error {
+			// the flags of a previous run stay intact
+			if strings.Join(path, ".") == p.config.Marker {
+				return helpers.ErrSkipChildren
+			}
+			return truncate(path, v)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range p.config.Fields {
+		v, err := helpers.GetField(e.GetFields(), key)
+		if errors.Is(err, helpers.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := helpers.Walk(v, truncate); err != nil {
+			return nil, err
+		}
+	}
+	if truncated {
+		if err := p.mark(e); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// truncate shortens v if it's a string too long, it returns true if it
+// did.
+func (p *Truncate) truncate(v *messages.Value) bool {
+	s, ok := v.GetKind().(*messages.Value_StringValue)
+	if !ok || len(s.StringValue) <= p.config.MaxBytes {
+		return false
+	}
+	end := p.config.MaxBytes
+	for end > 0 && !utf8.RuneStart(s.StringValue[end]) {
+		end--
+	}
+	s.StringValue = s.StringValue[:end]
+	return true
+}
+
+// mark adds TruncatedFlag to the marker list of e, once.
+func (p *Truncate) mark(e *messages.Event) error {
+	st := fields(e)
+	v, err := helpers.GetField(st, p.config.Marker)
+	if errors.Is(err, helpers.ErrKeyNotFound) {
+		_, err = helpers.PutField(st, p.config.Marker, helpers.NewListValue(&messages.ListValue{
+			Values: []*messages.Value{helpers.NewStringValue(TruncatedFlag)},
+		}))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	list := v.GetListValue()
+	if list == nil {
+		return fmt.Errorf("expected a list at %s, got %T", p.config.Marker, v.GetKind())
+	}
+	for _, flag := range list.Values {
+		if flag.GetStringValue() == TruncatedFlag {
+			return nil
+		}
+	}
+	list.Values = append(list.Values, helpers.NewStringValue(TruncatedFlag))
+	return nil
+}
+
+func (p *Truncate) String() string {
+	return fmt.Sprintf("truncate=[max_bytes=%d, fields=%s]", p.config.MaxBytes, strings.Join(p.config.Fields, ","))
+}
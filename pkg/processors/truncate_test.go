@@ -0,0 +1,72 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+)
+
+func TestTruncate(t *testing.T) {
+	p, err := NewTruncate(TruncateConfig{MaxBytes: 5})
+	require.NoError(t, err)
+
+	e := testEvent(t, map[string]interface{}{
+		"message": "hello world",
+		"short":   "hi",
+		"nested":  map[string]interface{}{"list": []interface{}{"abcdefgh", 12345678}},
+		// "é" is 2 bytes, the cut can't split it
+		"accents": "abcdé",
+	})
+	_, err = p.Process(e)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"message": "hello",
+		"short":   "hi",
+		"nested":  map[string]interface{}{"list": []interface{}{"abcde", int64(12345678)}},
+		"accents": "abcd",
+		"log":     map[string]interface{}{"flags": []interface{}{TruncatedFlag}},
+	}, helpers.AsMap(e.Fields))
+
+	// the flag is added once
+	e.Fields.Data["message"] = helpers.NewStringValue("hello again")
+	_, err = p.Process(e)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{TruncatedFlag}, helpers.AsMap(e.Fields)["log"].(map[string]interface{})["flags"])
+}
+
+func TestTruncateFields(t *testing.T) {
+	p, err := NewTruncate(TruncateConfig{MaxBytes: 3, Fields: []string{"message", "missing"}, Marker: "flags"})
+	require.NoError(t, err)
+
+	e := testEvent(t, map[string]interface{}{
+		"message": "hello",
+		"other":   "hello",
+		"flags":   []interface{}{"multiline"},
+	})
+	_, err = p.Process(e)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"message": "hel",
+		"other":   "hello",
+		"flags":   []interface{}{"multiline", TruncatedFlag},
+	}, helpers.AsMap(e.Fields))
+
+	// nothing truncated, no flag
+	e = testEvent(t, map[string]interface{}{"message": "hi"})
+	_, err = p.Process(e)
+	require.NoError(t, err)
+	require.False(t, helpers.HasField(e.Fields, "flags"))
+
+	e = testEvent(t, map[string]interface{}{"message": "hello", "flags": "x"})
+	_, err = p.Process(e)
+	require.Error(t, err)
+
+	_, err = NewTruncate(TruncateConfig{})
+	require.Error(t, err)
+}
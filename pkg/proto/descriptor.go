@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package proto
+
+import (
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ProducerServiceDescriptor returns the descriptor of the Producer service.
+func ProducerServiceDescriptor() protoreflect.ServiceDescriptor {
+	return File_shipper_proto.Services().ByName("Producer")
+}
+
+// FileDescriptorSet returns the descriptors of the shipper API files and of
+// all their imports, the imports first, like protoc --include_imports.
+// Gateways and tools that can't use the reflection service can load the
+// API from it.
+func FileDescriptorSet() *descriptorpb.FileDescriptorSet {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	add(File_shipper_proto)
+	return set
+}
+
+// RegisterReflection registers the gRPC reflection service in s, so tools
+// like grpcurl can list and call the services registered in s, like the
+// Producer service.
+func RegisterReflection(s reflection.GRPCServer) {
+	reflection.Register(s)
+}
@@ -0,0 +1,65 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package proto
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestFileDescriptorSet(t *testing.T) {
+	set := FileDescriptorSet()
+	require.Equal(t, "shipper.proto", set.File[len(set.File)-1].GetName())
+
+	// the imports come first, so the set can be loaded as it is
+	files, err := protodesc.NewFiles(set)
+	require.NoError(t, err)
+	desc, err := files.FindDescriptorByName("elastic.agent.shipper.v1.Producer")
+	require.NoError(t, err)
+	service := desc.(protoreflect.ServiceDescriptor)
+	require.Equal(t, ProducerServiceDescriptor().FullName(), service.FullName())
+	require.NotNil(t, service.Methods().ByName("PublishEvents"))
+}
+
+func TestRegisterReflection(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	RegisterProducerServer(s, UnimplementedProducerServer{})
+	RegisterReflection(s)
+	go func() {
+		_ = s.Serve(listener)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("passthrough:///server",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+	}))
+	reply, err := stream.Recv()
+	require.NoError(t, err)
+	var services []string
+	for _, service := range reply.GetListServicesResponse().GetService() {
+		services = append(services, service.GetName())
+	}
+	require.Contains(t, services, "elastic.agent.shipper.v1.Producer")
+}
@@ -0,0 +1,27 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package messages
+
+// Clear resets the struct like Reset, but keeps the allocated map, so the
+// struct can be reused without allocating a new one.
+func (x *Struct) Clear() {
+	data := x.Data
+	for k := range data {
+		delete(data, k)
+	}
+	x.Reset()
+	x.Data = data
+}
+
+// Clear resets the list like Reset, but keeps the allocated slice, so the
+// list can be reused without allocating a new one.
+func (x *ListValue) Clear() {
+	values := x.Values
+	for i := range values {
+		values[i] = nil
+	}
+	x.Reset()
+	x.Values = values[:0]
+}
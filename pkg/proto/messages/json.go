@@ -5,7 +5,15 @@
 package messages
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.elastic.co/fastjson"
@@ -18,9 +26,18 @@ func (val *Value) MarshalFastJSON(w *fastjson.Writer) error {
 		w.RawString("null")
 		return nil
 	case *Value_Float32Value:
-		w.Float32(typ.Float32Value)
+		if !writeNonFinite(w, float64(typ.Float32Value)) {
+			start := w.Size()
+			w.Float32(typ.Float32Value)
+			writeFloatSuffix(w, start)
+		}
+		return nil
 	case *Value_Float64Value:
-		w.Float64(typ.Float64Value)
+		if !writeNonFinite(w, typ.Float64Value) {
+			start := w.Size()
+			w.Float64(typ.Float64Value)
+			writeFloatSuffix(w, start)
+		}
 		return nil
 	case *Value_Int32Value:
 		w.Int64(int64(typ.Int32Value))
@@ -45,7 +62,7 @@ func (val *Value) MarshalFastJSON(w *fastjson.Writer) error {
 		if err != nil {
 			return fmt.Errorf("error marshaling within value: %w", err)
 		}
-		// return data, nil
+		return nil
 	case *Value_ListValue:
 		err := typ.ListValue.MarshalFastJSON(w)
 		if err != nil {
@@ -56,17 +73,40 @@ func (val *Value) MarshalFastJSON(w *fastjson.Writer) error {
 		w.RawByte('"')
 		w.Time(typ.TimestampValue.AsTime(), time.RFC3339Nano)
 		w.RawByte('"')
+	case *Value_BytesValue:
+		w.String(base64.StdEncoding.EncodeToString(typ.BytesValue))
 	default:
 		return fmt.Errorf("Unknown type %T in event", typ)
 	}
 	return nil
 }
 
+// writeNonFinite writes NaN and infinite values as strings, since JSON has no
+// representation for them. It returns false if f is finite.
+func writeNonFinite(w *fastjson.Writer, f float64) bool {
+	switch {
+	case math.IsNaN(f):
+		w.RawString(`"NaN"`)
+	case math.IsInf(f, 1):
+		w.RawString(`"Infinity"`)
+	case math.IsInf(f, -1):
+		w.RawString(`"-Infinity"`)
+	default:
+		return false
+	}
+	return true
+}
+
+// writeFloatSuffix completes the float written since start with ".0" when
+// it looks like an integer, so that it isn't decoded back as one.
+func writeFloatSuffix(w *fastjson.Writer, start int) {
+	if !bytes.ContainsAny(w.Bytes()[start:], ".eE") {
+		w.RawString(".0")
+	}
+}
+
 // MarshalFastJSON implements the JSON interface for the struct type
 func (sv *Struct) MarshalFastJSON(w *fastjson.Writer) error {
-	if sv.GetData() == nil {
-		return nil
-	}
 	w.RawByte('{')
 	beginning := true
 	for key, val := range sv.GetData() {
@@ -76,9 +116,8 @@ func (sv *Struct) MarshalFastJSON(w *fastjson.Writer) error {
 			beginning = false
 		}
 
-		w.RawString("\"")
-		w.RawString(key)
-		w.RawString("\":")
+		w.String(key)
+		w.RawByte(':')
 		err := val.MarshalFastJSON(w)
 		if err != nil {
 			return fmt.Errorf("error marshaling value in map: %w", err)
@@ -90,16 +129,228 @@ func (sv *Struct) MarshalFastJSON(w *fastjson.Writer) error {
 
 // MarshalFastJSON implements the JSON interface for the list Value type
 func (lv *ListValue) MarshalFastJSON(w *fastjson.Writer) error {
-	if lv.GetValues() == nil {
-		return nil
-	}
 	w.RawByte('[')
 	for iter, val := range lv.GetValues() {
 		if iter > 0 {
 			w.RawByte(',')
 		}
-		val.MarshalFastJSON(w)
+		if err := val.MarshalFastJSON(w); err != nil {
+			return fmt.Errorf("error marshaling value in list: %w", err)
+		}
 	}
 	w.RawByte(']')
 	return nil
 }
+
+// MarshalJSON implements json.Marshaler, the value is encoded like
+// MarshalFastJSON does.
+func (val *Value) MarshalJSON() ([]byte, error) {
+	var w fastjson.Writer
+	if err := val.MarshalFastJSON(&w); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// MarshalJSON implements json.Marshaler, the struct is encoded like
+// MarshalFastJSON does.
+func (sv *Struct) MarshalJSON() ([]byte, error) {
+	var w fastjson.Writer
+	if err := sv.MarshalFastJSON(&w); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// MarshalJSON implements json.Marshaler, the list is encoded like
+// MarshalFastJSON does.
+func (lv *ListValue) MarshalJSON() ([]byte, error) {
+	var w fastjson.Writer
+	if err := lv.MarshalFastJSON(&w); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, replacing the kind of val.
+// Integers are stored as Int64 or Uint64 values when they fit, other
+// numbers as Float64 values. Integers beyond 64 bits and floats out of the
+// float64 range are stored as strings, so no precision is lost. JSON has no
+// timestamps or bytes: the strings MarshalJSON writes for them are decoded
+// as string values.
+func (val *Value) UnmarshalJSON(data []byte) error {
+	dec := newJSONDecoder(data)
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return fmt.Errorf("error reading JSON: %w", err)
+	}
+	if err := expectJSONEnd(dec, "value"); err != nil {
+		return err
+	}
+	val.Kind = v.Kind
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, replacing the fields of sv
+// with the ones of the JSON object. The values are decoded like
+// Value.UnmarshalJSON does.
+func (sv *Struct) UnmarshalJSON(data []byte) error {
+	dec := newJSONDecoder(data)
+	if err := expectJSONDelim(dec, '{', "object"); err != nil {
+		return err
+	}
+	st, err := decodeJSONStruct(dec)
+	if err != nil {
+		return err
+	}
+	if err := expectJSONEnd(dec, "object"); err != nil {
+		return err
+	}
+	sv.Data = st.Data
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, replacing the values of lv
+// with the ones of the JSON array. The values are decoded like
+// Value.UnmarshalJSON does.
+func (lv *ListValue) UnmarshalJSON(data []byte) error {
+	dec := newJSONDecoder(data)
+	if err := expectJSONDelim(dec, '[', "array"); err != nil {
+		return err
+	}
+	list, err := decodeJSONList(dec)
+	if err != nil {
+		return fmt.Errorf("error reading JSON: %w", err)
+	}
+	if err := expectJSONEnd(dec, "array"); err != nil {
+		return err
+	}
+	lv.Values = list.Values
+	return nil
+}
+
+func newJSONDecoder(data []byte) *json.Decoder {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec
+}
+
+// expectJSONDelim reads the opening delimiter of an object or array.
+func expectJSONDelim(dec *json.Decoder, delim json.Delim, what string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("error reading JSON: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected a JSON %s, got %v", what, tok)
+	}
+	return nil
+}
+
+func expectJSONEnd(dec *json.Decoder, what string) error {
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("unexpected data after the JSON %s", what)
+	}
+	return nil
+}
+
+// decodeJSONStruct reads the fields of an object whose opening brace was already consumed.
+func decodeJSONStruct(dec *json.Decoder) (*Struct, error) {
+	st := &Struct{Data: map[string]*Value{}}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error reading JSON key: %w", err)
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a JSON key, got %v", tok)
+		}
+		value, err := decodeJSONValue(dec)
+		if err != nil {
+			return nil, fmt.Errorf("error reading JSON key %q: %w", key, err)
+		}
+		st.Data[key] = value
+	}
+	// closing brace
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("error reading JSON: %w", err)
+	}
+	return st, nil
+}
+
+// decodeJSONList reads the values of an array whose opening bracket was already consumed.
+func decodeJSONList(dec *json.Decoder) (*ListValue, error) {
+	list := &ListValue{}
+	for dec.More() {
+		v, err := decodeJSONValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		list.Values = append(list.Values, v)
+	}
+	// closing bracket
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (*Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case nil:
+		return &Value{Kind: &Value_NullValue{NullValue: NullValue_NULL_VALUE}}, nil
+	case bool:
+		return &Value{Kind: &Value_BoolValue{BoolValue: t}}, nil
+	case string:
+		return &Value{Kind: &Value_StringValue{StringValue: t}}, nil
+	case json.Number:
+		return jsonNumberValue(t)
+	case json.Delim:
+		switch t {
+		case '{':
+			st, err := decodeJSONStruct(dec)
+			if err != nil {
+				return nil, err
+			}
+			return &Value{Kind: &Value_StructValue{StructValue: st}}, nil
+		case '[':
+			list, err := decodeJSONList(dec)
+			if err != nil {
+				return nil, err
+			}
+			return &Value{Kind: &Value_ListValue{ListValue: list}}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
+
+// jsonNumberValue converts a JSON number to the narrowest lossless Value
+// kind. The numbers that can't be represented by a 64 bits kind are kept as
+// strings: integers that don't fit in 64 bits and floats out of the float64
+// range.
+func jsonNumberValue(n json.Number) (*Value, error) {
+	s := n.String()
+	integer := !strings.ContainsAny(s, ".eE")
+	if integer {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return &Value{Kind: &Value_Int64Value{Int64Value: i}}, nil
+		}
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return &Value{Kind: &Value_Uint64Value{Uint64Value: u}}, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	switch {
+	case errors.Is(err, strconv.ErrRange) || (err == nil && integer):
+		return &Value{Kind: &Value_StringValue{StringValue: s}}, nil
+	case err != nil:
+		return nil, fmt.Errorf("invalid JSON number %q: %w", s, err)
+	}
+	return &Value{Kind: &Value_Float64Value{Float64Value: f}}, nil
+}
@@ -0,0 +1,122 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// gRPC metadata keys identifying the caller.
+const (
+	AgentIDKey        = "elastic-shipper-agent-id"
+	InputIDKey        = "elastic-shipper-input-id"
+	PolicyRevisionKey = "elastic-shipper-policy-revision"
+)
+
+// Metadata identifies the caller of the shipper, so shippers can correlate
+// the calls and streams of an input without parsing the events. Empty
+// fields are not sent.
+type Metadata struct {
+	// AgentID is the ID of the Elastic Agent running the input.
+	AgentID string
+	// InputID is the ID of the input in the policy.
+	InputID string
+	// PolicyRevision is the revision of the policy the input runs with.
+	PolicyRevision int64
+}
+
+// pairs returns the metadata key-value pairs of the non-empty fields.
+func (m Metadata) pairs() []string {
+	var kv []string
+	if m.AgentID != "" {
+		kv = append(kv, AgentIDKey, m.AgentID)
+	}
+	if m.InputID != "" {
+		kv = append(kv, InputIDKey, m.InputID)
+	}
+	if m.PolicyRevision != 0 {
+		kv = append(kv, PolicyRevisionKey, strconv.FormatInt(m.PolicyRevision, 10))
+	}
+	return kv
+}
+
+// NewOutgoingContext returns ctx with the metadata sent by the calls using
+// it, replacing the fields already set in ctx.
+func NewOutgoingContext(ctx context.Context, m Metadata) context.Context {
+	kv := m.pairs()
+	if len(kv) == 0 {
+		return ctx
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	for i := 0; i < len(kv); i += 2 {
+		md.Set(kv[i], kv[i+1])
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// MetadataFromIncomingContext returns the metadata sent by the caller of a
+// shipper call. The fields the caller didn't send are empty.
+func MetadataFromIncomingContext(ctx context.Context) (Metadata, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	m := Metadata{
+		AgentID: first(md, AgentIDKey),
+		InputID: first(md, InputIDKey),
+	}
+	if revision := first(md, PolicyRevisionKey); revision != "" {
+		var err error
+		m.PolicyRevision, err = strconv.ParseInt(revision, 10, 64)
+		if err != nil {
+			return Metadata{}, fmt.Errorf("invalid policy revision %q", revision)
+		}
+	}
+	return m, nil
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// DialOptions returns the dial options sending the metadata with every call
+// of the client, the metadata set on the context of a call takes
+// precedence.
+func (m Metadata) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(m.withDefaults(ctx), method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(m.withDefaults(ctx), desc, cc, method, opts...)
+		}),
+	}
+}
+
+// withDefaults adds the fields of m that are not set in ctx.
+func (m Metadata) withDefaults(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	var missing Metadata
+	if len(md.Get(AgentIDKey)) == 0 {
+		missing.AgentID = m.AgentID
+	}
+	if len(md.Get(InputIDKey)) == 0 {
+		missing.InputID = m.InputID
+	}
+	if len(md.Get(PolicyRevisionKey)) == 0 {
+		missing.PolicyRevision = m.PolicyRevision
+	}
+	return NewOutgoingContext(ctx, missing)
+}
@@ -0,0 +1,75 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package protocol
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func TestMetadata(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []Metadata
+	)
+	srv := startShipper(t, grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		m, err := MetadataFromIncomingContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		received = append(received, m)
+		mu.Unlock()
+		return handler(ctx, req)
+	}))
+
+	defaults := Metadata{AgentID: "agent-1", InputID: "filestream-1", PolicyRevision: 3}
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: append(defaults.DialOptions(), srv.DialOption()),
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	req := &messages.PublishRequest{Events: []*messages.Event{{}}}
+	_, err = c.Publish(context.Background(), req)
+	require.NoError(t, err)
+	ctx := NewOutgoingContext(context.Background(), Metadata{InputID: "filestream-2", PolicyRevision: 4})
+	_, err = c.Publish(ctx, req)
+	require.NoError(t, err)
+
+	require.Equal(t, []Metadata{
+		defaults,
+		{AgentID: "agent-1", InputID: "filestream-2", PolicyRevision: 4},
+	}, received)
+}
+
+func TestMetadataContexts(t *testing.T) {
+	ctx := NewOutgoingContext(context.Background(), Metadata{AgentID: "agent-1"})
+	ctx = NewOutgoingContext(ctx, Metadata{AgentID: "agent-2", InputID: "input-1"})
+	md, _ := metadata.FromOutgoingContext(ctx)
+	require.Equal(t, []string{"agent-2"}, md.Get(AgentIDKey))
+	require.Equal(t, []string{"input-1"}, md.Get(InputIDKey))
+	require.Empty(t, md.Get(PolicyRevisionKey))
+
+	bg := context.Background()
+	require.Equal(t, bg, NewOutgoingContext(bg, Metadata{}))
+
+	m, err := MetadataFromIncomingContext(bg)
+	require.NoError(t, err)
+	require.Equal(t, Metadata{}, m)
+
+	_, err = MetadataFromIncomingContext(metadata.NewIncomingContext(bg, metadata.Pairs(PolicyRevisionKey, "latest")))
+	require.Error(t, err)
+}
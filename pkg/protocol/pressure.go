@@ -0,0 +1,38 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// QueuePressureKey is the reply header of PublishEvents holding how full
+// the shipper queue is, from 0 for empty to 1 for full. Publishers slow down
+// before the shipper starts rejecting events.
+const QueuePressureKey = "elastic-shipper-queue-pressure"
+
+// SetQueuePressure sends the queue pressure in the reply headers of the
+// call of ctx, it must be called by shippers before replying.
+func SetQueuePressure(ctx context.Context, pressure float64) error {
+	if pressure < 0 || pressure > 1 {
+		return fmt.Errorf("queue pressure must be between 0 and 1, got %v", pressure)
+	}
+	return grpc.SetHeader(ctx, metadata.Pairs(QueuePressureKey, strconv.FormatFloat(pressure, 'f', -1, 64)))
+}
+
+// QueuePressure returns the queue pressure in the reply headers of a call,
+// ok is false when the shipper didn't send a valid one.
+func QueuePressure(header metadata.MD) (pressure float64, ok bool) {
+	pressure, err := strconv.ParseFloat(first(header, QueuePressureKey), 64)
+	if err != nil || pressure < 0 || pressure > 1 {
+		return 0, false
+	}
+	return pressure, true
+}
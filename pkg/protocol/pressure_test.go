@@ -0,0 +1,36 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestQueuePressure(t *testing.T) {
+	cases := []struct {
+		value    string
+		pressure float64
+		ok       bool
+	}{
+		{"0.75", 0.75, true},
+		{"1", 1, true},
+		{"", 0, false},
+		{"high", 0, false},
+		{"1.5", 0, false},
+		{"-1", 0, false},
+	}
+	for _, c := range cases {
+		header := metadata.MD{}
+		if c.value != "" {
+			header.Set(QueuePressureKey, c.value)
+		}
+		pressure, ok := QueuePressure(header)
+		require.Equal(t, c.ok, ok, c.value)
+		require.Equal(t, c.pressure, pressure, c.value)
+	}
+}
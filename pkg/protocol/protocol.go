@@ -0,0 +1,268 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package protocol negotiates the version of the shipper protocol between
+// clients and shippers, so mixed-version deployments fail with a clear
+// error instead of misinterpreting each other. The versions are exchanged
+// in the gRPC metadata of every call by the interceptors of the package:
+//
+//	c, err := client.New(ctx, address, client.Options{
+//		DialOptions: protocol.DialOptions(),
+//	})
+//
+//	g := grpc.NewServer(protocol.ServerOptions()...)
+//
+// Peers that don't send their version, built before the negotiation, are
+// assumed to be compatible.
+//
+// The package also defines the metadata identifying the caller, see
+// Metadata.
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// MetadataKey is the gRPC metadata key holding the protocol version of the
+// client in the requests and of the shipper in the reply headers.
+const MetadataKey = "elastic-shipper-protocol-version"
+
+// Version is a version of the shipper protocol. Peers with the same major
+// version are compatible, the minor version is incremented for additions,
+// like new value kinds, that older peers ignore.
+type Version struct {
+	Major, Minor int
+}
+
+// Current is the version of the protocol defined by this module.
+var Current = Version{Major: 1, Minor: 0}
+
+func (v Version) String() string {
+	return strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor)
+}
+
+// ParseVersion parses a "major.minor" version.
+func ParseVersion(s string) (Version, error) {
+	major, minor, ok := strings.Cut(s, ".")
+	if !ok {
+		return Version{}, fmt.Errorf("invalid protocol version %q", s)
+	}
+	var v Version
+	var err1, err2 error
+	v.Major, err1 = strconv.Atoi(major)
+	v.Minor, err2 = strconv.Atoi(minor)
+	if err1 != nil || err2 != nil || v.Major < 0 || v.Minor < 0 {
+		return Version{}, fmt.Errorf("invalid protocol version %q", s)
+	}
+	return v, nil
+}
+
+// ErrIncompatible is matched by IncompatibleError with errors.Is.
+var ErrIncompatible = errors.New("incompatible shipper protocol versions")
+
+// IncompatibleError is returned when the client and the shipper speak
+// incompatible versions of the protocol. It converts to a FailedPrecondition
+// gRPC status.
+type IncompatibleError struct {
+	Client, Shipper Version
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("%s: the client speaks %s and the shipper %s, %s", ErrIncompatible, e.Client, e.Shipper, e.Guidance())
+}
+
+// Guidance tells which side to upgrade.
+func (e *IncompatibleError) Guidance() string {
+	if e.Client.Major > e.Shipper.Major {
+		return fmt.Sprintf("upgrade the shipper, with Elastic Agent, to a version supporting protocol %d.x", e.Client.Major)
+	}
+	return fmt.Sprintf("upgrade the client, the Beat or input publishing the events, to a version supporting protocol %d.x", e.Shipper.Major)
+}
+
+// Is makes IncompatibleError match ErrIncompatible.
+func (e *IncompatibleError) Is(target error) bool {
+	return target == ErrIncompatible
+}
+
+// GRPCStatus implements the interface of status.FromError.
+func (e *IncompatibleError) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
+
+// Check returns an IncompatibleError if the versions are incompatible.
+func Check(client, shipper Version) error {
+	if client.Major != shipper.Major {
+		return &IncompatibleError{Client: client, Shipper: shipper}
+	}
+	return nil
+}
+
+// versionFrom returns the version in md, ok is false when there is none.
+func versionFrom(md metadata.MD) (v Version, ok bool, err error) {
+	values := md.Get(MetadataKey)
+	if len(values) == 0 {
+		return Version{}, false, nil
+	}
+	v, err = ParseVersion(values[0])
+	return v, err == nil, err
+}
+
+// DialOptions returns the dial options installing both client interceptors
+// with the Current version.
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor(Current)),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptor(Current)),
+	}
+}
+
+// UnaryClientInterceptor sends the client version with every unary call,
+// and turns the rejections of a shipper speaking an incompatible version
+// into an IncompatibleError.
+func UnaryClientInterceptor(version Version) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		var header, trailer metadata.MD
+		callOpts = append(callOpts, grpc.Header(&header), grpc.Trailer(&trailer))
+		err := invoker(withVersion(ctx, version), method, req, reply, cc, callOpts...)
+		return incompatible(version, err, header, trailer)
+	}
+}
+
+// StreamClientInterceptor is UnaryClientInterceptor for streams, the
+// IncompatibleError is returned when receiving from the stream.
+func StreamClientInterceptor(version Version) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(withVersion(ctx, version), desc, cc, method, callOpts...)
+		if err != nil {
+			return nil, err
+		}
+		return &versionedStream{ClientStream: stream, version: version}, nil
+	}
+}
+
+type versionedStream struct {
+	grpc.ClientStream
+	version Version
+}
+
+func (s *versionedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if status.Code(err) != codes.FailedPrecondition {
+		return err
+	}
+	// the stream is over, so the header and trailer are available
+	header, _ := s.ClientStream.Header()
+	return incompatible(s.version, err, header, s.ClientStream.Trailer())
+}
+
+func withVersion(ctx context.Context, version Version) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, MetadataKey, version.String())
+}
+
+// incompatible converts the FailedPrecondition errors of a shipper with an
+// incompatible version.
+func incompatible(client Version, err error, header, trailer metadata.MD) error {
+	if status.Code(err) != codes.FailedPrecondition {
+		return err
+	}
+	shipper, ok, _ := versionFrom(header)
+	if !ok {
+		shipper, ok, _ = versionFrom(trailer)
+	}
+	if !ok {
+		return err
+	}
+	if incompatible := Check(client, shipper); incompatible != nil {
+		return incompatible
+	}
+	return err
+}
+
+// ServerOptions returns the server options installing both server
+// interceptors with the Current version.
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor(Current)),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor(Current)),
+	}
+}
+
+// UnaryServerInterceptor sends the shipper version in the header of every
+// unary call, and rejects the calls of clients speaking an incompatible
+// version with a FailedPrecondition status.
+func UnaryServerInterceptor(version Version) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkIncoming(ctx, version); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streams.
+func StreamServerInterceptor(version Version) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkIncoming(stream.Context(), version); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+func checkIncoming(ctx context.Context, shipper Version) error {
+	if err := grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, shipper.String())); err != nil {
+		return err
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	client, ok, err := versionFrom(md)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !ok {
+		return nil
+	}
+	return Check(client, shipper)
+}
+
+// Handshake checks that the shipper at the other end of conn speaks a
+// version compatible with Current, with a PersistedIndex call that returns
+// right away. It returns the version of the shipper, zero when the shipper
+// doesn't send it, or an IncompatibleError.
+func Handshake(ctx context.Context, conn grpc.ClientConnInterface) (Version, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := pb.NewProducerClient(conn).PersistedIndex(withVersion(ctx, Current), &messages.PersistedIndexRequest{})
+	if err != nil {
+		return Version{}, err
+	}
+	if _, err := stream.Recv(); err != nil {
+		header, _ := stream.Header()
+		return Version{}, incompatible(Current, err, header, stream.Trailer())
+	}
+	header, err := stream.Header()
+	if err != nil {
+		return Version{}, err
+	}
+	shipper, ok, err := versionFrom(header)
+	if err != nil {
+		return Version{}, err
+	}
+	if !ok {
+		return Version{}, nil
+	}
+	return shipper, Check(Current, shipper)
+}
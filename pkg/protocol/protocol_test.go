@@ -0,0 +1,124 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package protocol
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func startShipper(t *testing.T, opts ...grpc.ServerOption) *servertest.Server {
+	srv := servertest.New(servertest.Options{ServerOptions: opts})
+	srv.Start()
+	t.Cleanup(srv.Stop)
+	return srv
+}
+
+func newClient(t *testing.T, srv *servertest.Server) *client.Client {
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: append(DialOptions(), srv.DialOption()),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("1.12")
+	require.NoError(t, err)
+	require.Equal(t, Version{Major: 1, Minor: 12}, v)
+	require.Equal(t, "1.12", v.String())
+
+	for _, s := range []string{"", "1", "1.x", "-1.0", "1.0.0"} {
+		_, err := ParseVersion(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestCompatibleVersions(t *testing.T) {
+	shipper := Version{Major: Current.Major, Minor: Current.Minor + 1}
+	srv := startShipper(t, grpc.ChainUnaryInterceptor(UnaryServerInterceptor(shipper)),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor(shipper)))
+
+	conn, err := srv.Dial(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	v, err := Handshake(context.Background(), conn)
+	require.NoError(t, err)
+	require.Equal(t, shipper, v)
+
+	c := newClient(t, srv)
+	_, err = c.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.NoError(t, err)
+}
+
+func TestIncompatibleVersions(t *testing.T) {
+	shipper := Version{Major: Current.Major + 1}
+	srv := startShipper(t, grpc.ChainUnaryInterceptor(UnaryServerInterceptor(shipper)),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor(shipper)))
+
+	conn, err := srv.Dial(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = Handshake(context.Background(), conn)
+	var incompatible *IncompatibleError
+	require.ErrorAs(t, err, &incompatible)
+	require.Equal(t, IncompatibleError{Client: Current, Shipper: shipper}, *incompatible)
+	require.Contains(t, err.Error(), "upgrade the client")
+
+	c := newClient(t, srv)
+	_, err = c.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.ErrorIs(t, err, ErrIncompatible)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	require.Empty(t, srv.Events())
+
+	stream, err := c.PersistedIndex(context.Background(), &messages.PersistedIndexRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.ErrorIs(t, err, ErrIncompatible)
+}
+
+func TestShipperWithoutVersion(t *testing.T) {
+	srv := startShipper(t)
+	conn, err := srv.Dial(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	v, err := Handshake(context.Background(), conn)
+	require.NoError(t, err)
+	require.Zero(t, v)
+}
+
+func TestClientWithoutVersion(t *testing.T) {
+	srv := startShipper(t, ServerOptions()...)
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: []grpc.DialOption{srv.DialOption()},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Publish(context.Background(), &messages.PublishRequest{Events: []*messages.Event{{}}})
+	require.NoError(t, err)
+}
+
+func TestGuidance(t *testing.T) {
+	err := Check(Version{Major: 2}, Version{Major: 1, Minor: 3})
+	require.True(t, errors.Is(err, ErrIncompatible))
+	require.EqualError(t, err, "incompatible shipper protocol versions: the client speaks 2.0 and the shipper 1.3, "+
+		"upgrade the shipper, with Elastic Agent, to a version supporting protocol 2.x")
+	require.NoError(t, Check(Version{Major: 1}, Version{Major: 1, Minor: 3}))
+}
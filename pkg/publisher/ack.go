@@ -0,0 +1,200 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrShipperRestarted is reported for events accepted by a shipper process
+// that restarted before persisting them. They must be published again.
+var ErrShipperRestarted = errors.New("shipper restarted before the events were persisted")
+
+// PersistedIndexSubscriber streams persisted index updates, it's
+// implemented by client.Client.
+type PersistedIndexSubscriber interface {
+	SubscribePersistedIndex(ctx context.Context, interval time.Duration, fn func(*messages.PersistedIndexReply) error) error
+}
+
+type ackWaiter struct {
+	// id identifies the waiter, to remove it when Wait returns early
+	id    uint64
+	uuid  string
+	index uint64
+	fn    func(error)
+}
+
+// waiterHeap orders waiters by index, so the ones persisted first are at the top.
+type waiterHeap []ackWaiter
+
+func (h waiterHeap) Len() int            { return len(h) }
+func (h waiterHeap) Less(i, j int) bool  { return h[i].index < h[j].index }
+func (h waiterHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *waiterHeap) Push(x interface{}) { *h = append(*h, x.(ackWaiter)) }
+func (h *waiterHeap) Pop() interface{} {
+	old := *h
+	w := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return w
+}
+
+// AckTracker follows the persisted index of the shipper and notifies
+// producers once the events they published are persisted.
+// It is safe for concurrent use.
+type AckTracker struct {
+	mu        sync.Mutex
+	uuid      string
+	persisted uint64
+	waiters   waiterHeap
+	lastID    uint64
+}
+
+// NewAckTracker returns an AckTracker that hasn't seen any update yet.
+func NewAckTracker() *AckTracker {
+	return &AckTracker{}
+}
+
+// Run feeds the tracker with the updates streamed by sub, polled every
+// interval, until ctx is done.
+func (t *AckTracker) Run(ctx context.Context, sub PersistedIndexSubscriber, interval time.Duration) error {
+	return sub.SubscribePersistedIndex(ctx, interval, func(reply *messages.PersistedIndexReply) error {
+		t.Update(reply)
+		return nil
+	})
+}
+
+// Update records a persisted index reported by the shipper.
+func (t *AckTracker) Update(reply *messages.PersistedIndexReply) {
+	var restarted []ackWaiter
+
+	t.mu.Lock()
+	if reply.GetUuid() != t.uuid {
+		t.uuid = reply.GetUuid()
+		t.persisted = 0
+		restarted = t.removeOtherShippersLocked()
+	}
+	if reply.GetPersistedIndex() > t.persisted {
+		t.persisted = reply.GetPersistedIndex()
+	}
+	persisted := t.popPersistedLocked()
+	t.mu.Unlock()
+
+	for _, w := range restarted {
+		w.fn(ErrShipperRestarted)
+	}
+	for _, w := range persisted {
+		w.fn(nil)
+	}
+}
+
+// removeOtherShippersLocked removes the waiters for events accepted by
+// another shipper process than the current one.
+func (t *AckTracker) removeOtherShippersLocked() []ackWaiter {
+	var removed []ackWaiter
+	remaining := t.waiters[:0]
+	for _, w := range t.waiters {
+		if t.matches(w) {
+			remaining = append(remaining, w)
+		} else {
+			removed = append(removed, w)
+		}
+	}
+	t.waiters = remaining
+	heap.Init(&t.waiters)
+	return removed
+}
+
+// popPersistedLocked removes the waiters whose index is persisted.
+func (t *AckTracker) popPersistedLocked() []ackWaiter {
+	var persisted []ackWaiter
+	for len(t.waiters) > 0 && t.waiters[0].index <= t.persisted {
+		persisted = append(persisted, heap.Pop(&t.waiters).(ackWaiter))
+	}
+	return persisted
+}
+
+func (t *AckTracker) matches(w ackWaiter) bool {
+	return w.uuid == "" || t.uuid == "" || w.uuid == t.uuid
+}
+
+// OnPersisted calls fn once the shipper process identified by uuid has
+// persisted index, with a nil error, or with ErrShipperRestarted if the
+// shipper restarts first. An empty uuid matches any shipper process.
+func (t *AckTracker) OnPersisted(uuid string, index uint64, fn func(error)) {
+	t.register(uuid, index, fn)
+}
+
+// register implements OnPersisted, it returns the id of the waiter, or zero
+// if fn was called right away.
+func (t *AckTracker) register(uuid string, index uint64, fn func(error)) uint64 {
+	w := ackWaiter{uuid: uuid, index: index, fn: fn}
+
+	t.mu.Lock()
+	switch {
+	case !t.matches(w):
+		t.mu.Unlock()
+		fn(ErrShipperRestarted)
+		return 0
+	case t.uuid != "" && index <= t.persisted:
+		t.mu.Unlock()
+		fn(nil)
+		return 0
+	}
+	t.lastID++
+	w.id = t.lastID
+	heap.Push(&t.waiters, w)
+	t.mu.Unlock()
+	return w.id
+}
+
+// remove removes the waiter id, unless it was already notified.
+func (t *AckTracker) remove(id uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, w := range t.waiters {
+		if w.id == id {
+			heap.Remove(&t.waiters, i)
+			return
+		}
+	}
+}
+
+// Wait blocks until index is persisted by the shipper process identified by
+// uuid, the shipper restarts or ctx is done.
+func (t *AckTracker) Wait(ctx context.Context, uuid string, index uint64) error {
+	result := make(chan error, 1)
+	id := t.register(uuid, index, func(err error) {
+		result <- err
+	})
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		if id != 0 {
+			t.remove(id)
+		}
+		return ctx.Err()
+	}
+}
+
+// Persisted returns the last uuid and persisted index reported by the shipper.
+func (t *AckTracker) Persisted() (uuid string, index uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.uuid, t.persisted
+}
+
+// Pending returns the number of registered waiters not notified yet.
+func (t *AckTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.waiters)
+}
@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func TestAckTrackerUpdate(t *testing.T) {
+	tracker := NewAckTracker()
+
+	var results []error
+	var order []uint64
+	register := func(uuid string, index uint64) {
+		tracker.OnPersisted(uuid, index, func(err error) {
+			results = append(results, err)
+			order = append(order, index)
+		})
+	}
+	register("shipper-1", 3)
+	register("shipper-1", 1)
+	register("", 2)
+	require.Equal(t, 3, tracker.Pending())
+
+	tracker.Update(&messages.PersistedIndexReply{Uuid: "shipper-1", PersistedIndex: 2})
+	require.Equal(t, []uint64{1, 2}, order)
+	require.Equal(t, []error{nil, nil}, results)
+
+	// already persisted indexes are notified right away
+	register("shipper-1", 2)
+	require.Equal(t, []uint64{1, 2, 2}, order)
+
+	// the persisted index never goes back for the same process
+	tracker.Update(&messages.PersistedIndexReply{Uuid: "shipper-1", PersistedIndex: 1})
+	uuid, index := tracker.Persisted()
+	require.Equal(t, "shipper-1", uuid)
+	require.Equal(t, uint64(2), index)
+
+	tracker.Update(&messages.PersistedIndexReply{Uuid: "shipper-2"})
+	require.Equal(t, []uint64{1, 2, 2, 3}, order)
+	require.ErrorIs(t, results[3], ErrShipperRestarted)
+	require.Zero(t, tracker.Pending())
+
+	register("shipper-1", 1)
+	require.ErrorIs(t, results[4], ErrShipperRestarted)
+}
+
+func TestAckTrackerWait(t *testing.T) {
+	srv, client := newTestServer(t, servertest.Options{UUID: "shipper"})
+	batcher := NewBatcher(client, BatcherConfig{})
+	defer batcher.Close(context.Background())
+
+	tracker := NewAckTracker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = tracker.Run(ctx, client, time.Millisecond)
+	}()
+
+	acks := make(chan Ack, 2)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, batcher.Add(ctx, testEvent("test"), func(ack Ack) { acks <- ack }))
+	}
+	require.NoError(t, batcher.Flush(ctx))
+	first, last := <-acks, <-acks
+
+	require.NoError(t, srv.Persist(first.Index))
+	require.NoError(t, tracker.Wait(ctx, first.UUID, first.Index))
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer waitCancel()
+	require.ErrorIs(t, tracker.Wait(waitCtx, last.UUID, last.Index), context.DeadlineExceeded)
+	require.Zero(t, tracker.Pending(), "the canceled wait is not registered anymore")
+
+	srv.Restart("restarted")
+	require.ErrorIs(t, tracker.Wait(ctx, last.UUID, last.Index), ErrShipperRestarted)
+}
@@ -0,0 +1,536 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/processors"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+var (
+	// ErrQueueFull is returned by AsyncPublisher.Publish in OverflowError
+	// mode. It matches helpers.ErrQueueFull.
+	ErrQueueFull = newKindError("publisher queue is full", helpers.ErrQueueFull)
+	// ErrDropped is reported to the ack of the events evicted from the queue
+	// in OverflowDropOldest mode.
+	ErrDropped = errors.New("event dropped from a full publisher queue")
+	// ErrShed is returned for the events rejected by the load shedder.
+	ErrShed = errors.New("event shed under memory pressure")
+)
+
+// OverflowMode selects what AsyncPublisher.Publish does when the queue is full.
+type OverflowMode int
+
+const (
+	// OverflowBlock waits until there is room in the queue or the context is
+	// done, this is the default.
+	OverflowBlock OverflowMode = iota
+	// OverflowDropOldest makes room by evicting the oldest queued event.
+	OverflowDropOldest
+	// OverflowError fails with ErrQueueFull.
+	OverflowError
+)
+
+// AsyncPublisherConfig configures an AsyncPublisher.
+type AsyncPublisherConfig struct {
+	// QueueSize is the maximum number of queued events.
+	QueueSize int
+	// Concurrency is the number of requests published in parallel. With more
+	// than one, batches can be accepted by the shipper out of order.
+	Concurrency int
+	// Overflow selects the behavior when the queue is full.
+	Overflow OverflowMode
+	// MaxBatchEvents and MaxBatchBytes limit the size of the published
+	// requests, like in BatcherConfig.
+	MaxBatchEvents int
+	MaxBatchBytes  int
+	// UUID is set on every request, see messages.PublishRequest.
+	UUID string
+	// Pipeline, if set, processes the events in Publish, before they are
+	// queued. The events it drops are acked with ErrFiltered.
+	Pipeline processors.Processor
+	// Sequencer, if set, numbers the events in Publish, after the pipeline.
+	Sequencer *Sequencer
+	// LoadShedder, if set, rejects events and shrinks the queue under memory
+	// pressure.
+	LoadShedder *LoadShedder
+	// SlowConsumer, if set, is fed with the queued and accepted events.
+	SlowConsumer *SlowConsumerDetector
+	// RateLimiter, if set, delays the requests to bound the traffic.
+	RateLimiter *RateLimiter
+	// FlowControl, if set, adapts the rate of the requests to the pressure
+	// reported by the shipper.
+	FlowControl *FlowController
+	// RequeueUnaccepted puts the events the shipper didn't accept back at the
+	// front of the queue instead of acking them as not accepted. They are
+	// only requeued when the shipper accepted part of the batch, a shipper
+	// accepting nothing has a full queue and retrying right away would spin.
+	RequeueUnaccepted bool
+	// Spool, if set, persists the queued events until their outcome is
+	// known, the events left by a previous process are queued first. The
+	// events of a publish failing with a transient error, like Unavailable
+	// or ResourceExhausted, are retried, the other failures are acked with
+	// their error. The events that were not published when Close gives up
+	// stay in the spool. The publisher doesn't close the spool.
+	Spool *DiskSpool
+	// ReplayAck is called with the outcome of the events loaded from the
+	// spool, it may be nil.
+	ReplayAck AckFunc
+	// SpoolRetryInterval is the wait before requeuing spooled events whose
+	// publish failed with a transient error. Without a spool, these events
+	// are acked with the error.
+	SpoolRetryInterval time.Duration
+	// AckTracker, if set, follows the persisted index for the accepted
+	// events, so Shutdown waits until they are persisted. It must be fed
+	// with Run or Update.
+	AckTracker *AckTracker
+}
+
+// DefaultAsyncPublisherConfig returns the default configuration.
+func DefaultAsyncPublisherConfig() AsyncPublisherConfig {
+	batch := DefaultBatcherConfig()
+	return AsyncPublisherConfig{
+		QueueSize:          4096,
+		Concurrency:        1,
+		MaxBatchEvents:     batch.MaxEvents,
+		MaxBatchBytes:      batch.MaxBytes,
+		SpoolRetryInterval: time.Second,
+	}
+}
+
+type queuedEvent struct {
+	event    *messages.Event
+	onAck    AckFunc
+	size     int
+	enqueued time.Time
+	// segment of the spool holding the event, if spooled
+	segment uint64
+	spooled bool
+}
+
+// AsyncPublisher decouples producing events from publishing them: events are
+// queued by Publish and sent in batches by background workers.
+// It is safe for concurrent use.
+type AsyncPublisher struct {
+	client Client
+	config AsyncPublisherConfig
+
+	mu     sync.Mutex
+	queue  []queuedEvent
+	closed bool
+	// abandoned counts the events failed by Close giving up
+	abandoned int
+	// space is closed and replaced every time events leave the queue
+	space chan struct{}
+
+	// ready wakes up a worker when events are queued
+	ready chan struct{}
+	// ctx is canceled when Close gives up waiting for the queue to drain
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	persist *persistCounter
+}
+
+// NewAsyncPublisher returns an AsyncPublisher publishing through client and
+// starts its workers. Zero values in config are replaced by their defaults.
+// Close must be called to stop the workers.
+func NewAsyncPublisher(client Client, config AsyncPublisherConfig) *AsyncPublisher {
+	defaults := DefaultAsyncPublisherConfig()
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaults.Concurrency
+	}
+	if config.MaxBatchEvents <= 0 {
+		config.MaxBatchEvents = defaults.MaxBatchEvents
+	}
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = defaults.MaxBatchBytes
+	}
+	if config.SpoolRetryInterval <= 0 {
+		config.SpoolRetryInterval = defaults.SpoolRetryInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &AsyncPublisher{
+		client:  client,
+		config:  config,
+		space:   make(chan struct{}),
+		ready:   make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		persist: newPersistCounter(config.AckTracker),
+	}
+	if config.Spool != nil {
+		for _, replayed := range config.Spool.takeReplay() {
+			_ = p.pushLocked(queuedEvent{
+				event:   replayed.event,
+				onAck:   config.ReplayAck,
+				size:    eventSize(replayed.event),
+				segment: replayed.segment,
+				spooled: true,
+			})
+		}
+	}
+	p.wg.Add(config.Concurrency)
+	for i := 0; i < config.Concurrency; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// Publish queues the event, onAck may be nil and is called from a worker
+// once the outcome is known. When the queue is full, Publish blocks, evicts
+// the oldest event or fails according to the overflow mode.
+func (p *AsyncPublisher) Publish(ctx context.Context, e *messages.Event, onAck AckFunc) error {
+	e, err := process(p.config.Pipeline, e, onAck)
+	if err != nil || e == nil {
+		return err
+	}
+	if p.config.LoadShedder != nil && !p.config.LoadShedder.Admit(e) {
+		return ErrShed
+	}
+	if err := p.config.Sequencer.Stamp(e); err != nil {
+		return err
+	}
+	queued := queuedEvent{event: e, onAck: onAck, size: eventSize(e)}
+
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return ErrClosed
+		}
+		if len(p.queue) < p.limit() {
+			err := p.pushLocked(queued)
+			p.mu.Unlock()
+			return err
+		}
+
+		switch p.config.Overflow {
+		case OverflowError:
+			p.mu.Unlock()
+			return ErrQueueFull
+		case OverflowDropOldest:
+			if err := p.pushLocked(queued); err != nil {
+				p.mu.Unlock()
+				return err
+			}
+			dropped := p.queue[0]
+			p.queue[0] = queuedEvent{}
+			p.queue = p.queue[1:]
+			p.mu.Unlock()
+			p.discarded(1)
+			p.release([]queuedEvent{dropped})
+			if dropped.onAck != nil {
+				dropped.onAck(Ack{Err: ErrDropped})
+			}
+			return nil
+		}
+
+		space := p.space
+		p.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-space:
+		}
+	}
+}
+
+// limit is the current queue size, smaller under memory pressure.
+func (p *AsyncPublisher) limit() int {
+	if p.config.LoadShedder == nil {
+		return p.config.QueueSize
+	}
+	return p.config.LoadShedder.QueueLimit(p.config.QueueSize)
+}
+
+// pushLocked adds the event to the spool, unless it comes from it, and then
+// to the queue.
+func (p *AsyncPublisher) pushLocked(queued queuedEvent) error {
+	if p.config.Spool != nil && !queued.spooled {
+		segment, err := p.config.Spool.append(queued.event)
+		if err != nil {
+			return err
+		}
+		queued.segment, queued.spooled = segment, true
+	}
+	queued.enqueued = time.Now()
+	p.queue = append(p.queue, queued)
+	if p.config.SlowConsumer != nil {
+		p.config.SlowConsumer.Ingested(1)
+	}
+	p.wake()
+	return nil
+}
+
+// wake signals a worker without blocking, one pending signal is enough since
+// workers drain the queue before waiting again.
+func (p *AsyncPublisher) wake() {
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of queued events, not including the ones being
+// published.
+func (p *AsyncPublisher) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue)
+}
+
+// Close stops accepting events and waits until the queued events are
+// published or ctx is done. In that case the publishes in progress are
+// canceled and the remaining events are acked with ErrClosed.
+func (p *AsyncPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		// unblock the producers waiting for space
+		close(p.space)
+		p.space = make(chan struct{})
+	}
+	p.mu.Unlock()
+	// every worker exits once it finds the queue empty
+	for i := 0; i < p.config.Concurrency; i++ {
+		p.wake()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Shutdown closes the publisher like Close, then waits until the shipper
+// persists the accepted events, if the AckTracker is set, or ctx is done.
+// The report counts the events whose delivery is not guaranteed.
+func (p *AsyncPublisher) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	err := p.Close(ctx)
+	var report ShutdownReport
+	p.mu.Lock()
+	report.Abandoned = p.abandoned
+	p.mu.Unlock()
+	unpersisted, waitErr := p.persist.wait(ctx)
+	report.Unpersisted = unpersisted
+	if err == nil {
+		err = waitErr
+	}
+	return report, err
+}
+
+func (p *AsyncPublisher) worker() {
+	defer p.wg.Done()
+	for {
+		batch, ok := p.take()
+		if !ok {
+			return
+		}
+		if len(batch) == 0 {
+			<-p.ready
+			continue
+		}
+		p.publish(batch)
+	}
+}
+
+// take removes the next batch from the queue. It returns false once the
+// publisher is closed and the queue is empty.
+func (p *AsyncPublisher) take() ([]queuedEvent, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queue) == 0 {
+		if p.closed {
+			// let the next worker see it's closed too
+			p.wake()
+			return nil, false
+		}
+		return nil, true
+	}
+
+	n, size := 0, 0
+	for n < len(p.queue) && n < p.config.MaxBatchEvents {
+		if n > 0 && size+p.queue[n].size > p.config.MaxBatchBytes {
+			break
+		}
+		size += p.queue[n].size
+		n++
+	}
+	batch := make([]queuedEvent, n)
+	copy(batch, p.queue)
+	for i := 0; i < n; i++ {
+		p.queue[i] = queuedEvent{}
+	}
+	p.queue = p.queue[n:]
+	if len(p.queue) == 0 {
+		// release the backing array instead of growing it forever
+		p.queue = nil
+	} else {
+		// more work for the other workers
+		p.wake()
+	}
+
+	close(p.space)
+	p.space = make(chan struct{})
+	return batch, true
+}
+
+func (p *AsyncPublisher) publish(batch []queuedEvent) {
+	if p.ctx.Err() != nil {
+		p.fail(batch, ErrClosed)
+		return
+	}
+
+	events := make([]*messages.Event, len(batch))
+	size := 0
+	for i, queued := range batch {
+		events[i] = queued.event
+		size += queued.size
+	}
+	if err := p.config.RateLimiter.Wait(p.ctx, len(events), size); err != nil {
+		p.fail(batch, ErrClosed)
+		return
+	}
+	if err := p.config.FlowControl.Wait(p.ctx, len(events)); err != nil {
+		p.fail(batch, ErrClosed)
+		return
+	}
+	reply, err := p.config.FlowControl.publish(p.ctx, p.client, &messages.PublishRequest{
+		Uuid:   p.config.UUID,
+		Events: events,
+	})
+	if err != nil {
+		if p.config.Spool != nil && (transient(err) || p.ctx.Err() != nil) {
+			// the events stay in the spool until they can be sent again
+			p.retry(batch)
+			return
+		}
+		// sending them again would fail the same way
+		p.release(batch)
+		p.fail(batch, err)
+		return
+	}
+	accepted := int(reply.GetAcceptedCount())
+	p.persist.accepted(reply.GetUuid(), reply.GetAcceptedIndex(), accepted)
+	if d := p.config.SlowConsumer; d != nil && accepted > 0 {
+		d.Drained(accepted, time.Since(batch[0].enqueued))
+	}
+	if p.config.RequeueUnaccepted && accepted > 0 && accepted < len(batch) {
+		p.requeue(batch[accepted:])
+		batch = batch[:accepted]
+	} else if accepted < len(batch) {
+		p.discarded(len(batch) - accepted)
+	}
+
+	p.release(batch)
+	acks := make([]AckFunc, len(batch))
+	for i, queued := range batch {
+		acks[i] = queued.onAck
+	}
+	notifyAcks(reply, acks)
+}
+
+// transient returns true if a publish failing with err may succeed when
+// sent again later.
+func transient(err error) bool {
+	if errors.Is(err, helpers.ErrTooLarge) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// release removes from the spool the events whose outcome is known.
+func (p *AsyncPublisher) release(events []queuedEvent) {
+	for _, queued := range events {
+		if queued.spooled {
+			p.config.Spool.ack(queued.segment)
+		}
+	}
+}
+
+// retry requeues the spooled events of a failed publish after a while. If
+// Close gives up first, they are acked with ErrClosed and stay in the spool.
+func (p *AsyncPublisher) retry(events []queuedEvent) {
+	timer := time.NewTimer(p.config.SpoolRetryInterval)
+	defer timer.Stop()
+	select {
+	case <-p.ctx.Done():
+		p.fail(events, ErrClosed)
+	case <-timer.C:
+		p.requeue(events)
+	}
+}
+
+// requeue puts events back at the front of the queue, even if it exceeds the
+// queue size, since they were already admitted.
+func (p *AsyncPublisher) requeue(events []queuedEvent) {
+	if p.ctx.Err() != nil {
+		p.fail(events, ErrClosed)
+		return
+	}
+	p.mu.Lock()
+	queue := make([]queuedEvent, 0, len(events)+len(p.queue))
+	queue = append(queue, events...)
+	p.queue = append(queue, p.queue...)
+	p.wake()
+	p.mu.Unlock()
+}
+
+// discarded removes from the slow consumer backlog the events leaving the
+// queue without being accepted.
+func (p *AsyncPublisher) discarded(n int) {
+	if p.config.SlowConsumer != nil {
+		p.config.SlowConsumer.Discarded(n)
+	}
+}
+
+// fail acks the events with err, counting them as abandoned if Close gave
+// up.
+func (p *AsyncPublisher) fail(batch []queuedEvent, err error) {
+	p.discarded(len(batch))
+	if p.ctx.Err() != nil {
+		p.mu.Lock()
+		p.abandoned += len(batch)
+		p.mu.Unlock()
+	}
+	notifyError(batch, err)
+}
+
+func notifyError(batch []queuedEvent, err error) {
+	for _, queued := range batch {
+		if queued.onAck != nil {
+			queued.onAck(Ack{Err: err})
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/processors"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+// blockingClient accepts every event, but each Publish blocks until release
+// is closed or the context is done.
+type blockingClient struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu       sync.Mutex
+	requests []*messages.PublishRequest
+}
+
+func newBlockingClient() *blockingClient {
+	return &blockingClient{started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (c *blockingClient) Publish(ctx context.Context, req *messages.PublishRequest, _ ...grpc.CallOption) (*messages.PublishReply, error) {
+	c.started <- struct{}{}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.release:
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req)
+	return &messages.PublishReply{AcceptedCount: uint32(len(req.Events)), AcceptedIndex: uint64(len(req.Events))}, nil
+}
+
+func TestAsyncPublisher(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{Concurrency: 2, MaxBatchEvents: 4})
+
+	recorder := &ackRecorder{}
+	for i := 0; i < 20; i++ {
+		require.NoError(t, p.Publish(context.Background(), testEvent(fmt.Sprint(i)), recorder.onAck))
+	}
+	require.NoError(t, p.Close(context.Background()))
+	require.Zero(t, p.Len())
+
+	acks := recorder.get()
+	require.Len(t, acks, 20)
+	for _, ack := range acks {
+		require.True(t, ack.Accepted)
+		require.NoError(t, ack.Err)
+	}
+	require.Len(t, srv.Events(), 20)
+	for _, req := range srv.Requests() {
+		require.LessOrEqual(t, len(req.Events), 4)
+	}
+
+	err := p.Publish(context.Background(), testEvent("late"), nil)
+	require.ErrorIs(t, err, ErrClosed)
+	require.ErrorIs(t, err, helpers.ErrShutdown)
+}
+
+// fillQueue blocks the single worker on a first event and fills the queue
+// of size 2 behind it.
+func fillQueue(t *testing.T, overflow OverflowMode) (*AsyncPublisher, *blockingClient, *ackRecorder) {
+	client := newBlockingClient()
+	p := NewAsyncPublisher(client, AsyncPublisherConfig{QueueSize: 2, Overflow: overflow})
+	t.Cleanup(func() {
+		close(client.release)
+		_ = p.Close(context.Background())
+	})
+
+	recorder := &ackRecorder{}
+	require.NoError(t, p.Publish(context.Background(), testEvent("in flight"), recorder.onAck))
+	<-client.started
+	require.NoError(t, p.Publish(context.Background(), testEvent("oldest"), recorder.onAck))
+	require.NoError(t, p.Publish(context.Background(), testEvent("newest"), recorder.onAck))
+	require.Equal(t, 2, p.Len())
+	return p, client, recorder
+}
+
+func TestAsyncPublisherOverflow(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		p, _, _ := fillQueue(t, OverflowError)
+		err := p.Publish(context.Background(), testEvent("rejected"), nil)
+		require.ErrorIs(t, err, ErrQueueFull)
+		require.ErrorIs(t, err, helpers.ErrQueueFull)
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		p, _, recorder := fillQueue(t, OverflowDropOldest)
+		require.NoError(t, p.Publish(context.Background(), testEvent("queued"), nil))
+		require.Equal(t, 2, p.Len())
+		require.Equal(t, []Ack{{Err: ErrDropped}}, recorder.get())
+	})
+
+	t.Run("block", func(t *testing.T) {
+		p, client, _ := fillQueue(t, OverflowBlock)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, p.Publish(ctx, testEvent("timed out"), nil), context.DeadlineExceeded)
+
+		published := make(chan error)
+		go func() {
+			published <- p.Publish(context.Background(), testEvent("waits"), nil)
+		}()
+		select {
+		case err := <-published:
+			t.Fatalf("publish returned before there was room: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		client.release <- struct{}{}
+		require.NoError(t, <-published)
+	})
+}
+
+func TestAsyncPublisherCloseTimeout(t *testing.T) {
+	client := newBlockingClient()
+	p := NewAsyncPublisher(client, AsyncPublisherConfig{MaxBatchEvents: 1})
+	recorder := &ackRecorder{}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Publish(context.Background(), testEvent(fmt.Sprint(i)), recorder.onAck))
+	}
+	<-client.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Close(ctx), context.DeadlineExceeded)
+
+	acks := recorder.get()
+	require.Len(t, acks, 3)
+	require.ErrorIs(t, acks[0].Err, context.Canceled, "the publish in progress is canceled")
+	require.ErrorIs(t, acks[1].Err, ErrClosed)
+	require.ErrorIs(t, acks[2].Err, ErrClosed)
+}
+
+func TestAsyncPublisherLoadShedding(t *testing.T) {
+	_, c := newTestServer(t, servertest.Options{})
+	pressure := 0.0
+	shedder, err := NewLoadShedder(LoadShedderConfig{
+		Limiter: MemoryLimiterFunc(func() float64 { return pressure }),
+	})
+	require.NoError(t, err)
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{LoadShedder: shedder})
+
+	require.NoError(t, p.Publish(context.Background(), testEvent("admitted"), nil))
+	pressure = 1
+	require.ErrorIs(t, p.Publish(context.Background(), testEvent("shed"), nil), ErrShed)
+	require.EqualValues(t, 1, shedder.Shed())
+	require.NoError(t, p.Close(context.Background()))
+}
+
+func TestAsyncPublisherSlowConsumer(t *testing.T) {
+	_, c := newTestServer(t, servertest.Options{})
+	detector := NewSlowConsumerDetector(SlowConsumerConfig{})
+	start := time.Now()
+	detector.Sample(start)
+
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{SlowConsumer: detector})
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.Publish(context.Background(), testEvent(fmt.Sprint(i)), nil))
+	}
+	require.NoError(t, p.Close(context.Background()))
+
+	detector.Sample(start.Add(time.Second))
+	stats := detector.Stats()
+	require.Equal(t, 5.0, stats.IngestRate)
+	require.Equal(t, 5.0, stats.DrainRate)
+	require.Positive(t, stats.AckLatency)
+}
+
+func TestAsyncPublisherSlowConsumerFailures(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	var slow int
+	detector := NewSlowConsumerDetector(SlowConsumerConfig{
+		Threshold: time.Second,
+		OnSlow:    func(SlowConsumerStats) { slow++ },
+	})
+	start := time.Now()
+	detector.Sample(start)
+
+	srv.SetPublishErrors(errors.New("shipper failed"))
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{SlowConsumer: detector})
+	require.NoError(t, p.Publish(context.Background(), testEvent("failed"), nil))
+	require.NoError(t, p.Close(context.Background()))
+	require.Len(t, srv.Requests(), 1)
+
+	// nothing is queued, the idle publisher isn't a slow consumer
+	for i := 1; i <= 3; i++ {
+		detector.Sample(start.Add(time.Duration(i) * time.Second))
+	}
+	require.Zero(t, slow)
+	require.Zero(t, detector.Stats().Backlog)
+}
+
+func TestAsyncPublisherPipeline(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	addFields, err := processors.NewAddFields(map[string]interface{}{"env": "test"}, false)
+	require.NoError(t, err)
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{Pipeline: processors.NewPipeline(addFields)})
+
+	require.NoError(t, p.Publish(context.Background(), testEvent("first"), nil))
+	require.NoError(t, p.Close(context.Background()))
+	events := srv.Events()
+	require.Len(t, events, 1)
+	require.Equal(t, "test", events[0].Fields.Data["env"].GetStringValue())
+}
@@ -0,0 +1,346 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/processors"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+var (
+	// ErrClosed is returned when events are added to a closed publisher. It
+	// matches helpers.ErrShutdown.
+	ErrClosed = newKindError("publisher is closed", helpers.ErrShutdown)
+	// ErrFiltered is reported to the ack of the events dropped by the
+	// pipeline.
+	ErrFiltered = errors.New("event dropped by the pipeline")
+)
+
+// Client publishes requests to the shipper, it's implemented by client.Client.
+type Client interface {
+	Publish(ctx context.Context, req *messages.PublishRequest, opts ...grpc.CallOption) (*messages.PublishReply, error)
+}
+
+// Ack is the outcome of publishing a single event.
+type Ack struct {
+	// Accepted is true when the shipper accepted the event into its queue.
+	Accepted bool
+	// Index is the shipper queue index of an accepted event. The event is
+	// persisted once the persisted index reaches this value.
+	Index uint64
+	// UUID identifies the shipper process that replied.
+	UUID string
+	// Err is set when the publish request failed.
+	Err error
+}
+
+// AckFunc is called once the outcome of publishing an event is known.
+type AckFunc func(Ack)
+
+// BatcherConfig configures a Batcher.
+type BatcherConfig struct {
+	// MaxEvents flushes the batch once it holds this many events.
+	MaxEvents int
+	// MaxBytes flushes the batch before its marshaled size would exceed this
+	// value. A single event larger than MaxBytes is sent on its own.
+	MaxBytes int
+	// FlushInterval flushes pending events periodically, zero disables it.
+	FlushInterval time.Duration
+	// UUID is set on every request, see messages.PublishRequest.
+	UUID string
+	// RateLimiter, if set, delays the requests to bound the traffic.
+	RateLimiter *RateLimiter
+	// FlowControl, if set, adapts the rate of the requests to the pressure
+	// reported by the shipper.
+	FlowControl *FlowController
+	// Pipeline, if set, processes the events in Add. The events it drops
+	// are acked with ErrFiltered.
+	Pipeline processors.Processor
+	// Sequencer, if set, numbers the events in Add, after the pipeline.
+	Sequencer *Sequencer
+	// Clock drives the flush timer, defaults to clock.Real.
+	Clock clock.Clock
+	// AckTracker, if set, follows the persisted index for the accepted
+	// events, so Shutdown waits until they are persisted. It must be fed
+	// with Run or Update.
+	AckTracker *AckTracker
+}
+
+// DefaultBatcherConfig returns the default batching configuration.
+func DefaultBatcherConfig() BatcherConfig {
+	return BatcherConfig{
+		MaxEvents:     1024,
+		MaxBytes:      4 << 20, // default max gRPC message size
+		FlushInterval: time.Second,
+		Clock:         clock.Real,
+	}
+}
+
+type batch struct {
+	events []*messages.Event
+	acks   []AckFunc
+	size   int
+}
+
+// process runs the pipeline, if any, on e. It returns nil when the event is
+// dropped, after acking it.
+func process(pipeline processors.Processor, e *messages.Event, onAck AckFunc) (*messages.Event, error) {
+	if pipeline == nil {
+		return e, nil
+	}
+	e, err := pipeline.Process(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process event: %w", err)
+	}
+	if e == nil && onAck != nil {
+		onAck(Ack{Err: ErrFiltered})
+	}
+	return e, nil
+}
+
+// Batcher accumulates events and publishes them in batches.
+// It is safe for concurrent use.
+type Batcher struct {
+	client Client
+	config BatcherConfig
+
+	mu      sync.Mutex
+	pending batch
+	closed  bool
+	// abandoned counts the events whose publish failed after Close
+	abandoned int
+
+	// flushMu serializes publishing, so batches are sent in order
+	flushMu sync.Mutex
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	// ctx is canceled to stop a periodic flush when Close gives up
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	persist *persistCounter
+}
+
+// NewBatcher returns a Batcher publishing through client. Zero values in
+// config are replaced by their defaults. Close must be called to release
+// the flush timer.
+func NewBatcher(client Client, config BatcherConfig) *Batcher {
+	defaults := DefaultBatcherConfig()
+	if config.MaxEvents <= 0 {
+		config.MaxEvents = defaults.MaxEvents
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaults.MaxBytes
+	}
+	if config.Clock == nil {
+		config.Clock = defaults.Clock
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Batcher{
+		client:  client,
+		config:  config,
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		persist: newPersistCounter(config.AckTracker),
+	}
+	if config.FlushInterval > 0 {
+		// created here so a fake clock can fire it as soon as NewBatcher returns
+		ticker := config.Clock.NewTicker(config.FlushInterval)
+		b.wg.Add(1)
+		go b.flushLoop(ticker)
+	}
+	return b
+}
+
+func (b *Batcher) flushLoop(ticker clock.Ticker) {
+	defer b.wg.Done()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C():
+			_ = b.Flush(b.ctx)
+		}
+	}
+}
+
+// eventSize is the size an event adds to a marshaled PublishRequest.
+func eventSize(e *messages.Event) int {
+	return protowire.SizeTag(2) + protowire.SizeBytes(proto.Size(e))
+}
+
+// Add queues the event for publishing, onAck may be nil. If the event fills
+// the batch, the batch is published before Add returns.
+func (b *Batcher) Add(ctx context.Context, e *messages.Event, onAck AckFunc) error {
+	e, err := process(b.config.Pipeline, e, onAck)
+	if err != nil || e == nil {
+		return err
+	}
+	if err := b.config.Sequencer.Stamp(e); err != nil {
+		return err
+	}
+	size := eventSize(e)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	var full []batch
+	if len(b.pending.events) > 0 && b.pending.size+size > b.config.MaxBytes {
+		full = append(full, b.takeLocked())
+	}
+	b.pending.events = append(b.pending.events, e)
+	b.pending.acks = append(b.pending.acks, onAck)
+	b.pending.size += size
+
+	// also after a flush: the event alone can reach a limit
+	if len(b.pending.events) >= b.config.MaxEvents || b.pending.size >= b.config.MaxBytes {
+		full = append(full, b.takeLocked())
+	}
+	if len(full) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.flushMu.Lock()
+	b.mu.Unlock()
+	defer b.flushMu.Unlock()
+	for _, pending := range full {
+		// every batch is published, so all the events are acked
+		if publishErr := b.publish(ctx, pending); err == nil {
+			err = publishErr
+		}
+	}
+	return err
+}
+
+// Flush publishes the pending events.
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	pending := b.takeLocked()
+	b.flushMu.Lock()
+	b.mu.Unlock()
+	defer b.flushMu.Unlock()
+
+	if len(pending.events) == 0 {
+		return nil
+	}
+	return b.publish(ctx, pending)
+}
+
+// Close flushes the pending events and stops the flush timer. A periodic
+// flush in progress is canceled when ctx is done.
+func (b *Batcher) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+	defer b.cancel()
+
+	close(b.done)
+	stopped := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		b.cancel()
+		<-stopped
+	}
+	return b.Flush(ctx)
+}
+
+// Shutdown closes the batcher like Close, then waits until the shipper
+// persists the accepted events, if the AckTracker is set, or ctx is done.
+// The report counts the events whose delivery is not guaranteed.
+func (b *Batcher) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	err := b.Close(ctx)
+	var report ShutdownReport
+	b.mu.Lock()
+	report.Abandoned = b.abandoned
+	b.mu.Unlock()
+	unpersisted, waitErr := b.persist.wait(ctx)
+	report.Unpersisted = unpersisted
+	if err == nil {
+		err = waitErr
+	}
+	return report, err
+}
+
+func (b *Batcher) takeLocked() batch {
+	taken := b.pending
+	b.pending = batch{}
+	return taken
+}
+
+func (b *Batcher) publish(ctx context.Context, pending batch) error {
+	err := b.config.RateLimiter.Wait(ctx, len(pending.events), pending.size)
+	if err == nil {
+		err = b.config.FlowControl.Wait(ctx, len(pending.events))
+	}
+	var reply *messages.PublishReply
+	if err == nil {
+		reply, err = b.config.FlowControl.publish(ctx, b.client, &messages.PublishRequest{
+			Uuid:   b.config.UUID,
+			Events: pending.events,
+		})
+	}
+	if err != nil {
+		b.mu.Lock()
+		if b.closed {
+			b.abandoned += len(pending.events)
+		}
+		b.mu.Unlock()
+		for _, onAck := range pending.acks {
+			if onAck != nil {
+				onAck(Ack{Err: err})
+			}
+		}
+		return err
+	}
+
+	b.persist.accepted(reply.GetUuid(), reply.GetAcceptedIndex(), int(reply.GetAcceptedCount()))
+	notifyAcks(reply, pending.acks)
+	return nil
+}
+
+// notifyAcks reports the outcome of each event of a request. The shipper
+// accepts the first AcceptedCount events, and AcceptedIndex is the index
+// of the last accepted one.
+func notifyAcks(reply *messages.PublishReply, acks []AckFunc) {
+	accepted := int(reply.GetAcceptedCount())
+	for i, onAck := range acks {
+		if onAck == nil {
+			continue
+		}
+		ack := Ack{UUID: reply.GetUuid()}
+		if i < accepted {
+			ack.Accepted = true
+			ack.Index = acceptedIndex(reply.GetAcceptedIndex(), accepted, i)
+		}
+		onAck(ack)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/clock"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/processors"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func newTestServer(t *testing.T, opts servertest.Options) (*servertest.Server, *client.Client) {
+	srv := servertest.New(opts)
+	srv.Start()
+	t.Cleanup(srv.Stop)
+
+	c, err := client.New(context.Background(), servertest.Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: []grpc.DialOption{srv.DialOption()},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return srv, c
+}
+
+func testEvent(message string) *messages.Event {
+	return &messages.Event{
+		Source: &messages.Source{InputId: "test"},
+		Fields: &messages.Struct{Data: map[string]*messages.Value{
+			"message": helpers.NewStringValue(message),
+		}},
+	}
+}
+
+type ackRecorder struct {
+	mu   sync.Mutex
+	acks []Ack
+}
+
+func (r *ackRecorder) onAck(ack Ack) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.acks = append(r.acks, ack)
+}
+
+func (r *ackRecorder) get() []Ack {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Ack(nil), r.acks...)
+}
+
+func TestBatcherFlushTriggers(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   BatcherConfig
+		events   int
+		requests int
+	}{
+		{
+			name:     "max events",
+			config:   BatcherConfig{MaxEvents: 3},
+			events:   7,
+			requests: 2,
+		},
+		{
+			name:     "max bytes",
+			config:   BatcherConfig{MaxBytes: 2 * eventSize(testEvent(strings.Repeat("a", 100)))},
+			events:   5,
+			requests: 2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv, client := newTestServer(t, servertest.Options{})
+			batcher := NewBatcher(client, c.config)
+			defer batcher.Close(context.Background())
+
+			for i := 0; i < c.events; i++ {
+				require.NoError(t, batcher.Add(context.Background(), testEvent(strings.Repeat("a", 100)), nil))
+			}
+			require.Len(t, srv.Requests(), c.requests)
+
+			require.NoError(t, batcher.Close(context.Background()))
+			require.Len(t, srv.Events(), c.events)
+		})
+	}
+}
+
+func TestBatcherOversizedEvent(t *testing.T) {
+	srv, client := newTestServer(t, servertest.Options{})
+	small, large := testEvent("a"), testEvent(strings.Repeat("a", 100))
+	batcher := NewBatcher(client, BatcherConfig{MaxEvents: 10, MaxBytes: 2 * eventSize(small)})
+	defer batcher.Close(context.Background())
+
+	require.NoError(t, batcher.Add(context.Background(), small, nil))
+	require.NoError(t, batcher.Add(context.Background(), large, nil))
+	// the large event is sent on its own right after the small one
+	require.Len(t, srv.Requests(), 2)
+	require.Len(t, srv.Events(), 2)
+}
+
+func TestBatcherCloseCancelsFlush(t *testing.T) {
+	client := newBlockingClient()
+	batcher := NewBatcher(client, BatcherConfig{FlushInterval: time.Millisecond})
+
+	var recorder ackRecorder
+	require.NoError(t, batcher.Add(context.Background(), testEvent("test"), recorder.onAck))
+	<-client.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.NoError(t, batcher.Close(ctx))
+	acks := recorder.get()
+	require.Len(t, acks, 1)
+	require.ErrorIs(t, acks[0].Err, context.Canceled)
+}
+
+func TestBatcherFlushInterval(t *testing.T) {
+	srv, client := newTestServer(t, servertest.Options{})
+	batcher := NewBatcher(client, BatcherConfig{FlushInterval: 10 * time.Millisecond})
+	defer batcher.Close(context.Background())
+
+	require.NoError(t, batcher.Add(context.Background(), testEvent("test"), nil))
+	require.Eventually(t, func() bool {
+		return len(srv.Events()) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBatcherFlushIntervalFakeClock(t *testing.T) {
+	srv, client := newTestServer(t, servertest.Options{})
+	fake := clock.NewFake(time.Now())
+	batcher := NewBatcher(client, BatcherConfig{FlushInterval: time.Minute, Clock: fake})
+
+	require.NoError(t, batcher.Add(context.Background(), testEvent("test"), nil))
+	fake.Advance(30 * time.Second)
+	time.Sleep(10 * time.Millisecond)
+	require.Empty(t, srv.Events())
+
+	fake.Advance(30 * time.Second)
+	require.Eventually(t, func() bool {
+		return len(srv.Events()) == 1
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, batcher.Close(context.Background()))
+	require.Zero(t, fake.Tickers(), "the ticker is stopped")
+}
+
+func TestBatcherAcks(t *testing.T) {
+	srv, client := newTestServer(t, servertest.Options{UUID: "shipper"})
+	srv.SetAcceptLimit(2)
+	batcher := NewBatcher(client, BatcherConfig{MaxEvents: 3})
+	defer batcher.Close(context.Background())
+
+	var recorder ackRecorder
+	for i := 0; i < 3; i++ {
+		require.NoError(t, batcher.Add(context.Background(), testEvent("test"), recorder.onAck))
+	}
+	require.Equal(t, []Ack{
+		{Accepted: true, Index: 1, UUID: "shipper"},
+		{Accepted: true, Index: 2, UUID: "shipper"},
+		{UUID: "shipper"},
+	}, recorder.get())
+
+	srv.SetPublishErrors(status.Error(codes.Internal, "broken"))
+	require.NoError(t, batcher.Add(context.Background(), testEvent("test"), recorder.onAck))
+	require.Error(t, batcher.Flush(context.Background()))
+	acks := recorder.get()
+	require.Len(t, acks, 4)
+	require.Equal(t, codes.Internal, status.Code(acks[3].Err))
+}
+
+func TestBatcherClosed(t *testing.T) {
+	_, client := newTestServer(t, servertest.Options{})
+	batcher := NewBatcher(client, BatcherConfig{})
+	require.NoError(t, batcher.Close(context.Background()))
+	require.ErrorIs(t, batcher.Add(context.Background(), testEvent("test"), nil), ErrClosed)
+}
+
+func TestBatcherPipeline(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	pipeline := processors.NewPipeline(
+		processors.Func(func(e *messages.Event) (*messages.Event, error) {
+			if e.GetFields().GetData()["message"].GetStringValue() == "drop" {
+				return nil, nil
+			}
+			return e, nil
+		}),
+		processors.NewDropFields(false, "message"),
+	)
+	b := NewBatcher(c, BatcherConfig{Pipeline: pipeline})
+	defer b.Close(context.Background())
+
+	recorder := &ackRecorder{}
+	require.NoError(t, b.Add(context.Background(), testEvent("keep"), recorder.onAck))
+	require.NoError(t, b.Add(context.Background(), testEvent("drop"), recorder.onAck))
+	err := b.Add(context.Background(), &messages.Event{}, recorder.onAck)
+	require.ErrorIs(t, err, helpers.ErrKeyNotFound)
+	require.NoError(t, b.Flush(context.Background()))
+
+	acks := recorder.get()
+	require.Len(t, acks, 2)
+	require.ErrorIs(t, acks[0].Err, ErrFiltered)
+	require.True(t, acks[1].Accepted)
+	events := srv.Events()
+	require.Len(t, events, 1)
+	require.Empty(t, events[0].Fields.GetData())
+}
@@ -0,0 +1,256 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// CheckpointStore keeps the index of the last event of every source known
+// to be persisted by the shipper, so a producer resuming after a restart
+// knows where to start from. The indexes are numbered by the producer, like
+// file offsets or sequence numbers. It must be safe for concurrent use.
+type CheckpointStore interface {
+	// Load returns the checkpoint of source, ok is false if it has none.
+	Load(source string) (index uint64, ok bool, err error)
+	// Save sets the checkpoint of source.
+	Save(source string, index uint64) error
+}
+
+// SourceKey identifies the source of an event in a CheckpointStore, from
+// its input and stream IDs.
+func SourceKey(e *messages.Event) string {
+	return e.GetSource().GetInputId() + "/" + e.GetSource().GetStreamId()
+}
+
+// FileCheckpointStore is a CheckpointStore in a JSON file. Every Save
+// replaces the file atomically and syncs it to stable storage, so a crash
+// leaves either the previous or the new checkpoints.
+type FileCheckpointStore struct {
+	path string
+
+	mu          sync.Mutex
+	checkpoints map[string]uint64
+}
+
+// OpenFileCheckpointStore loads the checkpoints in the file at path, which
+// is created by the first Save if it doesn't exist.
+func OpenFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	s := &FileCheckpointStore{path: path, checkpoints: map[string]uint64{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.checkpoints); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoints in %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Load implements CheckpointStore.
+func (s *FileCheckpointStore) Load(source string) (uint64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, ok := s.checkpoints[source]
+	return index, ok, nil
+}
+
+// Checkpoints returns a copy of all the checkpoints.
+func (s *FileCheckpointStore) Checkpoints() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	checkpoints := make(map[string]uint64, len(s.checkpoints))
+	for source, index := range s.checkpoints {
+		checkpoints[source] = index
+	}
+	return checkpoints
+}
+
+// Save implements CheckpointStore. The checkpoint is kept in memory even if
+// writing the file fails, the next Save writes it again.
+func (s *FileCheckpointStore) Save(source string, index uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[source] = index
+	data, err := json.Marshal(s.checkpoints)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic replaces the file at path by a synced temporary file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync checkpoints: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace checkpoints: %w", err)
+	}
+	return nil
+}
+
+// Checkpointer saves the checkpoints of the events once an AckTracker
+// reports them persisted. The checkpoint of a source is the highest index
+// below its lowest event not persisted yet: the events can be persisted out
+// of order, with concurrent requests, but a producer resuming from the
+// checkpoint never skips an event that wasn't persisted.
+type Checkpointer struct {
+	store   CheckpointStore
+	tracker *AckTracker
+
+	mu      sync.Mutex
+	sources map[string]*sourceProgress
+	err     error
+}
+
+// sourceProgress holds the events of a source not covered by its
+// checkpoint yet.
+type sourceProgress struct {
+	// outstanding are the indexes of the events, sorted
+	outstanding []uint64
+	// done are the outstanding indexes persisted, or filtered out
+	done map[uint64]struct{}
+}
+
+// NewCheckpointer returns a Checkpointer saving into store the events
+// persisted according to tracker, which must be fed with Run or Update.
+func NewCheckpointer(store CheckpointStore, tracker *AckTracker) *Checkpointer {
+	return &Checkpointer{store: store, tracker: tracker, sources: map[string]*sourceProgress{}}
+}
+
+// AckFunc returns the ack of an event of source at index, to pass to
+// Publish or Add. The event is outstanding from this call until it is
+// persisted, or dropped by the pipeline, and the checkpoint of source
+// doesn't move past it meanwhile. An event that fails or isn't accepted
+// stays outstanding: it must be published again with a new AckFunc for the
+// same index. next, if not nil, is called with the ack as usual.
+func (c *Checkpointer) AckFunc(source string, index uint64, next AckFunc) AckFunc {
+	c.track(source, index)
+	return func(ack Ack) {
+		switch {
+		case ack.Accepted:
+			c.tracker.OnPersisted(ack.UUID, ack.Index, func(err error) {
+				if err == nil {
+					c.done(source, index)
+				}
+			})
+		case errors.Is(ack.Err, ErrFiltered):
+			// nothing to persist
+			c.done(source, index)
+		}
+		if next != nil {
+			next(ack)
+		}
+	}
+}
+
+func (c *Checkpointer) track(source string, index uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.sources[source]
+	if !ok {
+		p = &sourceProgress{done: map[uint64]struct{}{}}
+		c.sources[source] = p
+	}
+	n := len(p.outstanding)
+	if n == 0 || p.outstanding[n-1] < index {
+		p.outstanding = append(p.outstanding, index)
+		return
+	}
+	i, found := p.search(index)
+	if found {
+		// published again
+		return
+	}
+	p.outstanding = append(p.outstanding, 0)
+	copy(p.outstanding[i+1:], p.outstanding[i:])
+	p.outstanding[i] = index
+}
+
+// search returns the position of index in the outstanding indexes, or
+// where to insert it.
+func (p *sourceProgress) search(index uint64) (int, bool) {
+	i := sort.Search(len(p.outstanding), func(i int) bool { return p.outstanding[i] >= index })
+	return i, i < len(p.outstanding) && p.outstanding[i] == index
+}
+
+// done marks an event as persisted and saves the checkpoint of source if
+// it was the lowest outstanding one.
+func (c *Checkpointer) done(source string, index uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.sources[source]
+	if !ok {
+		return
+	}
+	if _, found := p.search(index); !found {
+		// an event published twice, already done
+		return
+	}
+	p.done[index] = struct{}{}
+	var checkpoint uint64
+	advanced := false
+	for len(p.outstanding) > 0 {
+		if _, ok := p.done[p.outstanding[0]]; !ok {
+			break
+		}
+		checkpoint = p.outstanding[0]
+		advanced = true
+		delete(p.done, checkpoint)
+		p.outstanding = p.outstanding[1:]
+	}
+	if !advanced {
+		return
+	}
+	if len(p.outstanding) == 0 {
+		delete(c.sources, source)
+	}
+	c.saveLocked(source, checkpoint)
+}
+
+func (c *Checkpointer) saveLocked(source string, index uint64) {
+	current, ok, err := c.store.Load(source)
+	if err == nil && ok && current >= index {
+		return
+	}
+	if err == nil {
+		err = c.store.Save(source, index)
+	}
+	if err != nil {
+		c.err = fmt.Errorf("failed to save checkpoint of %s: %w", source, err)
+	}
+}
+
+// Err returns the last error saving a checkpoint, if any.
+func (c *Checkpointer) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
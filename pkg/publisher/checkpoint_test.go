@@ -0,0 +1,128 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	store, err := OpenFileCheckpointStore(path)
+	require.NoError(t, err)
+
+	_, ok, err := store.Load("input/stream")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, store.Save("input/stream", 10))
+	require.NoError(t, store.Save("other/", 3))
+	require.NoError(t, store.Save("input/stream", 12))
+
+	store, err = OpenFileCheckpointStore(path)
+	require.NoError(t, err)
+	index, ok, err := store.Load("input/stream")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(12), index)
+	require.Equal(t, map[string]uint64{"input/stream": 12, "other/": 3}, store.Checkpoints())
+
+	// no temporary file is left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = OpenFileCheckpointStore(path)
+	require.Error(t, err)
+}
+
+func TestCheckpointer(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	store, err := OpenFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	require.NoError(t, err)
+	tracker := runTracker(t, c)
+	checkpointer := NewCheckpointer(store, tracker)
+
+	b := NewBatcher(c, BatcherConfig{})
+	defer b.Close(context.Background())
+	acks := make(chan Ack, 3)
+	for i := uint64(1); i <= 3; i++ {
+		e := testEvent("line")
+		e.Source = &messages.Source{InputId: "file", StreamId: "app.log"}
+		require.NoError(t, b.Add(context.Background(), e, checkpointer.AckFunc(SourceKey(e), i*100, func(ack Ack) { acks <- ack })))
+	}
+	require.NoError(t, b.Flush(context.Background()))
+	<-acks
+	second := <-acks
+	<-acks
+
+	_, ok, _ := store.Load("file/app.log")
+	require.False(t, ok, "nothing is persisted yet")
+
+	require.NoError(t, srv.Persist(second.Index))
+	require.Eventually(t, func() bool {
+		index, _, _ := store.Load("file/app.log")
+		return index == 200
+	}, time.Second, time.Millisecond)
+
+	srv.PersistAll()
+	require.Eventually(t, func() bool {
+		index, _, _ := store.Load("file/app.log")
+		return index == 300
+	}, time.Second, time.Millisecond)
+	require.NoError(t, checkpointer.Err())
+}
+
+func TestCheckpointerOutOfOrder(t *testing.T) {
+	store, err := OpenFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	require.NoError(t, err)
+	tracker := NewAckTracker()
+	checkpointer := NewCheckpointer(store, tracker)
+	checkpoint := func() uint64 {
+		index, _, err := store.Load("file/app.log")
+		require.NoError(t, err)
+		return index
+	}
+
+	acks := make([]AckFunc, 6)
+	for i := range acks {
+		acks[i] = checkpointer.AckFunc("file/app.log", uint64(i+1), nil)
+	}
+	// concurrent requests accepted in a different order than produced
+	acks[0](Ack{Accepted: true, UUID: "shipper", Index: 1})
+	acks[2](Ack{Accepted: true, UUID: "shipper", Index: 2})
+	acks[1](Ack{Accepted: true, UUID: "shipper", Index: 3})
+
+	tracker.Update(&messages.PersistedIndexReply{Uuid: "shipper", PersistedIndex: 2})
+	require.Equal(t, uint64(1), checkpoint(), "event 2 is not persisted")
+
+	tracker.Update(&messages.PersistedIndexReply{Uuid: "shipper", PersistedIndex: 3})
+	require.Equal(t, uint64(3), checkpoint())
+
+	// a filtered event doesn't hold the checkpoint back, a failed one does
+	// until it is published again
+	acks[3](Ack{Err: ErrFiltered})
+	require.Equal(t, uint64(4), checkpoint())
+	acks[4](Ack{Err: errors.New("unavailable")})
+	acks[5](Ack{Accepted: true, UUID: "shipper", Index: 4})
+	tracker.Update(&messages.PersistedIndexReply{Uuid: "shipper", PersistedIndex: 4})
+	require.Equal(t, uint64(4), checkpoint())
+
+	checkpointer.AckFunc("file/app.log", 5, nil)(Ack{Accepted: true, UUID: "shipper", Index: 5})
+	tracker.Update(&messages.PersistedIndexReply{Uuid: "shipper", PersistedIndex: 5})
+	require.Equal(t, uint64(6), checkpoint())
+	require.NoError(t, checkpointer.Err())
+}
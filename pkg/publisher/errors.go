@@ -0,0 +1,25 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+// kindError is a sentinel of the package also matching a sentinel of the
+// error taxonomy of the helpers, like helpers.ErrQueueFull.
+type kindError struct {
+	msg  string
+	kind error
+}
+
+func newKindError(msg string, kind error) error {
+	return &kindError{msg: msg, kind: kind}
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+// Is makes kindError match its kind.
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
@@ -0,0 +1,173 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/protocol"
+)
+
+// FlowMetrics receives the throttle level of a FlowController, it's
+// implemented by the prometheus client metrics.
+type FlowMetrics interface {
+	// ThrottleLevel is 0 when the events are sent at the maximum rate, and
+	// gets closer to 1 as the rate decreases.
+	ThrottleLevel(level float64)
+}
+
+// FlowControlConfig configures a FlowController.
+type FlowControlConfig struct {
+	// MaxEventsPerSecond is the highest rate, it must be positive.
+	MaxEventsPerSecond float64
+	// MinEventsPerSecond is the lowest rate, defaults to 1% of the maximum.
+	MinEventsPerSecond float64
+	// InitialEventsPerSecond is the rate at start, defaults to the maximum.
+	InitialEventsPerSecond float64
+	// Increase is added to the rate after every request accepted without
+	// pressure, defaults to 1% of the maximum.
+	Increase float64
+	// Decrease multiplies the rate when the shipper is under pressure, it's
+	// between 0 and 1 and defaults to 0.5.
+	Decrease float64
+	// PressureThreshold is the queue pressure reported by the shipper from
+	// which the rate decreases, see protocol.QueuePressureKey. Defaults to
+	// 0.9.
+	PressureThreshold float64
+	// Metrics, if set, receives the throttle level every time it changes.
+	Metrics FlowMetrics
+}
+
+// FlowController adapts the rate of the published events to the shipper,
+// like the AIMD congestion control of TCP: the rate increases slowly while
+// the requests are fully accepted, and is cut when the shipper is under
+// pressure. The shipper is under pressure when it doesn't accept all the
+// events of a request, fails with a ResourceExhausted status, or reports a
+// queue pressure above the threshold. It can be shared by several
+// publishers and is safe for concurrent use.
+type FlowController struct {
+	config  FlowControlConfig
+	limiter *RateLimiter
+
+	mu   sync.Mutex
+	rate float64
+}
+
+// NewFlowController returns a FlowController, zero values in config are
+// replaced by their defaults.
+func NewFlowController(config FlowControlConfig) (*FlowController, error) {
+	if config.MaxEventsPerSecond <= 0 {
+		return nil, fmt.Errorf("maximum events per second must be positive, got %v", config.MaxEventsPerSecond)
+	}
+	if config.MinEventsPerSecond <= 0 {
+		config.MinEventsPerSecond = config.MaxEventsPerSecond / 100
+	}
+	if config.MinEventsPerSecond > config.MaxEventsPerSecond {
+		return nil, fmt.Errorf("minimum events per second %v is above the maximum %v", config.MinEventsPerSecond, config.MaxEventsPerSecond)
+	}
+	if config.InitialEventsPerSecond <= 0 {
+		config.InitialEventsPerSecond = config.MaxEventsPerSecond
+	}
+	if config.Increase <= 0 {
+		config.Increase = config.MaxEventsPerSecond / 100
+	}
+	if config.Decrease <= 0 || config.Decrease >= 1 {
+		config.Decrease = 0.5
+	}
+	if config.PressureThreshold <= 0 {
+		config.PressureThreshold = 0.9
+	}
+	rate := math.Min(math.Max(config.InitialEventsPerSecond, config.MinEventsPerSecond), config.MaxEventsPerSecond)
+	f := &FlowController{
+		config:  config,
+		limiter: NewRateLimiter(RateLimiterConfig{EventsPerSecond: rate}),
+		rate:    rate,
+	}
+	if config.Metrics != nil {
+		config.Metrics.ThrottleLevel(f.ThrottleLevel())
+	}
+	return f, nil
+}
+
+// Rate returns the current events per second.
+func (f *FlowController) Rate() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rate
+}
+
+// ThrottleLevel returns 1 minus the ratio of the current rate to the
+// maximum.
+func (f *FlowController) ThrottleLevel() float64 {
+	return 1 - f.Rate()/f.config.MaxEventsPerSecond
+}
+
+// Wait blocks until the events can be sent at the current rate, or ctx is
+// done. A nil FlowController never waits.
+func (f *FlowController) Wait(ctx context.Context, events int) error {
+	if f == nil {
+		return nil
+	}
+	return f.limiter.Wait(ctx, events, 0)
+}
+
+// Observe adapts the rate to the outcome of a publish of requested events,
+// header holds the reply headers.
+func (f *FlowController) Observe(requested int, reply *messages.PublishReply, header metadata.MD) {
+	pressure, ok := protocol.QueuePressure(header)
+	if int(reply.GetAcceptedCount()) < requested || (ok && pressure >= f.config.PressureThreshold) {
+		f.adjust(func(rate float64) float64 { return rate * f.config.Decrease })
+		return
+	}
+	f.adjust(func(rate float64) float64 { return rate + f.config.Increase })
+}
+
+// ObserveError adapts the rate to a failed publish.
+func (f *FlowController) ObserveError(err error) {
+	if status.Code(err) == codes.ResourceExhausted {
+		f.adjust(func(rate float64) float64 { return rate * f.config.Decrease })
+	}
+}
+
+// adjust updates the rate, the limiter and the metrics under the lock so
+// concurrent adjustments are applied in the same order to all of them.
+func (f *FlowController) adjust(next func(rate float64) float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rate := math.Min(math.Max(next(f.rate), f.config.MinEventsPerSecond), f.config.MaxEventsPerSecond)
+	if rate == f.rate {
+		return
+	}
+	f.rate = rate
+	f.limiter.setEventsPerSecond(rate)
+	if f.config.Metrics != nil {
+		f.config.Metrics.ThrottleLevel(1 - rate/f.config.MaxEventsPerSecond)
+	}
+}
+
+// publish sends req through client and observes the outcome. A nil
+// FlowController only sends it.
+func (f *FlowController) publish(ctx context.Context, client Client, req *messages.PublishRequest) (*messages.PublishReply, error) {
+	if f == nil {
+		return client.Publish(ctx, req)
+	}
+	var header metadata.MD
+	reply, err := client.Publish(ctx, req, grpc.Header(&header))
+	if err != nil {
+		f.ObserveError(err)
+		return nil, err
+	}
+	f.Observe(len(req.Events), reply, header)
+	return reply, nil
+}
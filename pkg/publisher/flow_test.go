@@ -0,0 +1,141 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/protocol"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+type throttleRecorder struct {
+	mu     sync.Mutex
+	levels []float64
+}
+
+func (r *throttleRecorder) ThrottleLevel(level float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.levels = append(r.levels, level)
+}
+
+func TestFlowController(t *testing.T) {
+	metrics := &throttleRecorder{}
+	f, err := NewFlowController(FlowControlConfig{
+		MaxEventsPerSecond: 1000,
+		MinEventsPerSecond: 100,
+		Increase:           50,
+		Metrics:            metrics,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1000.0, f.Rate())
+
+	accepted := &messages.PublishReply{AcceptedCount: 10}
+	partial := &messages.PublishReply{AcceptedCount: 5}
+	pressure := metadata.Pairs(protocol.QueuePressureKey, "0.95")
+	relaxed := metadata.Pairs(protocol.QueuePressureKey, "0.5")
+
+	f.Observe(10, partial, nil)
+	require.Equal(t, 500.0, f.Rate())
+	f.Observe(10, accepted, pressure)
+	require.Equal(t, 250.0, f.Rate())
+	f.ObserveError(status.Error(codes.ResourceExhausted, "queue is full"))
+	require.Equal(t, 125.0, f.Rate())
+	f.ObserveError(status.Error(codes.Unavailable, "restarting"))
+	require.Equal(t, 125.0, f.Rate())
+	f.Observe(10, partial, nil)
+	require.Equal(t, 100.0, f.Rate(), "bounded by the minimum")
+	require.Equal(t, 0.9, f.ThrottleLevel())
+
+	f.Observe(10, accepted, relaxed)
+	require.Equal(t, 150.0, f.Rate())
+	for i := 0; i < 20; i++ {
+		f.Observe(10, accepted, nil)
+	}
+	require.Equal(t, 1000.0, f.Rate(), "bounded by the maximum")
+	require.Zero(t, f.ThrottleLevel())
+
+	require.Equal(t, []float64{0, 0.5, 0.75, 0.875, 0.9}, metrics.levels[:5])
+	require.Zero(t, metrics.levels[len(metrics.levels)-1])
+
+	_, err = NewFlowController(FlowControlConfig{})
+	require.Error(t, err)
+	_, err = NewFlowController(FlowControlConfig{MaxEventsPerSecond: 10, MinEventsPerSecond: 20})
+	require.Error(t, err)
+}
+
+func TestFlowControllerConcurrentAdjust(t *testing.T) {
+	metrics := &throttleRecorder{}
+	f, err := NewFlowController(FlowControlConfig{MaxEventsPerSecond: 1000, Increase: 10, Metrics: metrics})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if (i+j)%3 == 0 {
+					f.Observe(10, &messages.PublishReply{}, nil)
+				} else {
+					f.Observe(10, &messages.PublishReply{AcceptedCount: 10}, nil)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// the limiter and the metrics end with the last rate
+	f.limiter.mu.Lock()
+	require.Equal(t, f.Rate(), f.limiter.events.rate)
+	f.limiter.mu.Unlock()
+	metrics.mu.Lock()
+	require.Equal(t, f.ThrottleLevel(), metrics.levels[len(metrics.levels)-1])
+	metrics.mu.Unlock()
+}
+
+func TestBatcherFlowControl(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	f, err := NewFlowController(FlowControlConfig{MaxEventsPerSecond: 100000})
+	require.NoError(t, err)
+	b := NewBatcher(c, BatcherConfig{MaxEvents: 2, FlowControl: f})
+	defer b.Close(context.Background())
+
+	srv.SetPublishHeader(metadata.Pairs(protocol.QueuePressureKey, "1"))
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.Add(context.Background(), testEvent(fmt.Sprint(i)), nil))
+	}
+	require.Equal(t, 50000.0, f.Rate())
+
+	srv.SetPublishHeader(nil)
+	srv.SetAcceptLimit(1)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.Add(context.Background(), testEvent(fmt.Sprint(i)), nil))
+	}
+	require.Equal(t, 25000.0, f.Rate())
+}
+
+func TestAsyncPublisherFlowControl(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	f, err := NewFlowController(FlowControlConfig{MaxEventsPerSecond: 100000})
+	require.NoError(t, err)
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{FlowControl: f})
+
+	srv.SetPublishHeader(metadata.Pairs(protocol.QueuePressureKey, "0.99"))
+	require.NoError(t, p.Publish(context.Background(), testEvent("first"), nil))
+	require.NoError(t, p.Close(context.Background()))
+	require.Len(t, srv.Events(), 1)
+	require.Equal(t, 50000.0, f.Rate())
+}
@@ -0,0 +1,188 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// MemoryLimiter reports how close the process is to its memory budget.
+type MemoryLimiter interface {
+	// Pressure returns the memory in use as a fraction of the budget,
+	// where 0 means no memory in use and 1 means the budget is exhausted.
+	Pressure() float64
+}
+
+// MemoryLimiterFunc adapts a function to the MemoryLimiter interface.
+type MemoryLimiterFunc func() float64
+
+// Pressure implements MemoryLimiter.
+func (f MemoryLimiterFunc) Pressure() float64 {
+	return f()
+}
+
+// RuntimeMemoryLimiter is a MemoryLimiter based on the Go runtime heap statistics.
+type RuntimeMemoryLimiter struct {
+	budget   uint64
+	interval time.Duration
+
+	mu       sync.Mutex
+	pressure float64
+	updated  time.Time
+}
+
+// NewRuntimeMemoryLimiter returns a MemoryLimiter comparing the heap in use
+// against budget bytes. Since reading the runtime stats stops the world,
+// values are cached for 100ms.
+func NewRuntimeMemoryLimiter(budget uint64) *RuntimeMemoryLimiter {
+	return &RuntimeMemoryLimiter{
+		budget:   budget,
+		interval: 100 * time.Millisecond,
+	}
+}
+
+// Pressure implements MemoryLimiter.
+func (r *RuntimeMemoryLimiter) Pressure() float64 {
+	if r.budget == 0 {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.updated) < r.interval {
+		return r.pressure
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	r.pressure = float64(stats.HeapInuse) / float64(r.budget)
+	r.updated = time.Now()
+	return r.pressure
+}
+
+// Priority orders events for load shedding, lowest priority events are shed first.
+type Priority int
+
+const (
+	// PriorityLow events are shed as soon as the soft limit is reached.
+	PriorityLow Priority = iota
+	// PriorityNormal events are shed once the hard limit is reached.
+	PriorityNormal
+	// PriorityHigh events are never shed.
+	PriorityHigh
+)
+
+// LoadShedderConfig configures a LoadShedder.
+type LoadShedderConfig struct {
+	// Limiter reports the current memory pressure, see
+	// NewRuntimeMemoryLimiter. Nothing is shed when it's nil, since there is
+	// no memory budget to compare against.
+	Limiter MemoryLimiter
+	// SoftLimit is the pressure at which queue limits start shrinking and
+	// low priority events are shed.
+	SoftLimit float64
+	// HardLimit is the pressure at which queue limits reach their minimum and
+	// all but high priority events are shed.
+	HardLimit float64
+	// MinQueueFraction is the smallest fraction of the configured queue
+	// limit that is kept under memory pressure.
+	MinQueueFraction float64
+	// Priority returns the priority of an event. All events have
+	// PriorityNormal when unset.
+	Priority func(*messages.Event) Priority
+}
+
+// DefaultLoadShedderConfig returns the default load shedding configuration.
+func DefaultLoadShedderConfig() LoadShedderConfig {
+	return LoadShedderConfig{
+		SoftLimit:        0.75,
+		HardLimit:        0.95,
+		MinQueueFraction: 0.1,
+	}
+}
+
+// LoadShedder decides how much the publisher may queue and which events
+// it should drop depending on the memory pressure of the process.
+type LoadShedder struct {
+	config LoadShedderConfig
+	shed   uint64
+}
+
+// NewLoadShedder returns a new LoadShedder, zero values in config are
+// replaced by the ones of DefaultLoadShedderConfig. The hard limit must be
+// above the soft limit.
+func NewLoadShedder(config LoadShedderConfig) (*LoadShedder, error) {
+	defaults := DefaultLoadShedderConfig()
+	if config.SoftLimit <= 0 {
+		config.SoftLimit = defaults.SoftLimit
+	}
+	if config.HardLimit <= 0 {
+		config.HardLimit = defaults.HardLimit
+	}
+	if config.HardLimit <= config.SoftLimit {
+		return nil, fmt.Errorf("hard limit %v must be above the soft limit %v", config.HardLimit, config.SoftLimit)
+	}
+	if config.MinQueueFraction <= 0 || config.MinQueueFraction > 1 {
+		config.MinQueueFraction = defaults.MinQueueFraction
+	}
+	return &LoadShedder{config: config}, nil
+}
+
+func (s *LoadShedder) pressure() float64 {
+	if s.config.Limiter == nil {
+		return 0
+	}
+	return s.config.Limiter.Pressure()
+}
+
+// QueueLimit scales the configured queue limit down as the memory pressure
+// grows from the soft limit to the hard limit. A limit is reached when the
+// pressure is equal to it, like in Admit.
+func (s *LoadShedder) QueueLimit(limit int) int {
+	pressure := s.pressure()
+	if pressure < s.config.SoftLimit {
+		return limit
+	}
+	fraction := s.config.MinQueueFraction
+	if pressure < s.config.HardLimit {
+		progress := (pressure - s.config.SoftLimit) / (s.config.HardLimit - s.config.SoftLimit)
+		fraction = 1 - progress*(1-s.config.MinQueueFraction)
+	}
+	scaled := int(float64(limit) * fraction)
+	if scaled < 1 {
+		scaled = 1
+	}
+	return scaled
+}
+
+// Admit reports whether the event should be accepted given the current
+// memory pressure. Rejected events are counted as shed.
+func (s *LoadShedder) Admit(e *messages.Event) bool {
+	priority := PriorityNormal
+	if s.config.Priority != nil {
+		priority = s.config.Priority(e)
+	}
+	if priority >= PriorityHigh {
+		return true
+	}
+
+	pressure := s.pressure()
+	admit := pressure < s.config.SoftLimit ||
+		(priority > PriorityLow && pressure < s.config.HardLimit)
+	if !admit {
+		atomic.AddUint64(&s.shed, 1)
+	}
+	return admit
+}
+
+// Shed returns the number of events rejected by Admit.
+func (s *LoadShedder) Shed() uint64 {
+	return atomic.LoadUint64(&s.shed)
+}
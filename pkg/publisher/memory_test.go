@@ -0,0 +1,116 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func TestLoadShedder(t *testing.T) {
+	low := &messages.Event{Source: &messages.Source{InputId: "debug"}}
+	normal := &messages.Event{Source: &messages.Source{InputId: "logs"}}
+	high := &messages.Event{Source: &messages.Source{InputId: "audit"}}
+	priorities := map[string]Priority{"debug": PriorityLow, "logs": PriorityNormal, "audit": PriorityHigh}
+
+	cases := []struct {
+		name     string
+		pressure float64
+		limit    int
+		admitted []*messages.Event
+		shed     []*messages.Event
+	}{
+		{
+			name:     "no pressure",
+			pressure: 0.2,
+			limit:    1000,
+			admitted: []*messages.Event{low, normal, high},
+		},
+		{
+			name:     "between soft and hard limit",
+			pressure: 0.75,
+			limit:    550,
+			admitted: []*messages.Event{normal, high},
+			shed:     []*messages.Event{low},
+		},
+		{
+			name:     "at the soft limit",
+			pressure: 0.5,
+			limit:    1000,
+			admitted: []*messages.Event{normal, high},
+			shed:     []*messages.Event{low},
+		},
+		{
+			name:     "at the hard limit",
+			pressure: 1,
+			limit:    100,
+			admitted: []*messages.Event{high},
+			shed:     []*messages.Event{low, normal},
+		},
+		{
+			name:     "above hard limit",
+			pressure: 1.2,
+			limit:    100,
+			admitted: []*messages.Event{high},
+			shed:     []*messages.Event{low, normal},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			shedder, err := NewLoadShedder(LoadShedderConfig{
+				Limiter:          MemoryLimiterFunc(func() float64 { return c.pressure }),
+				SoftLimit:        0.5,
+				HardLimit:        1,
+				MinQueueFraction: 0.1,
+				Priority: func(e *messages.Event) Priority {
+					return priorities[e.GetSource().GetInputId()]
+				},
+			})
+			require.NoError(t, err)
+			require.Equal(t, c.limit, shedder.QueueLimit(1000))
+			for _, e := range c.admitted {
+				require.True(t, shedder.Admit(e), e.GetSource().GetInputId())
+			}
+			for _, e := range c.shed {
+				require.False(t, shedder.Admit(e), e.GetSource().GetInputId())
+			}
+			require.Equal(t, uint64(len(c.shed)), shedder.Shed())
+		})
+	}
+}
+
+func TestLoadShedderWithoutLimiter(t *testing.T) {
+	shedder, err := NewLoadShedder(LoadShedderConfig{
+		Priority: func(*messages.Event) Priority { return PriorityLow },
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1000, shedder.QueueLimit(1000))
+	require.True(t, shedder.Admit(&messages.Event{}))
+	require.Zero(t, shedder.Shed())
+}
+
+func TestLoadShedderDefaults(t *testing.T) {
+	pressure := 0.85
+	shedder, err := NewLoadShedder(LoadShedderConfig{
+		Limiter: MemoryLimiterFunc(func() float64 { return pressure }),
+	})
+	require.NoError(t, err)
+	// halfway between the default soft and hard limits
+	require.Equal(t, 550, shedder.QueueLimit(1000))
+
+	_, err = NewLoadShedder(LoadShedderConfig{SoftLimit: 0.8, HardLimit: 0.8})
+	require.Error(t, err)
+	_, err = NewLoadShedder(LoadShedderConfig{SoftLimit: 0.5, HardLimit: 0.4})
+	require.Error(t, err)
+}
+
+func TestRuntimeMemoryLimiter(t *testing.T) {
+	require.Zero(t, NewRuntimeMemoryLimiter(0).Pressure())
+	require.Greater(t, NewRuntimeMemoryLimiter(1).Pressure(), float64(1))
+}
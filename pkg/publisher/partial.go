@@ -0,0 +1,70 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"fmt"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// PartialReply is a publish request split according to the reply of the
+// shipper, which accepts a prefix of the events when its queue fills up.
+type PartialReply struct {
+	// Accepted are the events queued by the shipper.
+	Accepted []*messages.Event
+	// Unaccepted are the remaining events, they must be published again.
+	Unaccepted []*messages.Event
+	// UUID identifies the shipper process that replied.
+	UUID string
+	// LastIndex is the queue index of the last accepted event.
+	LastIndex uint64
+}
+
+// SplitReply splits the events of req into the accepted and unaccepted ones.
+// It fails if the reply accepts more events than the request holds.
+func SplitReply(req *messages.PublishRequest, reply *messages.PublishReply) (PartialReply, error) {
+	events := req.GetEvents()
+	accepted := int(reply.GetAcceptedCount())
+	if accepted > len(events) {
+		return PartialReply{}, fmt.Errorf("shipper accepted %d events out of %d", accepted, len(events))
+	}
+	return PartialReply{
+		Accepted:   events[:accepted:accepted],
+		Unaccepted: events[accepted:],
+		UUID:       reply.GetUuid(),
+		LastIndex:  reply.GetAcceptedIndex(),
+	}, nil
+}
+
+// Complete returns true if all the events were accepted.
+func (r PartialReply) Complete() bool {
+	return len(r.Unaccepted) == 0
+}
+
+// Index returns the queue index of the accepted event i. The event is
+// persisted once the persisted index of the shipper reaches this value.
+func (r PartialReply) Index(i int) uint64 {
+	return acceptedIndex(r.LastIndex, len(r.Accepted), i)
+}
+
+// Remainder returns the request publishing the unaccepted events, with the
+// same UUID as req so it's rejected if the shipper restarted, or nil when all
+// the events were accepted.
+func (r PartialReply) Remainder(req *messages.PublishRequest) *messages.PublishRequest {
+	if r.Complete() {
+		return nil
+	}
+	return &messages.PublishRequest{
+		Uuid:   req.GetUuid(),
+		Events: r.Unaccepted,
+	}
+}
+
+// acceptedIndex returns the queue index of the event i of the accepted ones,
+// given the index of the last one. Accepted events get consecutive indexes.
+func acceptedIndex(last uint64, accepted, i int) uint64 {
+	return last - uint64(accepted-1-i)
+}
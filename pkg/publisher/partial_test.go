@@ -0,0 +1,95 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func TestSplitReply(t *testing.T) {
+	events := []*messages.Event{testEvent("a"), testEvent("b"), testEvent("c")}
+	req := &messages.PublishRequest{Uuid: "shipper", Events: events}
+
+	cases := []struct {
+		name       string
+		reply      *messages.PublishReply
+		accepted   []*messages.Event
+		unaccepted []*messages.Event
+		indexes    []uint64
+	}{
+		{
+			name:       "all accepted",
+			reply:      &messages.PublishReply{Uuid: "shipper", AcceptedCount: 3, AcceptedIndex: 12},
+			accepted:   events,
+			unaccepted: []*messages.Event{},
+			indexes:    []uint64{10, 11, 12},
+		},
+		{
+			name:       "partially accepted",
+			reply:      &messages.PublishReply{Uuid: "shipper", AcceptedCount: 1, AcceptedIndex: 5},
+			accepted:   events[:1],
+			unaccepted: events[1:],
+			indexes:    []uint64{5},
+		},
+		{
+			name:       "none accepted",
+			reply:      &messages.PublishReply{Uuid: "restarted"},
+			accepted:   []*messages.Event{},
+			unaccepted: events,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			split, err := SplitReply(req, tc.reply)
+			require.NoError(t, err)
+			require.Equal(t, tc.accepted, split.Accepted)
+			require.Equal(t, tc.unaccepted, split.Unaccepted)
+			require.Equal(t, tc.reply.Uuid, split.UUID)
+			for i, index := range tc.indexes {
+				require.Equal(t, index, split.Index(i))
+			}
+
+			remainder := split.Remainder(req)
+			require.Equal(t, split.Complete(), remainder == nil)
+			if remainder != nil {
+				require.Equal(t, "shipper", remainder.Uuid)
+				require.Equal(t, tc.unaccepted, remainder.Events)
+			}
+		})
+	}
+
+	_, err := SplitReply(req, &messages.PublishReply{AcceptedCount: 4})
+	require.Error(t, err)
+}
+
+func TestAsyncPublisherRequeueUnaccepted(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	srv.SetAcceptLimit(2)
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{RequeueUnaccepted: true})
+
+	recorder := &ackRecorder{}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.Publish(context.Background(), testEvent(fmt.Sprint(i)), recorder.onAck))
+	}
+	require.NoError(t, p.Close(context.Background()))
+
+	acks := recorder.get()
+	require.Len(t, acks, 5)
+	for _, ack := range acks {
+		require.True(t, ack.Accepted)
+	}
+	got := make([]string, 0, 5)
+	for _, e := range srv.Events() {
+		got = append(got, e.Fields.Data["message"].GetStringValue())
+	}
+	require.Equal(t, []string{"0", "1", "2", "3", "4"}, got)
+}
@@ -0,0 +1,162 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiterConfig configures a RateLimiter. The event and byte limits
+// apply together, zero rates are unlimited.
+type RateLimiterConfig struct {
+	// EventsPerSecond is the sustained rate of published events.
+	EventsPerSecond float64
+	// EventsBurst is the number of events that can be published at once
+	// after a quiet period. Defaults to one second worth of events.
+	EventsBurst int
+	// BytesPerSecond is the sustained rate of published bytes, as counted
+	// by BatcherConfig.MaxBytes.
+	BytesPerSecond float64
+	// BytesBurst is the number of bytes that can be published at once after
+	// a quiet period. Defaults to one second worth of bytes.
+	BytesBurst int
+}
+
+// tokenBucket holds up to burst tokens, refilled at rate tokens per second.
+// The tokens can go negative: a request larger than the burst goes through
+// once the bucket is full, and the requests after it pay for it.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := &tokenBucket{rate: rate, burst: float64(burst), last: now}
+	if burst <= 0 {
+		b.burst = math.Max(1, math.Ceil(rate))
+	}
+	b.tokens = b.burst
+	return b
+}
+
+// reserve takes n tokens and returns how long to wait before using them.
+func (b *tokenBucket) reserve(now time.Time, n int) time.Duration {
+	if b == nil {
+		return 0
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+	need := math.Min(float64(n), b.burst)
+	var wait time.Duration
+	if b.tokens < need {
+		wait = time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+	}
+	b.tokens -= float64(n)
+	return wait
+}
+
+// refund gives back the tokens of a reservation that wasn't used.
+func (b *tokenBucket) refund(n int) {
+	if b != nil {
+		b.tokens = math.Min(b.burst, b.tokens+float64(n))
+	}
+}
+
+// RateLimiter bounds the events and bytes sent to the shipper with token
+// buckets. It can be shared by several publishers to bound their total
+// traffic, and is safe for concurrent use.
+type RateLimiter struct {
+	mu     sync.Mutex
+	events *tokenBucket
+	bytes  *tokenBucket
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewRateLimiter returns a RateLimiter with full buckets.
+func NewRateLimiter(config RateLimiterConfig) *RateLimiter {
+	now := time.Now()
+	return &RateLimiter{
+		events: newTokenBucket(config.EventsPerSecond, config.EventsBurst, now),
+		bytes:  newTokenBucket(config.BytesPerSecond, config.BytesBurst, now),
+		now:    time.Now,
+	}
+}
+
+// Wait blocks until a request of the given number of events and bytes can
+// be sent, or ctx is done. A nil RateLimiter never waits.
+func (l *RateLimiter) Wait(ctx context.Context, events, bytes int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	wait := l.reserveLocked(events, bytes)
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.events.refund(events)
+		l.bytes.refund(bytes)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Allow returns true and takes the tokens if a request of the given number
+// of events and bytes can be sent right away. A nil RateLimiter always
+// allows.
+func (l *RateLimiter) Allow(events, bytes int) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reserveLocked(events, bytes) > 0 {
+		l.events.refund(events)
+		l.bytes.refund(bytes)
+		return false
+	}
+	return true
+}
+
+// setEventsPerSecond changes the sustained event rate, the burst follows
+// the rate.
+func (l *RateLimiter) setEventsPerSecond(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// refill at the previous rate first
+	l.events.reserve(l.now(), 0)
+	l.events.rate = rate
+	l.events.burst = math.Max(1, math.Ceil(rate))
+	l.events.tokens = math.Min(l.events.tokens, l.events.burst)
+}
+
+func (l *RateLimiter) reserveLocked(events, bytes int) time.Duration {
+	now := l.now()
+	wait := l.events.reserve(now, events)
+	if bytesWait := l.bytes.reserve(now, bytes); bytesWait > wait {
+		wait = bytesWait
+	}
+	return wait
+}
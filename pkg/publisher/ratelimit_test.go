@@ -0,0 +1,119 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(0, 0)
+	newLimiter := func(config RateLimiterConfig) *RateLimiter {
+		l := NewRateLimiter(config)
+		l.now = func() time.Time { return now }
+		for _, b := range []*tokenBucket{l.events, l.bytes} {
+			if b != nil {
+				b.last = now
+			}
+		}
+		return l
+	}
+
+	t.Run("events", func(t *testing.T) {
+		l := newLimiter(RateLimiterConfig{EventsPerSecond: 10, EventsBurst: 5})
+		require.True(t, l.Allow(5, 0), "the burst is available right away")
+		require.False(t, l.Allow(1, 0))
+		now = now.Add(100 * time.Millisecond)
+		require.True(t, l.Allow(1, 0))
+		require.False(t, l.Allow(1, 0))
+		now = now.Add(time.Hour)
+		require.True(t, l.Allow(5, 0), "the bucket doesn't fill beyond the burst")
+		require.False(t, l.Allow(1, 0))
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		l := newLimiter(RateLimiterConfig{BytesPerSecond: 1000})
+		require.True(t, l.Allow(1000, 1000), "events are unlimited")
+		require.False(t, l.Allow(1, 1))
+		now = now.Add(time.Second)
+		require.True(t, l.Allow(1, 1000))
+	})
+
+	t.Run("larger than burst", func(t *testing.T) {
+		l := newLimiter(RateLimiterConfig{BytesPerSecond: 100, BytesBurst: 100})
+		require.True(t, l.Allow(1, 500), "a full bucket lets a large request through")
+		now = now.Add(time.Second)
+		require.False(t, l.Allow(1, 1), "its debt is paid by the next requests")
+		now = now.Add(4 * time.Second)
+		require.True(t, l.Allow(1, 1))
+	})
+
+	var unlimited *RateLimiter
+	require.True(t, unlimited.Allow(1000, 1000))
+	require.NoError(t, unlimited.Wait(context.Background(), 1000, 1000))
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := NewRateLimiter(RateLimiterConfig{EventsPerSecond: 100, EventsBurst: 1})
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, l.Wait(context.Background(), 1, 0))
+	}
+	require.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.Wait(ctx, 100, 0), context.DeadlineExceeded)
+	// the canceled reservation is given back
+	time.Sleep(20 * time.Millisecond)
+	require.True(t, l.Allow(1, 0))
+}
+
+func TestBatcherRateLimiter(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	b := NewBatcher(c, BatcherConfig{
+		MaxEvents:   1,
+		RateLimiter: NewRateLimiter(RateLimiterConfig{EventsPerSecond: 100, EventsBurst: 1}),
+	})
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, b.Add(context.Background(), testEvent("event"), nil))
+	}
+	require.GreaterOrEqual(t, time.Since(start), 25*time.Millisecond)
+	require.NoError(t, b.Close(context.Background()))
+	require.Len(t, srv.Events(), 4)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b = NewBatcher(c, BatcherConfig{
+		MaxEvents:   1,
+		RateLimiter: NewRateLimiter(RateLimiterConfig{EventsPerSecond: 1, EventsBurst: 1}),
+	})
+	require.NoError(t, b.Add(context.Background(), testEvent("allowed"), nil))
+	recorder := &ackRecorder{}
+	require.ErrorIs(t, b.Add(ctx, testEvent("limited"), recorder.onAck), context.Canceled)
+	require.Equal(t, []Ack{{Err: context.Canceled}}, recorder.get())
+}
+
+func TestAsyncPublisherRateLimiter(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{
+		MaxBatchEvents: 1,
+		RateLimiter:    NewRateLimiter(RateLimiterConfig{EventsPerSecond: 100, EventsBurst: 1}),
+	})
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, p.Publish(context.Background(), testEvent("event"), nil))
+	}
+	require.NoError(t, p.Close(context.Background()))
+	require.GreaterOrEqual(t, time.Since(start), 25*time.Millisecond)
+	require.Len(t, srv.Events(), 4)
+}
@@ -0,0 +1,332 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ReplayQueueConfig configures a ReplayQueue.
+type ReplayQueueConfig struct {
+	// Capacity is the maximum number of events retained, sent or not.
+	Capacity int
+	// MaxBatchEvents and MaxBatchBytes limit the size of the published
+	// requests, like in BatcherConfig.
+	MaxBatchEvents int
+	MaxBatchBytes  int
+	// RetryInterval is the wait before publishing again after a failure or
+	// when the shipper queue is full.
+	RetryInterval time.Duration
+}
+
+// DefaultReplayQueueConfig returns the default configuration.
+func DefaultReplayQueueConfig() ReplayQueueConfig {
+	batch := DefaultBatcherConfig()
+	return ReplayQueueConfig{
+		Capacity:       4096,
+		MaxBatchEvents: batch.MaxEvents,
+		MaxBatchBytes:  batch.MaxBytes,
+		RetryInterval:  time.Second,
+	}
+}
+
+type replayEntry struct {
+	event       *messages.Event
+	size        int
+	onPersisted func(error)
+	// index is the shipper queue index, once accepted
+	index uint64
+}
+
+// ReplayQueue is a ring buffer of events that keeps them after they are
+// sent, until the persisted index of the shipper covers them. When the
+// shipper restarts before persisting them, they are published again, so the
+// delivery is at least once without a disk spool, as long as the process
+// keeps running.
+//
+// The queue publishes its requests with the uuid of the shipper process, so
+// a restarted shipper rejects them instead of accepting them twice. It is
+// safe for concurrent use.
+type ReplayQueue struct {
+	client Client
+	config ReplayQueueConfig
+
+	mu      sync.Mutex
+	entries []replayEntry
+	// the events are numbered in push order, entries[seq%len(entries)]
+	// holds event seq. Events in [head, sent) were accepted and wait to be
+	// persisted, events in [sent, tail) wait to be sent.
+	head, sent, tail uint64
+	uuid             string
+	persisted        uint64
+	closed           bool
+	// space is closed and replaced every time events are persisted
+	space chan struct{}
+
+	// ready wakes up the worker when there are events to send
+	ready  chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewReplayQueue returns a ReplayQueue publishing through client and starts
+// its worker. Zero values in config are replaced by their defaults. The
+// queue only learns about the persisted events through Run or Update, and
+// Close must be called to stop the worker.
+func NewReplayQueue(client Client, config ReplayQueueConfig) *ReplayQueue {
+	defaults := DefaultReplayQueueConfig()
+	if config.Capacity <= 0 {
+		config.Capacity = defaults.Capacity
+	}
+	if config.MaxBatchEvents <= 0 {
+		config.MaxBatchEvents = defaults.MaxBatchEvents
+	}
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = defaults.MaxBatchBytes
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = defaults.RetryInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &ReplayQueue{
+		client:  client,
+		config:  config,
+		entries: make([]replayEntry, config.Capacity),
+		space:   make(chan struct{}),
+		ready:   make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	q.wg.Add(1)
+	go q.worker()
+	return q
+}
+
+func (q *ReplayQueue) entry(seq uint64) *replayEntry {
+	return &q.entries[seq%uint64(len(q.entries))]
+}
+
+// Push queues the event, blocking while the queue is full. onPersisted may
+// be nil, it's called once the shipper persisted the event, or with
+// ErrClosed when the queue is closed first.
+func (q *ReplayQueue) Push(ctx context.Context, e *messages.Event, onPersisted func(error)) error {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return ErrClosed
+		}
+		if q.tail-q.head < uint64(len(q.entries)) {
+			*q.entry(q.tail) = replayEntry{event: e, size: eventSize(e), onPersisted: onPersisted}
+			q.tail++
+			q.mu.Unlock()
+			q.wake()
+			return nil
+		}
+		space := q.space
+		q.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-space:
+		}
+	}
+}
+
+func (q *ReplayQueue) wake() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Run feeds the queue with the updates streamed by sub, polled every
+// interval, until ctx is done.
+func (q *ReplayQueue) Run(ctx context.Context, sub PersistedIndexSubscriber, interval time.Duration) error {
+	return sub.SubscribePersistedIndex(ctx, interval, func(reply *messages.PersistedIndexReply) error {
+		q.Update(reply)
+		return nil
+	})
+}
+
+// Update records a persisted index reported by the shipper, releasing the
+// persisted events. When the shipper restarted, the events it didn't
+// persist are sent again.
+func (q *ReplayQueue) Update(reply *messages.PersistedIndexReply) {
+	q.mu.Lock()
+	if reply.GetUuid() != q.uuid {
+		q.restartLocked(reply.GetUuid())
+	}
+	if reply.GetPersistedIndex() > q.persisted {
+		q.persisted = reply.GetPersistedIndex()
+	}
+	var persisted []func(error)
+	for q.head < q.sent && q.entry(q.head).index <= q.persisted {
+		entry := q.entry(q.head)
+		if entry.onPersisted != nil {
+			persisted = append(persisted, entry.onPersisted)
+		}
+		*entry = replayEntry{}
+		q.head++
+	}
+	if len(persisted) > 0 {
+		close(q.space)
+		q.space = make(chan struct{})
+	}
+	q.mu.Unlock()
+
+	for _, fn := range persisted {
+		fn(nil)
+	}
+}
+
+// restartLocked switches to a new shipper process. The events accepted by
+// the previous one are sent again, the first uuid seen isn't a restart.
+func (q *ReplayQueue) restartLocked(uuid string) {
+	if q.uuid != "" && q.sent > q.head {
+		q.sent = q.head
+		q.wake()
+	}
+	q.uuid = uuid
+	q.persisted = 0
+}
+
+// Len returns the number of events retained, sent or not.
+func (q *ReplayQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int(q.tail - q.head)
+}
+
+// Unsent returns the number of events waiting to be sent.
+func (q *ReplayQueue) Unsent() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int(q.tail - q.sent)
+}
+
+// Close stops accepting events and waits until the retained events are
+// persisted or ctx is done. In that case the worker is stopped and the
+// remaining events are notified with ErrClosed.
+func (q *ReplayQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	var err error
+	for err == nil {
+		q.mu.Lock()
+		empty := q.head == q.tail
+		space := q.space
+		q.mu.Unlock()
+		if empty {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-space:
+		}
+	}
+	q.cancel()
+	q.wg.Wait()
+
+	q.mu.Lock()
+	var remaining []func(error)
+	for ; q.head < q.tail; q.head++ {
+		if fn := q.entry(q.head).onPersisted; fn != nil {
+			remaining = append(remaining, fn)
+		}
+		*q.entry(q.head) = replayEntry{}
+	}
+	q.sent = q.head
+	q.mu.Unlock()
+	for _, fn := range remaining {
+		fn(ErrClosed)
+	}
+	return err
+}
+
+func (q *ReplayQueue) worker() {
+	defer q.wg.Done()
+	for {
+		req, from, ok := q.next()
+		if !ok {
+			select {
+			case <-q.ctx.Done():
+				return
+			case <-q.ready:
+			}
+			continue
+		}
+
+		reply, err := q.client.Publish(q.ctx, req)
+		if err == nil && q.accept(from, req, reply) {
+			continue
+		}
+		// failed, rejected by a restarted shipper or its queue is full
+		timer := time.NewTimer(q.config.RetryInterval)
+		select {
+		case <-q.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// next returns the request for the next events to send and the sequence
+// number of the first one.
+func (q *ReplayQueue) next() (*messages.PublishRequest, uint64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.sent == q.tail {
+		return nil, 0, false
+	}
+	req := &messages.PublishRequest{Uuid: q.uuid}
+	size := 0
+	for seq := q.sent; seq < q.tail && len(req.Events) < q.config.MaxBatchEvents; seq++ {
+		entry := q.entry(seq)
+		if len(req.Events) > 0 && size+entry.size > q.config.MaxBatchBytes {
+			break
+		}
+		size += entry.size
+		req.Events = append(req.Events, entry.event)
+	}
+	return req, q.sent, true
+}
+
+// accept records the indexes of the accepted events, it returns false when
+// the request must be retried later.
+func (q *ReplayQueue) accept(from uint64, req *messages.PublishRequest, reply *messages.PublishReply) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if reply.GetUuid() != q.uuid {
+		q.restartLocked(reply.GetUuid())
+	}
+	if req.Uuid != "" && req.Uuid != reply.GetUuid() {
+		// rejected by a restarted shipper, the retained events are sent again
+		return true
+	}
+	if q.sent != from {
+		// replayed while publishing, the events are sent again
+		return true
+	}
+	split, err := SplitReply(req, reply)
+	if err != nil {
+		return false
+	}
+	for i := range split.Accepted {
+		q.entry(from + uint64(i)).index = split.Index(i)
+	}
+	q.sent += uint64(len(split.Accepted))
+	return split.Complete()
+}
@@ -0,0 +1,158 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+type persistedRecorder struct {
+	results chan error
+}
+
+func newPersistedRecorder() *persistedRecorder {
+	return &persistedRecorder{results: make(chan error, 100)}
+}
+
+func (r *persistedRecorder) onPersisted(err error) {
+	r.results <- err
+}
+
+func (r *persistedRecorder) count() int {
+	return len(r.results)
+}
+
+// stopReplayQueue closes q without waiting for the events to be persisted.
+func stopReplayQueue(q *ReplayQueue) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = q.Close(ctx)
+}
+
+func TestReplayQueuePersisted(t *testing.T) {
+	srv, client := newTestServer(t, servertest.Options{UUID: "shipper-1"})
+	q := NewReplayQueue(client, ReplayQueueConfig{RetryInterval: time.Millisecond})
+	defer stopReplayQueue(q)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = q.Run(ctx, client, time.Millisecond)
+	}()
+
+	persisted := newPersistedRecorder()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, q.Push(ctx, testEvent("test"), persisted.onPersisted))
+	}
+	require.Eventually(t, func() bool { return q.Unsent() == 0 }, time.Second, time.Millisecond)
+	require.Equal(t, 3, q.Len())
+	require.Zero(t, persisted.count())
+
+	require.NoError(t, srv.Persist(2))
+	require.Eventually(t, func() bool { return persisted.count() == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, 1, q.Len())
+
+	srv.PersistAll()
+	require.Eventually(t, func() bool { return q.Len() == 0 }, time.Second, time.Millisecond)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, <-persisted.results)
+	}
+	require.Len(t, srv.Events(), 3)
+}
+
+func TestReplayQueueRestart(t *testing.T) {
+	cases := []struct {
+		name string
+		// detect tells the queue about the restart
+		detect func(q *ReplayQueue)
+	}{
+		{
+			name: "persisted index",
+			detect: func(q *ReplayQueue) {
+				q.Update(&messages.PersistedIndexReply{Uuid: "shipper-2"})
+			},
+		},
+		{
+			name: "publish reply",
+			detect: func(q *ReplayQueue) {
+				require.NoError(t, q.Push(context.Background(), testEvent("after"), nil))
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, client := newTestServer(t, servertest.Options{UUID: "shipper-1"})
+			q := NewReplayQueue(client, ReplayQueueConfig{RetryInterval: time.Millisecond})
+			defer stopReplayQueue(q)
+
+			persisted := newPersistedRecorder()
+			for i := 0; i < 2; i++ {
+				require.NoError(t, q.Push(context.Background(), testEvent("before"), persisted.onPersisted))
+			}
+			require.Eventually(t, func() bool { return q.Unsent() == 0 }, time.Second, time.Millisecond)
+			require.NoError(t, srv.Persist(1))
+			q.Update(&messages.PersistedIndexReply{Uuid: "shipper-1", PersistedIndex: 1})
+			require.NoError(t, <-persisted.results)
+
+			// the second event is lost by the restart
+			srv.Restart("shipper-2")
+			tc.detect(q)
+			require.Eventually(t, func() bool { return q.Unsent() == 0 }, time.Second, time.Millisecond)
+
+			var got []string
+			for _, e := range srv.Events() {
+				got = append(got, e.GetFields().GetData()["message"].GetStringValue())
+			}
+			require.Equal(t, "before", got[2], "the unpersisted event is sent again")
+			require.Zero(t, persisted.count())
+
+			srv.PersistAll()
+			_, index := srv.Indexes()
+			q.Update(&messages.PersistedIndexReply{Uuid: "shipper-2", PersistedIndex: index})
+			require.NoError(t, <-persisted.results)
+			require.Zero(t, q.Len())
+		})
+	}
+}
+
+func TestReplayQueueShipperFull(t *testing.T) {
+	srv, client := newTestServer(t, servertest.Options{UUID: "shipper"})
+	srv.SetAcceptLimit(1)
+	q := NewReplayQueue(client, ReplayQueueConfig{RetryInterval: time.Millisecond})
+	defer stopReplayQueue(q)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, q.Push(context.Background(), testEvent("test"), nil))
+	}
+	require.Eventually(t, func() bool { return q.Unsent() == 0 }, time.Second, time.Millisecond)
+	require.Len(t, srv.Events(), 3)
+	require.Equal(t, 3, q.Len())
+}
+
+func TestReplayQueueFull(t *testing.T) {
+	_, client := newTestServer(t, servertest.Options{UUID: "shipper"})
+	q := NewReplayQueue(client, ReplayQueueConfig{Capacity: 1})
+
+	persisted := newPersistedRecorder()
+	require.NoError(t, q.Push(context.Background(), testEvent("test"), persisted.onPersisted))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, q.Push(ctx, testEvent("test"), nil), context.DeadlineExceeded)
+
+	// the event is never persisted
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer closeCancel()
+	require.ErrorIs(t, q.Close(closeCtx), context.DeadlineExceeded)
+	require.ErrorIs(t, <-persisted.results, ErrClosed)
+	require.ErrorIs(t, q.Push(context.Background(), testEvent("test"), nil), ErrClosed)
+}
@@ -0,0 +1,79 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Sequencer numbers the events of every source, see helpers.Sequence. The
+// number is stamped once, when the event is added to a publisher, and is
+// kept by the retries and the spool, so a shipper deduplicating on it
+// stores each event once even when a reply is lost. It is safe for
+// concurrent use.
+type Sequencer struct {
+	producer string
+
+	mu   sync.Mutex
+	last map[string]uint64
+}
+
+// NewSequencer returns a Sequencer numbering the events as producer, which
+// defaults to a random UUID. A producer ID must not be reused with numbers
+// starting over, so a stable ID needs the numbers restored with Resume.
+func NewSequencer(producer string) (*Sequencer, error) {
+	if producer == "" {
+		uuid, err := helpers.NewUUID()
+		if err != nil {
+			return nil, fmt.Errorf("error generating the producer ID: %w", err)
+		}
+		producer = uuid.String()
+	}
+	return &Sequencer{producer: producer, last: map[string]uint64{}}, nil
+}
+
+// Producer returns the producer ID of the stamped events.
+func (s *Sequencer) Producer() string {
+	return s.producer
+}
+
+// Resume continues the numbers of source, see SourceKey, after last.
+func (s *Sequencer) Resume(source string, last uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last > s.last[source] {
+		s.last[source] = last
+	}
+}
+
+// Last returns the number of the last stamped event of source.
+func (s *Sequencer) Last(source string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last[source]
+}
+
+// Stamp sets the next number of the source of the event in its metadata.
+// Events already numbered are left as they are. Stamp does nothing on a nil
+// Sequencer.
+func (s *Sequencer) Stamp(e *messages.Event) error {
+	if s == nil {
+		return nil
+	}
+	if _, ok, err := helpers.GetSequence(e); ok || err != nil {
+		return err
+	}
+	source := SourceKey(e)
+	s.mu.Lock()
+	s.last[source]++
+	number := s.last[source]
+	s.mu.Unlock()
+	helpers.SetSequence(e, helpers.Sequence{Producer: s.producer, Number: number})
+	return nil
+}
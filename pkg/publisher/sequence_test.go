@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func TestSequencerStamp(t *testing.T) {
+	s, err := NewSequencer("")
+	require.NoError(t, err)
+	require.NotEmpty(t, s.Producer())
+
+	other := testEvent("other")
+	other.Source = &messages.Source{InputId: "other"}
+	s.Resume("other/", 10)
+	for i, e := range []*messages.Event{testEvent("a"), other, testEvent("b")} {
+		require.NoError(t, s.Stamp(e), i)
+	}
+	seq, ok, err := helpers.GetSequence(other)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, helpers.Sequence{Producer: s.Producer(), Number: 11}, seq)
+	require.Equal(t, uint64(2), s.Last("test/"))
+
+	// numbered events keep their number
+	require.NoError(t, s.Stamp(other))
+	seq, _, _ = helpers.GetSequence(other)
+	require.Equal(t, uint64(11), seq.Number)
+
+	var nilSequencer *Sequencer
+	require.NoError(t, nilSequencer.Stamp(testEvent("c")))
+}
+
+func TestBatcherSequencer(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{})
+	s, err := NewSequencer("producer")
+	require.NoError(t, err)
+	b := NewBatcher(c, BatcherConfig{Sequencer: s})
+	defer b.Close(context.Background())
+
+	for _, message := range []string{"a", "b", "c"} {
+		require.NoError(t, b.Add(context.Background(), testEvent(message), nil))
+	}
+	require.NoError(t, b.Flush(context.Background()))
+	for i, e := range srv.Events() {
+		seq, ok, err := helpers.GetSequence(e)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, helpers.Sequence{Producer: "producer", Number: uint64(i + 1)}, seq)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"sync"
+)
+
+// ShutdownReport is the outcome of a shutdown.
+type ShutdownReport struct {
+	// Abandoned is the number of events that were not published before the
+	// deadline. Their acks got ErrClosed, or the error of their canceled
+	// publish.
+	Abandoned int
+	// Unpersisted is the number of events accepted by the shipper that were
+	// not persisted before the deadline, or were lost by a shipper restart.
+	// It's only counted with an AckTracker.
+	Unpersisted int
+}
+
+// persistCounter counts the accepted events until the tracker reports them
+// persisted.
+type persistCounter struct {
+	tracker *AckTracker
+
+	mu      sync.Mutex
+	pending int
+	lost    int
+	// changed is closed and replaced every time pending decreases
+	changed chan struct{}
+}
+
+func newPersistCounter(tracker *AckTracker) *persistCounter {
+	return &persistCounter{tracker: tracker, changed: make(chan struct{})}
+}
+
+// accepted counts n events accepted by the shipper process uuid, up to
+// index.
+func (c *persistCounter) accepted(uuid string, index uint64, n int) {
+	if c.tracker == nil || n == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.pending += n
+	c.mu.Unlock()
+	// the callback can run right away, without the lock
+	c.tracker.OnPersisted(uuid, index, func(err error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.pending -= n
+		if err != nil {
+			c.lost += n
+		}
+		close(c.changed)
+		c.changed = make(chan struct{})
+	})
+}
+
+// wait blocks until all the accepted events are persisted or ctx is done,
+// and returns the number of events not persisted.
+func (c *persistCounter) wait(ctx context.Context) (int, error) {
+	for {
+		c.mu.Lock()
+		pending, lost, changed := c.pending, c.lost, c.changed
+		c.mu.Unlock()
+		if pending == 0 {
+			return lost, nil
+		}
+		select {
+		case <-ctx.Done():
+			return pending + lost, ctx.Err()
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func runTracker(t *testing.T, c *client.Client) *AckTracker {
+	tracker := NewAckTracker()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		_ = tracker.Run(ctx, c, time.Millisecond)
+	}()
+	return tracker
+}
+
+func TestAsyncPublisherShutdown(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{UUID: "shipper"})
+	tracker := runTracker(t, c)
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{AckTracker: tracker})
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, p.Publish(context.Background(), testEvent(fmt.Sprint(i)), nil))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report, err := p.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, ShutdownReport{Unpersisted: 5}, report)
+
+	srv.PersistAll()
+	report, err = p.Shutdown(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, ShutdownReport{}, report)
+}
+
+func TestAsyncPublisherShutdownAbandoned(t *testing.T) {
+	client := newBlockingClient()
+	p := NewAsyncPublisher(client, AsyncPublisherConfig{QueueSize: 10})
+	recorder := &ackRecorder{}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Publish(context.Background(), testEvent(fmt.Sprint(i)), recorder.onAck))
+	}
+	<-client.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	report, err := p.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, ShutdownReport{Abandoned: 3}, report)
+	for _, ack := range recorder.get() {
+		require.Error(t, ack.Err)
+	}
+}
+
+func TestBatcherShutdown(t *testing.T) {
+	srv, c := newTestServer(t, servertest.Options{UUID: "shipper"})
+	tracker := runTracker(t, c)
+	b := NewBatcher(c, BatcherConfig{AckTracker: tracker})
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, b.Add(context.Background(), testEvent(fmt.Sprint(i)), nil))
+	}
+	go func() {
+		// persist once the pending events are published by Close
+		for len(srv.Events()) < 4 {
+			time.Sleep(time.Millisecond)
+		}
+		srv.PersistAll()
+	}()
+
+	report, err := b.Shutdown(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, ShutdownReport{}, report)
+	require.ErrorIs(t, b.Add(context.Background(), testEvent("late"), nil), ErrClosed)
+}
@@ -0,0 +1,247 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package publisher contains the building blocks used to publish events
+// to the shipper asynchronously.
+package publisher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// SlowConsumerStats describes the rates observed by a SlowConsumerDetector.
+type SlowConsumerStats struct {
+	// IngestRate is the number of events per second entering the queue.
+	IngestRate float64
+	// DrainRate is the number of events per second acknowledged by the shipper.
+	DrainRate float64
+	// QueueGrowth is the difference between IngestRate and DrainRate.
+	QueueGrowth float64
+	// AckLatency is the smoothed time between enqueueing an event and its
+	// acknowledgment. The AsyncPublisher reports it when the shipper replies,
+	// for the oldest event of each batch: its events are accepted in the
+	// shipper queue, but not persisted yet.
+	AckLatency time.Duration
+	// Backlog is the number of events ingested and not drained yet.
+	Backlog uint64
+	// Slow is true while the shipper is considered a slow consumer.
+	Slow bool
+	// Since is when the shipper stopped keeping up: the drain rate fell
+	// below the ingest rate, or nothing was drained from the backlog.
+	// It is zero when the shipper keeps up.
+	Since time.Time
+}
+
+// SlowConsumerConfig configures a SlowConsumerDetector.
+type SlowConsumerConfig struct {
+	// Threshold is how long the shipper must not keep up before OnSlow is
+	// called.
+	Threshold time.Duration
+	// Interval is how often rates are sampled by Run.
+	Interval time.Duration
+	// OnSlow is called once when the shipper becomes a slow consumer.
+	OnSlow func(SlowConsumerStats)
+	// RecoveryWindow is how long the shipper must keep up with the ingest
+	// rate, or have drained the backlog, before OnRecovered is called.
+	// Defaults to Threshold.
+	RecoveryWindow time.Duration
+	// OnRecovered is called once when the drain rate catches up again.
+	OnRecovered func(SlowConsumerStats)
+	// Registry, if set, receives the detector metrics.
+	Registry *monitoring.Registry
+}
+
+// DefaultSlowConsumerConfig returns the default detector configuration.
+func DefaultSlowConsumerConfig() SlowConsumerConfig {
+	return SlowConsumerConfig{
+		Threshold: 30 * time.Second,
+		Interval:  time.Second,
+	}
+}
+
+type slowConsumerMetrics struct {
+	slow       *monitoring.Bool
+	events     *monitoring.Uint
+	ingestRate *monitoring.Float
+	drainRate  *monitoring.Float
+	ackLatency *monitoring.Int
+}
+
+// SlowConsumerDetector tracks ingestion and acknowledgment rates and reports
+// when the shipper sustains a drain rate below the ingestion rate.
+// It is safe for concurrent use.
+type SlowConsumerDetector struct {
+	config  SlowConsumerConfig
+	metrics *slowConsumerMetrics
+
+	mu         sync.Mutex
+	ingested   uint64
+	drained    uint64
+	latency    time.Duration
+	backlog    uint64
+	lastSample time.Time
+	stats      SlowConsumerStats
+	// recovering is when a slow consumer started keeping up again
+	recovering time.Time
+}
+
+// NewSlowConsumerDetector returns a new detector using the given configuration.
+func NewSlowConsumerDetector(config SlowConsumerConfig) *SlowConsumerDetector {
+	defaults := DefaultSlowConsumerConfig()
+	if config.Threshold <= 0 {
+		config.Threshold = defaults.Threshold
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.RecoveryWindow <= 0 {
+		config.RecoveryWindow = config.Threshold
+	}
+
+	d := &SlowConsumerDetector{config: config}
+	if config.Registry != nil {
+		d.metrics = &slowConsumerMetrics{
+			slow:       monitoring.NewBool(config.Registry, "slow_consumer.active"),
+			events:     monitoring.NewUint(config.Registry, "slow_consumer.events"),
+			ingestRate: monitoring.NewFloat(config.Registry, "slow_consumer.ingest_rate"),
+			drainRate:  monitoring.NewFloat(config.Registry, "slow_consumer.drain_rate"),
+			ackLatency: monitoring.NewInt(config.Registry, "slow_consumer.ack_latency_ms"),
+		}
+	}
+	return d
+}
+
+// Ingested records that n events entered the queue.
+func (d *SlowConsumerDetector) Ingested(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ingested += uint64(n)
+	d.backlog += uint64(n)
+}
+
+// Drained records that n events were acknowledged, latency after they
+// entered the queue.
+func (d *SlowConsumerDetector) Drained(n int, latency time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.drained += uint64(n)
+	if uint64(n) > d.backlog {
+		d.backlog = 0
+	} else {
+		d.backlog -= uint64(n)
+	}
+	if d.latency == 0 {
+		d.latency = latency
+	} else {
+		d.latency += (latency - d.latency) / 5
+	}
+}
+
+// Discarded records that n events left the queue without being
+// acknowledged, like the failed or dropped ones. They leave the backlog
+// without counting in the drain rate.
+func (d *SlowConsumerDetector) Discarded(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if uint64(n) > d.backlog {
+		d.backlog = 0
+	} else {
+		d.backlog -= uint64(n)
+	}
+}
+
+// Stats returns the stats computed by the last sample.
+func (d *SlowConsumerDetector) Stats() SlowConsumerStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+// Run samples the rates every Interval until ctx is done.
+func (d *SlowConsumerDetector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.Sample(now)
+		}
+	}
+}
+
+// Sample computes the rates since the previous sample and invokes the
+// configured callbacks if the slow consumer state changed.
+func (d *SlowConsumerDetector) Sample(now time.Time) {
+	d.mu.Lock()
+	if d.lastSample.IsZero() {
+		d.lastSample = now
+		d.ingested, d.drained = 0, 0
+		d.mu.Unlock()
+		return
+	}
+	elapsed := now.Sub(d.lastSample).Seconds()
+	if elapsed <= 0 {
+		d.mu.Unlock()
+		return
+	}
+
+	stats := d.stats
+	stats.IngestRate = float64(d.ingested) / elapsed
+	stats.DrainRate = float64(d.drained) / elapsed
+	stats.QueueGrowth = stats.IngestRate - stats.DrainRate
+	stats.AckLatency = d.latency
+	stats.Backlog = d.backlog
+	d.ingested, d.drained = 0, 0
+	d.lastSample = now
+
+	// without ingest, a shipper that drains nothing isn't keeping up
+	// until the backlog is empty
+	keepingUp := stats.Backlog == 0 || (stats.QueueGrowth <= 0 && stats.DrainRate > 0)
+	var callback func(SlowConsumerStats)
+	switch {
+	case !keepingUp:
+		d.recovering = time.Time{}
+		if stats.Since.IsZero() {
+			stats.Since = now
+		}
+		if !stats.Slow && now.Sub(stats.Since) >= d.config.Threshold {
+			stats.Slow = true
+			callback = d.config.OnSlow
+			if d.metrics != nil {
+				d.metrics.events.Inc()
+			}
+		}
+	case stats.Slow:
+		if d.recovering.IsZero() {
+			d.recovering = now
+		}
+		if stats.Backlog == 0 || now.Sub(d.recovering) >= d.config.RecoveryWindow {
+			stats.Slow = false
+			stats.Since = time.Time{}
+			d.recovering = time.Time{}
+			callback = d.config.OnRecovered
+		}
+	default:
+		stats.Since = time.Time{}
+	}
+	d.stats = stats
+
+	if d.metrics != nil {
+		d.metrics.slow.Set(stats.Slow)
+		d.metrics.ingestRate.Set(stats.IngestRate)
+		d.metrics.drainRate.Set(stats.DrainRate)
+		d.metrics.ackLatency.Set(stats.AckLatency.Milliseconds())
+	}
+	d.mu.Unlock()
+
+	if callback != nil {
+		callback(stats)
+	}
+}
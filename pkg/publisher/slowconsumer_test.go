@@ -0,0 +1,92 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestSlowConsumerDetector(t *testing.T) {
+	var slow, recovered []SlowConsumerStats
+	registry := monitoring.NewRegistry()
+	detector := NewSlowConsumerDetector(SlowConsumerConfig{
+		Threshold:   2 * time.Second,
+		OnSlow:      func(s SlowConsumerStats) { slow = append(slow, s) },
+		OnRecovered: func(s SlowConsumerStats) { recovered = append(recovered, s) },
+		Registry:    registry,
+	})
+
+	start := time.Now()
+	detector.Sample(start)
+
+	// the queue grows for three seconds, the callback fires once the threshold is reached
+	for i := 1; i <= 3; i++ {
+		detector.Ingested(100)
+		detector.Drained(50, 200*time.Millisecond)
+		detector.Sample(start.Add(time.Duration(i) * time.Second))
+	}
+	require.Len(t, slow, 1)
+	require.True(t, slow[0].Slow)
+	require.Equal(t, float64(100), slow[0].IngestRate)
+	require.Equal(t, float64(50), slow[0].DrainRate)
+	require.Equal(t, 200*time.Millisecond, slow[0].AckLatency)
+	require.Empty(t, recovered)
+
+	snapshot := monitoring.CollectFlatSnapshot(registry, monitoring.Full, false)
+	require.Equal(t, true, snapshot.Bools["slow_consumer.active"])
+	require.Equal(t, int64(1), snapshot.Ints["slow_consumer.events"])
+
+	// the shipper catches up, it must be sustained for the recovery window
+	for i := 4; i <= 5; i++ {
+		detector.Ingested(10)
+		detector.Drained(40, 100*time.Millisecond)
+		detector.Sample(start.Add(time.Duration(i) * time.Second))
+		require.Empty(t, recovered)
+	}
+	detector.Ingested(10)
+	detector.Drained(40, 100*time.Millisecond)
+	detector.Sample(start.Add(6 * time.Second))
+	require.Len(t, recovered, 1)
+	require.EqualValues(t, 60, recovered[0].Backlog)
+	require.False(t, recovered[0].Slow)
+	require.False(t, detector.Stats().Slow)
+	require.True(t, detector.Stats().Since.IsZero())
+}
+
+func TestSlowConsumerDetectorBacklog(t *testing.T) {
+	var slow, recovered int
+	detector := NewSlowConsumerDetector(SlowConsumerConfig{
+		Threshold:   2 * time.Second,
+		OnSlow:      func(SlowConsumerStats) { slow++ },
+		OnRecovered: func(SlowConsumerStats) { recovered++ },
+	})
+	start := time.Now()
+	detector.Sample(start)
+	detector.Ingested(100)
+	detector.Sample(start.Add(time.Second))
+
+	// nothing is ingested, but the backlog isn't drained either
+	for i := 2; i <= 4; i++ {
+		detector.Sample(start.Add(time.Duration(i) * time.Second))
+	}
+	require.Equal(t, 1, slow)
+	require.Zero(t, recovered)
+
+	// draining the backlog is a recovery right away
+	detector.Drained(100, time.Second)
+	detector.Sample(start.Add(5 * time.Second))
+	require.Equal(t, 1, recovered)
+	require.Zero(t, detector.Stats().Backlog)
+
+	// an idle detector stays healthy
+	detector.Sample(start.Add(10 * time.Second))
+	require.Equal(t, 1, slow)
+	require.False(t, detector.Stats().Slow)
+}
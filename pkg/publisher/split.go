@@ -0,0 +1,205 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrEventTooLarge is returned when a single event doesn't fit the max
+// message size, it can't be published however the request is split. It
+// matches helpers.ErrTooLarge.
+var ErrEventTooLarge = newKindError("event is larger than the max message size", helpers.ErrTooLarge)
+
+// EventTooLargeError describes an event larger than the max message size.
+type EventTooLargeError struct {
+	// Index is the position of the event in the request.
+	Index int
+	// Size is the size the event adds to a request, Max the size limit.
+	Size int
+	Max  int
+}
+
+func (e *EventTooLargeError) Error() string {
+	return fmt.Sprintf("%s: event %d takes %d bytes, the limit is %d", ErrEventTooLarge, e.Index, e.Size, e.Max)
+}
+
+// Is makes EventTooLargeError match ErrEventTooLarge and helpers.ErrTooLarge.
+func (e *EventTooLargeError) Is(target error) bool {
+	return target == ErrEventTooLarge || target == helpers.ErrTooLarge
+}
+
+// requestOverhead is the size of a PublishRequest without events.
+func requestOverhead(uuid string) int {
+	if uuid == "" {
+		return 0
+	}
+	return protowire.SizeTag(1) + protowire.SizeBytes(len(uuid))
+}
+
+// SplitRequest splits req into requests with the same UUID whose marshaled
+// size doesn't exceed maxBytes, keeping the order of the events. It returns
+// req itself when it fits, and an EventTooLargeError when an event alone
+// doesn't fit.
+func SplitRequest(req *messages.PublishRequest, maxBytes int) ([]*messages.PublishRequest, error) {
+	overhead := requestOverhead(req.GetUuid())
+	var parts []*messages.PublishRequest
+	var events []*messages.Event
+	size := overhead
+	for i, e := range req.GetEvents() {
+		eSize := eventSize(e)
+		if overhead+eSize > maxBytes {
+			return nil, &EventTooLargeError{Index: i, Size: eSize, Max: maxBytes}
+		}
+		if size+eSize > maxBytes {
+			parts = append(parts, &messages.PublishRequest{Uuid: req.GetUuid(), Events: events})
+			events, size = nil, overhead
+		}
+		events = append(events, e)
+		size += eSize
+	}
+	if len(parts) == 0 {
+		return []*messages.PublishRequest{req}, nil
+	}
+	return append(parts, &messages.PublishRequest{Uuid: req.GetUuid(), Events: events}), nil
+}
+
+// messageLimitPattern matches the errors of gRPC for messages above the max
+// send or receive size, also after decompression.
+var messageLimitPattern = regexp.MustCompile(`larger than max \((\d+) vs\. (\d+)\)`)
+
+// messageLimit returns the limit reported by a gRPC error for a message
+// above the max size, ok is false for other errors. The limit is zero when
+// the error doesn't report it.
+func messageLimit(err error) (limit int, ok bool) {
+	st, isStatus := status.FromError(err)
+	if !isStatus || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+	// the shipper also returns ResourceExhausted when its queue is full
+	match := messageLimitPattern.FindStringSubmatch(st.Message())
+	if match == nil {
+		return 0, false
+	}
+	limit, _ = strconv.Atoi(match[2])
+	return limit, true
+}
+
+// Splitter is a Client splitting the requests above the max message size of
+// the shipper into smaller ones. The limit starts from the configured value
+// and is lowered when the shipper or gRPC reject a request as too large, so
+// it doesn't need to match the server configuration exactly.
+//
+// gRPC checks the received size after decompression, so the limit applies
+// to the marshaled requests whatever the compression. It is safe for
+// concurrent use.
+type Splitter struct {
+	client Client
+
+	mu       sync.Mutex
+	maxBytes int
+}
+
+// NewSplitter returns a Splitter publishing through client, with an initial
+// limit of maxBytes. Zero uses the default max gRPC message size.
+func NewSplitter(client Client, maxBytes int) *Splitter {
+	if maxBytes <= 0 {
+		maxBytes = DefaultBatcherConfig().MaxBytes
+	}
+	return &Splitter{client: client, maxBytes: maxBytes}
+}
+
+// MaxBytes returns the current limit.
+func (s *Splitter) MaxBytes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxBytes
+}
+
+// lower lowers the limit after part was rejected as too large, reported is
+// the limit from the error if any. It returns the new limit.
+func (s *Splitter) lower(part *messages.PublishRequest, reported int) int {
+	limit := reported
+	if limit <= 0 || limit >= proto.Size(part) {
+		limit = proto.Size(part) / 2
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit < s.maxBytes {
+		s.maxBytes = limit
+	}
+	return s.maxBytes
+}
+
+// Publish publishes the events of req in as many requests as needed. The
+// requests are sent in order and stop at the first one not fully accepted,
+// the reply then accepts the events published so far, like a partial reply
+// of the shipper.
+//
+// It fails with an EventTooLargeError without publishing anything when an
+// event doesn't fit the limit. When some events were already accepted, it
+// returns their reply instead, and the error is returned by the next
+// request holding the event.
+func (s *Splitter) Publish(ctx context.Context, req *messages.PublishRequest, opts ...grpc.CallOption) (*messages.PublishReply, error) {
+	limit := s.MaxBytes()
+	parts, err := SplitRequest(req, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged *messages.PublishReply
+	accepted := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		var reply *messages.PublishReply
+		reply, err = s.client.Publish(ctx, part, opts...)
+		if reported, tooLarge := messageLimit(err); tooLarge {
+			limit = s.lower(part, reported)
+			remaining := &messages.PublishRequest{Uuid: req.GetUuid(), Events: req.GetEvents()[accepted:]}
+			if parts, err = SplitRequest(remaining, limit); err != nil {
+				if tooLargeErr := (*EventTooLargeError)(nil); errors.As(err, &tooLargeErr) {
+					tooLargeErr.Index += accepted
+				}
+				break
+			}
+			continue
+		}
+		if err != nil {
+			break
+		}
+
+		if merged == nil {
+			merged = &messages.PublishReply{}
+		}
+		merged.Uuid = reply.GetUuid()
+		if reply.GetAcceptedCount() > 0 {
+			merged.AcceptedCount += reply.GetAcceptedCount()
+			merged.AcceptedIndex = reply.GetAcceptedIndex()
+		}
+		accepted += int(reply.GetAcceptedCount())
+		if int(reply.GetAcceptedCount()) < len(part.GetEvents()) {
+			return merged, nil
+		}
+		parts = parts[1:]
+	}
+	if err != nil && accepted == 0 {
+		return nil, err
+	}
+	return merged, nil
+}
@@ -0,0 +1,181 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func TestSplitRequest(t *testing.T) {
+	event := testEvent("test")
+	size := eventSize(event)
+	overhead := requestOverhead("shipper")
+
+	cases := []struct {
+		name     string
+		events   int
+		maxBytes int
+		parts    []int
+	}{
+		{name: "fits", events: 3, maxBytes: overhead + 3*size, parts: []int{3}},
+		{name: "split", events: 5, maxBytes: overhead + 2*size, parts: []int{2, 2, 1}},
+		{name: "one per request", events: 2, maxBytes: overhead + size, parts: []int{1, 1}},
+		{name: "empty", events: 0, maxBytes: overhead, parts: []int{0}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &messages.PublishRequest{Uuid: "shipper"}
+			for i := 0; i < tc.events; i++ {
+				req.Events = append(req.Events, event)
+			}
+			parts, err := SplitRequest(req, tc.maxBytes)
+			require.NoError(t, err)
+
+			var got []int
+			for _, part := range parts {
+				require.Equal(t, "shipper", part.GetUuid())
+				require.LessOrEqual(t, proto.Size(part), tc.maxBytes)
+				got = append(got, len(part.GetEvents()))
+			}
+			require.Equal(t, tc.parts, got)
+		})
+	}
+}
+
+func TestSplitRequestEventTooLarge(t *testing.T) {
+	large := testEvent(strings.Repeat("x", 100))
+	req := &messages.PublishRequest{Events: []*messages.Event{testEvent("a"), large}}
+
+	_, err := SplitRequest(req, 50)
+	require.ErrorIs(t, err, ErrEventTooLarge)
+	require.ErrorIs(t, err, helpers.ErrTooLarge)
+	var tooLarge *EventTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	require.Equal(t, &EventTooLargeError{Index: 1, Size: eventSize(large), Max: 50}, tooLarge)
+}
+
+func TestMessageLimit(t *testing.T) {
+	cases := []struct {
+		name  string
+		err   error
+		limit int
+		ok    bool
+	}{
+		{
+			name:  "received",
+			err:   status.Error(codes.ResourceExhausted, "grpc: received message larger than max (2000 vs. 1024)"),
+			limit: 1024,
+			ok:    true,
+		},
+		{
+			name:  "sent",
+			err:   status.Error(codes.ResourceExhausted, "grpc: trying to send message larger than max (2000 vs. 512)"),
+			limit: 512,
+			ok:    true,
+		},
+		{name: "queue full", err: status.Error(codes.ResourceExhausted, "queue is full")},
+		{name: "other code", err: status.Error(codes.Internal, "larger than max (2000 vs. 512)")},
+		{name: "no error"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			limit, ok := messageLimit(tc.err)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.limit, limit)
+		})
+	}
+}
+
+func TestSplitterMaxRecvMsgSize(t *testing.T) {
+	const maxRecv = 1024
+	srv, client := newTestServer(t, servertest.Options{
+		UUID:          "shipper",
+		ServerOptions: []grpc.ServerOption{grpc.MaxRecvMsgSize(maxRecv)},
+	})
+	splitter := NewSplitter(client, 0)
+
+	req := &messages.PublishRequest{Uuid: "shipper"}
+	for i := 0; i < 50; i++ {
+		req.Events = append(req.Events, testEvent("test"))
+	}
+	require.Greater(t, proto.Size(req), maxRecv)
+
+	reply, err := splitter.Publish(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, uint32(50), reply.GetAcceptedCount())
+	require.Equal(t, uint64(50), reply.GetAcceptedIndex())
+	require.Equal(t, "shipper", reply.GetUuid())
+	require.Equal(t, maxRecv, splitter.MaxBytes())
+	require.Len(t, srv.Events(), 50)
+	require.Greater(t, len(srv.Requests()), 1)
+
+	// the learned limit is used right away
+	before := len(srv.Requests())
+	_, err = splitter.Publish(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, srv.Requests(), before+len(mustSplit(t, req, maxRecv)))
+}
+
+func mustSplit(t *testing.T, req *messages.PublishRequest, maxBytes int) []*messages.PublishRequest {
+	parts, err := SplitRequest(req, maxBytes)
+	require.NoError(t, err)
+	return parts
+}
+
+func TestSplitterPartialReply(t *testing.T) {
+	srv, client := newTestServer(t, servertest.Options{UUID: "shipper"})
+	srv.SetAcceptLimit(1)
+	event := testEvent("test")
+	splitter := NewSplitter(client, requestOverhead("shipper")+2*eventSize(event))
+
+	req := &messages.PublishRequest{Uuid: "shipper", Events: []*messages.Event{event, event, event, event, event}}
+	reply, err := splitter.Publish(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), reply.GetAcceptedCount(), "stops at the first partial reply")
+	require.Equal(t, uint64(1), reply.GetAcceptedIndex())
+	require.Len(t, srv.Requests(), 1)
+
+	srv.SetAcceptLimit(0)
+	reply, err = splitter.Publish(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, uint32(5), reply.GetAcceptedCount())
+	require.Equal(t, uint64(6), reply.GetAcceptedIndex())
+	require.Len(t, srv.Requests(), 4)
+}
+
+func TestSplitterEventTooLarge(t *testing.T) {
+	srv, client := newTestServer(t, servertest.Options{
+		UUID:          "shipper",
+		ServerOptions: []grpc.ServerOption{grpc.MaxRecvMsgSize(200)},
+	})
+	splitter := NewSplitter(client, 0)
+	large := testEvent(strings.Repeat("x", 300))
+
+	// the limit is learned from the rejected request
+	req := &messages.PublishRequest{Uuid: "shipper", Events: []*messages.Event{testEvent("a"), large}}
+	_, err := splitter.Publish(context.Background(), req)
+	var tooLarge *EventTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	require.Equal(t, 1, tooLarge.Index)
+	require.Equal(t, 200, splitter.MaxBytes())
+
+	// known limit: nothing is published
+	_, err = splitter.Publish(context.Background(), &messages.PublishRequest{Uuid: "shipper", Events: []*messages.Event{large}})
+	require.ErrorIs(t, err, ErrEventTooLarge)
+	require.Empty(t, srv.Requests())
+}
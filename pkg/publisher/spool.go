@@ -0,0 +1,392 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// ErrSpoolFull is returned when an event doesn't fit in the disk usage limit
+// of the spool. It matches helpers.ErrQueueFull.
+var ErrSpoolFull = newKindError("disk spool is full", helpers.ErrQueueFull)
+
+const (
+	segmentExt = ".seg"
+	// recordHeaderSize is the length and CRC32 of a record.
+	recordHeaderSize = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// DiskSpoolConfig configures a DiskSpool.
+type DiskSpoolConfig struct {
+	// MaxBytes is the maximum disk usage of the spool.
+	MaxBytes int64
+	// SegmentBytes is the size after which a new segment file is started.
+	// Segments are deleted once all their events are acknowledged, smaller
+	// segments release the disk space sooner and replay fewer duplicates.
+	SegmentBytes int64
+	// Sync flushes every event to stable storage before Publish returns, so
+	// events also survive a crash of the host, at the cost of throughput.
+	Sync bool
+}
+
+// DefaultDiskSpoolConfig returns the default configuration.
+func DefaultDiskSpoolConfig() DiskSpoolConfig {
+	return DiskSpoolConfig{
+		MaxBytes:     100 << 20,
+		SegmentBytes: 1 << 20,
+	}
+}
+
+// spooledEvent is an event read back from the spool.
+type spooledEvent struct {
+	event   *messages.Event
+	segment uint64
+}
+
+type segment struct {
+	id   uint64
+	size int64
+	// pending counts the events written but not acknowledged yet
+	pending int
+}
+
+// DiskSpool persists the events queued by an AsyncPublisher in segment
+// files, so the events that were not acknowledged when the process stopped
+// are published again by the next AsyncPublisher using the same directory.
+//
+// Each record is checksummed. When the spool is opened, the records of a
+// segment are read up to the first one that is truncated or corrupted, the
+// rest of the segment is lost. The events of a segment are replayed until
+// they are all acknowledged, so delivery is at least once.
+type DiskSpool struct {
+	dir    string
+	config DiskSpoolConfig
+
+	mu        sync.Mutex
+	segments  []*segment // oldest first, the last one is being written
+	active    *os.File
+	writer    *bufio.Writer
+	size      int64
+	replay    []spooledEvent
+	corrupted int
+	closed    bool
+}
+
+// OpenDiskSpool opens the spool in dir, creating the directory if needed,
+// and loads the events left by a previous process. Zero values in config
+// are replaced by their defaults. The spool must be closed once the
+// publisher using it is closed.
+func OpenDiskSpool(dir string, config DiskSpoolConfig) (*DiskSpool, error) {
+	defaults := DefaultDiskSpoolConfig()
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaults.MaxBytes
+	}
+	if config.SegmentBytes <= 0 {
+		config.SegmentBytes = defaults.SegmentBytes
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &DiskSpool{dir: dir, config: config}
+	ids, err := s.segmentIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := s.load(id); err != nil {
+			return nil, err
+		}
+	}
+	var next uint64
+	if len(ids) > 0 {
+		next = ids[len(ids)-1] + 1
+	}
+	// never append after a possibly corrupted tail
+	if err := s.startSegment(next); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *DiskSpool) segmentIDs() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (s *DiskSpool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// load reads the valid records of a segment left by a previous process.
+func (s *DiskSpool) load(id uint64) error {
+	f, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment: %w", err)
+	}
+
+	seg := &segment{id: id, size: info.Size()}
+	r := bufio.NewReader(f)
+	for remaining := seg.size; ; {
+		e, size, err := readRecord(r, remaining)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			s.corrupted++
+			break
+		}
+		remaining -= size
+		s.replay = append(s.replay, spooledEvent{event: e, segment: id})
+		seg.pending++
+	}
+	if seg.pending == 0 {
+		return os.Remove(s.segmentPath(id))
+	}
+	s.segments = append(s.segments, seg)
+	s.size += seg.size
+	return nil
+}
+
+// readRecord returns the next event and the size of its record, remaining
+// is the number of bytes left in the segment. It returns io.EOF at the end
+// of a segment, and an error for a truncated or corrupted record.
+func readRecord(r *bufio.Reader, remaining int64) (*messages.Event, int64, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, fmt.Errorf("truncated record header: %w", err)
+	}
+	size := int64(binary.LittleEndian.Uint32(header[:4]))
+	// check the length before allocating, it's not covered by the checksum
+	if size > remaining-recordHeaderSize {
+		return nil, 0, fmt.Errorf("record length %d exceeds the segment", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, fmt.Errorf("truncated record: %w", err)
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, 0, errors.New("record checksum mismatch")
+	}
+	e := &messages.Event{}
+	if err := proto.Unmarshal(payload, e); err != nil {
+		return nil, 0, fmt.Errorf("invalid record: %w", err)
+	}
+	return e, recordHeaderSize + size, nil
+}
+
+func (s *DiskSpool) startSegment(id uint64) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+	s.active = f
+	s.writer = bufio.NewWriter(f)
+	s.segments = append(s.segments, &segment{id: id})
+	return nil
+}
+
+// takeReplay returns the events loaded when the spool was opened, only once.
+func (s *DiskSpool) takeReplay() []spooledEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replay := s.replay
+	s.replay = nil
+	return replay
+}
+
+// append writes the event and returns the segment holding it.
+func (s *DiskSpool) append(e *messages.Event) (uint64, error) {
+	payload, err := proto.Marshal(e)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	size := int64(recordHeaderSize + len(payload))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	if s.size+size > s.config.MaxBytes {
+		return 0, ErrSpoolFull
+	}
+	active := s.segments[len(s.segments)-1]
+	if active.size > 0 && active.size+size > s.config.SegmentBytes {
+		if err := s.rotateLocked(); err != nil {
+			return 0, err
+		}
+		active = s.segments[len(s.segments)-1]
+	}
+
+	if err := s.writeLocked(payload); err != nil {
+		s.repairLocked(active)
+		return 0, err
+	}
+	active.size += size
+	active.pending++
+	s.size += size
+	return active.id, nil
+}
+
+func (s *DiskSpool) writeLocked(payload []byte) error {
+	var header [recordHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:], crc32.Checksum(payload, crcTable))
+	if _, err := s.writer.Write(header[:]); err != nil {
+		return fmt.Errorf("failed to write to spool: %w", err)
+	}
+	if _, err := s.writer.Write(payload); err != nil {
+		return fmt.Errorf("failed to write to spool: %w", err)
+	}
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write to spool: %w", err)
+	}
+	if s.config.Sync {
+		if err := s.active.Sync(); err != nil {
+			return fmt.Errorf("failed to sync spool: %w", err)
+		}
+	}
+	return nil
+}
+
+// repairLocked drops what a failed write left after the last complete
+// record, otherwise the next records would be lost behind a torn one when
+// the spool is opened again. If the segment can't be truncated, the next
+// records go to a new segment.
+func (s *DiskSpool) repairLocked(active *segment) {
+	s.writer.Reset(s.active)
+	if err := s.active.Truncate(active.size); err == nil {
+		if _, err := s.active.Seek(active.size, io.SeekStart); err == nil {
+			return
+		}
+	}
+	_ = s.active.Close()
+	if err := s.startSegment(active.id + 1); err != nil {
+		// the next append fails and tries again
+		return
+	}
+	if active.pending == 0 {
+		s.removeLocked(active)
+	}
+}
+
+// rotateLocked closes the active segment and starts the next one.
+func (s *DiskSpool) rotateLocked() error {
+	active := s.segments[len(s.segments)-1]
+	if err := s.active.Close(); err != nil {
+		return fmt.Errorf("failed to close spool segment: %w", err)
+	}
+	if err := s.startSegment(active.id + 1); err != nil {
+		return err
+	}
+	if active.pending == 0 {
+		s.removeLocked(active)
+	}
+	return nil
+}
+
+// ack releases an event of the segment, the segment is deleted once all its
+// events are acknowledged and it's not being written anymore.
+func (s *DiskSpool) ack(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, seg := range s.segments {
+		if seg.id != id {
+			continue
+		}
+		seg.pending--
+		if seg.pending == 0 && i < len(s.segments)-1 {
+			s.removeLocked(seg)
+		}
+		return
+	}
+}
+
+func (s *DiskSpool) removeLocked(seg *segment) {
+	// a segment that can't be removed is replayed again, which is safe
+	_ = os.Remove(s.segmentPath(seg.id))
+	s.size -= seg.size
+	for i, other := range s.segments {
+		if other == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+}
+
+// Size returns the disk usage of the spool in bytes.
+func (s *DiskSpool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Corrupted returns the number of segments found corrupted when the spool
+// was opened. Their events after the corruption were lost.
+func (s *DiskSpool) Corrupted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.corrupted
+}
+
+// Close closes the segment being written. The events that were not
+// acknowledged are replayed when the spool is opened again.
+func (s *DiskSpool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	active := s.segments[len(s.segments)-1]
+	err := s.active.Close()
+	if active.pending == 0 {
+		s.removeLocked(active)
+	}
+	return err
+}
@@ -0,0 +1,255 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+func spoolFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NoError(t, err)
+	return files
+}
+
+func TestDiskSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// the first process can't reach the shipper and gives up on close
+	spool, err := OpenDiskSpool(dir, DiskSpoolConfig{})
+	require.NoError(t, err)
+	blocked := newBlockingClient()
+	p := NewAsyncPublisher(blocked, AsyncPublisherConfig{Spool: spool})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Publish(context.Background(), testEvent(fmt.Sprint(i)), nil))
+	}
+	<-blocked.started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Close(ctx), context.DeadlineExceeded)
+	require.NoError(t, spool.Close())
+
+	// the next one publishes the events left in the spool
+	spool, err = OpenDiskSpool(dir, DiskSpoolConfig{})
+	require.NoError(t, err)
+	srv, c := newTestServer(t, servertest.Options{})
+	replayed := &ackRecorder{}
+	p = NewAsyncPublisher(c, AsyncPublisherConfig{Spool: spool, ReplayAck: replayed.onAck})
+	require.NoError(t, p.Publish(context.Background(), testEvent("new"), nil))
+	require.NoError(t, p.Close(context.Background()))
+
+	require.Len(t, replayed.get(), 3)
+	got := []string{}
+	for _, e := range srv.Events() {
+		got = append(got, e.Fields.Data["message"].GetStringValue())
+	}
+	require.Equal(t, []string{"0", "1", "2", "new"}, got)
+
+	require.NoError(t, spool.Close())
+	require.Zero(t, spool.Size())
+	require.Empty(t, spoolFiles(t, dir), "acknowledged segments are deleted")
+}
+
+func TestDiskSpoolRetriesFailedPublish(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenDiskSpool(dir, DiskSpoolConfig{})
+	require.NoError(t, err)
+	srv, c := newTestServer(t, servertest.Options{})
+	srv.SetPublishErrors(
+		status.Error(codes.Unavailable, "shipper is restarting"),
+		status.Error(codes.Unavailable, "shipper is restarting"),
+	)
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{Spool: spool, SpoolRetryInterval: time.Millisecond})
+
+	acks := &ackRecorder{}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, p.Publish(context.Background(), testEvent(fmt.Sprint(i)), acks.onAck))
+	}
+	require.NoError(t, p.Close(context.Background()))
+
+	require.Len(t, acks.get(), 2)
+	for _, ack := range acks.get() {
+		require.NoError(t, ack.Err)
+		require.True(t, ack.Accepted)
+	}
+	require.Len(t, srv.Events(), 2)
+	require.NoError(t, spool.Close())
+	require.Empty(t, spoolFiles(t, dir))
+}
+
+func TestDiskSpoolPermanentFailure(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenDiskSpool(dir, DiskSpoolConfig{})
+	require.NoError(t, err)
+	srv, c := newTestServer(t, servertest.Options{})
+	srv.SetPublishErrors(status.Error(codes.InvalidArgument, "poison event"))
+	p := NewAsyncPublisher(c, AsyncPublisherConfig{Spool: spool, MaxBatchEvents: 1, SpoolRetryInterval: time.Millisecond})
+
+	acks := &ackRecorder{}
+	require.NoError(t, p.Publish(context.Background(), testEvent("poison"), acks.onAck))
+	require.NoError(t, p.Publish(context.Background(), testEvent("next"), acks.onAck))
+	require.NoError(t, p.Close(context.Background()))
+
+	// the rejected event isn't sent again and doesn't block the next one
+	got := acks.get()
+	require.Len(t, got, 2)
+	require.ErrorIs(t, got[0].Err, helpers.ErrInvalidEvent)
+	require.NoError(t, got[1].Err)
+	require.Len(t, srv.Requests(), 2)
+	require.Len(t, srv.Events(), 1)
+	require.NoError(t, spool.Close())
+	require.Empty(t, spoolFiles(t, dir))
+}
+
+func TestDiskSpoolSegments(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenDiskSpool(dir, DiskSpoolConfig{SegmentBytes: 100})
+	require.NoError(t, err)
+	defer spool.Close()
+
+	var ids []uint64
+	segments := map[uint64]bool{}
+	for i := 0; i < 10; i++ {
+		segment, err := spool.append(testEvent(fmt.Sprint(i)))
+		require.NoError(t, err)
+		ids = append(ids, segment)
+		segments[segment] = true
+	}
+	require.Greater(t, len(segments), 2)
+	require.Len(t, spoolFiles(t, dir), len(segments))
+
+	size := spool.Size()
+	for _, id := range ids {
+		if id == ids[0] {
+			spool.ack(id)
+		}
+	}
+	require.Len(t, spoolFiles(t, dir), len(segments)-1, "the first segment is fully acknowledged")
+	require.Less(t, spool.Size(), size)
+}
+
+func TestDiskSpoolCorruption(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenDiskSpool(dir, DiskSpoolConfig{SegmentBytes: 1 << 20})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := spool.append(testEvent(fmt.Sprint(i)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, spool.Close())
+
+	files := spoolFiles(t, dir)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	// flip a byte in the last record
+	data[len(data)-2] ^= 0xff
+	require.NoError(t, os.WriteFile(files[0], data, 0o600))
+
+	spool, err = OpenDiskSpool(dir, DiskSpoolConfig{})
+	require.NoError(t, err)
+	require.Equal(t, 1, spool.Corrupted())
+	replay := spool.takeReplay()
+	require.Len(t, replay, 2)
+	require.Equal(t, "1", replay[1].event.Fields.Data["message"].GetStringValue())
+	require.NoError(t, spool.Close())
+
+	// a truncated record is handled the same way
+	require.NoError(t, os.WriteFile(files[0], data[:len(data)-5], 0o600))
+	spool, err = OpenDiskSpool(dir, DiskSpoolConfig{})
+	require.NoError(t, err)
+	require.Equal(t, 1, spool.Corrupted())
+	require.Len(t, spool.takeReplay(), 2)
+	require.NoError(t, spool.Close())
+}
+
+func TestDiskSpoolInvalidLength(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenDiskSpool(dir, DiskSpoolConfig{})
+	require.NoError(t, err)
+	_, err = spool.append(testEvent("test"))
+	require.NoError(t, err)
+	require.NoError(t, spool.Close())
+
+	files := spoolFiles(t, dir)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	// a corrupted length must not be trusted to allocate the record
+	var header [recordHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[:4], math.MaxUint32)
+	require.NoError(t, os.WriteFile(files[0], append(data, header[:]...), 0o600))
+
+	spool, err = OpenDiskSpool(dir, DiskSpoolConfig{})
+	require.NoError(t, err)
+	defer spool.Close()
+	require.Equal(t, 1, spool.Corrupted())
+	require.Len(t, spool.takeReplay(), 1)
+}
+
+func TestDiskSpoolWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := OpenDiskSpool(dir, DiskSpoolConfig{})
+	require.NoError(t, err)
+	_, err = spool.append(testEvent("0"))
+	require.NoError(t, err)
+
+	// make the next write fail, the segment can't be truncated either
+	active := spool.active
+	readOnly, err := os.Open(active.Name())
+	require.NoError(t, err)
+	spool.active = readOnly
+	spool.writer.Reset(readOnly)
+	_, err = spool.append(testEvent("lost"))
+	require.Error(t, err)
+	require.NoError(t, active.Close())
+
+	_, err = spool.append(testEvent("1"))
+	require.NoError(t, err)
+	require.NoError(t, spool.Close())
+
+	spool, err = OpenDiskSpool(dir, DiskSpoolConfig{})
+	require.NoError(t, err)
+	defer spool.Close()
+	require.Zero(t, spool.Corrupted())
+	got := []string{}
+	for _, replayed := range spool.takeReplay() {
+		got = append(got, replayed.event.Fields.Data["message"].GetStringValue())
+	}
+	require.Equal(t, []string{"0", "1"}, got)
+}
+
+func TestDiskSpoolFull(t *testing.T) {
+	spool, err := OpenDiskSpool(t.TempDir(), DiskSpoolConfig{MaxBytes: 100})
+	require.NoError(t, err)
+	defer spool.Close()
+	p := NewAsyncPublisher(newBlockingClient(), AsyncPublisherConfig{Spool: spool})
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		_ = p.Close(ctx)
+	}()
+
+	var publishErr error
+	for i := 0; i < 10 && publishErr == nil; i++ {
+		publishErr = p.Publish(context.Background(), testEvent(fmt.Sprint(i)), nil)
+	}
+	require.ErrorIs(t, publishErr, ErrSpoolFull)
+	require.LessOrEqual(t, spool.Size(), int64(100))
+}
@@ -0,0 +1,145 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerConfig configures a CircuitBreaker.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// breaker. Zero disables the breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting a probe
+	// call through.
+	OpenTimeout time.Duration
+}
+
+// DefaultBreakerConfig returns the default breaker configuration: it opens
+// after 5 consecutive failures for 30s.
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+// State is the state of a CircuitBreaker.
+type State int
+
+const (
+	// Closed lets all the calls through.
+	Closed State = iota
+	// Open rejects all the calls.
+	Open
+	// HalfOpen lets a single probe call through, its result closes or opens
+	// the breaker again.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops the calls to a shipper that keeps failing, so clients
+// fail fast instead of piling up retries. It is safe for concurrent use.
+type CircuitBreaker struct {
+	config BreakerConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker returns a closed breaker.
+func NewCircuitBreaker(config BreakerConfig) *CircuitBreaker {
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = DefaultBreakerConfig().OpenTimeout
+	}
+	return &CircuitBreaker{config: config, now: time.Now}
+}
+
+// Allow returns ErrCircuitOpen if the call must not be made. Every allowed
+// call must report its result with Success, Failure or Ignore.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.stateLocked() {
+	case Open:
+		return ErrCircuitOpen
+	case HalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Success reports a successful call, it closes the breaker.
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = Closed
+	b.failures = 0
+	b.probing = false
+}
+
+// Ignore reports a call whose result says nothing about the shipper, like a
+// canceled one. The state is unchanged, another call can probe a half-open
+// breaker.
+func (b *CircuitBreaker) Ignore() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Failure reports a failed call, it opens the breaker after too many
+// consecutive failures or a failed probe.
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.config.FailureThreshold <= 0 {
+		return
+	}
+	b.failures++
+	if b.stateLocked() == HalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state = Open
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stateLocked()
+}
+
+// stateLocked moves an open breaker to half-open once the timeout expires.
+func (b *CircuitBreaker) stateLocked() State {
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.state = HalfOpen
+	}
+	return b.state
+}
@@ -0,0 +1,51 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package retry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Second})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	require.NoError(t, b.Allow())
+	b.Failure()
+	require.Equal(t, Closed, b.State())
+	b.Success()
+	b.Failure()
+	require.Equal(t, Closed, b.State(), "a success resets the consecutive failures")
+	b.Failure()
+	require.Equal(t, Open, b.State())
+	require.ErrorIs(t, b.Allow(), ErrCircuitOpen)
+
+	now = now.Add(time.Second)
+	require.Equal(t, HalfOpen, b.State())
+	require.NoError(t, b.Allow())
+	require.ErrorIs(t, b.Allow(), ErrCircuitOpen, "a single probe is let through")
+	b.Success()
+	require.Equal(t, Closed, b.State())
+	require.NoError(t, b.Allow())
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := NewCircuitBreaker(BreakerConfig{})
+	for i := 0; i < 100; i++ {
+		require.NoError(t, b.Allow())
+		b.Failure()
+	}
+	require.Equal(t, Closed, b.State())
+}
+
+func TestStateString(t *testing.T) {
+	require.Equal(t, "closed", Closed.String())
+	require.Equal(t, "open", Open.String())
+	require.Equal(t, "half-open", HalfOpen.String())
+}
@@ -0,0 +1,198 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package retry retries calls to the shipper that fail with transient gRPC
+// errors, with jittered exponential backoff and a circuit breaker that stops
+// calling a shipper that keeps failing.
+//
+// client.Client retries the publishes failing with Unavailable on its own, a
+// Retrier set in client.Options replaces that policy when other codes must
+// be retried or a circuit breaker is needed.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryConfig configures a Retrier.
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts of a call, including the first
+	// one. Zero retries until the context is done.
+	MaxAttempts int
+	// InitialBackoff is the wait time after the first failure.
+	InitialBackoff time.Duration
+	// MaxBackoff is the upper bound of the wait time.
+	MaxBackoff time.Duration
+	// Multiplier grows the wait time after every failure.
+	Multiplier float64
+	// Jitter randomizes the wait time by up to this fraction, in either
+	// direction, so clients don't retry in lockstep. Between 0 and 1.
+	Jitter float64
+	// RetryableCodes are the transient gRPC codes that are retried, any other
+	// error is permanent and returned right away.
+	RetryableCodes []codes.Code
+	// Breaker configures the circuit breaker.
+	Breaker BreakerConfig
+}
+
+// DefaultRetryConfig returns the default retry configuration: up to 5
+// attempts, waiting from 100ms up to 10s, for the Unavailable and
+// ResourceExhausted codes.
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableCodes: []codes.Code{codes.Unavailable, codes.ResourceExhausted},
+		Breaker:        DefaultBreakerConfig(),
+	}
+}
+
+// Class is the classification of an error returned by the shipper.
+type Class int
+
+const (
+	// Permanent errors fail the same way when retried, like InvalidArgument.
+	Permanent Class = iota
+	// Transient errors may succeed when retried, like Unavailable.
+	Transient
+	// Canceled errors come from the caller giving up, like a done context,
+	// they are not retried and say nothing about the shipper.
+	Canceled
+)
+
+// Retrier retries calls according to its configuration. It is safe for
+// concurrent use, all the calls share the circuit breaker.
+type Retrier struct {
+	config    RetryConfig
+	retryable map[codes.Code]bool
+	breaker   *CircuitBreaker
+}
+
+// New returns a Retrier with the given configuration, start from
+// DefaultRetryConfig to change it. The unset backoff fields and retryable
+// codes take their default value, a negative MaxAttempts disables retries.
+func New(config RetryConfig) *Retrier {
+	defaults := DefaultRetryConfig()
+	if config.MaxAttempts < 0 {
+		config.MaxAttempts = 1
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = defaults.InitialBackoff
+	}
+	if config.MaxBackoff < config.InitialBackoff {
+		config.MaxBackoff = config.InitialBackoff
+	}
+	if config.Multiplier < 1 {
+		config.Multiplier = defaults.Multiplier
+	}
+	if config.Jitter < 0 || config.Jitter > 1 {
+		config.Jitter = defaults.Jitter
+	}
+	if config.RetryableCodes == nil {
+		config.RetryableCodes = defaults.RetryableCodes
+	}
+
+	retryable := make(map[codes.Code]bool, len(config.RetryableCodes))
+	for _, code := range config.RetryableCodes {
+		retryable[code] = true
+	}
+	return &Retrier{
+		config:    config,
+		retryable: retryable,
+		breaker:   NewCircuitBreaker(config.Breaker),
+	}
+}
+
+// Classify returns the class of err according to the retryable codes.
+func (r *Retrier) Classify(err error) Class {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		status.Code(err) == codes.Canceled {
+		return Canceled
+	}
+	if s, ok := status.FromError(err); ok && r.retryable[s.Code()] {
+		return Transient
+	}
+	return Permanent
+}
+
+// report tells the circuit breaker about the outcome of a failed call.
+func (r *Retrier) report(err error, class Class) {
+	_, isStatus := status.FromError(err)
+	switch {
+	case class == Transient || status.Code(err) == codes.DeadlineExceeded:
+		// a shipper that doesn't reply in time is failing too
+		r.breaker.Failure()
+	case class == Canceled || !isStatus:
+		// not a reply of the shipper
+		r.breaker.Ignore()
+	default:
+		// the shipper is up, it rejected the call
+		r.breaker.Success()
+	}
+}
+
+// Breaker returns the circuit breaker of the retrier.
+func (r *Retrier) Breaker() *CircuitBreaker {
+	return r.breaker
+}
+
+// Do calls fn until it succeeds, fails with a permanent error, the attempts
+// are exhausted or ctx is done. It fails with ErrCircuitOpen without calling
+// fn while the circuit breaker is open.
+func (r *Retrier) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	var last error
+	for attempt := 1; ; attempt++ {
+		if err := r.breaker.Allow(); err != nil {
+			if last != nil {
+				return fmt.Errorf("%w after %d attempts: %v", err, attempt-1, last)
+			}
+			return err
+		}
+
+		err := fn(ctx)
+		if err == nil {
+			r.breaker.Success()
+			return nil
+		}
+		class := r.Classify(err)
+		r.report(err, class)
+		if class != Transient {
+			return err
+		}
+		last = err
+
+		if r.config.MaxAttempts > 0 && attempt >= r.config.MaxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+		timer := time.NewTimer(r.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the wait time after the given failed attempt.
+func (r *Retrier) backoff(attempt int) time.Duration {
+	wait := float64(r.config.InitialBackoff) * math.Pow(r.config.Multiplier, float64(attempt-1))
+	if wait > float64(r.config.MaxBackoff) {
+		wait = float64(r.config.MaxBackoff)
+	}
+	//nolint:gosec // jitter doesn't need a secure random source
+	wait *= 1 + r.config.Jitter*(2*rand.Float64()-1)
+	return time.Duration(wait)
+}
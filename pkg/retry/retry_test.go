@@ -0,0 +1,207 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testRetryConfig() RetryConfig {
+	config := DefaultRetryConfig()
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = 2 * time.Millisecond
+	config.Breaker.FailureThreshold = 0
+	return config
+}
+
+// failing returns a call that fails with the given errors, then succeeds.
+func failing(errs ...error) (func(context.Context) error, *int) {
+	calls := 0
+	return func(context.Context) error {
+		calls++
+		if calls <= len(errs) {
+			return errs[calls-1]
+		}
+		return nil
+	}, &calls
+}
+
+func TestDo(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "shipper is restarting")
+	exhausted := status.Error(codes.ResourceExhausted, "queue is full")
+	invalid := status.Error(codes.InvalidArgument, "bad event")
+
+	cases := []struct {
+		name        string
+		maxAttempts int
+		errs        []error
+		calls       int
+		expErr      error
+	}{
+		{
+			name:  "success",
+			calls: 1,
+		},
+		{
+			name:  "transient errors are retried",
+			errs:  []error{unavailable, exhausted, unavailable},
+			calls: 4,
+		},
+		{
+			name:   "permanent errors are returned right away",
+			errs:   []error{unavailable, invalid},
+			calls:  2,
+			expErr: invalid,
+		},
+		{
+			name:        "gives up after max attempts",
+			maxAttempts: 3,
+			errs:        []error{unavailable, unavailable, exhausted, unavailable},
+			calls:       3,
+			expErr:      exhausted,
+		},
+		{
+			name:        "negative max attempts disables retries",
+			maxAttempts: -1,
+			errs:        []error{unavailable},
+			calls:       1,
+			expErr:      unavailable,
+		},
+		{
+			name:        "zero max attempts retries until success",
+			maxAttempts: 0,
+			errs:        []error{unavailable, unavailable, unavailable, unavailable, unavailable, unavailable},
+			calls:       7,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := testRetryConfig()
+			config.MaxAttempts = tc.maxAttempts
+			fn, calls := failing(tc.errs...)
+
+			err := New(config).Do(context.Background(), fn)
+			require.Equal(t, tc.calls, *calls)
+			if tc.expErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tc.expErr)
+		})
+	}
+}
+
+func TestDoContextDone(t *testing.T) {
+	config := testRetryConfig()
+	config.MaxAttempts = 0
+	config.InitialBackoff = time.Hour
+	config.MaxBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	unavailable := status.Error(codes.Unavailable, "down")
+	err := New(config).Do(ctx, func(context.Context) error { return unavailable })
+	require.ErrorIs(t, err, unavailable)
+}
+
+func TestClassify(t *testing.T) {
+	r := New(RetryConfig{RetryableCodes: []codes.Code{codes.Unavailable, codes.Aborted}})
+	require.Equal(t, Transient, r.Classify(status.Error(codes.Aborted, "")))
+	require.Equal(t, Permanent, r.Classify(status.Error(codes.ResourceExhausted, "")))
+	require.Equal(t, Permanent, r.Classify(errors.New("not a status")))
+	require.Equal(t, Permanent, r.Classify(status.Error(codes.DeadlineExceeded, "")))
+	require.Equal(t, Canceled, r.Classify(status.Error(codes.Canceled, "")))
+	require.Equal(t, Canceled, r.Classify(context.Canceled))
+	require.Equal(t, Canceled, r.Classify(fmt.Errorf("publish: %w", context.DeadlineExceeded)))
+}
+
+func TestDoBreakerOutcome(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected State
+	}{
+		{name: "transient", err: status.Error(codes.Unavailable, ""), expected: Open},
+		{name: "deadline exceeded", err: status.Error(codes.DeadlineExceeded, ""), expected: Open},
+		{name: "permanent", err: status.Error(codes.InvalidArgument, ""), expected: Closed},
+		{name: "canceled", err: status.Error(codes.Canceled, ""), expected: HalfOpen},
+		{name: "context error", err: context.DeadlineExceeded, expected: HalfOpen},
+		{name: "not a status", err: errors.New("marshal failed"), expected: HalfOpen},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := testRetryConfig()
+			config.MaxAttempts = -1
+			config.Breaker = BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}
+			r := New(config)
+			now := time.Now()
+			r.Breaker().now = func() time.Time { return now }
+			r.Breaker().Failure()
+			now = now.Add(time.Minute)
+
+			// the result of the probe decides the state
+			require.ErrorIs(t, r.Do(context.Background(), func(context.Context) error { return tc.err }), tc.err)
+			require.Equal(t, tc.expected, r.Breaker().State())
+			if tc.expected == HalfOpen {
+				require.NoError(t, r.Breaker().Allow(), "another call can probe")
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := New(RetryConfig{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+		Jitter:         0.1,
+	})
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, exp := range expected {
+		exp *= time.Millisecond
+		wait := r.backoff(i + 1)
+		require.InDelta(t, float64(exp), float64(wait), float64(exp)/10, "attempt %d", i+1)
+	}
+}
+
+func TestDoCircuitBreaker(t *testing.T) {
+	config := testRetryConfig()
+	config.MaxAttempts = 0
+	config.Breaker = BreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute}
+	r := New(config)
+	now := time.Now()
+	r.Breaker().now = func() time.Time { return now }
+
+	unavailable := status.Error(codes.Unavailable, "down")
+	fn, calls := failing(unavailable, unavailable, unavailable, unavailable)
+	err := r.Do(context.Background(), fn)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.ErrorContains(t, err, "after 3 attempts")
+	require.Equal(t, 3, *calls)
+
+	// rejected without calling
+	require.ErrorIs(t, r.Do(context.Background(), fn), ErrCircuitOpen)
+	require.Equal(t, 3, *calls)
+
+	// the probe fails and opens the breaker again
+	now = now.Add(time.Minute)
+	require.ErrorIs(t, r.Do(context.Background(), fn), ErrCircuitOpen)
+	require.Equal(t, 4, *calls)
+	require.Equal(t, Open, r.Breaker().State())
+
+	// a successful probe closes it
+	now = now.Add(time.Minute)
+	require.NoError(t, r.Do(context.Background(), fn))
+	require.Equal(t, 5, *calls)
+	require.Equal(t, Closed, r.Breaker().State())
+}
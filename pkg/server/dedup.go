@@ -0,0 +1,258 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package server
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Defaults of DedupOptions.
+const (
+	DefaultDedupWindow     = 1024
+	DefaultDedupMaxStreams = 10000
+)
+
+// DedupOptions configures a Deduplicator.
+type DedupOptions struct {
+	// Window is how many numbers below the highest one of a stream are
+	// remembered, so events published out of order within the window are
+	// still recognized. Older numbers are considered seen. Defaults to
+	// DefaultDedupWindow.
+	Window int
+	// MaxStreams is the max number of streams remembered, the least
+	// recently used ones are forgotten first. Defaults to
+	// DefaultDedupMaxStreams.
+	MaxStreams int
+}
+
+// Deduplicator recognizes the events already received from their sequence,
+// see helpers.Sequence. Events without a valid sequence are never
+// duplicates. It is safe for concurrent use.
+type Deduplicator struct {
+	opts DedupOptions
+
+	mu      sync.Mutex
+	streams map[string]*list.Element
+	lru     *list.List
+}
+
+// seqStream holds the numbers seen of a stream: the highest one, and a
+// bitmap of the window below it indexed by number modulo the window size.
+type seqStream struct {
+	key  string
+	max  uint64
+	seen []uint64
+}
+
+// NewDeduplicator returns an empty Deduplicator. Zero values in opts are
+// replaced by their defaults.
+func NewDeduplicator(opts DedupOptions) *Deduplicator {
+	if opts.Window <= 0 {
+		opts.Window = DefaultDedupWindow
+	}
+	if opts.MaxStreams <= 0 {
+		opts.MaxStreams = DefaultDedupMaxStreams
+	}
+	return &Deduplicator{opts: opts, streams: map[string]*list.Element{}, lru: list.New()}
+}
+
+func sequenceOf(e *messages.Event) (string, uint64, bool) {
+	seq, ok, err := helpers.GetSequence(e)
+	if !ok || err != nil {
+		return "", 0, false
+	}
+	return helpers.SequenceStream(e, seq.Producer), seq.Number, true
+}
+
+// Seen returns whether the event was marked already.
+func (d *Deduplicator) Seen(e *messages.Event) bool {
+	key, number, ok := sequenceOf(e)
+	if !ok {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	elem, ok := d.streams[key]
+	if !ok {
+		return false
+	}
+	d.lru.MoveToFront(elem)
+	return elem.Value.(*seqStream).has(number, uint64(d.opts.Window))
+}
+
+// Mark records the event as received. It must be called once the event is
+// stored, marking an event that can be lost drops its retries.
+func (d *Deduplicator) Mark(e *messages.Event) {
+	key, number, ok := sequenceOf(e)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	elem, ok := d.streams[key]
+	if ok {
+		d.lru.MoveToFront(elem)
+	} else {
+		elem = d.lru.PushFront(&seqStream{key: key, seen: make([]uint64, (d.opts.Window+63)/64)})
+		d.streams[key] = elem
+		for d.lru.Len() > d.opts.MaxStreams {
+			oldest := d.lru.Back()
+			d.lru.Remove(oldest)
+			delete(d.streams, oldest.Value.(*seqStream).key)
+		}
+	}
+	elem.Value.(*seqStream).add(number, uint64(d.opts.Window))
+}
+
+// Len returns the number of streams remembered.
+func (d *Deduplicator) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lru.Len()
+}
+
+func (s *seqStream) has(number, window uint64) bool {
+	switch {
+	case number > s.max:
+		return false
+	case s.max-number >= window:
+		return true
+	}
+	return s.bit(number, window)
+}
+
+func (s *seqStream) add(number, window uint64) {
+	if number > s.max {
+		// forget the numbers leaving the window
+		if number-s.max >= window {
+			for i := range s.seen {
+				s.seen[i] = 0
+			}
+		} else {
+			for n := s.max + 1; n < number; n++ {
+				s.setBit(n, window, false)
+			}
+		}
+		s.max = number
+	} else if s.max-number >= window {
+		return
+	}
+	s.setBit(number, window, true)
+}
+
+func (s *seqStream) bit(number, window uint64) bool {
+	i := number % window
+	return s.seen[i/64]&(1<<(i%64)) != 0
+}
+
+func (s *seqStream) setBit(number, window uint64, on bool) {
+	i := number % window
+	if on {
+		s.seen[i/64] |= 1 << (i % 64)
+	} else {
+		s.seen[i/64] &^= 1 << (i % 64)
+	}
+}
+
+// dedupQueue is the Queue of NewDedupQueue.
+type dedupQueue struct {
+	queue Queue
+	dedup *Deduplicator
+
+	mu sync.Mutex
+	// stored is the number of events passed to the queue
+	stored uint64
+	// pending are the duplicates reported as accepted but not yet as
+	// persisted, with the number of stored events before them
+	pending []dupRun
+	// persistedDups is the number of duplicates reported as persisted
+	persistedDups uint64
+}
+
+type dupRun struct {
+	after uint64
+	count uint64
+}
+
+// NewDedupQueue returns a Queue passing to queue the events not seen by
+// dedup, and marking them once accepted. Duplicates are reported as
+// accepted, so the client doesn't retry them, and as persisted once the
+// events accepted before them are persisted.
+func NewDedupQueue(queue Queue, dedup *Deduplicator) Queue {
+	return &dedupQueue{queue: queue, dedup: dedup}
+}
+
+// Publish implements Queue.
+func (q *dedupQueue) Publish(ctx context.Context, events []*messages.Event) (int, error) {
+	fresh := make([]*messages.Event, 0, len(events))
+	// index in events of every fresh event
+	indexes := make([]int, 0, len(events))
+	// duplicates within the request, their original isn't marked yet
+	inRequest := map[string]struct{}{}
+	for i, e := range events {
+		if q.dedup.Seen(e) {
+			continue
+		}
+		if key, number, ok := sequenceOf(e); ok {
+			id := fmt.Sprintf("%s/%d", key, number)
+			if _, dup := inRequest[id]; dup {
+				continue
+			}
+			inRequest[id] = struct{}{}
+		}
+		fresh = append(fresh, e)
+		indexes = append(indexes, i)
+	}
+
+	var accepted int
+	var err error
+	if len(fresh) > 0 {
+		accepted, err = q.queue.Publish(ctx, fresh)
+		if accepted < 0 || accepted > len(fresh) {
+			return 0, fmt.Errorf("the queue accepted %d events out of %d", accepted, len(fresh))
+		}
+	}
+	// the duplicates up to the first event not accepted are accepted too
+	end := len(events)
+	if accepted < len(fresh) {
+		end = indexes[accepted]
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	next := 0
+	for i, e := range events[:end] {
+		if next < len(indexes) && indexes[next] == i {
+			q.dedup.Mark(e)
+			q.stored++
+			next++
+			continue
+		}
+		if n := len(q.pending); n > 0 && q.pending[n-1].after == q.stored {
+			q.pending[n-1].count++
+		} else {
+			q.pending = append(q.pending, dupRun{after: q.stored, count: 1})
+		}
+	}
+	return end, err
+}
+
+// PersistedIndex implements Queue.
+func (q *dedupQueue) PersistedIndex() uint64 {
+	persisted := q.queue.PersistedIndex()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) > 0 && q.pending[0].after <= persisted {
+		q.persistedDups += q.pending[0].count
+		q.pending = q.pending[1:]
+	}
+	return persisted + q.persistedDups
+}
@@ -0,0 +1,97 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func sequenced(producer string, numbers ...uint64) []*messages.Event {
+	events := make([]*messages.Event, len(numbers))
+	for i, number := range numbers {
+		events[i] = &messages.Event{Source: &messages.Source{InputId: "test"}}
+		helpers.SetSequence(events[i], helpers.Sequence{Producer: producer, Number: number})
+	}
+	return events
+}
+
+func TestDeduplicator(t *testing.T) {
+	d := NewDeduplicator(DedupOptions{Window: 4, MaxStreams: 2})
+	for _, e := range sequenced("a", 1, 2, 5) {
+		require.False(t, d.Seen(e))
+		d.Mark(e)
+		require.True(t, d.Seen(e))
+	}
+	// out of order within the window
+	late := sequenced("a", 3, 4)
+	require.False(t, d.Seen(late[0]))
+	d.Mark(late[0])
+	require.True(t, d.Seen(late[0]))
+	require.False(t, d.Seen(late[1]))
+
+	// older than the window
+	d.Mark(sequenced("a", 10)[0])
+	require.True(t, d.Seen(late[1]))
+	require.False(t, d.Seen(sequenced("a", 7)[0]))
+
+	// other producers are other streams
+	require.False(t, d.Seen(sequenced("b", 1)[0]))
+	require.False(t, d.Seen(events(1)[0]))
+	d.Mark(sequenced("b", 1)[0])
+	d.Mark(sequenced("c", 1)[0])
+	require.Equal(t, 2, d.Len())
+	require.False(t, d.Seen(sequenced("a", 1)[0]), "the least recently used stream is forgotten")
+}
+
+func TestDedupQueue(t *testing.T) {
+	inner := &memQueue{size: 4}
+	q := NewDedupQueue(inner, NewDeduplicator(DedupOptions{}))
+	ctx := context.Background()
+
+	accepted, err := q.Publish(ctx, sequenced("a", 1, 2, 2, 3))
+	require.NoError(t, err)
+	require.Equal(t, 4, accepted)
+	require.Len(t, inner.events, 3)
+
+	// the retry of a request whose reply was lost
+	accepted, err = q.Publish(ctx, append(sequenced("a", 2, 3, 4, 5), events(1)...))
+	require.NoError(t, err)
+	require.Equal(t, 3, accepted, "the queue is full after 4")
+	require.Len(t, inner.events, 4)
+
+	accepted, err = q.Publish(ctx, sequenced("a", 1))
+	require.NoError(t, err)
+	require.Equal(t, 1, accepted)
+
+	// the duplicates are persisted with the events before them
+	require.Zero(t, q.PersistedIndex())
+	inner.persist(2)
+	require.Equal(t, uint64(3), q.PersistedIndex())
+	inner.persist(3)
+	require.Equal(t, uint64(6), q.PersistedIndex())
+	inner.persist(4)
+	require.Equal(t, uint64(8), q.PersistedIndex())
+}
+
+func TestServerDedup(t *testing.T) {
+	srv, err := New(NewDedupQueue(&memQueue{size: 10}, NewDeduplicator(DedupOptions{})), Options{})
+	require.NoError(t, err)
+	c := startServer(t, srv)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		reply, err := c.PublishEvents(ctx, &messages.PublishRequest{Events: sequenced("a", 1, 2)})
+		require.NoError(t, err)
+		require.Equal(t, uint32(2), reply.AcceptedCount)
+	}
+	accepted, _ := srv.Indexes()
+	require.Equal(t, uint64(4), accepted)
+}
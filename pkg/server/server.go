@@ -0,0 +1,211 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package server provides the scaffolding of a shipper Producer service, so
+// shipper implementations can be built on the protocol definitions of this
+// module: the Server handles the process uuid, the accepted and persisted
+// index bookkeeping and the PersistedIndex subscriptions, and stores the
+// events in a Queue.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/helpers"
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Queue is the backend storing the published events.
+type Queue interface {
+	// Publish adds the events to the queue, in order, and returns how many
+	// of them were accepted, from the first one. It accepts fewer events
+	// when the queue is full, the client retries the others later. Errors
+	// that are gRPC statuses are returned to the client as they are, the
+	// others as Internal errors.
+	Publish(ctx context.Context, events []*messages.Event) (accepted int, err error)
+	// PersistedIndex returns how many of the accepted events have been
+	// persisted, the first ones in order, since the queue was created.
+	PersistedIndex() uint64
+}
+
+// DefaultMinPollingInterval is the default of Options.MinPollingInterval.
+const DefaultMinPollingInterval = 100 * time.Millisecond
+
+// Options configures a Server.
+type Options struct {
+	// UUID of the shipper process. Defaults to a random UUID, it must
+	// change when the process restarts.
+	UUID string
+	// MaxMessageSize is the max size of the received requests, see
+	// ServerOptions. Zero keeps the default of gRPC, 4MiB.
+	MaxMessageSize int
+	// MinPollingInterval is the shortest interval between the checks of the
+	// persisted index of a subscription, shorter requested intervals are
+	// raised to it. Defaults to DefaultMinPollingInterval.
+	MinPollingInterval time.Duration
+}
+
+// Server implements the Producer service on top of a Queue. The events are
+// numbered from 1 in the order they are accepted, the accepted index of a
+// reply is the number of the last accepted event. Publish requests are
+// passed to the queue one at a time, so the numbering follows the order of
+// the queue. It is safe for concurrent use.
+type Server struct {
+	pb.UnimplementedProducerServer
+
+	queue Queue
+	opts  Options
+
+	// publishMu serializes the calls to the queue, mu guards the index so
+	// the subscriptions aren't blocked by a slow queue
+	publishMu     sync.Mutex
+	mu            sync.Mutex
+	acceptedIndex uint64
+}
+
+// New returns a server storing the events in queue.
+func New(queue Queue, opts Options) (*Server, error) {
+	if queue == nil {
+		return nil, errors.New("a queue is required")
+	}
+	if opts.MaxMessageSize < 0 {
+		return nil, fmt.Errorf("invalid max message size %d", opts.MaxMessageSize)
+	}
+	if opts.UUID == "" {
+		uuid, err := helpers.NewUUID()
+		if err != nil {
+			return nil, fmt.Errorf("error generating the shipper uuid: %w", err)
+		}
+		opts.UUID = uuid.String()
+	}
+	if opts.MinPollingInterval <= 0 {
+		opts.MinPollingInterval = DefaultMinPollingInterval
+	}
+	return &Server{queue: queue, opts: opts}, nil
+}
+
+// Register registers the Producer service of s in r.
+func (s *Server) Register(r grpc.ServiceRegistrar) {
+	pb.RegisterProducerServer(r, s)
+}
+
+// ServerOptions returns the options to create the gRPC server with, for the
+// max message size.
+func (s *Server) ServerOptions() []grpc.ServerOption {
+	if s.opts.MaxMessageSize == 0 {
+		return nil
+	}
+	return []grpc.ServerOption{grpc.MaxRecvMsgSize(s.opts.MaxMessageSize)}
+}
+
+// UUID returns the uuid of the shipper process.
+func (s *Server) UUID() string {
+	return s.opts.UUID
+}
+
+// Indexes returns the current accepted and persisted indexes.
+func (s *Server) Indexes() (accepted, persisted uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acceptedIndex, s.persistedIndex()
+}
+
+// persistedIndex returns the persisted index of the queue, which can't go
+// past the accepted index. s.mu must be held.
+func (s *Server) persistedIndex() uint64 {
+	persisted := s.queue.PersistedIndex()
+	if persisted > s.acceptedIndex {
+		return s.acceptedIndex
+	}
+	return persisted
+}
+
+// PublishEvents implements the Producer service. Requests for another
+// shipper process, whose uuid doesn't match, accept no events.
+func (s *Server) PublishEvents(ctx context.Context, req *messages.PublishRequest) (*messages.PublishReply, error) {
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+
+	reply := &messages.PublishReply{Uuid: s.opts.UUID, AcceptedIndex: s.accepted()}
+	if req.GetUuid() != "" && req.GetUuid() != s.opts.UUID {
+		return reply, nil
+	}
+	if len(req.GetEvents()) == 0 {
+		return reply, nil
+	}
+
+	accepted, err := s.queue.Publish(ctx, req.GetEvents())
+	if accepted < 0 || accepted > len(req.GetEvents()) {
+		return nil, status.Errorf(codes.Internal, "the queue accepted %d events out of %d", accepted, len(req.GetEvents()))
+	}
+	// the accepted events are in the queue, even if it failed afterwards
+	s.mu.Lock()
+	s.acceptedIndex += uint64(accepted)
+	reply.AcceptedIndex = s.acceptedIndex
+	s.mu.Unlock()
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "error publishing events: %v", err)
+	}
+
+	reply.AcceptedCount = uint32(accepted)
+	return reply, nil
+}
+
+func (s *Server) accepted() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acceptedIndex
+}
+
+// PersistedIndex implements the Producer service. The current value is sent
+// right away then, if the polling interval is set, every time it changes.
+func (s *Server) PersistedIndex(req *messages.PersistedIndexRequest, stream pb.Producer_PersistedIndexServer) error {
+	reply := s.persistedIndexReply()
+	if err := stream.Send(reply); err != nil {
+		return err
+	}
+
+	interval := req.GetPollingInterval().AsDuration()
+	if interval <= 0 {
+		return nil
+	}
+	if interval < s.opts.MinPollingInterval {
+		interval = s.opts.MinPollingInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+			next := s.persistedIndexReply()
+			if next.PersistedIndex == reply.PersistedIndex {
+				continue
+			}
+			reply = next
+			if err := stream.Send(reply); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) persistedIndexReply() *messages.PersistedIndexReply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &messages.PersistedIndexReply{Uuid: s.opts.UUID, PersistedIndex: s.persistedIndex()}
+}
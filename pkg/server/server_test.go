@@ -0,0 +1,175 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// memQueue holds up to size events, and persists them when told to.
+type memQueue struct {
+	mu        sync.Mutex
+	size      int
+	events    []*messages.Event
+	persisted uint64
+	err       error
+}
+
+func (q *memQueue) Publish(_ context.Context, events []*messages.Event) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err != nil {
+		return 0, q.err
+	}
+	n := q.size - len(q.events)
+	if n > len(events) {
+		n = len(events)
+	}
+	q.events = append(q.events, events[:n]...)
+	return n, nil
+}
+
+func (q *memQueue) PersistedIndex() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.persisted
+}
+
+func (q *memQueue) persist(n uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.persisted = n
+}
+
+func startServer(t *testing.T, srv *Server) pb.ProducerClient {
+	listener := bufconn.Listen(1024 * 1024)
+	g := grpc.NewServer(srv.ServerOptions()...)
+	srv.Register(g)
+	go func() {
+		_ = g.Serve(listener)
+	}()
+	t.Cleanup(g.Stop)
+
+	conn, err := grpc.Dial("passthrough:///server",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewProducerClient(conn)
+}
+
+func events(n int) []*messages.Event {
+	events := make([]*messages.Event, n)
+	for i := range events {
+		events[i] = &messages.Event{Source: &messages.Source{InputId: "test"}}
+	}
+	return events
+}
+
+func TestPublishEvents(t *testing.T) {
+	queue := &memQueue{size: 5}
+	srv, err := New(queue, Options{})
+	require.NoError(t, err)
+	require.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, srv.UUID())
+	c := startServer(t, srv)
+	ctx := context.Background()
+
+	reply, err := c.PublishEvents(ctx, &messages.PublishRequest{Events: events(3)})
+	require.NoError(t, err)
+	require.Equal(t, srv.UUID(), reply.Uuid)
+	require.Equal(t, uint32(3), reply.AcceptedCount)
+	require.Equal(t, uint64(3), reply.AcceptedIndex)
+
+	// the queue is full after two more events
+	reply, err = c.PublishEvents(ctx, &messages.PublishRequest{Uuid: srv.UUID(), Events: events(3)})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), reply.AcceptedCount)
+	require.Equal(t, uint64(5), reply.AcceptedIndex)
+
+	// requests for another shipper process are rejected
+	reply, err = c.PublishEvents(ctx, &messages.PublishRequest{Uuid: "other", Events: events(1)})
+	require.NoError(t, err)
+	require.Zero(t, reply.AcceptedCount)
+	require.Equal(t, uint64(5), reply.AcceptedIndex)
+
+	queue.err = status.Error(codes.Unavailable, "closing")
+	_, err = c.PublishEvents(ctx, &messages.PublishRequest{Events: events(1)})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	queue.err = errors.New("disk full")
+	_, err = c.PublishEvents(ctx, &messages.PublishRequest{Events: events(1)})
+	require.Equal(t, codes.Internal, status.Code(err))
+
+	accepted, persisted := srv.Indexes()
+	require.Equal(t, uint64(5), accepted)
+	require.Zero(t, persisted)
+	require.Len(t, queue.events, 5)
+}
+
+func TestPersistedIndex(t *testing.T) {
+	queue := &memQueue{size: 10}
+	srv, err := New(queue, Options{UUID: "shipper-1", MinPollingInterval: time.Millisecond})
+	require.NoError(t, err)
+	c := startServer(t, srv)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err = c.PublishEvents(ctx, &messages.PublishRequest{Events: events(10)})
+	require.NoError(t, err)
+
+	// a single reply without a polling interval
+	stream, err := c.PersistedIndex(ctx, &messages.PersistedIndexRequest{})
+	require.NoError(t, err)
+	reply, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "shipper-1", reply.Uuid)
+	require.Zero(t, reply.PersistedIndex)
+	_, err = stream.Recv()
+	require.Error(t, err)
+
+	stream, err = c.PersistedIndex(ctx, &messages.PersistedIndexRequest{PollingInterval: durationpb.New(time.Millisecond)})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	queue.persist(4)
+	reply, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), reply.PersistedIndex)
+
+	// capped at the accepted index
+	queue.persist(20)
+	reply, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), reply.PersistedIndex)
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	srv, err := New(&memQueue{size: 10}, Options{MaxMessageSize: 100})
+	require.NoError(t, err)
+	c := startServer(t, srv)
+
+	_, err = c.PublishEvents(context.Background(), &messages.PublishRequest{Events: events(20)})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = New(nil, Options{})
+	require.Error(t, err)
+}
@@ -0,0 +1,265 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package servertest provides an in-memory shipper for testing clients
+// without a running shipper process.
+package servertest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+// Target is the address to use when dialing the server with DialOption.
+const Target = "passthrough:///servertest"
+
+// Options configures a Server.
+type Options struct {
+	// UUID of the simulated shipper process. Defaults to "servertest".
+	UUID string
+	// AutoPersist marks accepted events as persisted immediately.
+	AutoPersist bool
+	// DiscardEvents doesn't record the published requests and events, to
+	// keep the memory flat in benchmarks.
+	DiscardEvents bool
+	// ServerOptions are used to create the underlying gRPC server.
+	ServerOptions []grpc.ServerOption
+}
+
+// Server implements the shipper Producer service in memory. It records the
+// published events and lets tests control accepted counts, errors and the
+// persisted index. It is safe for concurrent use.
+type Server struct {
+	pb.UnimplementedProducerServer
+
+	opts     Options
+	listener *bufconn.Listener
+	grpc     *grpc.Server
+
+	mu             sync.Mutex
+	uuid           string
+	requests       []*messages.PublishRequest
+	events         []*messages.Event
+	acceptLimit    int
+	publishHeader  metadata.MD
+	publishErrors  []error
+	acceptedIndex  uint64
+	persistedIndex uint64
+}
+
+// New creates a server, it must be started with Start.
+func New(opts Options) *Server {
+	if opts.UUID == "" {
+		opts.UUID = "servertest"
+	}
+	return &Server{
+		opts:     opts,
+		uuid:     opts.UUID,
+		listener: bufconn.Listen(1024 * 1024),
+	}
+}
+
+// Start serves the Producer service on an in-memory listener.
+func (s *Server) Start() {
+	s.grpc = grpc.NewServer(s.opts.ServerOptions...)
+	pb.RegisterProducerServer(s.grpc, s)
+	go func() {
+		_ = s.grpc.Serve(s.listener)
+	}()
+}
+
+// Stop stops the server, closing all open connections and streams.
+func (s *Server) Stop() {
+	if s.grpc != nil {
+		s.grpc.Stop()
+	}
+}
+
+// DialOption returns the dial option connecting to the in-memory listener.
+// Use it with Target as the address.
+func (s *Server) DialOption() grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return s.listener.DialContext(ctx)
+	})
+}
+
+// Dial opens an insecure client connection to the server.
+func (s *Server) Dial(ctx context.Context, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		s.DialOption(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	return grpc.DialContext(ctx, Target, opts...)
+}
+
+// PublishEvents implements the Producer service.
+func (s *Server) PublishEvents(ctx context.Context, req *messages.PublishRequest) (*messages.PublishReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.publishHeader != nil {
+		if err := grpc.SetHeader(ctx, s.publishHeader); err != nil {
+			return nil, err
+		}
+	}
+
+	if !s.opts.DiscardEvents {
+		s.requests = append(s.requests, req)
+	}
+	if len(s.publishErrors) > 0 {
+		err := s.publishErrors[0]
+		s.publishErrors = s.publishErrors[1:]
+		return nil, err
+	}
+
+	reply := &messages.PublishReply{Uuid: s.uuid}
+	if req.GetUuid() != "" && req.GetUuid() != s.uuid {
+		reply.AcceptedIndex = s.acceptedIndex
+		return reply, nil
+	}
+
+	accepted := req.GetEvents()
+	if s.acceptLimit > 0 && len(accepted) > s.acceptLimit {
+		accepted = accepted[:s.acceptLimit]
+	}
+	if !s.opts.DiscardEvents {
+		s.events = append(s.events, accepted...)
+	}
+	s.acceptedIndex += uint64(len(accepted))
+	if s.opts.AutoPersist {
+		s.persistedIndex = s.acceptedIndex
+	}
+
+	reply.AcceptedCount = uint32(len(accepted))
+	reply.AcceptedIndex = s.acceptedIndex
+	return reply, nil
+}
+
+// PersistedIndex implements the Producer service. The current value is sent
+// right away, then every polling interval if it changed.
+func (s *Server) PersistedIndex(req *messages.PersistedIndexRequest, stream pb.Producer_PersistedIndexServer) error {
+	reply := s.persistedIndexReply()
+	if err := stream.Send(reply); err != nil {
+		return err
+	}
+
+	interval := req.GetPollingInterval().AsDuration()
+	if interval <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+			next := s.persistedIndexReply()
+			if next.PersistedIndex == reply.PersistedIndex && next.Uuid == reply.Uuid {
+				continue
+			}
+			reply = next
+			if err := stream.Send(reply); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) persistedIndexReply() *messages.PersistedIndexReply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &messages.PersistedIndexReply{Uuid: s.uuid, PersistedIndex: s.persistedIndex}
+}
+
+// SetAcceptLimit limits how many events of each request are accepted.
+// Zero accepts all events.
+func (s *Server) SetAcceptLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acceptLimit = limit
+}
+
+// SetPublishHeader sets the reply headers of the next calls to
+// PublishEvents, nil sends none.
+func (s *Server) SetPublishHeader(header metadata.MD) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.publishHeader = header
+}
+
+// SetPublishErrors makes the next calls to PublishEvents fail, one error per call.
+func (s *Server) SetPublishErrors(errs ...error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.publishErrors = append(s.publishErrors[:0], errs...)
+}
+
+// Persist advances the persisted index. It can't go past the accepted index.
+func (s *Server) Persist(index uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index > s.acceptedIndex {
+		return fmt.Errorf("index %d has not been accepted, the accepted index is %d", index, s.acceptedIndex)
+	}
+	if index > s.persistedIndex {
+		s.persistedIndex = index
+	}
+	return nil
+}
+
+// PersistAll marks every accepted event as persisted.
+func (s *Server) PersistAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.persistedIndex = s.acceptedIndex
+}
+
+// Restart simulates a restart of the shipper process: the uuid changes and
+// the indexes are reset. Recorded events are kept.
+func (s *Server) Restart(uuid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uuid = uuid
+	s.acceptedIndex = 0
+	s.persistedIndex = 0
+}
+
+// UUID returns the uuid of the simulated shipper process.
+func (s *Server) UUID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uuid
+}
+
+// Events returns all the accepted events, in order.
+func (s *Server) Events() []*messages.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*messages.Event(nil), s.events...)
+}
+
+// Requests returns all the received publish requests, including the failed ones.
+func (s *Server) Requests() []*messages.PublishRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*messages.PublishRequest(nil), s.requests...)
+}
+
+// Indexes returns the current accepted and persisted indexes.
+func (s *Server) Indexes() (accepted, persisted uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acceptedIndex, s.persistedIndex
+}
@@ -0,0 +1,137 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package servertest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+)
+
+func newTestClient(t *testing.T, srv *Server) *client.Client {
+	srv.Start()
+	t.Cleanup(srv.Stop)
+
+	c, err := client.New(context.Background(), Target, client.Options{
+		MaxRetries:  -1,
+		DialOptions: []grpc.DialOption{srv.DialOption()},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func events(n int) []*messages.Event {
+	events := make([]*messages.Event, n)
+	for i := range events {
+		events[i] = &messages.Event{Source: &messages.Source{InputId: "test"}}
+	}
+	return events
+}
+
+func TestServerPublish(t *testing.T) {
+	srv := New(Options{UUID: "shipper-1"})
+	c := newTestClient(t, srv)
+	ctx := context.Background()
+
+	reply, err := c.Publish(ctx, &messages.PublishRequest{Events: events(3)})
+	require.NoError(t, err)
+	require.Equal(t, "shipper-1", reply.Uuid)
+	require.Equal(t, uint32(3), reply.AcceptedCount)
+	require.Equal(t, uint64(3), reply.AcceptedIndex)
+
+	srv.SetAcceptLimit(2)
+	reply, err = c.Publish(ctx, &messages.PublishRequest{Uuid: "shipper-1", Events: events(5)})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), reply.AcceptedCount)
+	require.Equal(t, uint64(5), reply.AcceptedIndex)
+
+	// requests for another shipper process are rejected
+	reply, err = c.Publish(ctx, &messages.PublishRequest{Uuid: "shipper-0", Events: events(1)})
+	require.NoError(t, err)
+	require.Zero(t, reply.AcceptedCount)
+
+	srv.SetPublishErrors(status.Error(codes.ResourceExhausted, "queue is full"))
+	_, err = c.Publish(ctx, &messages.PublishRequest{Events: events(1)})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	require.Len(t, srv.Events(), 5)
+	require.Len(t, srv.Requests(), 4)
+}
+
+func TestServerPersistedIndex(t *testing.T) {
+	srv := New(Options{})
+	c := newTestClient(t, srv)
+
+	_, err := c.Publish(context.Background(), &messages.PublishRequest{Events: events(10)})
+	require.NoError(t, err)
+	require.Error(t, srv.Persist(11))
+
+	errDone := errors.New("done")
+	var indexes []uint64
+	err = c.SubscribePersistedIndex(context.Background(), time.Millisecond, func(reply *messages.PersistedIndexReply) error {
+		indexes = append(indexes, reply.PersistedIndex)
+		switch reply.PersistedIndex {
+		case 0:
+			require.NoError(t, srv.Persist(4))
+		case 4:
+			srv.PersistAll()
+		case 10:
+			return errDone
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errDone)
+	require.Equal(t, []uint64{0, 4, 10}, indexes)
+}
+
+func TestServerRestart(t *testing.T) {
+	srv := New(Options{AutoPersist: true})
+	c := newTestClient(t, srv)
+
+	_, err := c.Publish(context.Background(), &messages.PublishRequest{Events: events(2)})
+	require.NoError(t, err)
+	accepted, persisted := srv.Indexes()
+	require.Equal(t, uint64(2), accepted)
+	require.Equal(t, uint64(2), persisted)
+
+	srv.Restart("restarted")
+	reply, err := c.Publish(context.Background(), &messages.PublishRequest{Events: events(1)})
+	require.NoError(t, err)
+	require.Equal(t, "restarted", reply.Uuid)
+	require.Equal(t, uint64(1), reply.AcceptedIndex)
+}
+
+func TestServerDiscardEvents(t *testing.T) {
+	srv := New(Options{DiscardEvents: true})
+	c := newTestClient(t, srv)
+
+	reply, err := c.Publish(context.Background(), &messages.PublishRequest{Events: events(3)})
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), reply.AcceptedCount)
+	require.Empty(t, srv.Events())
+	require.Empty(t, srv.Requests())
+}
+
+func TestServerPublishHeader(t *testing.T) {
+	srv := New(Options{})
+	c := newTestClient(t, srv)
+	srv.SetPublishHeader(metadata.Pairs("queue-pressure", "0.5"))
+
+	var header metadata.MD
+	_, err := c.Publish(context.Background(), &messages.PublishRequest{Events: events(1)}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Equal(t, []string{"0.5"}, header.Get("queue-pressure"))
+}
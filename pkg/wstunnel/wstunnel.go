@@ -0,0 +1,225 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package wstunnel tunnels the gRPC connections of the shipper protocol in
+// WebSocket connections, for the producers behind proxies that only let
+// HTTP/1.1 through. The whole protocol is supported, including the
+// persisted index stream: the WebSocket binary frames carry the bytes of the
+// HTTP/2 connection of gRPC.
+//
+// On the shipper side, a Listener is an http.Handler accepting the
+// WebSocket connections and the net.Listener they are served from:
+//
+//	lis := wstunnel.NewListener(nil)
+//	http.Handle("/shipper", lis)
+//	go grpcServer.Serve(lis)
+//
+// On the producer side, DialOption makes gRPC dial the WebSocket endpoint:
+//
+//	client.New(ctx, "passthrough:///shipper", client.Options{
+//		DialOptions: []grpc.DialOption{wstunnel.DialOption("wss://shipper.example.com/shipper", nil)},
+//	})
+//
+// TLS is the job of the WebSocket connection, wss URLs, so gRPC is used
+// without transport security on top of it.
+package wstunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+)
+
+// ErrListenerClosed is returned by Listener.Accept once the listener is
+// closed.
+var ErrListenerClosed = errors.New("websocket listener closed")
+
+// Listener accepts the tunneled connections: it is the http.Handler of the
+// WebSocket endpoint and the net.Listener the gRPC server is served from.
+type Listener struct {
+	check  func(*http.Request) error
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewListener returns an open Listener. check, if not nil, is called with
+// the WebSocket handshake requests, the connections are refused if it
+// fails. It can authenticate the producers or check the origin of
+// browsers.
+func NewListener(check func(*http.Request) error) *Listener {
+	return &Listener{
+		check:  check,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+// ServeHTTP implements http.Handler, it upgrades the request to a WebSocket
+// connection handed to Accept, and returns once the connection is closed.
+func (l *Listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	websocket.Server{
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			if l.check == nil {
+				return nil
+			}
+			return l.check(r)
+		},
+		Handler: l.handle,
+	}.ServeHTTP(w, r)
+}
+
+func (l *Listener) handle(ws *websocket.Conn) {
+	ws.PayloadType = websocket.BinaryFrame
+	c := &serverConn{Conn: ws, done: make(chan struct{})}
+	select {
+	case l.conns <- c:
+	case <-l.closed:
+		return
+	}
+	// the connection is closed when the handler returns
+	<-c.done
+}
+
+// serverConn signals when it's closed, so the handler knows when to
+// return.
+type serverConn struct {
+	*websocket.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *serverConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
+// Accept implements net.Listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, ErrListenerClosed
+	}
+}
+
+// Close implements net.Listener, the new connections are refused. The
+// accepted ones are left open.
+func (l *Listener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+// Addr implements net.Listener.
+func (l *Listener) Addr() net.Addr {
+	return addr{}
+}
+
+type addr struct{}
+
+func (addr) Network() string { return "websocket" }
+func (addr) String() string  { return "websocket" }
+
+// DialConfig configures the WebSocket connections of the producers.
+type DialConfig struct {
+	// Header is added to the handshake requests, for authentication.
+	Header http.Header
+	// TLSConfig is used for the wss URLs.
+	TLSConfig *tls.Config
+	// Origin is the origin of the handshake requests, defaults to the
+	// endpoint URL with the http or https scheme.
+	Origin string
+}
+
+// Dial opens a WebSocket connection to the endpoint, a ws or wss URL. The
+// context bounds the handshake.
+func Dial(ctx context.Context, endpoint string, config *DialConfig) (net.Conn, error) {
+	if config == nil {
+		config = &DialConfig{}
+	}
+	location, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebSocket endpoint: %w", err)
+	}
+	origin := config.Origin
+	if origin == "" {
+		o := *location
+		o.Scheme = "http"
+		if location.Scheme == "wss" {
+			o.Scheme = "https"
+		}
+		origin = o.String()
+	}
+	wsConfig, err := websocket.NewConfig(endpoint, origin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebSocket endpoint: %w", err)
+	}
+	wsConfig.Header = config.Header
+	wsConfig.TlsConfig = config.TLSConfig
+
+	var conn net.Conn
+	switch location.Scheme {
+	case "ws":
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", hostPort(location, "80"))
+	case "wss":
+		conn, err = (&tls.Dialer{Config: config.TLSConfig}).DialContext(ctx, "tcp", hostPort(location, "443"))
+	default:
+		return nil, fmt.Errorf("invalid WebSocket endpoint scheme %q", location.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// bound the handshake by the context
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	ws, err := websocket.NewClient(wsConfig, conn)
+	close(stop)
+	<-stopped
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket handshake failed: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	ws.PayloadType = websocket.BinaryFrame
+	return ws, nil
+}
+
+func hostPort(location *url.URL, defaultPort string) string {
+	if location.Port() != "" {
+		return location.Host
+	}
+	return net.JoinHostPort(location.Hostname(), defaultPort)
+}
+
+// DialOption returns the gRPC dial options tunneling the connections to
+// the endpoint, a ws or wss URL, whatever the target is.
+func DialOption(endpoint string, config *DialConfig) grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return Dial(ctx, endpoint, config)
+	})
+}
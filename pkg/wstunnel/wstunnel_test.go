@@ -0,0 +1,94 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package wstunnel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/elastic/elastic-agent-shipper-client/pkg/client"
+	pb "github.com/elastic/elastic-agent-shipper-client/pkg/proto"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/proto/messages"
+	"github.com/elastic/elastic-agent-shipper-client/pkg/servertest"
+)
+
+// startTunnel serves srv through a WebSocket endpoint and returns its URL.
+func startTunnel(t *testing.T, srv *servertest.Server) string {
+	lis := NewListener(func(r *http.Request) error {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			return errors.New("unauthorized")
+		}
+		return nil
+	})
+	g := grpc.NewServer()
+	pb.RegisterProducerServer(g, srv)
+	go func() {
+		_ = g.Serve(lis)
+	}()
+	t.Cleanup(g.Stop)
+
+	httpServer := httptest.NewServer(lis)
+	t.Cleanup(httpServer.Close)
+	return "ws" + strings.TrimPrefix(httpServer.URL, "http")
+}
+
+func TestTunnel(t *testing.T) {
+	srv := servertest.New(servertest.Options{})
+	endpoint := startTunnel(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := client.New(ctx, "passthrough:///shipper", client.Options{
+		MaxRetries: -1,
+		DialOptions: []grpc.DialOption{DialOption(endpoint, &DialConfig{
+			Header: http.Header{"Authorization": []string{"Bearer secret"}},
+		})},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	reply, err := c.Publish(ctx, &messages.PublishRequest{Events: []*messages.Event{{}, {}}})
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), reply.AcceptedCount)
+	require.Len(t, srv.Events(), 2)
+
+	// the persisted index stream goes through the tunnel too
+	srv.PersistAll()
+	stream, err := c.PersistedIndex(ctx, &messages.PersistedIndexRequest{})
+	require.NoError(t, err)
+	index, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), index.PersistedIndex)
+}
+
+func TestDialRefused(t *testing.T) {
+	srv := servertest.New(servertest.Options{})
+	endpoint := startTunnel(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := Dial(ctx, endpoint, nil)
+	require.Error(t, err, "the check refuses the connection")
+
+	_, err = Dial(ctx, "http://localhost", nil)
+	require.Error(t, err)
+}
+
+func TestListenerClose(t *testing.T) {
+	lis := NewListener(nil)
+	require.NoError(t, lis.Close())
+	require.NoError(t, lis.Close())
+	_, err := lis.Accept()
+	require.ErrorIs(t, err, ErrListenerClosed)
+	require.Equal(t, "websocket", lis.Addr().Network())
+}